@@ -18,6 +18,8 @@ import (
 	awsauth "github.com/smartystreets/go-aws-auth"
 	"net/http"
 	"os"
+
+	"k8s.io/heapster/common/transport"
 )
 
 type AWSSigningTransport struct {
@@ -51,7 +53,7 @@ func createAWSClient() (*http.Client, error) {
 			AccessKeyID:     id,
 			SecretAccessKey: secret,
 		},
-		HTTPClient: http.DefaultClient,
+		HTTPClient: &http.Client{Transport: transport.Shared()},
 	}
 	return &http.Client{Transport: http.RoundTripper(signingTransport)}, nil
 }
@@ -27,8 +27,9 @@ import (
 )
 
 const (
-	ESIndex       = "heapster"
-	ESClusterName = "default"
+	ESIndex            = "heapster"
+	ESClusterName      = "default"
+	ESIndexDatePattern = "2006.01.02"
 )
 
 type ElasticSearchService struct {
@@ -36,13 +37,32 @@ type ElasticSearchService struct {
 	bulkProcessor *elastic.BulkProcessor
 	baseIndex     string
 	ClusterName   string
+	// Go time layout of the date suffix of the indices, a new index is created whenever it changes.
+	datePattern string
+	// Whether the cluster doesn't support mapping types, like Elasticsearch 7.x and OpenSearch.
+	// Every type then gets indices of its own, named like the aliases of the indices with types.
+	typeless bool
+	// Name of the ILM policy managing the indices, empty if they are created per date.
+	ilmPolicy string
+	// Rollover and deletion settings of the ILM policy, if Heapster manages it.
+	ilmMaxAge, ilmMaxSize, ilmDeleteAfter string
+	ilmPolicyCreated                      bool
+	// Indices and aliases known to exist. SaveData isn't safe for concurrent use, the sinks serialize
+	// their calls to it.
+	knownIndices map[string]bool
 }
 
 func (esSvc *ElasticSearchService) Index(date time.Time) string {
-	return date.Format(fmt.Sprintf("%s-2006.01.02", esSvc.baseIndex))
+	return esSvc.baseIndex + "-" + date.Format(esSvc.datePattern)
 }
 func (esSvc *ElasticSearchService) IndexAlias(date time.Time, typeName string) string {
-	return date.Format(fmt.Sprintf("%s-%s-2006.01.02", esSvc.baseIndex, typeName))
+	return esSvc.baseIndex + "-" + typeName + "-" + date.Format(esSvc.datePattern)
+}
+
+// Returns the alias the documents of the type are written to when the indices are
+// managed by ILM.
+func (esSvc *ElasticSearchService) RolloverAlias(typeName string) string {
+	return esSvc.baseIndex + "-" + typeName
 }
 
 func (esSvc *ElasticSearchService) FlushData() error {
@@ -54,6 +74,9 @@ func (esSvc *ElasticSearchService) SaveData(date time.Time, typeName string, sin
 	if typeName == "" || len(sinkData) == 0 {
 		return nil
 	}
+	if esSvc.typeless {
+		return esSvc.saveTypelessData(date, typeName, sinkData)
+	}
 
 	indexName := esSvc.Index(date)
 
@@ -101,6 +124,126 @@ func (esSvc *ElasticSearchService) SaveData(date time.Time, typeName string, sin
 	return nil
 }
 
+// Saves the documents in the index of their type, without a mapping type.
+func (esSvc *ElasticSearchService) saveTypelessData(date time.Time, typeName string, sinkData []interface{}) error {
+	var indexName string
+	var err error
+	if esSvc.ilmPolicy != "" {
+		indexName, err = esSvc.ensureRolloverAlias(typeName)
+	} else {
+		indexName, err = esSvc.ensureTypelessIndex(esSvc.IndexAlias(date, typeName), typeName)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, data := range sinkData {
+		indexID := uuid.NewUUID()
+		req := elastic.NewBulkIndexRequest().
+			Index(indexName).
+			Id(indexID.String()).
+			Doc(data)
+		esSvc.bulkProcessor.Add(req)
+	}
+	return nil
+}
+
+func (esSvc *ElasticSearchService) ensureTypelessIndex(indexName, typeName string) (string, error) {
+	if esSvc.knownIndices[indexName] {
+		return indexName, nil
+	}
+	exists, err := esSvc.EsClient.IndexExists(indexName).Do()
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		body := map[string]interface{}{}
+		if mapping, found := typelessMapping(typeName); found {
+			body["mappings"] = mapping
+		}
+		createIndex, err := esSvc.EsClient.CreateIndex(indexName).BodyJson(body).Do()
+		if err != nil {
+			return "", err
+		}
+		if !createIndex.Acknowledged {
+			return "", fmt.Errorf("Failed to create Index in ES cluster: %s", indexName)
+		}
+	}
+	esSvc.knownIndices[indexName] = true
+	return indexName, nil
+}
+
+// Makes sure that the rollover alias of the type exists, creating the ILM policy if Heapster
+// manages it, an index template applying it to the indices of the type and the first index.
+func (esSvc *ElasticSearchService) ensureRolloverAlias(typeName string) (string, error) {
+	alias := esSvc.RolloverAlias(typeName)
+	if esSvc.knownIndices[alias] {
+		return alias, nil
+	}
+	if !esSvc.ilmPolicyCreated && (esSvc.ilmMaxAge != "" || esSvc.ilmMaxSize != "" || esSvc.ilmDeleteAfter != "") {
+		if _, err := esSvc.EsClient.PerformRequest("PUT", "/_ilm/policy/"+esSvc.ilmPolicy, nil, esSvc.ilmPolicyBody()); err != nil {
+			return "", fmt.Errorf("Failed to create ILM policy %s: %v", esSvc.ilmPolicy, err)
+		}
+		esSvc.ilmPolicyCreated = true
+	}
+
+	template := map[string]interface{}{
+		"index_patterns": []string{alias + "-*"},
+		"settings": map[string]interface{}{
+			"index.lifecycle.name":           esSvc.ilmPolicy,
+			"index.lifecycle.rollover_alias": alias,
+		},
+	}
+	if mapping, found := typelessMapping(typeName); found {
+		template["mappings"] = mapping
+	}
+	if _, err := esSvc.EsClient.PerformRequest("PUT", "/_template/"+alias, nil, template); err != nil {
+		return "", fmt.Errorf("Failed to create index template %s: %v", alias, err)
+	}
+
+	exists, err := esSvc.EsClient.IndexExists(alias).Do()
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		body := map[string]interface{}{
+			"aliases": map[string]interface{}{
+				alias: map[string]interface{}{"is_write_index": true},
+			},
+		}
+		if _, err := esSvc.EsClient.PerformRequest("PUT", "/"+alias+"-000001", nil, body); err != nil {
+			return "", fmt.Errorf("Failed to create the first index of %s: %v", alias, err)
+		}
+	}
+	esSvc.knownIndices[alias] = true
+	return alias, nil
+}
+
+func (esSvc *ElasticSearchService) ilmPolicyBody() map[string]interface{} {
+	phases := map[string]interface{}{}
+	rollover := map[string]interface{}{}
+	if esSvc.ilmMaxAge != "" {
+		rollover["max_age"] = esSvc.ilmMaxAge
+	}
+	if esSvc.ilmMaxSize != "" {
+		rollover["max_size"] = esSvc.ilmMaxSize
+	}
+	if len(rollover) > 0 {
+		phases["hot"] = map[string]interface{}{
+			"actions": map[string]interface{}{"rollover": rollover},
+		}
+	}
+	if esSvc.ilmDeleteAfter != "" {
+		phases["delete"] = map[string]interface{}{
+			"min_age": esSvc.ilmDeleteAfter,
+			"actions": map[string]interface{}{"delete": map[string]interface{}{}},
+		}
+	}
+	return map[string]interface{}{
+		"policy": map[string]interface{}{"phases": phases},
+	}
+}
+
 // CreateElasticSearchConfig creates an ElasticSearch configuration struct
 // which contains an ElasticSearch client for later use
 func CreateElasticSearchService(uri *url.URL) (*ElasticSearchService, error) {
@@ -122,6 +265,37 @@ func CreateElasticSearchService(uri *url.URL) (*ElasticSearchService, error) {
 		esSvc.baseIndex = opts["index"][0]
 	}
 
+	esSvc.datePattern = ESIndexDatePattern
+	if len(opts["indexDatePattern"]) > 0 {
+		esSvc.datePattern = opts["indexDatePattern"][0]
+		if (time.Time{}).Format(esSvc.datePattern) == esSvc.datePattern {
+			return nil, fmt.Errorf("Failed to parse URL's indexDatePattern: %q is not a Go time layout", esSvc.datePattern)
+		}
+	}
+
+	if len(opts["typeless"]) > 0 {
+		esSvc.typeless, err = strconv.ParseBool(opts["typeless"][0])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse URL's typeless value into a bool")
+		}
+	}
+
+	if len(opts["ilmPolicy"]) > 0 {
+		if !esSvc.typeless {
+			return nil, fmt.Errorf("ILM policies require typeless=true")
+		}
+		esSvc.ilmPolicy = opts["ilmPolicy"][0]
+	}
+	for name, setting := range map[string]*string{"ilmMaxAge": &esSvc.ilmMaxAge, "ilmMaxSize": &esSvc.ilmMaxSize, "ilmDeleteAfter": &esSvc.ilmDeleteAfter} {
+		if len(opts[name]) > 0 {
+			if esSvc.ilmPolicy == "" {
+				return nil, fmt.Errorf("%s requires ilmPolicy", name)
+			}
+			*setting = opts[name][0]
+		}
+	}
+	esSvc.knownIndices = make(map[string]bool)
+
 	// Set the URL endpoints of the ES's nodes. Notice that when sniffing is
 	// enabled, these URLs are used to initially sniff the cluster on startup.
 	var startupFns []elastic.ClientOptionFunc
@@ -15,12 +15,20 @@
 package elasticsearch
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/olivere/elastic.v3"
 )
 
@@ -96,3 +104,130 @@ func TestCreateElasticSearchServiceForDefaultClusterName(t *testing.T) {
 		t.Fatalf("cluster name is not equal. Expected: %s, Got: %s", ESClusterName, esSvc.ClusterName)
 	}
 }
+
+// A fake Elasticsearch 7.x cluster recording the requests it gets.
+type fakeESServer struct {
+	*httptest.Server
+	sync.Mutex
+	requests []string
+	bulk     string
+}
+
+func newFakeESServer() *fakeESServer {
+	server := &fakeESServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		server.Lock()
+		defer server.Unlock()
+		server.requests = append(server.requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "HEAD":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/_bulk":
+			server.bulk += string(body)
+			fmt.Fprint(w, `{"took":1,"errors":false,"items":[]}`)
+		default:
+			fmt.Fprint(w, `{"acknowledged":true}`)
+		}
+	}))
+	return server
+}
+
+// Returns the requests other than bulk ones, which depend on the scheduling of the bulk workers.
+func (server *fakeESServer) indexRequests() []string {
+	server.Lock()
+	defer server.Unlock()
+	requests := []string{}
+	for _, request := range server.requests {
+		if request != "POST /_bulk" {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func TestTypelessIndices(t *testing.T) {
+	server := newFakeESServer()
+	defer server.Close()
+
+	uri, err := url.Parse("?nodes=" + server.URL + "&sniff=false&healthCheck=false&typeless=true&indexDatePattern=2006.01")
+	require.NoError(t, err)
+	esSvc, err := CreateElasticSearchService(uri)
+	require.NoError(t, err)
+
+	date := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, esSvc.SaveData(date, "cpu", []interface{}{map[string]string{"a": "b"}}))
+	require.NoError(t, esSvc.SaveData(date, "cpu", []interface{}{map[string]string{"a": "c"}}))
+	require.NoError(t, esSvc.FlushData())
+
+	assert.Equal(t, []string{"HEAD /heapster-cpu-2016.10", "PUT /heapster-cpu-2016.10"}, server.indexRequests())
+	assert.Equal(t, 2, strings.Count(server.bulk, `"_index":"heapster-cpu-2016.10"`))
+	assert.NotContains(t, server.bulk, "_type")
+}
+
+func TestILMManagedIndices(t *testing.T) {
+	server := newFakeESServer()
+	defer server.Close()
+
+	uri, err := url.Parse("?nodes=" + server.URL + "&sniff=false&healthCheck=false&typeless=true&ilmPolicy=heapster&ilmMaxAge=1d&ilmDeleteAfter=30d")
+	require.NoError(t, err)
+	esSvc, err := CreateElasticSearchService(uri)
+	require.NoError(t, err)
+
+	date := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, esSvc.SaveData(date, "events", []interface{}{map[string]string{"a": "b"}}))
+	require.NoError(t, esSvc.SaveData(date, "cpu", []interface{}{map[string]string{"a": "c"}}))
+	require.NoError(t, esSvc.FlushData())
+
+	assert.Equal(t, []string{
+		"PUT /_ilm/policy/heapster",
+		"PUT /_template/heapster-events",
+		"HEAD /heapster-events",
+		"PUT /heapster-events-000001",
+		"PUT /_template/heapster-cpu",
+		"HEAD /heapster-cpu",
+		"PUT /heapster-cpu-000001",
+	}, server.indexRequests())
+	assert.Contains(t, server.bulk, `"_index":"heapster-events"`)
+	assert.Contains(t, server.bulk, `"_index":"heapster-cpu"`)
+	assert.Equal(t, map[string]interface{}{
+		"policy": map[string]interface{}{
+			"phases": map[string]interface{}{
+				"hot":    map[string]interface{}{"actions": map[string]interface{}{"rollover": map[string]interface{}{"max_age": "1d"}}},
+				"delete": map[string]interface{}{"min_age": "30d", "actions": map[string]interface{}{"delete": map[string]interface{}{}}},
+			},
+		},
+	}, esSvc.ilmPolicyBody())
+}
+
+func TestTypelessMapping(t *testing.T) {
+	for _, typeName := range []string{"cpu", "filesystem", "memory", "network", "general", "events"} {
+		typeMapping, found := typelessMapping(typeName)
+		require.True(t, found, typeName)
+		encoded, err := json.Marshal(typeMapping)
+		require.NoError(t, err)
+		assert.False(t, strings.Contains(string(encoded), `"string"`), typeName)
+		assert.False(t, strings.Contains(string(encoded), `"not_analyzed"`), typeName)
+	}
+
+	typeMapping, _ := typelessMapping("cpu")
+	tags := typeMapping["properties"].(map[string]interface{})["MetricsTags"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "keyword"}, tags["pod_id"])
+	assert.Equal(t, map[string]interface{}{
+		"type":   "text",
+		"fields": map[string]interface{}{"raw": map[string]interface{}{"type": "keyword"}},
+	}, tags["pod_name"])
+
+	_, found := typelessMapping("unknown")
+	assert.False(t, found)
+}
+
+func TestIndexOptionErrors(t *testing.T) {
+	for _, query := range []string{"indexDatePattern=daily", "typeless=maybe", "ilmPolicy=heapster", "typeless=true&ilmMaxAge=1d"} {
+		uri, err := url.Parse("?nodes=https://foo.com:20468&sniff=false&healthCheck=false&" + query)
+		require.NoError(t, err)
+		_, err = CreateElasticSearchService(uri)
+		assert.Error(t, err, query)
+	}
+}
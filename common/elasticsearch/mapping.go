@@ -14,6 +14,7 @@
 package elasticsearch
 
 import (
+	"encoding/json"
 	"strings"
 
 	"k8s.io/heapster/metrics/core"
@@ -370,3 +371,55 @@ var mapping = `{
     }
   }
 }`
+
+// Returns the mapping of the documents of the given type in a typeless index, derived from
+// the mapping of the type: string fields become keyword fields if they aren't analyzed and
+// text fields otherwise.
+func typelessMapping(typeName string) (map[string]interface{}, bool) {
+	var legacy struct {
+		Mappings map[string]map[string]interface{} `json:"mappings"`
+	}
+	if err := json.Unmarshal([]byte(mapping), &legacy); err != nil {
+		// The mapping is a constant, this can't happen.
+		panic(err)
+	}
+	typeMapping, found := legacy.Mappings[typeName]
+	if !found {
+		return nil, false
+	}
+	return map[string]interface{}{
+		"properties": typelessProperties(typeMapping["properties"]),
+	}, true
+}
+
+func typelessProperties(properties interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	fields, _ := properties.(map[string]interface{})
+	for name, field := range fields {
+		fieldMapping, _ := field.(map[string]interface{})
+		result[name] = typelessField(fieldMapping)
+	}
+	return result
+}
+
+func typelessField(field map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(field))
+	for key, value := range field {
+		result[key] = value
+	}
+	if properties, found := field["properties"]; found {
+		result["properties"] = typelessProperties(properties)
+	}
+	if fields, found := field["fields"]; found {
+		result["fields"] = typelessProperties(fields)
+	}
+	if field["type"] == "string" {
+		if field["index"] == "not_analyzed" {
+			result["type"] = "keyword"
+		} else {
+			result["type"] = "text"
+		}
+		delete(result, "index")
+	}
+	return result
+}
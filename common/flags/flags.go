@@ -35,6 +35,43 @@ func (u *Uri) String() string {
 	return fmt.Sprintf("%s:%s", u.Key, val)
 }
 
+// Options of the uris holding secrets.
+var secretOptions = map[string]bool{
+	"pw":           true,
+	"pass":         true,
+	"password":     true,
+	"token":        true,
+	"esUserSecret": true,
+	"api-key":      true,
+}
+
+const redactedValue = "REDACTED"
+
+// Redacted returns the uri as String does, with the password of its user and the values of the
+// options holding secrets replaced, so that it can be shown to operators.
+func (u *Uri) Redacted() string {
+	redacted := *u
+	if u.Val.User != nil {
+		if _, found := u.Val.User.Password(); found {
+			redacted.Val.User = url.UserPassword(u.Val.User.Username(), redactedValue)
+		}
+	}
+	query := u.Val.Query()
+	changed := false
+	for option, values := range query {
+		if secretOptions[option] {
+			for i := range values {
+				values[i] = redactedValue
+			}
+			changed = true
+		}
+	}
+	if changed {
+		redacted.Val.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
 func (u *Uri) Set(value string) error {
 	s := strings.SplitN(value, ":", 2)
 	if s[0] == "" {
@@ -67,6 +104,15 @@ func (us *Uris) String() string {
 	return b.String()
 }
 
+// Redacted returns the uris redacted by Uri.Redacted.
+func (us *Uris) Redacted() []string {
+	result := make([]string, 0, len(*us))
+	for i := range *us {
+		result = append(result, (*us)[i].Redacted())
+	}
+	return result
+}
+
 func (us *Uris) Set(value string) error {
 	var u Uri
 	if err := u.Set(value); err != nil {
@@ -22,7 +22,8 @@ import (
 )
 
 type PointSavedToInfluxdb struct {
-	Ponit influxdb.Point
+	Ponit           influxdb.Point
+	RetentionPolicy string
 }
 
 type FakeInfluxDBClient struct {
@@ -35,7 +36,7 @@ func NewFakeInfluxDBClient() *FakeInfluxDBClient {
 
 func (client *FakeInfluxDBClient) Write(bps influxdb.BatchPoints) (*influxdb.Response, error) {
 	for _, pnt := range bps.Points {
-		client.Pnts = append(client.Pnts, PointSavedToInfluxdb{pnt})
+		client.Pnts = append(client.Pnts, PointSavedToInfluxdb{pnt, bps.RetentionPolicy})
 	}
 	return nil, nil
 }
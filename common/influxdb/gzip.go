@@ -0,0 +1,120 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"k8s.io/heapster/common/transport"
+	"k8s.io/heapster/version"
+
+	influxdb "github.com/influxdata/influxdb/client"
+)
+
+// A client of the InfluxDB 1.x API writing gzipped line protocol, which the client library
+// doesn't support. The queries go through the client library.
+type gzipClient struct {
+	*influxdb.Client
+	url        url.URL
+	config     InfluxdbConfig
+	userAgent  string
+	httpClient *http.Client
+}
+
+func newGzipClient(client *influxdb.Client, u url.URL, c InfluxdbConfig) *gzipClient {
+	return &gzipClient{
+		Client:    client,
+		url:       u,
+		config:    c,
+		userAgent: fmt.Sprintf("%v/%v", "heapster", version.HeapsterVersion),
+		httpClient: &http.Client{
+			Transport: transport.New(&tls.Config{InsecureSkipVerify: c.InsecureSsl}),
+		},
+	}
+}
+
+func (client *gzipClient) Write(bps influxdb.BatchPoints) (*influxdb.Response, error) {
+	body, err := gzipLineProtocol(bps)
+	if err != nil {
+		return nil, err
+	}
+	u := client.url
+	u.Path = "write"
+	params := url.Values{}
+	params.Set("db", bps.Database)
+	params.Set("rp", bps.RetentionPolicy)
+	params.Set("precision", bps.Precision)
+	params.Set("consistency", bps.WriteConsistency)
+	u.RawQuery = params.Encode()
+	req, err := http.NewRequest("POST", u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("User-Agent", client.userAgent)
+	if client.config.User != "" {
+		req.SetBasicAuth(client.config.User, client.config.Password)
+	}
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("%s", string(respBody))
+		return &influxdb.Response{Err: err}, err
+	}
+	return nil, nil
+}
+
+// Returns the points in the line protocol, with the tags of the batch added to every point.
+func lineProtocol(bps influxdb.BatchPoints) *bytes.Buffer {
+	var b bytes.Buffer
+	for _, p := range bps.Points {
+		for k, v := range bps.Tags {
+			if p.Tags == nil {
+				p.Tags = make(map[string]string, len(bps.Tags))
+			}
+			p.Tags[k] = v
+		}
+		b.WriteString(p.MarshalString())
+		b.WriteByte('\n')
+	}
+	return &b
+}
+
+func gzipLineProtocol(bps influxdb.BatchPoints) (*bytes.Buffer, error) {
+	var b bytes.Buffer
+	writer := gzip.NewWriter(&b)
+	if _, err := lineProtocol(bps).WriteTo(writer); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"k8s.io/heapster/version"
@@ -40,9 +41,31 @@ type InfluxdbConfig struct {
 	WithFields      bool
 	InsecureSsl     bool
 	RetentionPolicy string
+	RawSamples      bool
+	// Version of the InfluxDB API, 1 or 2. The 2.x API writes to a bucket of an organization
+	// and is queried with Flux.
+	ApiVersion int
+	Org        string
+	Bucket     string
+	Token      string
+	// Durations of the retention policies of metric families, by family. A family is the
+	// part of metric names before the first slash, e.g. filesystem for filesystem/usage.
+	FamilyRetentionPolicies map[string]string
+	// Measurements the metrics of families are written to, by family.
+	FamilyMeasurements map[string]string
+	// Whether the points are written gzipped.
+	Gzip bool
 }
 
 func NewClient(c InfluxdbConfig) (InfluxdbClient, error) {
+	if c.ApiVersion == 2 {
+		client := newV2Client(c)
+		if _, _, err := client.Ping(); err != nil {
+			return nil, fmt.Errorf("failed to ping InfluxDB server at %q - %v", c.Host, err)
+		}
+		return client, nil
+	}
+
 	url := &url.URL{
 		Scheme: "http",
 		Host:   c.Host,
@@ -66,6 +89,9 @@ func NewClient(c InfluxdbConfig) (InfluxdbClient, error) {
 	if _, _, err := client.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping InfluxDB server at %q - %v", c.Host, err)
 	}
+	if c.Gzip {
+		return newGzipClient(client, *url, c), nil
+	}
 	return client, nil
 }
 
@@ -79,6 +105,8 @@ func BuildConfig(uri *url.URL) (*InfluxdbConfig, error) {
 		WithFields:      false,
 		InsecureSsl:     false,
 		RetentionPolicy: "0",
+		RawSamples:      false,
+		ApiVersion:      1,
 	}
 
 	if len(uri.Host) > 0 {
@@ -121,5 +149,70 @@ func BuildConfig(uri *url.URL) (*InfluxdbConfig, error) {
 		config.InsecureSsl = val
 	}
 
+	if len(opts["rawsamples"]) >= 1 {
+		val, err := strconv.ParseBool(opts["rawsamples"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `rawsamples` flag - %v", err)
+		}
+		config.RawSamples = val
+	}
+
+	if len(opts["gzip"]) >= 1 {
+		val, err := strconv.ParseBool(opts["gzip"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `gzip` flag - %v", err)
+		}
+		config.Gzip = val
+	}
+
+	if len(opts["apiversion"]) >= 1 {
+		val, err := strconv.Atoi(opts["apiversion"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `apiversion` flag - %v", err)
+		}
+		if val != 1 && val != 2 {
+			return nil, fmt.Errorf("failed to parse `apiversion` flag - should be 1 or 2, got %d", val)
+		}
+		config.ApiVersion = val
+	}
+	if len(opts["org"]) >= 1 {
+		config.Org = opts["org"][0]
+	}
+	if len(opts["token"]) >= 1 {
+		config.Token = opts["token"][0]
+	}
+	config.Bucket = config.DbName
+	if len(opts["bucket"]) >= 1 {
+		config.Bucket = opts["bucket"][0]
+	}
+	if config.ApiVersion == 2 && config.Org == "" {
+		return nil, fmt.Errorf("the `org` flag is required for the InfluxDB 2.x API")
+	}
+
+	families, err := parseFamilyOption(opts, "familyretention")
+	if err != nil {
+		return nil, err
+	}
+	if len(families) > 0 && config.ApiVersion == 2 {
+		return nil, fmt.Errorf("the `familyretention` flag is not supported by the InfluxDB 2.x API")
+	}
+	config.FamilyRetentionPolicies = families
+	if config.FamilyMeasurements, err = parseFamilyOption(opts, "familymeasurement"); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
+
+// Parses the values of a repeated option of the form <family>:<value>.
+func parseFamilyOption(opts url.Values, name string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, opt := range opts[name] {
+		parts := strings.SplitN(opt, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("failed to parse `%s` flag - %q should be of the form <family>:<value>", name, opt)
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
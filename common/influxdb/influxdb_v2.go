@@ -0,0 +1,257 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/heapster/common/transport"
+	"k8s.io/heapster/version"
+
+	influxdb "github.com/influxdata/influxdb/client"
+	influx_models "github.com/influxdata/influxdb/models"
+)
+
+// A client of the InfluxDB 2.x API. Points are written to the bucket of the config and
+// queries are Flux scripts. Each result of a query response holds the tables yielded
+// under one name, in the order of the response, with the name of the yield as the name
+// of the rows. Numeric values are returned as json.Number like in the 1.x client.
+type v2Client struct {
+	url        url.URL
+	config     InfluxdbConfig
+	userAgent  string
+	httpClient *http.Client
+}
+
+func newV2Client(c InfluxdbConfig) *v2Client {
+	u := url.URL{
+		Scheme: "http",
+		Host:   c.Host,
+	}
+	if c.Secure {
+		u.Scheme = "https"
+	}
+	return &v2Client{
+		url:       u,
+		config:    c,
+		userAgent: fmt.Sprintf("%v/%v", "heapster", version.HeapsterVersion),
+		httpClient: &http.Client{
+			Transport: transport.New(&tls.Config{InsecureSkipVerify: c.InsecureSsl}),
+		},
+	}
+}
+
+func (client *v2Client) newRequest(method, path string, params url.Values, body io.Reader) (*http.Request, error) {
+	u := client.url
+	u.Path = path
+	u.RawQuery = params.Encode()
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", client.userAgent)
+	if client.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+client.config.Token)
+	}
+	return req, nil
+}
+
+func (client *v2Client) do(req *http.Request, expectedStatus int) ([]byte, error) {
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expectedStatus {
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiError) == nil && apiError.Message != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, apiError.Message)
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, string(body))
+	}
+	return body, nil
+}
+
+func (client *v2Client) Write(bps influxdb.BatchPoints) (*influxdb.Response, error) {
+	body := lineProtocol(bps)
+	if client.config.Gzip {
+		var err error
+		if body, err = gzipLineProtocol(bps); err != nil {
+			return nil, err
+		}
+	}
+
+	params := url.Values{}
+	params.Set("org", client.config.Org)
+	params.Set("bucket", client.config.Bucket)
+	params.Set("precision", "ns")
+	req, err := client.newRequest("POST", "/api/v2/write", params, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if client.config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if _, err := client.do(req, http.StatusNoContent); err != nil {
+		return &influxdb.Response{Err: err}, err
+	}
+	return nil, nil
+}
+
+func (client *v2Client) Query(q influxdb.Query) (*influxdb.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": q.Command,
+		"type":  "flux",
+		"dialect": map[string]interface{}{
+			"header":      true,
+			"annotations": []string{"datatype"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("org", client.config.Org)
+	req, err := client.newRequest("POST", "/api/v2/query", params, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/csv")
+	respBody, err := client.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return parseFluxCSV(respBody)
+}
+
+func (client *v2Client) Ping() (time.Duration, string, error) {
+	start := time.Now()
+	req, err := client.newRequest("GET", "/health", nil, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	body, err := client.do(req, http.StatusOK)
+	if err != nil {
+		return 0, "", err
+	}
+	var health struct {
+		Version string `json:"version"`
+	}
+	json.Unmarshal(body, &health)
+	return time.Since(start), health.Version, nil
+}
+
+// Converts an annotated Flux CSV response to a response with one result per yield name.
+// Every table becomes a row holding the columns of the table except the result and table ones.
+func parseFluxCSV(data []byte) (*influxdb.Response, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	response := &influxdb.Response{}
+	results := make(map[string]int)
+	var datatypes, header []string
+	// The result name and id of the current table.
+	var table string
+	expectHeader := false
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Flux response: %v", err)
+		}
+		if strings.HasPrefix(record[0], "#") {
+			if record[0] == "#datatype" {
+				datatypes = record
+			}
+			expectHeader = true
+			continue
+		}
+		if expectHeader || header == nil {
+			header = record
+			expectHeader = false
+			if len(header) > 1 && header[1] == "error" {
+				// The error is in the next record.
+				if record, err := reader.Read(); err == nil && len(record) > 1 {
+					return nil, fmt.Errorf("Flux query failed: %s", record[1])
+				}
+				return nil, fmt.Errorf("Flux query failed")
+			}
+			continue
+		}
+
+		values := []interface{}{}
+		columns := []string{}
+		var resultName, tableId string
+		for i, value := range record {
+			if i >= len(header) || i == 0 {
+				continue
+			}
+			switch header[i] {
+			case "result":
+				resultName = value
+				continue
+			case "table":
+				tableId = value
+				continue
+			}
+			columns = append(columns, header[i])
+			datatype := ""
+			if i < len(datatypes) {
+				datatype = datatypes[i]
+			}
+			switch datatype {
+			case "long", "unsignedLong", "double":
+				values = append(values, json.Number(value))
+			default:
+				values = append(values, value)
+			}
+		}
+
+		index, found := results[resultName]
+		if !found {
+			index = len(response.Results)
+			results[resultName] = index
+			response.Results = append(response.Results, influxdb.Result{})
+		}
+		result := &response.Results[index]
+		if table != resultName+"/"+tableId || len(result.Series) == 0 {
+			result.Series = append(result.Series, influx_models.Row{Name: resultName, Columns: columns})
+			table = resultName + "/" + tableId
+		}
+		row := &result.Series[len(result.Series)-1]
+		row.Values = append(row.Values, values)
+	}
+	return response, nil
+}
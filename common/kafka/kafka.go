@@ -17,6 +17,7 @@ package kafka
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"net/url"
 	"time"
 
@@ -46,6 +47,9 @@ type KafkaClient interface {
 	Name() string
 	Stop()
 	ProduceKafkaMessage(msgData interface{}) error
+	// ProduceKeyedKafkaMessage sends the message with the key, the messages of a key going to the
+	// same partition. Messages without a key are distributed across the partitions.
+	ProduceKeyedKafkaMessage(key string, msgData interface{}) error
 }
 
 type kafkaSink struct {
@@ -53,15 +57,27 @@ type kafkaSink struct {
 	dataTopic string
 }
 
+// ProduceKafkaMessage sends byte slices as they are and other values encoded as json.
 func (sink *kafkaSink) ProduceKafkaMessage(msgData interface{}) error {
+	return sink.ProduceKeyedKafkaMessage("", msgData)
+}
+
+func (sink *kafkaSink) ProduceKeyedKafkaMessage(key string, msgData interface{}) error {
 	start := time.Now()
-	msgJson, err := json.Marshal(msgData)
-	if err != nil {
-		return fmt.Errorf("failed to transform the items to json : %s", err)
+	msgJson, ok := msgData.([]byte)
+	if !ok {
+		var err error
+		msgJson, err = json.Marshal(msgData)
+		if err != nil {
+			return fmt.Errorf("failed to transform the items to json : %s", err)
+		}
 	}
 
 	message := &proto.Message{Value: []byte(string(msgJson))}
-	_, err = sink.producer.Distribute(sink.dataTopic, message)
+	if key != "" {
+		message.Key = []byte(key)
+	}
+	_, err := sink.producer.Distribute(sink.dataTopic, message)
 	if err != nil {
 		return fmt.Errorf("failed to produce message to %s: %s", sink.dataTopic, err)
 	}
@@ -92,18 +108,51 @@ func setupProducer(sinkBrokerHosts []string, topic string, brokerConf kafka.Brok
 	conf.RequiredAcks = proto.RequiredAcksLocal
 	producer := broker.Producer(conf)
 
-	// create RoundRobinProducer with the default producer.
+	// distribute the messages by key, or round robin, with the default producer.
 	count, err := broker.PartitionCount(topic)
 	if err != nil {
 		count = 1
 		glog.Warningf("Failed to get partition count of topic %q: %s", topic, err)
 	}
-	sinkProducer := kafka.NewRoundRobinProducer(producer, count)
+	sinkProducer := newKeyedProducer(producer, count)
 	glog.V(3).Infof("kafka sink setup successfully")
 	return sinkProducer, nil
 }
 
-func getTopic(opts map[string][]string, topicType string) (string, error) {
+// A producer writing the messages with a key to the partition of the hash of their key, so
+// that the consumers get the messages of a key in order, and the other messages round robin.
+// The hash producer of the client library can't be used, as it computes partitions out of
+// range and rejects the messages without a key.
+type keyedProducer struct {
+	producer   kafka.Producer
+	roundRobin kafka.DistributingProducer
+	partitions int32
+}
+
+func newKeyedProducer(producer kafka.Producer, partitions int32) kafka.DistributingProducer {
+	return &keyedProducer{
+		producer:   producer,
+		roundRobin: kafka.NewRoundRobinProducer(producer, partitions),
+		partitions: partitions,
+	}
+}
+
+// Distribute writes the messages to the partition of the key of the first one.
+func (p *keyedProducer) Distribute(topic string, messages ...*proto.Message) (int64, error) {
+	if len(messages) == 0 || len(messages[0].Key) == 0 {
+		return p.roundRobin.Distribute(topic, messages...)
+	}
+	return p.producer.Produce(topic, keyPartition(messages[0].Key, p.partitions), messages...)
+}
+
+func keyPartition(key []byte, partitions int32) int32 {
+	hasher := fnv.New32a()
+	hasher.Write(key)
+	return int32(hasher.Sum32() % uint32(partitions))
+}
+
+// GetTopic returns the topic configured for the topic type, or its default.
+func GetTopic(opts map[string][]string, topicType string) (string, error) {
 	var topic string
 	switch topicType {
 	case TimeSeriesTopic:
@@ -128,7 +177,7 @@ func NewKafkaClient(uri *url.URL, topicType string) (KafkaClient, error) {
 	}
 	glog.V(3).Infof("kafka sink option: %v", opts)
 
-	topic, err := getTopic(opts, topicType)
+	topic, err := GetTopic(opts, topicType)
 	if err != nil {
 		return nil, err
 	}
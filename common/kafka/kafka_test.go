@@ -0,0 +1,48 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/optiopay/kafka/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProducer struct {
+	partitions []int32
+}
+
+func (p *fakeProducer) Produce(topic string, partition int32, messages ...*proto.Message) (int64, error) {
+	p.partitions = append(p.partitions, partition)
+	return 0, nil
+}
+
+func TestKeyedProducer(t *testing.T) {
+	producer := &fakeProducer{}
+	distributing := newKeyedProducer(producer, 8)
+	for _, key := range []string{"ns1/p1", "ns1/p2", "ns1/p1", "", ""} {
+		_, err := distributing.Distribute("metrics", &proto.Message{Key: []byte(key)})
+		assert.NoError(t, err)
+	}
+
+	assert.Len(t, producer.partitions, 5)
+	for _, partition := range producer.partitions {
+		assert.True(t, partition >= 0 && partition < 8)
+	}
+	// The messages of a key go to the same partition, the others round robin.
+	assert.Equal(t, producer.partitions[0], producer.partitions[2])
+	assert.NotEqual(t, producer.partitions[3], producer.partitions[4])
+}
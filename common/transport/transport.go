@@ -0,0 +1,233 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transport provides the HTTP transports of the sinks, which keep their connections to
+// the backends alive between exports, cache the addresses of the backends and limit the number
+// of connections opened to each of them.
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout         = 30 * time.Second
+	dialKeepAlive       = 30 * time.Second
+	tlsHandshakeTimeout = 10 * time.Second
+)
+
+// Options of the connections of the sinks.
+type Options struct {
+	// Idle connections kept open to every host, to be reused by the next requests.
+	MaxIdleConnsPerHost int
+	// How long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+	// Connections open at once to every host by a transport, 0 for no limit. A request
+	// needing another connection waits for one to be closed, at most for the dial timeout.
+	MaxConnsPerHost int
+	// How long the resolved addresses of a host are used, 0 to resolve them on every dial.
+	DNSCacheTTL time.Duration
+}
+
+var DefaultOptions = Options{
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+	MaxConnsPerHost:     0,
+	DNSCacheTTL:         30 * time.Second,
+}
+
+var (
+	lock    sync.Mutex
+	options = DefaultOptions
+	cache   = newDNSCache(DefaultOptions.DNSCacheTTL, net.LookupHost)
+	shared  *http.Transport
+)
+
+// Configure sets the options of the transports. Must be called before the sinks are created.
+func Configure(opts Options) {
+	lock.Lock()
+	defer lock.Unlock()
+	options = opts
+	cache = newDNSCache(opts.DNSCacheTTL, net.LookupHost)
+	shared = nil
+}
+
+// Shared returns the transport shared by the sinks which don't need a TLS configuration of their own.
+func Shared() *http.Transport {
+	lock.Lock()
+	defer lock.Unlock()
+	if shared == nil {
+		shared = newTransport(nil, options, cache)
+	}
+	return shared
+}
+
+// New returns a transport with the given TLS configuration, pooling its connections and caching
+// the addresses of its hosts like the shared one.
+func New(tlsConfig *tls.Config) *http.Transport {
+	lock.Lock()
+	defer lock.Unlock()
+	return newTransport(tlsConfig, options, cache)
+}
+
+// NewClient returns a client of the shared transport, with the given timeout.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: Shared()}
+}
+
+func newTransport(tlsConfig *tls.Config, opts Options, cache *dnsCache) *http.Transport {
+	d := &dialer{
+		dial:            (&net.Dialer{Timeout: dialTimeout, KeepAlive: dialKeepAlive}).Dial,
+		maxConnsPerHost: opts.MaxConnsPerHost,
+		hostConns:       make(map[string]chan struct{}),
+	}
+	if opts.DNSCacheTTL > 0 {
+		d.cache = cache
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		Dial:                  d.Dial,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// Dials the cached addresses of the hosts, with at most maxConnsPerHost connections per address.
+type dialer struct {
+	dial            func(network, address string) (net.Conn, error)
+	cache           *dnsCache
+	maxConnsPerHost int
+
+	lock sync.Mutex
+	// Semaphores of the connections by address.
+	hostConns map[string]chan struct{}
+}
+
+// A connection giving back its slot when closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (this *limitedConn) Close() error {
+	this.once.Do(this.release)
+	return this.Conn.Close()
+}
+
+func (this *dialer) Dial(network, address string) (net.Conn, error) {
+	if this.maxConnsPerHost <= 0 {
+		return this.dialResolved(network, address)
+	}
+	slots := this.slots(address)
+	select {
+	case slots <- struct{}{}:
+	case <-time.After(dialTimeout):
+		return nil, fmt.Errorf("timed out waiting for one of the %d connections to %s", this.maxConnsPerHost, address)
+	}
+	release := func() { <-slots }
+	conn, err := this.dialResolved(network, address)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &limitedConn{Conn: conn, release: release}, nil
+}
+
+func (this *dialer) slots(address string) chan struct{} {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	slots, found := this.hostConns[address]
+	if !found {
+		slots = make(chan struct{}, this.maxConnsPerHost)
+		this.hostConns[address] = slots
+	}
+	return slots
+}
+
+// Dials the addresses of the host in turn. The host is resolved again on the next dial if none
+// of them can be reached, e.g. because the backend moved.
+func (this *dialer) dialResolved(network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || this.cache == nil || net.ParseIP(host) != nil {
+		return this.dial(network, address)
+	}
+	addrs, err := this.cache.resolve(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		var conn net.Conn
+		if conn, err = this.dial(network, net.JoinHostPort(addr, port)); err == nil {
+			return conn, nil
+		}
+	}
+	this.cache.forget(host)
+	return nil, err
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// Addresses of the hosts, resolved at most once per TTL.
+type dnsCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	lookup  func(host string) ([]string, error)
+	entries map[string]dnsEntry
+}
+
+func newDNSCache(ttl time.Duration, lookup func(host string) ([]string, error)) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		lookup:  lookup,
+		entries: make(map[string]dnsEntry),
+	}
+}
+
+func (this *dnsCache) resolve(host string) ([]string, error) {
+	now := time.Now()
+	this.Lock()
+	entry, found := this.entries[host]
+	this.Unlock()
+	if found && now.Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	// Concurrent dials may resolve the same host, the last one wins.
+	addrs, err := this.lookup(host)
+	if err != nil {
+		return nil, err
+	}
+	this.Lock()
+	this.entries[host] = dnsEntry{addrs: addrs, expires: now.Add(this.ttl)}
+	this.Unlock()
+	return addrs, nil
+}
+
+func (this *dnsCache) forget(host string) {
+	this.Lock()
+	defer this.Unlock()
+	delete(this.entries, host)
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver struct {
+	addrs   map[string][]string
+	lookups int
+}
+
+func (this *fakeResolver) lookup(host string) ([]string, error) {
+	this.lookups++
+	addrs, found := this.addrs[host]
+	if !found {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	return addrs, nil
+}
+
+func TestDNSCache(t *testing.T) {
+	resolver := &fakeResolver{addrs: map[string][]string{"influxdb": {"10.0.0.1"}}}
+	cache := newDNSCache(100*time.Millisecond, resolver.lookup)
+
+	for i := 0; i < 3; i++ {
+		addrs, err := cache.resolve("influxdb")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.1"}, addrs)
+	}
+	assert.Equal(t, 1, resolver.lookups)
+
+	_, err := cache.resolve("kafka")
+	assert.Error(t, err)
+	assert.Equal(t, 2, resolver.lookups)
+
+	// The addresses are resolved again once expired or forgotten.
+	resolver.addrs["influxdb"] = []string{"10.0.0.2"}
+	time.Sleep(150 * time.Millisecond)
+	addrs, err := cache.resolve("influxdb")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2"}, addrs)
+	assert.Equal(t, 3, resolver.lookups)
+
+	cache.forget("influxdb")
+	_, err = cache.resolve("influxdb")
+	require.NoError(t, err)
+	assert.Equal(t, 4, resolver.lookups)
+}
+
+func TestDialResolved(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	// The first address of the backend is gone, the second one is dialed instead.
+	resolver := &fakeResolver{addrs: map[string][]string{"backend": {"127.0.0.2", "127.0.0.1"}}}
+	var dialed []string
+	d := &dialer{
+		dial: func(network, address string) (net.Conn, error) {
+			dialed = append(dialed, address)
+			if address != listener.Addr().String() {
+				return nil, fmt.Errorf("connection refused")
+			}
+			return net.Dial(network, address)
+		},
+		cache:     newDNSCache(time.Minute, resolver.lookup),
+		hostConns: make(map[string]chan struct{}),
+	}
+
+	conn, err := d.Dial("tcp", net.JoinHostPort("backend", port))
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, []string{"127.0.0.2:" + port, "127.0.0.1:" + port}, dialed)
+
+	// Addresses are dialed as is.
+	dialed = nil
+	conn, err = d.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, []string{listener.Addr().String()}, dialed)
+	assert.Equal(t, 1, resolver.lookups)
+
+	// A host none of the addresses of which can be reached is resolved again.
+	resolver.addrs["backend"] = []string{"127.0.0.2"}
+	d.cache.forget("backend")
+	_, err = d.Dial("tcp", net.JoinHostPort("backend", port))
+	assert.Error(t, err)
+	resolver.addrs["backend"] = []string{"127.0.0.1"}
+	conn, err = d.Dial("tcp", net.JoinHostPort("backend", port))
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, 3, resolver.lookups)
+}
+
+func TestMaxConnsPerHost(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	d := &dialer{
+		dial:            net.Dial,
+		maxConnsPerHost: 2,
+		hostConns:       make(map[string]chan struct{}),
+	}
+	address := listener.Addr().String()
+	conn1, err := d.Dial("tcp", address)
+	require.NoError(t, err)
+	conn2, err := d.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn2.Close()
+
+	dialed := make(chan net.Conn)
+	go func() {
+		conn, err := d.Dial("tcp", address)
+		if err != nil {
+			conn = nil
+		}
+		dialed <- conn
+	}()
+	select {
+	case <-dialed:
+		t.Fatalf("a third connection was opened")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Closing a connection lets the waiting dial through, closing it twice doesn't free another slot.
+	conn1.Close()
+	conn1.Close()
+	select {
+	case conn3 := <-dialed:
+		require.NotNil(t, conn3)
+		conn3.Close()
+	case <-time.After(time.Second):
+		t.Fatalf("the connection wasn't opened after another one was closed")
+	}
+	assert.Equal(t, 1, len(d.slots(address)))
+}
@@ -34,11 +34,15 @@ import (
 )
 
 var (
-	argFrequency = flag.Duration("frequency", 30*time.Second, "The resolution at which Eventer pushes events to sinks")
-	argMaxProcs  = flag.Int("max_procs", 0, "max number of CPUs that can be used simultaneously. Less than 1 for default (number of cores)")
-	argSources   flags.Uris
-	argSinks     flags.Uris
-	argVersion   bool
+	argFrequency          = flag.Duration("frequency", 30*time.Second, "The resolution at which Eventer pushes events to sinks")
+	argMaxProcs           = flag.Int("max_procs", 0, "max number of CPUs that can be used simultaneously. Less than 1 for default (number of cores)")
+	argSinkQueueSize      = flag.Int("sink_queue_size", sinks.DefaultSinkQueueSize, "The maximum number of events queued for every sink")
+	argSinkBatchSize      = flag.Int("sink_batch_size", sinks.DefaultSinkBatchSize, "The maximum number of events exported to a sink at once")
+	argSinkWorkers        = flag.Int("sink_workers", sinks.DefaultSinkWorkers, "The number of concurrent exports to every sink")
+	argSinkOverloadPolicy = flag.String("sink_overload_policy", sinks.DefaultSinkOverloadPolicy, "What to do with events that don't fit in a full sink queue - drop them (drop), or replace the queued version of the same event and drop the others (aggregate)")
+	argSources            flags.Uris
+	argSinks              flags.Uris
+	argVersion            bool
 )
 
 func main() {
@@ -88,7 +92,7 @@ func main() {
 	for _, sink := range sinkList {
 		glog.Infof("Starting with %s sink", sink.Name())
 	}
-	sinkManager, err := sinks.NewEventSinkManager(sinkList, sinks.DefaultSinkExportEventsTimeout, sinks.DefaultSinkStopTimeout)
+	sinkManager, err := sinks.NewEventSinkManager(sinkList, *argSinkQueueSize, *argSinkBatchSize, *argSinkWorkers, *argSinkOverloadPolicy, sinks.DefaultSinkStopTimeout)
 	if err != nil {
 		glog.Fatalf("Failed to create sink manager: %v", err)
 	}
@@ -108,6 +112,9 @@ func validateFlags() error {
 	if *argFrequency < 5*time.Second {
 		return fmt.Errorf("frequency needs to be greater than 5 seconds - %d", *argFrequency)
 	}
+	if *argSinkQueueSize < 1 || *argSinkBatchSize < 1 || *argSinkWorkers < 1 {
+		return fmt.Errorf("sink_queue_size, sink_batch_size and sink_workers need to be positive")
+	}
 	return nil
 }
 
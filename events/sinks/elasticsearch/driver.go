@@ -77,6 +77,8 @@ func eventToPoint(event *kube_api.Event, clusterName string) (*EsSinkPoint, erro
 	return &point, nil
 }
 
+// The sink workers call it concurrently, but the ElasticSearch service creates the indices and
+// the ids of the documents without synchronization, so the exports are serialized.
 func (sink *elasticSearchSink) ExportEvents(eventBatch *event_core.EventBatch) {
 	sink.Lock()
 	defer sink.Unlock()
@@ -17,10 +17,16 @@ package elasticsearch
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/olivere/elastic.v3"
 	esCommon "k8s.io/heapster/common/elasticsearch"
 	"k8s.io/heapster/events/core"
@@ -115,3 +121,60 @@ func TestStoreMultipleDataInput(t *testing.T) {
 
 	FakeESSink = fakeESSink{}
 }
+
+func TestConcurrentExports(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "HEAD":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/_bulk":
+			fmt.Fprint(w, `{"took":1,"errors":false,"items":[]}`)
+		default:
+			fmt.Fprint(w, `{"acknowledged":true}`)
+		}
+	}))
+	defer server.Close()
+
+	for _, query := range []string{"&typeless=true", "&typeless=true&ilmPolicy=heapster&ilmMaxAge=1d"} {
+		lock.Lock()
+		requests = map[string]int{}
+		lock.Unlock()
+		uri, err := url.Parse("?nodes=" + server.URL + "&sniff=false&healthCheck=false" + query)
+		require.NoError(t, err)
+		sink, err := NewElasticSearchSink(uri)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				now := kube_api_unversioned.Now()
+				sink.ExportEvents(&core.EventBatch{
+					Timestamp: now.Time,
+					Events: []*kube_api.Event{
+						{Message: fmt.Sprintf("event%d", i), LastTimestamp: now, FirstTimestamp: now},
+					},
+				})
+			}(i)
+		}
+		wg.Wait()
+
+		// The index of the events is only created once.
+		lock.Lock()
+		created := 0
+		for request, count := range requests {
+			if strings.HasPrefix(request, "PUT /heapster-events") {
+				created += count
+			}
+		}
+		lock.Unlock()
+		assert.Equal(t, 1, created, query)
+	}
+}
@@ -24,6 +24,8 @@ import (
 	"k8s.io/heapster/events/sinks/influxdb"
 	"k8s.io/heapster/events/sinks/kafka"
 	"k8s.io/heapster/events/sinks/log"
+	"k8s.io/heapster/events/sinks/nats"
+	"k8s.io/heapster/events/sinks/pubsub"
 
 	"github.com/golang/glog"
 )
@@ -43,6 +45,10 @@ func (this *SinkFactory) Build(uri flags.Uri) (core.EventSink, error) {
 		return elasticsearch.NewElasticSearchSink(&uri.Val)
 	case "kafka":
 		return kafka.NewKafkaSink(&uri.Val)
+	case "nats":
+		return nats.CreateNatsSink(&uri.Val)
+	case "pubsub":
+		return pubsub.CreatePubSubSink(&uri.Val)
 	default:
 		return nil, fmt.Errorf("Sink not recognized: %s", uri.Key)
 	}
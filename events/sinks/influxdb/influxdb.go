@@ -18,12 +18,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	influxdb_common "k8s.io/heapster/common/influxdb"
 	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/util"
 	metrics_core "k8s.io/heapster/metrics/core"
 	kube_api "k8s.io/kubernetes/pkg/api"
 
@@ -32,10 +34,14 @@ import (
 )
 
 type influxdbSink struct {
-	client influxdb_common.InfluxdbClient
+	// Guards client and dbExists, but not the requests, so that batches are sent concurrently.
 	sync.RWMutex
-	c        influxdb_common.InfluxdbConfig
-	dbExists bool
+	client     influxdb_common.InfluxdbClient
+	c          influxdb_common.InfluxdbConfig
+	dbExists   bool
+	attributes *util.AttributeExtractor
+	// Maximum number of points sent in one request.
+	batchSize int
 }
 
 const (
@@ -47,11 +53,17 @@ const (
 	// Event special tags
 	dbNotFoundError = "database not found"
 
-	// Maximum number of influxdb Points to be sent in one batch.
-	maxSendBatchSize = 1000
+	// Default number of influxdb Points to be sent in one batch.
+	defaultBatchSize = 1000
 )
 
-func (sink *influxdbSink) resetConnection() {
+// Drops the client, unless another export already replaced it.
+func (sink *influxdbSink) resetConnection(client influxdb_common.InfluxdbClient) {
+	sink.Lock()
+	defer sink.Unlock()
+	if sink.client != client {
+		return
+	}
 	glog.Infof("Influxdb connection reset")
 	sink.dbExists = false
 	sink.client = nil
@@ -116,9 +128,6 @@ func eventToPoint(event *kube_api.Event) (*influxdb.Point, error) {
 }
 
 func (sink *influxdbSink) ExportEvents(eventBatch *core.EventBatch) {
-	sink.Lock()
-	defer sink.Unlock()
-
 	dataPoints := make([]influxdb.Point, 0, 10)
 	for _, event := range eventBatch.Events {
 		var point *influxdb.Point
@@ -131,8 +140,11 @@ func (sink *influxdbSink) ExportEvents(eventBatch *core.EventBatch) {
 		if err != nil {
 			glog.Warningf("Failed to convert event to point: %v", err)
 		}
+		for name, value := range sink.attributes.Extract(event) {
+			point.Tags[name] = value
+		}
 		dataPoints = append(dataPoints, *point)
-		if len(dataPoints) >= maxSendBatchSize {
+		if len(dataPoints) >= sink.batchSize {
 			sink.sendData(dataPoints)
 			dataPoints = make([]influxdb.Point, 0, 1)
 		}
@@ -143,7 +155,11 @@ func (sink *influxdbSink) ExportEvents(eventBatch *core.EventBatch) {
 }
 
 func (sink *influxdbSink) sendData(dataPoints []influxdb.Point) {
-	if err := sink.createDatabase(); err != nil {
+	sink.Lock()
+	err := sink.createDatabase()
+	client := sink.client
+	sink.Unlock()
+	if err != nil {
 		glog.Errorf("Failed to create infuxdb: %v", err)
 		return
 	}
@@ -154,13 +170,13 @@ func (sink *influxdbSink) sendData(dataPoints []influxdb.Point) {
 	}
 
 	start := time.Now()
-	if _, err := sink.client.Write(bp); err != nil {
+	if _, err := client.Write(bp); err != nil {
 		glog.Errorf("InfluxDB write failed: %v", err)
 		if strings.Contains(err.Error(), dbNotFoundError) {
-			sink.resetConnection()
-		} else if _, _, err := sink.client.Ping(); err != nil {
+			sink.resetConnection(client)
+		} else if _, _, err := client.Ping(); err != nil {
 			glog.Errorf("InfluxDB ping failed: %v", err)
-			sink.resetConnection()
+			sink.resetConnection(client)
 		}
 	}
 	end := time.Now()
@@ -184,7 +200,8 @@ func (sink *influxdbSink) createDatabase() error {
 		sink.client = client
 	}
 
-	if sink.dbExists {
+	// Buckets of the 2.x API aren't created by the sink.
+	if sink.dbExists || sink.c.ApiVersion == 2 {
 		return nil
 	}
 
@@ -230,8 +247,9 @@ func new(c influxdb_common.InfluxdbConfig) core.EventSink {
 		glog.Errorf("issues while creating an InfluxDB sink: %v, will retry on use", err)
 	}
 	return &influxdbSink{
-		client: client, // can be nil
-		c:      c,
+		client:    client, // can be nil
+		c:         c,
+		batchSize: defaultBatchSize,
 	}
 }
 
@@ -240,7 +258,19 @@ func CreateInfluxdbSink(uri *url.URL) (core.EventSink, error) {
 	if err != nil {
 		return nil, err
 	}
+	attributes, err := util.NewAttributeExtractor(uri.Query()["attribute"])
+	if err != nil {
+		return nil, err
+	}
+	batchSize := defaultBatchSize
+	if len(uri.Query()["batchsize"]) >= 1 {
+		if batchSize, err = strconv.Atoi(uri.Query()["batchsize"][0]); err != nil || batchSize < 1 {
+			return nil, fmt.Errorf("failed to parse `batchsize` flag - should be a positive number")
+		}
+	}
 	sink := new(*config)
+	sink.(*influxdbSink).attributes = attributes
+	sink.(*influxdbSink).batchSize = batchSize
 	glog.Infof("created influxdb sink with options: host:%s user:%s db:%s", config.Host, config.User, config.DbName)
 	return sink, nil
 }
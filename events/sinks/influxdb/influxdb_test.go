@@ -21,6 +21,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 
+	influxdb "github.com/influxdata/influxdb/client"
 	"github.com/stretchr/testify/assert"
 	influxdb_common "k8s.io/heapster/common/influxdb"
 	"k8s.io/heapster/events/core"
@@ -37,8 +38,9 @@ type fakeInfluxDBEventSink struct {
 func NewFakeSink() fakeInfluxDBEventSink {
 	return fakeInfluxDBEventSink{
 		&influxdbSink{
-			client: influxdb_common.Client,
-			c:      influxdb_common.Config,
+			client:    influxdb_common.Client,
+			c:         influxdb_common.Config,
+			batchSize: defaultBatchSize,
 		},
 		influxdb_common.Client,
 	}
@@ -101,4 +103,41 @@ func TestCreateInfluxdbSink(t *testing.T) {
 
 	//check sink name
 	assert.Equal(t, sink.Name(), "InfluxDB Sink")
+	assert.Equal(t, defaultBatchSize, sink.(*influxdbSink).batchSize)
+
+	uri, err := url.Parse(server.URL + "?batchsize=5000")
+	assert.NoError(t, err)
+	sink, err = CreateInfluxdbSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, 5000, sink.(*influxdbSink).batchSize)
+
+	uri, err = url.Parse(server.URL + "?batchsize=0")
+	assert.NoError(t, err)
+	_, err = CreateInfluxdbSink(uri)
+	assert.Error(t, err)
+}
+
+// Records the number of points of each write.
+type batchRecordingClient struct {
+	*influxdb_common.FakeInfluxDBClient
+	batches []int
+}
+
+func (client *batchRecordingClient) Write(bps influxdb.BatchPoints) (*influxdb.Response, error) {
+	client.batches = append(client.batches, len(bps.Points))
+	return nil, nil
+}
+
+func TestBatchSize(t *testing.T) {
+	client := &batchRecordingClient{FakeInfluxDBClient: influxdb_common.NewFakeInfluxDBClient()}
+	sink := &influxdbSink{client: client, c: influxdb_common.Config, dbExists: true, batchSize: 2}
+	batch := core.EventBatch{Timestamp: time.Now()}
+	for i := 0; i < 5; i++ {
+		batch.Events = append(batch.Events, &kube_api.Event{
+			Message:       "event",
+			LastTimestamp: kube_api_unversioned.NewTime(time.Now()),
+		})
+	}
+	sink.ExportEvents(&batch)
+	assert.Equal(t, []int{2, 2, 1}, client.batches)
 }
@@ -17,12 +17,12 @@ package kafka
 import (
 	"encoding/json"
 	"net/url"
-	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	kafka_common "k8s.io/heapster/common/kafka"
 	event_core "k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/util"
 	"k8s.io/heapster/metrics/core"
 	kube_api "k8s.io/kubernetes/pkg/api"
 )
@@ -35,7 +35,7 @@ type KafkaSinkPoint struct {
 
 type kafkaSink struct {
 	kafka_common.KafkaClient
-	sync.RWMutex
+	attributes *util.AttributeExtractor
 }
 
 func getEventValue(event *kube_api.Event) (string, error) {
@@ -67,15 +67,16 @@ func eventToPoint(event *kube_api.Event) (*KafkaSinkPoint, error) {
 	return &point, nil
 }
 
+// Safe to call concurrently, as the producer is.
 func (sink *kafkaSink) ExportEvents(eventBatch *event_core.EventBatch) {
-	sink.Lock()
-	defer sink.Unlock()
-
 	for _, event := range eventBatch.Events {
 		point, err := eventToPoint(event)
 		if err != nil {
 			glog.Warningf("Failed to convert event to point: %v", err)
 		}
+		for name, value := range sink.attributes.Extract(event) {
+			point.EventTags[name] = value
+		}
 
 		err = sink.ProduceKafkaMessage(*point)
 		if err != nil {
@@ -85,6 +86,10 @@ func (sink *kafkaSink) ExportEvents(eventBatch *event_core.EventBatch) {
 }
 
 func NewKafkaSink(uri *url.URL) (event_core.EventSink, error) {
+	attributes, err := util.NewAttributeExtractor(uri.Query()["attribute"])
+	if err != nil {
+		return nil, err
+	}
 	client, err := kafka_common.NewKafkaClient(uri, kafka_common.EventsTopic)
 	if err != nil {
 		return nil, err
@@ -92,5 +97,6 @@ func NewKafkaSink(uri *url.URL) (event_core.EventSink, error) {
 
 	return &kafkaSink{
 		KafkaClient: client,
+		attributes:  attributes,
 	}, nil
 }
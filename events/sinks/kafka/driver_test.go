@@ -20,6 +20,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	event_core "k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/util"
 	kube_api "k8s.io/kubernetes/pkg/api"
 	kube_api_unversioned "k8s.io/kubernetes/pkg/api/unversioned"
 )
@@ -45,6 +46,10 @@ func (client *fakeKafkaClient) ProduceKafkaMessage(msgData interface{}) error {
 	return nil
 }
 
+func (client *fakeKafkaClient) ProduceKeyedKafkaMessage(key string, msgData interface{}) error {
+	return client.ProduceKafkaMessage(msgData)
+}
+
 func (client *fakeKafkaClient) Name() string {
 	return "Apache Kafka Sink"
 }
@@ -99,3 +104,23 @@ func TestStoreMultipleEventsInput(t *testing.T) {
 	assert.Equal(t, 2, len(fakeSink.fakeClient.points))
 
 }
+
+func TestStoreEventAttributes(t *testing.T) {
+	fakeSink := NewFakeSink()
+	attributes, err := util.NewAttributeExtractor([]string{`exit_code:{.message}:exit code (\d+)`})
+	assert.NoError(t, err)
+	fakeSink.EventSink.(*kafkaSink).attributes = attributes
+
+	now := time.Now()
+	event := kube_api.Event{
+		Message:        "terminated with exit code 2",
+		LastTimestamp:  kube_api_unversioned.NewTime(now),
+		FirstTimestamp: kube_api_unversioned.NewTime(now),
+	}
+	fakeSink.ExportEvents(&event_core.EventBatch{
+		Timestamp: now,
+		Events:    []*kube_api.Event{&event},
+	})
+	assert.Equal(t, 1, len(fakeSink.fakeClient.points))
+	assert.Equal(t, "2", fakeSink.fakeClient.points[0].EventTags["exit_code"])
+}
@@ -15,17 +15,29 @@
 package sinks
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/heapster/events/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	kube_types "k8s.io/kubernetes/pkg/types"
 )
 
 const (
-	DefaultSinkExportEventsTimeout = 20 * time.Second
-	DefaultSinkStopTimeout         = 60 * time.Second
+	DefaultSinkQueueSize      = 100000
+	DefaultSinkBatchSize      = 1000
+	DefaultSinkWorkers        = 4
+	DefaultSinkOverloadPolicy = OverloadPolicyDrop
+	DefaultSinkStopTimeout    = 60 * time.Second
+
+	// Events that don't fit in the sink queue are dropped.
+	OverloadPolicyDrop = "drop"
+	// Events that don't fit in the sink queue replace the queued version of the same event
+	// (which Kubernetes updates in place, e.g. to bump its count). Other events are dropped.
+	OverloadPolicyAggregate = "aggregate"
 )
 
 var (
@@ -39,78 +51,114 @@ var (
 		},
 		[]string{"exporter"},
 	)
+
+	// Number of events dropped because the sink queue was full.
+	droppedEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "dropped_events",
+			Help:      "Number of events dropped because the sink queue was full.",
+		},
+		[]string{"exporter"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(exporterDuration)
+	prometheus.MustRegister(droppedEvents)
 }
 
 type sinkHolder struct {
-	sink              core.EventSink
-	eventBatchChannel chan *core.EventBatch
-	stopChannel       chan bool
+	sink        core.EventSink
+	queue       *eventQueue
+	stopChannel chan struct{}
+	workers     sync.WaitGroup
 }
 
-// Sink Manager - a special sink that distributes data to other sinks. It pushes data
-// only to these sinks that completed their previous exports. Data that could not be
-// pushed in the defined time is dropped and not retried.
+// Sink Manager - a special sink that distributes events to other sinks. Every sink has
+// a bounded queue of events, which is drained in batches by a pool of workers. Events that
+// don't fit in the queue are handled according to the overload policy and not retried.
 type sinkManager struct {
-	sinkHolders         []sinkHolder
-	exportEventsTimeout time.Duration
-	// Should be larger than exportEventsTimeout, although it is not a hard requirement.
+	sinkHolders []*sinkHolder
+	// Should be larger than the time a single export takes, although it is not a hard requirement.
 	stopTimeout time.Duration
 }
 
-func NewEventSinkManager(sinks []core.EventSink, exportEventsTimeout, stopTimeout time.Duration) (core.EventSink, error) {
-	sinkHolders := []sinkHolder{}
+func NewEventSinkManager(sinks []core.EventSink, queueSize, batchSize, workers int, overloadPolicy string, stopTimeout time.Duration) (core.EventSink, error) {
+	if queueSize < 1 || batchSize < 1 || workers < 1 {
+		return nil, fmt.Errorf("queue size, batch size and number of workers must be positive")
+	}
+	if overloadPolicy != OverloadPolicyDrop && overloadPolicy != OverloadPolicyAggregate {
+		return nil, fmt.Errorf("unknown overload policy %q, should be one of %s, %s", overloadPolicy, OverloadPolicyDrop, OverloadPolicyAggregate)
+	}
+
+	sinkHolders := []*sinkHolder{}
 	for _, sink := range sinks {
-		sh := sinkHolder{
-			sink:              sink,
-			eventBatchChannel: make(chan *core.EventBatch),
-			stopChannel:       make(chan bool),
+		sh := &sinkHolder{
+			sink:        sink,
+			queue:       newEventQueue(queueSize, overloadPolicy == OverloadPolicyAggregate),
+			stopChannel: make(chan struct{}),
 		}
 		sinkHolders = append(sinkHolders, sh)
-		go func(sh sinkHolder) {
+		for i := 0; i < workers; i++ {
+			sh.workers.Add(1)
+			go sh.work(batchSize)
+		}
+	}
+	return &sinkManager{
+		sinkHolders: sinkHolders,
+		stopTimeout: stopTimeout,
+	}, nil
+}
+
+// Exports batches of queued events until stopped, and then the events left in the queue.
+// Workers of the same sink export concurrently.
+func (sh *sinkHolder) work(batchSize int) {
+	defer sh.workers.Done()
+	for {
+		select {
+		case <-sh.queue.ready:
+			events, more := sh.queue.pop(batchSize)
+			if more {
+				// Let another worker pick up the rest in the meantime.
+				sh.queue.notify()
+			}
+			if len(events) > 0 {
+				export(sh.sink, &core.EventBatch{
+					Timestamp: time.Now(),
+					Events:    events,
+				})
+			}
+		case <-sh.stopChannel:
+			glog.V(2).Infof("Stop received: %s", sh.sink.Name())
 			for {
-				select {
-				case data := <-sh.eventBatchChannel:
-					export(sh.sink, data)
-				case isStop := <-sh.stopChannel:
-					glog.V(2).Infof("Stop received: %s", sh.sink.Name())
-					if isStop {
-						sh.sink.Stop()
-						return
-					}
+				events, _ := sh.queue.pop(batchSize)
+				if len(events) == 0 {
+					return
 				}
+				export(sh.sink, &core.EventBatch{
+					Timestamp: time.Now(),
+					Events:    events,
+				})
 			}
-		}(sh)
+		}
 	}
-	return &sinkManager{
-		sinkHolders:         sinkHolders,
-		exportEventsTimeout: exportEventsTimeout,
-		stopTimeout:         stopTimeout,
-	}, nil
 }
 
-// Guarantees that the export will complete in exportEventsTimeout.
+// Queues the events for all sinks and returns immediately; the events are exported
+// asynchronously.
 func (this *sinkManager) ExportEvents(data *core.EventBatch) {
-	var wg sync.WaitGroup
+	if len(data.Events) == 0 {
+		return
+	}
 	for _, sh := range this.sinkHolders {
-		wg.Add(1)
-		go func(sh sinkHolder, wg *sync.WaitGroup) {
-			defer wg.Done()
-			glog.V(2).Infof("Pushing events to: %s", sh.sink.Name())
-			select {
-			case sh.eventBatchChannel <- data:
-				glog.V(2).Infof("Data events completed: %s", sh.sink.Name())
-				// everything ok
-			case <-time.After(this.exportEventsTimeout):
-				glog.Warningf("Failed to events data to sink: %s", sh.sink.Name())
-			}
-		}(sh, &wg)
+		if dropped := sh.queue.push(data.Events); dropped > 0 {
+			glog.Warningf("Sink %s is overloaded, dropped %d events", sh.sink.Name(), dropped)
+			droppedEvents.WithLabelValues(sh.sink.Name()).Add(float64(dropped))
+		}
+		glog.V(2).Infof("Queued %d events for: %s", len(data.Events), sh.sink.Name())
 	}
-	// Wait for all pushes to complete or timeout.
-	wg.Wait()
 }
 
 func (this *sinkManager) Name() string {
@@ -121,16 +169,22 @@ func (this *sinkManager) Stop() {
 	for _, sh := range this.sinkHolders {
 		glog.V(2).Infof("Running stop for: %s", sh.sink.Name())
 
-		go func(sh sinkHolder) {
+		go func(sh *sinkHolder) {
+			close(sh.stopChannel)
+
+			done := make(chan struct{})
+			go func() {
+				sh.workers.Wait()
+				close(done)
+			}()
 			select {
-			case sh.stopChannel <- true:
+			case <-done:
 				// everything ok
-				glog.V(2).Infof("Stop sent to sink: %s", sh.sink.Name())
-
 			case <-time.After(this.stopTimeout):
-				glog.Warningf("Failed to stop sink: %s", sh.sink.Name())
+				glog.Warningf("Failed to wait for exports to sink: %s", sh.sink.Name())
 			}
-			return
+			sh.sink.Stop()
+			glog.V(2).Infof("Stopped sink: %s", sh.sink.Name())
 		}(sh)
 	}
 }
@@ -142,3 +196,93 @@ func export(s core.EventSink, data *core.EventBatch) {
 		Observe(float64(time.Since(startTime)) / float64(time.Microsecond))
 	s.ExportEvents(data)
 }
+
+// A bounded FIFO queue of events waiting to be exported to a sink.
+type eventQueue struct {
+	sync.Mutex
+	events    []*queuedEvent
+	size      int
+	aggregate bool
+	// Queued events by UID, maintained if aggregate is set.
+	byUID map[kube_types.UID]*queuedEvent
+	// Signalled when there are events to export.
+	ready chan struct{}
+}
+
+// An entry of the queue, which newer versions of the event replace in place.
+type queuedEvent struct {
+	event *kube_api.Event
+}
+
+func newEventQueue(size int, aggregate bool) *eventQueue {
+	q := &eventQueue{
+		size:      size,
+		aggregate: aggregate,
+		ready:     make(chan struct{}, 1),
+	}
+	if aggregate {
+		q.byUID = make(map[kube_types.UID]*queuedEvent)
+	}
+	return q
+}
+
+// Adds the events to the queue and returns the number of events that were dropped.
+func (q *eventQueue) push(events []*kube_api.Event) int {
+	q.Lock()
+	dropped := 0
+	for _, event := range events {
+		if len(q.events) < q.size {
+			queued := &queuedEvent{event: event}
+			q.events = append(q.events, queued)
+			if q.aggregate {
+				q.byUID[event.UID] = queued
+			}
+		} else if !q.aggregate || !q.replace(event) {
+			dropped++
+		}
+	}
+	q.Unlock()
+	q.notify()
+	return dropped
+}
+
+// Replaces the queued version of the given event. Must be called with the lock held.
+func (q *eventQueue) replace(event *kube_api.Event) bool {
+	queued, found := q.byUID[event.UID]
+	if !found {
+		return false
+	}
+	queued.event = event
+	return true
+}
+
+// Removes at most max events from the front of the queue. The second result tells
+// whether events are left in the queue.
+func (q *eventQueue) pop(max int) ([]*kube_api.Event, bool) {
+	q.Lock()
+	defer q.Unlock()
+	n := len(q.events)
+	if n > max {
+		n = max
+	}
+	result := make([]*kube_api.Event, n)
+	for i, queued := range q.events[:n] {
+		result[i] = queued.event
+		if q.aggregate && q.byUID[queued.event.UID] == queued {
+			delete(q.byUID, queued.event.UID)
+		}
+	}
+	q.events = q.events[n:]
+	if len(q.events) == 0 {
+		// Release the backing array so that exported events can be collected.
+		q.events = nil
+	}
+	return result, len(q.events) > 0
+}
+
+func (q *eventQueue) notify() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
@@ -15,83 +15,130 @@
 package sinks
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	kube_api "k8s.io/kubernetes/pkg/api"
+	kube_types "k8s.io/kubernetes/pkg/types"
 
 	"k8s.io/heapster/events/core"
 	"k8s.io/heapster/events/util"
 )
 
-func doThreeBatches(manager core.EventSink) time.Duration {
-	now := time.Now()
-	batch := core.EventBatch{
-		Timestamp: now,
+func makeBatch(names ...string) *core.EventBatch {
+	batch := &core.EventBatch{
+		Timestamp: time.Now(),
 		Events:    []*kube_api.Event{},
 	}
-
-	manager.ExportEvents(&batch)
-	manager.ExportEvents(&batch)
-	manager.ExportEvents(&batch)
-
-	elapsed := time.Now().Sub(now)
-	return elapsed
+	for _, name := range names {
+		event := &kube_api.Event{}
+		event.Namespace = "ns"
+		event.Name = name
+		event.UID = kube_types.UID(name)
+		batch.Events = append(batch.Events, event)
+	}
+	return batch
 }
 
-func TestAllExportsInTime(t *testing.T) {
-	timeout := 3 * time.Second
+func waitForEvents(sink *util.DummySink, count int, timeout time.Duration) bool {
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(10 * time.Millisecond) {
+		if sink.GetEventCount() >= count {
+			return true
+		}
+	}
+	return false
+}
 
-	sink1 := util.NewDummySink("s1", time.Second)
-	sink2 := util.NewDummySink("s2", time.Second)
-	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout)
+func TestAllEventsExported(t *testing.T) {
+	sink1 := util.NewDummySink("s1", 0)
+	sink2 := util.NewDummySink("s2", 0)
+	manager, err := NewEventSinkManager([]core.EventSink{sink1, sink2}, 100, 10, 2, OverloadPolicyDrop, time.Second)
+	assert.NoError(t, err)
 
-	elapsed := doThreeBatches(manager)
-	if elapsed > 2*timeout+2*time.Second {
-		t.Fatalf("3xExportEvents took too long: %s", elapsed)
+	names := []string{}
+	for i := 0; i < 25; i++ {
+		names = append(names, fmt.Sprintf("e%d", i))
 	}
-
-	assert.Equal(t, 3, sink1.GetExportCount())
-	assert.Equal(t, 3, sink2.GetExportCount())
+	manager.ExportEvents(makeBatch(names...))
+	manager.ExportEvents(makeBatch("e25", "e26"))
+	manager.ExportEvents(makeBatch())
+
+	assert.True(t, waitForEvents(sink1, 27, 5*time.Second))
+	assert.True(t, waitForEvents(sink2, 27, 5*time.Second))
+	// Events are exported in batches of at most 10.
+	assert.True(t, sink1.GetExportCount() >= 3)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 27, sink1.GetEventCount())
+	assert.Equal(t, 27, sink2.GetEventCount())
 }
 
-func TestOneExportInTime(t *testing.T) {
-	timeout := 3 * time.Second
-
-	sink1 := util.NewDummySink("s1", time.Second)
+func TestSlowSinkDoesNotBlock(t *testing.T) {
+	sink1 := util.NewDummySink("s1", 0)
 	sink2 := util.NewDummySink("s2", 30*time.Second)
-	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout)
+	manager, err := NewEventSinkManager([]core.EventSink{sink1, sink2}, 100, 10, 1, OverloadPolicyDrop, time.Second)
+	assert.NoError(t, err)
 
-	elapsed := doThreeBatches(manager)
-	if elapsed > 2*timeout+2*time.Second {
+	now := time.Now()
+	manager.ExportEvents(makeBatch("a"))
+	manager.ExportEvents(makeBatch("b"))
+	manager.ExportEvents(makeBatch("c"))
+	if elapsed := time.Since(now); elapsed > time.Second {
 		t.Fatalf("3xExportEvents took too long: %s", elapsed)
 	}
-	if elapsed < 2*timeout-1*time.Second {
-		t.Fatalf("3xExportEvents took too short: %s", elapsed)
-	}
 
-	assert.Equal(t, 3, sink1.GetExportCount())
+	assert.True(t, waitForEvents(sink1, 3, 5*time.Second))
 	assert.Equal(t, 1, sink2.GetExportCount())
 }
 
-func TestNoExportInTime(t *testing.T) {
-	timeout := 3 * time.Second
-
-	sink1 := util.NewDummySink("s1", 30*time.Second)
-	sink2 := util.NewDummySink("s2", 30*time.Second)
-	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout)
-
-	elapsed := doThreeBatches(manager)
-	if elapsed > 2*timeout+2*time.Second {
-		t.Fatalf("3xExportEvents took too long: %s", elapsed)
-	}
-	if elapsed < 2*timeout-1*time.Second {
-		t.Fatalf("3xExportEvents took too short: %s", elapsed)
+func TestOverloadPolicies(t *testing.T) {
+	for _, policy := range []string{OverloadPolicyDrop, OverloadPolicyAggregate} {
+		// The first export blocks the only worker, so that the rest stays queued.
+		sink := util.NewDummySink("s", time.Second)
+		manager, err := NewEventSinkManager([]core.EventSink{sink}, 2, 10, 1, policy, time.Second)
+		assert.NoError(t, err)
+
+		manager.ExportEvents(makeBatch("a"))
+		assert.True(t, waitForEvents(sink, 1, 5*time.Second))
+
+		updated := makeBatch("b", "c", "b", "d")
+		manager.ExportEvents(updated)
+		assert.True(t, waitForEvents(sink, 3, 5*time.Second), "for policy %s", policy)
+
+		queue := manager.(*sinkManager).sinkHolders[0].queue
+		queue.Lock()
+		assert.Len(t, queue.events, 0)
+		queue.Unlock()
+		time.Sleep(1500 * time.Millisecond)
+		assert.Equal(t, 3, sink.GetEventCount(), "for policy %s", policy)
 	}
+}
 
-	assert.Equal(t, 1, sink1.GetExportCount())
-	assert.Equal(t, 1, sink2.GetExportCount())
+func TestEventQueue(t *testing.T) {
+	batch := makeBatch("a", "b", "a", "c")
+
+	q := newEventQueue(2, false)
+	assert.Equal(t, 2, q.push(batch.Events))
+	events, more := q.pop(1)
+	assert.Equal(t, []*kube_api.Event{batch.Events[0]}, events)
+	assert.True(t, more)
+	events, more = q.pop(10)
+	assert.Equal(t, []*kube_api.Event{batch.Events[1]}, events)
+	assert.False(t, more)
+
+	q = newEventQueue(2, true)
+	assert.Equal(t, 1, q.push(batch.Events))
+	events, _ = q.pop(10)
+	// The second version of "a" replaced the first one, "c" was dropped.
+	assert.Equal(t, []*kube_api.Event{batch.Events[2], batch.Events[1]}, events)
+}
+
+func TestInvalidOptions(t *testing.T) {
+	_, err := NewEventSinkManager([]core.EventSink{}, 0, 10, 1, OverloadPolicyDrop, time.Second)
+	assert.Error(t, err)
+	_, err = NewEventSinkManager([]core.EventSink{}, 10, 10, 1, "retry", time.Second)
+	assert.Error(t, err)
 }
 
 func TestStop(t *testing.T) {
@@ -99,7 +146,7 @@ func TestStop(t *testing.T) {
 
 	sink1 := util.NewDummySink("s1", 30*time.Second)
 	sink2 := util.NewDummySink("s2", 30*time.Second)
-	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout)
+	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, 10, 10, 1, OverloadPolicyDrop, timeout)
 
 	now := time.Now()
 	manager.Stop()
@@ -112,3 +159,22 @@ func TestStop(t *testing.T) {
 	assert.Equal(t, true, sink1.IsStopped())
 	assert.Equal(t, true, sink2.IsStopped())
 }
+
+func TestStopExportsQueuedEvents(t *testing.T) {
+	// The first export blocks the only worker, so that the rest stays queued.
+	sink := util.NewDummySink("s", 500*time.Millisecond)
+	manager, err := NewEventSinkManager([]core.EventSink{sink}, 10, 2, 1, OverloadPolicyDrop, 5*time.Second)
+	assert.NoError(t, err)
+
+	manager.ExportEvents(makeBatch("a"))
+	assert.True(t, waitForEvents(sink, 1, 5*time.Second))
+	manager.ExportEvents(makeBatch("b", "c", "d"))
+	manager.Stop()
+
+	assert.True(t, waitForEvents(sink, 4, 5*time.Second))
+	for start := time.Now(); !sink.IsStopped() && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, sink.IsStopped())
+	assert.Equal(t, 4, sink.GetEventCount())
+}
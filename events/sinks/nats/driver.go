@@ -0,0 +1,169 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/util"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	defaultSubject = "kubernetes.events.{{.Namespace}}.{{.Reason}}"
+	defaultTimeout = 10 * time.Second
+	// Number of events published between two flushes. A failed export is retried from the
+	// first event that wasn't flushed.
+	defaultFlushEvery = 100
+)
+
+type natsSink struct {
+	sync.Mutex
+	server  *url.URL
+	subject *util.EventTemplate
+	timeout time.Duration
+	conn    *natsConn
+	// Number of events published between two flushes.
+	flushEvery int
+}
+
+func (sink *natsSink) Name() string {
+	return "NATS Sink"
+}
+
+func (sink *natsSink) ExportEvents(eventBatch *core.EventBatch) {
+	sink.Lock()
+	defer sink.Unlock()
+
+	if len(eventBatch.Events) == 0 {
+		return
+	}
+	sent, err := sink.publish(eventBatch.Events)
+	if err != nil && sink.conn != nil {
+		// The server might have dropped an idle connection, try once more with a new one,
+		// without the events the server already acknowledged.
+		sink.disconnect()
+		var retried int
+		retried, err = sink.publish(eventBatch.Events[sent:])
+		sent += retried
+	}
+	if err != nil {
+		sink.disconnect()
+		glog.Errorf("Failed to export %d events to NATS: %v", len(eventBatch.Events)-sent, err)
+		return
+	}
+	glog.V(4).Infof("Exported %d events to NATS", len(eventBatch.Events))
+}
+
+// Publishes the events and returns the number of them the server acknowledged.
+func (sink *natsSink) publish(events []*kube_api.Event) (int, error) {
+	if sink.conn == nil {
+		conn, err := dialNats(sink.server, sink.timeout)
+		if err != nil {
+			return 0, err
+		}
+		sink.conn = conn
+	}
+	sent := 0
+	for i, event := range events {
+		if i-sent == sink.flushEvery {
+			if err := sink.conn.flush(); err != nil {
+				return sent, err
+			}
+			sent = i
+		}
+		subject, err := sink.subject.Execute(event)
+		if err != nil {
+			glog.Warningf("Failed to build NATS subject for event %s/%s: %v", event.Namespace, event.Name, err)
+			continue
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			glog.Warningf("Failed to marshal event %s/%s: %v", event.Namespace, event.Name, err)
+			continue
+		}
+		if err := sink.conn.publish(natsSubject(subject), payload); err != nil {
+			return sent, err
+		}
+	}
+	if err := sink.conn.flush(); err != nil {
+		return sent, err
+	}
+	return len(events), nil
+}
+
+func (sink *natsSink) disconnect() {
+	if sink.conn != nil {
+		sink.conn.close()
+		sink.conn = nil
+	}
+}
+
+func (sink *natsSink) Stop() {
+	sink.Lock()
+	defer sink.Unlock()
+	sink.disconnect()
+}
+
+// NATS subjects can't contain whitespace or empty tokens.
+func natsSubject(subject string) string {
+	tokens := strings.Split(strings.Join(strings.Fields(subject), "_"), ".")
+	for i, token := range tokens {
+		if token == "" {
+			tokens[i] = "_"
+		}
+	}
+	return strings.Join(tokens, ".")
+}
+
+func CreateNatsSink(uri *url.URL) (core.EventSink, error) {
+	if uri.Host == "" {
+		return nil, fmt.Errorf("NATS server address is required, e.g. nats:nats://localhost:4222")
+	}
+	opts := uri.Query()
+
+	subjectText := defaultSubject
+	if len(opts["subject"]) >= 1 {
+		subjectText = opts["subject"][0]
+	}
+	subject, err := util.NewEventTemplate(subjectText)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultTimeout
+	if len(opts["timeout"]) >= 1 {
+		timeout, err = time.ParseDuration(opts["timeout"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `timeout` flag - %v", err)
+		}
+	}
+
+	server := &url.URL{Scheme: uri.Scheme, Host: uri.Host, User: uri.User}
+	glog.Infof("Created NATS sink publishing to %s", server.Host)
+	return &natsSink{
+		server:     server,
+		subject:    subject,
+		timeout:    timeout,
+		flushEvery: defaultFlushEvery,
+	}, nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/events/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+type natsMessage struct {
+	subject string
+	payload []byte
+}
+
+// A fake NATS server accepting publishes on a single connection at a time.
+type fakeNatsServer struct {
+	sync.Mutex
+	listener net.Listener
+	connect  string
+	messages []natsMessage
+	// When set, the next connection is closed after answering that many PINGs.
+	closeAfterPongs int
+}
+
+func newFakeNatsServer(t *testing.T) *fakeNatsServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &fakeNatsServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeNatsServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\"}\r\n")
+	s.Lock()
+	closeAfterPongs := s.closeAfterPongs
+	s.closeAfterPongs = 0
+	s.Unlock()
+	for pongs := 0; ; {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			s.Lock()
+			s.connect = strings.TrimPrefix(line, "CONNECT ")
+			s.Unlock()
+		case strings.HasPrefix(line, "PUB "):
+			var subject string
+			var size int
+			fmt.Sscanf(line, "PUB %s %d", &subject, &size)
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			s.Lock()
+			s.messages = append(s.messages, natsMessage{subject: subject, payload: payload[:size]})
+			s.Unlock()
+		case line == "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+			if pongs++; pongs == closeAfterPongs {
+				return
+			}
+		}
+	}
+}
+
+func (s *fakeNatsServer) getMessages() []natsMessage {
+	s.Lock()
+	defer s.Unlock()
+	return s.messages
+}
+
+func newEvent(namespace, name, reason string) *kube_api.Event {
+	event := &kube_api.Event{Reason: reason}
+	event.Namespace = namespace
+	event.Name = name
+	return event
+}
+
+func TestExportEvents(t *testing.T) {
+	server := newFakeNatsServer(t)
+	defer server.listener.Close()
+
+	uri, err := url.Parse(fmt.Sprintf("nats://user:secret@%s?subject=k8s.{{.Namespace}}.{{.Reason}}", server.listener.Addr()))
+	require.NoError(t, err)
+	sink, err := CreateNatsSink(uri)
+	require.NoError(t, err)
+	defer sink.Stop()
+
+	sink.ExportEvents(&core.EventBatch{
+		Timestamp: time.Now(),
+		Events: []*kube_api.Event{
+			newEvent("ns1", "e1", "FailedScheduling"),
+			newEvent("ns2", "e2", "Back Off"),
+		},
+	})
+
+	messages := server.getMessages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "k8s.ns1.FailedScheduling", messages[0].subject)
+	assert.Equal(t, "k8s.ns2.Back_Off", messages[1].subject)
+	event := kube_api.Event{}
+	require.NoError(t, json.Unmarshal(messages[0].payload, &event))
+	assert.Equal(t, "e1", event.Name)
+
+	options := natsConnectOptions{}
+	require.NoError(t, json.Unmarshal([]byte(server.connect), &options))
+	assert.Equal(t, "user", options.User)
+	assert.Equal(t, "secret", options.Pass)
+
+	// The sink reconnects after losing the connection.
+	sink.(*natsSink).conn.close()
+	sink.ExportEvents(&core.EventBatch{
+		Timestamp: time.Now(),
+		Events:    []*kube_api.Event{newEvent("ns1", "e3", "Started")},
+	})
+	messages = server.getMessages()
+	require.Len(t, messages, 3)
+	assert.Equal(t, "k8s.ns1.Started", messages[2].subject)
+}
+
+func TestNatsSubject(t *testing.T) {
+	assert.Equal(t, "a.b.c", natsSubject("a.b.c"))
+	assert.Equal(t, "a._.c", natsSubject("a..c"))
+	assert.Equal(t, "a.b_c", natsSubject("a.b c"))
+}
+
+func TestCreateNatsSinkErrors(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"nats://localhost:4222?subject={{.Namespace",
+		"nats://localhost:4222?timeout=abc",
+	} {
+		uri, err := url.Parse(raw)
+		require.NoError(t, err)
+		_, err = CreateNatsSink(uri)
+		assert.Error(t, err, "for %q", raw)
+	}
+}
+
+func TestRetryPublishesUnsentEvents(t *testing.T) {
+	server := newFakeNatsServer(t)
+	defer server.listener.Close()
+	// The connection is closed after the handshake and the first flush.
+	server.closeAfterPongs = 2
+
+	uri, err := url.Parse(fmt.Sprintf("nats://%s?subject=k8s.{{.Namespace}}", server.listener.Addr()))
+	require.NoError(t, err)
+	sink, err := CreateNatsSink(uri)
+	require.NoError(t, err)
+	defer sink.Stop()
+	sink.(*natsSink).flushEvery = 2
+
+	events := []*kube_api.Event{}
+	for i := 0; i < 5; i++ {
+		events = append(events, newEvent(fmt.Sprintf("ns%d", i), "e", "Started"))
+	}
+	sink.ExportEvents(&core.EventBatch{Timestamp: time.Now(), Events: events})
+
+	// The acknowledged events aren't published again.
+	subjects := []string{}
+	for _, message := range server.getMessages() {
+		subjects = append(subjects, message.subject)
+	}
+	assert.Equal(t, []string{"k8s.ns0", "k8s.ns1", "k8s.ns2", "k8s.ns3", "k8s.ns4"}, subjects)
+}
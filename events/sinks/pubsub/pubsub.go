@@ -0,0 +1,169 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	gce_util "k8s.io/heapster/common/gce"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/util"
+
+	gce "cloud.google.com/go/compute/metadata"
+	"github.com/golang/glog"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	pubsubEndpoint = "https://pubsub.googleapis.com/v1/"
+	defaultTopic   = "kubernetes-events"
+	// Maximum number of messages in a single publish request.
+	maxMessagesPerRequest = 1000
+)
+
+type pubsubMessage struct {
+	Data       string            `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type publishRequest struct {
+	Messages []pubsubMessage `json:"messages"`
+}
+
+type pubsubSink struct {
+	project    string
+	topic      *util.EventTemplate
+	attributes *util.AttributeExtractor
+	client     *http.Client
+	endpoint   string
+}
+
+func (sink *pubsubSink) Name() string {
+	return "Google Pub/Sub Sink"
+}
+
+func (sink *pubsubSink) ExportEvents(eventBatch *core.EventBatch) {
+	messages := make(map[string][]pubsubMessage)
+	for _, event := range eventBatch.Events {
+		topic, err := sink.topic.Execute(event)
+		if err != nil {
+			glog.Warningf("Failed to build Pub/Sub topic for event %s/%s: %v", event.Namespace, event.Name, err)
+			continue
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			glog.Warningf("Failed to marshal event %s/%s: %v", event.Namespace, event.Name, err)
+			continue
+		}
+		attributes := map[string]string{
+			"namespace": event.Namespace,
+			"reason":    event.Reason,
+			"kind":      event.InvolvedObject.Kind,
+			"name":      event.InvolvedObject.Name,
+		}
+		for name, value := range sink.attributes.Extract(event) {
+			attributes[name] = value
+		}
+		messages[topic] = append(messages[topic], pubsubMessage{
+			Data:       base64.StdEncoding.EncodeToString(data),
+			Attributes: attributes,
+		})
+	}
+
+	for topic, topicMessages := range messages {
+		for start := 0; start < len(topicMessages); start += maxMessagesPerRequest {
+			end := start + maxMessagesPerRequest
+			if end > len(topicMessages) {
+				end = len(topicMessages)
+			}
+			if err := sink.publish(topic, topicMessages[start:end]); err != nil {
+				glog.Errorf("Failed to publish %d events to Pub/Sub topic %s: %v", end-start, topic, err)
+			} else {
+				glog.V(4).Infof("Published %d events to Pub/Sub topic %s", end-start, topic)
+			}
+		}
+	}
+}
+
+func (sink *pubsubSink) publish(topic string, messages []pubsubMessage) error {
+	body, err := json.Marshal(publishRequest{Messages: messages})
+	if err != nil {
+		return err
+	}
+	publishUrl := fmt.Sprintf("%sprojects/%s/topics/%s:publish", sink.endpoint, url.QueryEscape(sink.project), url.QueryEscape(topic))
+	resp, err := sink.client.Post(publishUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("publish failed with status %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func (sink *pubsubSink) Stop() {
+	// nothing needs to be done.
+}
+
+func CreatePubSubSink(uri *url.URL) (core.EventSink, error) {
+	if err := gce_util.EnsureOnGCE(); err != nil {
+		return nil, err
+	}
+	opts := uri.Query()
+
+	topicText := defaultTopic
+	if len(opts["topic"]) >= 1 {
+		topicText = opts["topic"][0]
+	}
+	topic, err := util.NewEventTemplate(topicText)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := util.NewAttributeExtractor(opts["attribute"])
+	if err != nil {
+		return nil, err
+	}
+
+	var project string
+	if len(opts["project"]) >= 1 {
+		project = opts["project"][0]
+	} else {
+		// Detect project ID
+		project, err = gce.ProjectID()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client := oauth2.NewClient(oauth2.NoContext, google.ComputeTokenSource(""))
+	glog.Infof("Created Pub/Sub sink for project %s", project)
+	return &pubsubSink{
+		project:    project,
+		topic:      topic,
+		attributes: attributes,
+		client:     client,
+		endpoint:   pubsubEndpoint,
+	}, nil
+}
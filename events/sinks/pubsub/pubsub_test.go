@@ -0,0 +1,75 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/util"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+func TestExportEvents(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]publishRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := publishRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		lock.Lock()
+		requests[r.URL.Path] = req
+		lock.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	topic, err := util.NewEventTemplate("events-{{.Namespace}}")
+	require.NoError(t, err)
+	sink := &pubsubSink{
+		project:  "my-project",
+		topic:    topic,
+		client:   http.DefaultClient,
+		endpoint: server.URL + "/v1/",
+	}
+
+	events := []*kube_api.Event{{Reason: "Killing"}, {Reason: "Started"}, {Reason: "Pulled"}}
+	events[0].Namespace = "ns1"
+	events[1].Namespace = "ns2"
+	events[2].Namespace = "ns1"
+	events[2].InvolvedObject.Kind = "Pod"
+	sink.ExportEvents(&core.EventBatch{Timestamp: time.Now(), Events: events})
+
+	require.Len(t, requests, 2)
+	ns1 := requests["/v1/projects/my-project/topics/events-ns1:publish"]
+	require.Len(t, ns1.Messages, 2)
+	assert.Equal(t, "Pulled", ns1.Messages[1].Attributes["reason"])
+	assert.Equal(t, "Pod", ns1.Messages[1].Attributes["kind"])
+
+	data, err := base64.StdEncoding.DecodeString(ns1.Messages[0].Data)
+	require.NoError(t, err)
+	event := kube_api.Event{}
+	require.NoError(t, json.Unmarshal(data, &event))
+	assert.Equal(t, "Killing", event.Reason)
+
+	assert.Len(t, requests["/v1/projects/my-project/topics/events-ns2:publish"].Messages, 1)
+}
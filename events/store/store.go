@@ -0,0 +1,160 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/heapster/events/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+// EventStore is an event sink that keeps recent events in memory, indexed by the object
+// they involve. Events that weren't updated within the retention period are discarded.
+type EventStore struct {
+	sync.RWMutex
+	retention time.Duration
+	// Events by namespace/name. Kubernetes updates events in place, so a newer version
+	// replaces the stored one.
+	events map[string]*kube_api.Event
+	// Names of the events involving an object, by the key of the object.
+	objects map[string]map[string]struct{}
+}
+
+func NewEventStore(retention time.Duration) *EventStore {
+	return &EventStore{
+		retention: retention,
+		events:    make(map[string]*kube_api.Event),
+		objects:   make(map[string]map[string]struct{}),
+	}
+}
+
+func (this *EventStore) Name() string {
+	return "Event Store"
+}
+
+func (this *EventStore) ExportEvents(batch *core.EventBatch) {
+	this.Lock()
+	defer this.Unlock()
+
+	for _, event := range batch.Events {
+		name := eventKey(event.Namespace, event.Name)
+		if old, found := this.events[name]; found {
+			this.unindex(name, old)
+		}
+		this.events[name] = event
+		object := objectKey(event.InvolvedObject.Kind, event.InvolvedObject.Namespace, event.InvolvedObject.Name)
+		if this.objects[object] == nil {
+			this.objects[object] = make(map[string]struct{})
+		}
+		this.objects[object][name] = struct{}{}
+	}
+
+	cutoff := batch.Timestamp.Add(-this.retention)
+	for name, event := range this.events {
+		if EventTime(event).Before(cutoff) {
+			delete(this.events, name)
+			this.unindex(name, event)
+		}
+	}
+}
+
+// Must be called with the lock held.
+func (this *EventStore) unindex(name string, event *kube_api.Event) {
+	object := objectKey(event.InvolvedObject.Kind, event.InvolvedObject.Namespace, event.InvolvedObject.Name)
+	delete(this.objects[object], name)
+	if len(this.objects[object]) == 0 {
+		delete(this.objects, object)
+	}
+}
+
+func (this *EventStore) Stop() {
+	// nothing needs to be done.
+}
+
+// Returns the events involving the given object which happened between start and end, oldest first.
+// Namespace should be empty for objects that aren't namespaced, e.g. nodes.
+func (this *EventStore) GetObjectEvents(kind, namespace, name string, start, end time.Time) []*kube_api.Event {
+	this.RLock()
+	defer this.RUnlock()
+
+	result := []*kube_api.Event{}
+	for eventName := range this.objects[objectKey(kind, namespace, name)] {
+		event := this.events[eventName]
+		// An event covers the time between its first and last occurrence.
+		if !EventStartTime(event).After(end) && !EventTime(event).Before(start) {
+			result = append(result, event)
+		}
+	}
+	sort.Sort(byEventTime(result))
+	return result
+}
+
+// Returns all the events which happened between start and end, oldest first.
+func (this *EventStore) GetEvents(start, end time.Time) []*kube_api.Event {
+	this.RLock()
+	defer this.RUnlock()
+
+	result := []*kube_api.Event{}
+	for _, event := range this.events {
+		if !EventStartTime(event).After(end) && !EventTime(event).Before(start) {
+			result = append(result, event)
+		}
+	}
+	sort.Sort(byEventTime(result))
+	return result
+}
+
+// Returns the event with the given namespace and name, or nil if it isn't stored.
+func (this *EventStore) GetEvent(namespace, name string) *kube_api.Event {
+	this.RLock()
+	defer this.RUnlock()
+	return this.events[eventKey(namespace, name)]
+}
+
+// Returns the time of the last occurrence of the event.
+func EventTime(event *kube_api.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.FirstTimestamp.IsZero() {
+		return event.FirstTimestamp.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// Returns the time of the first occurrence of the event.
+func EventStartTime(event *kube_api.Event) time.Time {
+	if !event.FirstTimestamp.IsZero() {
+		return event.FirstTimestamp.Time
+	}
+	return EventTime(event)
+}
+
+func eventKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func objectKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+type byEventTime []*kube_api.Event
+
+func (a byEventTime) Len() int           { return len(a) }
+func (a byEventTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byEventTime) Less(i, j int) bool { return EventTime(a[i]).Before(EventTime(a[j])) }
@@ -0,0 +1,93 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/events/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	kube_api_unversioned "k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+func newEvent(name, kind, object string, first, last time.Time) *kube_api.Event {
+	event := &kube_api.Event{
+		Reason:         "Test",
+		FirstTimestamp: kube_api_unversioned.NewTime(first),
+		LastTimestamp:  kube_api_unversioned.NewTime(last),
+	}
+	event.Namespace = "default"
+	event.Name = name
+	event.InvolvedObject.Kind = kind
+	event.InvolvedObject.Name = object
+	if kind == "Pod" {
+		event.InvolvedObject.Namespace = "default"
+	}
+	return event
+}
+
+func TestEventStore(t *testing.T) {
+	now := time.Now()
+	store := NewEventStore(time.Hour)
+	store.ExportEvents(&core.EventBatch{
+		Timestamp: now,
+		Events: []*kube_api.Event{
+			newEvent("e1", "Pod", "pod1", now.Add(-30*time.Minute), now.Add(-20*time.Minute)),
+			newEvent("e2", "Pod", "pod1", now.Add(-10*time.Minute), now.Add(-10*time.Minute)),
+			newEvent("e3", "Pod", "pod2", now.Add(-10*time.Minute), now.Add(-10*time.Minute)),
+			newEvent("e4", "Node", "node1", now.Add(-5*time.Minute), now.Add(-5*time.Minute)),
+		},
+	})
+
+	events := store.GetObjectEvents("Pod", "default", "pod1", time.Time{}, now)
+	require.Len(t, events, 2)
+	assert.Equal(t, "e1", events[0].Name)
+	assert.Equal(t, "e2", events[1].Name)
+
+	// e1 spans the start of the range.
+	events = store.GetObjectEvents("Pod", "default", "pod1", now.Add(-25*time.Minute), now.Add(-15*time.Minute))
+	require.Len(t, events, 1)
+	assert.Equal(t, "e1", events[0].Name)
+
+	assert.Len(t, store.GetObjectEvents("Node", "", "node1", time.Time{}, now), 1)
+	assert.Empty(t, store.GetObjectEvents("Pod", "default", "pod3", time.Time{}, now))
+	assert.Equal(t, "pod2", store.GetEvent("default", "e3").InvolvedObject.Name)
+	assert.Nil(t, store.GetEvent("default", "e5"))
+
+	events = store.GetEvents(now.Add(-15*time.Minute), now)
+	require.Len(t, events, 3)
+	assert.Equal(t, "e4", events[2].Name)
+	assert.Len(t, store.GetEvents(time.Time{}, now), 4)
+
+	// An updated event replaces the stored version, old events expire.
+	store.ExportEvents(&core.EventBatch{
+		Timestamp: now.Add(45 * time.Minute),
+		Events: []*kube_api.Event{
+			newEvent("e2", "Pod", "pod1", now.Add(-10*time.Minute), now.Add(40*time.Minute)),
+		},
+	})
+	events = store.GetObjectEvents("Pod", "default", "pod1", time.Time{}, now.Add(time.Hour))
+	require.Len(t, events, 1)
+	assert.Equal(t, now.Add(40*time.Minute).Unix(), events[0].LastTimestamp.Unix())
+	assert.Nil(t, store.GetEvent("default", "e1"))
+	assert.Len(t, store.GetObjectEvents("Node", "", "node1", time.Time{}, now.Add(time.Hour)), 1)
+
+	store.ExportEvents(&core.EventBatch{Timestamp: now.Add(2 * time.Hour)})
+	assert.Empty(t, store.events)
+	assert.Empty(t, store.objects)
+}
@@ -0,0 +1,190 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+// AttributeExtractor derives additional sink attributes (tags) from events. Every attribute
+// is configured as <name>:<jsonpath>[:<regexp>], e.g. `exit_code:{.message}:exit code (\d+)`.
+// The JSONPath is evaluated against the JSON representation of the event and supports
+// fields (.a.b or ['a']) and array indexes ([0]). If a regexp is given, the attribute is set
+// to its first submatch (or to the whole match if it has no groups). Attributes which don't
+// resolve to a value are left out.
+type AttributeExtractor struct {
+	attributes []eventAttribute
+}
+
+type eventAttribute struct {
+	name   string
+	path   []interface{}
+	regexp *regexp.Regexp
+}
+
+// Creates an extractor from the given attribute specifications. Returns nil if there are none.
+func NewAttributeExtractor(specs []string) (*AttributeExtractor, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	extractor := &AttributeExtractor{}
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid attribute %q, should be <name>:<jsonpath>[:<regexp>]", spec)
+		}
+		path, err := parseJSONPath(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute %q: %v", spec, err)
+		}
+		attribute := eventAttribute{name: parts[0], path: path}
+		if len(parts) == 3 {
+			attribute.regexp, err = regexp.Compile(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid attribute %q: %v", spec, err)
+			}
+		}
+		extractor.attributes = append(extractor.attributes, attribute)
+	}
+	return extractor, nil
+}
+
+// Returns the attributes of the event. Safe to call on a nil extractor.
+func (this *AttributeExtractor) Extract(event *kube_api.Event) map[string]string {
+	if this == nil {
+		return nil
+	}
+	raw, err := json.Marshal(event)
+	if err != nil {
+		glog.Warningf("Failed to marshal event %s/%s: %v", event.Namespace, event.Name, err)
+		return nil
+	}
+	var object interface{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		glog.Warningf("Failed to unmarshal event %s/%s: %v", event.Namespace, event.Name, err)
+		return nil
+	}
+
+	result := make(map[string]string, len(this.attributes))
+	for _, attribute := range this.attributes {
+		value, found := evaluateJSONPath(object, attribute.path)
+		if !found {
+			continue
+		}
+		if attribute.regexp != nil {
+			match := attribute.regexp.FindStringSubmatch(value)
+			if match == nil {
+				continue
+			}
+			value = match[0]
+			if len(match) > 1 {
+				value = match[1]
+			}
+		}
+		result[attribute.name] = value
+	}
+	return result
+}
+
+// Parses a JSONPath like `{.involvedObject.kind}`, `$.metadata['name']` or `.items[0]` into
+// a list of field names (strings) and array indexes (ints).
+func parseJSONPath(path string) ([]interface{}, error) {
+	text := strings.TrimSpace(path)
+	if strings.HasPrefix(text, "{") && strings.HasSuffix(text, "}") {
+		text = text[1 : len(text)-1]
+	}
+	text = strings.TrimPrefix(text, "$")
+
+	result := []interface{}{}
+	for len(text) > 0 {
+		switch text[0] {
+		case '.':
+			end := 1
+			for end < len(text) && text[end] != '.' && text[end] != '[' {
+				end++
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("empty field name in %q", path)
+			}
+			result = append(result, text[1:end])
+			text = text[end:]
+		case '[':
+			end := strings.Index(text, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in %q", path)
+			}
+			inner := text[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				result = append(result, inner[1:len(inner)-1])
+			} else if index, err := strconv.Atoi(inner); err == nil && index >= 0 {
+				result = append(result, index)
+			} else {
+				return nil, fmt.Errorf("unsupported subscript [%s] in %q", inner, path)
+			}
+			text = text[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", text[0], path)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("empty path %q", path)
+	}
+	return result, nil
+}
+
+func evaluateJSONPath(object interface{}, path []interface{}) (string, bool) {
+	for _, step := range path {
+		switch step := step.(type) {
+		case string:
+			fields, ok := object.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if object, ok = fields[step]; !ok {
+				return "", false
+			}
+		case int:
+			items, ok := object.([]interface{})
+			if !ok || step >= len(items) {
+				return "", false
+			}
+			object = items[step]
+		}
+	}
+
+	switch value := object.(type) {
+	case nil:
+		return "", false
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(value), true
+	default:
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", false
+		}
+		return string(raw), true
+	}
+}
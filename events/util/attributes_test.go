@@ -0,0 +1,76 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+func TestAttributeExtractor(t *testing.T) {
+	event := &kube_api.Event{
+		Reason:  "BackOff",
+		Message: "container app terminated with exit code 137 (OOMKilled)",
+		Count:   3,
+	}
+	event.Namespace = "ns1"
+	event.Labels = map[string]string{"app.kubernetes.io/name": "web"}
+	event.InvolvedObject.Kind = "Pod"
+	event.InvolvedObject.FieldPath = "spec.containers{app}"
+
+	extractor, err := NewAttributeExtractor([]string{
+		"kind:{.involvedObject.kind}",
+		"count:$.count",
+		`exit_code:{.message}:exit code (\d+)`,
+		"oom:.message:OOM[A-Za-z]+",
+		"app:.metadata.labels['app.kubernetes.io/name']",
+		"missing:.involvedObject.uid",
+		"nomatch:.message:Evicted",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"kind":      "Pod",
+		"count":     "3",
+		"exit_code": "137",
+		"oom":       "OOMKilled",
+		"app":       "web",
+	}, extractor.Extract(event))
+
+	var none *AttributeExtractor
+	assert.Nil(t, none.Extract(event))
+	none, err = NewAttributeExtractor(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, none)
+}
+
+func TestParseJSONPath(t *testing.T) {
+	path, err := parseJSONPath(`{.items[2]["name"].value}`)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"items", 2, "name", "value"}, path)
+
+	for _, invalid := range []string{"", "{}", "items", ".a..b", ".a[", ".a[-1]", ".a[x]"} {
+		_, err := parseJSONPath(invalid)
+		assert.Error(t, err, "for %q", invalid)
+	}
+
+	for _, invalid := range []string{"kind", ":.reason", "kind:reason", "code:.message:("} {
+		_, err := NewAttributeExtractor([]string{invalid})
+		assert.Error(t, err, "for %q", invalid)
+	}
+}
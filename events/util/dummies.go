@@ -25,6 +25,7 @@ type DummySink struct {
 	name        string
 	mutex       sync.Mutex
 	exportCount int
+	eventCount  int
 	stopped     bool
 	latency     time.Duration
 }
@@ -32,9 +33,10 @@ type DummySink struct {
 func (this *DummySink) Name() string {
 	return this.name
 }
-func (this *DummySink) ExportEvents(*core.EventBatch) {
+func (this *DummySink) ExportEvents(batch *core.EventBatch) {
 	this.mutex.Lock()
 	this.exportCount++
+	this.eventCount += len(batch.Events)
 	this.mutex.Unlock()
 
 	time.Sleep(this.latency)
@@ -60,6 +62,12 @@ func (this *DummySink) GetExportCount() int {
 	return this.exportCount
 }
 
+func (this *DummySink) GetEventCount() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.eventCount
+}
+
 func NewDummySink(name string, latency time.Duration) *DummySink {
 	return &DummySink{
 		name:        name,
@@ -0,0 +1,45 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+// EventTemplate renders names, like topics or subjects, from the fields of an event,
+// e.g. "events.{{.Namespace}}.{{.Reason}}".
+type EventTemplate struct {
+	template *template.Template
+}
+
+func NewEventTemplate(text string) (*EventTemplate, error) {
+	tmpl, err := template.New("event").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event template %q: %v", text, err)
+	}
+	return &EventTemplate{template: tmpl}, nil
+}
+
+func (this *EventTemplate) Execute(event *kube_api.Event) (string, error) {
+	var buffer bytes.Buffer
+	if err := this.template.Execute(&buffer, event); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
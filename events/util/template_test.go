@@ -0,0 +1,42 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+func TestEventTemplate(t *testing.T) {
+	event := &kube_api.Event{Reason: "BackOff"}
+	event.Namespace = "kube-system"
+	event.InvolvedObject.Kind = "Pod"
+
+	tmpl, err := NewEventTemplate("events.{{.Namespace}}.{{.InvolvedObject.Kind}}.{{.Reason}}")
+	assert.NoError(t, err)
+	result, err := tmpl.Execute(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "events.kube-system.Pod.BackOff", result)
+
+	tmpl, err = NewEventTemplate("{{.NoSuchField}}")
+	assert.NoError(t, err)
+	_, err = tmpl.Execute(event)
+	assert.Error(t, err)
+
+	_, err = NewEventTemplate("{{.Namespace")
+	assert.Error(t, err)
+}
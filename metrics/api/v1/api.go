@@ -19,21 +19,28 @@ import (
 
 	restful "github.com/emicklei/go-restful"
 
+	eventstore "k8s.io/heapster/events/store"
 	"k8s.io/heapster/metrics/api/v1/types"
 	"k8s.io/heapster/metrics/core"
 	metricsink "k8s.io/heapster/metrics/sinks/metric"
+	"k8s.io/heapster/metrics/util"
 )
 
 type Api struct {
 	runningInKubernetes bool
 	metricSink          *metricsink.MetricSink
 	historicalSource    core.HistoricalSource
+	eventStore          *eventstore.EventStore
 	gkeMetrics          map[string]core.MetricDescriptor
 	gkeLabels           map[string]core.LabelDescriptor
+
+	// Coalesces identical concurrent model API queries.
+	modelRequests util.SingleFlightGroup
 }
 
-// Create a new Api to serve from the specified cache.
-func NewApi(runningInKubernetes bool, metricSink *metricsink.MetricSink, historicalSource core.HistoricalSource) *Api {
+// Create a new Api to serve from the specified cache. The event store is optional, it enables
+// the endpoints joining events and metrics.
+func NewApi(runningInKubernetes bool, metricSink *metricsink.MetricSink, historicalSource core.HistoricalSource, eventStore *eventstore.EventStore) *Api {
 	gkeMetrics := make(map[string]core.MetricDescriptor)
 	gkeLabels := make(map[string]core.LabelDescriptor)
 	for _, val := range core.StandardMetrics {
@@ -59,6 +66,7 @@ func NewApi(runningInKubernetes bool, metricSink *metricsink.MetricSink, histori
 		runningInKubernetes: runningInKubernetes,
 		metricSink:          metricSink,
 		historicalSource:    historicalSource,
+		eventStore:          eventStore,
 		gkeMetrics:          gkeMetrics,
 		gkeLabels:           gkeLabels,
 	}
@@ -93,6 +101,7 @@ func (a *Api) Register(container *restful.Container) {
 
 	if a.historicalSource != nil {
 		a.RegisterHistorical(container)
+		a.RegisterReports(container)
 	}
 }
 
@@ -182,9 +191,13 @@ func (a *Api) exportMetricsSchema(_ *restful.Request, response *restful.Response
 	response.WriteEntity(result)
 }
 
-func (a *Api) exportMetrics(_ *restful.Request, response *restful.Response) {
+func (a *Api) exportMetrics(request *restful.Request, response *restful.Response) {
 	response.PrettyPrint(false)
-	response.WriteEntity(a.processMetricsRequest(a.metricSink.GetShortStore()))
+	timeseries := a.processMetricsRequest(a.metricSink.GetShortStore())
+	if redaction := requestRedaction(request); redaction != nil {
+		redaction.redactTimeseries(timeseries)
+	}
+	response.WriteEntity(timeseries)
 }
 
 func (a *Api) processMetricsRequest(shortStorage []*core.DataBatch) []*types.Timeseries {
@@ -627,9 +627,19 @@ func (a *HistoricalApi) processMetricRequest(key core.HistoricalKey, request *re
 		response.WriteError(http.StatusBadRequest, err)
 		return
 	}
+	pageOpts, err := getMetricPageOptions(request)
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
 	metricName := request.PathParameter("metric-name")
 	convertedMetricName := convertMetricName(metricName)
 
+	if pageOpts != nil {
+		a.processPagedMetricRequest(key, convertedMetricName, labels, start, end, pageOpts, response)
+		return
+	}
+
 	var metrics map[core.HistoricalKey][]core.TimestampedMetricValue
 	if labels != nil {
 		metrics, err = a.historicalSource.GetLabeledMetric(convertedMetricName, labels, []core.HistoricalKey{key}, start, end)
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -53,6 +54,9 @@ type fakeHistoricalSource struct {
 	metricRequests      []metricReq
 	aggregationRequests []metricReq
 
+	// points, when set, are returned (filtered by time range) instead of a single fixed point.
+	points []core.TimestampedMetricValue
+
 	nowTime time.Time
 }
 
@@ -75,6 +79,17 @@ func (src *fakeHistoricalSource) GetLabeledMetric(metricName string, labels map[
 
 	res := make(map[core.HistoricalKey][]core.TimestampedMetricValue, len(metricKeys))
 
+	if src.points != nil {
+		for _, key := range metricKeys {
+			for _, point := range src.points {
+				if !point.Timestamp.Before(start) && !point.Timestamp.After(end) {
+					res[key] = append(res[key], point)
+				}
+			}
+		}
+		return res, nil
+	}
+
 	for _, key := range metricKeys {
 		res[key] = []core.TimestampedMetricValue{
 			{
@@ -838,6 +853,129 @@ func TestFetchMetrics(t *testing.T) {
 	}
 }
 
+func TestFetchPagedMetrics(t *testing.T) {
+	api, src := prepApi()
+	nowTime := time.Now().UTC().Truncate(time.Second)
+	nowFunc = func() time.Time { return nowTime }
+
+	// one point every 10 minutes over the last 2 hours, in reverse order
+	start := nowTime.Add(-2 * time.Hour)
+	for ts := nowTime; !ts.Before(start); ts = ts.Add(-10 * time.Minute) {
+		src.points = append(src.points, core.TimestampedMetricValue{
+			Timestamp: ts,
+			MetricValue: core.MetricValue{
+				ValueType: core.ValueInt64,
+				IntValue:  ts.Unix(),
+			},
+		})
+	}
+
+	fetch := func(params map[string]string) *fakeRespRecorder {
+		queryParams := make(url.Values)
+		queryParams.Add("start", start.Format(time.RFC3339))
+		for k, v := range params {
+			queryParams.Add(k, v)
+		}
+		req := restful.NewRequest(&http.Request{URL: &url.URL{RawQuery: queryParams.Encode()}})
+		req.PathParameters()["metric-name"] = "some-metric"
+		recorder := &fakeRespRecorder{
+			data:    new(bytes.Buffer),
+			headers: make(http.Header),
+		}
+		api.clusterMetrics(req, restful.NewResponse(recorder))
+		return recorder
+	}
+
+	// page through the results in 30 minute chunks
+	var timestamps []time.Time
+	token := ""
+	for pages := 0; ; pages++ {
+		require.True(t, pages < 10, "too many pages")
+		src.metricRequests = nil
+		recorder := fetch(map[string]string{"limit": "5", "chunk": "30m", "continue": token})
+		require.Equal(t, http.StatusOK, recorder.status)
+		for _, req := range src.metricRequests {
+			assert.True(t, req.end.Sub(req.start) <= 30*time.Minute, "window %v - %v is too long", req.start, req.end)
+		}
+
+		result := types.MetricResult{}
+		require.NoError(t, json.Unmarshal(recorder.data.Bytes(), &result))
+		assert.True(t, len(result.Metrics) <= 5)
+		for _, point := range result.Metrics {
+			timestamps = append(timestamps, point.Timestamp)
+			assert.Equal(t, uint64(point.Timestamp.Unix()), point.Value)
+		}
+		if result.Continue == "" {
+			break
+		}
+		token = result.Continue
+	}
+	require.Len(t, timestamps, 13)
+	for i, ts := range timestamps {
+		assert.True(t, ts.Equal(start.Add(time.Duration(i)*10*time.Minute)), "unexpected timestamp %v at %d", ts, i)
+	}
+
+	// stream everything as NDJSON
+	recorder := fetch(map[string]string{"format": "ndjson", "chunk": "1h"})
+	require.Equal(t, http.StatusOK, recorder.status)
+	assert.Equal(t, "application/x-ndjson", recorder.headers.Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(recorder.data.String()), "\n")
+	require.Len(t, lines, 13)
+	point := types.MetricPoint{}
+	require.NoError(t, json.Unmarshal([]byte(lines[12]), &point))
+	assert.True(t, point.Timestamp.Equal(nowTime))
+
+	// a streamed page ends with a continuation line
+	recorder = fetch(map[string]string{"format": "ndjson", "limit": "3"})
+	lines = strings.Split(strings.TrimSpace(recorder.data.String()), "\n")
+	require.Len(t, lines, 4)
+	continuation := types.MetricContinuation{}
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &continuation))
+	after, skip, err := decodeContinueToken(continuation.Continue)
+	require.NoError(t, err)
+	assert.True(t, after.Equal(start.Add(20*time.Minute)))
+	assert.Equal(t, 1, skip)
+
+	// pages cut between points sharing a timestamp neither drop nor repeat any of them
+	src.points = nil
+	for i := 0; i < 5; i++ {
+		src.points = append(src.points, core.TimestampedMetricValue{
+			Timestamp: nowTime.Add(-time.Hour),
+			MetricValue: core.MetricValue{
+				ValueType: core.ValueInt64,
+				IntValue:  int64(i),
+			},
+		})
+	}
+	var values []uint64
+	token = ""
+	for pages := 0; ; pages++ {
+		require.True(t, pages < 10, "too many pages")
+		recorder := fetch(map[string]string{"limit": "2", "continue": token})
+		require.Equal(t, http.StatusOK, recorder.status)
+		result := types.MetricResult{}
+		require.NoError(t, json.Unmarshal(recorder.data.Bytes(), &result))
+		for _, point := range result.Metrics {
+			values = append(values, point.Value)
+		}
+		if result.Continue == "" {
+			break
+		}
+		token = result.Continue
+	}
+	assert.Equal(t, []uint64{0, 1, 2, 3, 4}, values)
+
+	for _, params := range []map[string]string{
+		{"limit": "0"},
+		{"limit": "abc"},
+		{"continue": "not-a-token"},
+		{"format": "xml"},
+		{"chunk": "-1h"},
+	} {
+		assert.Equal(t, http.StatusBadRequest, fetch(params).status, "for params %v", params)
+	}
+}
+
 func TestFetchAggregations(t *testing.T) {
 	api, src := prepApi()
 	nowTime := time.Now().UTC().Truncate(time.Second)
@@ -0,0 +1,339 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/golang/glog"
+
+	"k8s.io/heapster/metrics/api/v1/types"
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	// defaultHistoricalChunk is the length of the time windows in which paged and streamed
+	// historical queries are fetched from the sink.
+	defaultHistoricalChunk = 6 * time.Hour
+
+	ndjsonFormat      = "ndjson"
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// metricPageOptions holds the paging and streaming parameters of a historical metric request.
+type metricPageOptions struct {
+	// limit is the maximum number of points returned, or zero for no limit.
+	limit int
+	// after is the timestamp of the last point returned in the previous page.
+	after time.Time
+	// skip is the number of points at after returned in the previous pages.
+	skip int
+	// ndjson requests the points to be streamed as newline delimited JSON.
+	ndjson bool
+	// chunk is the length of the time windows the sink is queried in.
+	chunk time.Duration
+}
+
+// getMetricPageOptions parses the `limit`, `continue`, `format` and `chunk` query parameters.
+// It returns nil if neither paging nor streaming was requested.
+func getMetricPageOptions(request *restful.Request) (*metricPageOptions, error) {
+	rawLimit := request.QueryParameter("limit")
+	rawContinue := request.QueryParameter("continue")
+	format := request.QueryParameter("format")
+	rawChunk := request.QueryParameter("chunk")
+
+	if rawLimit == "" && rawContinue == "" && format == "" && rawChunk == "" {
+		return nil, nil
+	}
+
+	opts := &metricPageOptions{
+		chunk: defaultHistoricalChunk,
+	}
+	if rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("limit must be a positive integer, got %q", rawLimit)
+		}
+		opts.limit = limit
+	}
+	if rawContinue != "" {
+		after, skip, err := decodeContinueToken(rawContinue)
+		if err != nil {
+			return nil, err
+		}
+		opts.after, opts.skip = after, skip
+	}
+	switch format {
+	case "", "json":
+	case ndjsonFormat:
+		opts.ndjson = true
+	default:
+		return nil, fmt.Errorf("unknown format %q, should be one of json, ndjson", format)
+	}
+	if rawChunk != "" {
+		chunk, err := time.ParseDuration(rawChunk)
+		if err != nil || chunk <= 0 {
+			return nil, fmt.Errorf("chunk must be a positive duration, got %q", rawChunk)
+		}
+		opts.chunk = chunk
+	}
+	return opts, nil
+}
+
+// A continue token holds the timestamp of the last point returned and the number of points
+// returned at that timestamp, as several points may share it.
+func encodeContinueToken(after time.Time, skip int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s,%d", after.UTC().Format(time.RFC3339Nano), skip)))
+}
+
+func decodeContinueToken(token string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("malformed continue token %q", token)
+	}
+	parts := strings.Split(string(raw), ",")
+	if len(parts) != 2 {
+		return time.Time{}, 0, fmt.Errorf("malformed continue token %q", token)
+	}
+	after, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("malformed continue token %q", token)
+	}
+	skip, err := strconv.Atoi(parts[1])
+	if err != nil || skip < 0 {
+		return time.Time{}, 0, fmt.Errorf("malformed continue token %q", token)
+	}
+	return after, skip, nil
+}
+
+type timestampedMetricValues []core.TimestampedMetricValue
+
+func (v timestampedMetricValues) Len() int           { return len(v) }
+func (v timestampedMetricValues) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v timestampedMetricValues) Less(i, j int) bool { return v[i].Timestamp.Before(v[j].Timestamp) }
+
+// metricPointWriter receives the points of a paged metric request in timestamp order.
+type metricPointWriter interface {
+	write(point types.MetricPoint) error
+	// flush is called after every chunk fetched from the sink.
+	flush()
+	// finish is called once all points have been written. continueToken is empty
+	// if the result is complete.
+	finish(continueToken string) error
+	// started reports whether anything was sent to the client yet.
+	started() bool
+}
+
+// processPagedMetricRequest fetches the metric for the object at the given key in time windows of
+// opts.chunk and streams the points to the client, so that only a single window is kept in
+// memory at any time.
+func (a *HistoricalApi) processPagedMetricRequest(key core.HistoricalKey, metricName string, labels map[string]string, start, end time.Time, opts *metricPageOptions, response *restful.Response) {
+	var writer metricPointWriter
+	if opts.ndjson {
+		writer = &ndjsonMetricPointWriter{response: response}
+	} else {
+		writer = &jsonMetricPointWriter{response: response}
+	}
+
+	if opts.after.After(start) {
+		start = opts.after
+	}
+	// The last point written and the number of points written at its timestamp.
+	last, lastCount := opts.after, opts.skip
+	skip := opts.skip
+
+	count := 0
+	continueToken := ""
+	for windowStart := start; continueToken == "" && windowStart.Before(end); {
+		windowEnd := windowStart.Add(opts.chunk)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+
+		var metrics map[core.HistoricalKey][]core.TimestampedMetricValue
+		var err error
+		if labels != nil {
+			metrics, err = a.historicalSource.GetLabeledMetric(metricName, labels, []core.HistoricalKey{key}, windowStart, windowEnd)
+		} else {
+			metrics, err = a.historicalSource.GetMetric(metricName, []core.HistoricalKey{key}, windowStart, windowEnd)
+		}
+		if err != nil {
+			if !writer.started() {
+				response.WriteError(http.StatusInternalServerError, err)
+			} else {
+				glog.Errorf("failed to fetch %s for %s between %v and %v: %v", metricName, key.String(), windowStart, windowEnd, err)
+			}
+			return
+		}
+
+		values := metrics[key]
+		sort.Stable(timestampedMetricValues(values))
+		for _, value := range values {
+			// Windows are inclusive on both ends, the points at the start of all but the first
+			// window were returned with the previous one.
+			if !windowStart.Equal(start) && !value.Timestamp.After(windowStart) {
+				continue
+			}
+			// The previous pages ended with skip points at opts.after.
+			if skip > 0 && value.Timestamp.Equal(opts.after) {
+				skip--
+				continue
+			}
+			if opts.limit > 0 && count == opts.limit {
+				continueToken = encodeContinueToken(last, lastCount)
+				break
+			}
+			if err := writer.write(exportMetricPoint(value)); err != nil {
+				glog.Errorf("failed to write %s for %s: %v", metricName, key.String(), err)
+				return
+			}
+			if value.Timestamp.Equal(last) {
+				lastCount++
+			} else {
+				last, lastCount = value.Timestamp, 1
+			}
+			count++
+		}
+		writer.flush()
+		windowStart = windowEnd
+	}
+
+	if err := writer.finish(continueToken); err != nil {
+		glog.Errorf("failed to write %s for %s: %v", metricName, key.String(), err)
+	}
+}
+
+// jsonMetricPointWriter streams the points of a page as a single MetricResult, flushing the
+// response after each chunk.
+type jsonMetricPointWriter struct {
+	response        *restful.Response
+	written         bool
+	latestTimestamp time.Time
+}
+
+func (w *jsonMetricPointWriter) start() error {
+	if w.written {
+		return nil
+	}
+	w.written = true
+	w.response.AddHeader("Content-Type", restful.MIME_JSON)
+	w.response.WriteHeader(http.StatusOK)
+	_, err := io.WriteString(w.response, `{"metrics":[`)
+	return err
+}
+
+func (w *jsonMetricPointWriter) write(point types.MetricPoint) error {
+	separator := ","
+	if !w.written {
+		if err := w.start(); err != nil {
+			return err
+		}
+		separator = ""
+	}
+	if w.latestTimestamp.Before(point.Timestamp) {
+		w.latestTimestamp = point.Timestamp
+	}
+	encoded, err := json.Marshal(point)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w.response, separator+string(encoded))
+	return err
+}
+
+func (w *jsonMetricPointWriter) flush() {
+	if !w.written {
+		return
+	}
+	if flusher, ok := w.response.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *jsonMetricPointWriter) finish(continueToken string) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	latestTimestamp, err := json.Marshal(w.latestTimestamp)
+	if err != nil {
+		return err
+	}
+	tail := `],"latestTimestamp":` + string(latestTimestamp)
+	if continueToken != "" {
+		encoded, err := json.Marshal(continueToken)
+		if err != nil {
+			return err
+		}
+		tail += `,"continue":` + string(encoded)
+	}
+	_, err = io.WriteString(w.response, tail+"}")
+	return err
+}
+
+func (w *jsonMetricPointWriter) started() bool {
+	return w.written
+}
+
+// ndjsonMetricPointWriter streams every point as a separate line of JSON, flushing the
+// response after each chunk.  A result cut short by the page limit is terminated by a
+// MetricContinuation line.
+type ndjsonMetricPointWriter struct {
+	response *restful.Response
+	encoder  *json.Encoder
+}
+
+func (w *ndjsonMetricPointWriter) start() {
+	if w.encoder != nil {
+		return
+	}
+	w.response.AddHeader("Content-Type", ndjsonContentType)
+	w.response.WriteHeader(http.StatusOK)
+	w.encoder = json.NewEncoder(w.response)
+}
+
+func (w *ndjsonMetricPointWriter) write(point types.MetricPoint) error {
+	w.start()
+	return w.encoder.Encode(point)
+}
+
+func (w *ndjsonMetricPointWriter) flush() {
+	if w.encoder == nil {
+		return
+	}
+	if flusher, ok := w.response.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *ndjsonMetricPointWriter) finish(continueToken string) error {
+	w.start()
+	if continueToken == "" {
+		return nil
+	}
+	return w.encoder.Encode(types.MetricContinuation{Continue: continueToken})
+}
+
+func (w *ndjsonMetricPointWriter) started() bool {
+	return w.encoder != nil
+}
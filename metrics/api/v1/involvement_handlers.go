@@ -0,0 +1,197 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+
+	eventstore "k8s.io/heapster/events/store"
+	"k8s.io/heapster/metrics/api/v1/types"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util/metrics"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// Time before and after an event for which the metrics of the involved entity are returned.
+	defaultInvolvementWindow = 15 * time.Minute
+)
+
+var (
+	defaultInvolvementMetrics = []string{core.MetricCpuUsageRate.Name, core.MetricMemoryUsage.Name}
+)
+
+// addInvolvementRoutes adds the routes joining events and metrics of model entities.
+func (a *Api) addInvolvementRoutes(ws *restful.WebService) {
+	// The /nodes/{node-name}/involvement endpoint returns the events and metrics of a Node entity.
+	ws.Route(ws.GET("/nodes/{node-name}/involvement").
+		To(metrics.InstrumentRouteFunc("nodeInvolvement", a.nodeInvolvement)).
+		Doc("Get the events and metrics of a node").
+		Operation("nodeInvolvement").
+		Param(ws.PathParameter("node-name", "The name of the node to lookup").DataType("string")).
+		Param(ws.QueryParameter("start", "Start time for requested events and metrics").DataType("string")).
+		Param(ws.QueryParameter("end", "End time for requested events and metrics").DataType("string")).
+		Param(ws.QueryParameter("metrics", "A comma-separated list of requested metrics").DataType("string")).
+		Writes(types.Involvement{}))
+
+	if a.isRunningInKubernetes() {
+		// The /namespaces/{namespace-name}/pods/{pod-name}/involvement endpoint returns the events and metrics of a Pod entity.
+		ws.Route(ws.GET("/namespaces/{namespace-name}/pods/{pod-name}/involvement").
+			To(metrics.InstrumentRouteFunc("podInvolvement", a.podInvolvement)).
+			Doc("Get the events and metrics of a pod").
+			Operation("podInvolvement").
+			Param(ws.PathParameter("namespace-name", "The name of the namespace to lookup").DataType("string")).
+			Param(ws.PathParameter("pod-name", "The name of the pod to lookup").DataType("string")).
+			Param(ws.QueryParameter("start", "Start time for requested events and metrics").DataType("string")).
+			Param(ws.QueryParameter("end", "End time for requested events and metrics").DataType("string")).
+			Param(ws.QueryParameter("metrics", "A comma-separated list of requested metrics").DataType("string")).
+			Writes(types.Involvement{}))
+
+		// The /namespaces/{namespace-name}/events/{event-name}/involvement endpoint returns the events and metrics
+		// of the Pod or Node entity involved in an event, around the time of the event.
+		ws.Route(ws.GET("/namespaces/{namespace-name}/events/{event-name}/involvement").
+			To(metrics.InstrumentRouteFunc("eventInvolvement", a.eventInvolvement)).
+			Doc("Get the events and metrics of the pod or node involved in an event").
+			Operation("eventInvolvement").
+			Param(ws.PathParameter("namespace-name", "The namespace of the event").DataType("string")).
+			Param(ws.PathParameter("event-name", "The name of the event").DataType("string")).
+			Param(ws.QueryParameter("window", "Time before and after the event to return events and metrics for, 15m by default").DataType("string")).
+			Param(ws.QueryParameter("metrics", "A comma-separated list of requested metrics").DataType("string")).
+			Writes(types.Involvement{}))
+	}
+}
+
+// addEventRoutes adds the routes listing the recent events.
+func (a *Api) addEventRoutes(ws *restful.WebService) {
+	// The /events endpoint returns the events of all the entities.
+	ws.Route(ws.GET("/events").
+		To(metrics.InstrumentRouteFunc("events", a.events)).
+		Doc("Get the events of the cluster").
+		Operation("events").
+		Param(ws.QueryParameter("start", "Start time for requested events").DataType("string")).
+		Param(ws.QueryParameter("end", "End time for requested events").DataType("string")).
+		Writes([]types.Event{}))
+}
+
+func (a *Api) events(request *restful.Request, response *restful.Response) {
+	start, end, err := getStartEndTime(request)
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	result := []types.Event{}
+	for _, event := range a.eventStore.GetEvents(start, end) {
+		result = append(result, exportEvent(event))
+	}
+	response.WriteEntity(result)
+}
+
+func (a *Api) nodeInvolvement(request *restful.Request, response *restful.Response) {
+	start, end, err := getStartEndTime(request)
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	node := request.PathParameter("node-name")
+	response.WriteEntity(a.involvement("Node", "", node, core.NodeKey(node), start, end, getInvolvementMetrics(request)))
+}
+
+func (a *Api) podInvolvement(request *restful.Request, response *restful.Response) {
+	start, end, err := getStartEndTime(request)
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	namespace := request.PathParameter("namespace-name")
+	pod := request.PathParameter("pod-name")
+	response.WriteEntity(a.involvement("Pod", namespace, pod, core.PodKey(namespace, pod), start, end, getInvolvementMetrics(request)))
+}
+
+func (a *Api) eventInvolvement(request *restful.Request, response *restful.Response) {
+	window := defaultInvolvementWindow
+	if raw := request.QueryParameter("window"); raw != "" {
+		var err error
+		if window, err = time.ParseDuration(raw); err != nil {
+			response.WriteError(http.StatusBadRequest, fmt.Errorf("window argument cannot be parsed: %s", err))
+			return
+		}
+	}
+	namespace := request.PathParameter("namespace-name")
+	name := request.PathParameter("event-name")
+	event := a.eventStore.GetEvent(namespace, name)
+	if event == nil {
+		response.WriteError(http.StatusNotFound, fmt.Errorf("event %s/%s not found", namespace, name))
+		return
+	}
+
+	object := event.InvolvedObject
+	var key string
+	switch object.Kind {
+	case "Pod":
+		key = core.PodKey(object.Namespace, object.Name)
+	case "Node":
+		key = core.NodeKey(object.Name)
+	default:
+		response.WriteError(http.StatusNotFound, fmt.Errorf("event %s/%s involves a %s, not a pod or a node", namespace, name, object.Kind))
+		return
+	}
+	start := eventstore.EventStartTime(event).Add(-window)
+	end := eventstore.EventTime(event).Add(window)
+	response.WriteEntity(a.involvement(object.Kind, object.Namespace, object.Name, key, start, end, getInvolvementMetrics(request)))
+}
+
+func (a *Api) involvement(kind, namespace, name, key string, start, end time.Time, metricNames []string) types.Involvement {
+	result := types.Involvement{
+		Key:     key,
+		Start:   start,
+		End:     end,
+		Events:  []types.Event{},
+		Metrics: make(map[string]types.MetricResult, len(metricNames)),
+	}
+	for _, event := range a.eventStore.GetObjectEvents(kind, namespace, name, start, end) {
+		result.Events = append(result.Events, exportEvent(event))
+	}
+	for _, metricName := range metricNames {
+		values := a.metricSink.GetMetric(convertMetricName(metricName), []string{key}, start, end)
+		result.Metrics[metricName] = exportTimestampedMetricValue(values[key])
+	}
+	return result
+}
+
+func getInvolvementMetrics(request *restful.Request) []string {
+	raw := request.QueryParameter("metrics")
+	if raw == "" {
+		return defaultInvolvementMetrics
+	}
+	return strings.Split(raw, ",")
+}
+
+func exportEvent(event *kube_api.Event) types.Event {
+	return types.Event{
+		Namespace:      event.Namespace,
+		Name:           event.Name,
+		Type:           event.Type,
+		Reason:         event.Reason,
+		Message:        event.Message,
+		Count:          event.Count,
+		FirstTimestamp: eventstore.EventStartTime(event),
+		LastTimestamp:  eventstore.EventTime(event),
+	}
+}
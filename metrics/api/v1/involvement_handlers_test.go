@@ -0,0 +1,144 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	eventcore "k8s.io/heapster/events/core"
+	eventstore "k8s.io/heapster/events/store"
+	"k8s.io/heapster/metrics/api/v1/types"
+	"k8s.io/heapster/metrics/core"
+	metricsink "k8s.io/heapster/metrics/sinks/metric"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	kube_api_unversioned "k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+func newInvolvedEvent(name, kind, namespace, object string, timestamp time.Time) *kube_api.Event {
+	event := &kube_api.Event{
+		Reason:         "OOMKilling",
+		Count:          1,
+		FirstTimestamp: kube_api_unversioned.NewTime(timestamp),
+		LastTimestamp:  kube_api_unversioned.NewTime(timestamp),
+	}
+	event.Namespace = "default"
+	event.Name = name
+	event.InvolvedObject.Kind = kind
+	event.InvolvedObject.Namespace = namespace
+	event.InvolvedObject.Name = object
+	return event
+}
+
+func TestInvolvement(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	metricSink := metricsink.NewMetricSink(time.Hour, time.Hour, []string{core.MetricMemoryUsage.Name})
+	for i := 3; i >= 0; i-- {
+		value := core.MetricValue{ValueType: core.ValueInt64, IntValue: int64(100 * (4 - i))}
+		metricSink.ExportData(&core.DataBatch{
+			Timestamp: now.Add(-time.Duration(i) * 10 * time.Minute),
+			MetricSets: map[string]*core.MetricSet{
+				core.PodKey("default", "pod1"): {
+					Labels:       map[string]string{core.LabelMetricSetType.Key: core.MetricSetTypePod},
+					MetricValues: map[string]core.MetricValue{core.MetricMemoryUsage.Name: value},
+				},
+				core.NodeKey("node1"): {
+					Labels:       map[string]string{core.LabelMetricSetType.Key: core.MetricSetTypeNode},
+					MetricValues: map[string]core.MetricValue{core.MetricMemoryUsage.Name: value},
+				},
+			},
+		})
+	}
+
+	store := eventstore.NewEventStore(time.Hour)
+	store.ExportEvents(&eventcore.EventBatch{
+		Timestamp: now,
+		Events: []*kube_api.Event{
+			newInvolvedEvent("e1", "Pod", "default", "pod1", now.Add(-25*time.Minute)),
+			newInvolvedEvent("e2", "Pod", "default", "pod1", now.Add(-5*time.Minute)),
+			newInvolvedEvent("e3", "Node", "", "node1", now.Add(-5*time.Minute)),
+			newInvolvedEvent("e4", "ReplicaSet", "default", "rs1", now.Add(-5*time.Minute)),
+		},
+	})
+
+	container := restful.NewContainer()
+	container.Router(restful.CurlyRouter{})
+	NewApi(true, metricSink, nil, store).Register(container)
+	server := httptest.NewServer(container)
+	defer server.Close()
+
+	get := func(path string, expectedStatus int) types.Involvement {
+		resp, err := http.Get(server.URL + "/api/v1/model" + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, expectedStatus, resp.StatusCode, path)
+		result := types.Involvement{}
+		if expectedStatus == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		}
+		return result
+	}
+
+	// Everything about the pod.
+	result := get("/namespaces/default/pods/pod1/involvement?metrics=memory/usage", http.StatusOK)
+	assert.Equal(t, core.PodKey("default", "pod1"), result.Key)
+	require.Len(t, result.Events, 2)
+	assert.Equal(t, "e1", result.Events[0].Name)
+	assert.Equal(t, "OOMKilling", result.Events[0].Reason)
+	assert.Len(t, result.Metrics[core.MetricMemoryUsage.Name].Metrics, 4)
+
+	// Only the second half hour, by default cpu/usage_rate is returned as well.
+	start := now.Add(-15 * time.Minute).Format(time.RFC3339)
+	result = get("/namespaces/default/pods/pod1/involvement?start="+start, http.StatusOK)
+	require.Len(t, result.Events, 1)
+	assert.Equal(t, "e2", result.Events[0].Name)
+	assert.Len(t, result.Metrics[core.MetricMemoryUsage.Name].Metrics, 2)
+	assert.Empty(t, result.Metrics[core.MetricCpuUsageRate.Name].Metrics)
+
+	result = get("/nodes/node1/involvement", http.StatusOK)
+	require.Len(t, result.Events, 1)
+	assert.Equal(t, "e3", result.Events[0].Name)
+
+	// Around an event: pod1 at -25m +/- 10m.
+	result = get("/namespaces/default/events/e1/involvement?window=10m", http.StatusOK)
+	assert.Equal(t, core.PodKey("default", "pod1"), result.Key)
+	assert.Equal(t, now.Add(-35*time.Minute).Unix(), result.Start.Unix())
+	require.Len(t, result.Events, 1)
+	assert.Equal(t, "e1", result.Events[0].Name)
+	points := result.Metrics[core.MetricMemoryUsage.Name].Metrics
+	require.Len(t, points, 2)
+	assert.Equal(t, uint64(100), points[0].Value)
+	assert.Equal(t, uint64(200), points[1].Value)
+
+	resp, err := http.Get(server.URL + "/api/v1/model/events?start=" + start)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	events := []types.Event{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&events))
+	// All events since the start, whatever entity they involve.
+	assert.Len(t, events, 3)
+
+	get("/namespaces/default/events/e4/involvement", http.StatusNotFound)
+	get("/namespaces/default/events/e5/involvement", http.StatusNotFound)
+	get("/namespaces/default/events/e1/involvement?window=x", http.StatusBadRequest)
+}
@@ -92,13 +92,16 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 		Param(ws.QueryParameter("start", "Start time for requested metric").DataType("string")).
 		Param(ws.QueryParameter("end", "End time for requested metric").DataType("string")).
 		Param(ws.QueryParameter("labels", "A comma-separated list of key:values pairs to use to search for a labeled metric").DataType("string")).
+		Param(ws.QueryParameter("compare", "An offset, e.g. 24h, of an earlier window to return alongside the requested one").DataType("string")).
+		Param(ws.QueryParameter("cluster", "The federated cluster of the entity, the primary one if empty").DataType("string")).
 		Writes(types.MetricResult{}))
 
 	// The /nodes/{node-name}/metrics endpoint returns a list of all nodes with some metrics.
 	ws.Route(ws.GET("/nodes/").
 		To(metrics.InstrumentRouteFunc("nodeList", a.nodeList)).
 		Doc("Get a list of all nodes that have some current metrics").
-		Operation("nodeList"))
+		Operation("nodeList").
+		Param(ws.QueryParameter("cluster", "The federated cluster of the nodes, the primary one if empty").DataType("string")))
 
 	// The /nodes/{node-name}/metrics endpoint returns a list of all available metrics for a Node entity.
 	ws.Route(ws.GET("/nodes/{node-name}/metrics/").
@@ -118,6 +121,8 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 		Param(ws.QueryParameter("start", "Start time for requested metric").DataType("string")).
 		Param(ws.QueryParameter("end", "End time for requested metric").DataType("string")).
 		Param(ws.QueryParameter("labels", "A comma-separated list of key:values pairs to use to search for a labeled metric").DataType("string")).
+		Param(ws.QueryParameter("compare", "An offset, e.g. 24h, of an earlier window to return alongside the requested one").DataType("string")).
+		Param(ws.QueryParameter("cluster", "The federated cluster of the entity, the primary one if empty").DataType("string")).
 		Writes(types.MetricResult{}))
 
 	if a.isRunningInKubernetes() {
@@ -125,7 +130,8 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 		ws.Route(ws.GET("/namespaces/").
 			To(metrics.InstrumentRouteFunc("namespaceList", a.namespaceList)).
 			Doc("Get a list of all namespaces that have some current metrics").
-			Operation("namespaceList"))
+			Operation("namespaceList").
+			Param(ws.QueryParameter("cluster", "The federated cluster of the namespaces, the primary one if empty").DataType("string")))
 
 		// The /namespaces/{namespace-name}/metrics endpoint returns a list of all available metrics for a Namespace entity.
 		ws.Route(ws.GET("/namespaces/{namespace-name}/metrics").
@@ -145,13 +151,16 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 			Param(ws.QueryParameter("start", "Start time for requested metrics").DataType("string")).
 			Param(ws.QueryParameter("end", "End time for requested metric").DataType("string")).
 			Param(ws.QueryParameter("labels", "A comma-separated list of key:values pairs to use to search for a labeled metric").DataType("string")).
+			Param(ws.QueryParameter("compare", "An offset, e.g. 24h, of an earlier window to return alongside the requested one").DataType("string")).
+			Param(ws.QueryParameter("cluster", "The federated cluster of the entity, the primary one if empty").DataType("string")).
 			Writes(types.MetricResult{}))
 
 		ws.Route(ws.GET("/namespaces/{namespace-name}/pods/").
 			To(metrics.InstrumentRouteFunc("namespacePodList", a.namespacePodList)).
 			Doc("Get a list of pods from the given namespace that have some metrics").
 			Operation("namespacePodList").
-			Param(ws.PathParameter("namespace-name", "The name of the namespace to lookup").DataType("string")))
+			Param(ws.PathParameter("namespace-name", "The name of the namespace to lookup").DataType("string")).
+			Param(ws.QueryParameter("cluster", "The federated cluster of the namespace, the primary one if empty").DataType("string")))
 
 		// The /namespaces/{namespace-name}/pods/{pod-name}/metrics endpoint returns a list of all available metrics for a Pod entity.
 		ws.Route(ws.GET("/namespaces/{namespace-name}/pods/{pod-name}/metrics").
@@ -173,6 +182,8 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 			Param(ws.QueryParameter("start", "Start time for requested metrics").DataType("string")).
 			Param(ws.QueryParameter("end", "End time for requested metric").DataType("string")).
 			Param(ws.QueryParameter("labels", "A comma-separated list of key:values pairs to use to search for a labeled metric").DataType("string")).
+			Param(ws.QueryParameter("compare", "An offset, e.g. 24h, of an earlier window to return alongside the requested one").DataType("string")).
+			Param(ws.QueryParameter("cluster", "The federated cluster of the entity, the primary one if empty").DataType("string")).
 			Writes(types.MetricResult{}))
 
 		// The /namespaces/{namespace-name}/pods/{pod-name}/containers endpoint
@@ -182,7 +193,8 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 			Doc("Get a list of containers for a Pod entity ").
 			Operation("podContainerList").
 			Param(ws.PathParameter("namespace-name", "The name of the namespace to lookup").DataType("string")).
-			Param(ws.PathParameter("pod-name", "The name of the pod to lookup").DataType("string")))
+			Param(ws.PathParameter("pod-name", "The name of the pod to lookup").DataType("string")).
+			Param(ws.QueryParameter("cluster", "The federated cluster of the pod, the primary one if empty").DataType("string")))
 
 		// The /namespaces/{namespace-name}/pods/{pod-name}/containers/metrics/{container-name}/metrics endpoint
 		// returns a list of all available metrics for a Pod Container entity.
@@ -207,6 +219,8 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 			Param(ws.QueryParameter("start", "Start time for requested metrics").DataType("string")).
 			Param(ws.QueryParameter("end", "End time for requested metric").DataType("string")).
 			Param(ws.QueryParameter("labels", "A comma-separated list of key:values pairs to use to search for a labeled metric").DataType("string")).
+			Param(ws.QueryParameter("compare", "An offset, e.g. 24h, of an earlier window to return alongside the requested one").DataType("string")).
+			Param(ws.QueryParameter("cluster", "The federated cluster of the entity, the primary one if empty").DataType("string")).
 			Writes(types.MetricResult{}))
 	}
 
@@ -214,7 +228,8 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 		To(metrics.InstrumentRouteFunc("systemContainerList", a.nodeSystemContainerList)).
 		Doc("Get a list of all non-pod containers with some metrics").
 		Operation("systemContainerList").
-		Param(ws.PathParameter("node-name", "The name of the namespace to lookup").DataType("string")))
+		Param(ws.PathParameter("node-name", "The name of the namespace to lookup").DataType("string")).
+		Param(ws.QueryParameter("cluster", "The federated cluster of the node, the primary one if empty").DataType("string")))
 
 	// The /nodes/{node-name}/freecontainers/{container-name}/metrics endpoint
 	// returns a list of all available metrics for a Free Container entity.
@@ -237,6 +252,8 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 		Param(ws.QueryParameter("start", "Start time for requested metrics").DataType("string")).
 		Param(ws.QueryParameter("end", "End time for requested metric").DataType("string")).
 		Param(ws.QueryParameter("labels", "A comma-separated list of key:values pairs to use to search for a labeled metric").DataType("string")).
+		Param(ws.QueryParameter("compare", "An offset, e.g. 24h, of an earlier window to return alongside the requested one").DataType("string")).
+		Param(ws.QueryParameter("cluster", "The federated cluster of the entity, the primary one if empty").DataType("string")).
 		Writes(types.MetricResult{}))
 
 	if a.isRunningInKubernetes() {
@@ -252,6 +269,8 @@ func addClusterMetricsRoutes(a clusterMetricsFetcher, ws *restful.WebService) {
 			Param(ws.QueryParameter("start", "Start time for requested metrics").DataType("string")).
 			Param(ws.QueryParameter("end", "End time for requested metric").DataType("string")).
 			Param(ws.QueryParameter("labels", "A comma-separated list of key:values pairs to use to search for a labeled metric").DataType("string")).
+			Param(ws.QueryParameter("compare", "An offset, e.g. 24h, of an earlier window to return alongside the requested one").DataType("string")).
+			Param(ws.QueryParameter("cluster", "The federated cluster of the entity, the primary one if empty").DataType("string")).
 			Writes(types.MetricResult{}))
 	}
 }
@@ -271,6 +290,19 @@ func (a *Api) RegisterModel(container *restful.Container) {
 		Produces(restful.MIME_JSON)
 
 	addClusterMetricsRoutes(a, ws)
+	if a.isRunningInKubernetes() {
+		a.addQOSRoutes(ws)
+	}
+	if a.eventStore != nil {
+		a.addEventRoutes(ws)
+		a.addInvolvementRoutes(ws)
+	}
+
+	ws.Route(ws.GET("/completeness").
+		To(metrics.InstrumentRouteFunc("completeness", a.completeness)).
+		Doc("Get the share of the nodes and pods covered by the latest data batch").
+		Operation("completeness").
+		Writes(types.Completeness{}))
 
 	ws.Route(ws.GET("/debug/allkeys").
 		To(metrics.InstrumentRouteFunc("debugAllKeys", a.allKeys)).
@@ -281,29 +313,60 @@ func (a *Api) RegisterModel(container *restful.Container) {
 
 // availableMetrics returns a list of available cluster metric names.
 func (a *Api) availableClusterMetrics(request *restful.Request, response *restful.Response) {
-	a.processMetricNamesRequest(core.ClusterKey(), response)
+	a.processMetricNamesRequest(request, core.ClusterKey(), response)
 }
 
 // availableMetrics returns a list of available node metric names.
 func (a *Api) availableNodeMetrics(request *restful.Request, response *restful.Response) {
-	a.processMetricNamesRequest(core.NodeKey(request.PathParameter("node-name")), response)
+	a.processMetricNamesRequest(request, core.NodeKey(request.PathParameter("node-name")), response)
 }
 
 // availableMetrics returns a list of available namespace metric names.
 func (a *Api) availableNamespaceMetrics(request *restful.Request, response *restful.Response) {
-	a.processMetricNamesRequest(core.NamespaceKey(request.PathParameter("namespace-name")), response)
+	a.processMetricNamesRequest(request, core.NamespaceKey(request.PathParameter("namespace-name")), response)
+}
+
+// addQOSRoutes adds the routes of the metrics aggregated by QoS class, which are only
+// available in the model.
+func (a *Api) addQOSRoutes(ws *restful.WebService) {
+	// The /qos-classes/{qos-class}/metrics endpoint returns a list of all available metrics for a QoS class.
+	ws.Route(ws.GET("/qos-classes/{qos-class}/metrics").
+		To(metrics.InstrumentRouteFunc("availableQOSMetrics", a.availableQOSMetrics)).
+		Doc("Get a list of all available metrics for the pods of a QoS class").
+		Operation("availableQOSMetrics").
+		Param(ws.PathParameter("qos-class", "The QoS class: Guaranteed, Burstable or BestEffort").DataType("string")))
+
+	// The /qos-classes/{qos-class}/metrics/{metric-name} endpoint exposes a metric aggregated
+	// over the pods of a QoS class.
+	ws.Route(ws.GET("/qos-classes/{qos-class}/metrics/{metric-name:*}").
+		To(metrics.InstrumentRouteFunc("qosMetrics", a.qosMetrics)).
+		Doc("Export a metric aggregated over the pods of a QoS class").
+		Operation("qosMetrics").
+		Param(ws.PathParameter("qos-class", "The QoS class: Guaranteed, Burstable or BestEffort").DataType("string")).
+		Param(ws.PathParameter("metric-name", "The name of the requested metric").DataType("string")).
+		Param(ws.QueryParameter("start", "Start time for requested metrics").DataType("string")).
+		Param(ws.QueryParameter("end", "End time for requested metric").DataType("string")).
+		Param(ws.QueryParameter("labels", "A comma-separated list of key:values pairs to use to search for a labeled metric").DataType("string")).
+		Param(ws.QueryParameter("compare", "An offset, e.g. 24h, of an earlier window to return alongside the requested one").DataType("string")).
+		Param(ws.QueryParameter("cluster", "The federated cluster of the entity, the primary one if empty").DataType("string")).
+		Writes(types.MetricResult{}))
+}
+
+// availableQOSMetrics returns a list of available QoS class metric names.
+func (a *Api) availableQOSMetrics(request *restful.Request, response *restful.Response) {
+	a.processMetricNamesRequest(request, core.QOSKey(request.PathParameter("qos-class")), response)
 }
 
 // availableMetrics returns a list of available pod metric names.
 func (a *Api) availablePodMetrics(request *restful.Request, response *restful.Response) {
-	a.processMetricNamesRequest(
+	a.processMetricNamesRequest(request,
 		core.PodKey(request.PathParameter("namespace-name"),
 			request.PathParameter("pod-name")), response)
 }
 
 // availableMetrics returns a list of available pod metric names.
 func (a *Api) availablePodContainerMetrics(request *restful.Request, response *restful.Response) {
-	a.processMetricNamesRequest(
+	a.processMetricNamesRequest(request,
 		core.PodContainerKey(request.PathParameter("namespace-name"),
 			request.PathParameter("pod-name"),
 			request.PathParameter("container-name"),
@@ -312,36 +375,56 @@ func (a *Api) availablePodContainerMetrics(request *restful.Request, response *r
 
 // availableMetrics returns a list of available pod metric names.
 func (a *Api) availableFreeContainerMetrics(request *restful.Request, response *restful.Response) {
-	a.processMetricNamesRequest(
+	a.processMetricNamesRequest(request,
 		core.NodeContainerKey(request.PathParameter("node-name"),
 			request.PathParameter("container-name"),
 		), response)
 }
 
 func (a *Api) nodeList(request *restful.Request, response *restful.Response) {
-	response.WriteEntity(a.metricSink.GetNodes())
+	response.WriteEntity(a.metricSink.GetNodes(request.QueryParameter("cluster")))
 }
 
 func (a *Api) namespaceList(request *restful.Request, response *restful.Response) {
-	response.WriteEntity(a.metricSink.GetNamespaces())
+	response.WriteEntity(a.metricSink.GetNamespaces(request.QueryParameter("cluster")))
 }
 
 func (a *Api) namespacePodList(request *restful.Request, response *restful.Response) {
-	response.WriteEntity(a.metricSink.GetPodsFromNamespace(request.PathParameter("namespace-name")))
+	response.WriteEntity(a.metricSink.GetPodsFromNamespace(request.QueryParameter("cluster"), request.PathParameter("namespace-name")))
 }
 
 func (a *Api) podContainerList(request *restful.Request, response *restful.Response) {
-	response.WriteEntity(a.metricSink.GetContainersForPodFromNamespace(request.PathParameter("namespace-name"), request.PathParameter("pod-name")))
+	response.WriteEntity(a.metricSink.GetContainersForPodFromNamespace(request.QueryParameter("cluster"), request.PathParameter("namespace-name"), request.PathParameter("pod-name")))
 }
 
 func (a *Api) nodeSystemContainerList(request *restful.Request, response *restful.Response) {
-	response.WriteEntity(a.metricSink.GetSystemContainersFromNode(request.PathParameter("node-name")))
+	response.WriteEntity(a.metricSink.GetSystemContainersFromNode(request.QueryParameter("cluster"), request.PathParameter("node-name")))
 }
 
 func (a *Api) allKeys(request *restful.Request, response *restful.Response) {
 	response.WriteEntity(a.metricSink.GetMetricSetKeys())
 }
 
+// completeness returns the completeness of the latest data batch.
+func (a *Api) completeness(request *restful.Request, response *restful.Response) {
+	batch := a.metricSink.GetLatestDataBatch()
+	if batch == nil || batch.Completeness == nil {
+		response.WriteError(http.StatusNotFound, errors.New("no completeness available yet"))
+		return
+	}
+	c := batch.Completeness
+	response.WriteEntity(types.Completeness{
+		Timestamp:     batch.Timestamp,
+		NodesScraped:  c.NodesScraped,
+		NodesExpected: c.NodesExpected,
+		NodeRatio:     c.NodeRatio(),
+		PodsCovered:   c.PodsCovered,
+		PodsRunning:   c.PodsRunning,
+		PodRatio:      c.PodRatio(),
+		Degraded:      c.Degraded,
+	})
+}
+
 // clusterMetrics returns a metric timeseries for a metric of the Cluster entity.
 func (a *Api) clusterMetrics(request *restful.Request, response *restful.Response) {
 	a.processMetricRequest(core.ClusterKey(), request, response)
@@ -359,6 +442,12 @@ func (a *Api) namespaceMetrics(request *restful.Request, response *restful.Respo
 		request, response)
 }
 
+// qosMetrics returns a metric timeseries for a metric aggregated over a QoS class.
+func (a *Api) qosMetrics(request *restful.Request, response *restful.Response) {
+	a.processMetricRequest(core.QOSKey(request.PathParameter("qos-class")),
+		request, response)
+}
+
 // podMetrics returns a metric timeseries for a metric of the Pod entity.
 func (a *Api) podMetrics(request *restful.Request, response *restful.Response) {
 	a.processMetricRequest(
@@ -378,7 +467,7 @@ func (a *Api) podListMetrics(request *restful.Request, response *restful.Respons
 	metricName := request.PathParameter("metric-name")
 	convertedMetricName := convertMetricName(metricName)
 	for _, podName := range strings.Split(request.PathParameter("pod-list"), ",") {
-		keys = append(keys, core.PodKey(ns, podName))
+		keys = append(keys, clusterScopedKey(request, core.PodKey(ns, podName)))
 	}
 
 	labels, err := getLabels(request)
@@ -387,19 +476,31 @@ func (a *Api) podListMetrics(request *restful.Request, response *restful.Respons
 		return
 	}
 
-	var metrics map[string][]core.TimestampedMetricValue
-	if labels != nil {
-		metrics = a.metricSink.GetLabeledMetric(convertedMetricName, labels, keys, start, end)
-	} else {
-		metrics = a.metricSink.GetMetric(convertedMetricName, keys, start, end)
+	compare, err := getCompareOffset(request)
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
 	}
 
-	result := types.MetricResultList{
-		Items: make([]types.MetricResult, 0, len(keys)),
-	}
-	for _, key := range keys {
-		result.Items = append(result.Items, exportTimestampedMetricValue(metrics[key]))
-	}
+	result, _, _ := a.modelRequests.Do(modelRequestKey(request), func() (interface{}, error) {
+		metrics := a.getMetrics(convertedMetricName, labels, keys, start, end)
+		var previous map[string][]core.TimestampedMetricValue
+		if compare > 0 {
+			previous = a.getMetrics(convertedMetricName, labels, keys, shiftStart(start, compare), end.Add(-compare))
+		}
+
+		result := types.MetricResultList{
+			Items: make([]types.MetricResult, 0, len(keys)),
+		}
+		for _, key := range keys {
+			item := exportTimestampedMetricValue(metrics[key])
+			if compare > 0 {
+				item.Previous = exportComparedMetricValue(previous[key], compare)
+			}
+			result.Items = append(result.Items, item)
+		}
+		return result, nil
+	})
 	response.PrettyPrint(false)
 	response.WriteEntity(result)
 }
@@ -438,6 +539,7 @@ func parseTimeParam(queryParam string, defaultValue time.Time) (time.Time, error
 }
 
 func (a *Api) processMetricRequest(key string, request *restful.Request, response *restful.Response) {
+	key = clusterScopedKey(request, key)
 	start, end, err := getStartEndTime(request)
 	if err != nil {
 		response.WriteError(http.StatusBadRequest, err)
@@ -451,21 +553,48 @@ func (a *Api) processMetricRequest(key string, request *restful.Request, respons
 		return
 	}
 
-	var metrics map[string][]core.TimestampedMetricValue
-	if labels != nil {
-		metrics = a.metricSink.GetLabeledMetric(convertedMetricName, labels, []string{key}, start, end)
-	} else {
-		metrics = a.metricSink.GetMetric(convertedMetricName, []string{key}, start, end)
+	compare, err := getCompareOffset(request)
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
 	}
-	converted := exportTimestampedMetricValue(metrics[key])
+
+	converted, _, _ := a.modelRequests.Do(modelRequestKey(request), func() (interface{}, error) {
+		metrics := a.getMetrics(convertedMetricName, labels, []string{key}, start, end)
+		result := exportTimestampedMetricValue(metrics[key])
+		if compare > 0 {
+			previous := a.getMetrics(convertedMetricName, labels, []string{key}, shiftStart(start, compare), end.Add(-compare))
+			result.Previous = exportComparedMetricValue(previous[key], compare)
+		}
+		return result, nil
+	})
 	response.WriteEntity(converted)
 }
 
-func (a *Api) processMetricNamesRequest(key string, response *restful.Response) {
-	metricNames := a.metricSink.GetMetricNames(key)
+func (a *Api) getMetrics(metricName string, labels map[string]string, keys []string, start, end time.Time) map[string][]core.TimestampedMetricValue {
+	if labels != nil {
+		return a.metricSink.GetLabeledMetric(metricName, labels, keys, start, end)
+	}
+	return a.metricSink.GetMetric(metricName, keys, start, end)
+}
+
+// Identifies requests that can share a single computation. The raw query is used rather than
+// the parsed start and end times, as a missing end time defaults to the current time.
+func modelRequestKey(request *restful.Request) string {
+	return request.Request.URL.Path + "?" + request.Request.URL.RawQuery
+}
+
+func (a *Api) processMetricNamesRequest(request *restful.Request, key string, response *restful.Response) {
+	metricNames := a.metricSink.GetMetricNames(clusterScopedKey(request, key))
 	response.WriteEntity(metricNames)
 }
 
+// Returns the key of the metric set in the federated cluster given by the optional `cluster`
+// query parameter.
+func clusterScopedKey(request *restful.Request, key string) string {
+	return core.ClusterScopedKey(request.QueryParameter("cluster"), key)
+}
+
 func convertMetricName(metricName string) string {
 	if convertedMetricName, ok := deprecatedMetricNamesConversion[metricName]; ok {
 		return convertedMetricName
@@ -485,6 +614,44 @@ func getStartEndTime(request *restful.Request) (time.Time, time.Time, error) {
 	return start, end, nil
 }
 
+// getCompareOffset parses the optional `compare` query parameter: how far back the window
+// returned alongside the requested one is.
+func getCompareOffset(request *restful.Request) (time.Duration, error) {
+	compareRaw := request.QueryParameter("compare")
+	if compareRaw == "" {
+		return 0, nil
+	}
+	compare, err := time.ParseDuration(compareRaw)
+	if err != nil {
+		return 0, fmt.Errorf("compare argument cannot be parsed: %s", err)
+	}
+	if compare <= 0 {
+		return 0, fmt.Errorf("compare argument must be positive, got %q", compareRaw)
+	}
+	return compare, nil
+}
+
+// shiftStart moves a start time back by the compare offset. A missing start is left as is,
+// so that all retained data before the shifted end is returned.
+func shiftStart(start time.Time, compare time.Duration) time.Time {
+	if start.IsZero() {
+		return start
+	}
+	return start.Add(-compare)
+}
+
+// exportComparedMetricValue exports the values of the shifted window with their timestamps
+// moved forward by the compare offset, so that they line up with the requested window.
+func exportComparedMetricValue(values []core.TimestampedMetricValue, compare time.Duration) *types.MetricResult {
+	shifted := make([]core.TimestampedMetricValue, 0, len(values))
+	for _, value := range values {
+		value.Timestamp = value.Timestamp.Add(compare)
+		shifted = append(shifted, value)
+	}
+	result := exportTimestampedMetricValue(shifted)
+	return &result
+}
+
 func exportTimestampedMetricValue(values []core.TimestampedMetricValue) types.MetricResult {
 	result := types.MetricResult{
 		Metrics: make([]types.MetricPoint, 0, len(values)),
@@ -493,22 +660,26 @@ func exportTimestampedMetricValue(values []core.TimestampedMetricValue) types.Me
 		if result.LatestTimestamp.Before(value.Timestamp) {
 			result.LatestTimestamp = value.Timestamp
 		}
-		// TODO: clean up types in model api
-		var intValue int64
-		if value.ValueType == core.ValueInt64 {
-			intValue = value.IntValue
-		} else {
-			intValue = int64(value.FloatValue)
-		}
-
-		result.Metrics = append(result.Metrics, types.MetricPoint{
-			Timestamp: value.Timestamp,
-			Value:     uint64(intValue),
-		})
+		result.Metrics = append(result.Metrics, exportMetricPoint(value))
 	}
 	return result
 }
 
+func exportMetricPoint(value core.TimestampedMetricValue) types.MetricPoint {
+	// TODO: clean up types in model api
+	var intValue int64
+	if value.ValueType == core.ValueInt64 {
+		intValue = value.IntValue
+	} else {
+		intValue = int64(value.FloatValue)
+	}
+
+	return types.MetricPoint{
+		Timestamp: value.Timestamp,
+		Value:     uint64(intValue),
+	}
+}
+
 func getLabels(request *restful.Request) (map[string]string, error) {
 	labelsRaw := request.QueryParameter("labels")
 	if labelsRaw == "" {
@@ -0,0 +1,115 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/api/v1/types"
+	"k8s.io/heapster/metrics/core"
+	metricsink "k8s.io/heapster/metrics/sinks/metric"
+)
+
+func TestCompareMetrics(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	metricSink := metricsink.NewMetricSink(48*time.Hour, 48*time.Hour, nil)
+	for _, offset := range []time.Duration{24 * time.Hour, 0} {
+		for i := 2; i >= 0; i-- {
+			value := core.MetricValue{ValueType: core.ValueInt64, IntValue: int64(100*(3-i)) + int64(offset/time.Hour)}
+			metricSink.ExportData(&core.DataBatch{
+				Timestamp: now.Add(-offset - time.Duration(i)*time.Minute),
+				MetricSets: map[string]*core.MetricSet{
+					core.NodeKey("node1"): {
+						Labels:       map[string]string{core.LabelMetricSetType.Key: core.MetricSetTypeNode},
+						MetricValues: map[string]core.MetricValue{core.MetricMemoryUsage.Name: value},
+					},
+					core.PodKey("default", "pod1"): {
+						Labels:       map[string]string{core.LabelMetricSetType.Key: core.MetricSetTypePod},
+						MetricValues: map[string]core.MetricValue{core.MetricMemoryUsage.Name: value},
+					},
+				},
+			})
+		}
+	}
+
+	container := restful.NewContainer()
+	container.Router(restful.CurlyRouter{})
+	NewApi(true, metricSink, nil, nil).Register(container)
+	server := httptest.NewServer(container)
+	defer server.Close()
+
+	get := func(path string, expectedStatus int, result interface{}) {
+		resp, err := http.Get(server.URL + "/api/v1/model" + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, expectedStatus, resp.StatusCode, path)
+		if expectedStatus == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+		}
+	}
+
+	start := now.Add(-90 * time.Second).Format(time.RFC3339)
+
+	// Without compare, only the requested window is returned.
+	result := types.MetricResult{}
+	get("/nodes/node1/metrics/memory/usage?start="+start, http.StatusOK, &result)
+	assert.Len(t, result.Metrics, 2)
+	assert.Nil(t, result.Previous)
+
+	// The previous window is lined up with the requested one.
+	result = types.MetricResult{}
+	get("/nodes/node1/metrics/memory/usage?compare=24h&start="+start, http.StatusOK, &result)
+	require.Len(t, result.Metrics, 2)
+	require.NotNil(t, result.Previous)
+	require.Len(t, result.Previous.Metrics, 2)
+	for i := range result.Metrics {
+		assert.Equal(t, result.Metrics[i].Timestamp.Unix(), result.Previous.Metrics[i].Timestamp.Unix())
+		assert.Equal(t, result.Metrics[i].Value+24, result.Previous.Metrics[i].Value)
+	}
+	assert.Equal(t, now.Unix(), result.Previous.LatestTimestamp.Unix())
+
+	// Without a start, everything retained before the shifted end is compared.
+	result = types.MetricResult{}
+	get("/namespaces/default/pods/pod1/metrics/memory/usage?compare=24h", http.StatusOK, &result)
+	assert.Len(t, result.Metrics, 6)
+	require.NotNil(t, result.Previous)
+	assert.Len(t, result.Previous.Metrics, 3)
+
+	// Nothing is retained before the window compared with.
+	result = types.MetricResult{}
+	get("/nodes/node1/metrics/memory/usage?compare=72h&start="+start, http.StatusOK, &result)
+	require.NotNil(t, result.Previous)
+	assert.Empty(t, result.Previous.Metrics)
+
+	list := types.MetricResultList{}
+	get("/namespaces/default/pod-list/pod1,pod2/metrics/memory/usage?compare=24h&start="+start, http.StatusOK, &list)
+	require.Len(t, list.Items, 2)
+	require.NotNil(t, list.Items[0].Previous)
+	assert.Len(t, list.Items[0].Previous.Metrics, 2)
+	require.NotNil(t, list.Items[1].Previous)
+	assert.Empty(t, list.Items[1].Previous.Metrics)
+
+	get("/nodes/node1/metrics/memory/usage?compare=x", http.StatusBadRequest, nil)
+	get("/nodes/node1/metrics/memory/usage?compare=-24h", http.StatusBadRequest, nil)
+	get("/namespaces/default/pod-list/pod1/metrics/memory/usage?compare=0s", http.StatusBadRequest, nil)
+}
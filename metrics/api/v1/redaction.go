@@ -0,0 +1,306 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+
+	"k8s.io/heapster/metrics/api/v1/types"
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	// Value replacing the hidden label values.
+	RedactedValue = "redacted"
+
+	// Request attribute holding the redaction applying to the client.
+	redactionAttribute = "redaction"
+)
+
+// RedactionRule hides label values and the entities they name from the API clients matching its
+// users or groups, e.g. read-only tenants which shouldn't see the pods of the other tenants.
+type RedactionRule struct {
+	Name string `json:"name"`
+	// Common names of the client certificates, or `*` for all the clients, including the ones
+	// without a certificate.
+	Users []string `json:"users"`
+	// Organizations of the client certificates.
+	Groups []string `json:"groups"`
+	// Keys of the labels the values of which are hidden. The entities they name can't be listed
+	// nor queried either, e.g. the pods if `pod_name` is hidden.
+	HideLabels []string `json:"hideLabels"`
+	// Whether only the cluster and namespace aggregates are served. Hides the labels of the
+	// nodes, pods and containers.
+	AggregatesOnly bool `json:"aggregatesOnly"`
+}
+
+// RedactionConfig lists the redaction rules. The clients matching none of them, typically the
+// admins, get the API responses as is.
+type RedactionConfig struct {
+	Rules []RedactionRule `json:"rules"`
+}
+
+// Labels hidden by the AggregatesOnly rules.
+var aggregateHiddenLabels = []string{
+	core.LabelNodename.Key,
+	core.LabelHostname.Key,
+	core.LabelHostID.Key,
+	core.LabelPodName.Key,
+	core.LabelPodId.Key,
+	core.LabelContainerName.Key,
+	core.LabelContainerBaseImage.Key,
+	core.LabelLabels.Key,
+}
+
+// Labels naming the entities of the path segments preceding their names.
+var entitySegmentLabels = map[string]string{
+	"nodes":          core.LabelNodename.Key,
+	"namespaces":     core.LabelNamespaceName.Key,
+	"pods":           core.LabelPodName.Key,
+	"pod-list":       core.LabelPodName.Key,
+	"pod-id":         core.LabelPodId.Key,
+	"pod-id-list":    core.LabelPodId.Key,
+	"containers":     core.LabelContainerName.Key,
+	"freecontainers": core.LabelContainerName.Key,
+}
+
+// Path segments refused to any client with a redaction: the events name their objects, the debug
+// endpoints list all the entities.
+var redactedSegments = map[string]bool{
+	"events":      true,
+	"involvement": true,
+	"debug":       true,
+}
+
+// Labels naming the rows of the usage reports, by grouping.
+var reportGroupByLabels = map[string]string{
+	reportGroupByNamespace: core.LabelNamespaceName.Key,
+	reportGroupByNode:      core.LabelNodename.Key,
+	reportGroupByPod:       core.LabelPodName.Key,
+}
+
+// Paths served to the clients with a redaction. The debug, admin and sink endpoints aren't.
+var redactedPaths = []string{
+	"/api/v1/model/",
+	"/api/v1/historical/",
+	"/api/v1/reports/",
+	"/api/v1/metric-export",
+	"/apis/metrics/",
+}
+
+// The redaction applying to a client: the union of the rules it matches.
+type redaction struct {
+	rules          []string
+	hidden         map[string]bool
+	aggregatesOnly bool
+}
+
+func (rd *redaction) String() string {
+	return strings.Join(rd.rules, ",")
+}
+
+// Redactor applies the redaction rules to the API requests of the clients matching them.
+type Redactor struct {
+	config RedactionConfig
+}
+
+// NewRedactor creates a redactor with the rules of the given YAML or JSON file.
+func NewRedactor(path string) (*Redactor, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	redactor := &Redactor{}
+	if err := yaml.Unmarshal(data, &redactor.config); err != nil {
+		return nil, fmt.Errorf("failed to parse redaction rules %s - %v", path, err)
+	}
+	for i, rule := range redactor.config.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("invalid redaction rules %s - rule %d has no name", path, i)
+		}
+		if len(rule.Users) == 0 && len(rule.Groups) == 0 {
+			return nil, fmt.Errorf("invalid redaction rules %s - rule %s has no users nor groups", path, rule.Name)
+		}
+		if len(rule.HideLabels) == 0 && !rule.AggregatesOnly {
+			return nil, fmt.Errorf("invalid redaction rules %s - rule %s hides nothing", path, rule.Name)
+		}
+	}
+	return redactor, nil
+}
+
+// Returns the redaction applying to the client of the request, nil if none does. The client is
+// identified by its certificate, like by the --allowed_users authorization.
+func (r *Redactor) redaction(req *http.Request) *redaction {
+	user := ""
+	groups := []string{}
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		user = req.TLS.PeerCertificates[0].Subject.CommonName
+		groups = req.TLS.PeerCertificates[0].Subject.Organization
+	}
+
+	var result *redaction
+	for _, rule := range r.config.Rules {
+		if !ruleMatches(rule, user, groups) {
+			continue
+		}
+		if result == nil {
+			result = &redaction{hidden: make(map[string]bool)}
+		}
+		result.rules = append(result.rules, rule.Name)
+		for _, label := range rule.HideLabels {
+			result.hidden[label] = true
+		}
+		if rule.AggregatesOnly {
+			result.aggregatesOnly = true
+			for _, label := range aggregateHiddenLabels {
+				result.hidden[label] = true
+			}
+		}
+	}
+	return result
+}
+
+func ruleMatches(rule RedactionRule, user string, groups []string) bool {
+	for _, ruleUser := range rule.Users {
+		if ruleUser == "*" || (user != "" && ruleUser == user) {
+			return true
+		}
+	}
+	for _, ruleGroup := range rule.Groups {
+		for _, group := range groups {
+			if ruleGroup == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns why the request is refused to a client with the given redaction, or an empty string
+// if it is served.
+func (rd *redaction) refusal(req *http.Request) string {
+	path := req.URL.Path
+	prefix := ""
+	for _, redactedPath := range redactedPaths {
+		if strings.HasPrefix(path, redactedPath) {
+			prefix = redactedPath
+			break
+		}
+	}
+	if prefix == "" {
+		return "the endpoint isn't served"
+	}
+	if prefix == "/api/v1/metric-export" && path != "/api/v1/metric-export-schema" && rd.aggregatesOnly {
+		return "only the aggregates are served"
+	}
+	if prefix == "/api/v1/reports/" {
+		groupBy := req.URL.Query().Get("groupBy")
+		if groupBy == "" {
+			groupBy = reportGroupByNamespace
+		}
+		if label, found := reportGroupByLabels[groupBy]; found && rd.hidden[label] {
+			return fmt.Sprintf("label %s is hidden", label)
+		}
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, prefix), "/")
+	for i := 0; i < len(segments); i++ {
+		segment := segments[i]
+		// The rest of the path is the name of the metric.
+		if segment == "metrics" || segment == "metrics-aggregated" {
+			break
+		}
+		if redactedSegments[segment] {
+			return fmt.Sprintf("the %s endpoints aren't served", segment)
+		}
+		if label, found := entitySegmentLabels[segment]; found {
+			if rd.hidden[label] {
+				return fmt.Sprintf("label %s is hidden", label)
+			}
+			// Skip the name of the entity.
+			i++
+		}
+	}
+	return ""
+}
+
+// Filter refuses the requests revealing hidden labels, and passes the redaction to the handlers
+// of the others.
+func (r *Redactor) Filter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	redaction := r.redaction(req.Request)
+	if redaction == nil {
+		chain.ProcessFilter(req, resp)
+		return
+	}
+	if refusal := redaction.refusal(req.Request); refusal != "" {
+		glog.V(2).Infof("Refused %s to %s with redaction %v: %s", req.Request.URL.Path, req.Request.RemoteAddr, redaction, refusal)
+		resp.WriteErrorString(http.StatusForbidden, fmt.Sprintf("Forbidden by redaction %v: %s", redaction, refusal))
+		return
+	}
+	req.SetAttribute(redactionAttribute, redaction)
+	chain.ProcessFilter(req, resp)
+}
+
+// Handler refuses the requests of the clients with a redaction to the handler, which serves the
+// labels as is, e.g. the Prometheus exposition or the endpoints of the HTTP sinks. Returns the
+// handler as is if the redactor is nil.
+func (r *Redactor) Handler(handler http.Handler) http.Handler {
+	if r == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if redaction := r.redaction(req); redaction != nil {
+			glog.V(2).Infof("Refused %s to %s with redaction %v: the endpoint isn't served", req.URL.Path, req.RemoteAddr, redaction)
+			http.Error(w, fmt.Sprintf("Forbidden by redaction %v: the endpoint isn't served", redaction), http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// Returns the redaction set on the request by the filter, nil if there is none.
+func requestRedaction(req *restful.Request) *redaction {
+	if redaction, ok := req.Attribute(redactionAttribute).(*redaction); ok {
+		return redaction
+	}
+	return nil
+}
+
+// Replaces the hidden label values of the exported timeseries.
+func (rd *redaction) redactTimeseries(timeseries []*types.Timeseries) {
+	for _, ts := range timeseries {
+		rd.redactLabels(ts.Labels)
+		for _, points := range ts.Metrics {
+			for _, point := range points {
+				rd.redactLabels(point.Labels)
+			}
+		}
+	}
+}
+
+func (rd *redaction) redactLabels(labels map[string]string) {
+	for key := range labels {
+		if rd.hidden[key] {
+			labels[key] = RedactedValue
+		}
+	}
+}
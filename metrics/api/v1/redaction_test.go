@@ -0,0 +1,218 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/api/v1/types"
+	"k8s.io/heapster/metrics/core"
+	metricsink "k8s.io/heapster/metrics/sinks/metric"
+)
+
+const testRedactionRules = `
+rules:
+- name: tenants
+  groups: [tenants]
+  hideLabels: [pod_name, labels]
+- name: billing
+  users: [billing]
+  aggregatesOnly: true
+`
+
+func newTestRedactor(t *testing.T, rules string) (*Redactor, error) {
+	file, err := ioutil.TempFile("", "redaction")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(rules)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	return NewRedactor(file.Name())
+}
+
+func TestNewRedactor(t *testing.T) {
+	_, err := newTestRedactor(t, testRedactionRules)
+	assert.NoError(t, err)
+
+	for _, rules := range []string{
+		"rules: [{users: [a], hideLabels: [pod_name]}]",
+		"rules: [{name: a, hideLabels: [pod_name]}]",
+		"rules: [{name: a, users: [a]}]",
+		"rules: {name: a}",
+	} {
+		_, err := newTestRedactor(t, rules)
+		assert.Error(t, err, rules)
+	}
+}
+
+func redactionRequest(t *testing.T, handler http.Handler, path, user string, groups ...string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "http://heapster"+path, nil)
+	require.NoError(t, err)
+	if user != "" {
+		// The certificates are verified by the authentication handler in front of the API.
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+			Subject: pkix.Name{CommonName: user, Organization: groups},
+		}}}
+	}
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestRedaction(t *testing.T) {
+	redactor, err := newTestRedactor(t, testRedactionRules)
+	require.NoError(t, err)
+
+	now := time.Now()
+	metricSink := metricsink.NewMetricSink(time.Hour, time.Hour, nil)
+	value := core.MetricValue{ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 100}
+	metricSink.ExportData(&core.DataBatch{
+		Timestamp: now,
+		MetricSets: map[string]*core.MetricSet{
+			core.PodKey("ns1", "pod1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key:   core.MetricSetTypePod,
+					core.LabelNamespaceName.Key:   "ns1",
+					core.LabelPodName.Key:         "pod1",
+					core.LabelLabels.Key:          "app:secret",
+					core.LabelHostname.Key:        "node1",
+					core.LabelPodNamespace.Key:    "ns1",
+					core.LabelContainerName.Key:   "",
+					core.LabelPodId.Key:           "uid1",
+					core.LabelNodename.Key:        "node1",
+					core.LabelHostID.Key:          "node1",
+					core.LabelPodNamespaceUID.Key: "nsuid1",
+				},
+				MetricValues: map[string]core.MetricValue{core.MetricMemoryUsage.Name: value},
+			},
+			core.NamespaceKey("ns1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypeNamespace,
+					core.LabelNamespaceName.Key: "ns1",
+				},
+				MetricValues: map[string]core.MetricValue{core.MetricMemoryUsage.Name: value},
+			},
+		},
+	})
+
+	container := restful.NewContainer()
+	container.Router(restful.CurlyRouter{})
+	container.Filter(redactor.Filter)
+	NewApi(true, metricSink, nil, nil).Register(container)
+
+	for _, tc := range []struct {
+		path   string
+		user   string
+		groups []string
+		status int
+	}{
+		// Clients matching no rule see everything.
+		{"/api/v1/model/namespaces/ns1/pods/", "admin", nil, http.StatusOK},
+		{"/api/v1/model/namespaces/ns1/pods/pod1/metrics/memory/usage", "admin", nil, http.StatusOK},
+		{"/api/v1/model/debug/allkeys", "", nil, http.StatusOK},
+
+		{"/api/v1/model/namespaces/ns1/metrics/memory/usage", "alice", []string{"tenants"}, http.StatusOK},
+		{"/api/v1/model/nodes/node1/metrics/memory/usage", "alice", []string{"tenants"}, http.StatusOK},
+		{"/api/v1/model/namespaces/ns1/pods/", "alice", []string{"tenants"}, http.StatusForbidden},
+		{"/api/v1/model/namespaces/ns1/pods/pod1/metrics/memory/usage", "alice", []string{"tenants"}, http.StatusForbidden},
+		{"/api/v1/model/namespaces/ns1/pod-list/pod1,pod2/metrics/memory/usage", "alice", []string{"tenants"}, http.StatusForbidden},
+		{"/api/v1/model/debug/allkeys", "alice", []string{"tenants"}, http.StatusForbidden},
+		{"/api/v1/model/events", "alice", []string{"tenants"}, http.StatusForbidden},
+		{"/api/v1/metric-export", "alice", []string{"tenants"}, http.StatusOK},
+
+		// A namespace named after an entity is only a name.
+		{"/api/v1/model/namespaces/pods/metrics/memory/usage", "alice", []string{"tenants"}, http.StatusOK},
+
+		{"/api/v1/model/metrics/memory/usage", "billing", nil, http.StatusOK},
+		{"/api/v1/model/namespaces/ns1/metrics/memory/usage", "billing", nil, http.StatusOK},
+		{"/api/v1/model/nodes/", "billing", nil, http.StatusForbidden},
+		{"/api/v1/model/nodes/node1/freecontainers/", "billing", nil, http.StatusForbidden},
+		{"/api/v1/metric-export", "billing", nil, http.StatusForbidden},
+		{"/api/v1/metric-export-schema", "billing", nil, http.StatusOK},
+	} {
+		resp := redactionRequest(t, container, tc.path, tc.user, tc.groups...)
+		assert.Equal(t, tc.status, resp.Code, "%s by %s", tc.path, tc.user)
+	}
+
+	// The hidden labels of the exported metrics are redacted.
+	resp := redactionRequest(t, container, "/api/v1/metric-export", "alice", "tenants")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var timeseries []*types.Timeseries
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&timeseries))
+	require.Len(t, timeseries, 1)
+	assert.Equal(t, RedactedValue, timeseries[0].Labels[core.LabelPodName.Key])
+	assert.Equal(t, RedactedValue, timeseries[0].Labels[core.LabelLabels.Key])
+	assert.Equal(t, "ns1", timeseries[0].Labels[core.LabelPodNamespace.Key])
+	assert.Equal(t, "node1", timeseries[0].Labels[core.LabelHostname.Key])
+}
+
+func TestRedactionRefusal(t *testing.T) {
+	redactor, err := newTestRedactor(t, testRedactionRules)
+	require.NoError(t, err)
+	redaction := redactor.redaction(&http.Request{TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+		Subject: pkix.Name{CommonName: "alice", Organization: []string{"tenants"}},
+	}}}})
+	require.NotNil(t, redaction)
+
+	for path, refused := range map[string]bool{
+		"/api/v1/reports/usage":                               false,
+		"/api/v1/reports/usage?groupBy=node":                  false,
+		"/api/v1/reports/usage?groupBy=pod":                   true,
+		"/api/v1/reports/usage?groupBy=namespace":             false,
+		"/api/v1/historical/pod-id/uid1/metrics/memory/usage": false,
+		"/apis/metrics/v1alpha1/nodes/":                       false,
+		"/apis/metrics/v1alpha1/pods/":                        true,
+		// The debug, admin and sink endpoints are only served to the clients without redaction.
+		"/api/v1/sinks":                   true,
+		"/debug/pprof/":                   true,
+		"/api/v1/admin/label-corrections": true,
+	} {
+		req, err := http.NewRequest("GET", "http://heapster"+path, nil)
+		require.NoError(t, err)
+		assert.Equal(t, refused, redaction.refusal(req) != "", path)
+	}
+}
+
+func TestRedactorHandler(t *testing.T) {
+	redactor, err := newTestRedactor(t, testRedactionRules)
+	require.NoError(t, err)
+	handler := redactor.Handler(prometheus.Handler())
+
+	// The exposition serves the label values as is, so it's refused to any client with a redaction.
+	resp := redactionRequest(t, handler, "/metrics", "alice", "tenants")
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Body.String(), "tenants")
+	assert.Equal(t, http.StatusForbidden, redactionRequest(t, handler, "/metrics", "billing").Code)
+	assert.Equal(t, http.StatusOK, redactionRequest(t, handler, "/metrics", "admin", "admins").Code)
+	assert.Equal(t, http.StatusOK, redactionRequest(t, handler, "/metrics", "").Code)
+
+	// Without redaction rules the handler is served as is.
+	var none *Redactor
+	assert.Equal(t, http.StatusOK, redactionRequest(t, none.Handler(prometheus.Handler()), "/metrics", "alice", "tenants").Code)
+}
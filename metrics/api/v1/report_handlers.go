@@ -0,0 +1,266 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+
+	"k8s.io/heapster/metrics/api/v1/types"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util/metrics"
+)
+
+const (
+	defaultReportPeriod = 24 * time.Hour
+
+	// Entities the usage report can be grouped by.
+	reportGroupByNamespace = "namespace"
+	reportGroupByNode      = "node"
+	reportGroupByPod       = "pod"
+)
+
+// A column of the usage report, an aggregation of a metric over the report period.
+type reportColumn struct {
+	name        string
+	metric      string
+	aggregation core.AggregationType
+}
+
+var usageReportColumns = []reportColumn{
+	{"cpu_usage_average", core.MetricCpuUsageRate.Name, core.AggregationTypeAverage},
+	{"cpu_usage_max", core.MetricCpuUsageRate.Name, core.AggregationTypeMaximum},
+	{"cpu_request", core.MetricCpuRequest.Name, core.AggregationTypeAverage},
+	{"cpu_limit", core.MetricCpuLimit.Name, core.AggregationTypeAverage},
+	{"memory_usage_average", core.MetricMemoryUsage.Name, core.AggregationTypeAverage},
+	{"memory_usage_max", core.MetricMemoryUsage.Name, core.AggregationTypeMaximum},
+	{"memory_request", core.MetricMemoryRequest.Name, core.AggregationTypeAverage},
+	{"memory_limit", core.MetricMemoryLimit.Name, core.AggregationTypeAverage},
+}
+
+// RegisterReports registers the endpoints summarizing the historical metrics into reports.
+func (a *Api) RegisterReports(container *restful.Container) {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/reports").
+		Doc("Reports computed from the historical metrics").
+		Consumes("*/*").
+		Produces(restful.MIME_JSON, "text/csv")
+
+	// The /usage endpoint summarizes the resource usage, requests and limits of namespaces, nodes or pods.
+	ws.Route(ws.GET("/usage").
+		To(metrics.InstrumentRouteFunc("usageReport", a.usageReport)).
+		Doc("Get a summary of resource usage, requests and limits").
+		Operation("usageReport").
+		Param(ws.QueryParameter("period", "The period covered by the report, e.g. 24h or 7d (24h by default)").DataType("string")).
+		Param(ws.QueryParameter("end", "End time of the report, now by default").DataType("string")).
+		Param(ws.QueryParameter("groupBy", "One of namespace (default), node or pod").DataType("string")).
+		Param(ws.QueryParameter("format", "One of json (default) or csv").DataType("string")).
+		Writes(types.UsageReport{}))
+	container.Add(ws)
+}
+
+func (a *Api) usageReport(request *restful.Request, response *restful.Response) {
+	period, err := parseReportPeriod(request.QueryParameter("period"))
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	end, err := parseTimeParam(request.QueryParameter("end"), nowFunc())
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	format := request.QueryParameter("format")
+	if format != "" && format != "json" && format != "csv" {
+		response.WriteError(http.StatusBadRequest, fmt.Errorf("unknown format %q, should be json or csv", format))
+		return
+	}
+	groupBy := request.QueryParameter("groupBy")
+	if groupBy == "" {
+		groupBy = reportGroupByNamespace
+	}
+
+	names, keys, err := a.reportKeys(groupBy)
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	report := types.UsageReport{
+		Start:   end.Add(-period),
+		End:     end,
+		GroupBy: groupBy,
+		Columns: make([]string, 0, len(usageReportColumns)),
+		Rows:    make([]types.UsageReportRow, 0, len(keys)),
+	}
+	for _, column := range usageReportColumns {
+		report.Columns = append(report.Columns, column.name)
+	}
+	for i := range keys {
+		report.Rows = append(report.Rows, types.UsageReportRow{
+			Name:   names[i],
+			Values: make(map[string]int64, len(usageReportColumns)),
+		})
+	}
+	if len(keys) > 0 {
+		if err := a.fillUsageReport(&report, keys); err != nil {
+			response.WriteError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if format == "csv" {
+		writeUsageReportCSV(report, response)
+		return
+	}
+	response.WriteEntity(report)
+}
+
+// Returns the names and historical keys of the entities the report is grouped by, sorted by name.
+func (a *Api) reportKeys(groupBy string) ([]string, []core.HistoricalKey, error) {
+	names := []string{}
+	keys := []core.HistoricalKey{}
+	switch groupBy {
+	case reportGroupByNamespace:
+		namespaces, err := a.historicalSource.GetNamespaces()
+		if err != nil {
+			return nil, nil, err
+		}
+		sort.Strings(namespaces)
+		for _, namespace := range namespaces {
+			names = append(names, namespace)
+			keys = append(keys, core.HistoricalKey{ObjectType: core.MetricSetTypeNamespace, NamespaceName: namespace})
+		}
+	case reportGroupByNode:
+		nodes, err := a.historicalSource.GetNodes()
+		if err != nil {
+			return nil, nil, err
+		}
+		sort.Strings(nodes)
+		for _, node := range nodes {
+			names = append(names, node)
+			keys = append(keys, core.HistoricalKey{ObjectType: core.MetricSetTypeNode, NodeName: node})
+		}
+	case reportGroupByPod:
+		namespaces, err := a.historicalSource.GetNamespaces()
+		if err != nil {
+			return nil, nil, err
+		}
+		sort.Strings(namespaces)
+		for _, namespace := range namespaces {
+			pods, err := a.historicalSource.GetPodsFromNamespace(namespace)
+			if err != nil {
+				return nil, nil, err
+			}
+			sort.Strings(pods)
+			for _, pod := range pods {
+				names = append(names, namespace+"/"+pod)
+				keys = append(keys, core.HistoricalKey{ObjectType: core.MetricSetTypePod, NamespaceName: namespace, PodName: pod})
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown groupBy %q, should be one of namespace, node or pod", groupBy)
+	}
+	return names, keys, nil
+}
+
+// Fetches the aggregations of every metric of the report in a single bucket spanning the period.
+func (a *Api) fillUsageReport(report *types.UsageReport, keys []core.HistoricalKey) error {
+	aggregations := make(map[string][]core.AggregationType)
+	metricNames := []string{}
+	for _, column := range usageReportColumns {
+		if _, found := aggregations[column.metric]; !found {
+			metricNames = append(metricNames, column.metric)
+		}
+		aggregations[column.metric] = append(aggregations[column.metric], column.aggregation)
+	}
+
+	for _, metricName := range metricNames {
+		values, err := a.historicalSource.GetAggregation(metricName, aggregations[metricName], keys, report.Start, report.End, 0)
+		if err != nil {
+			return fmt.Errorf("failed to aggregate %s: %v", metricName, err)
+		}
+		for i, key := range keys {
+			if len(values[key]) == 0 {
+				continue
+			}
+			for _, column := range usageReportColumns {
+				if column.metric != metricName {
+					continue
+				}
+				if value, found := values[key][0].Aggregations[column.aggregation]; found {
+					report.Rows[i].Values[column.name] = reportValue(value)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func reportValue(value core.MetricValue) int64 {
+	if value.ValueType == core.ValueFloat {
+		return int64(value.FloatValue)
+	}
+	return value.IntValue
+}
+
+// Parses a duration, additionally accepting a number of days like 7d.
+func parseReportPeriod(raw string) (time.Duration, error) {
+	if raw == "" {
+		return defaultReportPeriod, nil
+	}
+	var period time.Duration
+	var err error
+	if strings.HasSuffix(raw, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(raw, "d"))
+		period = time.Duration(days) * 24 * time.Hour
+	} else {
+		period, err = time.ParseDuration(raw)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("period argument cannot be parsed: %s", err)
+	}
+	if period <= 0 {
+		return 0, fmt.Errorf("period must be positive")
+	}
+	return period, nil
+}
+
+// Writes the report as a table with a header row. Unknown values are left empty.
+func writeUsageReportCSV(report types.UsageReport, response *restful.Response) {
+	response.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(response)
+	writer.Write(append([]string{report.GroupBy}, report.Columns...))
+	for _, row := range report.Rows {
+		record := []string{row.Name}
+		for _, column := range report.Columns {
+			if value, found := row.Values[column]; found {
+				record = append(record, strconv.FormatInt(value, 10))
+			} else {
+				record = append(record, "")
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/api/v1/types"
+	"k8s.io/heapster/metrics/core"
+)
+
+// Returns fixed aggregated values per metric and key.
+type reportHistoricalSource struct {
+	*fakeHistoricalSource
+	values map[string]map[core.HistoricalKey]int64
+	// Time ranges of the aggregation requests.
+	starts, ends []time.Time
+}
+
+func (src *reportHistoricalSource) GetAggregation(metricName string, aggregations []core.AggregationType, metricKeys []core.HistoricalKey, start, end time.Time, bucketSize time.Duration) (map[core.HistoricalKey][]core.TimestampedAggregationValue, error) {
+	src.starts = append(src.starts, start)
+	src.ends = append(src.ends, end)
+	result := make(map[core.HistoricalKey][]core.TimestampedAggregationValue)
+	for _, key := range metricKeys {
+		value, found := src.values[metricName][key]
+		if !found {
+			continue
+		}
+		aggregated := core.AggregationValue{Aggregations: make(map[core.AggregationType]core.MetricValue)}
+		for i, aggregation := range aggregations {
+			// The maximum is made different from the average.
+			aggregated.Aggregations[aggregation] = core.MetricValue{ValueType: core.ValueInt64, IntValue: value * int64(i+1)}
+		}
+		result[key] = []core.TimestampedAggregationValue{{Timestamp: start, AggregationValue: aggregated}}
+	}
+	return result, nil
+}
+
+func TestUsageReport(t *testing.T) {
+	now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	ns1 := core.HistoricalKey{ObjectType: core.MetricSetTypeNamespace, NamespaceName: "ns1"}
+	ns2 := core.HistoricalKey{ObjectType: core.MetricSetTypeNamespace, NamespaceName: "ns2"}
+	pod := core.HistoricalKey{ObjectType: core.MetricSetTypePod, NamespaceName: "ns1", PodName: "pod1"}
+	src := &reportHistoricalSource{
+		fakeHistoricalSource: &fakeHistoricalSource{
+			nodes:            []string{"node1"},
+			namespaces:       []string{"ns2", "ns1"},
+			podsForNamespace: map[string][]string{"ns1": {"pod1"}, "ns2": {}},
+		},
+		values: map[string]map[core.HistoricalKey]int64{
+			core.MetricCpuUsageRate.Name:  {ns1: 100, ns2: 10, pod: 50},
+			core.MetricCpuRequest.Name:    {ns1: 200},
+			core.MetricMemoryUsage.Name:   {ns1: 1000},
+			core.MetricMemoryLimit.Name:   {ns1: 4000},
+			core.MetricMemoryRequest.Name: {ns1: 2000},
+		},
+	}
+
+	container := restful.NewContainer()
+	NewApi(true, nil, src, nil).Register(container)
+	server := httptest.NewServer(container)
+	defer server.Close()
+
+	get := func(query string, expectedStatus int) []byte {
+		resp, err := http.Get(server.URL + "/api/v1/reports/usage" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, expectedStatus, resp.StatusCode, query)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return body
+	}
+
+	report := types.UsageReport{}
+	require.NoError(t, json.Unmarshal(get("", http.StatusOK), &report))
+	assert.Equal(t, "namespace", report.GroupBy)
+	assert.Equal(t, now.Add(-24*time.Hour), report.Start)
+	assert.Equal(t, now, src.ends[0])
+	require.Len(t, report.Rows, 2)
+	assert.Equal(t, "ns1", report.Rows[0].Name)
+	assert.Equal(t, map[string]int64{
+		"cpu_usage_average":    100,
+		"cpu_usage_max":        200,
+		"cpu_request":          200,
+		"memory_usage_average": 1000,
+		"memory_usage_max":     2000,
+		"memory_request":       2000,
+		"memory_limit":         4000,
+	}, report.Rows[0].Values)
+	assert.Equal(t, "ns2", report.Rows[1].Name)
+	assert.Equal(t, int64(10), report.Rows[1].Values["cpu_usage_average"])
+
+	report = types.UsageReport{}
+	require.NoError(t, json.Unmarshal(get("?period=7d&groupBy=pod", http.StatusOK), &report))
+	assert.Equal(t, now.Add(-7*24*time.Hour), report.Start)
+	require.Len(t, report.Rows, 1)
+	assert.Equal(t, "ns1/pod1", report.Rows[0].Name)
+	assert.Equal(t, int64(50), report.Rows[0].Values["cpu_usage_average"])
+
+	csv := string(get("?format=csv&end=2016-09-30T12:00:00Z", http.StatusOK))
+	assert.Equal(t, "namespace,cpu_usage_average,cpu_usage_max,cpu_request,cpu_limit,memory_usage_average,memory_usage_max,memory_request,memory_limit\n"+
+		"ns1,100,200,200,,1000,2000,2000,4000\n"+
+		"ns2,10,20,,,,,,\n", csv)
+	assert.Equal(t, now.Add(-24*time.Hour), src.ends[len(src.ends)-1])
+
+	report = types.UsageReport{}
+	require.NoError(t, json.Unmarshal(get("?groupBy=node", http.StatusOK), &report))
+	require.Len(t, report.Rows, 1)
+	assert.Equal(t, "node1", report.Rows[0].Name)
+	assert.Empty(t, report.Rows[0].Values)
+
+	get("?groupBy=container", http.StatusBadRequest)
+	get("?period=x", http.StatusBadRequest)
+	get("?period=-1h", http.StatusBadRequest)
+	get("?format=xml", http.StatusBadRequest)
+}
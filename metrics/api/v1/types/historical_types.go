@@ -47,3 +47,27 @@ type MetricAggregationResult struct {
 type MetricAggregationResultList struct {
 	Items []MetricAggregationResult `json:"items"`
 }
+
+// MetricContinuation terminates a streamed (NDJSON) metric result which was cut short by
+// the page limit.  Passing Continue back as the `continue` query parameter resumes the stream.
+type MetricContinuation struct {
+	Continue string `json:"continue"`
+}
+
+// UsageReport summarizes the resource usage, requests and limits of a group of entities
+// (namespaces, nodes or pods) over a period of time.
+type UsageReport struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	GroupBy string    `json:"groupBy"`
+	// Names of the values of every row. CPU values are in millicores, memory values in bytes.
+	Columns []string         `json:"columns"`
+	Rows    []UsageReportRow `json:"rows"`
+}
+
+// UsageReportRow contains the values of a single entity of a UsageReport. Values which
+// are not known are missing.
+type UsageReportRow struct {
+	Name   string           `json:"name"`
+	Values map[string]int64 `json:"values"`
+}
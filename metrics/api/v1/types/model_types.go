@@ -30,6 +30,12 @@ type MetricPoint struct {
 type MetricResult struct {
 	Metrics         []MetricPoint `json:"metrics"`
 	LatestTimestamp time.Time     `json:"latestTimestamp"`
+	// Continue is set on paged historical results which were cut short by the page limit.
+	// Passing it back as the `continue` query parameter fetches the next page.
+	Continue string `json:"continue,omitempty"`
+	// Previous is set on model results requested with a `compare` offset. It holds the window
+	// shifted back by the offset, with timestamps moved forward by the offset to match Metrics.
+	Previous *MetricResult `json:"previous,omitempty"`
 }
 
 type MetricResultList struct {
@@ -61,3 +67,39 @@ type ExternalEntityListEntry struct {
 	CPUUsage uint64 `json:"cpuUsage"`
 	MemUsage uint64 `json:"memUsage"`
 }
+
+// An Event is a Kubernetes event involving a model entity.
+type Event struct {
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`
+	Reason         string    `json:"reason"`
+	Message        string    `json:"message"`
+	Count          int32     `json:"count"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+}
+
+// An Involvement joins the events of a model entity (a Pod or a Node) with its metrics
+// in the same time range.
+type Involvement struct {
+	// The key of the entity, as returned by /debug/allkeys.
+	Key     string                  `json:"key"`
+	Start   time.Time               `json:"start"`
+	End     time.Time               `json:"end"`
+	Events  []Event                 `json:"events"`
+	Metrics map[string]MetricResult `json:"metrics"`
+}
+
+// Completeness is the share of the cluster covered by the latest data batch of the model.
+type Completeness struct {
+	Timestamp     time.Time `json:"timestamp"`
+	NodesScraped  int       `json:"nodesScraped"`
+	NodesExpected int       `json:"nodesExpected"`
+	NodeRatio     float64   `json:"nodeRatio"`
+	PodsCovered   int       `json:"podsCovered"`
+	PodsRunning   int       `json:"podsRunning"`
+	PodRatio      float64   `json:"podRatio"`
+	// Whether the batch is below the minimum completeness set by --min_completeness.
+	Degraded bool `json:"degraded"`
+}
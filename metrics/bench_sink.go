@@ -0,0 +1,75 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/metrics/sinks"
+)
+
+// Name of the subcommand benchmarking a sink.
+const benchSinkCommand = "bench-sink"
+
+// Exports synthetic batches to the sink given in the arguments at a target rate, and prints the
+// achieved throughput, the latencies and the errors of the exports. Helps sizing a sink before
+// pointing heapster at it.
+func runBenchSink(args []string) error {
+	fs := pflag.NewFlagSet(benchSinkCommand, pflag.ContinueOnError)
+	sinkUri := fs.String("sink", "", "sink to benchmark, with the same options as heapster's --sink")
+	opts := sinks.BenchmarkOptions{}
+	fs.Float64Var(&opts.Rate, "rate", 1, "batches per second exported to the sink")
+	fs.DurationVar(&opts.Duration, "duration", time.Minute, "duration of the benchmark")
+	fs.IntVar(&opts.Nodes, "nodes", 10, "number of nodes of the synthetic batches")
+	fs.IntVar(&opts.PodsPerNode, "pods", 30, "number of pods per node of the synthetic batches")
+	fs.IntVar(&opts.ContainersPerPod, "containers", 2, "number of containers per pod of the synthetic batches")
+	fs.IntVar(&opts.Concurrency, "concurrency", 1, "maximum number of batches exported at the same time")
+	if err := fs.Parse(args); err == pflag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if *sinkUri == "" {
+		return errors.New("--sink is required")
+	}
+	if opts.Rate <= 0 || opts.Duration <= 0 || opts.Concurrency < 1 {
+		return errors.New("--rate and --duration must be positive, --concurrency at least 1")
+	}
+	if opts.Nodes < 0 || opts.PodsPerNode < 0 || opts.ContainersPerPod < 0 {
+		return errors.New("--nodes, --pods and --containers can't be negative")
+	}
+
+	var uri flags.Uri
+	if err := uri.Set(*sinkUri); err != nil {
+		return err
+	}
+	sink, err := sinks.NewBenchmarkSink(sinks.NewSinkFactory(), uri)
+	if err != nil {
+		return fmt.Errorf("failed to create sink: %v", err)
+	}
+	defer sink.Stop()
+
+	report, err := sinks.Benchmark(sink, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(report)
+	return nil
+}
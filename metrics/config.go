@@ -0,0 +1,103 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/options"
+	"k8s.io/heapster/metrics/sinks"
+	"k8s.io/heapster/version"
+)
+
+// Words in the names of the flags holding secrets.
+var secretFlagWords = []string{"password", "token", "secret"}
+
+// RuntimeConfig is the effective configuration of a running heapster, with the secrets redacted.
+type RuntimeConfig struct {
+	Version          string   `json:"version"`
+	Sources          []string `json:"sources"`
+	Sinks            []string `json:"sinks"`
+	ReloadedSinks    []string `json:"reloadedSinks,omitempty"`
+	HistoricalSource string   `json:"historicalSource,omitempty"`
+	Processors       []string `json:"processors"`
+	MetricResolution string   `json:"metricResolution"`
+	// Values of all the flags, including the ones enabling features.
+	Flags map[string]string `json:"flags"`
+}
+
+// Builds the configuration from the options and the flags they were parsed from, the processors
+// and the watcher of the sink configuration file, which may be nil.
+type runtimeConfig struct {
+	opt        *options.HeapsterRunOptions
+	flagSet    *pflag.FlagSet
+	processors []core.DataProcessor
+	watcher    *sinks.SinkConfigWatcher
+}
+
+// Config returns the current configuration. Only the sinks of the configuration file change
+// after startup.
+func (this *runtimeConfig) Config() RuntimeConfig {
+	config := RuntimeConfig{
+		Version:          version.HeapsterVersion,
+		Sources:          this.opt.Sources.Redacted(),
+		Sinks:            this.opt.Sinks.Redacted(),
+		HistoricalSource: redactedUri(this.opt.HistoricalSource),
+		Processors:       make([]string, 0, len(this.processors)),
+		MetricResolution: this.opt.MetricResolution.String(),
+		Flags:            make(map[string]string),
+	}
+	if this.watcher != nil {
+		config.ReloadedSinks = this.watcher.Uris()
+	}
+	for _, processor := range this.processors {
+		config.Processors = append(config.Processors, processor.Name())
+	}
+	this.flagSet.VisitAll(func(f *pflag.Flag) {
+		config.Flags[f.Name] = redactedFlag(f)
+	})
+	return config
+}
+
+// Returns the value of the flag, with the secrets of its uris redacted or fully redacted if its
+// name tells it's a secret.
+func redactedFlag(f *pflag.Flag) string {
+	if uris, ok := f.Value.(*flags.Uris); ok {
+		return strings.Join(uris.Redacted(), ",")
+	}
+	name := strings.ToLower(f.Name)
+	for _, word := range secretFlagWords {
+		if strings.Contains(name, word) && f.Value.String() != "" {
+			return "REDACTED"
+		}
+	}
+	return f.Value.String()
+}
+
+// Returns the uri with its secrets redacted, or an empty string if it's empty or isn't a uri.
+func redactedUri(value string) string {
+	if value == "" {
+		return ""
+	}
+	var uri flags.Uri
+	if err := uri.Set(value); err != nil {
+		return ""
+	}
+	return uri.Redacted()
+}
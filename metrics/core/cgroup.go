@@ -0,0 +1,65 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	cadvisor "github.com/google/cadvisor/info/v1"
+)
+
+const (
+	CgroupV1 = "v1"
+	CgroupV2 = "v2"
+)
+
+// DetectCgroupVersion tells the cgroup hierarchy a node runs from the stats of its root
+// container. cAdvisor reads pressure stall information only from cgroup v2, and per-cpu usage
+// only from the cpuacct controller of cgroup v1. Returns an empty string if the stats report
+// neither, e.g. on a cgroup v2 node with a kernel or cAdvisor without pressure stall information.
+func DetectCgroupVersion(stat *cadvisor.ContainerStats, pressure bool) string {
+	if stat == nil {
+		return ""
+	}
+	if pressure {
+		return CgroupV2
+	}
+	if len(stat.Cpu.Usage.PerCpu) > 0 {
+		return CgroupV1
+	}
+	return ""
+}
+
+// NormalizeCgroupStats rewrites stats read from a cgroup v2 hierarchy in place so that
+// they carry the cgroup v1 meaning the standard metrics are defined with:
+//   - memory.stat is hierarchical on cgroup v2, so the page fault counters are reported
+//     by whichever of the container and hierarchical data the kubelet filled in;
+//   - a working set that could not be computed because memory.stat has no
+//     total_inactive_file falls back to the usage, as cAdvisor itself does.
+//
+// Stats of any other cgroup version are left untouched.
+func NormalizeCgroupStats(version string, stat *cadvisor.ContainerStats) {
+	if version != CgroupV2 || stat == nil {
+		return
+	}
+	memory := &stat.Memory
+	if memory.ContainerData.Pgfault == 0 && memory.ContainerData.Pgmajfault == 0 {
+		memory.ContainerData = memory.HierarchicalData
+	}
+	if memory.HierarchicalData.Pgfault == 0 && memory.HierarchicalData.Pgmajfault == 0 {
+		memory.HierarchicalData = memory.ContainerData
+	}
+	if memory.WorkingSet == 0 {
+		memory.WorkingSet = memory.Usage
+	}
+}
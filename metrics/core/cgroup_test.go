@@ -0,0 +1,63 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectCgroupVersion(t *testing.T) {
+	v1 := &cadvisor.ContainerStats{
+		Cpu: cadvisor.CpuStats{Usage: cadvisor.CpuUsage{Total: 100, PerCpu: []uint64{40, 60}}},
+	}
+	assert.Equal(t, CgroupV1, DetectCgroupVersion(v1, false))
+
+	v2 := &cadvisor.ContainerStats{
+		Cpu: cadvisor.CpuStats{Usage: cadvisor.CpuUsage{Total: 100}},
+	}
+	assert.Equal(t, CgroupV2, DetectCgroupVersion(v2, true))
+
+	// Missing per-cpu usage alone doesn't tell, e.g. cpuacct may not be mounted.
+	assert.Equal(t, "", DetectCgroupVersion(v2, false))
+	assert.Equal(t, "", DetectCgroupVersion(&cadvisor.ContainerStats{}, false))
+	assert.Equal(t, "", DetectCgroupVersion(nil, true))
+}
+
+func TestNormalizeCgroupStats(t *testing.T) {
+	stat := &cadvisor.ContainerStats{}
+	stat.Memory.Usage = 200
+	stat.Memory.HierarchicalData.Pgfault = 10
+	stat.Memory.HierarchicalData.Pgmajfault = 1
+
+	NormalizeCgroupStats(CgroupV1, stat)
+	assert.Equal(t, uint64(0), stat.Memory.WorkingSet)
+	assert.Equal(t, uint64(0), stat.Memory.ContainerData.Pgfault)
+
+	NormalizeCgroupStats(CgroupV2, stat)
+	assert.Equal(t, uint64(200), stat.Memory.WorkingSet)
+	assert.Equal(t, uint64(10), stat.Memory.ContainerData.Pgfault)
+	assert.Equal(t, uint64(1), stat.Memory.ContainerData.Pgmajfault)
+
+	stat = &cadvisor.ContainerStats{}
+	stat.Memory.Usage = 200
+	stat.Memory.WorkingSet = 150
+	stat.Memory.ContainerData.Pgfault = 10
+	NormalizeCgroupStats(CgroupV2, stat)
+	assert.Equal(t, uint64(150), stat.Memory.WorkingSet)
+	assert.Equal(t, uint64(10), stat.Memory.HierarchicalData.Pgfault)
+}
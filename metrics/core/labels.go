@@ -19,7 +19,7 @@ package core
 var (
 	LabelMetricSetType = LabelDescriptor{
 		Key:         "type",
-		Description: "Type of the metrics set (container, pod, namespace, node, cluster)",
+		Description: "Type of the metrics set (container, pod, namespace, node, cluster, qos, cronjob, deployment, daemonset, job, canary)",
 	}
 	MetricSetTypeSystemContainer = "sys_container"
 	MetricSetTypePodContainer    = "pod_container"
@@ -27,6 +27,12 @@ var (
 	MetricSetTypeNamespace       = "ns"
 	MetricSetTypeNode            = "node"
 	MetricSetTypeCluster         = "cluster"
+	MetricSetTypeQOS             = "qos"
+	MetricSetTypeCronJob         = "cronjob"
+	MetricSetTypeDeployment      = "deployment"
+	MetricSetTypeDaemonSet       = "daemonset"
+	MetricSetTypeJob             = "job"
+	MetricSetTypeCanary          = "canary"
 
 	LabelPodId = LabelDescriptor{
 		Key:         "pod_id",
@@ -45,6 +51,30 @@ var (
 		Key:         "namespace_name",
 		Description: "The name of the namespace",
 	}
+	LabelQOSClass = LabelDescriptor{
+		Key:         "qos_class",
+		Description: "The QoS class of the pod: Guaranteed, Burstable or BestEffort",
+	}
+	LabelJobName = LabelDescriptor{
+		Key:         "job_name",
+		Description: "The name of the job that created the pod",
+	}
+	LabelCronJobName = LabelDescriptor{
+		Key:         "cronjob_name",
+		Description: "The name of the cron job that created the job of the pod",
+	}
+	LabelDeploymentName = LabelDescriptor{
+		Key:         "deployment_name",
+		Description: "The name of the deployment",
+	}
+	LabelDaemonSetName = LabelDescriptor{
+		Key:         "daemonset_name",
+		Description: "The name of the daemon set",
+	}
+	LabelExitCode = LabelDescriptor{
+		Key:         "exit_code",
+		Description: "Exit code of a terminated container",
+	}
 	LabelPodNamespaceUID = LabelDescriptor{
 		Key:         "namespace_id",
 		Description: "The UID of namespace of the pod",
@@ -73,6 +103,26 @@ var (
 		Key:         "host_id",
 		Description: "Identifier specific to a host. Set by cloud provider or user",
 	}
+	LabelCloudProvider = LabelDescriptor{
+		Key:         "cloud_provider",
+		Description: "Cloud provider of the node: gce, aws or azure",
+	}
+	LabelInstanceType = LabelDescriptor{
+		Key:         "instance_type",
+		Description: "Cloud instance type of the node",
+	}
+	LabelZone = LabelDescriptor{
+		Key:         "zone",
+		Description: "Cloud zone of the node",
+	}
+	LabelCapacityType = LabelDescriptor{
+		Key:         "capacity_type",
+		Description: "Whether the node is a spot (or preemptible) or an on_demand instance",
+	}
+	LabelCgroupVersion = LabelDescriptor{
+		Key:         "cgroup_version",
+		Description: "Version of the cgroup hierarchy of the node (v1 or v2)",
+	}
 	LabelContainerBaseImage = LabelDescriptor{
 		Key:         "container_base_image",
 		Description: "User-defined image name that is run inside the container",
@@ -82,6 +132,10 @@ var (
 		Key:         "custom_metric_name",
 		Description: "User-defined name of the exported custom metric",
 	}
+	LabelClusterName = LabelDescriptor{
+		Key:         "cluster_name",
+		Description: "The name of the cluster, when several clusters are federated",
+	}
 	LabelGCEResourceID = LabelDescriptor{
 		Key:         "resource_id",
 		Description: "Resource id for nodes specific for GCE.",
@@ -104,6 +158,7 @@ var commonLabels = []LabelDescriptor{
 	LabelNodename,
 	LabelHostname,
 	LabelHostID,
+	LabelClusterName,
 }
 
 var containerLabels = []LabelDescriptor{
@@ -117,6 +172,7 @@ var podLabels = []LabelDescriptor{
 	LabelPodNamespace,
 	LabelPodNamespaceUID,
 	LabelLabels,
+	LabelQOSClass,
 }
 
 var metricLabels = []LabelDescriptor{
@@ -28,6 +28,9 @@ const (
 var StandardMetrics = []Metric{
 	MetricUptime,
 	MetricCpuUsage,
+	MetricCpuQuota,
+	MetricCpuPeriod,
+	MetricCpuShares,
 	MetricMemoryUsage,
 	MetricMemoryWorkingSet,
 	MetricMemoryPageFaults,
@@ -42,7 +45,8 @@ var AdditionalMetrics = []Metric{
 	MetricCpuRequest,
 	MetricCpuLimit,
 	MetricMemoryRequest,
-	MetricMemoryLimit}
+	MetricMemoryLimit,
+	MetricMemoryLimitUtilization}
 
 // Computed based on corresponding StandardMetrics.
 var RateMetrics = []Metric{
@@ -52,7 +56,8 @@ var RateMetrics = []Metric{
 	MetricNetworkRxRate,
 	MetricNetworkRxErrorsRate,
 	MetricNetworkTxRate,
-	MetricNetworkTxErrorsRate}
+	MetricNetworkTxErrorsRate,
+	MetricFilesystemUsageRate}
 
 var RateMetricsMapping = map[string]Metric{
 	MetricCpuUsage.MetricDescriptor.Name:              MetricCpuUsageRate,
@@ -61,12 +66,87 @@ var RateMetricsMapping = map[string]Metric{
 	MetricNetworkRx.MetricDescriptor.Name:             MetricNetworkRxRate,
 	MetricNetworkRxErrors.MetricDescriptor.Name:       MetricNetworkRxErrorsRate,
 	MetricNetworkTx.MetricDescriptor.Name:             MetricNetworkTxRate,
-	MetricNetworkTxErrors.MetricDescriptor.Name:       MetricNetworkTxErrorsRate}
+	MetricNetworkTxErrors.MetricDescriptor.Name:       MetricNetworkTxErrorsRate,
+	MetricFilesystemUsage.MetricDescriptor.Name:       MetricFilesystemUsageRate,
+	MetricNumaCpuUsage.MetricDescriptor.Name:          MetricNumaCpuUsageRate}
+
+// Estimates of the time left before a resource runs out, computed from the trend of its usage.
+var PredictionMetrics = []Metric{
+	MetricMemoryTimeToOOM,
+	MetricFilesystemTimeToDiskPressure,
+}
 
 var LabeledMetrics = []Metric{
 	MetricFilesystemUsage,
 	MetricFilesystemLimit,
 	MetricFilesystemAvailable,
+	MetricFilesystemInodeUtilization,
+}
+
+// Health of the storage devices of the nodes, reported by a node plugin as custom metrics.
+var DiskMetrics = []Metric{
+	MetricDiskHealthStatus,
+	MetricDiskTemperature,
+}
+
+// Names of the custom metrics holding the health of the storage devices, by metric they're
+// stored as.
+var DiskCustomMetrics = map[string]Metric{
+	"disk_health_status": MetricDiskHealthStatus,
+	"disk_temperature":   MetricDiskTemperature,
+}
+
+// Usage of the NUMA nodes of the nodes, computed from the topology of the machine.
+var NumaMetrics = []Metric{
+	MetricNumaCpuUsage,
+	MetricNumaCpuUsageRate,
+	MetricNumaMemoryUsage,
+	MetricNumaMemoryCapacity,
+}
+
+// Run durations of the containers of the job pods, set once when they terminate.
+var JobMetrics = []Metric{
+	MetricContainerRunDuration,
+}
+
+// Share of the network traffic of the nodes not attributed to their pods, to detect the network
+// configurations hiding the traffic of the pods.
+var NetworkAttributionMetrics = []Metric{
+	MetricNetworkAttributionGap,
+}
+
+// Process limits of the nodes, from the summary API of the kubelets.
+var ProcessMetrics = []Metric{
+	MetricProcessMax,
+	MetricProcessCount,
+}
+
+// Problems of the nodes reported by the node problem detector.
+var NodeProblemMetrics = []Metric{
+	MetricNodeProblem,
+	MetricNodeProblemEvents,
+}
+
+// State of the workloads, from the Kubernetes API.
+var WorkloadMetrics = []Metric{
+	MetricDeploymentReplicasDesired,
+	MetricDeploymentReplicasAvailable,
+	MetricDeploymentReplicasUpdated,
+	MetricDeploymentReplicasUnavailable,
+	MetricDaemonSetScheduledDesired,
+	MetricDaemonSetScheduledCurrent,
+	MetricDaemonSetMisscheduled,
+	MetricDaemonSetReady,
+	MetricJobCompletionsDesired,
+	MetricJobActive,
+	MetricJobSucceeded,
+	MetricJobFailed,
+}
+
+// Metrics of the synthetic canary series.
+var CanaryMetrics = []Metric{
+	MetricCanaryValue,
+	MetricCanaryTimestamp,
 }
 
 var NodeAutoscalingMetrics = []Metric{
@@ -82,7 +162,10 @@ var NodeAutoscalingMetrics = []Metric{
 
 var CpuMetrics = []Metric{
 	MetricCpuLimit,
+	MetricCpuPeriod,
+	MetricCpuQuota,
 	MetricCpuRequest,
+	MetricCpuShares,
 	MetricCpuUsage,
 	MetricCpuUsageRate,
 	MetricNodeCpuAllocatable,
@@ -92,16 +175,21 @@ var CpuMetrics = []Metric{
 }
 var FilesystemMetrics = []Metric{
 	MetricFilesystemAvailable,
+	MetricFilesystemInodeUtilization,
 	MetricFilesystemLimit,
+	MetricFilesystemTimeToDiskPressure,
 	MetricFilesystemUsage,
+	MetricFilesystemUsageRate,
 }
 var MemoryMetrics = []Metric{
 	MetricMemoryLimit,
+	MetricMemoryLimitUtilization,
 	MetricMemoryMajorPageFaults,
 	MetricMemoryMajorPageFaultsRate,
 	MetricMemoryPageFaults,
 	MetricMemoryPageFaultsRate,
 	MetricMemoryRequest,
+	MetricMemoryTimeToOOM,
 	MetricMemoryUsage,
 	MetricMemoryWorkingSet,
 	MetricNodeMemoryAllocatable,
@@ -118,6 +206,7 @@ var NetworkMetrics = []Metric{
 	MetricNetworkTxErrors,
 	MetricNetworkTxErrorsRate,
 	MetricNetworkTxRate,
+	MetricNetworkAttributionGap,
 }
 
 type MetricFamily string
@@ -148,8 +237,8 @@ func MetricFamilyForName(metricName string) MetricFamily {
 	return MetricFamilyGeneral
 }
 
-var AllMetrics = append(append(append(append(StandardMetrics, AdditionalMetrics...), RateMetrics...), LabeledMetrics...),
-	NodeAutoscalingMetrics...)
+var AllMetrics = append(append(append(append(append(append(append(append(append(append(append(append(append(StandardMetrics, AdditionalMetrics...), RateMetrics...), LabeledMetrics...),
+	NodeAutoscalingMetrics...), PredictionMetrics...), DiskMetrics...), NumaMetrics...), JobMetrics...), NetworkAttributionMetrics...), ProcessMetrics...), NodeProblemMetrics...), WorkloadMetrics...), CanaryMetrics...)
 
 // Definition of Standard Metrics.
 var MetricUptime = Metric{
@@ -190,6 +279,63 @@ var MetricCpuUsage = Metric{
 	},
 }
 
+var MetricCpuQuota = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "cpu/quota",
+		Description: "CFS quota of the container in microseconds per CFS period",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+	HasValue: func(spec *cadvisor.ContainerSpec) bool {
+		return spec.HasCpu && spec.Cpu.Quota > 0
+	},
+	GetValue: func(spec *cadvisor.ContainerSpec, stat *cadvisor.ContainerStats) MetricValue {
+		return MetricValue{
+			ValueType:  ValueInt64,
+			MetricType: MetricGauge,
+			IntValue:   int64(spec.Cpu.Quota)}
+	},
+}
+
+var MetricCpuPeriod = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "cpu/period",
+		Description: "CFS period of the container in microseconds",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+	HasValue: func(spec *cadvisor.ContainerSpec) bool {
+		return spec.HasCpu && spec.Cpu.Period > 0
+	},
+	GetValue: func(spec *cadvisor.ContainerSpec, stat *cadvisor.ContainerStats) MetricValue {
+		return MetricValue{
+			ValueType:  ValueInt64,
+			MetricType: MetricGauge,
+			IntValue:   int64(spec.Cpu.Period)}
+	},
+}
+
+var MetricCpuShares = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "cpu/shares",
+		Description: "Relative CPU weight (cgroup cpu shares) of the container",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+	HasValue: func(spec *cadvisor.ContainerSpec) bool {
+		return spec.HasCpu && spec.Cpu.Limit > 0
+	},
+	GetValue: func(spec *cadvisor.ContainerSpec, stat *cadvisor.ContainerStats) MetricValue {
+		return MetricValue{
+			ValueType:  ValueInt64,
+			MetricType: MetricGauge,
+			IntValue:   int64(spec.Cpu.Limit)}
+	},
+}
+
 var MetricMemoryUsage = Metric{
 	MetricDescriptor: MetricDescriptor{
 		Name:        "memory/usage",
@@ -281,7 +427,7 @@ var MetricNetworkRx = Metric{
 		return MetricValue{
 			ValueType:  ValueInt64,
 			MetricType: MetricCumulative,
-			IntValue:   int64(stat.Network.RxBytes)}
+			IntValue:   int64(getNetworkStats(stat).RxBytes)}
 	},
 }
 
@@ -300,7 +446,7 @@ var MetricNetworkRxErrors = Metric{
 		return MetricValue{
 			ValueType:  ValueInt64,
 			MetricType: MetricCumulative,
-			IntValue:   int64(stat.Network.RxErrors)}
+			IntValue:   int64(getNetworkStats(stat).RxErrors)}
 	},
 }
 
@@ -319,7 +465,7 @@ var MetricNetworkTx = Metric{
 		return MetricValue{
 			ValueType:  ValueInt64,
 			MetricType: MetricCumulative,
-			IntValue:   int64(stat.Network.TxBytes)}
+			IntValue:   int64(getNetworkStats(stat).TxBytes)}
 	},
 }
 
@@ -338,7 +484,7 @@ var MetricNetworkTxErrors = Metric{
 		return MetricValue{
 			ValueType:  ValueInt64,
 			MetricType: MetricCumulative,
-			IntValue:   int64(stat.Network.TxErrors)}
+			IntValue:   int64(getNetworkStats(stat).TxErrors)}
 	},
 }
 
@@ -383,6 +529,38 @@ var MetricMemoryLimit = Metric{
 	},
 }
 
+var MetricMemoryLimitUtilization = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "memory/limit_utilization",
+		Description: "Memory working set as a share of the memory limit of the container",
+		Type:        MetricGauge,
+		ValueType:   ValueFloat,
+		Units:       UnitsCount,
+	},
+}
+
+// Definition of Prediction Metrics.
+var MetricMemoryTimeToOOM = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "memory/time_to_oom",
+		Description: "Estimated number of seconds before the memory working set of the container reaches its memory limit",
+		Type:        MetricGauge,
+		ValueType:   ValueFloat,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricFilesystemTimeToDiskPressure = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "filesystem/time_to_disk_pressure",
+		Description: "Estimated number of seconds before the available bytes of a node filesystem fall below the disk pressure threshold",
+		Type:        MetricGauge,
+		ValueType:   ValueFloat,
+		Units:       UnitsCount,
+		Labels:      metricLabels,
+	},
+}
+
 // Definition of Rate Metrics.
 var MetricCpuUsageRate = Metric{
 	MetricDescriptor: MetricDescriptor{
@@ -444,6 +622,36 @@ var MetricNetworkTxRate = Metric{
 	},
 }
 
+var MetricNetworkAttributionGap = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "network/attribution_gap",
+		Description: "Share of the bytes received and transmitted by a node, or by all the nodes, which are not attributed to its pods",
+		Type:        MetricGauge,
+		ValueType:   ValueFloat,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricProcessMax = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "process/max",
+		Description: "Maximum number of processes the node can run, its pid limit",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricProcessCount = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "process/count",
+		Description: "Number of processes running on the node",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
 var MetricNetworkTxErrorsRate = Metric{
 	MetricDescriptor: MetricDescriptor{
 		Name:        "network/tx_errors_rate",
@@ -567,6 +775,17 @@ var MetricFilesystemUsage = Metric{
 	},
 }
 
+var MetricFilesystemUsageRate = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "filesystem/usage_rate",
+		Description: "Rate of growth of the bytes consumed on a filesystem in bytes per second",
+		Type:        MetricGauge,
+		ValueType:   ValueFloat,
+		Units:       UnitsBytes,
+		Labels:      metricLabels,
+	},
+}
+
 var MetricFilesystemLimit = Metric{
 	MetricDescriptor: MetricDescriptor{
 		Name:        "filesystem/limit",
@@ -609,6 +828,287 @@ var MetricFilesystemAvailable = Metric{
 	},
 }
 
+var MetricFilesystemInodeUtilization = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "filesystem/inode_utilization",
+		Description: "The share of inodes used on a filesystem",
+		Type:        MetricGauge,
+		ValueType:   ValueFloat,
+		Units:       UnitsCount,
+		Labels:      metricLabels,
+	},
+	HasLabeledMetric: func(spec *cadvisor.ContainerSpec) bool {
+		return spec.HasFilesystem
+	},
+	GetLabeledMetric: func(spec *cadvisor.ContainerSpec, stat *cadvisor.ContainerStats) []LabeledMetric {
+		result := make([]LabeledMetric, 0, len(stat.Filesystem))
+		for _, fs := range stat.Filesystem {
+			if !fs.HasInodes || fs.Inodes == 0 {
+				continue
+			}
+			result = append(result, LabeledMetric{
+				Name: "filesystem/inode_utilization",
+				Labels: map[string]string{
+					LabelResourceID.Key: fs.Device,
+				},
+				MetricValue: MetricValue{
+					ValueType:  ValueFloat,
+					MetricType: MetricGauge,
+					FloatValue: InodeUtilization(fs.Inodes, fs.InodesFree),
+				},
+			})
+		}
+		return result
+	},
+}
+
+var MetricDiskHealthStatus = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "disk/health_status",
+		Description: "SMART overall health of a storage device of the node, 1 if passed and 0 if failing",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+		Labels:      metricLabels,
+	},
+}
+
+var MetricDiskTemperature = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "disk/temperature",
+		Description: "Temperature of a storage device of the node in degrees Celsius, as reported by SMART",
+		Type:        MetricGauge,
+		ValueType:   ValueFloat,
+		Units:       UnitsCount,
+		Labels:      metricLabels,
+	},
+}
+
+var MetricNumaCpuUsage = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "cpu/numa_usage",
+		Description: "Cumulative CPU usage of the cores of a NUMA node of the node",
+		Type:        MetricCumulative,
+		ValueType:   ValueInt64,
+		Units:       UnitsNanoseconds,
+		Labels:      metricLabels,
+	},
+}
+
+var MetricNumaCpuUsageRate = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "cpu/numa_usage_rate",
+		Description: "CPU usage of the cores of a NUMA node of the node in millicores",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+		Labels:      metricLabels,
+	},
+}
+
+var MetricNumaMemoryUsage = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "memory/numa_usage",
+		Description: "Memory of a NUMA node of the node in use, file, anonymous and unevictable pages, in bytes",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsBytes,
+		Labels:      metricLabels,
+	},
+}
+
+var MetricNumaMemoryCapacity = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "memory/numa_capacity",
+		Description: "Memory of a NUMA node of the node in bytes",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsBytes,
+		Labels:      metricLabels,
+	},
+}
+
+var MetricContainerRunDuration = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "container/run_duration",
+		Description: "Number of milliseconds a container of a job pod ran for, set when the container terminates",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsMilliseconds,
+		Labels:      []LabelDescriptor{LabelExitCode},
+	},
+}
+
+var MetricNodeProblem = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "node/problem",
+		Description: "Whether a permanent problem reported by the node problem detector affects the node, 1 if it does and 0 if not",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+		Labels:      metricLabels,
+	},
+}
+
+var MetricNodeProblemEvents = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "node/problem_events",
+		Description: "Cumulative number of temporary problems of a kind reported by the node problem detector on the node",
+		Type:        MetricCumulative,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+		Labels:      metricLabels,
+	},
+}
+
+var MetricDeploymentReplicasDesired = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "deployment/replicas_desired",
+		Description: "Number of replicas the deployment asks for",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricDeploymentReplicasAvailable = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "deployment/replicas_available",
+		Description: "Number of replicas of the deployment available for at least its minimum ready seconds",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricDeploymentReplicasUpdated = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "deployment/replicas_updated",
+		Description: "Number of replicas of the deployment running its current pod template",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricDeploymentReplicasUnavailable = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "deployment/replicas_unavailable",
+		Description: "Number of replicas the deployment still needs to be fully available",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricDaemonSetScheduledDesired = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "daemonset/scheduled_desired",
+		Description: "Number of nodes which should run a pod of the daemon set",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricDaemonSetScheduledCurrent = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "daemonset/scheduled_current",
+		Description: "Number of nodes running a pod of the daemon set which should",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricDaemonSetMisscheduled = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "daemonset/misscheduled",
+		Description: "Number of nodes running a pod of the daemon set which shouldn't",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricDaemonSetReady = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "daemonset/ready",
+		Description: "Number of running pods of the daemon set which are ready",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricJobCompletionsDesired = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "job/completions_desired",
+		Description: "Number of pods of the job which should complete successfully",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricJobActive = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "job/active",
+		Description: "Number of running pods of the job",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricJobSucceeded = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "job/succeeded",
+		Description: "Number of pods of the job which completed successfully",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricJobFailed = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "job/failed",
+		Description: "Number of pods of the job which failed",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricCanaryValue = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "canary/value",
+		Description: "Known value of the synthetic canary series, constant or a sawtooth going up by one every scrape",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsCount,
+	},
+}
+
+var MetricCanaryTimestamp = Metric{
+	MetricDescriptor: MetricDescriptor{
+		Name:        "canary/timestamp",
+		Description: "Time the canary point was generated in milliseconds since the epoch",
+		Type:        MetricGauge,
+		ValueType:   ValueInt64,
+		Units:       UnitsMilliseconds,
+	},
+}
+
+// Returns the share of used inodes given the total and free number of inodes.
+func InodeUtilization(inodes, inodesFree uint64) float32 {
+	if inodes == 0 || inodesFree > inodes {
+		return 0
+	}
+	return float32(inodes-inodesFree) / float32(inodes)
+}
+
 func IsNodeAutoscalingMetric(name string) bool {
 	for _, autoscalingMetric := range NodeAutoscalingMetrics {
 		if autoscalingMetric.MetricDescriptor.Name == name {
@@ -0,0 +1,42 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilesystemInodeUtilization(t *testing.T) {
+	spec := &cadvisor.ContainerSpec{HasFilesystem: true}
+	stat := &cadvisor.ContainerStats{
+		Filesystem: []cadvisor.FsStats{
+			{Device: "/dev/sda1", HasInodes: true, Inodes: 1000, InodesFree: 250},
+			{Device: "/dev/sda2", HasInodes: false},
+			{Device: "/dev/sda3", HasInodes: true, Inodes: 0},
+		},
+	}
+
+	assert.True(t, MetricFilesystemInodeUtilization.HasLabeledMetric(spec))
+	metrics := MetricFilesystemInodeUtilization.GetLabeledMetric(spec, stat)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "/dev/sda1", metrics[0].Labels[LabelResourceID.Key])
+	assert.Equal(t, ValueFloat, metrics[0].ValueType)
+	assert.InEpsilon(t, 0.75, metrics[0].FloatValue, 0.0001)
+
+	assert.Equal(t, float32(0), InodeUtilization(10, 20))
+}
@@ -15,34 +15,375 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
 )
 
-// MetricsSet keys inside of DataBatch. The structure of the returned string is
-// an implementation detail and no component should rely on it as it may change
-// anytime. It it only guaranteed that it is unique for the unique combination of
-// passed parameters.
+// MetricsSet keys inside of DataBatch. The keys are built by the active KeyScheme, the
+// default one unless SetKeyScheme was called. The format of the default scheme is stable:
+// downstream systems joining on the keys may rely on it. Entities are looked up by their
+// names, so a key is only guaranteed to be unique for the unique combination of passed
+// parameters.
+
+// KeyScheme builds the keys of the metric sets of the entities.
+type KeyScheme interface {
+	ClusterKey() string
+	NodeKey(node string) string
+	NodeContainerKey(node, container string) string
+	NamespaceKey(namespace string) string
+	PodKey(namespace, podName string) string
+	PodContainerKey(namespace, podName, containerName string) string
+	QOSKey(qosClass string) string
+	CronJobKey(namespace, cronJob string) string
+	DeploymentKey(namespace, deployment string) string
+	DaemonSetKey(namespace, daemonSet string) string
+	JobKey(namespace, job string) string
+}
+
+// The scheme building the keys, replaced at startup only.
+var keyScheme KeyScheme = DefaultKeyScheme{}
+
+// SetKeyScheme replaces the scheme building the keys of the metric sets. It must be called
+// before any metric set is created, as the keys of the previous scheme aren't found anymore.
+func SetKeyScheme(scheme KeyScheme) {
+	keyScheme = scheme
+}
 
 func PodContainerKey(namespace, podName, containerName string) string {
-	return fmt.Sprintf("namespace:%s/pod:%s/container:%s", namespace, podName, containerName)
+	return keyScheme.PodContainerKey(namespace, podName, containerName)
 }
 
 func PodKey(namespace, podName string) string {
-	return fmt.Sprintf("namespace:%s/pod:%s", namespace, podName)
+	return keyScheme.PodKey(namespace, podName)
 }
 
 func NamespaceKey(namespace string) string {
-	return fmt.Sprintf("namespace:%s", namespace)
+	return keyScheme.NamespaceKey(namespace)
 }
 
 func NodeKey(node string) string {
-	return fmt.Sprintf("node:%s", node)
+	return keyScheme.NodeKey(node)
 }
 
 func NodeContainerKey(node, container string) string {
-	return fmt.Sprintf("node:%s/container:%s", node, container)
+	return keyScheme.NodeContainerKey(node, container)
+}
+
+func QOSKey(qosClass string) string {
+	return keyScheme.QOSKey(qosClass)
+}
+
+func CronJobKey(namespace, cronJob string) string {
+	return keyScheme.CronJobKey(namespace, cronJob)
+}
+
+func DeploymentKey(namespace, deployment string) string {
+	return keyScheme.DeploymentKey(namespace, deployment)
+}
+
+func DaemonSetKey(namespace, daemonSet string) string {
+	return keyScheme.DaemonSetKey(namespace, daemonSet)
+}
+
+func JobKey(namespace, job string) string {
+	return keyScheme.JobKey(namespace, job)
+}
+
+func CanaryKey() string {
+	return "canary"
 }
 
 func ClusterKey() string {
+	return keyScheme.ClusterKey()
+}
+
+// The cluster whose metric sets keep their keys when several clusters are federated, set at
+// startup only. The keys of the other clusters are scoped by ClusterScopedKey.
+var primaryCluster string
+
+// SetPrimaryCluster sets the federated cluster whose keys aren't scoped, the one of the
+// Kubernetes API used by the processors.
+func SetPrimaryCluster(cluster string) {
+	primaryCluster = cluster
+}
+
+// IsPrimaryCluster returns whether the metric sets of the cluster keep their keys. The metric
+// sets without a cluster are all of the primary cluster.
+func IsPrimaryCluster(cluster string) bool {
+	return cluster == "" || cluster == primaryCluster
+}
+
+// ClusterScopedKey returns the key of a metric set of the cluster, prefixed like
+// `cluster:c1/namespace:ns1` unless the cluster is the primary one.
+func ClusterScopedKey(cluster, key string) string {
+	if IsPrimaryCluster(cluster) {
+		return key
+	}
+	return fmt.Sprintf("cluster:%s/%s", cluster, key)
+}
+
+// ScopedKey returns the key scoped by the cluster of the labels of a metric set, for the keys
+// of the metric sets aggregating it.
+func ScopedKey(labels map[string]string, key string) string {
+	return ClusterScopedKey(labels[LabelClusterName.Key], key)
+}
+
+// DefaultKeyScheme builds keys like `namespace:ns1/pod:pod1/container:c1`.
+type DefaultKeyScheme struct{}
+
+func (DefaultKeyScheme) ClusterKey() string {
 	return "cluster"
 }
+
+func (DefaultKeyScheme) NodeKey(node string) string {
+	return fmt.Sprintf("node:%s", node)
+}
+
+func (DefaultKeyScheme) NodeContainerKey(node, container string) string {
+	return fmt.Sprintf("node:%s/container:%s", node, container)
+}
+
+func (DefaultKeyScheme) NamespaceKey(namespace string) string {
+	return fmt.Sprintf("namespace:%s", namespace)
+}
+
+func (DefaultKeyScheme) PodKey(namespace, podName string) string {
+	return fmt.Sprintf("namespace:%s/pod:%s", namespace, podName)
+}
+
+func (DefaultKeyScheme) PodContainerKey(namespace, podName, containerName string) string {
+	return fmt.Sprintf("namespace:%s/pod:%s/container:%s", namespace, podName, containerName)
+}
+
+func (DefaultKeyScheme) QOSKey(qosClass string) string {
+	return fmt.Sprintf("qos:%s", qosClass)
+}
+
+func (DefaultKeyScheme) CronJobKey(namespace, cronJob string) string {
+	return fmt.Sprintf("namespace:%s/cronjob:%s", namespace, cronJob)
+}
+
+func (DefaultKeyScheme) DeploymentKey(namespace, deployment string) string {
+	return fmt.Sprintf("namespace:%s/deployment:%s", namespace, deployment)
+}
+
+func (DefaultKeyScheme) DaemonSetKey(namespace, daemonSet string) string {
+	return fmt.Sprintf("namespace:%s/daemonset:%s", namespace, daemonSet)
+}
+
+func (DefaultKeyScheme) JobKey(namespace, job string) string {
+	return fmt.Sprintf("namespace:%s/job:%s", namespace, job)
+}
+
+// KeyFields are the fields available to the key templates. Each entity only sets the fields
+// identifying it, e.g. Namespace and Pod for the pods.
+type KeyFields struct {
+	Node       string
+	Namespace  string
+	Pod        string
+	Container  string
+	QOSClass   string
+	CronJob    string
+	Deployment string
+	DaemonSet  string
+	Job        string
+}
+
+// Fields identifying the entities of each template, which the templates must all use so that
+// the keys stay unique.
+var keyTemplateFields = map[string][]string{
+	"cluster":       {},
+	"node":          {"Node"},
+	"nodeContainer": {"Node", "Container"},
+	"namespace":     {"Namespace"},
+	"pod":           {"Namespace", "Pod"},
+	"podContainer":  {"Namespace", "Pod", "Container"},
+	"qos":           {"QOSClass"},
+	"cronJob":       {"Namespace", "CronJob"},
+	"deployment":    {"Namespace", "Deployment"},
+	"daemonSet":     {"Namespace", "DaemonSet"},
+	"job":           {"Namespace", "Job"},
+}
+
+// TemplateKeyScheme builds the keys with Go templates of KeyFields, by entity. The entities
+// without a template get the keys of the default scheme.
+type TemplateKeyScheme struct {
+	templates map[string]*template.Template
+}
+
+// NewTemplateKeyScheme parses the templates, by entity: cluster, node, nodeContainer,
+// namespace, pod, podContainer, qos, cronJob, deployment, daemonSet or job. A template must use all the fields identifying
+// its entity, and the keys of different entities must differ.
+func NewTemplateKeyScheme(templates map[string]string) (*TemplateKeyScheme, error) {
+	scheme := &TemplateKeyScheme{templates: make(map[string]*template.Template)}
+	for entity, text := range templates {
+		fields, found := keyTemplateFields[entity]
+		if !found {
+			return nil, fmt.Errorf("unknown entity %q of key template", entity)
+		}
+		tmpl, err := template.New(entity).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key template of %s - %v", entity, err)
+		}
+		if err := tmpl.Execute(ioutil.Discard, sampleKeyFields("")); err != nil {
+			return nil, fmt.Errorf("invalid key template of %s - %v", entity, err)
+		}
+		scheme.templates[entity] = tmpl
+
+		// Every identifying field must change the key.
+		sample := scheme.key(entity, sampleKeyFields(""))
+		for _, field := range fields {
+			if scheme.key(entity, sampleKeyFields(field)) == sample {
+				return nil, fmt.Errorf("key template of %s doesn't use %s", entity, field)
+			}
+		}
+	}
+
+	// The entities are told apart by their keys.
+	entities := make(map[string]string)
+	for entity := range keyTemplateFields {
+		key := scheme.key(entity, sampleKeyFields(""))
+		if other, found := entities[key]; found {
+			names := []string{entity, other}
+			sort.Strings(names)
+			return nil, fmt.Errorf("keys of %s collide", strings.Join(names, " and "))
+		}
+		entities[key] = entity
+	}
+	return scheme, nil
+}
+
+// Returns fields with the same value for all, but the given one.
+func sampleKeyFields(changed string) KeyFields {
+	fields := KeyFields{"x", "x", "x", "x", "x", "x", "x", "x", "x"}
+	switch changed {
+	case "Node":
+		fields.Node = "y"
+	case "Namespace":
+		fields.Namespace = "y"
+	case "Pod":
+		fields.Pod = "y"
+	case "Container":
+		fields.Container = "y"
+	case "QOSClass":
+		fields.QOSClass = "y"
+	case "CronJob":
+		fields.CronJob = "y"
+	case "Deployment":
+		fields.Deployment = "y"
+	case "DaemonSet":
+		fields.DaemonSet = "y"
+	case "Job":
+		fields.Job = "y"
+	}
+	return fields
+}
+
+// LoadKeyScheme reads the templates of a TemplateKeyScheme from a YAML or JSON file mapping
+// the entities to their templates.
+func LoadKeyScheme(path string) (*TemplateKeyScheme, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	templates := make(map[string]string)
+	if err := yaml.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("failed to parse key templates %s - %v", path, err)
+	}
+	return NewTemplateKeyScheme(templates)
+}
+
+// Returns the key of the template of the entity, or of the default scheme if it has none.
+func (this *TemplateKeyScheme) key(entity string, fields KeyFields) string {
+	tmpl, found := this.templates[entity]
+	if !found {
+		return defaultEntityKey(entity, fields)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fields); err != nil {
+		// The templates were checked with sample fields, but functions like index may fail on others.
+		glog.Errorf("Failed to execute key template of %s, using the default key: %v", entity, err)
+		return defaultEntityKey(entity, fields)
+	}
+	return buf.String()
+}
+
+func defaultEntityKey(entity string, fields KeyFields) string {
+	scheme := DefaultKeyScheme{}
+	switch entity {
+	case "cluster":
+		return scheme.ClusterKey()
+	case "node":
+		return scheme.NodeKey(fields.Node)
+	case "nodeContainer":
+		return scheme.NodeContainerKey(fields.Node, fields.Container)
+	case "namespace":
+		return scheme.NamespaceKey(fields.Namespace)
+	case "pod":
+		return scheme.PodKey(fields.Namespace, fields.Pod)
+	case "podContainer":
+		return scheme.PodContainerKey(fields.Namespace, fields.Pod, fields.Container)
+	case "qos":
+		return scheme.QOSKey(fields.QOSClass)
+	case "cronJob":
+		return scheme.CronJobKey(fields.Namespace, fields.CronJob)
+	case "deployment":
+		return scheme.DeploymentKey(fields.Namespace, fields.Deployment)
+	case "daemonSet":
+		return scheme.DaemonSetKey(fields.Namespace, fields.DaemonSet)
+	case "job":
+		return scheme.JobKey(fields.Namespace, fields.Job)
+	}
+	return ""
+}
+
+func (this *TemplateKeyScheme) ClusterKey() string {
+	return this.key("cluster", KeyFields{})
+}
+
+func (this *TemplateKeyScheme) NodeKey(node string) string {
+	return this.key("node", KeyFields{Node: node})
+}
+
+func (this *TemplateKeyScheme) NodeContainerKey(node, container string) string {
+	return this.key("nodeContainer", KeyFields{Node: node, Container: container})
+}
+
+func (this *TemplateKeyScheme) NamespaceKey(namespace string) string {
+	return this.key("namespace", KeyFields{Namespace: namespace})
+}
+
+func (this *TemplateKeyScheme) PodKey(namespace, podName string) string {
+	return this.key("pod", KeyFields{Namespace: namespace, Pod: podName})
+}
+
+func (this *TemplateKeyScheme) PodContainerKey(namespace, podName, containerName string) string {
+	return this.key("podContainer", KeyFields{Namespace: namespace, Pod: podName, Container: containerName})
+}
+
+func (this *TemplateKeyScheme) QOSKey(qosClass string) string {
+	return this.key("qos", KeyFields{QOSClass: qosClass})
+}
+
+func (this *TemplateKeyScheme) CronJobKey(namespace, cronJob string) string {
+	return this.key("cronJob", KeyFields{Namespace: namespace, CronJob: cronJob})
+}
+
+func (this *TemplateKeyScheme) DeploymentKey(namespace, deployment string) string {
+	return this.key("deployment", KeyFields{Namespace: namespace, Deployment: deployment})
+}
+
+func (this *TemplateKeyScheme) DaemonSetKey(namespace, daemonSet string) string {
+	return this.key("daemonSet", KeyFields{Namespace: namespace, DaemonSet: daemonSet})
+}
+
+func (this *TemplateKeyScheme) JobKey(namespace, job string) string {
+	return this.key("job", KeyFields{Namespace: namespace, Job: job})
+}
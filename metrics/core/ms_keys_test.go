@@ -0,0 +1,92 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultKeys(t *testing.T) {
+	// Downstream systems join on these keys, they must not change.
+	assert.Equal(t, "cluster", ClusterKey())
+	assert.Equal(t, "node:n1", NodeKey("n1"))
+	assert.Equal(t, "node:n1/container:kubelet", NodeContainerKey("n1", "kubelet"))
+	assert.Equal(t, "namespace:ns1", NamespaceKey("ns1"))
+	assert.Equal(t, "namespace:ns1/pod:p1", PodKey("ns1", "p1"))
+	assert.Equal(t, "namespace:ns1/pod:p1/container:c1", PodContainerKey("ns1", "p1", "c1"))
+	assert.Equal(t, "qos:Burstable", QOSKey("Burstable"))
+	assert.Equal(t, "namespace:ns1/cronjob:backup", CronJobKey("ns1", "backup"))
+}
+
+func TestTemplateKeyScheme(t *testing.T) {
+	scheme, err := NewTemplateKeyScheme(map[string]string{
+		"cluster":      "prod",
+		"pod":          "prod/pod/{{.Namespace}}/{{.Pod}}",
+		"podContainer": "prod/container/{{.Namespace}}/{{.Pod}}/{{.Container}}",
+	})
+	require.NoError(t, err)
+	SetKeyScheme(scheme)
+	defer SetKeyScheme(DefaultKeyScheme{})
+
+	assert.Equal(t, "prod", ClusterKey())
+	assert.Equal(t, "prod/pod/ns1/p1", PodKey("ns1", "p1"))
+	assert.Equal(t, "prod/container/ns1/p1/c1", PodContainerKey("ns1", "p1", "c1"))
+	// The entities without a template keep the default keys.
+	assert.Equal(t, "node:n1", NodeKey("n1"))
+	assert.Equal(t, "namespace:ns1", NamespaceKey("ns1"))
+}
+
+func TestTemplateKeySchemeErrors(t *testing.T) {
+	for _, templates := range []map[string]string{
+		{"replicaSet": "{{.Namespace}}"},
+		{"pod": "{{.Namespace"},
+		{"pod": "{{.Uid}}"},
+		// Pods of different namespaces would share keys.
+		{"pod": "pod:{{.Pod}}"},
+		{"namespace": "node:{{.Namespace}}"},
+	} {
+		_, err := NewTemplateKeyScheme(templates)
+		assert.Error(t, err, "%v", templates)
+	}
+}
+
+func TestLoadKeyScheme(t *testing.T) {
+	file, err := ioutil.TempFile("", "keys")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("node: \"host/{{.Node}}\"\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	scheme, err := LoadKeyScheme(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "host/n1", scheme.NodeKey("n1"))
+}
+
+func TestClusterScopedKeys(t *testing.T) {
+	SetPrimaryCluster("c1")
+	defer SetPrimaryCluster("")
+
+	assert.Equal(t, "namespace:ns1", ClusterScopedKey("", NamespaceKey("ns1")))
+	assert.Equal(t, "namespace:ns1", ClusterScopedKey("c1", NamespaceKey("ns1")))
+	assert.Equal(t, "cluster:c2/namespace:ns1", ClusterScopedKey("c2", NamespaceKey("ns1")))
+	assert.Equal(t, "cluster:c2/cluster", ScopedKey(map[string]string{LabelClusterName.Key: "c2"}, ClusterKey()))
+	assert.Equal(t, "cluster", ScopedKey(map[string]string{}, ClusterKey()))
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"regexp"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	networkInterfaceInclude *regexp.Regexp
+	networkInterfaceExclude *regexp.Regexp
+)
+
+// SetNetworkInterfaceFilter restricts the interfaces taken into account by the network metrics.
+// An interface is counted if its name matches include (when set) and does not match exclude
+// (when set). Empty expressions disable the corresponding check.
+func SetNetworkInterfaceFilter(include, exclude string) error {
+	var err error
+	networkInterfaceInclude, err = compileInterfaceRegexp(include)
+	if err != nil {
+		return fmt.Errorf("invalid network interface include regexp %q: %v", include, err)
+	}
+	networkInterfaceExclude, err = compileInterfaceRegexp(exclude)
+	if err != nil {
+		return fmt.Errorf("invalid network interface exclude regexp %q: %v", exclude, err)
+	}
+	return nil
+}
+
+func compileInterfaceRegexp(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+func isNetworkInterfaceIncluded(name string) bool {
+	if networkInterfaceInclude != nil && !networkInterfaceInclude.MatchString(name) {
+		return false
+	}
+	if networkInterfaceExclude != nil && networkInterfaceExclude.MatchString(name) {
+		return false
+	}
+	return true
+}
+
+// Returns the network stats of the container. If no interface filter is set the stats reported
+// by cadvisor are used as is, otherwise the stats of all matching interfaces are summed up.
+func getNetworkStats(stat *cadvisor.ContainerStats) cadvisor.InterfaceStats {
+	if (networkInterfaceInclude == nil && networkInterfaceExclude == nil) || len(stat.Network.Interfaces) == 0 {
+		return stat.Network.InterfaceStats
+	}
+	result := cadvisor.InterfaceStats{}
+	for _, iface := range stat.Network.Interfaces {
+		if !isNetworkInterfaceIncluded(iface.Name) {
+			continue
+		}
+		result.RxBytes += iface.RxBytes
+		result.RxPackets += iface.RxPackets
+		result.RxErrors += iface.RxErrors
+		result.RxDropped += iface.RxDropped
+		result.TxBytes += iface.TxBytes
+		result.TxPackets += iface.TxPackets
+		result.TxErrors += iface.TxErrors
+		result.TxDropped += iface.TxDropped
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkInterfaceFilter(t *testing.T) {
+	defer SetNetworkInterfaceFilter("", "")
+
+	stat := &cadvisor.ContainerStats{
+		Network: cadvisor.NetworkStats{
+			InterfaceStats: cadvisor.InterfaceStats{Name: "eth0", RxBytes: 100, TxBytes: 10},
+			Interfaces: []cadvisor.InterfaceStats{
+				{Name: "eth0", RxBytes: 100, TxBytes: 10, RxErrors: 1},
+				{Name: "eth1", RxBytes: 200, TxBytes: 20, TxErrors: 2},
+				{Name: "lo", RxBytes: 1000, TxBytes: 1000},
+				{Name: "veth1234", RxBytes: 300, TxBytes: 30},
+				{Name: "cali5678", RxBytes: 400, TxBytes: 40},
+			},
+		},
+	}
+	spec := &cadvisor.ContainerSpec{HasNetwork: true}
+
+	// No filter - stats reported by cadvisor are used.
+	assert.NoError(t, SetNetworkInterfaceFilter("", ""))
+	assert.Equal(t, int64(100), MetricNetworkRx.GetValue(spec, stat).IntValue)
+
+	assert.NoError(t, SetNetworkInterfaceFilter("", "^(lo|veth.*|cali.*)$"))
+	assert.Equal(t, int64(300), MetricNetworkRx.GetValue(spec, stat).IntValue)
+	assert.Equal(t, int64(30), MetricNetworkTx.GetValue(spec, stat).IntValue)
+	assert.Equal(t, int64(1), MetricNetworkRxErrors.GetValue(spec, stat).IntValue)
+	assert.Equal(t, int64(2), MetricNetworkTxErrors.GetValue(spec, stat).IntValue)
+
+	assert.NoError(t, SetNetworkInterfaceFilter("^eth", "^eth1$"))
+	assert.Equal(t, int64(100), MetricNetworkRx.GetValue(spec, stat).IntValue)
+
+	assert.Error(t, SetNetworkInterfaceFilter("(", ""))
+	assert.Error(t, SetNetworkInterfaceFilter("", "("))
+}
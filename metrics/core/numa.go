@@ -0,0 +1,66 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+)
+
+// NumaNodeID returns the resource id of the metrics of a NUMA node, named like in sysfs.
+func NumaNodeID(id int) string {
+	return fmt.Sprintf("node%d", id)
+}
+
+// NumaMetricValues returns the metrics of every NUMA node of the topology of a node: its memory
+// capacity, the usage of its cores summed from the per-cpu usage of the root container, unless the
+// node doesn't report it like on cgroup v2, and its memory usage if known.
+func NumaMetricValues(topology []cadvisor.Node, stat *cadvisor.ContainerStats, memoryUsage map[int]uint64) []LabeledMetric {
+	result := []LabeledMetric{}
+	for _, node := range topology {
+		if node.Memory > 0 {
+			result = append(result, newNumaMetric(MetricNumaMemoryCapacity, node.Id, int64(node.Memory)))
+		}
+		if usage, found := memoryUsage[node.Id]; found {
+			result = append(result, newNumaMetric(MetricNumaMemoryUsage, node.Id, int64(usage)))
+		}
+		if stat == nil || len(stat.Cpu.Usage.PerCpu) == 0 {
+			continue
+		}
+		var cpuUsage uint64
+		for _, core := range node.Cores {
+			for _, thread := range core.Threads {
+				if thread >= 0 && thread < len(stat.Cpu.Usage.PerCpu) {
+					cpuUsage += stat.Cpu.Usage.PerCpu[thread]
+				}
+			}
+		}
+		result = append(result, newNumaMetric(MetricNumaCpuUsage, node.Id, int64(cpuUsage)))
+	}
+	return result
+}
+
+func newNumaMetric(metric Metric, id int, value int64) LabeledMetric {
+	return LabeledMetric{
+		Name:   metric.Name,
+		Labels: map[string]string{LabelResourceID.Key: NumaNodeID(id)},
+		MetricValue: MetricValue{
+			MetricType: metric.Type,
+			ValueType:  ValueInt64,
+			IntValue:   value,
+		},
+	}
+}
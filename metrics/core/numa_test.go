@@ -0,0 +1,85 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+var testTopology = []cadvisor.Node{
+	{
+		Id:     0,
+		Memory: 1000,
+		Cores: []cadvisor.Core{
+			{Id: 0, Threads: []int{0, 2}},
+			{Id: 1, Threads: []int{1, 3}},
+		},
+	},
+	{
+		Id:     1,
+		Memory: 2000,
+		Cores: []cadvisor.Core{
+			{Id: 0, Threads: []int{4, 6}},
+			{Id: 1, Threads: []int{5, 7}},
+		},
+	},
+}
+
+func numaValues(metrics []LabeledMetric) map[string]int64 {
+	result := map[string]int64{}
+	for _, metric := range metrics {
+		result[metric.Name+":"+metric.Labels[LabelResourceID.Key]] = metric.IntValue
+	}
+	return result
+}
+
+func TestNumaMetricValues(t *testing.T) {
+	stat := &cadvisor.ContainerStats{}
+	stat.Cpu.Usage.PerCpu = []uint64{1, 2, 4, 8, 16, 32, 64, 128}
+
+	metrics := NumaMetricValues(testTopology, stat, map[int]uint64{0: 300, 1: 400})
+
+	assert.Equal(t, map[string]int64{
+		"memory/numa_capacity:node0": 1000,
+		"memory/numa_capacity:node1": 2000,
+		"memory/numa_usage:node0":    300,
+		"memory/numa_usage:node1":    400,
+		"cpu/numa_usage:node0":       15,
+		"cpu/numa_usage:node1":       240,
+	}, numaValues(metrics))
+	for _, metric := range metrics {
+		if metric.Name == MetricNumaCpuUsage.Name {
+			assert.Equal(t, MetricCumulative, metric.MetricType)
+		} else {
+			assert.Equal(t, MetricGauge, metric.MetricType)
+		}
+	}
+}
+
+func TestNumaMetricValuesWithoutUsage(t *testing.T) {
+	// Neither per-cpu usage, like on cgroup v2, nor NUMA memory stats.
+	stat := &cadvisor.ContainerStats{}
+	stat.Cpu.Usage.Total = 100
+
+	metrics := NumaMetricValues(testTopology, stat, nil)
+
+	assert.Equal(t, map[string]int64{
+		"memory/numa_capacity:node0": 1000,
+		"memory/numa_capacity:node1": 2000,
+	}, numaValues(metrics))
+}
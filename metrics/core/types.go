@@ -15,6 +15,8 @@
 package core
 
 import (
+	"fmt"
+	"net/http"
 	"time"
 )
 
@@ -43,6 +45,7 @@ type ValueType int8
 const (
 	ValueInt64 ValueType = iota
 	ValueFloat
+	ValueHistogram
 )
 
 func (self *ValueType) String() string {
@@ -51,6 +54,8 @@ func (self *ValueType) String() string {
 		return "int64"
 	case ValueFloat:
 		return "double"
+	case ValueHistogram:
+		return "distribution"
 	}
 	return ""
 }
@@ -87,8 +92,10 @@ func (self *UnitsType) String() string {
 type MetricValue struct {
 	IntValue   int64
 	FloatValue float32
-	MetricType MetricType
-	ValueType  ValueType
+	// Only set for ValueHistogram.
+	HistogramValue *Histogram
+	MetricType     MetricType
+	ValueType      ValueType
 }
 
 func (this *MetricValue) GetValue() interface{} {
@@ -96,11 +103,57 @@ func (this *MetricValue) GetValue() interface{} {
 		return this.IntValue
 	} else if ValueFloat == this.ValueType {
 		return this.FloatValue
+	} else if ValueHistogram == this.ValueType {
+		return this.HistogramValue
 	} else {
 		return nil
 	}
 }
 
+// A distribution of observed values. Bounds are the increasing upper bounds of the buckets,
+// Counts[i] is the number of values below Bounds[i] (and not below Bounds[i-1]) and the
+// last element of Counts, at len(Bounds), holds the values above the last bound.
+type Histogram struct {
+	Bounds []float64
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+// Returns the mean of the observed values, or 0 if there are none.
+func (this *Histogram) Mean() float64 {
+	if this.Count == 0 {
+		return 0
+	}
+	return this.Sum / float64(this.Count)
+}
+
+// Returns a new histogram holding the values of both a and b. Both histograms must
+// have the same bucket bounds.
+func MergeHistograms(a, b *Histogram) (*Histogram, error) {
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("missing histogram value")
+	}
+	if len(a.Bounds) != len(b.Bounds) || len(a.Counts) != len(b.Counts) {
+		return nil, fmt.Errorf("histograms have different buckets")
+	}
+	for i := range a.Bounds {
+		if a.Bounds[i] != b.Bounds[i] {
+			return nil, fmt.Errorf("histograms have different buckets")
+		}
+	}
+	result := &Histogram{
+		Bounds: a.Bounds,
+		Counts: make([]uint64, len(a.Counts)),
+		Sum:    a.Sum + b.Sum,
+		Count:  a.Count + b.Count,
+	}
+	for i := range a.Counts {
+		result.Counts[i] = a.Counts[i] + b.Counts[i]
+	}
+	return result, nil
+}
+
 type LabeledMetric struct {
 	Name   string
 	Labels map[string]string
@@ -112,6 +165,8 @@ func (this *LabeledMetric) GetValue() interface{} {
 		return this.IntValue
 	} else if ValueFloat == this.ValueType {
 		return this.FloatValue
+	} else if ValueHistogram == this.ValueType {
+		return this.HistogramValue
 	} else {
 		return nil
 	}
@@ -123,12 +178,55 @@ type MetricSet struct {
 	MetricValues   map[string]MetricValue
 	Labels         map[string]string
 	LabeledMetrics []LabeledMetric
+	// All samples collected in the scrape window, oldest first. Only set by sources
+	// running in raw sample mode and passed only to sinks implementing RawSampleSink.
+	RawSamples []RawSample
+}
+
+// A single sample of the metrics of a MetricSet taken at the given time.
+type RawSample struct {
+	Timestamp    time.Time
+	MetricValues map[string]MetricValue
 }
 
 type DataBatch struct {
 	Timestamp time.Time
 	// Should use key functions from ms_keys.go
 	MetricSets map[string]*MetricSet
+	// Share of the cluster covered by the batch, nil if it wasn't computed.
+	Completeness *Completeness
+	// Set for batches scraped out of band from a few nodes, in between the regular ones.
+	// They cover only these nodes, so the processors and sinks which need the whole cluster
+	// skip them.
+	OutOfBand bool
+}
+
+// Completeness of a data batch: the nodes scraped out of the ready ones and the running
+// pods having metrics out of all running pods.
+type Completeness struct {
+	NodesScraped  int
+	NodesExpected int
+	PodsCovered   int
+	PodsRunning   int
+	// Set when the completeness is below the configured minimum, in which case sinks should
+	// consider the batch partial.
+	Degraded bool
+}
+
+// Returns the ratio of scraped nodes, 1 when no node is expected.
+func (this *Completeness) NodeRatio() float64 {
+	if this.NodesExpected == 0 {
+		return 1
+	}
+	return float64(this.NodesScraped) / float64(this.NodesExpected)
+}
+
+// Returns the ratio of covered running pods, 1 when no pod is running.
+func (this *Completeness) PodRatio() float64 {
+	if this.PodsRunning == 0 {
+		return 1
+	}
+	return float64(this.PodsCovered) / float64(this.PodsRunning)
 }
 
 // A place from where the metrics should be scraped.
@@ -137,6 +235,18 @@ type MetricsSource interface {
 	ScrapeMetrics(start, end time.Time) *DataBatch
 }
 
+// A MetricsSource scraping a single node.
+type NodeMetricsSource interface {
+	MetricsSource
+	NodeName() string
+}
+
+// A MetricsSource which can also scrape only the sources of the given nodes.
+type NodeScrapingSource interface {
+	MetricsSource
+	ScrapeNodeMetrics(nodes []string, start, end time.Time) *DataBatch
+}
+
 // Provider of list of sources to be scaped.
 type MetricsSourceProvider interface {
 	GetMetricsSources() []MetricsSource
@@ -152,6 +262,42 @@ type DataSink interface {
 	Stop()
 }
 
+// A DataSink that wants to receive the raw samples attached to the MetricSets. Other sinks
+// get the data batches with raw samples removed.
+type RawSampleSink interface {
+	DataSink
+	AcceptsRawSamples() bool
+}
+
+// A DataSink that is able to store ValueHistogram metrics. Other sinks get the data batches
+// with histogram values removed.
+type HistogramSink interface {
+	DataSink
+	AcceptsHistograms() bool
+}
+
+// A DataSink that reports whether a batch was written, so that the failed batches can be retried.
+type RetryableSink interface {
+	DataSink
+	// Exports data like ExportData, returning an error if the batch wasn't entirely written.
+	// Exporting a batch again should overwrite rather than duplicate the data already written.
+	TryExportData(*DataBatch) error
+}
+
+// A DataSink that serves the exported data itself, on the given path of the Heapster port.
+type HttpSink interface {
+	DataSink
+	http.Handler
+	HttpPath() string
+}
+
+// A MetricsSource that receives the pushed metrics itself, on the given path of the Heapster port.
+type HttpSource interface {
+	MetricsSource
+	http.Handler
+	HttpPath() string
+}
+
 type DataProcessor interface {
 	Name() string
 	Process(*DataBatch) (*DataBatch, error)
@@ -0,0 +1,46 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeHistograms(t *testing.T) {
+	a := &Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 1}, Sum: 3.5, Count: 2}
+	b := &Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 2, 0}, Sum: 3, Count: 2}
+
+	merged, err := MergeHistograms(a, b)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1, 2}, merged.Bounds)
+	assert.Equal(t, []uint64{1, 2, 1}, merged.Counts)
+	assert.Equal(t, uint64(4), merged.Count)
+	assert.Equal(t, 6.5, merged.Sum)
+	assert.Equal(t, 1.625, merged.Mean())
+	assert.Equal(t, []uint64{1, 0, 1}, a.Counts)
+
+	_, err = MergeHistograms(a, &Histogram{Bounds: []float64{1, 3}, Counts: []uint64{0, 0, 0}})
+	assert.Error(t, err)
+	_, err = MergeHistograms(a, &Histogram{Bounds: []float64{1}, Counts: []uint64{0, 0}})
+	assert.Error(t, err)
+	_, err = MergeHistograms(a, nil)
+	assert.Error(t, err)
+
+	value := MetricValue{ValueType: ValueHistogram, HistogramValue: a}
+	assert.Equal(t, a, value.GetValue())
+	assert.Equal(t, float64(0), (&Histogram{}).Mean())
+}
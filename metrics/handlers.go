@@ -17,21 +17,51 @@ package main
 import (
 	"net/http"
 	"net/http/pprof"
+	"strconv"
 	"strings"
+	"time"
 
 	restful "github.com/emicklei/go-restful"
+	eventstore "k8s.io/heapster/events/store"
 	"k8s.io/heapster/metrics/api/v1"
 	metricsApi "k8s.io/heapster/metrics/apis/metrics"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/processors"
+	"k8s.io/heapster/metrics/sinks"
 	metricsink "k8s.io/heapster/metrics/sinks/metric"
+	"k8s.io/heapster/metrics/sizing"
+	"k8s.io/heapster/metrics/ui"
+	"k8s.io/heapster/metrics/util/accounting"
 	"k8s.io/heapster/metrics/util/metrics"
 
 	"k8s.io/kubernetes/pkg/client/cache"
 )
 
-const pprofBasePath = "/debug/pprof/"
+const (
+	pprofBasePath     = "/debug/pprof/"
+	sizingBasePath    = "/debug/sizing"
+	resourcesBasePath = "/debug/resources"
+	sinksBasePath     = "/api/v1/sinks"
+	configBasePath    = "/api/v1/config"
 
-func setupHandlers(metricSink *metricsink.MetricSink, podLister *cache.StoreToPodLister, nodeLister *cache.StoreToNodeLister, historicalSource core.HistoricalSource) http.Handler {
+	labelCorrectionsBasePath = "/api/v1/admin/label-corrections"
+)
+
+// Body of a label correction request.
+type labelCorrectionRequest struct {
+	processors.LabelCorrection `json:",inline"`
+	Reason                     string `json:"reason"`
+}
+
+// Returns the user of a request for the audit log: the client certificate if there is one.
+func requestUser(req *http.Request) string {
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		return req.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	return req.RemoteAddr
+}
+
+func setupHandlers(metricSink *metricsink.MetricSink, podLister *cache.StoreToPodLister, nodeLister *cache.StoreToNodeLister, historicalSource core.HistoricalSource, eventStore *eventstore.EventStore, recommender *sizing.Recommender, labelCorrector *processors.LabelCorrector, sinkStats sinks.StatsProvider, config *runtimeConfig, redactor *v1.Redactor, enableUI bool) http.Handler {
 
 	runningInKubernetes := true
 
@@ -39,7 +69,10 @@ func setupHandlers(metricSink *metricsink.MetricSink, podLister *cache.StoreToPo
 	wsContainer := restful.NewContainer()
 	wsContainer.EnableContentEncoding(true)
 	wsContainer.Router(restful.CurlyRouter{})
-	a := v1.NewApi(runningInKubernetes, metricSink, historicalSource)
+	if redactor != nil {
+		wsContainer.Filter(redactor.Filter)
+	}
+	a := v1.NewApi(runningInKubernetes, metricSink, historicalSource, eventStore)
 	a.Register(wsContainer)
 	// Metrics API
 	m := metricsApi.NewApi(metricSink, podLister, nodeLister)
@@ -64,5 +97,91 @@ func setupHandlers(metricSink *metricsink.MetricSink, podLister *cache.StoreToPo
 	ws.Route(ws.GET("/{subpath:*}").To(metrics.InstrumentRouteFunc("pprof", handlePprofEndpoint))).Doc("pprof endpoint")
 	wsContainer.Add(ws)
 
+	// Setup the sizing recommendation handler, for the current or the given number of pods.
+	handleSizingEndpoint := func(req *restful.Request, resp *restful.Response) {
+		targetPods := 0
+		if param := req.QueryParameter("pods"); param != "" {
+			var err error
+			if targetPods, err = strconv.Atoi(param); err != nil || targetPods <= 0 {
+				resp.WriteErrorString(http.StatusBadRequest, "pods should be a positive number")
+				return
+			}
+		}
+		recommendation, err := recommender.Recommend(time.Now(), targetPods)
+		if err != nil {
+			resp.WriteError(http.StatusInternalServerError, err)
+			return
+		}
+		resp.WriteEntity(recommendation)
+	}
+	ws = new(restful.WebService).Path(sizingBasePath).Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("").To(metrics.InstrumentRouteFunc("sizing", handleSizingEndpoint)).
+		Doc("Get the resource requests recommended for heapster").
+		Param(ws.QueryParameter("pods", "Number of running pods to size heapster for, the current ones by default").DataType("int")).
+		Writes(sizing.Recommendation{}))
+	wsContainer.Add(ws)
+
+	// Setup the handler of the resources used by each source and sink.
+	handleResourcesEndpoint := func(req *restful.Request, resp *restful.Response) {
+		resp.WriteEntity(accounting.DefaultLedger.Usage())
+	}
+	ws = new(restful.WebService).Path(resourcesBasePath).Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("").To(metrics.InstrumentRouteFunc("resources", handleResourcesEndpoint)).
+		Doc("Get the goroutines, connections and buffered bytes of each source and sink"))
+	wsContainer.Add(ws)
+
+	// Setup the handler of the export statistics of each sink.
+	handleSinksEndpoint := func(req *restful.Request, resp *restful.Response) {
+		resp.WriteEntity(sinkStats.Stats())
+	}
+	ws = new(restful.WebService).Path(sinksBasePath).Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("").To(metrics.InstrumentRouteFunc("sinks", handleSinksEndpoint)).
+		Doc("Get the last export time, latency, batch sizes, failures and dropped points of each sink").
+		Writes([]sinks.SinkStats{}))
+	wsContainer.Add(ws)
+
+	// Setup the handler of the effective configuration.
+	handleConfigEndpoint := func(req *restful.Request, resp *restful.Response) {
+		resp.WriteEntity(config.Config())
+	}
+	ws = new(restful.WebService).Path(configBasePath).Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("").To(metrics.InstrumentRouteFunc("config", handleConfigEndpoint)).
+		Doc("Get the sources, sinks, processors and flags of heapster, with their secrets redacted").
+		Writes(RuntimeConfig{}))
+	wsContainer.Add(ws)
+
+	if labelCorrector != nil {
+		// Setup the handlers applying and auditing the label corrections.
+		handleLabelCorrections := func(req *restful.Request, resp *restful.Response) {
+			resp.WriteEntity(labelCorrector.Audit())
+		}
+		handleAddLabelCorrection := func(req *restful.Request, resp *restful.Response) {
+			correction := labelCorrectionRequest{}
+			if err := req.ReadEntity(&correction); err != nil {
+				resp.WriteError(http.StatusBadRequest, err)
+				return
+			}
+			audit, err := labelCorrector.Correct(correction.LabelCorrection, requestUser(req.Request), correction.Reason)
+			if err != nil {
+				resp.WriteError(http.StatusBadRequest, err)
+				return
+			}
+			resp.WriteEntity(audit)
+		}
+		ws = new(restful.WebService).Path(labelCorrectionsBasePath).Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+		ws.Route(ws.GET("").To(metrics.InstrumentRouteFunc("labelCorrections", handleLabelCorrections)).
+			Doc("Get the audit log of the label corrections").
+			Writes([]processors.LabelCorrectionAudit{}))
+		ws.Route(ws.POST("").To(metrics.InstrumentRouteFunc("addLabelCorrection", handleAddLabelCorrection)).
+			Doc("Correct a label in the in-memory history and in all the future batches").
+			Reads(labelCorrectionRequest{}).
+			Writes(processors.LabelCorrectionAudit{}))
+		wsContainer.Add(ws)
+	}
+
+	if enableUI {
+		wsContainer.Handle(ui.BasePath, ui.NewHandler())
+	}
+
 	return wsContainer
 }
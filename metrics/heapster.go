@@ -33,6 +33,13 @@ import (
 
 	"k8s.io/heapster/common/flags"
 	kube_config "k8s.io/heapster/common/kubernetes"
+	"k8s.io/heapster/common/transport"
+	eventcore "k8s.io/heapster/events/core"
+	eventmanager "k8s.io/heapster/events/manager"
+	eventsinks "k8s.io/heapster/events/sinks"
+	eventsources "k8s.io/heapster/events/sources"
+	eventstore "k8s.io/heapster/events/store"
+	"k8s.io/heapster/metrics/api/v1"
 	"k8s.io/heapster/metrics/cmd/heapster-apiserver/app"
 	"k8s.io/heapster/metrics/core"
 	"k8s.io/heapster/metrics/manager"
@@ -40,19 +47,29 @@ import (
 	"k8s.io/heapster/metrics/processors"
 	"k8s.io/heapster/metrics/sinks"
 	metricsink "k8s.io/heapster/metrics/sinks/metric"
+	"k8s.io/heapster/metrics/sizing"
+	"k8s.io/heapster/metrics/snapshot"
 	"k8s.io/heapster/metrics/sources"
+	"k8s.io/heapster/metrics/sources/kubelet"
 	"k8s.io/heapster/metrics/util"
 	"k8s.io/heapster/version"
 	kube_api "k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/client/cache"
 	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
-	"k8s.io/kubernetes/pkg/fields"
 	"k8s.io/kubernetes/pkg/healthz"
 	"k8s.io/kubernetes/pkg/util/flag"
 	"k8s.io/kubernetes/pkg/util/logs"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == benchSinkCommand {
+		if err := runBenchSink(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", benchSinkCommand, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	opt := options.NewHeapsterRunOptions()
 	opt.AddFlags(pflag.CommandLine)
 
@@ -73,16 +90,50 @@ func main() {
 	if err := validateFlags(opt); err != nil {
 		glog.Fatal(err)
 	}
+	if err := core.SetNetworkInterfaceFilter(opt.NetworkInterfaceInclude, opt.NetworkInterfaceExclude); err != nil {
+		glog.Fatal(err)
+	}
+	if opt.KeyTemplates != "" {
+		keyScheme, err := core.LoadKeyScheme(opt.KeyTemplates)
+		if err != nil {
+			glog.Fatalf("Failed to load metric set key templates: %v", err)
+		}
+		core.SetKeyScheme(keyScheme)
+	}
 
 	kubernetesUrl, err := getKubernetesAddress(opt.Sources)
 	if err != nil {
 		glog.Fatalf("Failed to get kubernetes address: %v", err)
 	}
-	sourceManager := createSourceManagerOrDie(opt.Sources)
-	sinkManager, metricSink, historicalSource := createAndInitSinksOrDie(opt.Sinks, opt.HistoricalSource)
+	// The first federated cluster keeps the keys of its metric sets, and its API is the one used
+	// by the processors.
+	if len(opt.Sources) > 0 {
+		core.SetPrimaryCluster(sources.ClusterName(opt.Sources[0]))
+	}
+	sourceManager, httpSources := createSourceManagerOrDie(opt.Sources, opt.SourcePlugins, opt.Canary, opt.CanaryPeriod)
+	transport.Configure(opt.SinkTransport)
+	sinks.ConfigureCircuitBreaker(opt.SinkBreakerFailures, opt.SinkBreakerProbeInterval)
+	sinkManager, metricSink, historicalSource, httpSinks := createAndInitSinksOrDie(opt.Sinks, opt.HistoricalSource)
+	var sinkConfigWatcher *sinks.SinkConfigWatcher
+	if opt.SinkConfig != "" {
+		sinkConfigWatcher, err = sinks.NewSinkConfigWatcher(sinkManager, sinks.NewSinkFactory(), opt.SinkConfig)
+		if err != nil {
+			glog.Fatalf("Failed to read sink configuration: %v", err)
+		}
+		sinkConfigWatcher.Start()
+	}
 
 	podLister, nodeLister := getListersOrDie(kubernetesUrl)
-	dataProcessors := createDataProcessorsOrDie(kubernetesUrl, podLister)
+	sinks.ConfigureInactivePods(podLister)
+	var labelCorrector *processors.LabelCorrector
+	if opt.LabelCorrections {
+		labelCorrector = processors.NewLabelCorrector(metricSink)
+	}
+	dataProcessors := createDataProcessorsOrDie(kubernetesUrl, podLister, nodeLister, opt, labelCorrector)
+
+	if opt.SnapshotLocation != "" {
+		startSnapshotsOrDie(opt, metricSink)
+	}
 
 	man, err := manager.NewManager(sourceManager, dataProcessors, sinkManager,
 		opt.MetricResolution, manager.DefaultScrapeOffset, manager.DefaultMaxParallelism)
@@ -98,17 +149,38 @@ func main() {
 
 	mux := http.NewServeMux()
 	promHandler := prometheus.Handler()
-	handler := setupHandlers(metricSink, podLister, nodeLister, historicalSource)
+	eventStore := createEventStoreOrDie(opt, man, podLister)
+	recommender := sizing.NewRecommender(podLister, opt.VerticalSizing)
+	recommender.Start(opt.SizingReportInterval)
+	var redactor *v1.Redactor
+	if opt.APIRedaction != "" {
+		if redactor, err = v1.NewRedactor(opt.APIRedaction); err != nil {
+			glog.Fatalf("Failed to read API redaction rules: %v", err)
+		}
+	}
+	config := &runtimeConfig{
+		opt:        opt,
+		flagSet:    pflag.CommandLine,
+		processors: dataProcessors,
+		watcher:    sinkConfigWatcher,
+	}
+	handler := setupHandlers(metricSink, podLister, nodeLister, historicalSource, eventStore, recommender, labelCorrector, sinkManager.(sinks.StatsProvider), config, redactor, opt.EnableUI)
 	healthz.InstallHandler(mux, healthzChecker(metricSink))
 
 	addr := fmt.Sprintf("%s:%d", opt.Ip, opt.Port)
 	glog.Infof("Starting heapster on port %d", opt.Port)
 
 	if len(opt.TLSCertFile) > 0 && len(opt.TLSKeyFile) > 0 {
-		startSecureServing(opt, handler, promHandler, mux, addr)
+		startSecureServing(opt, handler, promHandler, httpSinks, httpSources, redactor, mux, addr)
 	} else {
 		mux.Handle("/", handler)
 		mux.Handle("/metrics", promHandler)
+		for _, sink := range httpSinks {
+			mux.Handle(sink.HttpPath(), sink)
+		}
+		for _, source := range httpSources {
+			mux.Handle(source.HttpPath(), source)
+		}
 
 		glog.Fatal(http.ListenAndServe(addr, mux))
 	}
@@ -133,8 +205,10 @@ func createAndRunAPIServer(opt *options.HeapsterRunOptions, metricSink *metricsi
 }
 
 func startSecureServing(opt *options.HeapsterRunOptions, handler http.Handler, promHandler http.Handler,
-	mux *http.ServeMux, address string) {
+	httpSinks []core.HttpSink, httpSources []core.HttpSource, redactor *v1.Redactor, mux *http.ServeMux, address string) {
 
+	// The API applies the redaction rules itself, the exposition and the sinks serve all the labels.
+	promHandler = redactor.Handler(promHandler)
 	if len(opt.TLSClientCAFile) > 0 {
 		authPprofHandler, err := newAuthHandler(opt, handler)
 		if err != nil {
@@ -150,9 +224,24 @@ func startSecureServing(opt *options.HeapsterRunOptions, handler http.Handler, p
 	}
 	mux.Handle("/", handler)
 	mux.Handle("/metrics", promHandler)
+	for _, sink := range httpSinks {
+		sinkHandler := redactor.Handler(sink)
+		if len(opt.TLSClientCAFile) > 0 {
+			authSinkHandler, err := newAuthHandler(opt, sinkHandler)
+			if err != nil {
+				glog.Fatalf("Failed to create authorized handler for %s: %v", sink.Name(), err)
+			}
+			sinkHandler = authSinkHandler
+		}
+		mux.Handle(sink.HttpPath(), sinkHandler)
+	}
+	// The pushes are authenticated by the token of their source, client certificates are optional.
+	for _, source := range httpSources {
+		mux.Handle(source.HttpPath(), source)
+	}
 
-	// If allowed users is set, then we need to enable Client Authentication
-	if len(opt.AllowedUsers) > 0 {
+	// If allowed users or redaction rules are set, then we need to enable Client Authentication
+	if len(opt.AllowedUsers) > 0 || len(opt.APIRedaction) > 0 {
 		server := &http.Server{
 			Addr:      address,
 			Handler:   mux,
@@ -164,8 +253,8 @@ func startSecureServing(opt *options.HeapsterRunOptions, handler http.Handler, p
 	}
 }
 
-func createSourceManagerOrDie(src flags.Uris) core.MetricsSource {
-	if len(src) != 1 {
+func createSourceManagerOrDie(src, plugins flags.Uris, canary string, canaryPeriod int) (core.MetricsSource, []core.HttpSource) {
+	if len(src) == 0 {
 		glog.Fatal("Wrong number of sources specified")
 	}
 	sourceFactory := sources.NewSourceFactory()
@@ -173,14 +262,26 @@ func createSourceManagerOrDie(src flags.Uris) core.MetricsSource {
 	if err != nil {
 		glog.Fatalf("Failed to create source provide: %v", err)
 	}
+	sourceProvider, err = sourceFactory.BuildPlugins(sourceProvider, plugins)
+	if err != nil {
+		glog.Fatalf("Failed to create source plugins: %v", err)
+	}
+	httpSources := sources.HttpSources(sourceProvider)
+	if canary != "" {
+		sourceProvider, err = sources.NewCanaryProvider(sourceProvider, canary, canaryPeriod)
+		if err != nil {
+			glog.Fatalf("Failed to create canary source: %v", err)
+		}
+		glog.Infof("Generating a %s canary series", canary)
+	}
 	sourceManager, err := sources.NewSourceManager(sourceProvider, sources.DefaultMetricsScrapeTimeout)
 	if err != nil {
 		glog.Fatalf("Failed to create source manager: %v", err)
 	}
-	return sourceManager
+	return sourceManager, httpSources
 }
 
-func createAndInitSinksOrDie(sinkAddresses flags.Uris, historicalSource string) (core.DataSink, *metricsink.MetricSink, core.HistoricalSource) {
+func createAndInitSinksOrDie(sinkAddresses flags.Uris, historicalSource string) (core.DataSink, *metricsink.MetricSink, core.HistoricalSource, []core.HttpSink) {
 	sinksFactory := sinks.NewSinkFactory()
 	metricSink, sinkList, histSource := sinksFactory.BuildAll(sinkAddresses, historicalSource)
 	if metricSink == nil {
@@ -189,24 +290,82 @@ func createAndInitSinksOrDie(sinkAddresses flags.Uris, historicalSource string)
 	if histSource == nil && len(historicalSource) > 0 {
 		glog.Fatal("Failed to use a sink as a historical metrics source")
 	}
+	httpSinks := []core.HttpSink{}
 	for _, sink := range sinkList {
 		glog.Infof("Starting with %s", sink.Name())
+		if httpSink, ok := sink.(core.HttpSink); ok {
+			httpSinks = append(httpSinks, httpSink)
+		}
 	}
 	sinkManager, err := sinks.NewDataSinkManager(sinkList, sinks.DefaultSinkExportDataTimeout, sinks.DefaultSinkStopTimeout)
 	if err != nil {
 		glog.Fatalf("Failed to created sink manager: %v", err)
 	}
-	return sinkManager, metricSink, histSource
+	return sinkManager, metricSink, histSource, httpSinks
+}
+
+// Returns nil if no event source is configured. The events with the reasons of --event_scrape
+// trigger out of band scrapes of their nodes.
+func createEventStoreOrDie(opt *options.HeapsterRunOptions, man manager.Manager, podLister *cache.StoreToPodLister) *eventstore.EventStore {
+	if len(opt.EventSources) == 0 {
+		return nil
+	}
+	eventSources, err := eventsources.NewSourceFactory().BuildAll(opt.EventSources)
+	if err != nil || len(eventSources) != 1 {
+		glog.Fatalf("Failed to create event source: %v", err)
+	}
+	store := eventstore.NewEventStore(opt.EventRetention)
+	var eventSink eventcore.EventSink = store
+	if opt.EventScrape != "" {
+		trigger := manager.NewEventScrapeTrigger(man, podLister, strings.Split(opt.EventScrape, ","), manager.DefaultEventScrapeInterval)
+		eventSink, err = eventsinks.NewEventSinkManager([]eventcore.EventSink{store, trigger}, eventsinks.DefaultSinkQueueSize,
+			eventsinks.DefaultSinkBatchSize, 1, eventsinks.DefaultSinkOverloadPolicy, eventsinks.DefaultSinkStopTimeout)
+		if err != nil {
+			glog.Fatalf("Failed to create event sink manager: %v", err)
+		}
+	}
+	eventManager, err := eventmanager.NewManager(eventSources[0], eventSink, opt.MetricResolution)
+	if err != nil {
+		glog.Fatalf("Failed to create event manager: %v", err)
+	}
+	eventManager.Start()
+	return store
 }
 
+// Restores the model from the latest snapshot if enabled, before uploading new snapshots.
+func startSnapshotsOrDie(opt *options.HeapsterRunOptions, metricSink *metricsink.MetricSink) {
+	store, err := snapshot.NewObjectStore(opt.SnapshotLocation)
+	if err != nil {
+		glog.Fatalf("Failed to create snapshot store: %v", err)
+	}
+	uploader := snapshot.NewUploader(store, metricSink)
+	if opt.SnapshotRestore {
+		// A missing model is better than no monitoring at all.
+		if err := uploader.Restore(); err != nil {
+			glog.Errorf("Failed to restore the model snapshot from %s: %v", store, err)
+		}
+	}
+	uploader.Start(opt.SnapshotInterval)
+}
+
+// Returns empty listers outside of Kubernetes.
 func getListersOrDie(kubernetesUrl *url.URL) (*cache.StoreToPodLister, *cache.StoreToNodeLister) {
+	if kubernetesUrl == nil {
+		return &cache.StoreToPodLister{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})},
+			&cache.StoreToNodeLister{Store: cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	}
 	kubeClient := createKubeClientOrDie(kubernetesUrl)
 
 	podLister, err := getPodLister(kubeClient)
 	if err != nil {
 		glog.Fatalf("Failed to create podLister: %v", err)
 	}
-	nodeLister, _, err := util.GetNodeLister(kubeClient)
+	// The completeness of the batches is relative to the scraped nodes.
+	nodeSelector, err := kubelet.GetNodeLabelSelector(kubernetesUrl)
+	if err != nil {
+		glog.Fatalf("Failed to create nodeLister: %v", err)
+	}
+	nodeLister, _, err := util.GetSelectedNodeLister(kubeClient, nodeSelector)
 	if err != nil {
 		glog.Fatalf("Failed to create nodeLister: %v", err)
 	}
@@ -221,23 +380,49 @@ func createKubeClientOrDie(kubernetesUrl *url.URL) *kube_client.Client {
 	return kube_client.NewOrDie(kubeConfig)
 }
 
-func createDataProcessorsOrDie(kubernetesUrl *url.URL, podLister *cache.StoreToPodLister) []core.DataProcessor {
-	dataProcessors := []core.DataProcessor{
-		// Convert cumulative to rate
-		processors.NewRateCalculator(core.RateMetricsMapping),
+// The processors enriching the metric sets from the Kubernetes API are left out outside of
+// Kubernetes, when kubernetesUrl is nil.
+func createDataProcessorsOrDie(kubernetesUrl *url.URL, podLister *cache.StoreToPodLister, nodeLister *cache.StoreToNodeLister,
+	opt *options.HeapsterRunOptions, labelCorrector *processors.LabelCorrector) []core.DataProcessor {
+	// Only the metric sets of the primary cluster are known to its API.
+	primaryOnly := func(processor core.DataProcessor) core.DataProcessor {
+		if len(opt.Sources) > 1 {
+			return processors.NewPrimaryClusterProcessor(processor)
+		}
+		return processor
 	}
+	dataProcessors := []core.DataProcessor{}
+	if opt.CustomMetricPolicy != "" {
+		var events processors.EventPoster
+		if opt.CustomMetricPolicyEvents && kubernetesUrl != nil {
+			events = createKubeClientOrDie(kubernetesUrl).Events(kube_api.NamespaceAll)
+		}
+		customMetricValidator, err := processors.NewCustomMetricValidator(opt.CustomMetricPolicy, events)
+		if err != nil {
+			glog.Fatalf("Failed to create CustomMetricValidator: %v", err)
+		}
+		dataProcessors = append(dataProcessors, customMetricValidator)
+	}
+	// Convert cumulative to rate
+	dataProcessors = append(dataProcessors, processors.NewRateCalculator(core.RateMetricsMapping))
 
-	podBasedEnricher, err := processors.NewPodBasedEnricher(podLister)
-	if err != nil {
-		glog.Fatalf("Failed to create PodBasedEnricher: %v", err)
+	if kubernetesUrl != nil {
+		podBasedEnricher, err := processors.NewPodBasedEnricher(podLister, opt.PodIdentity)
+		if err != nil {
+			glog.Fatalf("Failed to create PodBasedEnricher: %v", err)
+		}
+		dataProcessors = append(dataProcessors, primaryOnly(podBasedEnricher))
 	}
-	dataProcessors = append(dataProcessors, podBasedEnricher)
+	dataProcessors = append(dataProcessors, processors.NewLimitUtilizationCalculator())
+	dataProcessors = append(dataProcessors, processors.NewExhaustionPredictor(opt.PredictionWindow, opt.DiskPressureThreshold))
 
-	namespaceBasedEnricher, err := processors.NewNamespaceBasedEnricher(kubernetesUrl)
-	if err != nil {
-		glog.Fatalf("Failed to create NamespaceBasedEnricher: %v", err)
+	if kubernetesUrl != nil {
+		namespaceBasedEnricher, err := processors.NewNamespaceBasedEnricher(kubernetesUrl)
+		if err != nil {
+			glog.Fatalf("Failed to create NamespaceBasedEnricher: %v", err)
+		}
+		dataProcessors = append(dataProcessors, primaryOnly(namespaceBasedEnricher))
 	}
-	dataProcessors = append(dataProcessors, namespaceBasedEnricher)
 
 	// aggregators
 	metricsToAggregate := []string{
@@ -261,18 +446,48 @@ func createDataProcessorsOrDie(kubernetesUrl *url.URL, podLister *cache.StoreToP
 		&processors.NamespaceAggregator{
 			MetricsToAggregate: metricsToAggregate,
 		},
+		&processors.QOSAggregator{
+			MetricsToAggregate: metricsToAggregate,
+		},
 		&processors.NodeAggregator{
 			MetricsToAggregate: metricsToAggregateForNode,
 		},
 		&processors.ClusterAggregator{
 			MetricsToAggregate: metricsToAggregate,
-		})
+		},
+		processors.NewNetworkAttributionValidator(podLister, opt.NetworkAttributionGapThreshold))
+
+	if opt.MetadataFile != "" {
+		metadataEnricher, err := processors.NewMetadataEnricher(opt.MetadataFile)
+		if err != nil {
+			glog.Fatalf("Failed to create MetadataEnricher: %v", err)
+		}
+		dataProcessors = append(dataProcessors, metadataEnricher)
+	}
+
+	if kubernetesUrl == nil {
+		if labelCorrector != nil {
+			dataProcessors = append(dataProcessors, labelCorrector)
+		}
+		return dataProcessors
+	}
+
+	jobDurationTracker, err := processors.NewJobDurationTracker(kubernetesUrl, podLister)
+	if err != nil {
+		glog.Fatalf("Failed to create JobDurationTracker: %v", err)
+	}
+	dataProcessors = append(dataProcessors, primaryOnly(jobDurationTracker))
+
+	if labelCorrector != nil {
+		dataProcessors = append(dataProcessors, labelCorrector)
+	}
 
 	nodeAutoscalingEnricher, err := processors.NewNodeAutoscalingEnricher(kubernetesUrl)
 	if err != nil {
 		glog.Fatalf("Failed to create NodeAutoscalingEnricher: %v", err)
 	}
-	dataProcessors = append(dataProcessors, nodeAutoscalingEnricher)
+	dataProcessors = append(dataProcessors, primaryOnly(nodeAutoscalingEnricher))
+	dataProcessors = append(dataProcessors, primaryOnly(processors.NewCompletenessTracker(nodeLister, podLister, opt.MinCompleteness)))
 	return dataProcessors
 }
 
@@ -302,23 +517,23 @@ func healthzChecker(metricSink *metricsink.MetricSink) healthz.HealthzChecker {
 }
 
 // Gets the address of the kubernetes source from the list of source URIs.
-// Possible kubernetes sources are: 'kubernetes' and 'kubernetes.summary_api'
+// Possible kubernetes sources are: 'kubernetes' and 'kubernetes.summary_api'. Returns nil
+// for the 'docker' source, with which heapster runs as a host agent outside of Kubernetes.
 func getKubernetesAddress(args flags.Uris) (*url.URL, error) {
 	for _, uri := range args {
 		if strings.SplitN(uri.Key, ".", 2)[0] == "kubernetes" {
 			return &uri.Val, nil
 		}
 	}
+	if len(args) == 1 && args[0].Key == "docker" {
+		return nil, nil
+	}
 	return nil, fmt.Errorf("No kubernetes source found.")
 }
 
 func getPodLister(kubeClient *kube_client.Client) (*cache.StoreToPodLister, error) {
-	lw := cache.NewListWatchFromClient(kubeClient, "pods", kube_api.NamespaceAll, fields.Everything())
-	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
-	podLister := &cache.StoreToPodLister{Indexer: store}
-	reflector := cache.NewReflector(lw, &kube_api.Pod{}, store, time.Hour)
-	reflector.Run()
-	return podLister, nil
+	podLister, _, err := util.GetPodLister(kubeClient)
+	return podLister, err
 }
 
 func validateFlags(opt *options.HeapsterRunOptions) error {
@@ -331,6 +546,42 @@ func validateFlags(opt *options.HeapsterRunOptions) error {
 	if len(opt.TLSClientCAFile) > 0 && len(opt.TLSCertFile) == 0 {
 		return fmt.Errorf("client cert authentication requires TLS certificate & key")
 	}
+	if len(opt.APIRedaction) > 0 && len(opt.TLSClientCAFile) == 0 {
+		return fmt.Errorf("API redaction requires client cert authentication")
+	}
+	if len(opt.EventSources) > 1 {
+		return fmt.Errorf("at most one event source can be specified")
+	}
+	if opt.PredictionWindow < opt.MetricResolution {
+		return fmt.Errorf("prediction window needs to be at least the metric resolution - %v", opt.PredictionWindow)
+	}
+	if opt.DiskPressureThreshold < 0 || opt.DiskPressureThreshold >= 1 {
+		return fmt.Errorf("disk pressure threshold needs to be between 0 and 1 - %v", opt.DiskPressureThreshold)
+	}
+	if opt.NetworkAttributionGapThreshold < 0 || opt.NetworkAttributionGapThreshold > 1 {
+		return fmt.Errorf("network attribution gap threshold needs to be between 0 and 1 - %v", opt.NetworkAttributionGapThreshold)
+	}
+	if opt.MinCompleteness < 0 || opt.MinCompleteness > 1 {
+		return fmt.Errorf("minimum completeness needs to be between 0 and 1 - %v", opt.MinCompleteness)
+	}
+	if opt.SnapshotLocation != "" && opt.SnapshotInterval < time.Minute {
+		return fmt.Errorf("snapshot interval needs to be at least a minute - %v", opt.SnapshotInterval)
+	}
+	if opt.SinkTransport.MaxIdleConnsPerHost < 0 || opt.SinkTransport.MaxConnsPerHost < 0 {
+		return fmt.Errorf("sink connection limits can't be negative")
+	}
+	if opt.SinkTransport.IdleConnTimeout < 0 || opt.SinkTransport.DNSCacheTTL < 0 {
+		return fmt.Errorf("sink idle connection timeout and DNS cache TTL can't be negative")
+	}
+	if opt.SinkBreakerFailures < 0 {
+		return fmt.Errorf("sink breaker failures can't be negative - %d", opt.SinkBreakerFailures)
+	}
+	if opt.SinkBreakerFailures > 0 && opt.SinkBreakerProbeInterval <= 0 {
+		return fmt.Errorf("sink breaker probe interval needs to be positive - %v", opt.SinkBreakerProbeInterval)
+	}
+	if opt.SizingReportInterval < 0 {
+		return fmt.Errorf("sizing report interval can't be negative - %v", opt.SizingReportInterval)
+	}
 	return nil
 }
 
@@ -0,0 +1,201 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package heapstertest provides utilities to test processors and sinks end-to-end: a fake
+// kubelet serving canned payloads to the real sources, a sink recording the exported batches
+// and a pipeline running them through the source and sink managers of heapster.
+package heapstertest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/kubelet"
+	"k8s.io/heapster/metrics/sources/summary"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/stats"
+	kube_client "k8s.io/kubernetes/pkg/kubelet/client"
+)
+
+const (
+	summaryPath    = "/stats/summary/"
+	containersPath = "/stats/container/"
+)
+
+// FakeKubelet is a kubelet serving the summary and the cadvisor containers it's given.
+// The summary endpoint returns 404 until a summary is set, like the kubelets which don't
+// support it.
+type FakeKubelet struct {
+	server *httptest.Server
+	sync.Mutex
+	summary    *stats.Summary
+	containers map[string]cadvisor.ContainerInfo
+	requests   map[string]int
+}
+
+// NewFakeKubelet starts a fake kubelet, which has to be closed once done.
+func NewFakeKubelet() *FakeKubelet {
+	this := &FakeKubelet{
+		containers: make(map[string]cadvisor.ContainerInfo),
+		requests:   make(map[string]int),
+	}
+	this.server = httptest.NewServer(http.HandlerFunc(this.serve))
+	return this
+}
+
+func (this *FakeKubelet) serve(w http.ResponseWriter, r *http.Request) {
+	this.Lock()
+	defer this.Unlock()
+	this.requests[r.URL.Path]++
+	var payload interface{}
+	switch r.URL.Path {
+	case summaryPath:
+		if this.summary == nil {
+			http.NotFound(w, r)
+			return
+		}
+		payload = this.summary
+	case containersPath:
+		payload = this.containers
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payload)
+}
+
+// SetSummary sets the summary served by the kubelet.
+func (this *FakeKubelet) SetSummary(summary *stats.Summary) {
+	this.Lock()
+	defer this.Unlock()
+	this.summary = summary
+}
+
+// SetContainers sets the cadvisor containers served by the kubelet.
+func (this *FakeKubelet) SetContainers(containers ...cadvisor.ContainerInfo) {
+	this.Lock()
+	defer this.Unlock()
+	this.containers = make(map[string]cadvisor.ContainerInfo, len(containers))
+	for _, container := range containers {
+		this.containers[container.Name] = container
+	}
+}
+
+// Requests returns the number of requests received on the path, e.g. /stats/summary/.
+func (this *FakeKubelet) Requests(path string) int {
+	this.Lock()
+	defer this.Unlock()
+	return this.requests[path]
+}
+
+// Host returns the address of the kubelet for the kubelet client.
+func (this *FakeKubelet) Host() kubelet.Host {
+	host, port, _ := net.SplitHostPort(this.server.Listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return kubelet.Host{IP: host, Port: portNumber}
+}
+
+// Client returns a kubelet client talking plain HTTP to the kubelet.
+func (this *FakeKubelet) Client() *kubelet.KubeletClient {
+	client, _ := kubelet.NewKubeletClient(&kube_client.KubeletClientConfig{
+		Port:        uint(this.Host().Port),
+		HTTPTimeout: 10 * time.Second,
+	})
+	return client
+}
+
+// KubeletSource returns the cadvisor source of the kubelet, running on the given node.
+func (this *FakeKubelet) KubeletSource(nodeName string) core.MetricsSource {
+	return kubelet.NewKubeletMetricsSource(this.Host(), this.Client(), nodeName, nodeName, nodeName)
+}
+
+// SummarySource returns the summary source of the kubelet, running on the given node. It
+// falls back to the cadvisor source if no summary is set.
+func (this *FakeKubelet) SummarySource(nodeName string) core.MetricsSource {
+	node := summary.NodeInfo{
+		Host:           this.Host(),
+		NodeName:       nodeName,
+		HostName:       nodeName,
+		HostID:         nodeName,
+		KubeletVersion: "v1.3.0",
+	}
+	return summary.NewSummaryMetricsSource(node, this.Client(), this.KubeletSource(nodeName))
+}
+
+func (this *FakeKubelet) Close() {
+	this.server.Close()
+}
+
+func uint64Value(value uint64) *uint64 {
+	return &value
+}
+
+// SampleSummary returns the summary of a node running a pod of the namespace with a single
+// container, whose node, pod and container metrics are all set.
+func SampleSummary(nodeName, namespace, podName string, now time.Time) *stats.Summary {
+	start := unversioned.NewTime(now.Add(-time.Hour))
+	sampleTime := unversioned.NewTime(now)
+	cpu := func(nanoCores uint64) *stats.CPUStats {
+		return &stats.CPUStats{
+			Time:                 sampleTime,
+			UsageNanoCores:       uint64Value(nanoCores),
+			UsageCoreNanoSeconds: uint64Value(nanoCores * 3600),
+		}
+	}
+	memory := func(bytes uint64) *stats.MemoryStats {
+		return &stats.MemoryStats{
+			Time:            sampleTime,
+			UsageBytes:      uint64Value(bytes),
+			WorkingSetBytes: uint64Value(bytes / 2),
+			RSSBytes:        uint64Value(bytes / 4),
+		}
+	}
+	return &stats.Summary{
+		Node: stats.NodeStats{
+			NodeName:  nodeName,
+			StartTime: start,
+			CPU:       cpu(2000000000),
+			Memory:    memory(4 << 30),
+			Network: &stats.NetworkStats{
+				Time:    sampleTime,
+				RxBytes: uint64Value(1 << 20),
+				TxBytes: uint64Value(2 << 20),
+			},
+			Fs: &stats.FsStats{
+				AvailableBytes: uint64Value(60 << 30),
+				CapacityBytes:  uint64Value(100 << 30),
+				UsedBytes:      uint64Value(40 << 30),
+			},
+		},
+		Pods: []stats.PodStats{{
+			PodRef:    stats.PodReference{Name: podName, Namespace: namespace, UID: namespace + "-" + podName},
+			StartTime: start,
+			Containers: []stats.ContainerStats{{
+				Name:      podName,
+				StartTime: start,
+				CPU:       cpu(100000000),
+				Memory:    memory(256 << 20),
+			}},
+		}},
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package heapstertest
+
+import (
+	"time"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks"
+	"k8s.io/heapster/metrics/sources"
+)
+
+// A provider of a fixed list of sources.
+type staticSourceProvider []core.MetricsSource
+
+func (this staticSourceProvider) GetMetricsSources() []core.MetricsSource {
+	return this
+}
+
+// Pipeline scrapes its sources, runs the batch through its processors and exports it to
+// its sinks, like a heapster housekeeping does, but on demand.
+type Pipeline struct {
+	source     core.MetricsSource
+	processors []core.DataProcessor
+	sink       core.DataSink
+}
+
+// NewPipeline creates a pipeline using the source and sink managers of heapster, so that the
+// sinks get the batches as they would in heapster, e.g. without raw samples if they don't
+// accept them.
+func NewPipeline(metricsSources []core.MetricsSource, processors []core.DataProcessor, dataSinks ...core.DataSink) (*Pipeline, error) {
+	sourceManager, err := sources.NewSourceManager(staticSourceProvider(metricsSources), sources.DefaultMetricsScrapeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	sinkManager, err := sinks.NewDataSinkManager(dataSinks, sinks.DefaultSinkExportDataTimeout, sinks.DefaultSinkStopTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{
+		source:     sourceManager,
+		processors: processors,
+		sink:       sinkManager,
+	}, nil
+}
+
+// Run scrapes the metrics between start and end and exports them, returning the processed
+// batch. The sinks receive the batch asynchronously, RecorderSink.WaitForBatches waits for it.
+func (this *Pipeline) Run(start, end time.Time) (*core.DataBatch, error) {
+	data := this.source.ScrapeMetrics(start, end)
+	for _, processor := range this.processors {
+		var err error
+		if data, err = processor.Process(data); err != nil {
+			return nil, err
+		}
+	}
+	this.sink.ExportData(data)
+	return data, nil
+}
+
+// Stop stops the sinks.
+func (this *Pipeline) Stop() {
+	this.sink.Stop()
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package heapstertest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/processors"
+)
+
+func TestPipeline(t *testing.T) {
+	kubelet := NewFakeKubelet()
+	defer kubelet.Close()
+	now := time.Now()
+	kubelet.SetSummary(SampleSummary("node1", "ns1", "pod1", now))
+
+	sink := NewRecorderSink("recorder")
+	pipeline, err := NewPipeline(
+		[]core.MetricsSource{kubelet.SummarySource("node1")},
+		[]core.DataProcessor{
+			processors.NewPodAggregator(),
+			&processors.NamespaceAggregator{MetricsToAggregate: []string{core.MetricMemoryUsage.Name}},
+		},
+		sink)
+	require.NoError(t, err)
+	defer pipeline.Stop()
+
+	data, err := pipeline.Run(now.Add(-time.Minute), now)
+	require.NoError(t, err)
+	batches, err := sink.WaitForBatches(1, 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, data, batches[0])
+	assert.Equal(t, 1, kubelet.Requests(summaryPath))
+
+	node := data.MetricSets[core.NodeKey("node1")]
+	require.NotNil(t, node)
+	assert.Equal(t, int64(4<<30), node.MetricValues[core.MetricMemoryUsage.Name].IntValue)
+	container := data.MetricSets[core.PodContainerKey("ns1", "pod1", "pod1")]
+	require.NotNil(t, container)
+	assert.Equal(t, int64(256<<20), container.MetricValues[core.MetricMemoryUsage.Name].IntValue)
+	namespace := data.MetricSets[core.NamespaceKey("ns1")]
+	require.NotNil(t, namespace)
+	assert.Equal(t, int64(256<<20), namespace.MetricValues[core.MetricMemoryUsage.Name].IntValue)
+}
+
+func TestFakeKubeletFallback(t *testing.T) {
+	kubelet := NewFakeKubelet()
+	defer kubelet.Close()
+
+	// Without a summary the summary source falls back to cadvisor.
+	source := kubelet.SummarySource("node1")
+	source.ScrapeMetrics(time.Now().Add(-time.Minute), time.Now())
+	assert.Equal(t, 1, kubelet.Requests(summaryPath))
+	assert.Equal(t, 1, kubelet.Requests(containersPath))
+}
+
+func TestRecorderSinkTimeout(t *testing.T) {
+	sink := NewRecorderSink("recorder")
+	sink.ExportData(&core.DataBatch{})
+	batches, err := sink.WaitForBatches(1, time.Second)
+	require.NoError(t, err)
+	assert.Len(t, batches, 1)
+	assert.Equal(t, batches[0], sink.Latest())
+
+	_, err = sink.WaitForBatches(2, 10*time.Millisecond)
+	assert.Error(t, err)
+
+	// Timers firing right away don't leave the wait hanging.
+	for i := 0; i < 100; i++ {
+		_, err = sink.WaitForBatches(2, time.Microsecond)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package heapstertest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// RecorderSink is a sink recording the batches exported to it. It accepts raw samples and
+// histograms, unless told otherwise, so that it can stand for the sinks which do.
+type RecorderSink struct {
+	sync.Mutex
+	name    string
+	batches []*core.DataBatch
+	// Signaled whenever a batch is recorded.
+	cond             *sync.Cond
+	RejectRawSamples bool
+	RejectHistograms bool
+}
+
+func NewRecorderSink(name string) *RecorderSink {
+	this := &RecorderSink{name: name}
+	this.cond = sync.NewCond(&this.Mutex)
+	return this
+}
+
+func (this *RecorderSink) Name() string {
+	return this.name
+}
+
+func (this *RecorderSink) Stop() {}
+
+func (this *RecorderSink) ExportData(data *core.DataBatch) {
+	this.Lock()
+	defer this.Unlock()
+	this.batches = append(this.batches, data)
+	this.cond.Broadcast()
+}
+
+func (this *RecorderSink) AcceptsRawSamples() bool {
+	return !this.RejectRawSamples
+}
+
+func (this *RecorderSink) AcceptsHistograms() bool {
+	return !this.RejectHistograms
+}
+
+// Batches returns the batches exported so far, oldest first.
+func (this *RecorderSink) Batches() []*core.DataBatch {
+	this.Lock()
+	defer this.Unlock()
+	return append([]*core.DataBatch{}, this.batches...)
+}
+
+// Latest returns the last exported batch, or nil if none was.
+func (this *RecorderSink) Latest() *core.DataBatch {
+	this.Lock()
+	defer this.Unlock()
+	if len(this.batches) == 0 {
+		return nil
+	}
+	return this.batches[len(this.batches)-1]
+}
+
+// WaitForBatches waits until at least count batches were exported, and returns them.
+func (this *RecorderSink) WaitForBatches(count int, timeout time.Duration) ([]*core.DataBatch, error) {
+	// The timer is armed after the deadline is taken, so that it never fires before it.
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(deadline.Sub(time.Now()), func() {
+		this.Lock()
+		defer this.Unlock()
+		this.cond.Broadcast()
+	})
+	defer timer.Stop()
+
+	this.Lock()
+	defer this.Unlock()
+	for len(this.batches) < count {
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("got %d batches in %v, expected %d", len(this.batches), timeout, count)
+		}
+		this.cond.Wait()
+	}
+	return append([]*core.DataBatch{}, this.batches...), nil
+}
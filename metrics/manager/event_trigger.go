@@ -0,0 +1,117 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/events/core"
+	eventstore "k8s.io/heapster/events/store"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+const (
+	DefaultEventScrapeInterval = 10 * time.Second
+	// Older events, e.g. the ones listed when the event source starts, don't trigger scrapes.
+	maxTriggeringEventAge = time.Minute
+)
+
+// EventScrapeTrigger is an event sink scraping the node of the pods and nodes involved in events
+// with the given reasons, e.g. OOMKilling or Evicted, out of band, so that the resource usage
+// around the incident is captured at a higher resolution than the metric resolution. Every node
+// is scraped at most once per interval.
+type EventScrapeTrigger struct {
+	sync.Mutex
+	manager   Manager
+	podLister *cache.StoreToPodLister
+	reasons   map[string]bool
+	interval  time.Duration
+	// Time of the latest triggered scrape of every node.
+	lastScrapes map[string]time.Time
+}
+
+func NewEventScrapeTrigger(manager Manager, podLister *cache.StoreToPodLister, reasons []string, interval time.Duration) *EventScrapeTrigger {
+	trigger := &EventScrapeTrigger{
+		manager:     manager,
+		podLister:   podLister,
+		reasons:     make(map[string]bool, len(reasons)),
+		interval:    interval,
+		lastScrapes: make(map[string]time.Time),
+	}
+	for _, reason := range reasons {
+		trigger.reasons[reason] = true
+	}
+	return trigger
+}
+
+func (this *EventScrapeTrigger) Name() string {
+	return "Event Scrape Trigger"
+}
+
+func (this *EventScrapeTrigger) ExportEvents(batch *core.EventBatch) {
+	this.Lock()
+	defer this.Unlock()
+
+	for node, scraped := range this.lastScrapes {
+		if batch.Timestamp.Sub(scraped) >= this.interval {
+			delete(this.lastScrapes, node)
+		}
+	}
+
+	nodes := []string{}
+	for _, event := range batch.Events {
+		if !this.reasons[event.Reason] || batch.Timestamp.Sub(eventstore.EventTime(event)) > maxTriggeringEventAge {
+			continue
+		}
+		node := this.getNode(event.InvolvedObject.Kind, event.InvolvedObject.Namespace, event.InvolvedObject.Name, event.Source.Host)
+		if node == "" {
+			glog.V(2).Infof("Couldn't find the node of %s event %s/%s", event.Reason, event.Namespace, event.Name)
+			continue
+		}
+		if _, found := this.lastScrapes[node]; found {
+			continue
+		}
+		glog.V(1).Infof("Scraping node %s after %s event %s/%s", node, event.Reason, event.Namespace, event.Name)
+		this.lastScrapes[node] = batch.Timestamp
+		nodes = append(nodes, node)
+	}
+	if len(nodes) > 0 {
+		sort.Strings(nodes)
+		this.manager.ScrapeNodes(nodes)
+	}
+}
+
+// Returns the node of the involved object, or "" if it isn't known. The host reporting the event,
+// e.g. the kubelet evicting a pod, is the node unless the object is a pod scheduled elsewhere.
+func (this *EventScrapeTrigger) getNode(kind, namespace, name, host string) string {
+	switch kind {
+	case "Node":
+		return name
+	case "Pod":
+		if this.podLister != nil {
+			if pod, err := this.podLister.Pods(namespace).Get(name); err == nil && pod.Spec.NodeName != "" {
+				return pod.Spec.NodeName
+			}
+		}
+	}
+	return host
+}
+
+func (this *EventScrapeTrigger) Stop() {
+	// nothing needs to be done.
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/heapster/events/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+type fakeNodeScraper struct {
+	scrapes [][]string
+}
+
+func (this *fakeNodeScraper) Start() {}
+
+func (this *fakeNodeScraper) Stop() {}
+
+func (this *fakeNodeScraper) ScrapeNodes(nodes []string) {
+	this.scrapes = append(this.scrapes, nodes)
+}
+
+func triggeringEvent(name, reason, kind, namespace, object, host string, timestamp time.Time) *kube_api.Event {
+	return &kube_api.Event{
+		ObjectMeta: kube_api.ObjectMeta{Namespace: namespace, Name: name},
+		InvolvedObject: kube_api.ObjectReference{
+			Kind:      kind,
+			Namespace: namespace,
+			Name:      object,
+		},
+		Reason:        reason,
+		Source:        kube_api.EventSource{Component: "kubelet", Host: host},
+		LastTimestamp: unversioned.NewTime(timestamp),
+	}
+}
+
+func TestEventScrapeTrigger(t *testing.T) {
+	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	store.Add(&kube_api.Pod{
+		ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: "pod1"},
+		Spec:       kube_api.PodSpec{NodeName: "node2"},
+	})
+	scraper := &fakeNodeScraper{}
+	trigger := NewEventScrapeTrigger(scraper, &cache.StoreToPodLister{Indexer: store}, []string{"OOMKilling", "Evicted"}, 10*time.Second)
+
+	now := time.Now()
+	trigger.ExportEvents(&core.EventBatch{
+		Timestamp: now,
+		Events: []*kube_api.Event{
+			triggeringEvent("e1", "OOMKilling", "Node", "", "node1", "node1", now),
+			// The node of a known pod comes from its spec.
+			triggeringEvent("e2", "Evicted", "Pod", "ns1", "pod1", "other", now),
+			// The node of a deleted pod is the host reporting the event.
+			triggeringEvent("e3", "Evicted", "Pod", "ns1", "pod2", "node3", now),
+			triggeringEvent("e4", "Scheduled", "Pod", "ns1", "pod3", "node4", now),
+			triggeringEvent("e5", "Evicted", "Pod", "ns1", "pod4", "node5", now.Add(-time.Hour)),
+			triggeringEvent("e6", "Evicted", "Pod", "ns1", "pod5", "", now),
+		},
+	})
+	assert.Equal(t, [][]string{{"node1", "node2", "node3"}}, scraper.scrapes)
+
+	// Nodes are scraped at most once per interval.
+	trigger.ExportEvents(&core.EventBatch{
+		Timestamp: now.Add(5 * time.Second),
+		Events: []*kube_api.Event{
+			triggeringEvent("e7", "OOMKilling", "Node", "", "node1", "node1", now.Add(5*time.Second)),
+		},
+	})
+	assert.Equal(t, 1, len(scraper.scrapes))
+
+	trigger.ExportEvents(&core.EventBatch{
+		Timestamp: now.Add(10 * time.Second),
+		Events: []*kube_api.Event{
+			triggeringEvent("e7", "OOMKilling", "Node", "", "node1", "node1", now.Add(10*time.Second)),
+		},
+	})
+	assert.Equal(t, [][]string{{"node1", "node2", "node3"}, {"node1"}}, scraper.scrapes)
+}
@@ -48,6 +48,9 @@ func init() {
 type Manager interface {
 	Start()
 	Stop()
+	// Scrapes the given nodes out of band, in between the regular scrapes, and exports the
+	// batch asynchronously. Does nothing if the source can't scrape single nodes.
+	ScrapeNodes(nodes []string)
 }
 
 type realManager struct {
@@ -125,24 +128,47 @@ func (rm *realManager) housekeep(start, end time.Time) {
 	go func(rm *realManager) {
 		// should always give back the semaphore
 		defer func() { rm.housekeepSemaphoreChan <- struct{}{} }()
-		data := rm.source.ScrapeMetrics(start, end)
-
-		for _, p := range rm.processors {
-			newData, err := process(p, data)
-			if err == nil {
-				data = newData
-			} else {
-				glog.Errorf("Error in processor: %v", err)
-				return
-			}
-		}
+		rm.processAndExport(rm.source.ScrapeMetrics(start, end))
+	}(rm)
+}
+
+func (rm *realManager) ScrapeNodes(nodes []string) {
+	source, ok := rm.source.(core.NodeScrapingSource)
+	if !ok || len(nodes) == 0 {
+		return
+	}
+
+	go func(rm *realManager) {
+		select {
+		case <-rm.housekeepSemaphoreChan:
+			// ok, good to go
 
-		// Export data to sinks
-		rm.sink.ExportData(data)
+		case <-time.After(rm.housekeepTimeout):
+			glog.Warningf("Spent too long waiting for the out of band scrape of %v to start", nodes)
+			return
+		}
+		defer func() { rm.housekeepSemaphoreChan <- struct{}{} }()
 
+		end := time.Now()
+		rm.processAndExport(source.ScrapeNodeMetrics(nodes, end.Add(-rm.resolution), end))
 	}(rm)
 }
 
+func (rm *realManager) processAndExport(data *core.DataBatch) {
+	for _, p := range rm.processors {
+		newData, err := process(p, data)
+		if err == nil {
+			data = newData
+		} else {
+			glog.Errorf("Error in processor: %v", err)
+			return
+		}
+	}
+
+	// Export data to sinks
+	rm.sink.ExportData(data)
+}
+
 func process(p core.DataProcessor, data *core.DataBatch) (*core.DataBatch, error) {
 	startTime := time.Now()
 	defer processorDuration.
@@ -20,6 +20,7 @@ import (
 	"github.com/spf13/pflag"
 
 	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/common/transport"
 	genericoptions "k8s.io/kubernetes/pkg/genericapiserver/options"
 )
 
@@ -34,11 +35,41 @@ type HeapsterRunOptions struct {
 	TLSKeyFile       string
 	TLSClientCAFile  string
 	AllowedUsers     string
+	APIRedaction     string
 	Sources          flags.Uris
+	SourcePlugins    flags.Uris
 	Sinks            flags.Uris
 	HistoricalSource string
+	EventSources     flags.Uris
+	EventRetention   time.Duration
+	EventScrape      string
 	Version          bool
 	LabelSeperator   string
+	KeyTemplates     string
+
+	NetworkInterfaceInclude        string
+	NetworkInterfaceExclude        string
+	MinCompleteness                float64
+	PredictionWindow               time.Duration
+	DiskPressureThreshold          float64
+	NetworkAttributionGapThreshold float64
+	MetadataFile                   string
+	CustomMetricPolicy             string
+	CustomMetricPolicyEvents       bool
+	SizingReportInterval           time.Duration
+	VerticalSizing                 bool
+	SnapshotLocation               string
+	SnapshotInterval               time.Duration
+	SnapshotRestore                bool
+	LabelCorrections               bool
+	Canary                         string
+	CanaryPeriod                   int
+	EnableUI                       bool
+	SinkConfig                     string
+	PodIdentity                    string
+	SinkTransport                  transport.Options
+	SinkBreakerFailures            int
+	SinkBreakerProbeInterval       time.Duration
 }
 
 func NewHeapsterRunOptions() *HeapsterRunOptions {
@@ -52,7 +83,15 @@ func (h *HeapsterRunOptions) AddFlags(fs *pflag.FlagSet) {
 	h.ServerRunOptions.AddUniversalFlags(pflag.CommandLine)
 
 	fs.Var(&h.Sources, "source", "source(s) to watch")
+	fs.Var(&h.SourcePlugins, "source_plugin", "external source plugin(s) whose metric sets are added to the ones of the source, e.g. exec:/path/to/plugin?arg=--flag")
 	fs.Var(&h.Sinks, "sink", "external sink(s) that receive data")
+	fs.StringVar(&h.SinkConfig, "sink_config", "", "File listing additional sinks, one per line in the --sink format, e.g. a mounted ConfigMap. Reloaded when modified, adding, removing and reconfiguring the sinks without a restart. Empty to disable")
+	fs.IntVar(&h.SinkTransport.MaxIdleConnsPerHost, "sink_max_idle_conns_per_host", transport.DefaultOptions.MaxIdleConnsPerHost, "Idle connections kept open by the http sinks to each backend host, reused by the next exports")
+	fs.DurationVar(&h.SinkTransport.IdleConnTimeout, "sink_idle_conn_timeout", transport.DefaultOptions.IdleConnTimeout, "How long the http sinks keep an idle connection open")
+	fs.IntVar(&h.SinkTransport.MaxConnsPerHost, "sink_max_conns_per_host", transport.DefaultOptions.MaxConnsPerHost, "Connections opened at once by an http sink to each backend host. 0 for no limit")
+	fs.DurationVar(&h.SinkTransport.DNSCacheTTL, "sink_dns_cache_ttl", transport.DefaultOptions.DNSCacheTTL, "How long the http sinks use the resolved addresses of a backend host, regardless of the TTL of its DNS records. 0 to resolve them on every connection")
+	fs.IntVar(&h.SinkBreakerFailures, "sink_breaker_failures", 0, "Consecutive failed exports after which no more batches are pushed to a sink, but a probe every --sink_breaker_probe_interval. 0 to disable")
+	fs.DurationVar(&h.SinkBreakerProbeInterval, "sink_breaker_probe_interval", time.Minute, "Interval at which a sink failing persistently is probed with a single batch, pushing the batches to it again once one succeeds")
 	fs.DurationVar(&h.MetricResolution, "metric_resolution", 60*time.Second, "The resolution at which heapster will retain metrics.")
 
 	// TODO: Revise these flags before Heapster v1.3 and Kubernetes v1.5
@@ -66,7 +105,31 @@ func (h *HeapsterRunOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&h.TLSKeyFile, "tls_key", "", "file containing TLS key")
 	fs.StringVar(&h.TLSClientCAFile, "tls_client_ca", "", "file containing TLS client CA for client cert validation")
 	fs.StringVar(&h.AllowedUsers, "allowed_users", "", "comma-separated list of allowed users")
+	fs.StringVar(&h.APIRedaction, "api_redaction_config", "", "YAML or JSON file with the rules hiding label values and entities from the API clients matching their certificate users or groups, e.g. the pod names from read-only tenants. Requires --tls_client_ca. Empty to disable")
 	fs.StringVar(&h.HistoricalSource, "historical_source", "", "which source type to use for the historical API (should be exactly the same as one of the sink URIs), or empty to disable the historical API")
+	fs.Var(&h.EventSources, "event_source", "source to read events from for the API joining events and metrics, in the same format as the eventer --source flag, or empty to disable that API")
+	fs.DurationVar(&h.EventRetention, "event_retention", time.Hour, "How long events are kept for the API joining events and metrics")
+	fs.StringVar(&h.EventScrape, "event_scrape", "OOMKilling,Evicted", "Comma-separated list of event reasons which trigger an out of band scrape of the node of the involved pod or node, if --event_source is set. Empty to disable")
 	fs.BoolVar(&h.Version, "version", false, "print version info and exit")
 	fs.StringVar(&h.LabelSeperator, "label_seperator", ",", "seperator used for joining labels")
+	fs.StringVar(&h.KeyTemplates, "metric_set_key_templates", "", "YAML file of the templates of the keys of the metric sets, by entity, for the systems joining on them. Empty for the default keys")
+	fs.StringVar(&h.NetworkInterfaceInclude, "network_interface_include", "", "regexp of network interface names taken into account by the network metrics, e.g. '^eth'. Empty to include all interfaces")
+	fs.StringVar(&h.NetworkInterfaceExclude, "network_interface_exclude", "", "regexp of network interface names ignored by the network metrics, e.g. '^(lo|veth.*|cali.*)$'. Empty to exclude none")
+	fs.DurationVar(&h.PredictionWindow, "prediction_window", 15*time.Minute, "The period over which the trends of memory and filesystem usage are computed to estimate the time before they run out")
+	fs.Float64Var(&h.DiskPressureThreshold, "disk_pressure_threshold", 0.1, "share of a node filesystem, between 0 and 1, below which the available bytes cause disk pressure, like the kubelet nodefs.available eviction threshold")
+	fs.Float64Var(&h.NetworkAttributionGapThreshold, "network_attribution_gap_threshold", 0.5, "share of the network traffic of a node, between 0 and 1, not attributed to its pods above which a warning is logged. 0 to never warn")
+	fs.Float64Var(&h.MinCompleteness, "min_completeness", 0, "share of the ready nodes scraped and of the running pods covered, between 0 and 1, below which data batches are marked degraded for the sinks. 0 to never mark them")
+	fs.DurationVar(&h.SizingReportInterval, "sizing_report_interval", 10*time.Minute, "How often the resource requests recommended for heapster are logged. 0 to never log them")
+	fs.BoolVar(&h.VerticalSizing, "vertical_sizing", false, "Warn when the limits of the heapster container are below the resource requests recommended for the size of the cluster")
+	fs.StringVar(&h.SnapshotLocation, "snapshot_location", "", "Object storage location where snapshots of the model are uploaded, e.g. gs://<bucket>/<object> or s3://<bucket>/<object>?region=<region>. Empty to disable snapshots")
+	fs.DurationVar(&h.SnapshotInterval, "snapshot_interval", 5*time.Minute, "How often the model snapshot is uploaded")
+	fs.BoolVar(&h.SnapshotRestore, "snapshot_restore", true, "Restore the model from the latest snapshot at startup, if --snapshot_location is set")
+	fs.BoolVar(&h.LabelCorrections, "label_corrections", false, "Enable the /api/v1/admin/label-corrections endpoint, which corrects a mistaken label value in the in-memory history and in all the future batches")
+	fs.StringVar(&h.Canary, "canary", "", "Pattern of a synthetic canary series sent through the pipeline to every sink to verify delivery and latency: 'constant' or 'sawtooth'. Empty to disable")
+	fs.IntVar(&h.CanaryPeriod, "canary_period", 10, "Number of scrapes after which the sawtooth canary series wraps around to 0")
+	fs.StringVar(&h.CustomMetricPolicy, "custom_metric_policy", "", "YAML or JSON file with the policy of the names, label keys and value types of the custom metrics. The custom metrics violating it are dropped. Empty to disable")
+	fs.BoolVar(&h.CustomMetricPolicyEvents, "custom_metric_policy_events", false, "Post a warning event on the pods exporting custom metrics which violate --custom_metric_policy, at most once an hour per metric")
+	fs.BoolVar(&h.EnableUI, "ui", false, "Serve a minimal web UI on /ui/ showing the utilization of the cluster, nodes, namespaces and pods, and the recent events if --event_source is set")
+	fs.StringVar(&h.PodIdentity, "pod_identity", "uid", "Value of the pod_id label: 'uid' for the pod UID, which changes on every restart, or 'name' for the namespace/name of the StatefulSet pods, so that the history of each replica isn't split across restarts")
+	fs.StringVar(&h.MetadataFile, "metadata_file", "", "YAML, JSON or CSV file mapping namespaces and pod name patterns to labels added to the pod, container and namespace metrics. Reloaded when modified. Empty to disable")
 }
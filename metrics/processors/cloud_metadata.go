@@ -0,0 +1,131 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"strings"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	CloudProviderGCE   = "gce"
+	CloudProviderAWS   = "aws"
+	CloudProviderAzure = "azure"
+
+	CapacitySpot     = "spot"
+	CapacityOnDemand = "on_demand"
+)
+
+// Node labels holding the instance type and the zone, newest first.
+var (
+	instanceTypeLabels = []string{"node.kubernetes.io/instance-type", "beta.kubernetes.io/instance-type"}
+	zoneLabels         = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+)
+
+// Node labels set by the cloud providers or their node pools, mapping label values of spot
+// (or preemptible) instances to the provider.
+var spotLabels = []struct {
+	provider string
+	label    string
+	value    string
+}{
+	{CloudProviderGCE, "cloud.google.com/gke-preemptible", "true"},
+	{CloudProviderGCE, "cloud.google.com/gke-spot", "true"},
+	{CloudProviderAWS, "eks.amazonaws.com/capacityType", "SPOT"},
+	{CloudProviderAWS, "node.kubernetes.io/lifecycle", "spot"},
+	{CloudProviderAzure, "kubernetes.azure.com/scalesetpriority", "spot"},
+}
+
+// Prefixes of the labels identifying the provider of the nodes without a provider ID.
+var providerLabelPrefixes = map[string]string{
+	"cloud.google.com/":     CloudProviderGCE,
+	"eks.amazonaws.com/":    CloudProviderAWS,
+	"kubernetes.azure.com/": CloudProviderAzure,
+}
+
+// cloudMetadata returns the labels describing the cloud instance of the node, from its labels
+// and its provider ID, e.g. gce://<project>/<zone>/<name> or aws:///<zone>/<instance id>.
+// No label is returned for nodes of an unknown provider.
+func cloudMetadata(node *kube_api.Node) map[string]string {
+	provider, zone := parseProviderID(node.Spec.ProviderID)
+	if provider == "" {
+		for label := range node.Labels {
+			for prefix, labelProvider := range providerLabelPrefixes {
+				if strings.HasPrefix(label, prefix) {
+					provider = labelProvider
+				}
+			}
+		}
+	}
+	if provider == "" {
+		return map[string]string{}
+	}
+
+	result := map[string]string{
+		core.LabelCloudProvider.Key: provider,
+		core.LabelCapacityType.Key:  CapacityOnDemand,
+	}
+	if instanceType := firstLabel(node, instanceTypeLabels); instanceType != "" {
+		result[core.LabelInstanceType.Key] = instanceType
+	}
+	if labelZone := firstLabel(node, zoneLabels); labelZone != "" {
+		zone = labelZone
+	}
+	if zone != "" {
+		result[core.LabelZone.Key] = zone
+	}
+	for _, spot := range spotLabels {
+		if spot.provider == provider && node.Labels[spot.label] == spot.value {
+			result[core.LabelCapacityType.Key] = CapacitySpot
+		}
+	}
+	return result
+}
+
+func firstLabel(node *kube_api.Node, labels []string) string {
+	for _, label := range labels {
+		if value := node.Labels[label]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Returns the provider of a provider ID and the zone it holds, if any.
+func parseProviderID(providerID string) (string, string) {
+	parts := strings.SplitN(providerID, "://", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	path := strings.Split(strings.TrimPrefix(parts[1], "/"), "/")
+	switch parts[0] {
+	case CloudProviderGCE:
+		if len(path) == 3 {
+			return CloudProviderGCE, path[1]
+		}
+		return CloudProviderGCE, ""
+	case CloudProviderAWS:
+		if len(path) == 2 {
+			return CloudProviderAWS, path[0]
+		}
+		return CloudProviderAWS, ""
+	case CloudProviderAzure:
+		return CloudProviderAzure, ""
+	default:
+		return "", ""
+	}
+}
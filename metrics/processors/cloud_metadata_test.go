@@ -0,0 +1,104 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+func TestCloudMetadata(t *testing.T) {
+	for _, test := range []struct {
+		providerID string
+		labels     map[string]string
+		expected   map[string]string
+	}{
+		{
+			providerID: "gce://project/us-central1-b/gke-pool-1",
+			labels: map[string]string{
+				"beta.kubernetes.io/instance-type": "n1-standard-4",
+				"cloud.google.com/gke-preemptible": "true",
+			},
+			expected: map[string]string{
+				core.LabelCloudProvider.Key: CloudProviderGCE,
+				core.LabelInstanceType.Key:  "n1-standard-4",
+				core.LabelZone.Key:          "us-central1-b",
+				core.LabelCapacityType.Key:  CapacitySpot,
+			},
+		},
+		{
+			providerID: "aws:///us-east-1a/i-0123456789",
+			labels: map[string]string{
+				"node.kubernetes.io/instance-type":       "m5.large",
+				"beta.kubernetes.io/instance-type":       "m4.large",
+				"failure-domain.beta.kubernetes.io/zone": "us-east-1c",
+			},
+			expected: map[string]string{
+				core.LabelCloudProvider.Key: CloudProviderAWS,
+				core.LabelInstanceType.Key:  "m5.large",
+				core.LabelZone.Key:          "us-east-1c",
+				core.LabelCapacityType.Key:  CapacityOnDemand,
+			},
+		},
+		{
+			// No provider ID, the provider is found from the labels.
+			labels: map[string]string{
+				"eks.amazonaws.com/capacityType": "SPOT",
+			},
+			expected: map[string]string{
+				core.LabelCloudProvider.Key: CloudProviderAWS,
+				core.LabelCapacityType.Key:  CapacitySpot,
+			},
+		},
+		{
+			providerID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/pool/virtualMachines/0",
+			labels: map[string]string{
+				"kubernetes.azure.com/scalesetpriority": "spot",
+				"topology.kubernetes.io/zone":           "westeurope-1",
+			},
+			expected: map[string]string{
+				core.LabelCloudProvider.Key: CloudProviderAzure,
+				core.LabelZone.Key:          "westeurope-1",
+				core.LabelCapacityType.Key:  CapacitySpot,
+			},
+		},
+		{
+			// The spot label of another provider is ignored.
+			providerID: "gce://project/europe-west1-d/node",
+			labels: map[string]string{
+				"eks.amazonaws.com/capacityType": "SPOT",
+			},
+			expected: map[string]string{
+				core.LabelCloudProvider.Key: CloudProviderGCE,
+				core.LabelZone.Key:          "europe-west1-d",
+				core.LabelCapacityType.Key:  CapacityOnDemand,
+			},
+		},
+		{
+			providerID: "",
+			labels:     map[string]string{"beta.kubernetes.io/instance-type": "bare-metal"},
+			expected:   map[string]string{},
+		},
+	} {
+		node := &kube_api.Node{
+			ObjectMeta: kube_api.ObjectMeta{Name: "node", Labels: test.labels},
+			Spec:       kube_api.NodeSpec{ProviderID: test.providerID},
+		}
+		assert.Equal(t, test.expected, cloudMetadata(node), test.providerID)
+	}
+}
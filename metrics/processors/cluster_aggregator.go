@@ -25,17 +25,30 @@ func (this *ClusterAggregator) Name() string {
 }
 
 func (this *ClusterAggregator) Process(batch *core.DataBatch) (*core.DataBatch, error) {
-	clusterKey := core.ClusterKey()
-	cluster := clusterMetricSet()
+	// The cluster would miss the other nodes.
+	if batch.OutOfBand {
+		return batch, nil
+	}
+	// One cluster set per federated cluster, the primary one being always set.
+	clusters := map[string]*core.MetricSet{core.ClusterKey(): clusterMetricSet()}
 	for _, metricSet := range batch.MetricSets {
 		if metricSetType, found := metricSet.Labels[core.LabelMetricSetType.Key]; found &&
 			(metricSetType == core.MetricSetTypeNamespace || metricSetType == core.MetricSetTypeSystemContainer) {
+			clusterKey := core.ScopedKey(metricSet.Labels, core.ClusterKey())
+			cluster, found := clusters[clusterKey]
+			if !found {
+				cluster = clusterMetricSet()
+				copyClusterLabel(metricSet, cluster)
+				clusters[clusterKey] = cluster
+			}
 			if err := aggregate(metricSet, cluster, this.MetricsToAggregate); err != nil {
 				return nil, err
 			}
 		}
 	}
-	batch.MetricSets[clusterKey] = cluster
+	for key, cluster := range clusters {
+		batch.MetricSets[key] = cluster
+	}
 	return batch, nil
 }
 
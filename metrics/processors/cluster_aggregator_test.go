@@ -82,3 +82,38 @@ func TestClusterAggregate(t *testing.T) {
 	assert.True(t, found)
 	assert.Equal(t, int64(30), m3.IntValue)
 }
+
+func TestClusterAggregateFederated(t *testing.T) {
+	core.SetPrimaryCluster("c1")
+	defer core.SetPrimaryCluster("")
+
+	namespace := func(cluster string, value int64) *core.MetricSet {
+		return &core.MetricSet{
+			Labels: map[string]string{
+				core.LabelMetricSetType.Key: core.MetricSetTypeNamespace,
+				core.LabelClusterName.Key:   cluster,
+			},
+			MetricValues: map[string]core.MetricValue{
+				"m1": {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: value},
+			},
+		}
+	}
+	batch := core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			core.NamespaceKey("ns1"):                              namespace("c1", 10),
+			core.ClusterScopedKey("c2", core.NamespaceKey("ns1")): namespace("c2", 100),
+		},
+	}
+	processor := ClusterAggregator{
+		MetricsToAggregate: []string{"m1"},
+	}
+	result, err := processor.Process(&batch)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), result.MetricSets[core.ClusterKey()].MetricValues["m1"].IntValue)
+	other := result.MetricSets["cluster:c2/cluster"]
+	if assert.NotNil(t, other) {
+		assert.Equal(t, int64(100), other.MetricValues["m1"].IntValue)
+		assert.Equal(t, "c2", other.Labels[core.LabelClusterName.Key])
+	}
+}
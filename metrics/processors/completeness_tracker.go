@@ -0,0 +1,152 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+var (
+	completenessNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "completeness",
+			Name:      "nodes",
+			Help:      "Number of nodes scraped and expected in the latest data batch.",
+		},
+		[]string{"state"},
+	)
+
+	completenessPods = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "completeness",
+			Name:      "pods",
+			Help:      "Number of running pods covered by and expected in the latest data batch.",
+		},
+		[]string{"state"},
+	)
+
+	completenessDegraded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "completeness",
+			Name:      "degraded",
+			Help:      "1 if the latest data batch is below the minimum completeness, 0 otherwise.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(completenessNodes)
+	prometheus.MustRegister(completenessPods)
+	prometheus.MustRegister(completenessDegraded)
+}
+
+// CompletenessTracker computes the share of the ready nodes and running pods covered by
+// each batch, and marks the batch degraded when either is below the minimum completeness.
+type CompletenessTracker struct {
+	nodeLister      *cache.StoreToNodeLister
+	podLister       *cache.StoreToPodLister
+	minCompleteness float64
+}
+
+func (this *CompletenessTracker) Name() string {
+	return "completeness_tracker"
+}
+
+func (this *CompletenessTracker) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	// Out of band batches cover a few nodes on purpose.
+	if batch.OutOfBand {
+		return batch, nil
+	}
+	completeness := &core.Completeness{}
+
+	nodes, err := this.nodeLister.List()
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool, len(nodes.Items))
+	for _, node := range nodes.Items {
+		listed[node.Name] = true
+		if !isNodeReady(&node) {
+			continue
+		}
+		completeness.NodesExpected++
+		if _, found := batch.MetricSets[core.NodeKey(node.Name)]; found {
+			completeness.NodesScraped++
+		}
+	}
+
+	pods, err := this.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		// The pods of the nodes left out by the node selector of the source aren't expected.
+		if pod.Status.Phase != kube_api.PodRunning || (pod.Spec.NodeName != "" && !listed[pod.Spec.NodeName]) {
+			continue
+		}
+		completeness.PodsRunning++
+		if _, found := batch.MetricSets[core.PodKey(pod.Namespace, pod.Name)]; found {
+			completeness.PodsCovered++
+		}
+	}
+
+	completeness.Degraded = completeness.NodeRatio() < this.minCompleteness || completeness.PodRatio() < this.minCompleteness
+	if completeness.Degraded {
+		glog.Warningf("Data batch at %v is degraded: %d/%d nodes scraped, %d/%d running pods covered", batch.Timestamp,
+			completeness.NodesScraped, completeness.NodesExpected, completeness.PodsCovered, completeness.PodsRunning)
+	}
+
+	completenessNodes.WithLabelValues("scraped").Set(float64(completeness.NodesScraped))
+	completenessNodes.WithLabelValues("expected").Set(float64(completeness.NodesExpected))
+	completenessPods.WithLabelValues("covered").Set(float64(completeness.PodsCovered))
+	completenessPods.WithLabelValues("running").Set(float64(completeness.PodsRunning))
+	if completeness.Degraded {
+		completenessDegraded.Set(1)
+	} else {
+		completenessDegraded.Set(0)
+	}
+
+	batch.Completeness = completeness
+	return batch, nil
+}
+
+// Nodes without a ready condition are scraped by the kubelet source, so they are expected.
+func isNodeReady(node *kube_api.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == kube_api.NodeReady {
+			return condition.Status == kube_api.ConditionTrue
+		}
+	}
+	return true
+}
+
+// NewCompletenessTracker creates a tracker marking batches degraded below the given
+// completeness, between 0 and 1. A zero minimum never marks batches degraded.
+func NewCompletenessTracker(nodeLister *cache.StoreToNodeLister, podLister *cache.StoreToPodLister, minCompleteness float64) *CompletenessTracker {
+	return &CompletenessTracker{
+		nodeLister:      nodeLister,
+		podLister:       podLister,
+		minCompleteness: minCompleteness,
+	}
+}
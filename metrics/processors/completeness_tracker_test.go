@@ -0,0 +1,106 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+func TestCompletenessTracker(t *testing.T) {
+	nodeLister := &cache.StoreToNodeLister{Store: cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	for _, node := range []struct {
+		name   string
+		status kube_api.ConditionStatus
+	}{
+		{"node1", kube_api.ConditionTrue},
+		{"node2", kube_api.ConditionTrue},
+		{"node3", kube_api.ConditionFalse},
+	} {
+		nodeLister.Store.Add(&kube_api.Node{
+			ObjectMeta: kube_api.ObjectMeta{Name: node.name},
+			Status: kube_api.NodeStatus{
+				Conditions: []kube_api.NodeCondition{{Type: kube_api.NodeReady, Status: node.status}},
+			},
+		})
+	}
+
+	podLister := &cache.StoreToPodLister{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})}
+	for _, pod := range []struct {
+		name  string
+		phase kube_api.PodPhase
+	}{
+		{"pod1", kube_api.PodRunning},
+		{"pod2", kube_api.PodRunning},
+		{"pod3", kube_api.PodRunning},
+		{"pod4", kube_api.PodPending},
+	} {
+		podLister.Indexer.Add(&kube_api.Pod{
+			ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: pod.name},
+			Status:     kube_api.PodStatus{Phase: pod.phase},
+		})
+	}
+	// Running on a node left out by the node selector.
+	podLister.Indexer.Add(&kube_api.Pod{
+		ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: "pod5"},
+		Spec:       kube_api.PodSpec{NodeName: "windows1"},
+		Status:     kube_api.PodStatus{Phase: kube_api.PodRunning},
+	})
+
+	batch := &core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			core.NodeKey("node1"):       {},
+			core.NodeKey("node2"):       {},
+			core.PodKey("ns1", "pod1"):  {},
+			core.PodKey("ns1", "pod2"):  {},
+			core.PodKey("ns1", "pod4"):  {},
+			core.ClusterKey():           {},
+			core.NamespaceKey("ns1"):    {},
+			core.NodeKey("unknownNode"): {},
+		},
+	}
+
+	tracker := NewCompletenessTracker(nodeLister, podLister, 0.5)
+	batch, err := tracker.Process(batch)
+	require.NoError(t, err)
+	assert.Equal(t, &core.Completeness{
+		NodesScraped:  2,
+		NodesExpected: 2,
+		PodsCovered:   2,
+		PodsRunning:   3,
+	}, batch.Completeness)
+	assert.InDelta(t, 2.0/3, batch.Completeness.PodRatio(), 1e-9)
+
+	tracker = NewCompletenessTracker(nodeLister, podLister, 0.9)
+	batch, err = tracker.Process(batch)
+	require.NoError(t, err)
+	assert.True(t, batch.Completeness.Degraded)
+
+	delete(batch.MetricSets, core.NodeKey("node1"))
+	delete(batch.MetricSets, core.NodeKey("node2"))
+	tracker = NewCompletenessTracker(nodeLister, podLister, 0)
+	batch, err = tracker.Process(batch)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, batch.Completeness.NodeRatio())
+	assert.False(t, batch.Completeness.Degraded)
+}
@@ -0,0 +1,263 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+// Reasons of the rejection of a custom metric.
+const (
+	RejectedName       = "name"
+	RejectedLabelKey   = "label_key"
+	RejectedValueType  = "value_type"
+	RejectedUndeclared = "undeclared"
+)
+
+// How often an event is posted for the same rejected metric of a pod.
+const customMetricEventInterval = time.Hour
+
+var customMetricsRejected = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "heapster",
+		Subsystem: "custom_metrics",
+		Name:      "rejected_total",
+		Help:      "Number of custom metric values dropped because they violate the custom metric policy, by reason.",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(customMetricsRejected)
+}
+
+// CustomMetricPolicy is the schema the custom metrics have to follow. The names are given
+// without the `custom/` prefix.
+type CustomMetricPolicy struct {
+	// Regular expression the names have to match, any name if empty.
+	NamePattern string `json:"namePattern"`
+	// Regular expression the keys of the labels of the labeled custom metrics have to match.
+	LabelKeyPattern string `json:"labelKeyPattern"`
+	// Value types allowed: int64, double or distribution. All if empty.
+	ValueTypes []string `json:"valueTypes"`
+	// Value type of the declared metrics, by name.
+	Metrics map[string]string `json:"metrics"`
+	// Whether the metrics not declared are rejected.
+	Strict bool `json:"strict"`
+
+	nameRegexp     *regexp.Regexp
+	labelKeyRegexp *regexp.Regexp
+}
+
+var customMetricValueTypes = map[string]bool{"int64": true, "double": true, "distribution": true}
+
+func (this *CustomMetricPolicy) compile() error {
+	var err error
+	if this.NamePattern != "" {
+		if this.nameRegexp, err = regexp.Compile(this.NamePattern); err != nil {
+			return fmt.Errorf("invalid name pattern - %v", err)
+		}
+	}
+	if this.LabelKeyPattern != "" {
+		if this.labelKeyRegexp, err = regexp.Compile(this.LabelKeyPattern); err != nil {
+			return fmt.Errorf("invalid label key pattern - %v", err)
+		}
+	}
+	for _, valueType := range this.ValueTypes {
+		if !customMetricValueTypes[valueType] {
+			return fmt.Errorf("invalid value type %q", valueType)
+		}
+	}
+	for name, valueType := range this.Metrics {
+		if !customMetricValueTypes[valueType] {
+			return fmt.Errorf("invalid value type %q of metric %s", valueType, name)
+		}
+	}
+	return nil
+}
+
+// Returns why the metric violates the policy, or an empty string if it doesn't.
+func (this *CustomMetricPolicy) violation(name string, value core.MetricValue, labels map[string]string) string {
+	if this.nameRegexp != nil && !this.nameRegexp.MatchString(name) {
+		return RejectedName
+	}
+	declared, found := this.Metrics[name]
+	if !found && this.Strict {
+		return RejectedUndeclared
+	}
+	valueType := value.ValueType.String()
+	if found && valueType != declared {
+		return RejectedValueType
+	}
+	if !found && len(this.ValueTypes) > 0 && !containsString(this.ValueTypes, valueType) {
+		return RejectedValueType
+	}
+	if this.labelKeyRegexp != nil {
+		for key := range labels {
+			if !this.labelKeyRegexp.MatchString(key) {
+				return RejectedLabelKey
+			}
+		}
+	}
+	return ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// EventPoster posts the events about the pods exporting rejected metrics, e.g. the events client of
+// the API server.
+type EventPoster interface {
+	Create(event *kube_api.Event) (*kube_api.Event, error)
+}
+
+// CustomMetricValidator drops the custom metrics violating the policy, so that one exporter doesn't
+// break the naming conventions of all the sinks, counts them and optionally posts a warning event
+// on their pod.
+type CustomMetricValidator struct {
+	policy CustomMetricPolicy
+	events EventPoster
+
+	lock sync.Mutex
+	// Time of the last event posted, by pod, metric and reason.
+	posted map[string]time.Time
+}
+
+func (this *CustomMetricValidator) Name() string {
+	return "custom_metric_validator"
+}
+
+func (this *CustomMetricValidator) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	for _, metricSet := range batch.MetricSets {
+		for name, value := range metricSet.MetricValues {
+			if !strings.HasPrefix(name, core.CustomMetricPrefix) {
+				continue
+			}
+			if reason := this.policy.violation(strings.TrimPrefix(name, core.CustomMetricPrefix), value, nil); reason != "" {
+				delete(metricSet.MetricValues, name)
+				this.reject(metricSet, name, reason, batch.Timestamp)
+			}
+		}
+		kept := metricSet.LabeledMetrics[:0]
+		for _, metric := range metricSet.LabeledMetrics {
+			if strings.HasPrefix(metric.Name, core.CustomMetricPrefix) {
+				if reason := this.policy.violation(strings.TrimPrefix(metric.Name, core.CustomMetricPrefix), metric.MetricValue, metric.Labels); reason != "" {
+					this.reject(metricSet, metric.Name, reason, batch.Timestamp)
+					continue
+				}
+			}
+			kept = append(kept, metric)
+		}
+		metricSet.LabeledMetrics = kept
+	}
+	this.forgetEvents(batch.Timestamp)
+	return batch, nil
+}
+
+func (this *CustomMetricValidator) reject(metricSet *core.MetricSet, name, reason string, now time.Time) {
+	customMetricsRejected.WithLabelValues(reason).Inc()
+	namespace := metricSet.Labels[core.LabelNamespaceName.Key]
+	podName := metricSet.Labels[core.LabelPodName.Key]
+	container := metricSet.Labels[core.LabelContainerName.Key]
+	glog.V(4).Infof("Rejected custom metric %s of container %s of pod %s/%s: invalid %s", name, container, namespace, podName, reason)
+	if this.events == nil || namespace == "" || podName == "" {
+		return
+	}
+
+	key := namespace + "/" + podName + "|" + name + "|" + reason
+	this.lock.Lock()
+	last, found := this.posted[key]
+	if found && now.Sub(last) < customMetricEventInterval {
+		this.lock.Unlock()
+		return
+	}
+	this.posted[key] = now
+	this.lock.Unlock()
+
+	timestamp := unversioned.NewTime(now)
+	event := &kube_api.Event{
+		ObjectMeta: kube_api.ObjectMeta{
+			Namespace:    namespace,
+			GenerateName: podName + ".",
+		},
+		InvolvedObject: kube_api.ObjectReference{
+			Kind:      "Pod",
+			Namespace: namespace,
+			Name:      podName,
+			UID:       types.UID(metricSet.Labels[core.LabelPodId.Key]),
+		},
+		Reason:         "InvalidCustomMetric",
+		Message:        fmt.Sprintf("Custom metric %s of container %s dropped by heapster: invalid %s", name, container, strings.Replace(reason, "_", " ", -1)),
+		Source:         kube_api.EventSource{Component: "heapster"},
+		FirstTimestamp: timestamp,
+		LastTimestamp:  timestamp,
+		Count:          1,
+		Type:           kube_api.EventTypeWarning,
+	}
+	if _, err := this.events.Create(event); err != nil {
+		glog.Warningf("Failed to post the event about custom metric %s of pod %s/%s: %v", name, namespace, podName, err)
+	}
+}
+
+// Forgets the events old enough to be posted again.
+func (this *CustomMetricValidator) forgetEvents(now time.Time) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for key, last := range this.posted {
+		if now.Sub(last) >= customMetricEventInterval {
+			delete(this.posted, key)
+		}
+	}
+}
+
+// NewCustomMetricValidator creates a validator with the policy of the given YAML or JSON file. Events
+// are posted on the pods exporting rejected metrics if events isn't nil.
+func NewCustomMetricValidator(path string, events EventPoster) (*CustomMetricValidator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	validator := &CustomMetricValidator{
+		events: events,
+		posted: make(map[string]time.Time),
+	}
+	if err := yaml.Unmarshal(data, &validator.policy); err != nil {
+		return nil, fmt.Errorf("failed to parse custom metric policy %s - %v", path, err)
+	}
+	if err := validator.policy.compile(); err != nil {
+		return nil, fmt.Errorf("invalid custom metric policy %s - %v", path, err)
+	}
+	return validator, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+const testCustomMetricPolicy = `
+namePattern: '^[a-z][a-z0-9_]*$'
+labelKeyPattern: '^[a-z_]+$'
+valueTypes: [int64, double]
+metrics:
+  qps: double
+`
+
+type fakeEventPoster struct {
+	events []*kube_api.Event
+}
+
+func (this *fakeEventPoster) Create(event *kube_api.Event) (*kube_api.Event, error) {
+	this.events = append(this.events, event)
+	return event, nil
+}
+
+func newTestValidator(t *testing.T, policy string, events EventPoster) *CustomMetricValidator {
+	dir, err := ioutil.TempDir("", "policy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(policy), 0644))
+	validator, err := NewCustomMetricValidator(path, events)
+	require.NoError(t, err)
+	return validator
+}
+
+func customMetricsBatch(ts time.Time) *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: ts,
+		MetricSets: map[string]*core.MetricSet{
+			core.PodContainerKey("ns1", "pod1", "c1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePodContainer,
+					core.LabelNamespaceName.Key: "ns1",
+					core.LabelPodName.Key:       "pod1",
+					core.LabelPodId.Key:         "uid1",
+					core.LabelContainerName.Key: "c1",
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricCpuUsage.Name: {ValueType: core.ValueInt64, IntValue: 1},
+					"custom/requests":        {ValueType: core.ValueInt64, IntValue: 2},
+					"custom/qps":             {ValueType: core.ValueInt64, IntValue: 3},
+					"custom/Bad-Name":        {ValueType: core.ValueInt64, IntValue: 4},
+					"custom/latency":         {ValueType: core.ValueHistogram},
+				},
+				LabeledMetrics: []core.LabeledMetric{
+					{Name: "custom/errors", Labels: map[string]string{"code": "500"}, MetricValue: core.MetricValue{ValueType: core.ValueInt64}},
+					{Name: "custom/errors", Labels: map[string]string{"HTTP-Code": "500"}, MetricValue: core.MetricValue{ValueType: core.ValueInt64}},
+					{Name: core.MetricFilesystemUsage.Name, Labels: map[string]string{"resource_id": "/dev/sda1"}},
+				},
+			},
+		},
+	}
+}
+
+func TestCustomMetricValidator(t *testing.T) {
+	events := &fakeEventPoster{}
+	validator := newTestValidator(t, testCustomMetricPolicy, events)
+	now := time.Now()
+
+	batch, err := validator.Process(customMetricsBatch(now))
+	require.NoError(t, err)
+	ms := batch.MetricSets[core.PodContainerKey("ns1", "pod1", "c1")]
+
+	assert.Equal(t, 2, len(ms.MetricValues))
+	assert.Contains(t, ms.MetricValues, core.MetricCpuUsage.Name)
+	assert.Contains(t, ms.MetricValues, "custom/requests")
+	require.Len(t, ms.LabeledMetrics, 2)
+	assert.Equal(t, "500", ms.LabeledMetrics[0].Labels["code"])
+	assert.Equal(t, core.MetricFilesystemUsage.Name, ms.LabeledMetrics[1].Name)
+
+	// qps and latency have the wrong value type, Bad-Name the wrong name and an errors series a wrong label key.
+	require.Len(t, events.events, 4)
+	event := events.events[0]
+	assert.Equal(t, "ns1", event.Namespace)
+	assert.Equal(t, "Pod", event.InvolvedObject.Kind)
+	assert.Equal(t, "pod1", event.InvolvedObject.Name)
+	assert.Equal(t, "uid1", string(event.InvolvedObject.UID))
+	assert.Equal(t, kube_api.EventTypeWarning, event.Type)
+	assert.Equal(t, "InvalidCustomMetric", event.Reason)
+
+	// The events are posted at most once an hour.
+	_, err = validator.Process(customMetricsBatch(now.Add(time.Minute)))
+	require.NoError(t, err)
+	assert.Len(t, events.events, 4)
+	_, err = validator.Process(customMetricsBatch(now.Add(customMetricEventInterval)))
+	require.NoError(t, err)
+	assert.Len(t, events.events, 8)
+}
+
+func TestCustomMetricPolicyViolation(t *testing.T) {
+	policy := CustomMetricPolicy{
+		Metrics: map[string]string{"qps": "double"},
+		Strict:  true,
+	}
+	require.NoError(t, policy.compile())
+	assert.Equal(t, "", policy.violation("qps", core.MetricValue{ValueType: core.ValueFloat}, nil))
+	assert.Equal(t, RejectedValueType, policy.violation("qps", core.MetricValue{ValueType: core.ValueInt64}, nil))
+	assert.Equal(t, RejectedUndeclared, policy.violation("requests", core.MetricValue{ValueType: core.ValueInt64}, nil))
+}
+
+func TestInvalidCustomMetricPolicy(t *testing.T) {
+	for _, policy := range []CustomMetricPolicy{
+		{NamePattern: "("},
+		{LabelKeyPattern: "["},
+		{ValueTypes: []string{"float"}},
+		{Metrics: map[string]string{"qps": "string"}},
+	} {
+		assert.Error(t, policy.compile(), "%+v", policy)
+	}
+	_, err := NewCustomMetricValidator("/nonexistent", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"time"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// Minimum number of samples in the window for a trend to be computed.
+const minTrendSamples = 3
+
+type usageSample struct {
+	timestamp time.Time
+	value     float64
+}
+
+// The samples of a resource usage in the prediction window, oldest first.
+type usageTrend struct {
+	createTime time.Time
+	samples    []usageSample
+}
+
+// ExhaustionPredictor estimates the time before containers run out of memory, by extrapolating
+// the trend of their working set to their memory limit, and the time before node filesystems
+// reach disk pressure, by extrapolating the trend of their usage to the eviction threshold.
+// Resources whose usage doesn't grow get no estimate. Needs to run after PodBasedEnricher that
+// sets the memory limits.
+type ExhaustionPredictor struct {
+	window time.Duration
+	// Share of the filesystem that has to stay available to avoid disk pressure.
+	diskPressureThreshold float64
+	trends                map[string]*usageTrend
+}
+
+func (this *ExhaustionPredictor) Name() string {
+	return "exhaustion_predictor"
+}
+
+func (this *ExhaustionPredictor) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	seen := make(map[string]bool)
+	for key, metricSet := range batch.MetricSets {
+		timestamp := metricSet.ScrapeTime
+		if timestamp.IsZero() {
+			timestamp = batch.Timestamp
+		}
+
+		switch metricSet.Labels[core.LabelMetricSetType.Key] {
+		case core.MetricSetTypePodContainer:
+			limit := getInt(metricSet, &core.MetricMemoryLimit)
+			workingSet, found := metricSet.MetricValues[core.MetricMemoryWorkingSet.Name]
+			if limit <= 0 || !found {
+				continue
+			}
+			seen[key] = true
+			trend := this.record(key, metricSet.CreateTime, timestamp, float64(workingSet.IntValue))
+			if seconds, found := trend.timeToReach(float64(limit)); found {
+				setFloat(metricSet, &core.MetricMemoryTimeToOOM, float32(seconds))
+			}
+
+		case core.MetricSetTypeNode:
+			predictions := []core.LabeledMetric{}
+			for _, metric := range metricSet.LabeledMetrics {
+				if metric.Name != core.MetricFilesystemUsage.Name {
+					continue
+				}
+				limit, found := findLabeledMetric(metricSet.LabeledMetrics, core.MetricFilesystemLimit.Name, metric.Labels)
+				if !found || limit.IntValue <= 0 {
+					continue
+				}
+				trendKey := key + "/" + metric.Labels[core.LabelResourceID.Key]
+				seen[trendKey] = true
+				trend := this.record(trendKey, metricSet.CreateTime, timestamp, float64(metric.IntValue))
+				if seconds, found := trend.timeToReach(float64(limit.IntValue) * (1 - this.diskPressureThreshold)); found {
+					predictions = append(predictions, core.LabeledMetric{
+						Name:   core.MetricFilesystemTimeToDiskPressure.Name,
+						Labels: metric.Labels,
+						MetricValue: core.MetricValue{
+							ValueType:  core.ValueFloat,
+							MetricType: core.MetricGauge,
+							FloatValue: float32(seconds),
+						},
+					})
+				}
+			}
+			metricSet.LabeledMetrics = append(metricSet.LabeledMetrics, predictions...)
+		}
+	}
+
+	// Forget the resources that are gone. Out of band batches cover only a few nodes.
+	if batch.OutOfBand {
+		return batch, nil
+	}
+	for key := range this.trends {
+		if !seen[key] {
+			delete(this.trends, key)
+		}
+	}
+	return batch, nil
+}
+
+// Adds a sample to the trend of the resource, starting a new trend if the resource was recreated.
+func (this *ExhaustionPredictor) record(key string, createTime, timestamp time.Time, value float64) *usageTrend {
+	trend, found := this.trends[key]
+	if !found || !trend.createTime.Equal(createTime) {
+		trend = &usageTrend{createTime: createTime}
+		this.trends[key] = trend
+	}
+	if n := len(trend.samples); n > 0 && !timestamp.After(trend.samples[n-1].timestamp) {
+		return trend
+	}
+	trend.samples = append(trend.samples, usageSample{timestamp: timestamp, value: value})
+	cutoff := timestamp.Add(-this.window)
+	for len(trend.samples) > 0 && !trend.samples[0].timestamp.After(cutoff) {
+		trend.samples = trend.samples[1:]
+	}
+	return trend
+}
+
+// Returns the number of seconds before the usage reaches the limit, extrapolating the least
+// squares fit of the samples from the latest one. Not found if the usage doesn't grow or there
+// are too few samples.
+func (this *usageTrend) timeToReach(limit float64) (float64, bool) {
+	n := len(this.samples)
+	if n < minTrendSamples {
+		return 0, false
+	}
+	latest := this.samples[n-1]
+	if latest.value >= limit {
+		return 0, true
+	}
+
+	start := this.samples[0].timestamp
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range this.samples {
+		x := sample.timestamp.Sub(start).Seconds()
+		sumX += x
+		sumY += sample.value
+		sumXY += x * sample.value
+		sumXX += x * x
+	}
+	denominator := float64(n)*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	slope := (float64(n)*sumXY - sumX*sumY) / denominator
+	if slope <= 0 {
+		return 0, false
+	}
+	return (limit - latest.value) / slope, true
+}
+
+// NewExhaustionPredictor creates a predictor computing the trends over the given window, with
+// disk pressure happening when less than the given share of a filesystem is available.
+func NewExhaustionPredictor(window time.Duration, diskPressureThreshold float64) *ExhaustionPredictor {
+	return &ExhaustionPredictor{
+		window:                window,
+		diskPressureThreshold: diskPressureThreshold,
+		trends:                make(map[string]*usageTrend),
+	}
+}
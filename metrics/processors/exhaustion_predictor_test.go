@@ -0,0 +1,118 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func predictorBatch(now time.Time, created time.Time, workingSet, fsUsage int64) *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: now,
+		MetricSets: map[string]*core.MetricSet{
+			core.PodContainerKey("ns1", "pod1", "c1"): {
+				CreateTime: created,
+				ScrapeTime: now,
+				Labels:     map[string]string{core.LabelMetricSetType.Key: core.MetricSetTypePodContainer},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryWorkingSet.Name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: workingSet},
+					core.MetricMemoryLimit.Name:      {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1000},
+				},
+			},
+			core.NodeKey("node1"): {
+				CreateTime:   created,
+				ScrapeTime:   now,
+				Labels:       map[string]string{core.LabelMetricSetType.Key: core.MetricSetTypeNode},
+				MetricValues: map[string]core.MetricValue{},
+				LabeledMetrics: []core.LabeledMetric{
+					{
+						Name:        core.MetricFilesystemUsage.Name,
+						Labels:      map[string]string{core.LabelResourceID.Key: "/dev/sda1"},
+						MetricValue: core.MetricValue{ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: fsUsage},
+					},
+					{
+						Name:        core.MetricFilesystemLimit.Name,
+						Labels:      map[string]string{core.LabelResourceID.Key: "/dev/sda1"},
+						MetricValue: core.MetricValue{ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 10000},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestExhaustionPredictor(t *testing.T) {
+	predictor := NewExhaustionPredictor(5*time.Minute, 0.1)
+	created := time.Now().Add(-time.Hour)
+	start := time.Now()
+	containerKey := core.PodContainerKey("ns1", "pod1", "c1")
+	sda1 := map[string]string{core.LabelResourceID.Key: "/dev/sda1"}
+
+	var batch *core.DataBatch
+	var err error
+	// The working set grows by 10 bytes and the filesystem usage by 100 bytes per minute.
+	for i := 0; i < 3; i++ {
+		batch, err = predictor.Process(predictorBatch(start.Add(time.Duration(i)*time.Minute), created, 500+10*int64(i), 5000+100*int64(i)))
+		require.NoError(t, err)
+		if i < 2 {
+			_, found := batch.MetricSets[containerKey].MetricValues[core.MetricMemoryTimeToOOM.Name]
+			assert.False(t, found, "no estimate before %d samples", minTrendSamples)
+		}
+	}
+
+	// 480 bytes left at 10 bytes per minute.
+	timeToOOM, found := batch.MetricSets[containerKey].MetricValues[core.MetricMemoryTimeToOOM.Name]
+	require.True(t, found)
+	assert.InDelta(t, 48*60, timeToOOM.FloatValue, 0.1)
+
+	// 9000 bytes can be used before disk pressure, 3800 are left at 100 bytes per minute.
+	timeToDiskPressure, found := findLabeledMetric(batch.MetricSets[core.NodeKey("node1")].LabeledMetrics, core.MetricFilesystemTimeToDiskPressure.Name, sda1)
+	require.True(t, found)
+	assert.InDelta(t, 38*60, timeToDiskPressure.FloatValue, 0.1)
+
+	// A restarted container starts a new trend.
+	batch, err = predictor.Process(predictorBatch(start.Add(3*time.Minute), created.Add(time.Minute), 100, 5300))
+	require.NoError(t, err)
+	_, found = batch.MetricSets[containerKey].MetricValues[core.MetricMemoryTimeToOOM.Name]
+	assert.False(t, found)
+
+	// Samples older than the window are dropped, and a stable usage has no estimate.
+	for i := 4; i < 10; i++ {
+		batch, err = predictor.Process(predictorBatch(start.Add(time.Duration(i)*time.Minute), created.Add(time.Minute), 100, 5300))
+		require.NoError(t, err)
+	}
+	assert.Len(t, predictor.trends[containerKey].samples, 5)
+	_, found = batch.MetricSets[containerKey].MetricValues[core.MetricMemoryTimeToOOM.Name]
+	assert.False(t, found)
+	_, found = findLabeledMetric(batch.MetricSets[core.NodeKey("node1")].LabeledMetrics, core.MetricFilesystemTimeToDiskPressure.Name, sda1)
+	assert.False(t, found)
+
+	// A container above its limit has no time left.
+	trend := &usageTrend{samples: []usageSample{{start, 900}, {start.Add(time.Minute), 1100}, {start.Add(2 * time.Minute), 1000}}}
+	seconds, found := trend.timeToReach(1000)
+	assert.True(t, found)
+	assert.Equal(t, 0.0, seconds)
+
+	// Trends of resources that are gone are forgotten.
+	_, err = predictor.Process(&core.DataBatch{Timestamp: start.Add(10 * time.Minute), MetricSets: map[string]*core.MetricSet{}})
+	require.NoError(t, err)
+	assert.Empty(t, predictor.trends)
+}
@@ -36,6 +36,12 @@ func aggregate(src, dst *core.MetricSet, metricsToAggregate []string) error {
 				aggregatedValue.IntValue += metricValue.IntValue
 			} else if aggregatedValue.ValueType == core.ValueFloat {
 				aggregatedValue.FloatValue += metricValue.FloatValue
+			} else if aggregatedValue.ValueType == core.ValueHistogram {
+				histogram, err := core.MergeHistograms(aggregatedValue.HistogramValue, metricValue.HistogramValue)
+				if err != nil {
+					return fmt.Errorf("NamespaceAggregator: failed to aggregate %s: %v", metricName, err)
+				}
+				aggregatedValue.HistogramValue = histogram
 			} else {
 				return fmt.Errorf("NamespaceAggregator: type not supported in %s", metricName)
 			}
@@ -46,3 +52,10 @@ func aggregate(src, dst *core.MetricSet, metricsToAggregate []string) error {
 	}
 	return nil
 }
+
+// Copies the federated cluster of the source metric set, if any, to the aggregating one.
+func copyClusterLabel(src, dst *core.MetricSet) {
+	if cluster, found := src.Labels[core.LabelClusterName.Key]; found {
+		dst.Labels[core.LabelClusterName.Key] = cluster
+	}
+}
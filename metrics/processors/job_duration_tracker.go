@@ -0,0 +1,260 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	kube_config "k8s.io/heapster/common/kubernetes"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/client/cache"
+	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// Label set by the job controller on the pods of a job.
+const jobNamePodLabel = "job-name"
+
+// JobDurationTracker sets the run duration of the containers of job pods once they terminate,
+// on the containers and on the cron job that created the job, if any.
+type JobDurationTracker struct {
+	podLister *cache.StoreToPodLister
+	jobStore  cache.Store
+	reflector *cache.Reflector
+
+	// Containers that terminated before are not reported, e.g. after a restart of heapster.
+	startTime time.Time
+	// Runs already reported, by pod UID, container name and finish time.
+	reported map[string]bool
+}
+
+func (this *JobDurationTracker) Name() string {
+	return "job_duration_tracker"
+}
+
+func (this *JobDurationTracker) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	// The finished runs are reported once, with the regular batches.
+	if batch.OutOfBand {
+		return batch, nil
+	}
+	pods, err := this.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	reported := make(map[string]bool, len(this.reported))
+	cronJobs := make(map[string]*core.MetricSet)
+	for _, pod := range pods {
+		jobName := getJobName(pod)
+		if jobName == "" {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			// A container restarted since the last batch keeps its previous run in its last
+			// termination state.
+			for _, terminated := range []*kube_api.ContainerStateTerminated{status.LastTerminationState.Terminated, status.State.Terminated} {
+				if terminated == nil || terminated.StartedAt.IsZero() || !terminated.FinishedAt.After(this.startTime) {
+					continue
+				}
+				reportKey := fmt.Sprintf("%s/%s/%d", pod.UID, status.Name, terminated.FinishedAt.UnixNano())
+				reported[reportKey] = true
+				if this.reported[reportKey] {
+					continue
+				}
+				this.reportRun(batch, cronJobs, pod, jobName, status.Name, terminated)
+			}
+		}
+	}
+	this.reported = reported
+
+	for key, cronJob := range cronJobs {
+		batch.MetricSets[key] = cronJob
+	}
+	return batch, nil
+}
+
+// Adds the run of the container to its metric set and to the one of its cron job.
+func (this *JobDurationTracker) reportRun(batch *core.DataBatch, cronJobs map[string]*core.MetricSet, pod *kube_api.Pod, jobName, containerName string, terminated *kube_api.ContainerStateTerminated) {
+	metric := core.LabeledMetric{
+		Name:   core.MetricContainerRunDuration.Name,
+		Labels: map[string]string{core.LabelExitCode.Key: strconv.Itoa(int(terminated.ExitCode))},
+		MetricValue: core.MetricValue{
+			MetricType: core.MetricGauge,
+			ValueType:  core.ValueInt64,
+			IntValue:   int64(terminated.FinishedAt.Sub(terminated.StartedAt.Time) / time.Millisecond),
+		},
+	}
+	cronJobName := this.getCronJobName(pod.Namespace, jobName)
+
+	containerKey := core.PodContainerKey(pod.Namespace, pod.Name, containerName)
+	container, found := batch.MetricSets[containerKey]
+	if !found {
+		container = terminatedContainerMetricSet(pod, containerName, terminated)
+		batch.MetricSets[containerKey] = container
+	}
+	container.Labels[core.LabelJobName.Key] = jobName
+	if cronJobName != "" {
+		container.Labels[core.LabelCronJobName.Key] = cronJobName
+	}
+	container.LabeledMetrics = append(container.LabeledMetrics, metric)
+
+	if cronJobName == "" {
+		return
+	}
+	cronJobKey := core.CronJobKey(pod.Namespace, cronJobName)
+	cronJob, found := cronJobs[cronJobKey]
+	if !found {
+		cronJob = cronJobMetricSet(pod.Namespace, cronJobName)
+		cronJobs[cronJobKey] = cronJob
+	}
+	addLongestRun(cronJob, containerName, metric)
+}
+
+// Returns the name of the job that created the pod, or "" if it wasn't created by a job.
+func getJobName(pod *kube_api.Pod) string {
+	if reference := getCreatedBy(pod.Annotations); reference != nil && reference.Kind == "Job" {
+		return reference.Name
+	}
+	return pod.Labels[jobNamePodLabel]
+}
+
+// Returns the name of the cron job that created the job, or "" if it wasn't created by a cron job.
+func (this *JobDurationTracker) getCronJobName(namespace, jobName string) string {
+	obj, exists, err := this.jobStore.GetByKey(namespace + "/" + jobName)
+	if err != nil || !exists {
+		if err != nil {
+			glog.Warningf("Failed to get job %s/%s: %v", namespace, jobName, err)
+		}
+		return ""
+	}
+	job, ok := obj.(*batch.Job)
+	if !ok {
+		glog.Errorf("Wrong job store content")
+		return ""
+	}
+	for _, owner := range job.OwnerReferences {
+		if isCronJobKind(owner.Kind) {
+			return owner.Name
+		}
+	}
+	if reference := getCreatedBy(job.Annotations); reference != nil && isCronJobKind(reference.Kind) {
+		return reference.Name
+	}
+	return ""
+}
+
+// Cron jobs were named scheduled jobs before Kubernetes 1.5.
+func isCronJobKind(kind string) bool {
+	return kind == "CronJob" || kind == "ScheduledJob"
+}
+
+// Returns the reference to the creator of an object from its annotations, or nil if there is none.
+func getCreatedBy(annotations map[string]string) *kube_api.ObjectReference {
+	createdBy, found := annotations[kube_api.CreatedByAnnotation]
+	if !found {
+		return nil
+	}
+	reference := kube_api.SerializedReference{}
+	if err := json.Unmarshal([]byte(createdBy), &reference); err != nil {
+		glog.V(4).Infof("Failed to parse the creator reference %q: %v", createdBy, err)
+		return nil
+	}
+	return &reference.Reference
+}
+
+// Keeps the longest run of the batch for each container name and exit code of the cron job.
+func addLongestRun(cronJob *core.MetricSet, containerName string, metric core.LabeledMetric) {
+	exitCode := metric.Labels[core.LabelExitCode.Key]
+	for i, existing := range cronJob.LabeledMetrics {
+		if existing.Labels[core.LabelContainerName.Key] == containerName && existing.Labels[core.LabelExitCode.Key] == exitCode {
+			if existing.IntValue < metric.IntValue {
+				cronJob.LabeledMetrics[i].IntValue = metric.IntValue
+			}
+			return
+		}
+	}
+	cronJob.LabeledMetrics = append(cronJob.LabeledMetrics, core.LabeledMetric{
+		Name: metric.Name,
+		Labels: map[string]string{
+			core.LabelContainerName.Key: containerName,
+			core.LabelExitCode.Key:      exitCode,
+		},
+		MetricValue: metric.MetricValue,
+	})
+}
+
+// Metric set of a container that terminated and isn't scraped anymore.
+func terminatedContainerMetricSet(pod *kube_api.Pod, containerName string, terminated *kube_api.ContainerStateTerminated) *core.MetricSet {
+	return &core.MetricSet{
+		MetricValues:   make(map[string]core.MetricValue),
+		LabeledMetrics: []core.LabeledMetric{},
+		CreateTime:     terminated.StartedAt.Time,
+		ScrapeTime:     terminated.FinishedAt.Time,
+		Labels: map[string]string{
+			core.LabelMetricSetType.Key: core.MetricSetTypePodContainer,
+			core.LabelNamespaceName.Key: pod.Namespace,
+			core.LabelPodNamespace.Key:  pod.Namespace,
+			core.LabelPodName.Key:       pod.Name,
+			core.LabelPodId.Key:         string(pod.UID),
+			core.LabelContainerName.Key: containerName,
+			core.LabelNodename.Key:      pod.Spec.NodeName,
+			core.LabelLabels.Key:        util.LabelsToString(pod.Labels),
+		},
+	}
+}
+
+func cronJobMetricSet(namespace, cronJobName string) *core.MetricSet {
+	return &core.MetricSet{
+		MetricValues:   make(map[string]core.MetricValue),
+		LabeledMetrics: []core.LabeledMetric{},
+		Labels: map[string]string{
+			core.LabelMetricSetType.Key: core.MetricSetTypeCronJob,
+			core.LabelNamespaceName.Key: namespace,
+			core.LabelCronJobName.Key:   cronJobName,
+		},
+	}
+}
+
+func NewJobDurationTracker(url *url.URL, podLister *cache.StoreToPodLister) (*JobDurationTracker, error) {
+	kubeConfig, err := kube_config.GetKubeClientConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient := kube_client.NewOrDie(kubeConfig)
+
+	// watch jobs
+	lw := cache.NewListWatchFromClient(kubeClient.BatchClient, "jobs", kube_api.NamespaceAll, fields.Everything())
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	reflector := cache.NewReflector(lw, &batch.Job{}, store, time.Hour)
+	reflector.Run()
+
+	return &JobDurationTracker{
+		podLister: podLister,
+		jobStore:  store,
+		reflector: reflector,
+		startTime: time.Now(),
+		reported:  make(map[string]bool),
+	}, nil
+}
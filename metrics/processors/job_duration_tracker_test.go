@@ -0,0 +1,129 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+func jobPod(name, jobName string, started time.Time, ran time.Duration, exitCode int32) *kube_api.Pod {
+	return &kube_api.Pod{
+		ObjectMeta: kube_api.ObjectMeta{
+			Name:      name,
+			Namespace: "ns1",
+			UID:       types.UID("uid-" + name),
+			Labels:    map[string]string{"job-name": jobName},
+		},
+		Status: kube_api.PodStatus{
+			ContainerStatuses: []kube_api.ContainerStatus{{
+				Name: "main",
+				State: kube_api.ContainerState{Terminated: &kube_api.ContainerStateTerminated{
+					ExitCode:   exitCode,
+					StartedAt:  unversioned.NewTime(started),
+					FinishedAt: unversioned.NewTime(started.Add(ran)),
+				}},
+			}},
+		},
+	}
+}
+
+func TestJobDurationTracker(t *testing.T) {
+	now := time.Now()
+	podLister := &cache.StoreToPodLister{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})}
+	jobStore := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	tracker := &JobDurationTracker{
+		podLister: podLister,
+		jobStore:  jobStore,
+		startTime: now.Add(-time.Hour),
+		reported:  make(map[string]bool),
+	}
+
+	require.NoError(t, jobStore.Add(&batch.Job{
+		ObjectMeta: kube_api.ObjectMeta{
+			Name:      "backup-1234",
+			Namespace: "ns1",
+			Annotations: map[string]string{
+				kube_api.CreatedByAnnotation: `{"kind":"SerializedReference","reference":{"kind":"ScheduledJob","namespace":"ns1","name":"backup"}}`,
+			},
+		},
+	}))
+	require.NoError(t, podLister.Indexer.Add(jobPod("backup-1234-a", "backup-1234", now.Add(-10*time.Minute), 5*time.Minute, 0)))
+	require.NoError(t, podLister.Indexer.Add(jobPod("backup-1234-b", "backup-1234", now.Add(-10*time.Minute), 7*time.Minute, 0)))
+	require.NoError(t, podLister.Indexer.Add(jobPod("backup-1234-c", "backup-1234", now.Add(-10*time.Minute), time.Minute, 1)))
+	// Terminated before the tracker started.
+	require.NoError(t, podLister.Indexer.Add(jobPod("old", "other", now.Add(-3*time.Hour), time.Minute, 0)))
+	// Not a job pod.
+	notJob := jobPod("web", "", now.Add(-10*time.Minute), time.Minute, 0)
+	notJob.Labels = nil
+	require.NoError(t, podLister.Indexer.Add(notJob))
+
+	batch, err := tracker.Process(&core.DataBatch{Timestamp: now, MetricSets: map[string]*core.MetricSet{}})
+	require.NoError(t, err)
+	assert.Len(t, batch.MetricSets, 4)
+
+	container := batch.MetricSets[core.PodContainerKey("ns1", "backup-1234-a", "main")]
+	require.NotNil(t, container)
+	assert.Equal(t, core.MetricSetTypePodContainer, container.Labels[core.LabelMetricSetType.Key])
+	assert.Equal(t, "backup-1234", container.Labels[core.LabelJobName.Key])
+	assert.Equal(t, "backup", container.Labels[core.LabelCronJobName.Key])
+	require.Len(t, container.LabeledMetrics, 1)
+	assert.Equal(t, core.MetricContainerRunDuration.Name, container.LabeledMetrics[0].Name)
+	assert.Equal(t, "0", container.LabeledMetrics[0].Labels[core.LabelExitCode.Key])
+	assert.Equal(t, int64(5*60*1000), container.LabeledMetrics[0].IntValue)
+
+	cronJob := batch.MetricSets[core.CronJobKey("ns1", "backup")]
+	require.NotNil(t, cronJob)
+	assert.Equal(t, core.MetricSetTypeCronJob, cronJob.Labels[core.LabelMetricSetType.Key])
+	runs := map[string]int64{}
+	for _, metric := range cronJob.LabeledMetrics {
+		assert.Equal(t, "main", metric.Labels[core.LabelContainerName.Key])
+		runs[metric.Labels[core.LabelExitCode.Key]] = metric.IntValue
+	}
+	assert.Equal(t, map[string]int64{"0": 7 * 60 * 1000, "1": 60 * 1000}, runs)
+
+	// Terminated containers are reported only once.
+	batch, err = tracker.Process(&core.DataBatch{Timestamp: now.Add(time.Minute), MetricSets: map[string]*core.MetricSet{}})
+	require.NoError(t, err)
+	assert.Empty(t, batch.MetricSets)
+
+	// A container that failed and was restarted since the last batch reports its previous run.
+	restarted := jobPod("backup-1234-c", "backup-1234", now.Add(-10*time.Minute), time.Minute, 1)
+	status := &restarted.Status.ContainerStatuses[0]
+	status.LastTerminationState = kube_api.ContainerState{Terminated: &kube_api.ContainerStateTerminated{
+		ExitCode:   2,
+		StartedAt:  unversioned.NewTime(now.Add(-8 * time.Minute)),
+		FinishedAt: unversioned.NewTime(now.Add(-6 * time.Minute)),
+	}}
+	status.State = kube_api.ContainerState{Running: &kube_api.ContainerStateRunning{StartedAt: unversioned.NewTime(now.Add(-5 * time.Minute))}}
+	require.NoError(t, podLister.Indexer.Update(restarted))
+	batch, err = tracker.Process(&core.DataBatch{Timestamp: now.Add(2 * time.Minute), MetricSets: map[string]*core.MetricSet{}})
+	require.NoError(t, err)
+	container = batch.MetricSets[core.PodContainerKey("ns1", "backup-1234-c", "main")]
+	require.NotNil(t, container)
+	require.Len(t, container.LabeledMetrics, 1)
+	assert.Equal(t, "2", container.LabeledMetrics[0].Labels[core.LabelExitCode.Key])
+	assert.Equal(t, int64(2*60*1000), container.LabeledMetrics[0].IntValue)
+}
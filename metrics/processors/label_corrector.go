@@ -0,0 +1,193 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+)
+
+// Labels that are part of the metric set keys, which a correction would make inconsistent.
+var uncorrectableLabels = map[string]bool{
+	core.LabelMetricSetType.Key: true,
+	core.LabelPodId.Key:         true,
+	core.LabelPodName.Key:       true,
+	core.LabelPodNamespace.Key:  true,
+	core.LabelNamespaceName.Key: true,
+	core.LabelContainerName.Key: true,
+	core.LabelNodename.Key:      true,
+	core.LabelLabels.Key:        true,
+}
+
+// LabelCorrection replaces a mistaken value of a label, either a heapster label or a
+// kubernetes label of the pods (stored in the `labels` label).
+type LabelCorrection struct {
+	Label string `json:"label"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	// Restricts the correction to a namespace, all the namespaces if empty.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func (this *LabelCorrection) Validate() error {
+	if this.Label == "" {
+		return fmt.Errorf("label correction without a label")
+	}
+	if uncorrectableLabels[this.Label] {
+		return fmt.Errorf("label %s identifies the metric sets and cannot be corrected", this.Label)
+	}
+	if this.From == this.To {
+		return fmt.Errorf("label correction of %s replaces %q by itself", this.Label, this.From)
+	}
+	return nil
+}
+
+// Apply returns a corrected copy of the metric set, or nil if the correction does not apply to it.
+func (this *LabelCorrection) Apply(metricSet *core.MetricSet) *core.MetricSet {
+	if this.Namespace != "" && metricSet.Labels[core.LabelNamespaceName.Key] != this.Namespace {
+		return nil
+	}
+
+	var labels map[string]string
+	if value, found := metricSet.Labels[this.Label]; found && value == this.From {
+		labels = util.CopyLabels(metricSet.Labels)
+		labels[this.Label] = this.To
+	}
+	podLabels := util.StringToLabels(metricSet.Labels[core.LabelLabels.Key])
+	if value, found := podLabels[this.Label]; found && value == this.From {
+		if labels == nil {
+			labels = util.CopyLabels(metricSet.Labels)
+		}
+		podLabels[this.Label] = this.To
+		labels[core.LabelLabels.Key] = util.LabelsToString(podLabels)
+	}
+
+	var labeledMetrics []core.LabeledMetric
+	for i, metric := range metricSet.LabeledMetrics {
+		if value, found := metric.Labels[this.Label]; !found || value != this.From {
+			continue
+		}
+		if labeledMetrics == nil {
+			labeledMetrics = append([]core.LabeledMetric{}, metricSet.LabeledMetrics...)
+		}
+		labeledMetrics[i].Labels = util.CopyLabels(metric.Labels)
+		labeledMetrics[i].Labels[this.Label] = this.To
+	}
+
+	if labels == nil && labeledMetrics == nil {
+		return nil
+	}
+	result := *metricSet
+	if labels != nil {
+		result.Labels = labels
+	}
+	if labeledMetrics != nil {
+		result.LabeledMetrics = labeledMetrics
+	}
+	return &result
+}
+
+// LabelCorrectionAudit records a label correction.
+type LabelCorrectionAudit struct {
+	Timestamp  time.Time       `json:"timestamp"`
+	User       string          `json:"user"`
+	Reason     string          `json:"reason,omitempty"`
+	Correction LabelCorrection `json:"correction"`
+	// Number of metric sets of the in-memory history corrected.
+	HistoryCorrected int `json:"historyCorrected"`
+}
+
+// LabelHistory is the in-memory history to correct along with the future batches.
+type LabelHistory interface {
+	RelabelHistory(relabel func(*core.MetricSet) *core.MetricSet) int
+}
+
+// LabelCorrector applies the label corrections added at runtime to every batch.
+type LabelCorrector struct {
+	history LabelHistory
+
+	lock        sync.RWMutex
+	corrections []LabelCorrection
+	audit       []LabelCorrectionAudit
+}
+
+func (this *LabelCorrector) Name() string {
+	return "label_corrector"
+}
+
+func (this *LabelCorrector) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	this.lock.RLock()
+	corrections := this.corrections
+	this.lock.RUnlock()
+
+	for _, correction := range corrections {
+		for key, metricSet := range batch.MetricSets {
+			if corrected := correction.Apply(metricSet); corrected != nil {
+				batch.MetricSets[key] = corrected
+			}
+		}
+	}
+	return batch, nil
+}
+
+// Correct applies the correction to the in-memory history and to all the future batches, and
+// records it in the audit log.
+func (this *LabelCorrector) Correct(correction LabelCorrection, user, reason string) (LabelCorrectionAudit, error) {
+	if err := correction.Validate(); err != nil {
+		return LabelCorrectionAudit{}, err
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.corrections = append(append([]LabelCorrection{}, this.corrections...), correction)
+	audit := LabelCorrectionAudit{
+		Timestamp:  time.Now(),
+		User:       user,
+		Reason:     reason,
+		Correction: correction,
+	}
+	if this.history != nil {
+		audit.HistoryCorrected = this.history.RelabelHistory(correction.Apply)
+	}
+	this.audit = append(this.audit, audit)
+	glog.Infof("Label correction by %s: %s %q -> %q in namespace %q, %d metric sets of the history corrected (reason: %s)",
+		user, correction.Label, correction.From, correction.To, correction.Namespace, audit.HistoryCorrected, reason)
+	return audit, nil
+}
+
+// Corrections returns the corrections applied to the batches.
+func (this *LabelCorrector) Corrections() []LabelCorrection {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.corrections
+}
+
+// Audit returns the record of the corrections, oldest first.
+func (this *LabelCorrector) Audit() []LabelCorrectionAudit {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return append([]LabelCorrectionAudit{}, this.audit...)
+}
+
+func NewLabelCorrector(history LabelHistory) *LabelCorrector {
+	return &LabelCorrector{history: history}
+}
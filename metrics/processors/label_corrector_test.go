@@ -0,0 +1,107 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+)
+
+type fakeLabelHistory struct {
+	metricSets []*core.MetricSet
+}
+
+func (this *fakeLabelHistory) RelabelHistory(relabel func(*core.MetricSet) *core.MetricSet) int {
+	count := 0
+	for i, metricSet := range this.metricSets {
+		if corrected := relabel(metricSet); corrected != nil {
+			this.metricSets[i] = corrected
+			count++
+		}
+	}
+	return count
+}
+
+func TestLabelCorrectionApply(t *testing.T) {
+	util.SetLabelSeperator(",")
+	correction := LabelCorrection{Label: "team", From: "platfrom", To: "platform", Namespace: "ns1"}
+
+	metricSet := &core.MetricSet{
+		Labels: map[string]string{
+			core.LabelNamespaceName.Key: "ns1",
+			core.LabelLabels.Key:        "app:web,team:platfrom",
+		},
+		LabeledMetrics: []core.LabeledMetric{
+			{Name: "m1", Labels: map[string]string{"team": "platfrom"}},
+			{Name: "m2", Labels: map[string]string{"team": "other"}},
+		},
+	}
+	corrected := correction.Apply(metricSet)
+	require.NotNil(t, corrected)
+	assert.Equal(t, "app:web,team:platform", corrected.Labels[core.LabelLabels.Key])
+	assert.Equal(t, "platform", corrected.LabeledMetrics[0].Labels["team"])
+	assert.Equal(t, "other", corrected.LabeledMetrics[1].Labels["team"])
+
+	// The original metric set is left alone.
+	assert.Equal(t, "app:web,team:platfrom", metricSet.Labels[core.LabelLabels.Key])
+	assert.Equal(t, "platfrom", metricSet.LabeledMetrics[0].Labels["team"])
+
+	assert.Nil(t, correction.Apply(corrected))
+	assert.Nil(t, correction.Apply(&core.MetricSet{Labels: map[string]string{
+		core.LabelNamespaceName.Key: "ns2",
+		"team":                      "platfrom",
+	}}))
+}
+
+func TestLabelCorrectionValidate(t *testing.T) {
+	assert.Error(t, (&LabelCorrection{From: "a", To: "b"}).Validate())
+	assert.Error(t, (&LabelCorrection{Label: "team", From: "a", To: "a"}).Validate())
+	assert.Error(t, (&LabelCorrection{Label: core.LabelPodName.Key, From: "a", To: "b"}).Validate())
+	assert.NoError(t, (&LabelCorrection{Label: "team", From: "a", To: "b"}).Validate())
+}
+
+func TestLabelCorrector(t *testing.T) {
+	history := &fakeLabelHistory{metricSets: []*core.MetricSet{
+		{Labels: map[string]string{"team": "platfrom"}},
+		{Labels: map[string]string{"team": "other"}},
+	}}
+	corrector := NewLabelCorrector(history)
+
+	_, err := corrector.Correct(LabelCorrection{Label: "team", From: "a", To: "a"}, "admin", "")
+	assert.Error(t, err)
+	assert.Empty(t, corrector.Audit())
+
+	audit, err := corrector.Correct(LabelCorrection{Label: "team", From: "platfrom", To: "platform"}, "admin", "typo")
+	require.NoError(t, err)
+	assert.Equal(t, 1, audit.HistoryCorrected)
+	assert.Equal(t, "admin", audit.User)
+	assert.Equal(t, "typo", audit.Reason)
+	assert.Equal(t, []LabelCorrectionAudit{audit}, corrector.Audit())
+	assert.Equal(t, "platform", history.metricSets[0].Labels["team"])
+
+	batch := &core.DataBatch{MetricSets: map[string]*core.MetricSet{
+		"a": {Labels: map[string]string{"team": "platfrom"}},
+		"b": {Labels: map[string]string{"team": "other"}},
+	}}
+	batch, err = corrector.Process(batch)
+	require.NoError(t, err)
+	assert.Equal(t, "platform", batch.MetricSets["a"].Labels["team"])
+	assert.Equal(t, "other", batch.MetricSets["b"].Labels["team"])
+}
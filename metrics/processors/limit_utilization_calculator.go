@@ -0,0 +1,50 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"k8s.io/heapster/metrics/core"
+)
+
+// Computes the memory limit utilization (working set / limit) of containers that define
+// a memory limit. Needs to run after PodBasedEnricher that sets the limits.
+type LimitUtilizationCalculator struct {
+}
+
+func (this *LimitUtilizationCalculator) Name() string {
+	return "limit_utilization_calculator"
+}
+
+func (this *LimitUtilizationCalculator) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	for _, metricSet := range batch.MetricSets {
+		if metricSet.Labels[core.LabelMetricSetType.Key] != core.MetricSetTypePodContainer {
+			continue
+		}
+		limit := getInt(metricSet, &core.MetricMemoryLimit)
+		if limit <= 0 {
+			continue
+		}
+		workingSet, found := metricSet.MetricValues[core.MetricMemoryWorkingSet.Name]
+		if !found {
+			continue
+		}
+		setFloat(metricSet, &core.MetricMemoryLimitUtilization, float32(workingSet.IntValue)/float32(limit))
+	}
+	return batch, nil
+}
+
+func NewLimitUtilizationCalculator() *LimitUtilizationCalculator {
+	return &LimitUtilizationCalculator{}
+}
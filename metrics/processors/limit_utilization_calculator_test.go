@@ -0,0 +1,77 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestLimitUtilizationCalculator(t *testing.T) {
+	limited := core.PodContainerKey("ns1", "pod1", "c1")
+	unlimited := core.PodContainerKey("ns1", "pod1", "c2")
+	pod := core.PodKey("ns1", "pod1")
+
+	batch := &core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			limited: {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePodContainer,
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryWorkingSet.Name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 256},
+					core.MetricMemoryLimit.Name:      {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1024},
+				},
+			},
+			unlimited: {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePodContainer,
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryWorkingSet.Name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 256},
+					core.MetricMemoryLimit.Name:      {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 0},
+				},
+			},
+			pod: {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePod,
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryWorkingSet.Name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 512},
+					core.MetricMemoryLimit.Name:      {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1024},
+				},
+			},
+		},
+	}
+
+	processor := NewLimitUtilizationCalculator()
+	result, err := processor.Process(batch)
+	assert.NoError(t, err)
+
+	utilization, found := result.MetricSets[limited].MetricValues[core.MetricMemoryLimitUtilization.Name]
+	assert.True(t, found)
+	assert.Equal(t, core.ValueFloat, utilization.ValueType)
+	assert.InEpsilon(t, 0.25, utilization.FloatValue, 0.0001)
+
+	_, found = result.MetricSets[unlimited].MetricValues[core.MetricMemoryLimitUtilization.Name]
+	assert.False(t, found)
+	_, found = result.MetricSets[pod].MetricValues[core.MetricMemoryLimitUtilization.Name]
+	assert.False(t, found)
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+)
+
+// A rule of the metadata file, adding its labels to the pods of the namespace whose name
+// matches the pod pattern. An empty namespace or pattern matches everything.
+type metadataRule struct {
+	Namespace string            `json:"namespace"`
+	Pod       string            `json:"pod"`
+	Labels    map[string]string `json:"labels"`
+
+	podRegexp *regexp.Regexp
+}
+
+func (this *metadataRule) matches(namespace, podName string) bool {
+	if this.Namespace != "" && this.Namespace != namespace {
+		return false
+	}
+	if this.podRegexp != nil {
+		// Namespace metric sets only match the rules without a pod pattern.
+		return podName != "" && this.podRegexp.MatchString(podName)
+	}
+	return true
+}
+
+// MetadataEnricher adds labels read from a static file to the pod, container and namespace
+// metric sets, for organizations whose ownership metadata lives outside Kubernetes. The file
+// is reloaded when it changes. Needs to run after PodBasedEnricher that sets the pod labels,
+// and after NamespaceAggregator to label the namespaces.
+type MetadataEnricher struct {
+	path    string
+	modTime time.Time
+	rules   []metadataRule
+}
+
+func (this *MetadataEnricher) Name() string {
+	return "metadata_enricher"
+}
+
+func (this *MetadataEnricher) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	if err := this.reload(); err != nil {
+		glog.Warningf("Failed to reload metadata file %s, keeping the previous rules: %v", this.path, err)
+	}
+	if len(this.rules) == 0 {
+		return batch, nil
+	}
+
+	for _, metricSet := range batch.MetricSets {
+		switch metricSet.Labels[core.LabelMetricSetType.Key] {
+		case core.MetricSetTypePod, core.MetricSetTypePodContainer, core.MetricSetTypeNamespace:
+		default:
+			continue
+		}
+		namespace := metricSet.Labels[core.LabelNamespaceName.Key]
+		podName := metricSet.Labels[core.LabelPodName.Key]
+
+		metadata := make(map[string]string)
+		// Later rules override the earlier ones.
+		for i := range this.rules {
+			if this.rules[i].matches(namespace, podName) {
+				for key, value := range this.rules[i].Labels {
+					metadata[key] = value
+				}
+			}
+		}
+		if len(metadata) == 0 {
+			continue
+		}
+		// Kubernetes labels take precedence over the metadata.
+		for key, value := range util.StringToLabels(metricSet.Labels[core.LabelLabels.Key]) {
+			metadata[key] = value
+		}
+		metricSet.Labels[core.LabelLabels.Key] = util.LabelsToString(metadata)
+	}
+	return batch, nil
+}
+
+// Reads the rules again if the file was modified since they were last read.
+func (this *MetadataEnricher) reload() error {
+	info, err := os.Stat(this.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(this.modTime) {
+		return nil
+	}
+	rules, err := readMetadataFile(this.path)
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("Loaded %d metadata rules from %s", len(rules), this.path)
+	this.rules = rules
+	this.modTime = info.ModTime()
+	return nil
+}
+
+// Reads a CSV file, with a header of namespace, pod and the label names, or a YAML or JSON
+// list of rules.
+func readMetadataFile(path string) ([]metadataRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []metadataRule
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		rules, err = parseMetadataCSV(string(data))
+	} else {
+		err = yaml.Unmarshal(data, &rules)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Pod != "" {
+			if rule.podRegexp, err = regexp.Compile(rule.Pod); err != nil {
+				return nil, fmt.Errorf("invalid pod pattern of rule %d - %v", i+1, err)
+			}
+		}
+		for key, value := range rule.Labels {
+			if key == "" || strings.ContainsAny(key, ":"+util.LabelSeperator()) || strings.Contains(value, util.LabelSeperator()) {
+				return nil, fmt.Errorf("invalid label %q of rule %d", key, i+1)
+			}
+		}
+	}
+	return rules, nil
+}
+
+func parseMetadataCSV(data string) ([]metadataRule, error) {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	header := records[0]
+	if len(header) < 2 || header[0] != "namespace" || header[1] != "pod" {
+		return nil, fmt.Errorf("the CSV header needs to start with namespace,pod - %v", header)
+	}
+
+	rules := make([]metadataRule, 0, len(records)-1)
+	for _, record := range records[1:] {
+		rule := metadataRule{
+			Namespace: record[0],
+			Pod:       record[1],
+			Labels:    make(map[string]string),
+		}
+		// Empty cells leave the label unset.
+		for i := 2; i < len(record); i++ {
+			if record[i] != "" {
+				rule.Labels[header[i]] = record[i]
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// NewMetadataEnricher creates an enricher reading its rules from the given file, failing if
+// the file can't be read.
+func NewMetadataEnricher(path string) (*MetadataEnricher, error) {
+	enricher := &MetadataEnricher{path: path}
+	if err := enricher.reload(); err != nil {
+		return nil, err
+	}
+	return enricher, nil
+}
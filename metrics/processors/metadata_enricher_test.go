@@ -0,0 +1,130 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+)
+
+func metadataBatch() *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			core.PodKey("payments", "api-1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePod,
+					core.LabelNamespaceName.Key: "payments",
+					core.LabelPodName.Key:       "api-1",
+					core.LabelLabels.Key:        "app:api,team:k8s-team",
+				},
+			},
+			core.PodContainerKey("payments", "worker-1", "c1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePodContainer,
+					core.LabelNamespaceName.Key: "payments",
+					core.LabelPodName.Key:       "worker-1",
+					core.LabelContainerName.Key: "c1",
+				},
+			},
+			core.NamespaceKey("payments"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypeNamespace,
+					core.LabelNamespaceName.Key: "payments",
+				},
+			},
+			core.NodeKey("node1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypeNode,
+				},
+			},
+		},
+	}
+}
+
+func TestMetadataEnricher(t *testing.T) {
+	util.SetLabelSeperator(",")
+	dir, err := ioutil.TempDir("", "metadata")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metadata.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+- namespace: payments
+  labels:
+    team: payments
+    cost-center: "1234"
+- pod: ^api-
+  labels:
+    tier: frontend
+    cost-center: "5678"
+`), 0644))
+	enricher, err := NewMetadataEnricher(path)
+	require.NoError(t, err)
+
+	batch, err := enricher.Process(metadataBatch())
+	require.NoError(t, err)
+	// Kubernetes labels win over the metadata, later rules over earlier ones.
+	assert.Equal(t, "app:api,cost-center:5678,team:k8s-team,tier:frontend", batch.MetricSets[core.PodKey("payments", "api-1")].Labels[core.LabelLabels.Key])
+	assert.Equal(t, "cost-center:1234,team:payments", batch.MetricSets[core.PodContainerKey("payments", "worker-1", "c1")].Labels[core.LabelLabels.Key])
+	assert.Equal(t, "cost-center:1234,team:payments", batch.MetricSets[core.NamespaceKey("payments")].Labels[core.LabelLabels.Key])
+	_, found := batch.MetricSets[core.NodeKey("node1")].Labels[core.LabelLabels.Key]
+	assert.False(t, found)
+
+	// A modified file is reloaded, an invalid one keeps the previous rules.
+	require.NoError(t, ioutil.WriteFile(path, []byte("- pod: \"(\"\n"), 0644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	batch, err = enricher.Process(metadataBatch())
+	require.NoError(t, err)
+	assert.Equal(t, "cost-center:1234,team:payments", batch.MetricSets[core.NamespaceKey("payments")].Labels[core.LabelLabels.Key])
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("- namespace: payments\n  labels: {team: billing}\n"), 0644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	batch, err = enricher.Process(metadataBatch())
+	require.NoError(t, err)
+	assert.Equal(t, "team:billing", batch.MetricSets[core.NamespaceKey("payments")].Labels[core.LabelLabels.Key])
+}
+
+func TestMetadataFileCSV(t *testing.T) {
+	util.SetLabelSeperator(",")
+	dir, err := ioutil.TempDir("", "metadata")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metadata.csv")
+	require.NoError(t, ioutil.WriteFile(path, []byte("namespace,pod,team,cost-center\npayments,,payments,1234\n,^api-,,5678\n"), 0644))
+	rules, err := readMetadataFile(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, map[string]string{"team": "payments", "cost-center": "1234"}, rules[0].Labels)
+	assert.Equal(t, map[string]string{"cost-center": "5678"}, rules[1].Labels)
+	assert.True(t, rules[1].matches("default", "api-2"))
+	assert.False(t, rules[1].matches("default", ""))
+
+	for _, content := range []string{"pod,namespace,team\n", "namespace,pod,team\ndefault,,a,b\n", "namespace,pod,team:x\ndefault,,a\n", "namespace,pod,team\ndefault,,\"a,b\"\n"} {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		_, err := readMetadataFile(path)
+		assert.Error(t, err, content)
+	}
+}
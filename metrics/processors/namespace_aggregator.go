@@ -28,18 +28,23 @@ func (this *NamespaceAggregator) Name() string {
 }
 
 func (this *NamespaceAggregator) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	// The namespaces would miss the pods of the other nodes.
+	if batch.OutOfBand {
+		return batch, nil
+	}
 	namespaces := make(map[string]*core.MetricSet)
 	for key, metricSet := range batch.MetricSets {
 		if metricSetType, found := metricSet.Labels[core.LabelMetricSetType.Key]; found && metricSetType == core.MetricSetTypePod {
 			// Aggregating pods
 			if namespaceName, found := metricSet.Labels[core.LabelNamespaceName.Key]; found {
-				namespaceKey := core.NamespaceKey(namespaceName)
+				namespaceKey := core.ScopedKey(metricSet.Labels, core.NamespaceKey(namespaceName))
 				namespace, found := namespaces[namespaceKey]
 				if !found {
 					if nsFromBatch, found := batch.MetricSets[namespaceKey]; found {
 						namespace = nsFromBatch
 					} else {
 						namespace = namespaceMetricSet(namespaceName, metricSet.Labels[core.LabelPodNamespaceUID.Key])
+						copyClusterLabel(metricSet, namespace)
 						namespaces[namespaceKey] = namespace
 					}
 				}
@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"math"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+const (
+	// Traffic of a node, in bytes per second, below which the gap isn't significant.
+	minAttributedTraffic = 1024
+	// How often a warning is logged for the same node.
+	attributionWarningInterval = time.Hour
+)
+
+// Network traffic of a node and of its pods, in bytes per second.
+type nodeTraffic struct {
+	node float64
+	pods float64
+}
+
+// NetworkAttributionValidator compares the network rates of the nodes with the sum of the rates
+// of their pods, and sets the share of the traffic of the nodes not attributed to their pods
+// as network/attribution_gap on the nodes and the cluster. A large gap usually means that the
+// network plugin moves the traffic of the pods to interfaces which aren't in their network
+// namespace, so that their metrics miss it. The pods using the network of their node report the
+// traffic of the whole node, so they are left out, and their traffic and the one of the node
+// itself aren't attributed to pods. The gap is rarely zero. Needs to run after RateCalculator
+// and ClusterAggregator.
+type NetworkAttributionValidator struct {
+	podLister *cache.StoreToPodLister
+	// Gap above which a warning is logged, 0 to never log.
+	threshold float64
+	// Time of the last warning, by node. The empty node stands for the cluster.
+	warned map[string]time.Time
+}
+
+func (this *NetworkAttributionValidator) Name() string {
+	return "network_attribution_validator"
+}
+
+func (this *NetworkAttributionValidator) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	traffic := make(map[string]*nodeTraffic)
+	nodeTrafficOf := func(node string) *nodeTraffic {
+		if traffic[node] == nil {
+			traffic[node] = &nodeTraffic{}
+		}
+		return traffic[node]
+	}
+	nodeSets := make(map[string]*core.MetricSet)
+	for _, metricSet := range batch.MetricSets {
+		// The gaps of the other federated clusters aren't computed, their node names may collide.
+		if !core.IsPrimaryCluster(metricSet.Labels[core.LabelClusterName.Key]) {
+			continue
+		}
+		node := metricSet.Labels[core.LabelNodename.Key]
+		switch metricSet.Labels[core.LabelMetricSetType.Key] {
+		case core.MetricSetTypeNode:
+			nodeSets[node] = metricSet
+			nodeTrafficOf(node).node += networkRate(metricSet)
+		case core.MetricSetTypePod:
+			if node != "" && !this.hostNetwork(metricSet) {
+				nodeTrafficOf(node).pods += networkRate(metricSet)
+			}
+		}
+	}
+
+	total := nodeTraffic{}
+	for node, metricSet := range nodeSets {
+		nodeTraffic := traffic[node]
+		if nodeTraffic.node < minAttributedTraffic {
+			continue
+		}
+		total.node += nodeTraffic.node
+		total.pods += nodeTraffic.pods
+		gap := 1 - nodeTraffic.pods/nodeTraffic.node
+		setFloat(metricSet, &core.MetricNetworkAttributionGap, float32(gap))
+		this.check(node, gap, batch.Timestamp)
+	}
+
+	// Out of band batches cover only a few nodes.
+	if batch.OutOfBand || total.node < minAttributedTraffic {
+		return batch, nil
+	}
+	gap := 1 - total.pods/total.node
+	if cluster, found := batch.MetricSets[core.ClusterKey()]; found {
+		setFloat(cluster, &core.MetricNetworkAttributionGap, float32(gap))
+	}
+	this.check("", gap, batch.Timestamp)
+	return batch, nil
+}
+
+// Logs a warning if the gap is above the threshold, at most once per interval for a node. Pods
+// with more traffic than their node are counted twice, which is as suspicious as missing traffic.
+func (this *NetworkAttributionValidator) check(node string, gap float64, now time.Time) {
+	if this.threshold <= 0 || math.Abs(gap) <= this.threshold {
+		return
+	}
+	if last, found := this.warned[node]; found && now.Sub(last) < attributionWarningInterval {
+		return
+	}
+	this.warned[node] = now
+	if node == "" {
+		glog.Warningf("%.0f%% of the network traffic of the cluster isn't attributed to pods, "+
+			"the network plugin may hide the traffic of the pods from their metrics", gap*100)
+		return
+	}
+	glog.Warningf("%.0f%% of the network traffic of node %s isn't attributed to its pods, "+
+		"the network plugin may hide the traffic of the pods from their metrics", gap*100, node)
+}
+
+// Tells whether the pod of the metric set uses the network of its node.
+func (this *NetworkAttributionValidator) hostNetwork(metricSet *core.MetricSet) bool {
+	pod, err := this.podLister.Pods(metricSet.Labels[core.LabelNamespaceName.Key]).Get(metricSet.Labels[core.LabelPodName.Key])
+	if err != nil {
+		return false
+	}
+	return pod.Spec.SecurityContext != nil && pod.Spec.SecurityContext.HostNetwork
+}
+
+// Returns the bytes received and transmitted per second by the metric set.
+func networkRate(metricSet *core.MetricSet) float64 {
+	rate := 0.0
+	for _, metric := range []*core.Metric{&core.MetricNetworkRxRate, &core.MetricNetworkTxRate} {
+		if value, found := metricSet.MetricValues[metric.Name]; found {
+			rate += float64(value.FloatValue)
+		}
+	}
+	return rate
+}
+
+// NewNetworkAttributionValidator returns a validator logging a warning for the gaps above the
+// threshold, between 0 and 1, or never if it's 0. The pod lister tells the pods using the
+// network of their node.
+func NewNetworkAttributionValidator(podLister *cache.StoreToPodLister, threshold float64) *NetworkAttributionValidator {
+	return &NetworkAttributionValidator{
+		podLister: podLister,
+		threshold: threshold,
+		warned:    make(map[string]time.Time),
+	}
+}
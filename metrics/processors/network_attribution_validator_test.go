@@ -0,0 +1,102 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+func networkMetricSet(setType, node string, rx, tx float32) *core.MetricSet {
+	return &core.MetricSet{
+		Labels: map[string]string{
+			core.LabelMetricSetType.Key: setType,
+			core.LabelNodename.Key:      node,
+			core.LabelNamespaceName.Key: "ns1",
+		},
+		MetricValues: map[string]core.MetricValue{
+			core.MetricNetworkRxRate.Name: {MetricType: core.MetricGauge, ValueType: core.ValueFloat, FloatValue: rx},
+			core.MetricNetworkTxRate.Name: {MetricType: core.MetricGauge, ValueType: core.ValueFloat, FloatValue: tx},
+		},
+	}
+}
+
+func podNetworkMetricSet(name, node string, rx, tx float32) *core.MetricSet {
+	metricSet := networkMetricSet(core.MetricSetTypePod, node, rx, tx)
+	metricSet.Labels[core.LabelPodName.Key] = name
+	return metricSet
+}
+
+func TestNetworkAttributionValidator(t *testing.T) {
+	podLister := &cache.StoreToPodLister{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})}
+	// The pod using the network of its node reports all the traffic of n2.
+	podLister.Indexer.Add(&kube_api.Pod{
+		ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: "host"},
+		Spec:       kube_api.PodSpec{SecurityContext: &kube_api.PodSecurityContext{HostNetwork: true}},
+	})
+	podLister.Indexer.Add(&kube_api.Pod{ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: "p1"}})
+	now := time.Now()
+	batch := &core.DataBatch{
+		Timestamp: now,
+		MetricSets: map[string]*core.MetricSet{
+			core.ClusterKey(): {
+				Labels:       map[string]string{core.LabelMetricSetType.Key: core.MetricSetTypeCluster},
+				MetricValues: map[string]core.MetricValue{},
+			},
+			core.NodeKey("n1"):         networkMetricSet(core.MetricSetTypeNode, "n1", 6000, 4000),
+			core.PodKey("ns1", "p1"):   podNetworkMetricSet("p1", "n1", 3000, 2000),
+			core.PodKey("ns1", "p2"):   podNetworkMetricSet("p2", "n1", 3000, 1000),
+			core.NodeKey("n2"):         networkMetricSet(core.MetricSetTypeNode, "n2", 5000, 5000),
+			core.PodKey("ns1", "p3"):   podNetworkMetricSet("p3", "n2", 100, 0),
+			core.PodKey("ns1", "host"): podNetworkMetricSet("host", "n2", 5000, 5000),
+			core.NodeKey("idle"):       networkMetricSet(core.MetricSetTypeNode, "idle", 100, 100),
+			core.PodKey("ns1", "idle"): podNetworkMetricSet("idle", "idle", 0, 0),
+		},
+	}
+	validator := NewNetworkAttributionValidator(podLister, 0.5)
+	_, err := validator.Process(batch)
+	require.NoError(t, err)
+
+	gap := func(key string) (float32, bool) {
+		value, found := batch.MetricSets[key].MetricValues[core.MetricNetworkAttributionGap.Name]
+		return value.FloatValue, found
+	}
+	value, found := gap(core.NodeKey("n1"))
+	assert.True(t, found)
+	assert.InDelta(t, 0.1, value, 1e-6)
+	value, found = gap(core.NodeKey("n2"))
+	assert.True(t, found)
+	assert.InDelta(t, 0.99, value, 1e-6)
+	value, found = gap(core.ClusterKey())
+	assert.True(t, found)
+	assert.InDelta(t, 0.545, value, 1e-6)
+	// Too little traffic to tell.
+	_, found = gap(core.NodeKey("idle"))
+	assert.False(t, found)
+	_, found = gap(core.PodKey("ns1", "p1"))
+	assert.False(t, found)
+
+	// The node and the cluster above the threshold were warned about.
+	assert.Len(t, validator.warned, 2)
+	assert.Equal(t, now, validator.warned["n2"])
+	assert.Equal(t, now, validator.warned[""])
+}
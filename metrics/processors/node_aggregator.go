@@ -38,7 +38,7 @@ func (this *NodeAggregator) Process(batch *core.DataBatch) (*core.DataBatch, err
 				continue
 			}
 			if found {
-				nodeKey := core.NodeKey(nodeName)
+				nodeKey := core.ScopedKey(metricSet.Labels, core.NodeKey(nodeName))
 				node, found := batch.MetricSets[nodeKey]
 				if !found {
 					glog.V(1).Infof("No metric for node %s, cannot perform node level aggregation.", nodeKey)
@@ -41,6 +41,9 @@ func (this *NodeAutoscalingEnricher) Process(batch *core.DataBatch) (*core.DataB
 	for _, node := range nodes.Items {
 		if metricSet, found := batch.MetricSets[core.NodeKey(node.Name)]; found {
 			metricSet.Labels[core.LabelLabels.Key] = util.LabelsToString(node.Labels)
+			for key, value := range cloudMetadata(&node) {
+				metricSet.Labels[key] = value
+			}
 			capacityCpu, _ := node.Status.Capacity[kube_api.ResourceCPU]
 			capacityMem, _ := node.Status.Capacity[kube_api.ResourceMemory]
 			allocatableCpu, _ := node.Status.Allocatable[kube_api.ResourceCPU]
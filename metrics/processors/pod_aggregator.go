@@ -30,6 +30,7 @@ var LabelsToPopulate = []core.LabelDescriptor{
 	core.LabelPodNamespaceUID,
 	core.LabelHostname,
 	core.LabelHostID,
+	core.LabelClusterName,
 }
 
 type PodAggregator struct {
@@ -49,7 +50,7 @@ func (this *PodAggregator) Process(batch *core.DataBatch) (*core.DataBatch, erro
 			podName, found := metricSet.Labels[core.LabelPodName.Key]
 			ns, found2 := metricSet.Labels[core.LabelNamespaceName.Key]
 			if found && found2 {
-				podKey := core.PodKey(ns, podName)
+				podKey := core.ScopedKey(metricSet.Labels, core.PodKey(ns, podName))
 				pod, found := batch.MetricSets[podKey]
 				if !found {
 					pod, found = newPods[podKey]
@@ -77,6 +78,13 @@ func (this *PodAggregator) Process(batch *core.DataBatch) (*core.DataBatch, erro
 							aggregatedValue.IntValue += metricValue.IntValue
 						case core.ValueFloat:
 							aggregatedValue.FloatValue += metricValue.FloatValue
+						case core.ValueHistogram:
+							histogram, err := core.MergeHistograms(aggregatedValue.HistogramValue, metricValue.HistogramValue)
+							if err != nil {
+								glog.Errorf("PodAggregator: failed to aggregate %s: %v", metricName, err)
+								continue
+							}
+							aggregatedValue.HistogramValue = histogram
 						default:
 							return nil, fmt.Errorf("PodAggregator: type not supported in %s", metricName)
 						}
@@ -94,3 +94,49 @@ func TestPodAggregator(t *testing.T) {
 	assert.True(t, found)
 	assert.Equal(t, "ns1", labelNsName)
 }
+
+func TestPodAggregatorHistograms(t *testing.T) {
+	histogram := func(counts ...uint64) core.MetricValue {
+		return core.MetricValue{
+			ValueType:  core.ValueHistogram,
+			MetricType: core.MetricGauge,
+			HistogramValue: &core.Histogram{
+				Bounds: []float64{10, 100},
+				Counts: counts,
+				Sum:    50,
+				Count:  counts[0] + counts[1] + counts[2],
+			},
+		}
+	}
+	labels := map[string]string{
+		core.LabelMetricSetType.Key: core.MetricSetTypePodContainer,
+		core.LabelPodName.Key:       "pod1",
+		core.LabelNamespaceName.Key: "ns1",
+	}
+	c1 := histogram(1, 2, 3)
+	batch := core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			core.PodContainerKey("ns1", "pod1", "c1"): {
+				Labels:       labels,
+				MetricValues: map[string]core.MetricValue{"h": c1},
+			},
+			core.PodContainerKey("ns1", "pod1", "c2"): {
+				Labels:       labels,
+				MetricValues: map[string]core.MetricValue{"h": histogram(10, 20, 30)},
+			},
+		},
+	}
+	processor := PodAggregator{}
+	result, err := processor.Process(&batch)
+	assert.NoError(t, err)
+	pod, found := result.MetricSets[core.PodKey("ns1", "pod1")]
+	assert.True(t, found)
+
+	h := pod.MetricValues["h"].HistogramValue
+	assert.Equal(t, []uint64{11, 22, 33}, h.Counts)
+	assert.Equal(t, uint64(66), h.Count)
+	assert.Equal(t, float64(100), h.Sum)
+	// The container values are left untouched.
+	assert.Equal(t, []uint64{1, 2, 3}, c1.HistogramValue.Counts)
+}
@@ -24,10 +24,20 @@ import (
 	"k8s.io/heapster/metrics/core"
 	kube_api "k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/kubelet/qos"
+)
+
+const (
+	// The pod_id label is the UID of the pod, which changes whenever the pod is recreated.
+	PodIdentityUID = "uid"
+	// The pod_id label of the StatefulSet pods is their namespace and name, which a replica
+	// keeps across restarts, so that its history isn't split.
+	PodIdentityName = "name"
 )
 
 type PodBasedEnricher struct {
-	podLister *cache.StoreToPodLister
+	podLister   *cache.StoreToPodLister
+	podIdentity string
 }
 
 func (this *PodBasedEnricher) Name() string {
@@ -46,7 +56,7 @@ func (this *PodBasedEnricher) Process(batch *core.DataBatch) (*core.DataBatch, e
 				glog.V(3).Infof("Failed to get pod %s from cache: %v", core.PodKey(namespace, podName), err)
 				continue
 			}
-			addPodInfo(k, v, pod, batch, newMs)
+			addPodInfo(k, v, pod, this.podId(pod), batch, newMs)
 		case core.MetricSetTypePodContainer:
 			namespace := v.Labels[core.LabelNamespaceName.Key]
 			podName := v.Labels[core.LabelPodName.Key]
@@ -55,7 +65,7 @@ func (this *PodBasedEnricher) Process(batch *core.DataBatch) (*core.DataBatch, e
 				glog.V(3).Infof("Failed to get pod %s from cache: %v", core.PodKey(namespace, podName), err)
 				continue
 			}
-			addContainerInfo(k, v, pod, batch, newMs)
+			addContainerInfo(k, v, pod, this.podId(pod), batch, newMs)
 		}
 	}
 	for k, v := range newMs {
@@ -75,7 +85,30 @@ func (this *PodBasedEnricher) getPod(namespace, name string) (*kube_api.Pod, err
 	return pod, nil
 }
 
-func addContainerInfo(key string, containerMs *core.MetricSet, pod *kube_api.Pod, batch *core.DataBatch, newMs map[string]*core.MetricSet) {
+// Returns the value of the pod_id label of the pod.
+func (this *PodBasedEnricher) podId(pod *kube_api.Pod) string {
+	if this.podIdentity == PodIdentityName && isStatefulPod(pod) {
+		return pod.Namespace + "/" + pod.Name
+	}
+	return string(pod.UID)
+}
+
+// Returns whether the pod is a replica of a StatefulSet, or of a PetSet as they were called before.
+func isStatefulPod(pod *kube_api.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if isStatefulSetKind(owner.Kind) {
+			return true
+		}
+	}
+	reference := getCreatedBy(pod.Annotations)
+	return reference != nil && isStatefulSetKind(reference.Kind)
+}
+
+func isStatefulSetKind(kind string) bool {
+	return kind == "StatefulSet" || kind == "PetSet"
+}
+
+func addContainerInfo(key string, containerMs *core.MetricSet, pod *kube_api.Pod, podId string, batch *core.DataBatch, newMs map[string]*core.MetricSet) {
 	for _, container := range pod.Spec.Containers {
 		if key == core.PodContainerKey(pod.Namespace, pod.Name, container.Name) {
 			updateContainerResourcesAndLimits(containerMs, container)
@@ -86,8 +119,9 @@ func addContainerInfo(key string, containerMs *core.MetricSet, pod *kube_api.Pod
 		}
 	}
 
-	containerMs.Labels[core.LabelPodId.Key] = string(pod.UID)
+	containerMs.Labels[core.LabelPodId.Key] = podId
 	containerMs.Labels[core.LabelLabels.Key] = util.LabelsToString(pod.Labels)
+	containerMs.Labels[core.LabelQOSClass.Key] = string(qos.GetPodQOS(pod))
 
 	namespace := containerMs.Labels[core.LabelNamespaceName.Key]
 	podName := containerMs.Labels[core.LabelPodName.Key]
@@ -111,16 +145,17 @@ func addContainerInfo(key string, containerMs *core.MetricSet, pod *kube_api.Pod
 				},
 			}
 			newMs[podKey] = podMs
-			addPodInfo(podKey, podMs, pod, batch, newMs)
+			addPodInfo(podKey, podMs, pod, podId, batch, newMs)
 		}
 	}
 }
 
-func addPodInfo(key string, podMs *core.MetricSet, pod *kube_api.Pod, batch *core.DataBatch, newMs map[string]*core.MetricSet) {
+func addPodInfo(key string, podMs *core.MetricSet, pod *kube_api.Pod, podId string, batch *core.DataBatch, newMs map[string]*core.MetricSet) {
 
-	// Add UID to pod
-	podMs.Labels[core.LabelPodId.Key] = string(pod.UID)
+	// Add the ID to the pod
+	podMs.Labels[core.LabelPodId.Key] = podId
 	podMs.Labels[core.LabelLabels.Key] = util.LabelsToString(pod.Labels)
+	podMs.Labels[core.LabelQOSClass.Key] = string(qos.GetPodQOS(pod))
 
 	// Add cpu/mem requests and limits to containers
 	for _, container := range pod.Spec.Containers {
@@ -137,8 +172,9 @@ func addPodInfo(key string, podMs *core.MetricSet, pod *kube_api.Pod, batch *cor
 						core.LabelPodName.Key:            pod.Name,
 						core.LabelContainerName.Key:      container.Name,
 						core.LabelContainerBaseImage.Key: container.Image,
-						core.LabelPodId.Key:              string(pod.UID),
+						core.LabelPodId.Key:              podId,
 						core.LabelLabels.Key:             util.LabelsToString(pod.Labels),
+						core.LabelQOSClass.Key:           podMs.Labels[core.LabelQOSClass.Key],
 						core.LabelNodename.Key:           podMs.Labels[core.LabelNodename.Key],
 						core.LabelHostname.Key:           podMs.Labels[core.LabelHostname.Key],
 						core.LabelHostID.Key:             podMs.Labels[core.LabelHostID.Key],
@@ -185,8 +221,14 @@ func intValue(value int64) core.MetricValue {
 	}
 }
 
-func NewPodBasedEnricher(podLister *cache.StoreToPodLister) (*PodBasedEnricher, error) {
+// NewPodBasedEnricher creates an enricher identifying the pods by their UID, or the StatefulSet
+// pods by their name, according to podIdentity.
+func NewPodBasedEnricher(podLister *cache.StoreToPodLister, podIdentity string) (*PodBasedEnricher, error) {
+	if podIdentity != PodIdentityUID && podIdentity != PodIdentityName {
+		return nil, fmt.Errorf("unknown pod identity %q, should be %q or %q", podIdentity, PodIdentityUID, PodIdentityName)
+	}
 	return &PodBasedEnricher{
-		podLister: podLister,
+		podLister:   podLister,
+		podIdentity: podIdentity,
 	}, nil
 }
@@ -19,12 +19,14 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"k8s.io/heapster/metrics/core"
 
 	kube_api "k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/resource"
 	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/types"
 )
 
 var batches = []*core.DataBatch{
@@ -120,7 +122,7 @@ func TestPodEnricher(t *testing.T) {
 	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
 	podLister := &cache.StoreToPodLister{Indexer: store}
 	podLister.Indexer.Add(&pod)
-	podBasedEnricher := PodBasedEnricher{podLister: podLister}
+	podBasedEnricher := PodBasedEnricher{podLister: podLister, podIdentity: PodIdentityUID}
 
 	var err error
 	for _, batch := range batches {
@@ -135,11 +137,13 @@ func TestPodEnricher(t *testing.T) {
 		assert.True(t, found)
 		checkRequests(t, podMs, 433, 1555)
 		checkLimits(t, podMs, 2222, 3333)
+		assert.Equal(t, "Burstable", podMs.Labels[core.LabelQOSClass.Key])
 
 		containerMs, found := batch.MetricSets[core.PodContainerKey("ns1", "pod1", "c1")]
 		assert.True(t, found)
 		checkRequests(t, containerMs, 100, 555)
 		checkLimits(t, containerMs, 0, 0)
+		assert.Equal(t, "Burstable", containerMs.Labels[core.LabelQOSClass.Key])
 	}
 }
 
@@ -162,3 +166,63 @@ func checkLimits(t *testing.T, ms *core.MetricSet, cpu, mem int64) {
 	assert.True(t, found)
 	assert.Equal(t, mem, memVal.IntValue)
 }
+
+func TestStatefulPodIdentity(t *testing.T) {
+	newPod := func(name string, uid string, owner string, createdBy string) *kube_api.Pod {
+		pod := &kube_api.Pod{}
+		pod.Namespace = "ns1"
+		pod.Name = name
+		pod.UID = types.UID(uid)
+		if owner != "" {
+			pod.OwnerReferences = []kube_api.OwnerReference{{Kind: owner, Name: "owner"}}
+		}
+		if createdBy != "" {
+			pod.Annotations = map[string]string{
+				kube_api.CreatedByAnnotation: `{"kind":"SerializedReference","reference":{"kind":"` + createdBy + `","name":"owner"}}`,
+			}
+		}
+		pod.Spec.Containers = []kube_api.Container{{Name: "c1"}}
+		return pod
+	}
+
+	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	podLister := &cache.StoreToPodLister{Indexer: store}
+	podLister.Indexer.Add(newPod("db-0", "uid-1", "StatefulSet", ""))
+	podLister.Indexer.Add(newPod("db-1", "uid-2", "", "PetSet"))
+	podLister.Indexer.Add(newPod("web-1234", "uid-3", "ReplicaSet", ""))
+
+	_, err := NewPodBasedEnricher(podLister, "other")
+	assert.Error(t, err)
+
+	for _, tc := range []struct {
+		identity string
+		expected map[string]string
+	}{
+		{PodIdentityUID, map[string]string{"db-0": "uid-1", "db-1": "uid-2", "web-1234": "uid-3"}},
+		{PodIdentityName, map[string]string{"db-0": "ns1/db-0", "db-1": "ns1/db-1", "web-1234": "uid-3"}},
+	} {
+		enricher, err := NewPodBasedEnricher(podLister, tc.identity)
+		require.NoError(t, err)
+		batch := &core.DataBatch{
+			Timestamp:  time.Now(),
+			MetricSets: map[string]*core.MetricSet{},
+		}
+		for name := range tc.expected {
+			batch.MetricSets[core.PodKey("ns1", name)] = &core.MetricSet{
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePod,
+					core.LabelPodName.Key:       name,
+					core.LabelNamespaceName.Key: "ns1",
+				},
+				MetricValues: map[string]core.MetricValue{},
+			}
+		}
+		batch, err = enricher.Process(batch)
+		require.NoError(t, err)
+		for name, podId := range tc.expected {
+			assert.Equal(t, podId, batch.MetricSets[core.PodKey("ns1", name)].Labels[core.LabelPodId.Key], name)
+			// The stub container metric sets get the same ID.
+			assert.Equal(t, podId, batch.MetricSets[core.PodContainerKey("ns1", name, "c1")].Labels[core.LabelPodId.Key], name)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"k8s.io/heapster/metrics/core"
+)
+
+// PrimaryClusterProcessor runs a processor reading the Kubernetes API on the metric sets of the
+// primary cluster only, when several clusters are federated. The API is the one of the primary
+// cluster, so the pods and nodes of the other clusters would be missing from it. Their metric
+// sets are passed through as is.
+type PrimaryClusterProcessor struct {
+	core.DataProcessor
+}
+
+func (this *PrimaryClusterProcessor) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	primary := &core.DataBatch{
+		Timestamp:    batch.Timestamp,
+		MetricSets:   make(map[string]*core.MetricSet, len(batch.MetricSets)),
+		Completeness: batch.Completeness,
+		OutOfBand:    batch.OutOfBand,
+	}
+	others := make(map[string]*core.MetricSet)
+	for key, metricSet := range batch.MetricSets {
+		if core.IsPrimaryCluster(metricSet.Labels[core.LabelClusterName.Key]) {
+			primary.MetricSets[key] = metricSet
+		} else {
+			others[key] = metricSet
+		}
+	}
+	result, err := this.DataProcessor.Process(primary)
+	if err != nil {
+		return nil, err
+	}
+	for key, metricSet := range others {
+		result.MetricSets[key] = metricSet
+	}
+	return result, nil
+}
+
+func NewPrimaryClusterProcessor(processor core.DataProcessor) *PrimaryClusterProcessor {
+	return &PrimaryClusterProcessor{DataProcessor: processor}
+}
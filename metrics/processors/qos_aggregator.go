@@ -0,0 +1,70 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"k8s.io/heapster/metrics/core"
+)
+
+// QOSAggregator sums up the metrics of pods by their QoS class.
+type QOSAggregator struct {
+	MetricsToAggregate []string
+}
+
+func (this *QOSAggregator) Name() string {
+	return "qos_aggregator"
+}
+
+func (this *QOSAggregator) Process(batch *core.DataBatch) (*core.DataBatch, error) {
+	// The QoS classes would miss the pods of the other nodes.
+	if batch.OutOfBand {
+		return batch, nil
+	}
+	qosClasses := make(map[string]*core.MetricSet)
+	for _, metricSet := range batch.MetricSets {
+		if metricSetType, found := metricSet.Labels[core.LabelMetricSetType.Key]; !found || metricSetType != core.MetricSetTypePod {
+			continue
+		}
+		// Pods unknown to the enricher have no QoS class.
+		qosClass, found := metricSet.Labels[core.LabelQOSClass.Key]
+		if !found {
+			continue
+		}
+		qosKey := core.ScopedKey(metricSet.Labels, core.QOSKey(qosClass))
+		qos, found := qosClasses[qosKey]
+		if !found {
+			qos = qosMetricSet(qosClass)
+			copyClusterLabel(metricSet, qos)
+			qosClasses[qosKey] = qos
+		}
+		if err := aggregate(metricSet, qos, this.MetricsToAggregate); err != nil {
+			return nil, err
+		}
+	}
+	for key, val := range qosClasses {
+		batch.MetricSets[key] = val
+	}
+	return batch, nil
+}
+
+func qosMetricSet(qosClass string) *core.MetricSet {
+	return &core.MetricSet{
+		MetricValues: make(map[string]core.MetricValue),
+		Labels: map[string]string{
+			core.LabelMetricSetType.Key: core.MetricSetTypeQOS,
+			core.LabelQOSClass.Key:      qosClass,
+		},
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestQOSAggregate(t *testing.T) {
+	podMetricSet := func(namespace, qosClass string, value int64) *core.MetricSet {
+		ms := &core.MetricSet{
+			Labels: map[string]string{
+				core.LabelMetricSetType.Key: core.MetricSetTypePod,
+				core.LabelNamespaceName.Key: namespace,
+			},
+			MetricValues: map[string]core.MetricValue{
+				"m1": {
+					ValueType:  core.ValueInt64,
+					MetricType: core.MetricGauge,
+					IntValue:   value,
+				},
+				"m2": {
+					ValueType:  core.ValueInt64,
+					MetricType: core.MetricGauge,
+					IntValue:   222,
+				},
+			},
+		}
+		if qosClass != "" {
+			ms.Labels[core.LabelQOSClass.Key] = qosClass
+		}
+		return ms
+	}
+	batch := core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			core.PodKey("ns1", "pod1"): podMetricSet("ns1", "BestEffort", 10),
+			core.PodKey("ns2", "pod2"): podMetricSet("ns2", "BestEffort", 100),
+			core.PodKey("ns1", "pod3"): podMetricSet("ns1", "Guaranteed", 1000),
+			core.PodKey("ns1", "pod4"): podMetricSet("ns1", "", 5),
+		},
+	}
+	processor := QOSAggregator{
+		MetricsToAggregate: []string{"m1"},
+	}
+	result, err := processor.Process(&batch)
+	assert.NoError(t, err)
+	assert.Len(t, result.MetricSets, 6)
+
+	bestEffort, found := result.MetricSets[core.QOSKey("BestEffort")]
+	assert.True(t, found)
+	assert.Equal(t, core.MetricSetTypeQOS, bestEffort.Labels[core.LabelMetricSetType.Key])
+	assert.Equal(t, "BestEffort", bestEffort.Labels[core.LabelQOSClass.Key])
+	assert.Equal(t, int64(110), bestEffort.MetricValues["m1"].IntValue)
+	_, found = bestEffort.MetricValues["m2"]
+	assert.False(t, found)
+
+	guaranteed, found := result.MetricSets[core.QOSKey("Guaranteed")]
+	assert.True(t, found)
+	assert.Equal(t, int64(1000), guaranteed.MetricValues["m1"].IntValue)
+}
@@ -31,7 +31,9 @@ func (this *RateCalculator) Name() string {
 
 func (this *RateCalculator) Process(batch *core.DataBatch) (*core.DataBatch, error) {
 	if this.previousBatch == nil {
-		this.previousBatch = batch
+		if !batch.OutOfBand {
+			this.previousBatch = batch
+		}
 		return batch, nil
 	}
 	if !batch.Timestamp.After(this.previousBatch.Timestamp) {
@@ -43,6 +45,12 @@ func (this *RateCalculator) Process(batch *core.DataBatch) (*core.DataBatch, err
 	for key, newMs := range batch.MetricSets {
 
 		if oldMs, found := this.previousBatch.MetricSets[key]; found {
+			if newMs.ScrapeTime.Equal(oldMs.ScrapeTime) && newMs.CreateTime.Equal(oldMs.CreateTime) {
+				// The same stats again, e.g. kept by incremental scrapes for the containers
+				// without newer ones, keep the rates computed from them.
+				this.carryRates(newMs, oldMs)
+				continue
+			}
 			if !newMs.ScrapeTime.After(oldMs.ScrapeTime) {
 				// New must be strictly after old.
 				continue
@@ -80,12 +88,97 @@ func (this *RateCalculator) Process(batch *core.DataBatch) (*core.DataBatch, err
 					}
 				}
 			}
+
+			// Labeled metrics, like filesystem/usage, get a rate per set of labels.
+			rates := []core.LabeledMetric{}
+			for _, metricNew := range newMs.LabeledMetrics {
+				targetMetric, found := this.rateMetricsMapping[metricNew.Name]
+				if !found {
+					continue
+				}
+				metricOld, found := findLabeledMetric(oldMs.LabeledMetrics, metricNew.Name, metricNew.Labels)
+				if !found {
+					continue
+				}
+				if metricNew.Name == core.MetricNumaCpuUsage.MetricDescriptor.Name {
+					// In millicores, like cpu/usage_rate.
+					newVal := 1000 * (metricNew.IntValue - metricOld.IntValue) /
+						(newMs.ScrapeTime.UnixNano() - oldMs.ScrapeTime.UnixNano())
+
+					rates = append(rates, core.LabeledMetric{
+						Name:   targetMetric.MetricDescriptor.Name,
+						Labels: metricNew.Labels,
+						MetricValue: core.MetricValue{
+							ValueType:  core.ValueInt64,
+							MetricType: core.MetricGauge,
+							IntValue:   newVal,
+						},
+					})
+				} else if targetMetric.MetricDescriptor.ValueType == core.ValueFloat {
+					newVal := 1e9 * float32(metricNew.IntValue-metricOld.IntValue) /
+						float32(newMs.ScrapeTime.UnixNano()-oldMs.ScrapeTime.UnixNano())
+
+					rates = append(rates, core.LabeledMetric{
+						Name:   targetMetric.MetricDescriptor.Name,
+						Labels: metricNew.Labels,
+						MetricValue: core.MetricValue{
+							ValueType:  core.ValueFloat,
+							MetricType: core.MetricGauge,
+							FloatValue: newVal,
+						},
+					})
+				}
+			}
+			newMs.LabeledMetrics = append(newMs.LabeledMetrics, rates...)
 		}
 	}
-	this.previousBatch = batch
+	// The rates of the next regular batch are computed over the whole resolution, and cover
+	// the nodes missing from out of band batches.
+	if !batch.OutOfBand {
+		this.previousBatch = batch
+	}
 	return batch, nil
 }
 
+// Copies the rates of the previous metric set to the new one scraped at the same time.
+func (this *RateCalculator) carryRates(newMs, oldMs *core.MetricSet) {
+	targets := make(map[string]bool, len(this.rateMetricsMapping))
+	for _, targetMetric := range this.rateMetricsMapping {
+		targets[targetMetric.MetricDescriptor.Name] = true
+	}
+	for name := range targets {
+		if value, found := oldMs.MetricValues[name]; found {
+			newMs.MetricValues[name] = value
+		}
+	}
+	for _, metric := range oldMs.LabeledMetrics {
+		if targets[metric.Name] {
+			newMs.LabeledMetrics = append(newMs.LabeledMetrics, metric)
+		}
+	}
+}
+
+func findLabeledMetric(metrics []core.LabeledMetric, name string, labels map[string]string) (core.LabeledMetric, bool) {
+	for _, metric := range metrics {
+		if metric.Name == name && labelsEqual(metric.Labels, labels) {
+			return metric, true
+		}
+	}
+	return core.LabeledMetric{}, false
+}
+
+func labelsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, found := b[key]; !found || other != value {
+			return false
+		}
+	}
+	return true
+}
+
 func NewRateCalculator(metrics map[string]core.Metric) *RateCalculator {
 	return &RateCalculator{
 		rateMetricsMapping: metrics,
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"k8s.io/heapster/metrics/core"
 )
@@ -48,6 +49,21 @@ func TestRateCalculator(t *testing.T) {
 						MetricType: core.MetricCumulative,
 						IntValue:   0,
 					},
+					core.MetricNetworkRxErrors.MetricDescriptor.Name: {
+						ValueType:  core.ValueInt64,
+						MetricType: core.MetricCumulative,
+						IntValue:   30,
+					},
+					core.MetricMemoryPageFaults.MetricDescriptor.Name: {
+						ValueType:  core.ValueInt64,
+						MetricType: core.MetricCumulative,
+						IntValue:   1000,
+					},
+					core.MetricMemoryMajorPageFaults.MetricDescriptor.Name: {
+						ValueType:  core.ValueInt64,
+						MetricType: core.MetricCumulative,
+						IntValue:   10,
+					},
 				},
 			},
 		},
@@ -75,6 +91,21 @@ func TestRateCalculator(t *testing.T) {
 						MetricType: core.MetricCumulative,
 						IntValue:   120,
 					},
+					core.MetricNetworkRxErrors.MetricDescriptor.Name: {
+						ValueType:  core.ValueInt64,
+						MetricType: core.MetricCumulative,
+						IntValue:   60,
+					},
+					core.MetricMemoryPageFaults.MetricDescriptor.Name: {
+						ValueType:  core.ValueInt64,
+						MetricType: core.MetricCumulative,
+						IntValue:   7000,
+					},
+					core.MetricMemoryMajorPageFaults.MetricDescriptor.Name: {
+						ValueType:  core.ValueInt64,
+						MetricType: core.MetricCumulative,
+						IntValue:   70,
+					},
 				},
 			},
 		},
@@ -87,7 +118,103 @@ func TestRateCalculator(t *testing.T) {
 	ms := current.MetricSets[key]
 	cpuRate := ms.MetricValues[core.MetricCpuUsageRate.Name]
 	txeRate := ms.MetricValues[core.MetricNetworkTxErrorsRate.Name]
+	rxeRate := ms.MetricValues[core.MetricNetworkRxErrorsRate.Name]
+	pageFaultsRate := ms.MetricValues[core.MetricMemoryPageFaultsRate.Name]
+	majorPageFaultsRate := ms.MetricValues[core.MetricMemoryMajorPageFaultsRate.Name]
 
 	assert.InEpsilon(t, 13, cpuRate.IntValue, 2)
 	assert.InEpsilon(t, 2, txeRate.FloatValue, 0.1)
+	assert.InEpsilon(t, 0.5, rxeRate.FloatValue, 0.1)
+	assert.InEpsilon(t, 100, pageFaultsRate.FloatValue, 0.1)
+	assert.InEpsilon(t, 1, majorPageFaultsRate.FloatValue, 0.1)
+}
+
+func TestRateCalculatorLabeledMetrics(t *testing.T) {
+	key := core.PodContainerKey("ns1", "pod1", "c")
+	now := time.Now()
+
+	fsUsage := func(device string, value int64) core.LabeledMetric {
+		return core.LabeledMetric{
+			Name:   core.MetricFilesystemUsage.Name,
+			Labels: map[string]string{core.LabelResourceID.Key: device},
+			MetricValue: core.MetricValue{
+				ValueType:  core.ValueInt64,
+				MetricType: core.MetricGauge,
+				IntValue:   value,
+			},
+		}
+	}
+	batch := func(ts time.Time, metrics ...core.LabeledMetric) *core.DataBatch {
+		return &core.DataBatch{
+			Timestamp: ts,
+			MetricSets: map[string]*core.MetricSet{
+				key: {
+					CreateTime:     now.Add(-time.Hour),
+					ScrapeTime:     ts,
+					MetricValues:   map[string]core.MetricValue{},
+					LabeledMetrics: metrics,
+				},
+			},
+		}
+	}
+
+	prev := batch(now.Add(-time.Minute), fsUsage("/dev/sda1", 1000), fsUsage("/dev/sda2", 6000))
+	current := batch(now, fsUsage("/dev/sda1", 7000), fsUsage("/dev/sda2", 3000), fsUsage("/dev/sda3", 500))
+
+	procesor := NewRateCalculator(core.RateMetricsMapping)
+	procesor.Process(prev)
+	procesor.Process(current)
+
+	rates := map[string]float32{}
+	for _, metric := range current.MetricSets[key].LabeledMetrics {
+		if metric.Name == core.MetricFilesystemUsageRate.Name {
+			assert.Equal(t, core.ValueFloat, metric.ValueType)
+			rates[metric.Labels[core.LabelResourceID.Key]] = metric.FloatValue
+		}
+	}
+	assert.Len(t, rates, 2)
+	assert.InEpsilon(t, 100, rates["/dev/sda1"], 0.01)
+	assert.InEpsilon(t, -50, rates["/dev/sda2"], 0.01)
+}
+
+func TestRateCalculatorNumaCpuUsage(t *testing.T) {
+	key := core.NodeKey("node1")
+	now := time.Now()
+
+	batch := func(ts time.Time, value int64) *core.DataBatch {
+		return &core.DataBatch{
+			Timestamp: ts,
+			MetricSets: map[string]*core.MetricSet{
+				key: {
+					CreateTime:   now.Add(-time.Hour),
+					ScrapeTime:   ts,
+					MetricValues: map[string]core.MetricValue{},
+					LabeledMetrics: []core.LabeledMetric{{
+						Name:   core.MetricNumaCpuUsage.Name,
+						Labels: map[string]string{core.LabelResourceID.Key: core.NumaNodeID(0)},
+						MetricValue: core.MetricValue{
+							ValueType:  core.ValueInt64,
+							MetricType: core.MetricCumulative,
+							IntValue:   value,
+						},
+					}},
+				},
+			},
+		}
+	}
+
+	prev := batch(now.Add(-time.Minute), 0)
+	// Two cores busy for a minute.
+	current := batch(now, 2*int64(time.Minute))
+
+	procesor := NewRateCalculator(core.RateMetricsMapping)
+	procesor.Process(prev)
+	procesor.Process(current)
+
+	metrics := current.MetricSets[key].LabeledMetrics
+	require.Len(t, metrics, 2)
+	assert.Equal(t, core.MetricNumaCpuUsageRate.Name, metrics[1].Name)
+	assert.Equal(t, core.ValueInt64, metrics[1].ValueType)
+	assert.Equal(t, int64(2000), metrics[1].IntValue)
+	assert.Equal(t, "node0", metrics[1].Labels[core.LabelResourceID.Key])
 }
@@ -0,0 +1,222 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batching
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const DefaultTargetLatency = 5 * time.Second
+
+var batchSizeGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "heapster",
+		Subsystem: "exporter",
+		Name:      "batch_size",
+		Help:      "Number of points sent in a request by the sinks batching them.",
+	},
+	[]string{"exporter"},
+)
+
+func init() {
+	prometheus.MustRegister(batchSizeGauge)
+}
+
+// BatchSize is the number of points a sink sends in a request. When adaptive, it is adjusted
+// with the outcome of every request, additive increase and multiplicative decrease (AIMD): it
+// grows by the minimum size after a full batch was sent within the target latency, and halves
+// after a failed or slow request. This finds the largest batches the backend can take, e.g. to
+// catch up quickly after an outage, without running into timeouts.
+type BatchSize struct {
+	sync.Mutex
+
+	name     string
+	adaptive bool
+	size     int
+	min      int
+	max      int
+	// Latency above which a request is too slow.
+	target time.Duration
+}
+
+// Fixed returns a batch size that never changes.
+func Fixed(size int) *BatchSize {
+	return &BatchSize{size: size, min: size, max: size}
+}
+
+// NewBatchSize creates the batch size of the named sink from its `batchsize`, `adaptivebatch`,
+// `minbatchsize`, `maxbatchsize` and `batchlatency` options.
+func NewBatchSize(name string, opts url.Values, defaultSize int) (*BatchSize, error) {
+	this := Fixed(defaultSize)
+	this.name = name
+	this.target = DefaultTargetLatency
+
+	parseSize := func(option string, value *int) error {
+		if len(opts[option]) < 1 {
+			return nil
+		}
+		size, err := strconv.Atoi(opts[option][0])
+		if err != nil || size < 1 {
+			return fmt.Errorf("failed to parse `%s` flag - should be a positive number", option)
+		}
+		*value = size
+		return nil
+	}
+	if err := parseSize("batchsize", &this.size); err != nil {
+		return nil, err
+	}
+	if len(opts["adaptivebatch"]) >= 1 {
+		adaptive, err := strconv.ParseBool(opts["adaptivebatch"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `adaptivebatch` flag - %v", err)
+		}
+		this.adaptive = adaptive
+	}
+	this.min = this.size / 10
+	if this.min < 1 {
+		this.min = 1
+	}
+	this.max = this.size * 10
+	if err := parseSize("minbatchsize", &this.min); err != nil {
+		return nil, err
+	}
+	if err := parseSize("maxbatchsize", &this.max); err != nil {
+		return nil, err
+	}
+	if this.min > this.max {
+		return nil, fmt.Errorf("`minbatchsize` flag can't be greater than `maxbatchsize`")
+	}
+	if len(opts["batchlatency"]) >= 1 {
+		target, err := time.ParseDuration(opts["batchlatency"][0])
+		if err != nil || target <= 0 {
+			return nil, fmt.Errorf("failed to parse `batchlatency` flag - should be a positive duration")
+		}
+		this.target = target
+	}
+
+	if !this.adaptive {
+		this.min = this.size
+		this.max = this.size
+	}
+	this.set(this.size)
+	return this, nil
+}
+
+// Size returns the number of points to send in the next request.
+func (this *BatchSize) Size() int {
+	this.Lock()
+	defer this.Unlock()
+	return this.size
+}
+
+// Record adjusts an adaptive batch size with the outcome of a request sending the given number
+// of points.
+func (this *BatchSize) Record(points int, latency time.Duration, err error) {
+	this.Lock()
+	defer this.Unlock()
+	if !this.adaptive {
+		return
+	}
+	switch {
+	case err != nil || latency > this.target:
+		this.set(this.size / 2)
+	case points >= this.size:
+		// Partial batches say nothing about how much larger ones would take.
+		this.set(this.size + this.min)
+	}
+}
+
+func (this *BatchSize) set(size int) {
+	if size < this.min {
+		size = this.min
+	}
+	if size > this.max {
+		size = this.max
+	}
+	this.size = size
+	if this.name != "" {
+		batchSizeGauge.WithLabelValues(this.name).Set(float64(size))
+	}
+}
+
+// Concurrency is the number of requests a sink sends at the same time, from its `concurrency`
+// option. The requests of a batch are sent one after the other by default.
+type Concurrency int
+
+func NewConcurrency(opts url.Values) (Concurrency, error) {
+	if len(opts["concurrency"]) < 1 {
+		return 1, nil
+	}
+	concurrency, err := strconv.Atoi(opts["concurrency"][0])
+	if err != nil || concurrency < 1 {
+		return 0, fmt.Errorf("failed to parse `concurrency` flag - should be a positive number")
+	}
+	return Concurrency(concurrency), nil
+}
+
+// Start returns the requests of a batch, sent with the concurrency.
+func (this Concurrency) Start() *Requests {
+	if this < 1 {
+		this = 1
+	}
+	return &Requests{slots: make(chan struct{}, int(this))}
+}
+
+// Requests sends the requests of a batch, at most as many at the same time as its concurrency.
+type Requests struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+	lock  sync.Mutex
+	err   error
+}
+
+// Go sends a request, waiting for one of the requests in flight to complete if there are
+// already as many as the concurrency. Without concurrency the request is sent before Go returns,
+// so that the next request has the batch size adjusted by this one.
+func (this *Requests) Go(send func() error) {
+	if cap(this.slots) == 1 {
+		this.record(send())
+		return
+	}
+	this.slots <- struct{}{}
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+		defer func() { <-this.slots }()
+		this.record(send())
+	}()
+}
+
+func (this *Requests) record(err error) {
+	if err != nil {
+		this.lock.Lock()
+		this.err = err
+		this.lock.Unlock()
+	}
+}
+
+// Wait waits for the requests in flight, and returns the error of a failed request if any.
+func (this *Requests) Wait() error {
+	this.wg.Wait()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.err
+}
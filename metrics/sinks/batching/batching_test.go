@@ -0,0 +1,134 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batching
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBatchSize(t *testing.T, query string) *BatchSize {
+	opts, err := url.ParseQuery(query)
+	require.NoError(t, err)
+	batchSize, err := NewBatchSize("", opts, 1000)
+	require.NoError(t, err)
+	return batchSize
+}
+
+func TestFixedBatchSize(t *testing.T) {
+	batchSize := newTestBatchSize(t, "batchsize=200")
+	assert.Equal(t, 200, batchSize.Size())
+	batchSize.Record(200, time.Minute, fmt.Errorf("timeout"))
+	batchSize.Record(200, time.Millisecond, nil)
+	assert.Equal(t, 200, batchSize.Size())
+
+	assert.Equal(t, 1000, newTestBatchSize(t, "").Size())
+	assert.Equal(t, 50, Fixed(50).Size())
+}
+
+func TestAdaptiveBatchSize(t *testing.T) {
+	batchSize := newTestBatchSize(t, "adaptivebatch=true&minbatchsize=100&maxbatchsize=1300&batchlatency=1s")
+	assert.Equal(t, 1000, batchSize.Size())
+
+	// Additive increase after full batches only.
+	batchSize.Record(1000, 100*time.Millisecond, nil)
+	assert.Equal(t, 1100, batchSize.Size())
+	batchSize.Record(500, 100*time.Millisecond, nil)
+	assert.Equal(t, 1100, batchSize.Size())
+	batchSize.Record(1100, 100*time.Millisecond, nil)
+	batchSize.Record(1200, 100*time.Millisecond, nil)
+	batchSize.Record(1300, 100*time.Millisecond, nil)
+	assert.Equal(t, 1300, batchSize.Size())
+
+	// Multiplicative decrease after slow or failed requests.
+	batchSize.Record(1300, 2*time.Second, nil)
+	assert.Equal(t, 650, batchSize.Size())
+	batchSize.Record(650, 10*time.Millisecond, fmt.Errorf("unavailable"))
+	assert.Equal(t, 325, batchSize.Size())
+	batchSize.Record(325, 10*time.Millisecond, fmt.Errorf("unavailable"))
+	batchSize.Record(162, 10*time.Millisecond, fmt.Errorf("unavailable"))
+	assert.Equal(t, 100, batchSize.Size())
+}
+
+func TestAdaptiveBatchSizeDefaults(t *testing.T) {
+	batchSize := newTestBatchSize(t, "adaptivebatch=true&batchsize=500")
+	assert.Equal(t, 50, batchSize.min)
+	assert.Equal(t, 5000, batchSize.max)
+	assert.Equal(t, DefaultTargetLatency, batchSize.target)
+}
+
+func TestNewBatchSizeErrors(t *testing.T) {
+	for _, query := range []string{
+		"batchsize=0",
+		"adaptivebatch=maybe",
+		"adaptivebatch=true&minbatchsize=x",
+		"adaptivebatch=true&minbatchsize=100&maxbatchsize=10",
+		"adaptivebatch=true&batchlatency=-1s",
+	} {
+		opts, err := url.ParseQuery(query)
+		require.NoError(t, err)
+		_, err = NewBatchSize("", opts, 1000)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	opts, err := url.ParseQuery("concurrency=3")
+	require.NoError(t, err)
+	concurrency, err := NewConcurrency(opts)
+	require.NoError(t, err)
+	assert.Equal(t, Concurrency(3), concurrency)
+
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	requests := concurrency.Start()
+	for i := 0; i < 10; i++ {
+		i := i
+		requests.Go(func() error {
+			lock.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			lock.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			lock.Lock()
+			inFlight--
+			lock.Unlock()
+			if i == 4 {
+				return fmt.Errorf("unavailable")
+			}
+			return nil
+		})
+	}
+	assert.Error(t, requests.Wait())
+	assert.Equal(t, 3, maxInFlight)
+
+	concurrency, err = NewConcurrency(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, Concurrency(1), concurrency)
+	for _, query := range []string{"concurrency=0", "concurrency=x"} {
+		opts, err := url.ParseQuery(query)
+		require.NoError(t, err)
+		_, err = NewConcurrency(opts)
+		assert.Error(t, err, query)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/metrics/core"
+)
+
+// BenchmarkOptions describes the synthetic load sent to a sink by Benchmark.
+type BenchmarkOptions struct {
+	// Batches per second.
+	Rate     float64
+	Duration time.Duration
+	// Size of the synthetic cluster of the batches.
+	Nodes            int
+	PodsPerNode      int
+	ContainersPerPod int
+	// Maximum number of batches exported at the same time. A batch due while as many are being
+	// exported is missed.
+	Concurrency int
+}
+
+// BenchmarkReport summarizes the exports of a benchmark.
+type BenchmarkReport struct {
+	Sink    string
+	Elapsed time.Duration
+	Target  float64
+	Batches int
+	Points  int64
+	// Failed exports, only known if the sink reports its failures, i.e. supports retries.
+	Errors          int
+	ReportsFailures bool
+	Missed          int
+	P50             time.Duration
+	P90             time.Duration
+	P99             time.Duration
+	Max             time.Duration
+}
+
+// BatchesPerSecond returns the rate of the exported batches.
+func (this BenchmarkReport) BatchesPerSecond() float64 {
+	if this.Elapsed <= 0 {
+		return 0
+	}
+	return float64(this.Batches) / this.Elapsed.Seconds()
+}
+
+// PointsPerSecond returns the rate of the exported points.
+func (this BenchmarkReport) PointsPerSecond() float64 {
+	if this.Elapsed <= 0 {
+		return 0
+	}
+	return float64(this.Points) / this.Elapsed.Seconds()
+}
+
+// ErrorRate returns the ratio of the exports which failed, 0 if the sink doesn't report its failures.
+func (this BenchmarkReport) ErrorRate() float64 {
+	if this.Batches == 0 {
+		return 0
+	}
+	return float64(this.Errors) / float64(this.Batches)
+}
+
+func (this BenchmarkReport) String() string {
+	errors := "unknown, the sink doesn't report its failures"
+	if this.ReportsFailures {
+		errors = fmt.Sprintf("%d (%.2f%%)", this.Errors, 100*this.ErrorRate())
+	}
+	return fmt.Sprintf(`sink:        %s
+elapsed:     %v
+target:      %.2f batches/s
+throughput:  %.2f batches/s, %.0f points/s
+batches:     %d exported, %d missed
+errors:      %s
+latency:     p50 %v, p90 %v, p99 %v, max %v
+`, this.Sink, this.Elapsed, this.Target, this.BatchesPerSecond(), this.PointsPerSecond(),
+		this.Batches, this.Missed, errors, this.P50, this.P90, this.P99, this.Max)
+}
+
+// NewBenchmarkSink creates the sink of the uri wrapped like by the sink manager, so that the
+// retries, rate limits and filters of its options are part of the benchmark.
+func NewBenchmarkSink(factory *SinkFactory, uri flags.Uri) (core.DataSink, error) {
+	sink, err := factory.Build(uri)
+	if err != nil {
+		return nil, err
+	}
+	_, retryable := sink.(core.RetryableSink)
+	wrapped, err := wrap(sink, uri)
+	if err != nil {
+		return nil, err
+	}
+	return &benchmarkSink{DataSink: wrapped, reportsFailures: retryable}, nil
+}
+
+// A sink built for a benchmark, which knows whether the sink it wraps reports its failures.
+type benchmarkSink struct {
+	core.DataSink
+	reportsFailures bool
+}
+
+func (this *benchmarkSink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *benchmarkSink) exportData(data *core.DataBatch) error {
+	return tryExportData(this.DataSink, data)
+}
+
+// Returns whether the failed exports to the sink are reported, the other sinks always seem to
+// succeed.
+func reportsFailures(sink core.DataSink) bool {
+	switch s := sink.(type) {
+	case *benchmarkSink:
+		return s.reportsFailures
+	case core.RetryableSink:
+		return true
+	}
+	return false
+}
+
+// Benchmark exports synthetic batches to the sink at the rate of the options and reports the
+// achieved throughput, the latencies of the exports and, if the sink reports them, their errors.
+func Benchmark(sink core.DataSink, opts BenchmarkOptions) (BenchmarkReport, error) {
+	if opts.Rate <= 0 {
+		return BenchmarkReport{}, fmt.Errorf("the rate must be positive, got %v", opts.Rate)
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	report := BenchmarkReport{Sink: sink.Name(), Target: opts.Rate, ReportsFailures: reportsFailures(sink)}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	latencies := []time.Duration{}
+	slots := make(chan struct{}, opts.Concurrency)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+	defer ticker.Stop()
+
+	start := time.Now()
+	deadline := time.After(opts.Duration)
+	for sequence := 0; ; sequence++ {
+		select {
+		case <-deadline:
+			wg.Wait()
+			report.Elapsed = time.Since(start)
+			summarizeLatencies(&report, latencies)
+			return report, nil
+		case now := <-ticker.C:
+			select {
+			case slots <- struct{}{}:
+			default:
+				report.Missed++
+				continue
+			}
+			batch := SyntheticBatch(opts, now, sequence)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				exportStart := time.Now()
+				err := tryExportData(sink, batch)
+				latency := time.Since(exportStart)
+				<-slots
+
+				lock.Lock()
+				defer lock.Unlock()
+				report.Batches++
+				report.Points += int64(batchPoints(batch))
+				if err != nil {
+					report.Errors++
+				}
+				latencies = append(latencies, latency)
+			}()
+		}
+	}
+}
+
+func summarizeLatencies(report *BenchmarkReport, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Sort(durations(latencies))
+	percentile := func(p float64) time.Duration {
+		index := int(p*float64(len(latencies))+0.5) - 1
+		if index < 0 {
+			index = 0
+		}
+		return latencies[index]
+	}
+	report.P50 = percentile(0.5)
+	report.P90 = percentile(0.9)
+	report.P99 = percentile(0.99)
+	report.Max = latencies[len(latencies)-1]
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// SyntheticBatch returns a batch of the synthetic cluster of the options at the given time. The
+// values change with the sequence number of the batch, so that the sinks dropping unchanged
+// values export them.
+func SyntheticBatch(opts BenchmarkOptions, timestamp time.Time, sequence int) *core.DataBatch {
+	batch := &core.DataBatch{
+		Timestamp:  timestamp,
+		MetricSets: make(map[string]*core.MetricSet),
+	}
+	value := int64(sequence + 1)
+	for n := 0; n < opts.Nodes; n++ {
+		node := fmt.Sprintf("bench-node-%d", n)
+		batch.MetricSets[core.NodeKey(node)] = syntheticMetricSet(timestamp, value, map[string]string{
+			core.LabelMetricSetType.Key: core.MetricSetTypeNode,
+			core.LabelNodename.Key:      node,
+			core.LabelHostname.Key:      node,
+			core.LabelHostID.Key:        node,
+		})
+		for p := 0; p < opts.PodsPerNode; p++ {
+			namespace := fmt.Sprintf("bench-ns-%d", p%10)
+			pod := fmt.Sprintf("%s-pod-%d", node, p)
+			podLabels := map[string]string{
+				core.LabelMetricSetType.Key: core.MetricSetTypePod,
+				core.LabelNamespaceName.Key: namespace,
+				core.LabelPodNamespace.Key:  namespace,
+				core.LabelPodName.Key:       pod,
+				core.LabelPodId.Key:         pod,
+				core.LabelNodename.Key:      node,
+				core.LabelHostname.Key:      node,
+				core.LabelHostID.Key:        node,
+				core.LabelLabels.Key:        "app:bench",
+			}
+			batch.MetricSets[core.PodKey(namespace, pod)] = syntheticMetricSet(timestamp, value, podLabels)
+			for c := 0; c < opts.ContainersPerPod; c++ {
+				container := fmt.Sprintf("container-%d", c)
+				containerLabels := map[string]string{
+					core.LabelMetricSetType.Key:      core.MetricSetTypePodContainer,
+					core.LabelContainerName.Key:      container,
+					core.LabelContainerBaseImage.Key: "bench:latest",
+				}
+				for key, label := range podLabels {
+					if key != core.LabelMetricSetType.Key {
+						containerLabels[key] = label
+					}
+				}
+				batch.MetricSets[core.PodContainerKey(namespace, pod, container)] = syntheticMetricSet(timestamp, value, containerLabels)
+			}
+		}
+	}
+	return batch
+}
+
+func syntheticMetricSet(timestamp time.Time, value int64, labels map[string]string) *core.MetricSet {
+	return &core.MetricSet{
+		CreateTime: timestamp.Add(-time.Hour),
+		ScrapeTime: timestamp,
+		Labels:     labels,
+		MetricValues: map[string]core.MetricValue{
+			core.MetricCpuUsage.Name:         {ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 1000000 * value},
+			core.MetricCpuUsageRate.Name:     {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 100 + value%100},
+			core.MetricMemoryUsage.Name:      {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1024 * 1024 * (100 + value%100)},
+			core.MetricMemoryWorkingSet.Name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1024 * 1024 * (50 + value%50)},
+			core.MetricNetworkRx.Name:        {ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 4096 * value},
+			core.MetricNetworkTx.Name:        {ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 2048 * value},
+		},
+	}
+}
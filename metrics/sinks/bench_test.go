@@ -0,0 +1,105 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/metrics/core"
+)
+
+// A sink taking the given time to export a batch.
+type slowSink struct {
+	recordingSink
+	delay time.Duration
+}
+
+func (this *slowSink) ExportData(data *core.DataBatch) {
+	time.Sleep(this.delay)
+}
+
+func TestSyntheticBatch(t *testing.T) {
+	opts := BenchmarkOptions{Nodes: 2, PodsPerNode: 3, ContainersPerPod: 2}
+	now := time.Now()
+	batch := SyntheticBatch(opts, now, 0)
+	assert.Equal(t, now, batch.Timestamp)
+	// Nodes, pods and containers.
+	assert.Len(t, batch.MetricSets, 2+2*3+2*3*2)
+	assert.Equal(t, 6*len(batch.MetricSets), batchPoints(batch))
+
+	container := batch.MetricSets[core.PodContainerKey("bench-ns-1", "bench-node-0-pod-1", "container-1")]
+	require.NotNil(t, container)
+	assert.Equal(t, "bench-node-0", container.Labels[core.LabelNodename.Key])
+
+	// The values change from batch to batch.
+	next := SyntheticBatch(opts, now.Add(time.Second), 1)
+	key := core.NodeKey("bench-node-1")
+	assert.NotEqual(t, batch.MetricSets[key].MetricValues[core.MetricMemoryUsage.Name],
+		next.MetricSets[key].MetricValues[core.MetricMemoryUsage.Name])
+}
+
+func TestBenchmark(t *testing.T) {
+	sink := &flakySink{}
+	opts := BenchmarkOptions{Rate: 100, Duration: 200 * time.Millisecond, Nodes: 1, PodsPerNode: 2}
+	report, err := Benchmark(sink, opts)
+	require.NoError(t, err)
+	assert.True(t, report.Batches > 5, "%d batches", report.Batches)
+	assert.Equal(t, report.Batches, sink.attempts)
+	assert.Equal(t, int64(report.Batches*3*6), report.Points)
+	assert.Equal(t, 0, report.Errors)
+	assert.True(t, report.ReportsFailures)
+	assert.True(t, report.BatchesPerSecond() > 0)
+	assert.True(t, report.P50 <= report.P99 && report.P99 <= report.Max)
+
+	// The failed exports are reported.
+	sink.down = true
+	report, err = Benchmark(sink, opts)
+	require.NoError(t, err)
+	assert.Equal(t, report.Batches, report.Errors)
+	assert.Equal(t, 1.0, report.ErrorRate())
+
+	_, err = Benchmark(sink, BenchmarkOptions{Duration: time.Second})
+	assert.Error(t, err)
+}
+
+func TestBenchmarkMissedBatches(t *testing.T) {
+	sink := &slowSink{delay: 50 * time.Millisecond}
+	report, err := Benchmark(sink, BenchmarkOptions{Rate: 100, Duration: 300 * time.Millisecond, Nodes: 1})
+	require.NoError(t, err)
+	assert.True(t, report.Missed > 0)
+	assert.True(t, report.Batches <= 7, "%d batches", report.Batches)
+	assert.True(t, report.P50 >= 50*time.Millisecond)
+	// The sink doesn't report its failures.
+	assert.False(t, report.ReportsFailures)
+	assert.Contains(t, report.String(), "errors:      unknown")
+}
+
+func TestNewBenchmarkSink(t *testing.T) {
+	var uri flags.Uri
+	require.NoError(t, uri.Set("log:?rateLimit=1000"))
+	sink, err := NewBenchmarkSink(NewSinkFactory(), uri)
+	require.NoError(t, err)
+	_, wrapped := sink.(*benchmarkSink).DataSink.(*rateLimitSink)
+	assert.True(t, wrapped)
+	assert.False(t, reportsFailures(sink))
+
+	require.NoError(t, uri.Set("unknown"))
+	_, err = NewBenchmarkSink(NewSinkFactory(), uri)
+	assert.Error(t, err)
+}
@@ -0,0 +1,163 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// Values of the breaker state metric.
+var breakerStateValues = map[string]float64{
+	BreakerClosed:   0,
+	BreakerOpen:     1,
+	BreakerHalfOpen: 2,
+}
+
+var (
+	// State of the circuit breaker of sink.
+	exporterBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "exporter",
+			Name:      "circuit_breaker_state",
+			Help:      "State of the circuit breaker of sink: 0 if closed, 1 if open, 2 if half-open while probing the sink.",
+		},
+		[]string{"exporter"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(exporterBreakerState)
+}
+
+var breakerConfig struct {
+	sync.RWMutex
+	failures      int
+	probeInterval time.Duration
+}
+
+// ConfigureCircuitBreaker sets the number of consecutive failed exports after which the sink
+// manager stops pushing batches to a sink, and the interval at which it then probes the sink
+// with a single batch. Applies to the sinks added to a manager afterwards, 0 failures disables
+// the circuit breakers.
+func ConfigureCircuitBreaker(failures int, probeInterval time.Duration) {
+	breakerConfig.Lock()
+	defer breakerConfig.Unlock()
+	breakerConfig.failures = failures
+	breakerConfig.probeInterval = probeInterval
+}
+
+// Keeps the sink manager from pushing batches to a sink failing persistently, so that a dead
+// backend doesn't hold a batch for the export timeout every cycle. Opens after the given number
+// of consecutive failures, and lets a batch through once per probe interval while open. The
+// breaker closes again once a probe succeeds. The failures reported by the sinks count, see
+// tryExportData, as well as the batches which the sinks were still too busy to take in the export
+// timeout. A nil breaker never opens.
+type circuitBreaker struct {
+	sync.Mutex
+	name          string
+	failures      int
+	probeInterval time.Duration
+	state         string
+	consecutive   int
+	nextProbe     time.Time
+}
+
+// Returns nil if the circuit breakers are disabled.
+func newCircuitBreaker(name string) *circuitBreaker {
+	breakerConfig.RLock()
+	defer breakerConfig.RUnlock()
+	if breakerConfig.failures <= 0 {
+		return nil
+	}
+	exporterBreakerState.WithLabelValues(name).Set(breakerStateValues[BreakerClosed])
+	return &circuitBreaker{
+		name:          name,
+		failures:      breakerConfig.failures,
+		probeInterval: breakerConfig.probeInterval,
+		state:         BreakerClosed,
+	}
+}
+
+// Returns whether a batch may be pushed to the sink. An open breaker turns half-open when the
+// probe is due, letting that batch only through until its export completes.
+func (this *circuitBreaker) allow(now time.Time) bool {
+	if this == nil {
+		return true
+	}
+	this.Lock()
+	defer this.Unlock()
+	switch this.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if now.Before(this.nextProbe) {
+			return false
+		}
+		glog.Infof("Probing sink %s after %d consecutive failures", this.name, this.consecutive)
+		this.setState(BreakerHalfOpen)
+		return true
+	}
+	return false
+}
+
+// Records the outcome of an export to the sink.
+func (this *circuitBreaker) record(now time.Time, err error) {
+	if this == nil {
+		return
+	}
+	this.Lock()
+	defer this.Unlock()
+	if err == nil {
+		if this.state != BreakerClosed {
+			glog.Infof("Sink %s recovered, pushing batches to it again", this.name)
+			this.setState(BreakerClosed)
+		}
+		this.consecutive = 0
+		return
+	}
+	this.consecutive++
+	if this.state == BreakerHalfOpen || (this.state == BreakerClosed && this.consecutive >= this.failures) {
+		glog.Warningf("Sink %s failed %d times in a row, probing it again in %v", this.name, this.consecutive, this.probeInterval)
+		this.setState(BreakerOpen)
+		this.nextProbe = now.Add(this.probeInterval)
+	}
+}
+
+// Returns the state of the breaker, empty if disabled.
+func (this *circuitBreaker) get() string {
+	if this == nil {
+		return ""
+	}
+	this.Lock()
+	defer this.Unlock()
+	return this.state
+}
+
+// Must be called with the lock held.
+func (this *circuitBreaker) setState(state string) {
+	this.state = state
+	exporterBreakerState.WithLabelValues(this.name).Set(breakerStateValues[state])
+}
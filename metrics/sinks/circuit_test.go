@@ -0,0 +1,141 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ConfigureCircuitBreaker(0, time.Minute)
+	assert.Nil(t, newCircuitBreaker("disabled"))
+
+	ConfigureCircuitBreaker(3, time.Minute)
+	defer ConfigureCircuitBreaker(0, 0)
+	breaker := newCircuitBreaker("test")
+	require.NotNil(t, breaker)
+	failure := errors.New("backend down")
+	now := time.Now()
+
+	// A success resets the count of failures.
+	breaker.record(now, failure)
+	breaker.record(now, failure)
+	breaker.record(now, nil)
+	breaker.record(now, failure)
+	breaker.record(now, failure)
+	assert.Equal(t, BreakerClosed, breaker.get())
+	assert.True(t, breaker.allow(now))
+
+	breaker.record(now, failure)
+	assert.Equal(t, BreakerOpen, breaker.get())
+	assert.False(t, breaker.allow(now.Add(59*time.Second)))
+
+	// A single probe goes through, and opens the breaker again if it fails.
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.allow(now))
+	assert.Equal(t, BreakerHalfOpen, breaker.get())
+	assert.False(t, breaker.allow(now))
+	breaker.record(now, failure)
+	assert.Equal(t, BreakerOpen, breaker.get())
+	assert.False(t, breaker.allow(now.Add(30*time.Second)))
+
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.allow(now))
+	breaker.record(now, nil)
+	assert.Equal(t, BreakerClosed, breaker.get())
+	assert.True(t, breaker.allow(now))
+}
+
+// Waits for the stats of the sinks of the manager to satisfy the condition.
+func waitForStats(t *testing.T, manager core.DataSink, condition func([]SinkStats) bool) []SinkStats {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := manager.(StatsProvider).Stats()
+		if condition(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the sink stats, got %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestManagerSkipsOpenBreakers(t *testing.T) {
+	ConfigureCircuitBreaker(2, time.Hour)
+	defer ConfigureCircuitBreaker(0, 0)
+	dead := &flakySink{down: true}
+	healthy := &flakySink{}
+	manager, _ := NewDataSinkManager([]core.DataSink{dead, healthy}, time.Second, time.Second)
+
+	manager.ExportData(batchAt(0))
+	manager.ExportData(batchAt(1))
+	// The next batches are only pushed once the second failure opened the breaker.
+	waitForStats(t, manager, func(stats []SinkStats) bool {
+		return stats[0].CircuitBreaker == BreakerOpen
+	})
+	for i := 2; i < 5; i++ {
+		manager.ExportData(batchAt(i))
+	}
+	stats := waitForStats(t, manager, func(stats []SinkStats) bool {
+		return stats[1].Exports == 5
+	})
+	assert.Equal(t, int64(2), stats[0].Exports)
+	assert.Equal(t, int64(2), stats[0].Failures)
+	assert.Equal(t, BreakerOpen, stats[0].CircuitBreaker)
+	assert.Equal(t, int64(5), stats[0].DroppedBatches)
+	assert.Equal(t, int64(0), stats[1].Failures)
+	assert.Equal(t, BreakerClosed, stats[1].CircuitBreaker)
+}
+
+// A sink blocking its exports until it's released.
+type blockingSink struct {
+	recordingSink
+	release chan struct{}
+}
+
+func (this *blockingSink) ExportData(data *core.DataBatch) {
+	<-this.release
+}
+
+func TestPushTimeoutsOpenBreakers(t *testing.T) {
+	ConfigureCircuitBreaker(2, time.Hour)
+	defer ConfigureCircuitBreaker(0, 0)
+	// The sink doesn't report its failures, but it hangs.
+	sink := &blockingSink{release: make(chan struct{})}
+	defer close(sink.release)
+	manager, _ := NewDataSinkManager([]core.DataSink{sink}, 10*time.Millisecond, time.Second)
+
+	// The first batch is taken, the next two time out.
+	for i := 0; i < 3; i++ {
+		manager.ExportData(batchAt(i))
+	}
+	stats := manager.(StatsProvider).Stats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, BreakerOpen, stats[0].CircuitBreaker)
+	assert.Equal(t, int64(2), stats[0].DroppedBatches)
+
+	// The next batches are dropped right away.
+	start := time.Now()
+	manager.ExportData(batchAt(3))
+	assert.True(t, time.Since(start) < 10*time.Millisecond)
+	assert.Equal(t, int64(3), manager.(StatsProvider).Stats()[0].DroppedBatches)
+}
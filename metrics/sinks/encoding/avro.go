@@ -0,0 +1,409 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/heapster/common/transport"
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+	schemaRegistryTimeout     = 10 * time.Second
+)
+
+// The schema used when no schema is configured. Custom schemas can use the same fields
+// and additionally fields named after tags, e.g. namespace_name, see avroDatum.
+const defaultAvroSchema = `{
+  "type": "record",
+  "name": "MetricPoint",
+  "namespace": "io.k8s.heapster",
+  "fields": [
+    {"name": "name", "type": "string"},
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "value", "type": ["null", "long", "double"]},
+    {"name": "tags", "type": {"type": "map", "values": "string"}}
+  ]
+}`
+
+// A parsed Avro schema. Only the types needed for metric points are supported: primitive
+// types, records, maps, arrays and unions.
+type avroSchema struct {
+	typ string
+	// Fields of records.
+	fields []avroField
+	// Type of the values of maps and the items of arrays.
+	items *avroSchema
+	// Branches of unions.
+	branches []*avroSchema
+}
+
+type avroField struct {
+	name   string
+	schema *avroSchema
+	// Default value, nil if there is none.
+	defaultValue interface{}
+}
+
+// Encodes metric points with an Avro schema registered with a Confluent Schema Registry.
+// Messages use the Confluent wire format: a zero magic byte, the 4 byte schema id and the
+// Avro encoded point.
+type avroEncoder struct {
+	schema   *avroSchema
+	schemaId int32
+}
+
+// Creates the encoder from the `schemaregistry`, `avroschema` and `avrosubject` options.
+func newAvroEncoderFromOpts(opts url.Values) (*avroEncoder, error) {
+	if len(opts["schemaregistry"]) < 1 {
+		return nil, fmt.Errorf("the `schemaregistry` flag is required for the avro format")
+	}
+	if len(opts["avrosubject"]) < 1 {
+		return nil, fmt.Errorf("the `avrosubject` flag is required for the avro format")
+	}
+	schemaText := defaultAvroSchema
+	if len(opts["avroschema"]) >= 1 {
+		content, err := ioutil.ReadFile(opts["avroschema"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `avroschema` flag - %v", err)
+		}
+		schemaText = string(content)
+	}
+	return newAvroEncoder(opts["schemaregistry"][0], opts["avrosubject"][0], schemaText)
+}
+
+func newAvroEncoder(registryUrl, subject, schemaText string) (*avroEncoder, error) {
+	schema, err := parseAvroSchema(schemaText)
+	if err != nil {
+		return nil, err
+	}
+	if schema.typ != "record" {
+		return nil, fmt.Errorf("Avro schema should be a record, got %s", schema.typ)
+	}
+	id, err := registerAvroSchema(registryUrl, subject, schemaText)
+	if err != nil {
+		return nil, err
+	}
+	return &avroEncoder{schema: schema, schemaId: id}, nil
+}
+
+func (this *avroEncoder) Encode(point *Point) ([]byte, error) {
+	return this.encode(avroDatum(point.Name, point.Value, point.Labels, point.Timestamp))
+}
+
+func (this *avroEncoder) ContentType() string {
+	return "avro/binary"
+}
+
+func (this *avroEncoder) encode(datum map[string]interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(0)
+	binary.Write(buf, binary.BigEndian, this.schemaId)
+	if err := this.schema.encode(buf, datum); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns the fields of a metric point as expected by the schema. Besides name, timestamp,
+// value and tags, every tag is available as a field of its own unless it clashes with them.
+func avroDatum(name string, value core.MetricValue, tags map[string]string, timestamp time.Time) map[string]interface{} {
+	datum := make(map[string]interface{}, len(tags)+4)
+	for key, tag := range tags {
+		datum[key] = tag
+	}
+	datum["name"] = name
+	datum["timestamp"] = timestamp.UnixNano() / int64(time.Millisecond)
+	switch value.ValueType {
+	case core.ValueInt64:
+		datum["value"] = value.IntValue
+	case core.ValueFloat:
+		datum["value"] = float64(value.FloatValue)
+	default:
+		datum["value"] = nil
+	}
+	datum["tags"] = tags
+	return datum
+}
+
+// Registers the schema under the subject, returning its id. Registering an already
+// registered schema returns the existing id.
+func registerAvroSchema(registryUrl, subject, schemaText string) (int32, error) {
+	body, err := json.Marshal(map[string]string{"schema": schemaText})
+	if err != nil {
+		return 0, err
+	}
+	url := strings.TrimSuffix(registryUrl, "/") + "/subjects/" + subject + "/versions"
+	client := transport.NewClient(schemaRegistryTimeout)
+	resp, err := client.Post(url, schemaRegistryContentType, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to register Avro schema: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema registry response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("schema registry returned %s: %s", resp.Status, string(respBody))
+	}
+	var registered struct {
+		Id int32 `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &registered); err != nil {
+		return 0, fmt.Errorf("invalid schema registry response: %v", err)
+	}
+	return registered.Id, nil
+}
+
+func parseAvroSchema(text string) (*avroSchema, error) {
+	var raw interface{}
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %v", err)
+	}
+	return parseAvroType(raw)
+}
+
+func parseAvroType(raw interface{}) (*avroSchema, error) {
+	switch raw := raw.(type) {
+	case string:
+		switch raw {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroSchema{typ: raw}, nil
+		}
+		return nil, fmt.Errorf("unsupported Avro type %q", raw)
+	case []interface{}:
+		schema := &avroSchema{typ: "union"}
+		for _, branch := range raw {
+			parsed, err := parseAvroType(branch)
+			if err != nil {
+				return nil, err
+			}
+			schema.branches = append(schema.branches, parsed)
+		}
+		return schema, nil
+	case map[string]interface{}:
+		typ, _ := raw["type"].(string)
+		switch typ {
+		case "record":
+			fields, _ := raw["fields"].([]interface{})
+			schema := &avroSchema{typ: typ}
+			for _, rawField := range fields {
+				field, _ := rawField.(map[string]interface{})
+				name, _ := field["name"].(string)
+				if name == "" {
+					return nil, fmt.Errorf("Avro record field without a name")
+				}
+				fieldSchema, err := parseAvroType(field["type"])
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %v", name, err)
+				}
+				schema.fields = append(schema.fields, avroField{name: name, schema: fieldSchema, defaultValue: field["default"]})
+			}
+			return schema, nil
+		case "map", "array":
+			itemsKey := "values"
+			if typ == "array" {
+				itemsKey = "items"
+			}
+			items, err := parseAvroType(raw[itemsKey])
+			if err != nil {
+				return nil, err
+			}
+			return &avroSchema{typ: typ, items: items}, nil
+		default:
+			// Primitive types with attributes, e.g. logical types.
+			return parseAvroType(typ)
+		}
+	}
+	return nil, fmt.Errorf("unsupported Avro schema %v", raw)
+}
+
+// Encodes the value in the Avro binary encoding. Records are given as maps from field
+// names to values; missing fields get their default value, or null if the field is nullable.
+func (this *avroSchema) encode(buf *bytes.Buffer, value interface{}) error {
+	switch this.typ {
+	case "null":
+		if value != nil {
+			return fmt.Errorf("expected null, got %v", value)
+		}
+	case "boolean":
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected boolean, got %v", value)
+		}
+		if b {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case "int", "long":
+		n, ok := avroLong(value)
+		if !ok {
+			return fmt.Errorf("expected %s, got %v", this.typ, value)
+		}
+		writeAvroLong(buf, n)
+	case "float", "double":
+		f, ok := avroDouble(value)
+		if !ok {
+			return fmt.Errorf("expected %s, got %v", this.typ, value)
+		}
+		if this.typ == "float" {
+			binary.Write(buf, binary.LittleEndian, math.Float32bits(float32(f)))
+		} else {
+			binary.Write(buf, binary.LittleEndian, math.Float64bits(f))
+		}
+	case "string", "bytes":
+		var data []byte
+		switch value := value.(type) {
+		case string:
+			data = []byte(value)
+		case []byte:
+			data = value
+		default:
+			return fmt.Errorf("expected %s, got %v", this.typ, value)
+		}
+		writeAvroLong(buf, int64(len(data)))
+		buf.Write(data)
+	case "record":
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected record, got %v", value)
+		}
+		for _, field := range this.fields {
+			fieldValue, found := fields[field.name]
+			if !found {
+				fieldValue = field.defaultValue
+			}
+			if err := field.schema.encode(buf, fieldValue); err != nil {
+				return fmt.Errorf("field %s: %v", field.name, err)
+			}
+		}
+	case "map":
+		entries, ok := value.(map[string]string)
+		if !ok {
+			return fmt.Errorf("expected map, got %v", value)
+		}
+		keys := make([]string, 0, len(entries))
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if len(keys) > 0 {
+			writeAvroLong(buf, int64(len(keys)))
+			for _, key := range keys {
+				writeAvroLong(buf, int64(len(key)))
+				buf.WriteString(key)
+				if err := this.items.encode(buf, entries[key]); err != nil {
+					return fmt.Errorf("map value %s: %v", key, err)
+				}
+			}
+		}
+		writeAvroLong(buf, 0)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected array, got %v", value)
+		}
+		if len(items) > 0 {
+			writeAvroLong(buf, int64(len(items)))
+			for _, item := range items {
+				if err := this.items.encode(buf, item); err != nil {
+					return err
+				}
+			}
+		}
+		writeAvroLong(buf, 0)
+	case "union":
+		for i, branch := range this.branches {
+			if branch.accepts(value) {
+				writeAvroLong(buf, int64(i))
+				return branch.encode(buf, value)
+			}
+		}
+		return fmt.Errorf("no branch of the union accepts %v", value)
+	}
+	return nil
+}
+
+// Tells whether the value can be encoded with the schema, used to pick union branches.
+func (this *avroSchema) accepts(value interface{}) bool {
+	switch value.(type) {
+	case nil:
+		return this.typ == "null"
+	case bool:
+		return this.typ == "boolean"
+	case int, int32, int64:
+		return this.typ == "int" || this.typ == "long"
+	case float32, float64:
+		return this.typ == "float" || this.typ == "double"
+	case string:
+		return this.typ == "string"
+	case []byte:
+		return this.typ == "bytes"
+	case map[string]string:
+		return this.typ == "map"
+	case map[string]interface{}:
+		return this.typ == "record"
+	case []interface{}:
+		return this.typ == "array"
+	}
+	return false
+}
+
+func avroLong(value interface{}) (int64, bool) {
+	switch value := value.(type) {
+	case int:
+		return int64(value), true
+	case int32:
+		return int64(value), true
+	case int64:
+		return value, true
+	case float64:
+		// Default values parsed from the schema.
+		return int64(value), value == math.Trunc(value)
+	}
+	return 0, false
+}
+
+func avroDouble(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case float32:
+		return float64(value), true
+	case float64:
+		return value, true
+	case int64:
+		return float64(value), true
+	}
+	return 0, false
+}
+
+// Writes a zig-zag encoded variable length integer.
+func writeAvroLong(buf *bytes.Buffer, n int64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutVarint(scratch[:], n)])
+}
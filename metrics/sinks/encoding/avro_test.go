@@ -0,0 +1,164 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+)
+
+// A schema registry assigning id 42 to every schema.
+func newFakeSchemaRegistry(t *testing.T, subjects *[]string, schemas *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, schemaRegistryContentType, r.Header.Get("Content-Type"))
+		var body struct {
+			Schema string `json:"schema"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		*subjects = append(*subjects, r.URL.Path)
+		*schemas = append(*schemas, body.Schema)
+		w.Write([]byte(`{"id":42}`))
+	}))
+}
+
+func readAvroLong(t *testing.T, r *bytes.Reader) int64 {
+	n, err := binary.ReadVarint(r)
+	require.NoError(t, err)
+	return n
+}
+
+func readAvroString(t *testing.T, r *bytes.Reader) string {
+	data := make([]byte, readAvroLong(t, r))
+	_, err := r.Read(data)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestAvroEncoder(t *testing.T) {
+	var subjects, schemas []string
+	registry := newFakeSchemaRegistry(t, &subjects, &schemas)
+	defer registry.Close()
+
+	uri, err := url.Parse("?format=avro&avrosubject=metrics-value&schemaregistry=" + url.QueryEscape(registry.URL))
+	require.NoError(t, err)
+	encoder, err := NewEncoder(uri.Query(), FormatJson)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/subjects/metrics-value/versions"}, subjects)
+	assert.Equal(t, []string{defaultAvroSchema}, schemas)
+
+	encoded, err := encoder.Encode(&Point{
+		Name:      "cpu/usage_rate",
+		Value:     core.MetricValue{ValueType: core.ValueFloat, MetricType: core.MetricGauge, FloatValue: 0.5},
+		Labels:    map[string]string{"pod_name": "pod1", "namespace_name": "ns1"},
+		Timestamp: time.Unix(1000, 0),
+	})
+	require.NoError(t, err)
+
+	r := bytes.NewReader(encoded)
+	magic, err := r.ReadByte()
+	require.NoError(t, err)
+	assert.Equal(t, byte(0), magic)
+	var id int32
+	require.NoError(t, binary.Read(r, binary.BigEndian, &id))
+	assert.Equal(t, int32(42), id)
+
+	assert.Equal(t, "cpu/usage_rate", readAvroString(t, r))
+	assert.Equal(t, int64(1000000), readAvroLong(t, r))
+	// The double branch of the value union.
+	assert.Equal(t, int64(2), readAvroLong(t, r))
+	var bits uint64
+	require.NoError(t, binary.Read(r, binary.LittleEndian, &bits))
+	assert.Equal(t, 0.5, math.Float64frombits(bits))
+	// A single block of tags, sorted by key.
+	assert.Equal(t, int64(2), readAvroLong(t, r))
+	assert.Equal(t, "namespace_name", readAvroString(t, r))
+	assert.Equal(t, "ns1", readAvroString(t, r))
+	assert.Equal(t, "pod_name", readAvroString(t, r))
+	assert.Equal(t, "pod1", readAvroString(t, r))
+	assert.Equal(t, int64(0), readAvroLong(t, r))
+	assert.Equal(t, 0, r.Len())
+}
+
+func TestAvroCustomSchema(t *testing.T) {
+	var subjects, schemas []string
+	registry := newFakeSchemaRegistry(t, &subjects, &schemas)
+	defer registry.Close()
+
+	schemaText := `{"type": "record", "name": "Point", "fields": [
+		{"name": "name", "type": "string"},
+		{"name": "value", "type": "long"},
+		{"name": "pod_name", "type": ["null", "string"]},
+		{"name": "cluster", "type": "string", "default": "prod"}
+	]}`
+	schemaFile, err := ioutil.TempFile("", "schema")
+	require.NoError(t, err)
+	defer os.Remove(schemaFile.Name())
+	_, err = schemaFile.WriteString(schemaText)
+	require.NoError(t, err)
+	schemaFile.Close()
+
+	uri, err := url.Parse("?format=avro&avrosubject=points&avroschema=" + schemaFile.Name() + "&schemaregistry=" + url.QueryEscape(registry.URL))
+	require.NoError(t, err)
+	encoder, err := newAvroEncoderFromOpts(uri.Query())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/subjects/points/versions"}, subjects)
+	assert.Equal(t, []string{schemaText}, schemas)
+
+	value := core.MetricValue{ValueType: core.ValueInt64, IntValue: -3}
+	encoded, err := encoder.encode(avroDatum("memory/usage", value, map[string]string{}, time.Unix(1, 0)))
+	require.NoError(t, err)
+	r := bytes.NewReader(encoded[5:])
+	assert.Equal(t, "memory/usage", readAvroString(t, r))
+	assert.Equal(t, int64(-3), readAvroLong(t, r))
+	// The missing tag is null, the missing field gets its default.
+	assert.Equal(t, int64(0), readAvroLong(t, r))
+	assert.Equal(t, "prod", readAvroString(t, r))
+	assert.Equal(t, 0, r.Len())
+
+	encoded, err = encoder.encode(avroDatum("memory/usage", value, map[string]string{"pod_name": "pod1"}, time.Unix(1, 0)))
+	require.NoError(t, err)
+	r = bytes.NewReader(encoded[5:])
+	readAvroString(t, r)
+	readAvroLong(t, r)
+	assert.Equal(t, int64(1), readAvroLong(t, r))
+	assert.Equal(t, "pod1", readAvroString(t, r))
+
+	// Float values cannot be encoded as long.
+	_, err = encoder.encode(avroDatum("cpu/usage_rate", core.MetricValue{ValueType: core.ValueFloat, FloatValue: 0.5}, nil, time.Unix(1, 0)))
+	assert.Error(t, err)
+}
+
+func TestAvroOptions(t *testing.T) {
+	_, err := newAvroEncoderFromOpts(url.Values{"avrosubject": {"metrics-value"}})
+	assert.Error(t, err)
+	_, err = newAvroEncoderFromOpts(url.Values{"schemaregistry": {"http://localhost:8081"}})
+	assert.Error(t, err)
+	_, err = parseAvroSchema(`{"type": "enum", "symbols": ["A"]}`)
+	assert.Error(t, err)
+}
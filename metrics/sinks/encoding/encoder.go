@@ -0,0 +1,105 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encoding serializes metric points for the sinks writing payloads, e.g. Kafka
+// messages, so that the payload format is picked with the `format` option of the sink
+// independently of its transport.
+package encoding
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	FormatJson        = "json"
+	FormatProtobuf    = "protobuf"
+	FormatAvro        = "avro"
+	FormatInflux      = "influx"
+	FormatOpenMetrics = "openmetrics"
+)
+
+// A single value of a metric, with the labels of its metric set and of the labeled metric.
+type Point struct {
+	Name      string
+	Value     core.MetricValue
+	Labels    map[string]string
+	Timestamp time.Time
+}
+
+type Encoder interface {
+	// Serializes the point in a self-contained payload.
+	Encode(point *Point) ([]byte, error)
+	// MIME type of the payloads, for the transports carrying it.
+	ContentType() string
+}
+
+// Returns the points of all the metrics of the batch.
+func BatchPoints(dataBatch *core.DataBatch) []*Point {
+	points := make([]*Point, 0)
+	timestamp := dataBatch.Timestamp.UTC()
+	for _, metricSet := range dataBatch.MetricSets {
+		for metricName, metricValue := range metricSet.MetricValues {
+			points = append(points, &Point{
+				Name:      metricName,
+				Value:     metricValue,
+				Labels:    metricSet.Labels,
+				Timestamp: timestamp,
+			})
+		}
+		for _, metric := range metricSet.LabeledMetrics {
+			labels := make(map[string]string)
+			for k, v := range metricSet.Labels {
+				labels[k] = v
+			}
+			for k, v := range metric.Labels {
+				labels[k] = v
+			}
+			points = append(points, &Point{
+				Name:      metric.Name,
+				Value:     metric.MetricValue,
+				Labels:    labels,
+				Timestamp: timestamp,
+			})
+		}
+	}
+	return points
+}
+
+// NewEncoder creates the encoder of the format given by the `format` option, or of the
+// default format of the sink. Formats may have options of their own.
+func NewEncoder(opts url.Values, defaultFormat string) (Encoder, error) {
+	format := defaultFormat
+	if len(opts["format"]) >= 1 {
+		format = opts["format"][0]
+	}
+	switch format {
+	case FormatJson:
+		return &jsonEncoder{}, nil
+	case FormatProtobuf:
+		return &protobufEncoder{}, nil
+	case FormatAvro:
+		return newAvroEncoderFromOpts(opts)
+	case FormatInflux:
+		return &influxEncoder{}, nil
+	case FormatOpenMetrics:
+		return &openMetricsEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("failed to parse `format` flag - unknown format %q, should be one of %s, %s, %s, %s or %s",
+			format, FormatJson, FormatProtobuf, FormatAvro, FormatInflux, FormatOpenMetrics)
+	}
+}
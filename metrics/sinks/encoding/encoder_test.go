@@ -0,0 +1,133 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/matttproud/golang_protobuf_extensions/pbutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func newTestEncoder(t *testing.T, format string) Encoder {
+	encoder, err := NewEncoder(url.Values{"format": {format}}, FormatJson)
+	require.NoError(t, err)
+	return encoder
+}
+
+var (
+	counterPoint = &Point{
+		Name:      "cpu/usage",
+		Value:     core.MetricValue{ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 123456},
+		Labels:    map[string]string{"pod_name": "pod1", "namespace_name": "ns1", "labels": ""},
+		Timestamp: time.Unix(1000, 500000000).UTC(),
+	}
+	gaugePoint = &Point{
+		Name:      "cpu/usage_rate",
+		Value:     core.MetricValue{ValueType: core.ValueFloat, MetricType: core.MetricGauge, FloatValue: 0.5},
+		Labels:    map[string]string{"pod_name": "pod\"1"},
+		Timestamp: time.Unix(1000, 0).UTC(),
+	}
+)
+
+func TestBatchPoints(t *testing.T) {
+	points := BatchPoints(&core.DataBatch{
+		Timestamp: time.Unix(1000, 0),
+		MetricSets: map[string]*core.MetricSet{
+			"node1": {
+				Labels: map[string]string{"nodename": "node1"},
+				MetricValues: map[string]core.MetricValue{
+					"memory/usage": {ValueType: core.ValueInt64, IntValue: 1},
+				},
+				LabeledMetrics: []core.LabeledMetric{{
+					Name:        "filesystem/usage",
+					Labels:      map[string]string{"resource_id": "/dev/sda1"},
+					MetricValue: core.MetricValue{ValueType: core.ValueInt64, IntValue: 2},
+				}},
+			},
+		},
+	})
+	require.Len(t, points, 2)
+	assert.Equal(t, "memory/usage", points[0].Name)
+	assert.Equal(t, map[string]string{"nodename": "node1"}, points[0].Labels)
+	assert.Equal(t, "filesystem/usage", points[1].Name)
+	assert.Equal(t, map[string]string{"nodename": "node1", "resource_id": "/dev/sda1"}, points[1].Labels)
+	assert.Equal(t, time.UTC, points[1].Timestamp.Location())
+}
+
+func TestJsonEncoder(t *testing.T) {
+	encoded, err := newTestEncoder(t, FormatJson).Encode(counterPoint)
+	require.NoError(t, err)
+	assert.Equal(t, `{"MetricsName":"cpu/usage","MetricsValue":{"value":123456},"MetricsTimestamp":"1970-01-01T00:16:40.5Z","MetricsTags":{"labels":"","namespace_name":"ns1","pod_name":"pod1"}}`, string(encoded))
+}
+
+func TestProtobufEncoder(t *testing.T) {
+	encoder := newTestEncoder(t, FormatProtobuf)
+	encoded, err := encoder.Encode(counterPoint)
+	require.NoError(t, err)
+
+	family := &dto.MetricFamily{}
+	_, err = pbutil.ReadDelimited(bytes.NewReader(encoded), family)
+	require.NoError(t, err)
+	assert.Equal(t, "heapster_cpu_usage", family.GetName())
+	assert.Equal(t, dto.MetricType_COUNTER, family.GetType())
+	require.Len(t, family.Metric, 1)
+	metric := family.Metric[0]
+	assert.Equal(t, 123456.0, metric.GetCounter().GetValue())
+	assert.Equal(t, int64(1000500), metric.GetTimestampMs())
+	require.Len(t, metric.Label, 2)
+	assert.Equal(t, "namespace_name", metric.Label[0].GetName())
+	assert.Equal(t, "pod_name", metric.Label[1].GetName())
+
+	_, err = encoder.Encode(&Point{Name: "latency", Value: core.MetricValue{ValueType: core.ValueHistogram}})
+	assert.Error(t, err)
+}
+
+func TestInfluxEncoder(t *testing.T) {
+	encoder := newTestEncoder(t, FormatInflux)
+	encoded, err := encoder.Encode(counterPoint)
+	require.NoError(t, err)
+	assert.Equal(t, "cpu/usage,namespace_name=ns1,pod_name=pod1 value=123456i 1000500000000", string(encoded))
+	encoded, err = encoder.Encode(gaugePoint)
+	require.NoError(t, err)
+	assert.Equal(t, `cpu/usage_rate,pod_name=pod"1 value=0.5 1000000000000`, string(encoded))
+}
+
+func TestOpenMetricsEncoder(t *testing.T) {
+	encoder := newTestEncoder(t, FormatOpenMetrics)
+	encoded, err := encoder.Encode(counterPoint)
+	require.NoError(t, err)
+	assert.Equal(t, "# TYPE heapster_cpu_usage counter\nheapster_cpu_usage_total{namespace_name=\"ns1\",pod_name=\"pod1\"} 123456 1000.5\n# EOF\n", string(encoded))
+	encoded, err = encoder.Encode(gaugePoint)
+	require.NoError(t, err)
+	assert.Equal(t, "# TYPE heapster_cpu_usage_rate gauge\nheapster_cpu_usage_rate{pod_name=\"pod\\\"1\"} 0.5 1000\n# EOF\n", string(encoded))
+}
+
+func TestNewEncoder(t *testing.T) {
+	encoder, err := NewEncoder(url.Values{}, FormatInflux)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", encoder.ContentType())
+	_, err = NewEncoder(url.Values{"format": {"xml"}}, FormatJson)
+	assert.Error(t, err)
+	_, err = NewEncoder(url.Values{"format": {"avro"}}, FormatJson)
+	assert.Error(t, err)
+}
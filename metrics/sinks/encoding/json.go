@@ -0,0 +1,45 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The JSON representation of a point, as sent by the Kafka sink since its first version.
+type JsonPoint struct {
+	MetricsName      string
+	MetricsValue     interface{}
+	MetricsTimestamp time.Time
+	MetricsTags      map[string]string
+}
+
+type jsonEncoder struct{}
+
+func (this *jsonEncoder) Encode(point *Point) ([]byte, error) {
+	return json.Marshal(JsonPoint{
+		MetricsName: point.Name,
+		MetricsValue: map[string]interface{}{
+			"value": point.Value.GetValue(),
+		},
+		MetricsTimestamp: point.Timestamp,
+		MetricsTags:      point.Labels,
+	})
+}
+
+func (this *jsonEncoder) ContentType() string {
+	return "application/json"
+}
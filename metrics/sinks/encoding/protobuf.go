@@ -0,0 +1,99 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+const prometheusPrefix = "heapster_"
+
+// Matches any character not allowed in Prometheus metric and label names.
+var invalidNameCharRegexp = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// Translates a heapster metric or label name, e.g. cpu/usage_rate, to a Prometheus one.
+func prometheusName(name string) string {
+	return invalidNameCharRegexp.ReplaceAllLiteralString(name, "_")
+}
+
+// Encodes points as Prometheus metric families with a single metric, in the length-delimited
+// protobuf format of the Prometheus exposition.
+type protobufEncoder struct{}
+
+func (this *protobufEncoder) Encode(point *Point) ([]byte, error) {
+	family, err := metricFamily(point)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := expfmt.NewEncoder(buf, expfmt.FmtProtoDelim).Encode(family); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (this *protobufEncoder) ContentType() string {
+	return string(expfmt.FmtProtoDelim)
+}
+
+func metricFamily(point *Point) (*dto.MetricFamily, error) {
+	var value float64
+	switch point.Value.ValueType {
+	case core.ValueInt64:
+		value = float64(point.Value.IntValue)
+	case core.ValueFloat:
+		value = float64(point.Value.FloatValue)
+	default:
+		return nil, fmt.Errorf("unsupported value type of metric %s", point.Name)
+	}
+
+	metric := &dto.Metric{TimestampMs: proto.Int64(point.Timestamp.UnixNano() / 1e6)}
+	for name, labelValue := range point.Labels {
+		if labelValue == "" {
+			continue
+		}
+		metric.Label = append(metric.Label, &dto.LabelPair{
+			Name:  proto.String(prometheusName(name)),
+			Value: proto.String(labelValue),
+		})
+	}
+	sort.Sort(byLabelName(metric.Label))
+
+	family := &dto.MetricFamily{Name: proto.String(prometheusPrefix + prometheusName(point.Name))}
+	if point.Value.MetricType == core.MetricCumulative {
+		family.Type = dto.MetricType_COUNTER.Enum()
+		metric.Counter = &dto.Counter{Value: proto.Float64(value)}
+	} else {
+		family.Type = dto.MetricType_GAUGE.Enum()
+		metric.Gauge = &dto.Gauge{Value: proto.Float64(value)}
+	}
+	family.Metric = []*dto.Metric{metric}
+	return family, nil
+}
+
+type byLabelName []*dto.LabelPair
+
+func (a byLabelName) Len() int           { return len(a) }
+func (a byLabelName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byLabelName) Less(i, j int) bool { return a[i].GetName() < a[j].GetName() }
@@ -0,0 +1,99 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/influxdb/models"
+	dto "github.com/prometheus/client_model/go"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// Escapes label values as required by the OpenMetrics text format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Encodes points in the InfluxDB line protocol, with the schema of the InfluxDB sink: the
+// metric name as measurement, the labels as tags and a single value field.
+type influxEncoder struct{}
+
+func (this *influxEncoder) Encode(point *Point) ([]byte, error) {
+	var value interface{}
+	switch point.Value.ValueType {
+	case core.ValueInt64:
+		value = point.Value.IntValue
+	case core.ValueFloat:
+		value = float64(point.Value.FloatValue)
+	default:
+		return nil, fmt.Errorf("unsupported value type of metric %s", point.Name)
+	}
+	tags := make(map[string]string, len(point.Labels))
+	for key, tag := range point.Labels {
+		// Empty tags are not valid in the line protocol.
+		if tag != "" {
+			tags[key] = tag
+		}
+	}
+	line, err := models.NewPoint(point.Name, models.NewTags(tags), models.Fields{"value": value}, point.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(line.String()), nil
+}
+
+func (this *influxEncoder) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+// Encodes points in the OpenMetrics text format, as a complete exposition of a single sample.
+type openMetricsEncoder struct{}
+
+func (this *openMetricsEncoder) Encode(point *Point) ([]byte, error) {
+	family, err := metricFamily(point)
+	if err != nil {
+		return nil, err
+	}
+	metric := family.Metric[0]
+	buf := &bytes.Buffer{}
+	sample := family.GetName()
+	value := metric.GetGauge().GetValue()
+	if family.GetType() == dto.MetricType_COUNTER {
+		fmt.Fprintf(buf, "# TYPE %s counter\n", sample)
+		sample += "_total"
+		value = metric.GetCounter().GetValue()
+	} else {
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", sample)
+	}
+	buf.WriteString(sample)
+	if len(metric.Label) > 0 {
+		labels := make([]string, 0, len(metric.Label))
+		for _, label := range metric.Label {
+			labels = append(labels, fmt.Sprintf("%s=\"%s\"", label.GetName(), labelValueEscaper.Replace(label.GetValue())))
+		}
+		fmt.Fprintf(buf, "{%s}", strings.Join(labels, ","))
+	}
+	// OpenMetrics timestamps are in seconds.
+	fmt.Fprintf(buf, " %s %s\n# EOF\n", strconv.FormatFloat(value, 'g', -1, 64),
+		strconv.FormatFloat(float64(metric.GetTimestampMs())/1000, 'f', -1, 64))
+	return buf.Bytes(), nil
+}
+
+func (this *openMetricsEncoder) ContentType() string {
+	return "application/openmetrics-text; version=1.0.0; charset=utf-8"
+}
@@ -16,14 +16,17 @@ package sinks
 
 import (
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/golang/glog"
 	"k8s.io/heapster/common/flags"
 	"k8s.io/heapster/metrics/core"
 	"k8s.io/heapster/metrics/sinks/elasticsearch"
+	"k8s.io/heapster/metrics/sinks/file"
 	"k8s.io/heapster/metrics/sinks/gcm"
 	"k8s.io/heapster/metrics/sinks/graphite"
+	"k8s.io/heapster/metrics/sinks/grpc"
 	"k8s.io/heapster/metrics/sinks/hawkular"
 	"k8s.io/heapster/metrics/sinks/influxdb"
 	"k8s.io/heapster/metrics/sinks/kafka"
@@ -31,8 +34,11 @@ import (
 	metricsink "k8s.io/heapster/metrics/sinks/metric"
 	"k8s.io/heapster/metrics/sinks/monasca"
 	"k8s.io/heapster/metrics/sinks/opentsdb"
+	"k8s.io/heapster/metrics/sinks/parquet"
+	"k8s.io/heapster/metrics/sinks/prometheus"
 	"k8s.io/heapster/metrics/sinks/riemann"
 	"k8s.io/heapster/metrics/sinks/wavefront"
+	"k8s.io/heapster/metrics/sinks/webhook"
 )
 
 type SinkFactory struct {
@@ -42,8 +48,12 @@ func (this *SinkFactory) Build(uri flags.Uri) (core.DataSink, error) {
 	switch uri.Key {
 	case "elasticsearch":
 		return elasticsearch.NewElasticSearchSink(&uri.Val)
+	case "file":
+		return file.NewFileSink(&uri.Val)
 	case "gcm":
 		return gcm.CreateGCMSink(&uri.Val)
+	case "grpc":
+		return grpc.NewGrpcSink(&uri.Val)
 	case "graphite":
 		return graphite.NewGraphiteSink(&uri.Val)
 	case "hawkular":
@@ -60,10 +70,20 @@ func (this *SinkFactory) Build(uri flags.Uri) (core.DataSink, error) {
 			core.MetricMemoryUsage.MetricDescriptor.Name}), nil
 	case "monasca":
 		return monasca.CreateMonascaSink(&uri.Val)
+	case "openmetrics":
+		return prometheus.CreateOpenMetricsSink(&uri.Val)
 	case "opentsdb":
 		return opentsdb.CreateOpenTSDBSink(&uri.Val)
+	case "parquet":
+		return parquet.NewParquetSink(&uri.Val)
+	case "prometheus":
+		return prometheus.CreateRemoteWriteSink(&uri.Val)
+	case "prometheus-pull":
+		return prometheus.CreateExpositionSink(&uri.Val)
 	case "wavefront":
 		return wavefront.NewWavefrontSink(&uri.Val)
+	case "webhook":
+		return webhook.NewWebhookSink(&uri.Val)
 	case "riemann":
 		return riemann.CreateRiemannSink(&uri.Val)
 	default:
@@ -91,6 +111,10 @@ func (this *SinkFactory) BuildAll(uris flags.Uris, historicalUri string) (*metri
 				glog.Errorf("Sink type %q does not support being used for historical access", uri.Key)
 			}
 		}
+		if sink, err = wrap(sink, uri); err != nil {
+			glog.Errorf("Failed to create sink: %v", err)
+			continue
+		}
 		result = append(result, sink)
 	}
 
@@ -115,6 +139,29 @@ func (this *SinkFactory) BuildAll(uris flags.Uris, historicalUri string) (*metri
 	return metric, result, historical
 }
 
+// Wraps the sink with the retries, metric renaming, rate limit, blackout windows, change thresholds,
+// relabeling, filters and priority given in the options of its uri.
+func wrap(sink core.DataSink, uri flags.Uri) (core.DataSink, error) {
+	for _, wrapper := range []func(core.DataSink, *url.URL) (core.DataSink, error){
+		newRetrySink,
+		newRenameSink,
+		newRateLimitSink,
+		newScheduledSink,
+		newThresholdSink,
+		newIntervalSink,
+		newInactiveSink,
+		newRelabelSink,
+		newFilterSink,
+		newPrioritySink,
+	} {
+		var err error
+		if sink, err = wrapper(sink, &uri.Val); err != nil {
+			return nil, err
+		}
+	}
+	return sink, nil
+}
+
 func NewSinkFactory() *SinkFactory {
 	return &SinkFactory{}
 }
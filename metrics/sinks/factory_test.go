@@ -0,0 +1,57 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestWrapperOptions(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		wrapper func(core.DataSink, *url.URL) (core.DataSink, error)
+		invalid []string
+	}{
+		{"retry", newRetrySink, []string{"retries=-1", "retries=x", "retries=1&retrybackoff=0s", "retries=1&retrymaxbackoff=x",
+			"retries=1&deadlettersize=0", "retries=1&deadletterage=-1m"}},
+		{"rename", newRenameSink, []string{"renameMetric=uptime", "renameMetric=uptime:", "aliasMetric=:uptime",
+			"renameMetric=uptime:a&renameMetric=uptime:b"}},
+		{"interval", newIntervalSink, []string{"pushinterval=x", "pushinterval=0s", "pushinterval=1m&downsample=min"}},
+		{"inactive", newInactiveSink, []string{"inactivewindow=x", "inactivewindow=pod:-1m", "inactivewindow=:1m"}},
+		{"relabel", newRelabelSink, []string{"renameLabel=pod_name", "renameLabel=pod_name:", "addLabel=:prod"}},
+		{"filter", newFilterSink, nil},
+	} {
+		// The sinks without the options of the wrapper are returned as is.
+		sink := &flakySink{}
+		uri, err := url.Parse("?batchsize=10")
+		require.NoError(t, err)
+		wrapped, err := test.wrapper(sink, uri)
+		require.NoError(t, err, test.name)
+		assert.True(t, wrapped == core.DataSink(sink), test.name)
+
+		for _, query := range test.invalid {
+			uri, err := url.Parse("?" + query)
+			require.NoError(t, err)
+			_, err = test.wrapper(sink, uri)
+			assert.Error(t, err, "%s: %s", test.name, query)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/encoding"
+	"k8s.io/heapster/metrics/util"
+)
+
+const (
+	FormatCsv = "csv"
+
+	// Name of the file being written, rotated files get the time they were opened appended.
+	filePrefix = "metrics"
+	// Layout of the time in the name of the rotated files, sorting like the times.
+	rotatedTimeLayout = "20060102T150405.000000000"
+
+	defaultMaxSize = 100 * 1024 * 1024
+	defaultMaxAge  = time.Hour
+)
+
+var csvHeader = []string{"timestamp", "name", "value", "labels"}
+
+// Writes the points of the batches to a file of a local directory, one point per line, and
+// rotates the file when it is too large or too old.
+type fileSink struct {
+	sync.Mutex
+
+	dir       string
+	extension string
+	// Encoder of the points, nil for CSV.
+	encoder encoding.Encoder
+
+	maxSize  int64
+	maxAge   time.Duration
+	gzip     bool
+	maxFiles int
+
+	file   *os.File
+	writer *bufio.Writer
+	csv    *csv.Writer
+	// Bytes written to the current file and the time it was opened.
+	size   int64
+	opened time.Time
+}
+
+func (this *fileSink) Name() string {
+	return "File Sink"
+}
+
+func (this *fileSink) ExportData(batch *core.DataBatch) {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.file != nil && this.maxAge > 0 && time.Since(this.opened) >= this.maxAge {
+		this.rotate()
+	}
+	if this.file == nil {
+		if err := this.open(); err != nil {
+			glog.Errorf("Failed to open metrics file in %s: %v", this.dir, err)
+			return
+		}
+	}
+
+	for _, point := range encoding.BatchPoints(batch) {
+		if err := this.write(point); err != nil {
+			glog.Errorf("Failed to write metric %s to %s: %v", point.Name, this.file.Name(), err)
+		}
+	}
+	if this.csv != nil {
+		this.csv.Flush()
+	}
+	if err := this.writer.Flush(); err != nil {
+		glog.Errorf("Failed to write to %s: %v", this.file.Name(), err)
+	}
+	if this.size >= this.maxSize {
+		this.rotate()
+	}
+}
+
+func (this *fileSink) write(point *encoding.Point) error {
+	if this.csv != nil {
+		return this.csv.Write([]string{
+			point.Timestamp.Format(time.RFC3339Nano),
+			point.Name,
+			formatValue(point.Value),
+			util.LabelsToString(point.Labels),
+		})
+	}
+	line, err := this.encoder.Encode(point)
+	if err != nil {
+		return err
+	}
+	if _, err := this.writer.Write(line); err != nil {
+		return err
+	}
+	return this.writer.WriteByte('\n')
+}
+
+func formatValue(value core.MetricValue) string {
+	switch value.ValueType {
+	case core.ValueInt64:
+		return strconv.FormatInt(value.IntValue, 10)
+	case core.ValueFloat:
+		return strconv.FormatFloat(float64(value.FloatValue), 'g', -1, 32)
+	default:
+		return ""
+	}
+}
+
+func (this *fileSink) currentPath() string {
+	return filepath.Join(this.dir, filePrefix+this.extension)
+}
+
+// Opens a new current file, rotating the one left over by a previous run first.
+func (this *fileSink) open() error {
+	if info, err := os.Stat(this.currentPath()); err == nil {
+		this.archive(info.ModTime())
+	}
+	file, err := os.OpenFile(this.currentPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	this.file = file
+	this.size = 0
+	this.opened = time.Now()
+	this.writer = bufio.NewWriter(&countingWriter{writer: file, count: &this.size})
+	this.csv = nil
+	if this.encoder == nil {
+		this.csv = csv.NewWriter(this.writer)
+		this.csv.Write(csvHeader)
+	}
+	return nil
+}
+
+// Closes the current file and archives it.
+func (this *fileSink) rotate() {
+	this.close()
+	this.archive(this.opened)
+}
+
+func (this *fileSink) close() {
+	if this.file == nil {
+		return
+	}
+	if this.csv != nil {
+		this.csv.Flush()
+	}
+	if err := this.writer.Flush(); err != nil {
+		glog.Errorf("Failed to write to %s: %v", this.file.Name(), err)
+	}
+	if err := this.file.Close(); err != nil {
+		glog.Errorf("Failed to close %s: %v", this.file.Name(), err)
+	}
+	this.file = nil
+}
+
+// Renames the current file after the time it was opened, compresses it if needed and
+// removes the oldest archived files.
+func (this *fileSink) archive(opened time.Time) {
+	archived := filepath.Join(this.dir, fmt.Sprintf("%s-%s%s", filePrefix, opened.UTC().Format(rotatedTimeLayout), this.extension))
+	if err := os.Rename(this.currentPath(), archived); err != nil {
+		glog.Errorf("Failed to rotate %s: %v", this.currentPath(), err)
+		return
+	}
+	if this.gzip {
+		if err := compress(archived); err != nil {
+			glog.Errorf("Failed to compress %s: %v", archived, err)
+		}
+	}
+	if this.maxFiles > 0 {
+		this.removeOldFiles()
+	}
+}
+
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	compressed := gzip.NewWriter(out)
+	if _, err := io.Copy(compressed, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (this *fileSink) removeOldFiles() {
+	archived, err := filepath.Glob(filepath.Join(this.dir, filePrefix+"-*"))
+	if err != nil {
+		glog.Errorf("Failed to list the rotated files of %s: %v", this.dir, err)
+		return
+	}
+	sort.Strings(archived)
+	for len(archived) > this.maxFiles {
+		if err := os.Remove(archived[0]); err != nil {
+			glog.Errorf("Failed to remove %s: %v", archived[0], err)
+		}
+		archived = archived[1:]
+	}
+}
+
+func (this *fileSink) Stop() {
+	this.Lock()
+	defer this.Unlock()
+	this.close()
+}
+
+// Counts the bytes written to the file.
+type countingWriter struct {
+	writer io.Writer
+	count  *int64
+}
+
+func (this *countingWriter) Write(p []byte) (int, error) {
+	n, err := this.writer.Write(p)
+	*this.count += int64(n)
+	return n, err
+}
+
+func NewFileSink(uri *url.URL) (core.DataSink, error) {
+	sink := &fileSink{
+		dir:       uri.Path,
+		extension: ".jsonl",
+		maxSize:   defaultMaxSize,
+		maxAge:    defaultMaxAge,
+	}
+	if sink.dir == "" {
+		return nil, fmt.Errorf("the directory of the file sink is required, e.g. file:/var/lib/heapster/metrics")
+	}
+	opts := uri.Query()
+
+	format := encoding.FormatJson
+	if len(opts["format"]) >= 1 {
+		format = opts["format"][0]
+	}
+	switch format {
+	case FormatCsv:
+		sink.extension = ".csv"
+	case encoding.FormatJson, encoding.FormatInflux:
+		if format == encoding.FormatInflux {
+			sink.extension = ".txt"
+		}
+		encoder, err := encoding.NewEncoder(opts, format)
+		if err != nil {
+			return nil, err
+		}
+		sink.encoder = encoder
+	default:
+		return nil, fmt.Errorf("failed to parse `format` flag - unknown format %q, should be one of %s, %s or %s",
+			format, encoding.FormatJson, FormatCsv, encoding.FormatInflux)
+	}
+
+	if len(opts["maxsize"]) >= 1 {
+		maxSize, err := strconv.ParseInt(opts["maxsize"][0], 10, 64)
+		if err != nil || maxSize <= 0 {
+			return nil, fmt.Errorf("failed to parse `maxsize` flag - should be a positive number of megabytes")
+		}
+		sink.maxSize = maxSize * 1024 * 1024
+	}
+	if len(opts["maxage"]) >= 1 {
+		maxAge, err := time.ParseDuration(opts["maxage"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `maxage` flag - %v", err)
+		}
+		sink.maxAge = maxAge
+	}
+	if len(opts["gzip"]) >= 1 {
+		gzip, err := strconv.ParseBool(opts["gzip"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `gzip` flag - %v", err)
+		}
+		sink.gzip = gzip
+	}
+	if len(opts["maxfiles"]) >= 1 {
+		maxFiles, err := strconv.Atoi(opts["maxfiles"][0])
+		if err != nil || maxFiles < 0 {
+			return nil, fmt.Errorf("failed to parse `maxfiles` flag - should be a non-negative number")
+		}
+		sink.maxFiles = maxFiles
+	}
+
+	if err := os.MkdirAll(sink.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the directory of the file sink: %v", err)
+	}
+	glog.Infof("Writing metrics to %s in the %s format", sink.dir, format)
+	return sink, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/encoding"
+	"k8s.io/heapster/metrics/util"
+)
+
+func testBatch(timestamp time.Time) *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: timestamp,
+		MetricSets: map[string]*core.MetricSet{
+			core.PodKey("ns1", "pod1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePod,
+					core.LabelPodName.Key:       "pod1",
+				},
+				MetricValues: map[string]core.MetricValue{
+					"cpu/usage_rate": {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 120},
+				},
+			},
+		},
+	}
+}
+
+func newTestSink(t *testing.T, dir, query string) *fileSink {
+	uri, err := url.Parse("file:" + dir + "?" + query)
+	require.NoError(t, err)
+	sink, err := NewFileSink(uri)
+	require.NoError(t, err)
+	return sink.(*fileSink)
+}
+
+func TestJsonLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heapster-file-sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := newTestSink(t, dir, "")
+	now := time.Now()
+	sink.ExportData(testBatch(now))
+	sink.ExportData(testBatch(now.Add(time.Minute)))
+	sink.Stop()
+
+	file, err := os.Open(filepath.Join(dir, "metrics.jsonl"))
+	require.NoError(t, err)
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		point := encoding.JsonPoint{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &point))
+		assert.Equal(t, "cpu/usage_rate", point.MetricsName)
+		assert.Equal(t, "pod1", point.MetricsTags[core.LabelPodName.Key])
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestCsvRotation(t *testing.T) {
+	util.SetLabelSeperator(",")
+	dir, err := ioutil.TempDir("", "heapster-file-sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := newTestSink(t, dir, "format=csv&gzip=true&maxfiles=2")
+	// Rotate after every batch.
+	sink.maxSize = 1
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		sink.ExportData(testBatch(now.Add(time.Duration(i) * time.Minute)))
+		// Rotated files are named after the time they were opened.
+		time.Sleep(time.Millisecond)
+	}
+	sink.Stop()
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "metrics-*.csv.gz"))
+	require.NoError(t, err)
+	require.Len(t, rotated, 2)
+	_, err = os.Stat(filepath.Join(dir, "metrics.csv"))
+	assert.True(t, os.IsNotExist(err))
+
+	file, err := os.Open(rotated[1])
+	require.NoError(t, err)
+	defer file.Close()
+	compressed, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	records, err := csv.NewReader(compressed).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, now.Add(2*time.Minute).UTC().Format(time.RFC3339Nano), records[1][0])
+	assert.Equal(t, []string{"cpu/usage_rate", "120", "pod_name:pod1,type:pod"}, records[1][1:])
+}
+
+func TestAgeRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heapster-file-sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := newTestSink(t, dir, "maxage=1h")
+	sink.ExportData(testBatch(time.Now()))
+	sink.opened = sink.opened.Add(-2 * time.Hour)
+	sink.ExportData(testBatch(time.Now()))
+	sink.Stop()
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "metrics-*.jsonl"))
+	require.NoError(t, err)
+	assert.Len(t, rotated, 1)
+
+	// The file left over by a previous run is rotated when the sink starts writing.
+	sink = newTestSink(t, dir, "")
+	sink.ExportData(testBatch(time.Now()))
+	sink.Stop()
+	rotated, err = filepath.Glob(filepath.Join(dir, "metrics-*.jsonl"))
+	require.NoError(t, err)
+	assert.Len(t, rotated, 2)
+}
+
+func TestOptions(t *testing.T) {
+	for _, query := range []string{"format=protobuf", "maxsize=0", "maxage=soon", "gzip=maybe", "maxfiles=-1"} {
+		uri, err := url.Parse("file:/tmp/heapster?" + query)
+		require.NoError(t, err)
+		_, err = NewFileSink(uri)
+		assert.Error(t, err, query)
+	}
+	uri, err := url.Parse("file:?format=csv")
+	require.NoError(t, err)
+	_, err = NewFileSink(uri)
+	assert.Error(t, err)
+}
@@ -0,0 +1,170 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// Names matched by the patterns of a filter option, given as a comma separated list in which
+// `*` matches any characters, e.g. `filesystem/*,memory/usage`.
+type namePatterns []*regexp.Regexp
+
+func parseNamePatterns(values []string) (namePatterns, error) {
+	result := namePatterns{}
+	for _, value := range values {
+		for _, pattern := range strings.Split(value, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			expr := "^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$"
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+			result = append(result, re)
+		}
+	}
+	return result, nil
+}
+
+func (this namePatterns) matches(name string) bool {
+	for _, re := range this {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Names accepted by an allow list and a deny list, both optional.
+type nameFilter struct {
+	include namePatterns
+	exclude namePatterns
+}
+
+func (this *nameFilter) empty() bool {
+	return len(this.include) == 0 && len(this.exclude) == 0
+}
+
+func (this *nameFilter) accepts(name string) bool {
+	if len(this.include) > 0 && !this.include.matches(name) {
+		return false
+	}
+	return !this.exclude.matches(name)
+}
+
+// A sink wrapper passing only the metric sets of the allowed namespaces and the allowed metrics to
+// the sink, so that the sinks billed by the volume of data get only what's worth storing. The metric
+// sets which don't belong to a namespace, like the ones of the nodes and the cluster, are not
+// filtered by namespace.
+type filterSink struct {
+	core.DataSink
+	namespaces nameFilter
+	metrics    nameFilter
+}
+
+// Wraps the sink with the filters given in the options of its uri, or returns it as is if it has none.
+func newFilterSink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	this := &filterSink{DataSink: sink}
+	for _, option := range []struct {
+		name     string
+		patterns *namePatterns
+	}{
+		{"namespaces", &this.namespaces.include},
+		{"excludeNamespaces", &this.namespaces.exclude},
+		{"includeMetrics", &this.metrics.include},
+		{"excludeMetrics", &this.metrics.exclude},
+	} {
+		patterns, err := parseNamePatterns(opts[option.name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `%s` flag - %v", option.name, err)
+		}
+		*option.patterns = patterns
+	}
+	if this.namespaces.empty() && this.metrics.empty() {
+		return sink, nil
+	}
+	if _, ok := sink.(core.HttpSink); ok {
+		return nil, fmt.Errorf("filters are not supported by sink %s", sink.Name())
+	}
+	return this, nil
+}
+
+func (this *filterSink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *filterSink) exportData(data *core.DataBatch) error {
+	result := &core.DataBatch{
+		Timestamp:    data.Timestamp,
+		MetricSets:   make(map[string]*core.MetricSet, len(data.MetricSets)),
+		Completeness: data.Completeness,
+		OutOfBand:    data.OutOfBand,
+	}
+	for key, ms := range data.MetricSets {
+		if namespace, found := ms.Labels[core.LabelNamespaceName.Key]; found && !this.namespaces.accepts(namespace) {
+			continue
+		}
+		if this.metrics.empty() {
+			result.MetricSets[key] = ms
+			continue
+		}
+		msCopy := *ms
+		msCopy.MetricValues = this.filterValues(ms.MetricValues)
+		msCopy.LabeledMetrics = make([]core.LabeledMetric, 0, len(ms.LabeledMetrics))
+		for _, metric := range ms.LabeledMetrics {
+			if this.metrics.accepts(metric.Name) {
+				msCopy.LabeledMetrics = append(msCopy.LabeledMetrics, metric)
+			}
+		}
+		if len(ms.RawSamples) > 0 {
+			msCopy.RawSamples = make([]core.RawSample, 0, len(ms.RawSamples))
+			for _, sample := range ms.RawSamples {
+				msCopy.RawSamples = append(msCopy.RawSamples, core.RawSample{
+					Timestamp:    sample.Timestamp,
+					MetricValues: this.filterValues(sample.MetricValues),
+				})
+			}
+		}
+		result.MetricSets[key] = &msCopy
+	}
+	return tryExportData(this.DataSink, result)
+}
+
+func (this *filterSink) filterValues(values map[string]core.MetricValue) map[string]core.MetricValue {
+	result := make(map[string]core.MetricValue, len(values))
+	for name, value := range values {
+		if this.metrics.accepts(name) {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+func (this *filterSink) AcceptsRawSamples() bool {
+	return acceptsRawSamples(this.DataSink)
+}
+
+func (this *filterSink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
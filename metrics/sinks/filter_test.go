@@ -0,0 +1,145 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestNamePatterns(t *testing.T) {
+	patterns, err := parseNamePatterns([]string{"filesystem/*, memory/usage", "custom/*"})
+	require.NoError(t, err)
+	assert.True(t, patterns.matches("filesystem/usage"))
+	assert.True(t, patterns.matches("memory/usage"))
+	assert.True(t, patterns.matches("custom/app/requests"))
+	assert.False(t, patterns.matches("memory/usage_rate"))
+	assert.False(t, patterns.matches("cpu/usage"))
+
+	patterns, err = parseNamePatterns([]string{"kube-*"})
+	require.NoError(t, err)
+	assert.True(t, patterns.matches("kube-system"))
+	assert.False(t, patterns.matches("default"))
+}
+
+func filterTestBatch() *core.DataBatch {
+	values := func() map[string]core.MetricValue {
+		return map[string]core.MetricValue{
+			"cpu/usage":        {ValueType: core.ValueInt64, IntValue: 1},
+			"memory/usage":     {ValueType: core.ValueInt64, IntValue: 2},
+			"filesystem/limit": {ValueType: core.ValueInt64, IntValue: 3},
+		}
+	}
+	labeled := []core.LabeledMetric{
+		{Name: "filesystem/usage", Labels: map[string]string{core.LabelResourceID.Key: "/dev/sda1"}},
+	}
+	return &core.DataBatch{
+		Timestamp: time.Unix(1475323200, 0),
+		MetricSets: map[string]*core.MetricSet{
+			core.NodeKey("n1"): {
+				Labels:         map[string]string{core.LabelMetricSetType.Key: core.MetricSetTypeNode},
+				MetricValues:   values(),
+				LabeledMetrics: labeled,
+			},
+			core.PodKey("prod", "p1"): {
+				Labels:       map[string]string{core.LabelNamespaceName.Key: "prod"},
+				MetricValues: values(),
+				RawSamples:   []core.RawSample{{MetricValues: values()}},
+			},
+			core.PodKey("staging", "p2"): {
+				Labels:       map[string]string{core.LabelNamespaceName.Key: "staging"},
+				MetricValues: values(),
+			},
+			core.PodKey("dev", "p3"): {
+				Labels:       map[string]string{core.LabelNamespaceName.Key: "dev"},
+				MetricValues: values(),
+			},
+		},
+	}
+}
+
+func newTestFilterSink(t *testing.T, query string) (*recordingSink, core.DataSink) {
+	sink := &recordingSink{}
+	uri, err := url.Parse("?" + query)
+	require.NoError(t, err)
+	wrapped, err := newFilterSink(sink, uri)
+	require.NoError(t, err)
+	return sink, wrapped
+}
+
+func metricNames(ms *core.MetricSet) []string {
+	names := []string{}
+	for name := range ms.MetricValues {
+		names = append(names, name)
+	}
+	for _, metric := range ms.LabeledMetrics {
+		names = append(names, metric.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFilterSinkNamespaces(t *testing.T) {
+	sink, wrapped := newTestFilterSink(t, "namespaces=prod,staging")
+	data := filterTestBatch()
+	wrapped.ExportData(data)
+
+	require.Len(t, sink.batches, 1)
+	sets := sink.batches[0].MetricSets
+	assert.Len(t, sets, 3)
+	assert.Contains(t, sets, core.NodeKey("n1"))
+	assert.Contains(t, sets, core.PodKey("prod", "p1"))
+	assert.Contains(t, sets, core.PodKey("staging", "p2"))
+	// Without metric filters the metric sets are passed as is.
+	assert.True(t, sets[core.PodKey("prod", "p1")] == data.MetricSets[core.PodKey("prod", "p1")])
+
+	sink, wrapped = newTestFilterSink(t, "excludeNamespaces=dev,stag*")
+	wrapped.ExportData(filterTestBatch())
+	sets = sink.batches[0].MetricSets
+	assert.Len(t, sets, 2)
+	assert.Contains(t, sets, core.NodeKey("n1"))
+	assert.Contains(t, sets, core.PodKey("prod", "p1"))
+}
+
+func TestFilterSinkMetrics(t *testing.T) {
+	sink, wrapped := newTestFilterSink(t, "excludeMetrics=filesystem/*")
+	data := filterTestBatch()
+	wrapped.ExportData(data)
+
+	sets := sink.batches[0].MetricSets
+	assert.Len(t, sets, 4)
+	assert.Equal(t, []string{"cpu/usage", "memory/usage"}, metricNames(sets[core.NodeKey("n1")]))
+	prod := sets[core.PodKey("prod", "p1")]
+	require.Len(t, prod.RawSamples, 1)
+	assert.Len(t, prod.RawSamples[0].MetricValues, 2)
+	assert.NotContains(t, prod.RawSamples[0].MetricValues, "filesystem/limit")
+	// The batch of the other sinks is left untouched.
+	assert.Len(t, data.MetricSets[core.NodeKey("n1")].MetricValues, 3)
+	assert.Len(t, data.MetricSets[core.NodeKey("n1")].LabeledMetrics, 1)
+
+	sink, wrapped = newTestFilterSink(t, "includeMetrics=filesystem/*,cpu/usage&excludeMetrics=filesystem/limit&namespaces=prod")
+	wrapped.ExportData(filterTestBatch())
+	sets = sink.batches[0].MetricSets
+	assert.Len(t, sets, 2)
+	assert.Equal(t, []string{"cpu/usage", "filesystem/usage"}, metricNames(sets[core.NodeKey("n1")]))
+	assert.Equal(t, []string{"cpu/usage"}, metricNames(sets[core.PodKey("prod", "p1")]))
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/golang/glog"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	gcm "google.golang.org/api/monitoring/v3"
 )
 
@@ -47,8 +48,9 @@ const (
 
 type gcmSink struct {
 	sync.RWMutex
-	registered   bool
-	project      string
+	// Projects where the metrics are registered.
+	registered   map[string]bool
+	router       *projectRouter
 	metricFilter MetricFilter
 	gcmService   *gcm.Service
 }
@@ -90,6 +92,13 @@ func createTimeSeries(timestamp time.Time, labels map[string]string, metric stri
 		point.Value.DoubleValue = v
 		point.Value.ForceSendFields = []string{"DoubleValue"}
 		valueType = "DOUBLE"
+	case core.ValueHistogram:
+		if val.HistogramValue == nil {
+			glog.Errorf("Missing histogram value in %v", metric)
+			return nil
+		}
+		point.Value.DistributionValue = createDistribution(val.HistogramValue)
+		valueType = "DISTRIBUTION"
 	default:
 		glog.Errorf("Type not supported %v in %v", val.ValueType, metric)
 		return nil
@@ -163,46 +172,60 @@ func fullProjectName(name string) string {
 	return fmt.Sprintf("projects/%s", name)
 }
 
-func (sink *gcmSink) sendRequest(req *gcm.CreateTimeSeriesRequest) {
-	_, err := sink.gcmService.Projects.TimeSeries.Create(fullProjectName(sink.project), req).Do()
+func (sink *gcmSink) sendRequest(project string, req *gcm.CreateTimeSeriesRequest) {
+	_, err := sink.gcmService.Projects.TimeSeries.Create(fullProjectName(project), req).Do()
 	if err != nil {
-		glog.Errorf("Error while sending request to GCM %v", err)
+		glog.Errorf("Error while sending request to GCM project %s %v", project, err)
 	} else {
-		glog.V(4).Infof("Successfully sent %v timeserieses to GCM", len(req.TimeSeries))
+		glog.V(4).Infof("Successfully sent %v timeserieses to GCM project %s", len(req.TimeSeries), project)
 	}
 }
 
 func (sink *gcmSink) ExportData(dataBatch *core.DataBatch) {
-	if err := sink.registerAllMetrics(); err != nil {
-		glog.Warningf("Error during metrics registration: %v", err)
-		return
+	if err := sink.router.reload(); err != nil {
+		glog.Warningf("Failed to reload the GCM project routes, keeping the previous ones: %v", err)
+	}
+
+	// Requests per project, the metric sets of projects where the registration fails are skipped.
+	reqs := make(map[string]*gcm.CreateTimeSeriesRequest)
+	failed := make(map[string]bool)
+	add := func(project string, point *gcm.TimeSeries) {
+		if point == nil {
+			return
+		}
+		req, found := reqs[project]
+		if !found {
+			req = getReq()
+			reqs[project] = req
+		}
+		req.TimeSeries = append(req.TimeSeries, point)
+		if len(req.TimeSeries) >= maxTimeseriesPerRequest {
+			sink.sendRequest(project, req)
+			reqs[project] = getReq()
+		}
 	}
 
-	req := getReq()
 	for _, metricSet := range dataBatch.MetricSets {
+		project := sink.router.project(metricSet.Labels)
+		if failed[project] {
+			continue
+		}
+		if err := sink.registerAllMetrics(project); err != nil {
+			glog.Warningf("Error during metrics registration in project %s: %v", project, err)
+			failed[project] = true
+			continue
+		}
 		for metric, val := range metricSet.MetricValues {
-			point := sink.getTimeSeries(dataBatch.Timestamp, metricSet.Labels, metric, val, metricSet.CreateTime)
-			if point != nil {
-				req.TimeSeries = append(req.TimeSeries, point)
-			}
-			if len(req.TimeSeries) >= maxTimeseriesPerRequest {
-				sink.sendRequest(req)
-				req = getReq()
-			}
+			add(project, sink.getTimeSeries(dataBatch.Timestamp, metricSet.Labels, metric, val, metricSet.CreateTime))
 		}
 		for _, metric := range metricSet.LabeledMetrics {
-			point := sink.getTimeSeriesForLabeledMetrics(dataBatch.Timestamp, metricSet.Labels, metric, metricSet.CreateTime)
-			if point != nil {
-				req.TimeSeries = append(req.TimeSeries, point)
-			}
-			if len(req.TimeSeries) >= maxTimeseriesPerRequest {
-				sink.sendRequest(req)
-				req = getReq()
-			}
+			add(project, sink.getTimeSeriesForLabeledMetrics(dataBatch.Timestamp, metricSet.Labels, metric, metricSet.CreateTime))
 		}
 	}
-	if len(req.TimeSeries) > 0 {
-		sink.sendRequest(req)
+	for project, req := range reqs {
+		if len(req.TimeSeries) > 0 {
+			sink.sendRequest(project, req)
+		}
 	}
 }
 
@@ -210,20 +233,20 @@ func (sink *gcmSink) Stop() {
 	// nothing needs to be done.
 }
 
-func (sink *gcmSink) registerAllMetrics() error {
-	return sink.register(core.AllMetrics)
+func (sink *gcmSink) registerAllMetrics(project string) error {
+	return sink.register(project, core.AllMetrics)
 }
 
-// Adds the specified metrics or updates them if they already exist.
-func (sink *gcmSink) register(metrics []core.Metric) error {
+// Adds the specified metrics to the project or updates them if they already exist.
+func (sink *gcmSink) register(project string, metrics []core.Metric) error {
 	sink.Lock()
 	defer sink.Unlock()
-	if sink.registered {
+	if sink.registered[project] {
 		return nil
 	}
 
 	for _, metric := range metrics {
-		metricName := fullMetricName(sink.project, metric.MetricDescriptor.Name)
+		metricName := fullMetricName(project, metric.MetricDescriptor.Name)
 		metricType := fullMetricType(metric.MetricDescriptor.Name)
 
 		if _, err := sink.gcmService.Projects.MetricDescriptors.Delete(metricName).Do(); err != nil {
@@ -277,6 +300,8 @@ func (sink *gcmSink) register(metrics []core.Metric) error {
 			valueType = "INT64"
 		case core.ValueFloat:
 			valueType = "DOUBLE"
+		case core.ValueHistogram:
+			valueType = "DISTRIBUTION"
 		}
 
 		desc := &gcm.MetricDescriptor{
@@ -288,15 +313,36 @@ func (sink *gcmSink) register(metrics []core.Metric) error {
 			Type:        metricType,
 		}
 
-		if _, err := sink.gcmService.Projects.MetricDescriptors.Create(fullProjectName(sink.project), desc).Do(); err != nil {
+		if _, err := sink.gcmService.Projects.MetricDescriptors.Create(fullProjectName(project), desc).Do(); err != nil {
 			glog.Errorf("Metric registration of %v failed: %v", desc.Name, err)
 			return err
 		}
 	}
-	sink.registered = true
+	sink.registered[project] = true
 	return nil
 }
 
+func createDistribution(histogram *core.Histogram) *gcm.Distribution {
+	counts := make(googleapi.Int64s, len(histogram.Counts))
+	for i, count := range histogram.Counts {
+		counts[i] = int64(count)
+	}
+	return &gcm.Distribution{
+		BucketCounts: counts,
+		BucketOptions: &gcm.BucketOptions{
+			ExplicitBuckets: &gcm.Explicit{Bounds: histogram.Bounds},
+		},
+		Count:           int64(histogram.Count),
+		Mean:            histogram.Mean(),
+		ForceSendFields: []string{"Count"},
+	}
+}
+
+// GCM stores histograms as distributions.
+func (sink *gcmSink) AcceptsHistograms() bool {
+	return true
+}
+
 func CreateGCMSink(uri *url.URL) (core.DataSink, error) {
 	if len(uri.Scheme) > 0 {
 		return nil, fmt.Errorf("scheme should not be set for GCM sink")
@@ -331,6 +377,15 @@ func CreateGCMSink(uri *url.URL) (core.DataSink, error) {
 		return nil, err
 	}
 
+	routingFile := ""
+	if len(opts["projectRouting"]) > 0 {
+		routingFile = opts["projectRouting"][0]
+	}
+	router, err := newProjectRouter(routingFile, projectId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse `projectRouting` flag - %v", err)
+	}
+
 	// Create Google Cloud Monitoring service.
 	client := oauth2.NewClient(oauth2.NoContext, google.ComputeTokenSource(""))
 	gcmService, err := gcm.New(client)
@@ -339,13 +394,13 @@ func CreateGCMSink(uri *url.URL) (core.DataSink, error) {
 	}
 
 	sink := &gcmSink{
-		registered:   false,
-		project:      projectId,
+		registered:   make(map[string]bool),
+		router:       router,
 		gcmService:   gcmService,
 		metricFilter: metricFilter,
 	}
 	glog.Infof("created GCM sink")
-	if err := sink.registerAllMetrics(); err != nil {
+	if err := sink.registerAllMetrics(router.project(map[string]string{})); err != nil {
 		glog.Warningf("Error during metrics registration: %v", err)
 	}
 	return sink, nil
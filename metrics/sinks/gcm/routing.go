@@ -0,0 +1,106 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// Content of the routing file, mapping namespaces to the projects their metrics are written to.
+type projectRoutes struct {
+	// Project of the metrics of the other namespaces and of the nodes and the cluster.
+	Default    string            `json:"default"`
+	Namespaces map[string]string `json:"namespaces"`
+}
+
+// projectRouter picks the project of each metric set from a routing file, reloaded when it
+// changes. Without a routing file all the metrics go to the project of the cluster.
+type projectRouter struct {
+	path           string
+	clusterProject string
+	modTime        time.Time
+	routes         projectRoutes
+}
+
+// Returns the project the metrics of the metric set are written to.
+func (this *projectRouter) project(labels map[string]string) string {
+	if namespace, found := labels[core.LabelNamespaceName.Key]; found {
+		if project, found := this.routes.Namespaces[namespace]; found {
+			return project
+		}
+	}
+	if this.routes.Default != "" {
+		return this.routes.Default
+	}
+	return this.clusterProject
+}
+
+// Reads the routes again if the file was modified since they were last read.
+func (this *projectRouter) reload() error {
+	if this.path == "" {
+		return nil
+	}
+	info, err := os.Stat(this.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(this.modTime) {
+		return nil
+	}
+	routes, err := readProjectRoutes(this.path)
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("Loaded the routes of %d namespaces from %s", len(routes.Namespaces), this.path)
+	this.routes = routes
+	this.modTime = info.ModTime()
+	return nil
+}
+
+func readProjectRoutes(path string) (projectRoutes, error) {
+	routes := projectRoutes{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return routes, err
+	}
+	if err := yaml.Unmarshal(data, &routes); err != nil {
+		return routes, err
+	}
+	for namespace, project := range routes.Namespaces {
+		if project == "" {
+			return routes, fmt.Errorf("no project for namespace %s", namespace)
+		}
+	}
+	return routes, nil
+}
+
+func newProjectRouter(path, clusterProject string) (*projectRouter, error) {
+	router := &projectRouter{
+		path:           path,
+		clusterProject: clusterProject,
+	}
+	if err := router.reload(); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcm
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestProjectRouter(t *testing.T) {
+	namespace := func(name string) map[string]string {
+		return map[string]string{core.LabelNamespaceName.Key: name}
+	}
+	node := map[string]string{core.LabelMetricSetType.Key: core.MetricSetTypeNode}
+
+	// Without a routing file everything goes to the project of the cluster.
+	router, err := newProjectRouter("", "cluster-project")
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-project", router.project(namespace("team-a")))
+	assert.Equal(t, "cluster-project", router.project(node))
+
+	file, err := ioutil.TempFile("", "routing")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	require.NoError(t, ioutil.WriteFile(file.Name(), []byte("namespaces:\n  team-a: project-a\n  team-b: project-b\n"), 0644))
+
+	router, err = newProjectRouter(file.Name(), "cluster-project")
+	require.NoError(t, err)
+	assert.Equal(t, "project-a", router.project(namespace("team-a")))
+	assert.Equal(t, "project-b", router.project(namespace("team-b")))
+	assert.Equal(t, "cluster-project", router.project(namespace("kube-system")))
+	assert.Equal(t, "cluster-project", router.project(node))
+
+	// A modified file is reloaded, an invalid one keeps the previous routes.
+	require.NoError(t, ioutil.WriteFile(file.Name(), []byte("namespaces:\n  team-a: \"\"\n"), 0644))
+	require.NoError(t, os.Chtimes(file.Name(), time.Now(), time.Now().Add(time.Minute)))
+	assert.Error(t, router.reload())
+	assert.Equal(t, "project-a", router.project(namespace("team-a")))
+
+	require.NoError(t, ioutil.WriteFile(file.Name(), []byte("default: shared-project\nnamespaces:\n  team-a: project-c\n"), 0644))
+	require.NoError(t, os.Chtimes(file.Name(), time.Now(), time.Now().Add(2*time.Minute)))
+	require.NoError(t, router.reload())
+	assert.Equal(t, "project-c", router.project(namespace("team-a")))
+	assert.Equal(t, "shared-project", router.project(namespace("team-b")))
+	assert.Equal(t, "shared-project", router.project(node))
+
+	_, err = newProjectRouter(file.Name()+"-missing", "cluster-project")
+	assert.Error(t, err)
+}
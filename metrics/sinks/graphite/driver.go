@@ -98,6 +98,35 @@ func (m *graphiteMetric) Path() string {
 			)
 		case core.MetricSetTypeCluster:
 			return fmt.Sprintf("cluster.%s", metricPath)
+		case core.MetricSetTypeQOS:
+			return fmt.Sprintf("qos.%s.%s",
+				escapeField(m.labels[core.LabelQOSClass.Key]),
+				metricPath,
+			)
+		case core.MetricSetTypeCronJob:
+			return fmt.Sprintf("cronjobs.%s.%s.%s",
+				m.labels[core.LabelNamespaceName.Key],
+				escapeField(m.labels[core.LabelCronJobName.Key]),
+				metricPath,
+			)
+		case core.MetricSetTypeDeployment:
+			return fmt.Sprintf("deployments.%s.%s.%s",
+				m.labels[core.LabelNamespaceName.Key],
+				escapeField(m.labels[core.LabelDeploymentName.Key]),
+				metricPath,
+			)
+		case core.MetricSetTypeDaemonSet:
+			return fmt.Sprintf("daemonsets.%s.%s.%s",
+				m.labels[core.LabelNamespaceName.Key],
+				escapeField(m.labels[core.LabelDaemonSetName.Key]),
+				metricPath,
+			)
+		case core.MetricSetTypeJob:
+			return fmt.Sprintf("jobs.%s.%s.%s",
+				m.labels[core.LabelNamespaceName.Key],
+				escapeField(m.labels[core.LabelJobName.Key]),
+				metricPath,
+			)
 		default:
 			glog.V(6).Infof("Unknown metric type %s", t)
 		}
@@ -110,6 +110,70 @@ var metricsTestCases = []struct {
 		"cluster.metric.avg",
 		"100",
 	},
+	{
+		graphiteMetric{
+			name:  "metric/avg",
+			value: core.MetricValue{IntValue: 100, ValueType: core.ValueInt64},
+			labels: map[string]string{
+				"type":      "qos",
+				"qos_class": "BestEffort",
+			},
+		},
+		"qos.BestEffort.metric.avg",
+		"100",
+	},
+	{
+		graphiteMetric{
+			name:  "job/run_duration",
+			value: core.MetricValue{IntValue: 100, ValueType: core.ValueInt64},
+			labels: map[string]string{
+				"type":           "cronjob",
+				"namespace_name": "default",
+				"cronjob_name":   "backup.daily",
+			},
+		},
+		"cronjobs.default.backup_daily.job.run_duration",
+		"100",
+	},
+	{
+		graphiteMetric{
+			name:  "deployment/replicas/desired",
+			value: core.MetricValue{IntValue: 100, ValueType: core.ValueInt64},
+			labels: map[string]string{
+				"type":            "deployment",
+				"namespace_name":  "default",
+				"deployment_name": "web.1",
+			},
+		},
+		"deployments.default.web_1.deployment.replicas.desired",
+		"100",
+	},
+	{
+		graphiteMetric{
+			name:  "daemonset/scheduled/desired",
+			value: core.MetricValue{IntValue: 100, ValueType: core.ValueInt64},
+			labels: map[string]string{
+				"type":           "daemonset",
+				"namespace_name": "default",
+				"daemonset_name": "web.1",
+			},
+		},
+		"daemonsets.default.web_1.daemonset.scheduled.desired",
+		"100",
+	},
+	{
+		graphiteMetric{
+			name:  "job/succeeded",
+			value: core.MetricValue{IntValue: 100, ValueType: core.ValueInt64},
+			labels: map[string]string{
+				"type":           "job",
+				"namespace_name": "default",
+				"job_name":       "web.1",
+			},
+		},
+		"jobs.default.web_1.job.succeeded",
+		"100",
+	},
 }
 
 func TestGraphitePathMetrics(t *testing.T) {
@@ -0,0 +1,247 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	grpcapi "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"k8s.io/heapster/metrics/core"
+)
+
+//go:generate protoc --go_out=plugins=grpc:. heapster.proto
+
+const (
+	dialTimeout = 10 * time.Second
+	// How long the receiver has to answer when a stream is closed.
+	closeTimeout = 10 * time.Second
+)
+
+// Streams the batches to a receiver implementing the MetricBatchReceiver service of
+// heapster.proto, over a single long-lived client stream.
+type grpcSink struct {
+	sync.Mutex
+
+	address string
+	conn    *grpcapi.ClientConn
+	client  MetricBatchReceiverClient
+	// The open stream and the function canceling it, nil until the first batch or after a failure.
+	stream MetricBatchReceiver_StreamClient
+	cancel context.CancelFunc
+	// Gets the answer of the receiver once it ended the stream.
+	done chan streamResult
+}
+
+type streamResult struct {
+	summary *StreamSummary
+	err     error
+}
+
+func (this *grpcSink) Name() string {
+	return "gRPC Sink"
+}
+
+func (this *grpcSink) ExportData(batch *core.DataBatch) {
+	this.Lock()
+	defer this.Unlock()
+
+	message := toMetricBatch(batch)
+	for attempt := 0; attempt < 2; attempt++ {
+		if this.stream != nil {
+			select {
+			case result := <-this.done:
+				glog.Warningf("The stream to %s was ended by the receiver: %v", this.address, result.err)
+				this.release()
+			default:
+			}
+		}
+		if this.stream == nil {
+			if err := this.openStream(); err != nil {
+				glog.Errorf("Failed to open a stream to %s: %v", this.address, err)
+				return
+			}
+		}
+		err := this.stream.Send(message)
+		if err == nil {
+			return
+		}
+		glog.Warningf("Failed to send a batch to %s: %v", this.address, err)
+		this.release()
+	}
+	glog.Errorf("Dropping a batch of %d metric sets that couldn't be sent to %s", len(message.MetricSets), this.address)
+}
+
+func (this *grpcSink) openStream() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := this.client.Stream(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	done := make(chan streamResult, 1)
+	// The receiver only answers when the stream is closed, or earlier when it fails.
+	go func() {
+		summary := &StreamSummary{}
+		err := stream.RecvMsg(summary)
+		done <- streamResult{summary: summary, err: err}
+	}()
+	this.stream = stream
+	this.cancel = cancel
+	this.done = done
+	return nil
+}
+
+// Closes the stream, waiting for the summary of the receiver.
+func (this *grpcSink) closeStream() {
+	if this.stream == nil {
+		return
+	}
+	if err := this.stream.CloseSend(); err == nil {
+		select {
+		case result := <-this.done:
+			if result.err == nil {
+				glog.V(2).Infof("Closed the stream to %s after %d batches", this.address, result.summary.Batches)
+			}
+		case <-time.After(closeTimeout):
+		}
+	}
+	this.release()
+}
+
+func (this *grpcSink) release() {
+	this.cancel()
+	this.stream = nil
+	this.cancel = nil
+	this.done = nil
+}
+
+func (this *grpcSink) Stop() {
+	this.Lock()
+	defer this.Unlock()
+	this.closeStream()
+	this.conn.Close()
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func toMetric(name string, labels map[string]string, value core.MetricValue) *Metric {
+	metric := &Metric{
+		Name:       name,
+		Labels:     labels,
+		IntValue:   value.IntValue,
+		FloatValue: float64(value.FloatValue),
+	}
+	if value.MetricType == core.MetricCumulative {
+		metric.Type = MetricType_CUMULATIVE
+	}
+	if value.ValueType == core.ValueFloat {
+		metric.ValueType = ValueType_FLOAT
+	}
+	return metric
+}
+
+func toMetricBatch(batch *core.DataBatch) *MetricBatch {
+	keys := make([]string, 0, len(batch.MetricSets))
+	for key := range batch.MetricSets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	message := &MetricBatch{
+		Timestamp:  millis(batch.Timestamp),
+		MetricSets: make([]*MetricSet, 0, len(keys)),
+	}
+	for _, key := range keys {
+		metricSet := batch.MetricSets[key]
+		set := &MetricSet{
+			Key:        key,
+			Labels:     metricSet.Labels,
+			CreateTime: millis(metricSet.CreateTime),
+			ScrapeTime: millis(metricSet.ScrapeTime),
+		}
+		names := make([]string, 0, len(metricSet.MetricValues))
+		for name := range metricSet.MetricValues {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			set.Metrics = append(set.Metrics, toMetric(name, nil, metricSet.MetricValues[name]))
+		}
+		for _, labeled := range metricSet.LabeledMetrics {
+			set.Metrics = append(set.Metrics, toMetric(labeled.Name, labeled.Labels, labeled.MetricValue))
+		}
+		message.MetricSets = append(message.MetricSets, set)
+	}
+	return message
+}
+
+func NewGrpcSink(uri *url.URL) (core.DataSink, error) {
+	if uri.Host == "" {
+		return nil, fmt.Errorf("the address of the receiver is required, e.g. grpc://receiver:9000")
+	}
+	opts := uri.Query()
+
+	dialOptions := []grpcapi.DialOption{grpcapi.WithTimeout(dialTimeout)}
+	useTLS := false
+	if len(opts["tls"]) >= 1 {
+		var err error
+		if useTLS, err = strconv.ParseBool(opts["tls"][0]); err != nil {
+			return nil, fmt.Errorf("failed to parse `tls` flag - %v", err)
+		}
+	}
+	if useTLS {
+		config := &tls.Config{}
+		if len(opts["cacert"]) >= 1 {
+			pem, err := ioutil.ReadFile(opts["cacert"][0])
+			if err != nil {
+				return nil, fmt.Errorf("failed to read `cacert` file - %v", err)
+			}
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("failed to parse `cacert` file - no certificate found")
+			}
+		}
+		if len(opts["servername"]) >= 1 {
+			config.ServerName = opts["servername"][0]
+		}
+		dialOptions = append(dialOptions, grpcapi.WithTransportCredentials(credentials.NewTLS(config)))
+	} else {
+		dialOptions = append(dialOptions, grpcapi.WithInsecure())
+	}
+
+	conn, err := grpcapi.Dial(uri.Host, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", uri.Host, err)
+	}
+	glog.Infof("Streaming metrics to %s", uri.Host)
+	return &grpcSink{
+		address: uri.Host,
+		conn:    conn,
+		client:  NewMetricBatchReceiverClient(conn),
+	}, nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpcapi "google.golang.org/grpc"
+	"k8s.io/heapster/metrics/core"
+)
+
+type fakeReceiver struct {
+	sync.Mutex
+	batches []*MetricBatch
+	// Number of batches after which the streams fail, 0 to never fail.
+	failAfter int
+	streams   int
+	closed    chan int64
+}
+
+func (this *fakeReceiver) Stream(stream MetricBatchReceiver_StreamServer) error {
+	this.Lock()
+	this.streams++
+	this.Unlock()
+	var received int64
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			this.closed <- received
+			return stream.SendAndClose(&StreamSummary{Batches: received})
+		}
+		if err != nil {
+			return err
+		}
+		received++
+		this.Lock()
+		this.batches = append(this.batches, batch)
+		this.Unlock()
+		if this.failAfter > 0 && int(received) >= this.failAfter {
+			return fmt.Errorf("receiver failure")
+		}
+	}
+}
+
+func (this *fakeReceiver) received() []*MetricBatch {
+	this.Lock()
+	defer this.Unlock()
+	return append([]*MetricBatch{}, this.batches...)
+}
+
+func startReceiver(t *testing.T, receiver *fakeReceiver) (*grpcapi.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpcapi.NewServer()
+	RegisterMetricBatchReceiverServer(server, receiver)
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+func testBatch(timestamp time.Time) *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: timestamp,
+		MetricSets: map[string]*core.MetricSet{
+			core.NodeKey("node1"): {
+				CreateTime: timestamp.Add(-time.Hour),
+				ScrapeTime: timestamp,
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypeNode,
+					core.LabelNodename.Key:      "node1",
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricCpuUsage.Name: {
+						ValueType:  core.ValueInt64,
+						MetricType: core.MetricCumulative,
+						IntValue:   1000,
+					},
+					core.MetricCpuUsageRate.Name: {
+						ValueType:  core.ValueFloat,
+						MetricType: core.MetricGauge,
+						FloatValue: 1.5,
+					},
+				},
+				LabeledMetrics: []core.LabeledMetric{
+					{
+						Name:   core.MetricFilesystemUsage.Name,
+						Labels: map[string]string{core.LabelResourceID.Key: "/dev/sda1"},
+						MetricValue: core.MetricValue{
+							ValueType:  core.ValueInt64,
+							MetricType: core.MetricGauge,
+							IntValue:   2048,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newTestSink(t *testing.T, address string) *grpcSink {
+	uri, err := url.Parse("//" + address)
+	require.NoError(t, err)
+	sink, err := NewGrpcSink(uri)
+	require.NoError(t, err)
+	return sink.(*grpcSink)
+}
+
+func TestStreamBatches(t *testing.T) {
+	receiver := &fakeReceiver{closed: make(chan int64, 10)}
+	server, address := startReceiver(t, receiver)
+	defer server.Stop()
+	sink := newTestSink(t, address)
+
+	timestamp := time.Unix(1475366400, 0)
+	sink.ExportData(testBatch(timestamp))
+	sink.ExportData(testBatch(timestamp.Add(time.Minute)))
+	sink.Stop()
+
+	select {
+	case received := <-receiver.closed:
+		assert.Equal(t, int64(2), received)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream wasn't closed")
+	}
+	batches := receiver.received()
+	require.Len(t, batches, 2)
+	assert.Equal(t, int64(1475366460000), batches[1].Timestamp)
+	require.Len(t, batches[0].MetricSets, 1)
+	set := batches[0].MetricSets[0]
+	assert.Equal(t, core.NodeKey("node1"), set.Key)
+	assert.Equal(t, "node1", set.Labels[core.LabelNodename.Key])
+	assert.Equal(t, int64(1475362800000), set.CreateTime)
+	require.Len(t, set.Metrics, 3)
+	assert.Equal(t, &Metric{Name: core.MetricCpuUsage.Name, Type: MetricType_CUMULATIVE, IntValue: 1000}, set.Metrics[0])
+	assert.Equal(t, &Metric{Name: core.MetricCpuUsageRate.Name, ValueType: ValueType_FLOAT, FloatValue: 1.5}, set.Metrics[1])
+	assert.Equal(t, core.MetricFilesystemUsage.Name, set.Metrics[2].Name)
+	assert.Equal(t, "/dev/sda1", set.Metrics[2].Labels[core.LabelResourceID.Key])
+	assert.Equal(t, int64(2048), set.Metrics[2].IntValue)
+}
+
+func TestReopenBrokenStream(t *testing.T) {
+	receiver := &fakeReceiver{failAfter: 1, closed: make(chan int64, 10)}
+	server, address := startReceiver(t, receiver)
+	defer server.Stop()
+	sink := newTestSink(t, address)
+	defer sink.Stop()
+
+	timestamp := time.Unix(1475366400, 0)
+	sink.ExportData(testBatch(timestamp))
+	// Sending to the broken stream fails once its status is received.
+	for i := 1; i < 10 && len(receiver.received()) < 2; i++ {
+		time.Sleep(100 * time.Millisecond)
+		sink.ExportData(testBatch(timestamp.Add(time.Duration(i) * time.Minute)))
+	}
+	assert.True(t, len(receiver.received()) >= 2)
+	receiver.Lock()
+	assert.True(t, receiver.streams >= 2)
+	receiver.Unlock()
+}
+
+func TestRegisteredDescriptor(t *testing.T) {
+	assert.Equal(t, reflect.TypeOf(&MetricBatch{}), proto.MessageType("heapster.v1.MetricBatch"))
+	assert.Equal(t, MetricType_value, proto.EnumValueMap("heapster.v1.MetricType"))
+	descriptor, _ := (&MetricBatch{}).Descriptor()
+	assert.Equal(t, proto.FileDescriptor("heapster.proto"), descriptor)
+	reader, err := gzip.NewReader(bytes.NewReader(descriptor))
+	require.NoError(t, err)
+	file, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(file), "MetricBatchReceiver")
+}
+
+func TestNewGrpcSinkErrors(t *testing.T) {
+	for _, location := range []string{
+		"",
+		"//receiver:9000?tls=maybe",
+		"//receiver:9000?tls=true&cacert=/nonexistent",
+	} {
+		uri, err := url.Parse(location)
+		require.NoError(t, err)
+		_, err = NewGrpcSink(uri)
+		assert.Error(t, err, location)
+	}
+}
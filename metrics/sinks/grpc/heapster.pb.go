@@ -0,0 +1,317 @@
+// Code generated by protoc-gen-go.
+// source: heapster.proto
+// DO NOT EDIT!
+
+/*
+Package grpc is a generated protocol buffer package.
+
+It is generated from these files:
+
+	heapster.proto
+
+It has these top-level messages:
+
+	MetricBatch
+	MetricSet
+	Metric
+	StreamSummary
+*/
+package grpc
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc1 "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type MetricType int32
+
+const (
+	MetricType_GAUGE      MetricType = 0
+	MetricType_CUMULATIVE MetricType = 1
+)
+
+var MetricType_name = map[int32]string{
+	0: "GAUGE",
+	1: "CUMULATIVE",
+}
+var MetricType_value = map[string]int32{
+	"GAUGE":      0,
+	"CUMULATIVE": 1,
+}
+
+func (x MetricType) String() string {
+	return proto.EnumName(MetricType_name, int32(x))
+}
+func (MetricType) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+type ValueType int32
+
+const (
+	ValueType_INT64 ValueType = 0
+	ValueType_FLOAT ValueType = 1
+)
+
+var ValueType_name = map[int32]string{
+	0: "INT64",
+	1: "FLOAT",
+}
+var ValueType_value = map[string]int32{
+	"INT64": 0,
+	"FLOAT": 1,
+}
+
+func (x ValueType) String() string {
+	return proto.EnumName(ValueType_name, int32(x))
+}
+func (ValueType) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+type MetricBatch struct {
+	// Time of the batch in milliseconds since the epoch.
+	Timestamp  int64        `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	MetricSets []*MetricSet `protobuf:"bytes,2,rep,name=metric_sets,json=metricSets" json:"metric_sets,omitempty"`
+}
+
+func (m *MetricBatch) Reset()                    { *m = MetricBatch{} }
+func (m *MetricBatch) String() string            { return proto.CompactTextString(m) }
+func (*MetricBatch) ProtoMessage()               {}
+func (*MetricBatch) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *MetricBatch) GetMetricSets() []*MetricSet {
+	if m != nil {
+		return m.MetricSets
+	}
+	return nil
+}
+
+type MetricSet struct {
+	// Unique key of the metric set in the batch, e.g. namespace:kube-system/pod:kube-dns-v20-xxxxx.
+	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// Labels of the metric set, see docs/storage-schema.md.
+	Labels map[string]string `protobuf:"bytes,2,rep,name=labels" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// Creation and scrape times in milliseconds since the epoch.
+	CreateTime int64     `protobuf:"varint,3,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"`
+	ScrapeTime int64     `protobuf:"varint,4,opt,name=scrape_time,json=scrapeTime,proto3" json:"scrape_time,omitempty"`
+	Metrics    []*Metric `protobuf:"bytes,5,rep,name=metrics" json:"metrics,omitempty"`
+}
+
+func (m *MetricSet) Reset()                    { *m = MetricSet{} }
+func (m *MetricSet) String() string            { return proto.CompactTextString(m) }
+func (*MetricSet) ProtoMessage()               {}
+func (*MetricSet) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *MetricSet) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *MetricSet) GetMetrics() []*Metric {
+	if m != nil {
+		return m.Metrics
+	}
+	return nil
+}
+
+type Metric struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Labels of the metric in addition to the ones of the metric set, e.g. resource_id.
+	Labels    map[string]string `protobuf:"bytes,2,rep,name=labels" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Type      MetricType        `protobuf:"varint,3,opt,name=type,proto3,enum=heapster.v1.MetricType" json:"type,omitempty"`
+	ValueType ValueType         `protobuf:"varint,4,opt,name=value_type,json=valueType,proto3,enum=heapster.v1.ValueType" json:"value_type,omitempty"`
+	// Set according to the value type.
+	IntValue   int64   `protobuf:"varint,5,opt,name=int_value,json=intValue,proto3" json:"int_value,omitempty"`
+	FloatValue float64 `protobuf:"fixed64,6,opt,name=float_value,json=floatValue,proto3" json:"float_value,omitempty"`
+}
+
+func (m *Metric) Reset()                    { *m = Metric{} }
+func (m *Metric) String() string            { return proto.CompactTextString(m) }
+func (*Metric) ProtoMessage()               {}
+func (*Metric) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Metric) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+type StreamSummary struct {
+	// Number of batches the receiver got on the stream.
+	Batches int64 `protobuf:"varint,1,opt,name=batches,proto3" json:"batches,omitempty"`
+}
+
+func (m *StreamSummary) Reset()                    { *m = StreamSummary{} }
+func (m *StreamSummary) String() string            { return proto.CompactTextString(m) }
+func (*StreamSummary) ProtoMessage()               {}
+func (*StreamSummary) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func init() {
+	proto.RegisterType((*MetricBatch)(nil), "heapster.v1.MetricBatch")
+	proto.RegisterType((*MetricSet)(nil), "heapster.v1.MetricSet")
+	proto.RegisterType((*Metric)(nil), "heapster.v1.Metric")
+	proto.RegisterType((*StreamSummary)(nil), "heapster.v1.StreamSummary")
+	proto.RegisterEnum("heapster.v1.MetricType", MetricType_name, MetricType_value)
+	proto.RegisterEnum("heapster.v1.ValueType", ValueType_name, ValueType_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc1.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc1.SupportPackageIsVersion3
+
+// Client API for MetricBatchReceiver service
+
+type MetricBatchReceiverClient interface {
+	// Heapster opens a stream and sends a batch every metric resolution, until it stops or the
+	// stream breaks, in which case it opens a new stream.
+	Stream(ctx context.Context, opts ...grpc1.CallOption) (MetricBatchReceiver_StreamClient, error)
+}
+
+type metricBatchReceiverClient struct {
+	cc *grpc1.ClientConn
+}
+
+func NewMetricBatchReceiverClient(cc *grpc1.ClientConn) MetricBatchReceiverClient {
+	return &metricBatchReceiverClient{cc}
+}
+
+func (c *metricBatchReceiverClient) Stream(ctx context.Context, opts ...grpc1.CallOption) (MetricBatchReceiver_StreamClient, error) {
+	stream, err := grpc1.NewClientStream(ctx, &_MetricBatchReceiver_serviceDesc.Streams[0], c.cc, "/heapster.v1.MetricBatchReceiver/Stream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricBatchReceiverStreamClient{stream}
+	return x, nil
+}
+
+type MetricBatchReceiver_StreamClient interface {
+	Send(*MetricBatch) error
+	CloseAndRecv() (*StreamSummary, error)
+	grpc1.ClientStream
+}
+
+type metricBatchReceiverStreamClient struct {
+	grpc1.ClientStream
+}
+
+func (x *metricBatchReceiverStreamClient) Send(m *MetricBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *metricBatchReceiverStreamClient) CloseAndRecv() (*StreamSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StreamSummary)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for MetricBatchReceiver service
+
+type MetricBatchReceiverServer interface {
+	// Heapster opens a stream and sends a batch every metric resolution, until it stops or the
+	// stream breaks, in which case it opens a new stream.
+	Stream(MetricBatchReceiver_StreamServer) error
+}
+
+func RegisterMetricBatchReceiverServer(s *grpc1.Server, srv MetricBatchReceiverServer) {
+	s.RegisterService(&_MetricBatchReceiver_serviceDesc, srv)
+}
+
+func _MetricBatchReceiver_Stream_Handler(srv interface{}, stream grpc1.ServerStream) error {
+	return srv.(MetricBatchReceiverServer).Stream(&metricBatchReceiverStreamServer{stream})
+}
+
+type MetricBatchReceiver_StreamServer interface {
+	SendAndClose(*StreamSummary) error
+	Recv() (*MetricBatch, error)
+	grpc1.ServerStream
+}
+
+type metricBatchReceiverStreamServer struct {
+	grpc1.ServerStream
+}
+
+func (x *metricBatchReceiverStreamServer) SendAndClose(m *StreamSummary) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *metricBatchReceiverStreamServer) Recv() (*MetricBatch, error) {
+	m := new(MetricBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _MetricBatchReceiver_serviceDesc = grpc1.ServiceDesc{
+	ServiceName: "heapster.v1.MetricBatchReceiver",
+	HandlerType: (*MetricBatchReceiverServer)(nil),
+	Methods:     []grpc1.MethodDesc{},
+	Streams: []grpc1.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _MetricBatchReceiver_Stream_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: fileDescriptor0,
+}
+
+func init() { proto.RegisterFile("heapster.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 465 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x93, 0xcd, 0x6e, 0xd3, 0x40,
+	0x10, 0xc7, 0x6b, 0xc7, 0x71, 0xf1, 0x58, 0x44, 0xd6, 0x16, 0x81, 0x15, 0x90, 0x1a, 0x72, 0x21,
+	0x14, 0x11, 0x89, 0xf0, 0x51, 0xe8, 0x89, 0x14, 0x85, 0xaa, 0x52, 0x0a, 0x92, 0xe3, 0x14, 0x89,
+	0x4b, 0xb4, 0x31, 0x03, 0xb5, 0xc8, 0x26, 0xd6, 0x7a, 0x1b, 0xc9, 0x0f, 0xc0, 0x0b, 0xf1, 0x84,
+	0x68, 0x67, 0xed, 0x7c, 0x20, 0xdf, 0x7a, 0x9b, 0x9d, 0xf9, 0xcd, 0xf8, 0x3f, 0x7f, 0xef, 0x42,
+	0xeb, 0x06, 0x79, 0x96, 0x2b, 0x94, 0xfd, 0x4c, 0xae, 0xd4, 0x8a, 0xf9, 0x9b, 0xf3, 0xfa, 0x55,
+	0xf7, 0x07, 0xf8, 0x57, 0xa8, 0x64, 0x9a, 0x9c, 0x73, 0x95, 0xdc, 0xb0, 0x27, 0xe0, 0xa9, 0x54,
+	0x60, 0xae, 0xb8, 0xc8, 0x42, 0xab, 0x63, 0xf5, 0x1a, 0xd1, 0x36, 0xc1, 0x4e, 0xc1, 0x17, 0x04,
+	0xcf, 0x72, 0x54, 0x79, 0x68, 0x77, 0x1a, 0x3d, 0x7f, 0xf0, 0xb0, 0xbf, 0x33, 0xaf, 0x6f, 0x86,
+	0x4d, 0x50, 0x45, 0x20, 0xaa, 0x30, 0xef, 0xfe, 0xb1, 0xc1, 0xdb, 0x54, 0x58, 0x00, 0x8d, 0xdf,
+	0x58, 0xd0, 0x78, 0x2f, 0xd2, 0x21, 0x3b, 0x03, 0x77, 0xc1, 0xe7, 0xb8, 0xa8, 0x66, 0x76, 0xeb,
+	0x67, 0xf6, 0xc7, 0x04, 0x8d, 0x96, 0x4a, 0x16, 0x51, 0xd9, 0xc1, 0x8e, 0xc1, 0x4f, 0x24, 0x72,
+	0x85, 0x33, 0x2d, 0x34, 0x6c, 0x90, 0x68, 0x30, 0xa9, 0x38, 0x15, 0xa8, 0x81, 0x3c, 0x91, 0x3c,
+	0x2b, 0x01, 0xc7, 0x00, 0x26, 0x45, 0xc0, 0x4b, 0x38, 0x34, 0x5a, 0xf3, 0xb0, 0x49, 0x9f, 0x3f,
+	0xaa, 0xf9, 0x7c, 0x54, 0x31, 0xed, 0x0f, 0xe0, 0xef, 0xe8, 0xa8, 0xd9, 0xe6, 0x01, 0x34, 0xd7,
+	0x7c, 0x71, 0x8b, 0xa1, 0x4d, 0x39, 0x73, 0x38, 0xb3, 0xdf, 0x5b, 0xdd, 0xbf, 0x36, 0xb8, 0x66,
+	0x1c, 0x63, 0xe0, 0x2c, 0xb9, 0xc0, 0xb2, 0x8f, 0x62, 0x76, 0xfa, 0x9f, 0x0d, 0xc7, 0x35, 0x3a,
+	0x6a, 0x3d, 0x78, 0x01, 0x8e, 0x2a, 0x32, 0xb3, 0x7c, 0x6b, 0xf0, 0xa8, 0xa6, 0x2d, 0x2e, 0x32,
+	0x8c, 0x08, 0x62, 0x6f, 0x01, 0x48, 0xd1, 0x8c, 0x5a, 0x1c, 0x6a, 0xd9, 0xff, 0x89, 0xd7, 0xba,
+	0x4c, 0x1d, 0xde, 0xba, 0x0a, 0xd9, 0x63, 0xf0, 0xd2, 0xa5, 0x9a, 0x99, 0xcd, 0x9a, 0x64, 0xe2,
+	0xbd, 0x74, 0xa9, 0x88, 0xd5, 0x1e, 0xff, 0x5c, 0xac, 0x78, 0x55, 0x76, 0x3b, 0x56, 0xcf, 0x8a,
+	0x80, 0x52, 0x04, 0xdc, 0xc5, 0xb4, 0xe7, 0x70, 0x7f, 0xa2, 0x24, 0x72, 0x31, 0xb9, 0x15, 0x82,
+	0xcb, 0x82, 0x85, 0x70, 0x38, 0xd7, 0xb7, 0x15, 0xf3, 0xf2, 0x8a, 0x56, 0xc7, 0x93, 0x67, 0x00,
+	0xdb, 0x75, 0x99, 0x07, 0xcd, 0x8b, 0xe1, 0xf4, 0x62, 0x14, 0x1c, 0xb0, 0x16, 0xc0, 0xa7, 0xe9,
+	0xd5, 0x74, 0x3c, 0x8c, 0x2f, 0xaf, 0x47, 0x81, 0x75, 0xf2, 0x14, 0xbc, 0xcd, 0x92, 0x9a, 0xbb,
+	0xfc, 0x12, 0xbf, 0x7b, 0x13, 0x1c, 0xe8, 0xf0, 0xf3, 0xf8, 0xeb, 0x30, 0x0e, 0xac, 0xc1, 0x37,
+	0x38, 0xda, 0x79, 0x19, 0x11, 0x26, 0x98, 0xae, 0x51, 0xb2, 0x8f, 0xe0, 0x1a, 0x35, 0x2c, 0xac,
+	0xb1, 0x99, 0xd8, 0x76, 0x7b, 0xaf, 0xb2, 0x27, 0xbe, 0x67, 0x9d, 0xbb, 0xdf, 0x9d, 0x5f, 0x32,
+	0x4b, 0xe6, 0x2e, 0x3d, 0xc7, 0xd7, 0xff, 0x06, 0x00, 0x06, 0xe7, 0x22, 0xa5, 0xa0, 0x03, 0x00,
+	0x00,
+}
@@ -122,6 +122,25 @@ func (h *hawkularSink) idName(ms *core.MetricSet, metricName string) string {
 	case core.MetricSetTypePodContainer:
 		n = append(n, ms.Labels[core.LabelContainerName.Key])
 		n = append(n, ms.Labels[core.LabelPodId.Key])
+	case core.MetricSetTypeQOS:
+		n = append(n, core.MetricSetTypeQOS)
+		n = append(n, ms.Labels[core.LabelQOSClass.Key])
+	case core.MetricSetTypeCronJob:
+		n = append(n, core.MetricSetTypeCronJob)
+		n = append(n, ms.Labels[core.LabelNamespaceName.Key])
+		n = append(n, ms.Labels[core.LabelCronJobName.Key])
+	case core.MetricSetTypeDeployment:
+		n = append(n, core.MetricSetTypeDeployment)
+		n = append(n, ms.Labels[core.LabelNamespaceName.Key])
+		n = append(n, ms.Labels[core.LabelDeploymentName.Key])
+	case core.MetricSetTypeDaemonSet:
+		n = append(n, core.MetricSetTypeDaemonSet)
+		n = append(n, ms.Labels[core.LabelNamespaceName.Key])
+		n = append(n, ms.Labels[core.LabelDaemonSetName.Key])
+	case core.MetricSetTypeJob:
+		n = append(n, core.MetricSetTypeJob)
+		n = append(n, ms.Labels[core.LabelNamespaceName.Key])
+		n = append(n, ms.Labels[core.LabelJobName.Key])
 	default:
 		n = append(n, ms.Labels[core.LabelContainerName.Key])
 		if ms.Labels[core.LabelPodId.Key] != "" {
@@ -219,6 +219,41 @@ func TestMetricIds(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, fmt.Sprintf("%s/%s/%s", core.MetricSetTypeNamespace, metricSet.Labels[core.LabelNamespaceName.Key], metricName), m.Id)
 
+	//
+	metricSet.Labels[core.LabelMetricSetType.Key] = core.MetricSetTypeQOS
+	metricSet.Labels[core.LabelQOSClass.Key] = "Burstable"
+	m, err = hSink.pointToLabeledMetricHeader(&metricSet, metricSet.LabeledMetrics[0], now)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s/%s/%s", core.MetricSetTypeQOS, "Burstable", metricName), m.Id)
+
+	//
+	metricSet.Labels[core.LabelMetricSetType.Key] = core.MetricSetTypeCronJob
+	metricSet.Labels[core.LabelCronJobName.Key] = "backup"
+	m, err = hSink.pointToLabeledMetricHeader(&metricSet, metricSet.LabeledMetrics[0], now)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s/%s/%s/%s", core.MetricSetTypeCronJob, metricSet.Labels[core.LabelNamespaceName.Key], "backup", metricName), m.Id)
+
+	//
+	metricSet.Labels[core.LabelMetricSetType.Key] = core.MetricSetTypeDeployment
+	metricSet.Labels[core.LabelDeploymentName.Key] = "web"
+	m, err = hSink.pointToLabeledMetricHeader(&metricSet, metricSet.LabeledMetrics[0], now)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s/%s/%s/%s", core.MetricSetTypeDeployment, metricSet.Labels[core.LabelNamespaceName.Key], "web", metricName), m.Id)
+
+	//
+	metricSet.Labels[core.LabelMetricSetType.Key] = core.MetricSetTypeDaemonSet
+	metricSet.Labels[core.LabelDaemonSetName.Key] = "web"
+	m, err = hSink.pointToLabeledMetricHeader(&metricSet, metricSet.LabeledMetrics[0], now)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s/%s/%s/%s", core.MetricSetTypeDaemonSet, metricSet.Labels[core.LabelNamespaceName.Key], "web", metricName), m.Id)
+
+	//
+	metricSet.Labels[core.LabelMetricSetType.Key] = core.MetricSetTypeJob
+	metricSet.Labels[core.LabelJobName.Key] = "web"
+	m, err = hSink.pointToLabeledMetricHeader(&metricSet, metricSet.LabeledMetrics[0], now)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s/%s/%s/%s", core.MetricSetTypeJob, metricSet.Labels[core.LabelNamespaceName.Key], "web", metricName), m.Id)
+
 }
 
 func TestRecentTest(t *testing.T) {
@@ -0,0 +1,182 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+var inactiveConfig struct {
+	sync.RWMutex
+	podLister *cache.StoreToPodLister
+}
+
+// ConfigureInactivePods sets the pod lister with which the inactive windows tell the terminated
+// pods from the ones only missing from a batch, e.g. after a failed scrape. Without it no metric
+// set is exported after it disappeared.
+func ConfigureInactivePods(podLister *cache.StoreToPodLister) {
+	inactiveConfig.Lock()
+	defer inactiveConfig.Unlock()
+	inactiveConfig.podLister = podLister
+}
+
+// Tells whether the pod of the metric set terminated or was deleted. The sets which don't
+// belong to a pod never terminate.
+func podTerminated(ms *core.MetricSet) bool {
+	inactiveConfig.RLock()
+	podLister := inactiveConfig.podLister
+	inactiveConfig.RUnlock()
+	namespace, podName := ms.Labels[core.LabelNamespaceName.Key], ms.Labels[core.LabelPodName.Key]
+	if podLister == nil || namespace == "" || podName == "" {
+		return false
+	}
+	pod, err := podLister.Pods(namespace).Get(podName)
+	if err != nil {
+		// Deleted.
+		return true
+	}
+	return pod.DeletionTimestamp != nil || pod.Status.Phase == kube_api.PodSucceeded || pod.Status.Phase == kube_api.PodFailed
+}
+
+// A metric set which was last in a batch at the given time.
+type inactiveSet struct {
+	ms       *core.MetricSet
+	lastSeen time.Time
+}
+
+// A sink wrapper exporting the metric sets of the terminated pods and their containers for a
+// window after their last batch, with their gauges set to zero. This closes the series in the
+// backends interpolating the missing points. The sets missing from a batch while their pod runs
+// are not exported, as they only missed a scrape. The windows are given by type of metric set,
+// and the sets without a window stop being exported at once.
+type inactiveSink struct {
+	core.DataSink
+	// Windows by type of metric set, the empty type applying to the types without their own.
+	windows map[string]time.Duration
+	// Metric sets by key, for the types with a window.
+	sets map[string]*inactiveSet
+}
+
+// Wraps the sink with the windows given in the options of its uri, or returns it as is if it has none.
+func newInactiveSink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	if len(opts["inactivewindow"]) == 0 {
+		return sink, nil
+	}
+	if _, ok := sink.(core.HttpSink); ok {
+		return nil, fmt.Errorf("inactive windows are not supported by sink %s", sink.Name())
+	}
+	this := &inactiveSink{
+		DataSink: sink,
+		windows:  make(map[string]time.Duration),
+		sets:     make(map[string]*inactiveSet),
+	}
+	for _, value := range opts["inactivewindow"] {
+		setType, text := "", value
+		if i := strings.LastIndex(value, ":"); i >= 0 {
+			setType, text = value[:i], value[i+1:]
+		}
+		window, err := time.ParseDuration(text)
+		if err != nil || window < 0 || (setType == "" && text != value) {
+			return nil, fmt.Errorf("failed to parse `inactivewindow` flag - %q should be [<type>:]<duration>", value)
+		}
+		this.windows[setType] = window
+	}
+	return this, nil
+}
+
+func (this *inactiveSink) window(ms *core.MetricSet) time.Duration {
+	if window, found := this.windows[ms.Labels[core.LabelMetricSetType.Key]]; found {
+		return window
+	}
+	return this.windows[""]
+}
+
+func (this *inactiveSink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *inactiveSink) exportData(data *core.DataBatch) error {
+	// Out of band batches only cover a few nodes, the other sets didn't disappear.
+	if data.OutOfBand {
+		return tryExportData(this.DataSink, data)
+	}
+	result := &core.DataBatch{
+		Timestamp:    data.Timestamp,
+		MetricSets:   make(map[string]*core.MetricSet, len(data.MetricSets)),
+		Completeness: data.Completeness,
+	}
+	for key, ms := range data.MetricSets {
+		result.MetricSets[key] = ms
+		if this.window(ms) > 0 {
+			this.sets[key] = &inactiveSet{ms: ms, lastSeen: data.Timestamp}
+		}
+	}
+	for key, set := range this.sets {
+		if _, found := data.MetricSets[key]; found {
+			continue
+		}
+		if data.Timestamp.Sub(set.lastSeen) > this.window(set.ms) {
+			delete(this.sets, key)
+			continue
+		}
+		if !podTerminated(set.ms) {
+			continue
+		}
+		result.MetricSets[key] = zeroGauges(set.ms, data.Timestamp)
+	}
+	return tryExportData(this.DataSink, result)
+}
+
+// Returns a copy of the metric set scraped at the given time, with its gauges set to zero. The
+// cumulative metrics keep their last value, as a zero would be taken for a reset.
+func zeroGauges(ms *core.MetricSet, timestamp time.Time) *core.MetricSet {
+	zero := func(value core.MetricValue) core.MetricValue {
+		if _, ok := gaugeValue(value); ok {
+			value.IntValue = 0
+			value.FloatValue = 0
+		}
+		return value
+	}
+	msCopy := *ms
+	msCopy.ScrapeTime = timestamp
+	msCopy.RawSamples = nil
+	msCopy.MetricValues = make(map[string]core.MetricValue, len(ms.MetricValues))
+	for name, value := range ms.MetricValues {
+		msCopy.MetricValues[name] = zero(value)
+	}
+	msCopy.LabeledMetrics = make([]core.LabeledMetric, 0, len(ms.LabeledMetrics))
+	for _, metric := range ms.LabeledMetrics {
+		metric.MetricValue = zero(metric.MetricValue)
+		msCopy.LabeledMetrics = append(msCopy.LabeledMetrics, metric)
+	}
+	return &msCopy
+}
+
+func (this *inactiveSink) AcceptsRawSamples() bool {
+	return acceptsRawSamples(this.DataSink)
+}
+
+func (this *inactiveSink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+func TestInactiveSink(t *testing.T) {
+	podLister := &cache.StoreToPodLister{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})}
+	ConfigureInactivePods(podLister)
+	defer ConfigureInactivePods(nil)
+	sink := &recordingSink{}
+	uri, err := url.Parse("?inactivewindow=2m&inactivewindow=pod_container:0s")
+	require.NoError(t, err)
+	wrapped, err := newInactiveSink(sink, uri)
+	require.NoError(t, err)
+
+	metricSet := func(setType, podName string) *core.MetricSet {
+		labels := map[string]string{core.LabelMetricSetType.Key: setType}
+		if podName != "" {
+			labels[core.LabelNamespaceName.Key] = "ns1"
+			labels[core.LabelPodName.Key] = podName
+		}
+		return &core.MetricSet{
+			Labels: labels,
+			MetricValues: map[string]core.MetricValue{
+				core.MetricCpuUsage.Name:    {MetricType: core.MetricCumulative, ValueType: core.ValueInt64, IntValue: 100},
+				core.MetricMemoryUsage.Name: {MetricType: core.MetricGauge, ValueType: core.ValueInt64, IntValue: 7},
+			},
+		}
+	}
+	pod := func(name string, phase kube_api.PodPhase) *kube_api.Pod {
+		return &kube_api.Pod{
+			ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: name},
+			Status:     kube_api.PodStatus{Phase: phase},
+		}
+	}
+	// p1 terminates, p2 runs on but its node fails to be scraped, p3 is deleted.
+	podLister.Indexer.Add(pod("p1", kube_api.PodSucceeded))
+	podLister.Indexer.Add(pod("p2", kube_api.PodRunning))
+	base := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+	wrapped.ExportData(&core.DataBatch{
+		Timestamp: base,
+		MetricSets: map[string]*core.MetricSet{
+			"node:n1":                           metricSet(core.MetricSetTypeNode, ""),
+			"node:n2":                           metricSet(core.MetricSetTypeNode, ""),
+			"namespace:ns1/pod:p1":              metricSet(core.MetricSetTypePod, "p1"),
+			"namespace:ns1/pod:p1/container:c1": metricSet(core.MetricSetTypePodContainer, "p1"),
+			"namespace:ns1/pod:p2":              metricSet(core.MetricSetTypePod, "p2"),
+			"namespace:ns1/pod:p3":              metricSet(core.MetricSetTypePod, "p3"),
+		},
+	})
+	for minute := 1; minute <= 3; minute++ {
+		wrapped.ExportData(&core.DataBatch{
+			Timestamp:  base.Add(time.Duration(minute) * time.Minute),
+			MetricSets: map[string]*core.MetricSet{"node:n1": metricSet(core.MetricSetTypeNode, "")},
+		})
+	}
+
+	require.Len(t, sink.batches, 4)
+	assert.Len(t, sink.batches[0].MetricSets, 6)
+	for _, batch := range sink.batches[1:3] {
+		require.Len(t, batch.MetricSets, 3)
+		for _, key := range []string{"namespace:ns1/pod:p1", "namespace:ns1/pod:p3"} {
+			pod := batch.MetricSets[key]
+			require.NotNil(t, pod)
+			assert.Equal(t, batch.Timestamp, pod.ScrapeTime)
+			assert.Equal(t, int64(0), pod.MetricValues[core.MetricMemoryUsage.Name].IntValue)
+			assert.Equal(t, int64(100), pod.MetricValues[core.MetricCpuUsage.Name].IntValue)
+		}
+	}
+	assert.Len(t, sink.batches[3].MetricSets, 1)
+}
+
+func TestInactiveSinkWithoutPods(t *testing.T) {
+	sink := &recordingSink{}
+	uri, err := url.Parse("?inactivewindow=2m")
+	require.NoError(t, err)
+	wrapped, err := newInactiveSink(sink, uri)
+	require.NoError(t, err)
+
+	base := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+	wrapped.ExportData(&core.DataBatch{
+		Timestamp: base,
+		MetricSets: map[string]*core.MetricSet{
+			"namespace:ns1/pod:p1": {Labels: map[string]string{
+				core.LabelMetricSetType.Key: core.MetricSetTypePod,
+				core.LabelNamespaceName.Key: "ns1",
+				core.LabelPodName.Key:       "p1",
+			}},
+		},
+	})
+	// Whether the pod terminated is unknown, so it's not exported.
+	wrapped.ExportData(&core.DataBatch{Timestamp: base.Add(time.Minute), MetricSets: map[string]*core.MetricSet{}})
+	require.Len(t, sink.batches, 2)
+	assert.Empty(t, sink.batches[1].MetricSets)
+}
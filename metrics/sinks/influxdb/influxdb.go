@@ -23,6 +23,7 @@ import (
 
 	influxdb_common "k8s.io/heapster/common/influxdb"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/batching"
 
 	"github.com/golang/glog"
 	influxdb "github.com/influxdata/influxdb/client"
@@ -31,8 +32,9 @@ import (
 type influxdbSink struct {
 	client influxdb_common.InfluxdbClient
 	sync.RWMutex
-	c        influxdb_common.InfluxdbConfig
-	dbExists bool
+	c         influxdb_common.InfluxdbConfig
+	dbExists  bool
+	batchSize *batching.BatchSize
 }
 
 const (
@@ -41,8 +43,10 @@ const (
 	// Event special tags
 	dbNotFoundError = "database not found"
 
-	// Maximum number of influxdb Points to be sent in one batch.
-	maxSendBatchSize = 10000
+	// Default number of influxdb Points to be sent in one batch.
+	defaultBatchSize = 10000
+
+	defaultRetentionPolicy = "default"
 )
 
 func (sink *influxdbSink) resetConnection() {
@@ -52,46 +56,55 @@ func (sink *influxdbSink) resetConnection() {
 }
 
 func (sink *influxdbSink) ExportData(dataBatch *core.DataBatch) {
+	sink.TryExportData(dataBatch)
+}
+
+// Points written again overwrite the ones with the same series and timestamp.
+func (sink *influxdbSink) TryExportData(dataBatch *core.DataBatch) error {
 	sink.Lock()
 	defer sink.Unlock()
 
+	var exportErr error
+	batchSize := sink.batchSize.Size()
 	dataPoints := make([]influxdb.Point, 0, 0)
 	for _, metricSet := range dataBatch.MetricSets {
-		for metricName, metricValue := range metricSet.MetricValues {
-
-			var value interface{}
-			if core.ValueInt64 == metricValue.ValueType {
-				value = metricValue.IntValue
-			} else if core.ValueFloat == metricValue.ValueType {
-				value = float64(metricValue.FloatValue)
-			} else {
-				continue
-			}
-
-			// Prepare measurement without fields
-			fieldName := "value"
-			measurementName := metricName
-			if sink.c.WithFields {
-				// Prepare measurement and field names
-				serieName := strings.SplitN(metricName, "/", 2)
-				measurementName = serieName[0]
-				if len(serieName) > 1 {
-					fieldName = serieName[1]
+		// Metrics present in the raw samples are written with the timestamps of the samples.
+		rawMetrics := make(map[string]bool)
+		if sink.c.RawSamples {
+			for _, sample := range metricSet.RawSamples {
+				for metricName, metricValue := range sample.MetricValues {
+					rawMetrics[metricName] = true
+					point, ok := sink.metricPoint(metricName, metricValue, metricSet.Labels, sample.Timestamp)
+					if !ok {
+						continue
+					}
+					dataPoints = append(dataPoints, point)
+					if len(dataPoints) >= batchSize {
+						if err := sink.sendData(dataPoints); err != nil {
+							exportErr = err
+						}
+						dataPoints = make([]influxdb.Point, 0, 0)
+						batchSize = sink.batchSize.Size()
+					}
 				}
 			}
+		}
 
-			point := influxdb.Point{
-				Measurement: measurementName,
-				Tags:        metricSet.Labels,
-				Fields: map[string]interface{}{
-					fieldName: value,
-				},
-				Time: dataBatch.Timestamp.UTC(),
+		for metricName, metricValue := range metricSet.MetricValues {
+			if rawMetrics[metricName] {
+				continue
+			}
+			point, ok := sink.metricPoint(metricName, metricValue, metricSet.Labels, dataBatch.Timestamp)
+			if !ok {
+				continue
 			}
 			dataPoints = append(dataPoints, point)
-			if len(dataPoints) >= maxSendBatchSize {
-				sink.sendData(dataPoints)
+			if len(dataPoints) >= batchSize {
+				if err := sink.sendData(dataPoints); err != nil {
+					exportErr = err
+				}
 				dataPoints = make([]influxdb.Point, 0, 0)
+				batchSize = sink.batchSize.Size()
 			}
 		}
 
@@ -106,18 +119,7 @@ func (sink *influxdbSink) ExportData(dataBatch *core.DataBatch) {
 				continue
 			}
 
-			// Prepare measurement without fields
-			fieldName := "value"
-			measurementName := labeledMetric.Name
-			if sink.c.WithFields {
-				// Prepare measurement and field names
-				serieName := strings.SplitN(labeledMetric.Name, "/", 2)
-				measurementName = serieName[0]
-				if len(serieName) > 1 {
-					fieldName = serieName[1]
-				}
-			}
-
+			measurementName, fieldName := sink.metricToSeriesAndField(labeledMetric.Name)
 			point := influxdb.Point{
 				Measurement: measurementName,
 				Tags:        make(map[string]string),
@@ -134,30 +136,93 @@ func (sink *influxdbSink) ExportData(dataBatch *core.DataBatch) {
 			}
 
 			dataPoints = append(dataPoints, point)
-			if len(dataPoints) >= maxSendBatchSize {
-				sink.sendData(dataPoints)
+			if len(dataPoints) >= batchSize {
+				if err := sink.sendData(dataPoints); err != nil {
+					exportErr = err
+				}
 				dataPoints = make([]influxdb.Point, 0, 0)
+				batchSize = sink.batchSize.Size()
 			}
 		}
 	}
 	if len(dataPoints) >= 0 {
-		sink.sendData(dataPoints)
+		if err := sink.sendData(dataPoints); err != nil {
+			exportErr = err
+		}
+	}
+	return exportErr
+}
+
+func (sink *influxdbSink) metricPoint(metricName string, metricValue core.MetricValue, labels map[string]string, timestamp time.Time) (influxdb.Point, bool) {
+	var value interface{}
+	if core.ValueInt64 == metricValue.ValueType {
+		value = metricValue.IntValue
+	} else if core.ValueFloat == metricValue.ValueType {
+		value = float64(metricValue.FloatValue)
+	} else {
+		return influxdb.Point{}, false
 	}
+
+	measurementName, fieldName := sink.metricToSeriesAndField(metricName)
+	return influxdb.Point{
+		Measurement: measurementName,
+		Tags:        labels,
+		Fields: map[string]interface{}{
+			fieldName: value,
+		},
+		Time: timestamp.UTC(),
+	}, true
+}
+
+// retentionPolicy returns the retention policy of the measurement, the one of its metric family
+// if the family has one.
+func (sink *influxdbSink) retentionPolicy(measurement string) string {
+	family := strings.SplitN(measurement, "/", 2)[0]
+	for routedFamily, routedMeasurement := range sink.c.FamilyMeasurements {
+		if routedMeasurement == measurement {
+			family = routedFamily
+			break
+		}
+	}
+	if _, found := sink.c.FamilyRetentionPolicies[family]; found {
+		return family
+	}
+	return defaultRetentionPolicy
 }
 
-func (sink *influxdbSink) sendData(dataPoints []influxdb.Point) {
+func (sink *influxdbSink) sendData(dataPoints []influxdb.Point) error {
 	if err := sink.createDatabase(); err != nil {
 		glog.Errorf("Failed to create infuxdb: %v", err)
-		return
+		return err
+	}
+	if len(sink.c.FamilyRetentionPolicies) == 0 {
+		return sink.writePoints(defaultRetentionPolicy, dataPoints)
 	}
+	byRetentionPolicy := make(map[string][]influxdb.Point)
+	for _, point := range dataPoints {
+		rp := sink.retentionPolicy(point.Measurement)
+		byRetentionPolicy[rp] = append(byRetentionPolicy[rp], point)
+	}
+	var result error
+	for rp, points := range byRetentionPolicy {
+		if err := sink.writePoints(rp, points); err != nil {
+			result = err
+		}
+	}
+	return result
+}
+
+func (sink *influxdbSink) writePoints(retentionPolicy string, dataPoints []influxdb.Point) error {
 	bp := influxdb.BatchPoints{
 		Points:          dataPoints,
 		Database:        sink.c.DbName,
-		RetentionPolicy: "default",
+		RetentionPolicy: retentionPolicy,
 	}
 
 	start := time.Now()
-	if _, err := sink.client.Write(bp); err != nil {
+	_, err := sink.client.Write(bp)
+	sink.batchSize.Record(len(dataPoints), time.Since(start), err)
+	if err != nil {
 		glog.Errorf("InfluxDB write failed: %v", err)
 		if strings.Contains(err.Error(), dbNotFoundError) {
 			sink.resetConnection()
@@ -168,6 +233,7 @@ func (sink *influxdbSink) sendData(dataPoints []influxdb.Point) {
 	}
 	end := time.Now()
 	glog.V(4).Infof("Exported %d data to influxDB in %s", len(dataPoints), end.Sub(start))
+	return err
 }
 
 func (sink *influxdbSink) Name() string {
@@ -178,6 +244,10 @@ func (sink *influxdbSink) Stop() {
 	// nothing needs to be done.
 }
 
+func (sink *influxdbSink) AcceptsRawSamples() bool {
+	return sink.c.RawSamples
+}
+
 func (sink *influxdbSink) ensureClient() error {
 	if sink.client == nil {
 		client, err := influxdb_common.NewClient(sink.c)
@@ -195,7 +265,8 @@ func (sink *influxdbSink) createDatabase() error {
 		return err
 	}
 
-	if sink.dbExists {
+	// Buckets of the 2.x API aren't created by the sink.
+	if sink.dbExists || sink.c.ApiVersion == 2 {
 		return nil
 	}
 	q := influxdb.Query{
@@ -211,11 +282,36 @@ func (sink *influxdbSink) createDatabase() error {
 		}
 	}
 
+	if err := sink.createFamilyRetentionPolicies(); err != nil {
+		return err
+	}
+
 	sink.dbExists = true
 	glog.Infof("Created database %q on influxDB server at %q", sink.c.DbName, sink.c.Host)
 	return nil
 }
 
+// createFamilyRetentionPolicies creates the retention policies of metric families, updating
+// the duration of existing ones.
+func (sink *influxdbSink) createFamilyRetentionPolicies() error {
+	for family, duration := range sink.c.FamilyRetentionPolicies {
+		q := influxdb.Query{
+			Command: fmt.Sprintf(`CREATE RETENTION POLICY %q ON %s DURATION %s REPLICATION 1`, family, sink.c.DbName, duration),
+		}
+		if resp, err := sink.client.Query(q); err != nil {
+			if !(resp != nil && resp.Err != nil && strings.Contains(resp.Err.Error(), "already exists")) {
+				return fmt.Errorf("Retention Policy creation failed for family %s: %v", family, err)
+			}
+			q.Command = fmt.Sprintf(`ALTER RETENTION POLICY %q ON %s DURATION %s`, family, sink.c.DbName, duration)
+			if _, err := sink.client.Query(q); err != nil {
+				return fmt.Errorf("Retention Policy update failed for family %s: %v", family, err)
+			}
+		}
+		glog.Infof("Created retention policy %q with duration %s in database %q", family, duration, sink.c.DbName)
+	}
+	return nil
+}
+
 func (sink *influxdbSink) createRetentionPolicy() error {
 	q := influxdb.Query{
 		Command: fmt.Sprintf(`CREATE RETENTION POLICY "default" ON %s DURATION %s REPLICATION 1 DEFAULT`, sink.c.DbName, sink.c.RetentionPolicy),
@@ -232,14 +328,15 @@ func (sink *influxdbSink) createRetentionPolicy() error {
 }
 
 // Returns a thread-compatible implementation of influxdb interactions.
-func new(c influxdb_common.InfluxdbConfig) core.DataSink {
+func new(c influxdb_common.InfluxdbConfig, batchSize *batching.BatchSize) core.DataSink {
 	client, err := influxdb_common.NewClient(c)
 	if err != nil {
 		glog.Errorf("issues while creating an InfluxDB sink: %v, will retry on use", err)
 	}
 	return &influxdbSink{
-		client: client, // can be nil
-		c:      c,
+		client:    client, // can be nil
+		c:         c,
+		batchSize: batchSize,
 	}
 }
 
@@ -248,7 +345,11 @@ func CreateInfluxdbSink(uri *url.URL) (core.DataSink, error) {
 	if err != nil {
 		return nil, err
 	}
-	sink := new(*config)
+	batchSize, err := batching.NewBatchSize("InfluxDB Sink", uri.Query(), defaultBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	sink := new(*config, batchSize)
 	glog.Infof("created influxdb sink with options: host:%s user:%s db:%s", config.Host, config.User, config.DbName)
 	return sink, nil
 }
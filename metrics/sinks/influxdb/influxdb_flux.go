@@ -0,0 +1,282 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/heapster/metrics/core"
+
+	influxdb "github.com/influxdata/influxdb/client"
+	influx_models "github.com/influxdata/influxdb/models"
+)
+
+// Flux equivalents of the InfluxQL queries, used with the InfluxDB 2.x API.
+//
+// Every query yields the results for the i-th metric key under the name "i", or the
+// j-th aggregation for the i-th metric key under the name "i_j". fluxResults turns them
+// back into results shaped like the InfluxQL ones, so that the same parsing applies.
+
+const fluxSchemaImport = `import "influxdata/influxdb/schema"`
+
+// fluxTime formats a time as a Flux time literal, the zero time being the epoch.
+func fluxTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (sink *influxdbSink) fluxRange(start, end time.Time) string {
+	stop := "now()"
+	if !end.IsZero() {
+		stop = fluxTime(end)
+	}
+	return fmt.Sprintf("range(start: %s, stop: %s)", fluxTime(start), stop)
+}
+
+func fluxEquals(column, value string) string {
+	return fmt.Sprintf("r[%q] == %q", column, value)
+}
+
+// keyToFluxPredicate converts a HistoricalKey to the body of a Flux filter function
+func (sink *influxdbSink) keyToFluxPredicate(key core.HistoricalKey) string {
+	preds := []string{fluxEquals("type", key.ObjectType)}
+	switch key.ObjectType {
+	case core.MetricSetTypeNode:
+		preds = append(preds, fluxEquals(core.LabelNodename.Key, key.NodeName))
+	case core.MetricSetTypeSystemContainer:
+		preds = append(preds, fluxEquals(core.LabelContainerName.Key, key.ContainerName), fluxEquals(core.LabelNodename.Key, key.NodeName))
+	case core.MetricSetTypeCluster:
+	case core.MetricSetTypeNamespace:
+		preds = append(preds, fluxEquals(core.LabelNamespaceName.Key, key.NamespaceName))
+	case core.MetricSetTypePod:
+		if key.PodId != "" {
+			preds = append(preds, fluxEquals(core.LabelPodId.Key, key.PodId))
+		} else {
+			preds = append(preds, fluxEquals(core.LabelNamespaceName.Key, key.NamespaceName), fluxEquals(core.LabelPodName.Key, key.PodName))
+		}
+	case core.MetricSetTypePodContainer:
+		if key.PodId != "" {
+			preds = append(preds, fluxEquals(core.LabelPodId.Key, key.PodId))
+		} else {
+			preds = append(preds, fluxEquals(core.LabelNamespaceName.Key, key.NamespaceName), fluxEquals(core.LabelPodName.Key, key.PodName))
+		}
+		preds = append(preds, fluxEquals(core.LabelContainerName.Key, key.ContainerName))
+	default:
+		// These are assigned by the API, so it shouldn't be possible to reach this unless things are really broken
+		panic(fmt.Sprintf("Unknown metric type %q", key.ObjectType))
+	}
+	return strings.Join(preds, " and ")
+}
+
+// composeFluxData returns the statement assigning the points of the metric for the key
+// to the given variable, as a single table.
+func (sink *influxdbSink) composeFluxData(variable, metricName string, labels map[string]string, key core.HistoricalKey, start, end time.Time) string {
+	seriesName, fieldName := sink.metricToSeriesAndField(metricName)
+	preds := []string{fluxEquals("_measurement", seriesName), fluxEquals("_field", fieldName), sink.keyToFluxPredicate(key)}
+	labelNames := make([]string, 0, len(labels))
+	for k := range labels {
+		labelNames = append(labelNames, k)
+	}
+	sort.Strings(labelNames)
+	for _, k := range labelNames {
+		preds = append(preds, fluxEquals(k, labels[k]))
+	}
+	return fmt.Sprintf("%s = from(bucket: %q)\n  |> %s\n  |> filter(fn: (r) => %s)\n  |> group()",
+		variable, sink.c.Bucket, sink.fluxRange(start, end), strings.Join(preds, " and "))
+}
+
+// composeFluxRawQuery creates the Flux query to fetch the given metric values
+func (sink *influxdbSink) composeFluxRawQuery(metricName string, labels map[string]string, metricKeys []core.HistoricalKey, start, end time.Time) string {
+	queries := make([]string, len(metricKeys))
+	for i, key := range metricKeys {
+		variable := fmt.Sprintf("data%d", i)
+		queries[i] = fmt.Sprintf("%s\n%s\n  |> keep(columns: [\"_time\", \"_value\"])\n  |> sort(columns: [\"_time\"])\n  |> yield(name: \"%d\")",
+			sink.composeFluxData(variable, metricName, labels, key, start, end), variable, i)
+	}
+	return strings.Join(queries, "\n")
+}
+
+// aggregationFluxCall converts an aggregation name into the equivalent call to a Flux function
+func (sink *influxdbSink) aggregationFluxCall(aggregationName core.AggregationType, column string) string {
+	switch aggregationName {
+	case core.AggregationTypeAverage:
+		return fmt.Sprintf("mean(column: %s)", column)
+	case core.AggregationTypeMaximum:
+		return fmt.Sprintf("max(column: %s)", column)
+	case core.AggregationTypeMinimum:
+		return fmt.Sprintf("min(column: %s)", column)
+	case core.AggregationTypeMedian:
+		return fmt.Sprintf("quantile(q: 0.5, method: \"exact_mean\", column: %s)", column)
+	case core.AggregationTypeCount:
+		return fmt.Sprintf("count(column: %s)", column)
+	case core.AggregationTypePercentile50:
+		return fmt.Sprintf("quantile(q: 0.5, method: \"exact_selector\", column: %s)", column)
+	case core.AggregationTypePercentile95:
+		return fmt.Sprintf("quantile(q: 0.95, method: \"exact_selector\", column: %s)", column)
+	case core.AggregationTypePercentile99:
+		return fmt.Sprintf("quantile(q: 0.99, method: \"exact_selector\", column: %s)", column)
+	}
+
+	// This should have been checked by the API level, so something's seriously wrong here
+	panic(fmt.Sprintf("Unknown aggregation type %q", aggregationName))
+}
+
+// composeFluxAggregateQuery creates the Flux query to fetch the given aggregation values.
+// Without a bucket size the aggregation spans the whole range and is reported at its start.
+func (sink *influxdbSink) composeFluxAggregateQuery(metricName string, labels map[string]string, aggregations []core.AggregationType, metricKeys []core.HistoricalKey, start, end time.Time, bucketSize time.Duration) string {
+	queries := []string{}
+	for i, key := range metricKeys {
+		variable := fmt.Sprintf("data%d", i)
+		queries = append(queries, sink.composeFluxData(variable, metricName, labels, key, start, end))
+		for j, agg := range aggregations {
+			var aggregation string
+			if bucketSize != 0 {
+				aggregation = fmt.Sprintf("aggregateWindow(every: %dns, fn: (column, tables=<-) => tables |> %s, timeSrc: \"_start\", createEmpty: false)",
+					bucketSize.Nanoseconds(), sink.aggregationFluxCall(agg, "column"))
+			} else {
+				aggregation = fmt.Sprintf("%s\n  |> map(fn: (r) => ({_time: %s, _value: r._value}))",
+					sink.aggregationFluxCall(agg, "\"_value\""), fluxTime(start))
+			}
+			queries = append(queries, fmt.Sprintf("%s\n  |> %s\n  |> keep(columns: [\"_time\", \"_value\"])\n  |> yield(name: \"%d_%d\")",
+				variable, aggregation, i, j))
+		}
+	}
+	return strings.Join(queries, "\n")
+}
+
+// composeFluxTagValuesQuery creates the Flux query listing the values of the tag for the points
+// matching the predicate, returned in the given column.
+func (sink *influxdbSink) composeFluxTagValuesQuery(tag, predicate, column string) string {
+	if predicate == "" {
+		predicate = "true"
+	}
+	return fmt.Sprintf("%s\nschema.tagValues(bucket: %q, tag: %q, predicate: (r) => %s, start: %s)\n  |> rename(columns: {_value: %q})\n  |> yield(name: \"0\")",
+		fluxSchemaImport, sink.c.Bucket, tag, predicate, fluxTime(time.Time{}), column)
+}
+
+// fluxResults turns the results of a Flux query, one per yield, into the results of the
+// equivalent InfluxQL query, one per metric key. Aggregations of the same key are merged
+// into the columns of a single row, joined on their time.
+func fluxResults(results []influxdb.Result) []influxdb.Result {
+	type column struct {
+		index int
+		rows  []influx_models.Row
+	}
+	keys := make(map[int][]column)
+	maxKey := -1
+	for _, result := range results {
+		if len(result.Series) == 0 {
+			continue
+		}
+		parts := strings.SplitN(result.Series[0].Name, "_", 2)
+		keyIndex, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		columnIndex := -1
+		if len(parts) > 1 {
+			if columnIndex, err = strconv.Atoi(parts[1]); err != nil {
+				continue
+			}
+		}
+		keys[keyIndex] = append(keys[keyIndex], column{columnIndex, result.Series})
+		if keyIndex > maxKey {
+			maxKey = keyIndex
+		}
+	}
+
+	converted := make([]influxdb.Result, maxKey+1)
+	for keyIndex, columns := range keys {
+		if len(columns) == 1 && columns[0].index < 0 {
+			// Not an aggregation, tables are concatenated.
+			row := influx_models.Row{Columns: columns[0].rows[0].Columns}
+			for _, table := range columns[0].rows {
+				row.Values = append(row.Values, table.Values...)
+			}
+			converted[keyIndex].Series = []influx_models.Row{row}
+			continue
+		}
+
+		numColumns := 0
+		for _, c := range columns {
+			if c.index+1 > numColumns {
+				numColumns = c.index + 1
+			}
+		}
+		byTime := make(map[string][]interface{})
+		times := []string{}
+		for _, c := range columns {
+			for _, table := range c.rows {
+				timeIndex, valueIndex := columnIndex(table, "_time"), columnIndex(table, "_value")
+				if timeIndex < 0 || valueIndex < 0 {
+					continue
+				}
+				for _, value := range table.Values {
+					t := value[timeIndex].(string)
+					values, found := byTime[t]
+					if !found {
+						values = make([]interface{}, numColumns+1)
+						values[0] = t
+						byTime[t] = values
+						times = append(times, t)
+					}
+					values[c.index+1] = value[valueIndex]
+				}
+			}
+		}
+		sort.Sort(byTimestamp(times))
+		row := influx_models.Row{Columns: []string{"time"}}
+		for _, t := range times {
+			values := byTime[t]
+			complete := true
+			for _, v := range values {
+				if v == nil {
+					complete = false
+				}
+			}
+			if complete {
+				row.Values = append(row.Values, values)
+			}
+		}
+		converted[keyIndex].Series = []influx_models.Row{row}
+	}
+	return converted
+}
+
+// Orders RFC3339 timestamps, which don't sort as strings when their precision differs.
+type byTimestamp []string
+
+func (a byTimestamp) Len() int      { return len(a) }
+func (a byTimestamp) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byTimestamp) Less(i, j int) bool {
+	left, _ := time.Parse(time.RFC3339Nano, a[i])
+	right, _ := time.Parse(time.RFC3339Nano, a[j])
+	return left.Before(right)
+}
+
+func columnIndex(row influx_models.Row, name string) int {
+	for i, column := range row.Columns {
+		if column == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,205 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+)
+
+// A fake InfluxDB 2.x server answering every query with the same response.
+type fakeInfluxDBV2 struct {
+	t             *testing.T
+	writes        []string
+	queries       []string
+	queryResponse string
+}
+
+func (f *fakeInfluxDBV2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/health":
+		w.Write([]byte(`{"status": "pass", "version": "2.0.0"}`))
+	case "/api/v2/write":
+		assert.Equal(f.t, "Token secret", r.Header.Get("Authorization"))
+		assert.Equal(f.t, "myorg", r.URL.Query().Get("org"))
+		assert.Equal(f.t, "metrics", r.URL.Query().Get("bucket"))
+		body, err := readBody(r)
+		require.NoError(f.t, err)
+		f.writes = append(f.writes, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	case "/api/v2/query":
+		assert.Equal(f.t, "Token secret", r.Header.Get("Authorization"))
+		assert.Equal(f.t, "myorg", r.URL.Query().Get("org"))
+		var query struct {
+			Query string `json:"query"`
+		}
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&query))
+		f.queries = append(f.queries, query.Query)
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte(f.queryResponse))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Reads the body of the request, gunzipped if compressed.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		return ioutil.ReadAll(r.Body)
+	}
+	reader, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+func newV2Sink(t *testing.T, options ...string) (*influxdbSink, *fakeInfluxDBV2, func()) {
+	fake := &fakeInfluxDBV2{t: t}
+	server := httptest.NewServer(fake)
+	serverUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	uri, err := url.Parse("influxdb:?apiversion=2&org=myorg&bucket=metrics&token=secret&" + strings.Join(options, "&"))
+	require.NoError(t, err)
+	uri.Host = serverUrl.Host
+	sink, err := CreateInfluxdbSink(uri)
+	require.NoError(t, err)
+	return sink.(*influxdbSink), fake, server.Close
+}
+
+func TestInfluxDBV2Write(t *testing.T) {
+	for _, gzip := range []string{"gzip=false", "gzip=true"} {
+		sink, fake, stop := newV2Sink(t, gzip)
+		testInfluxDBV2Write(t, sink, fake)
+		stop()
+	}
+}
+
+func testInfluxDBV2Write(t *testing.T, sink *influxdbSink, fake *fakeInfluxDBV2) {
+	sink.ExportData(&core.DataBatch{
+		Timestamp: time.Unix(1000, 0),
+		MetricSets: map[string]*core.MetricSet{
+			"pod1": {
+				Labels: map[string]string{"pod_name": "pod1"},
+				MetricValues: map[string]core.MetricValue{
+					"memory/usage": {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1024},
+				},
+			},
+		},
+	})
+	assert.Equal(t, []string{"memory/usage,pod_name=pod1 value=1024i 1000000000000\n"}, fake.writes)
+	assert.Empty(t, fake.queries)
+}
+
+func TestInfluxDBV2Aggregation(t *testing.T) {
+	sink, fake, stop := newV2Sink(t)
+	defer stop()
+
+	fake.queryResponse = "#datatype,string,long,dateTime:RFC3339,double\n" +
+		",result,table,_time,_value\n" +
+		",0_0,0,2016-10-01T12:05:00Z,2.5\n" +
+		",0_0,0,2016-10-01T12:00:00Z,1.5\n" +
+		"\n" +
+		"#datatype,string,long,dateTime:RFC3339,long\n" +
+		",result,table,_time,_value\n" +
+		",0_1,0,2016-10-01T12:00:00Z,3\n" +
+		",0_1,0,2016-10-01T12:05:00Z,4\n"
+
+	key := core.HistoricalKey{ObjectType: core.MetricSetTypePod, NamespaceName: "ns1", PodName: "pod1"}
+	start := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	res, err := sink.GetAggregation("cpu/usage_rate", []core.AggregationType{core.AggregationTypeAverage, core.AggregationTypeMaximum},
+		[]core.HistoricalKey{key}, start, start.Add(10*time.Minute), 5*time.Minute)
+	require.NoError(t, err)
+
+	require.Len(t, fake.queries, 1)
+	query := fake.queries[0]
+	assert.Contains(t, query, `from(bucket: "metrics")`)
+	assert.Contains(t, query, "range(start: 2016-10-01T12:00:00Z, stop: 2016-10-01T12:10:00Z)")
+	assert.Contains(t, query, `r["_measurement"] == "cpu/usage_rate" and r["_field"] == "value" and r["type"] == "pod" and r["namespace_name"] == "ns1" and r["pod_name"] == "pod1"`)
+	assert.Contains(t, query, "aggregateWindow(every: 300000000000ns, fn: (column, tables=<-) => tables |> mean(column: column)")
+	assert.Contains(t, query, `yield(name: "0_1")`)
+
+	require.Len(t, res[key], 2)
+	assert.Equal(t, start, res[key][0].Timestamp)
+	assert.Equal(t, core.ValueFloat, res[key][0].Aggregations[core.AggregationTypeAverage].ValueType)
+	assert.Equal(t, float32(1.5), res[key][0].Aggregations[core.AggregationTypeAverage].FloatValue)
+	assert.Equal(t, core.ValueInt64, res[key][0].Aggregations[core.AggregationTypeMaximum].ValueType)
+	assert.Equal(t, int64(3), res[key][0].Aggregations[core.AggregationTypeMaximum].IntValue)
+	assert.Equal(t, start.Add(5*time.Minute), res[key][1].Timestamp)
+	assert.Equal(t, int64(4), res[key][1].Aggregations[core.AggregationTypeMaximum].IntValue)
+}
+
+func TestInfluxDBV2Metrics(t *testing.T) {
+	sink, fake, stop := newV2Sink(t)
+	defer stop()
+
+	fake.queryResponse = "#datatype,string,long,dateTime:RFC3339,long\n" +
+		",result,table,_time,_value\n" +
+		",0,0,2016-10-01T12:00:00Z,10\n" +
+		",0,0,2016-10-01T12:01:00Z,20\n"
+	keys := []core.HistoricalKey{
+		{ObjectType: core.MetricSetTypeNode, NodeName: "node1"},
+		{ObjectType: core.MetricSetTypeNode, NodeName: "node2"},
+	}
+	_, err := sink.GetMetric("memory/usage", keys, time.Time{}, time.Time{})
+	// There are no results for the second key.
+	assert.EqualError(t, err, `No results for metric "memory/usage" describing "(node)node:node2"`)
+	assert.Contains(t, fake.queries[0], "range(start: 1970-01-01T00:00:00Z, stop: now())")
+
+	res, err := sink.GetMetric("memory/usage", keys[:1], time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, res[keys[0]], 2)
+	assert.Equal(t, int64(20), res[keys[0]][1].MetricValue.IntValue)
+
+	fake.queryResponse = "#datatype,string,long,string\n" +
+		",result,table,nodename\n" +
+		",0,0,node1\n" +
+		",0,0,node2\n"
+	nodes, err := sink.GetNodes()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"node1", "node2"}, nodes)
+	query := fake.queries[len(fake.queries)-1]
+	assert.True(t, strings.HasPrefix(query, `import "influxdata/influxdb/schema"`))
+	assert.Contains(t, query, `schema.tagValues(bucket: "metrics", tag: "nodename"`)
+
+	fake.queryResponse = "#datatype,string,string\n" +
+		",error,reference\n" +
+		",bad query,\n"
+	_, err = sink.GetNamespaces()
+	assert.Error(t, err)
+}
+
+func TestInfluxDBV2Config(t *testing.T) {
+	uri, err := url.Parse("influxdb:?apiversion=2")
+	require.NoError(t, err)
+	_, err = CreateInfluxdbSink(uri)
+	assert.Error(t, err)
+
+	uri, err = url.Parse("influxdb:?apiversion=3&org=myorg")
+	require.NoError(t, err)
+	_, err = CreateInfluxdbSink(uri)
+	assert.Error(t, err)
+}
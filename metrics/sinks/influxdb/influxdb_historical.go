@@ -180,8 +180,16 @@ func (sink *influxdbSink) labelsToPredicate(labels map[string]string) string {
 }
 
 // metricToSeriesAndField retrieves the appropriate field name and series name for a given metric
-// (this varies depending on whether or not WithFields is enabled)
+// (this varies depending on whether or not WithFields is enabled, or the family of the metric
+// is routed to a measurement)
 func (sink *influxdbSink) metricToSeriesAndField(metricName string) (string, string) {
+	seriesName := strings.SplitN(metricName, "/", 2)
+	if measurement, found := sink.c.FamilyMeasurements[seriesName[0]]; found {
+		if len(seriesName) > 1 {
+			return measurement, seriesName[1]
+		}
+		return measurement, "value"
+	}
 	if sink.c.WithFields {
 		seriesName := strings.SplitN(metricName, "/", 2)
 		if len(seriesName) > 1 {
@@ -194,8 +202,20 @@ func (sink *influxdbSink) metricToSeriesAndField(metricName string) (string, str
 	}
 }
 
+// seriesSource returns the series to select from, qualified with its retention policy unless
+// it is in the default one
+func (sink *influxdbSink) seriesSource(seriesName string) string {
+	if rp := sink.retentionPolicy(seriesName); rp != defaultRetentionPolicy {
+		return fmt.Sprintf("%q.%q", rp, seriesName)
+	}
+	return fmt.Sprintf("%q", seriesName)
+}
+
 // composeRawQuery creates the InfluxQL query to fetch the given metric values
 func (sink *influxdbSink) composeRawQuery(metricName string, labels map[string]string, metricKeys []core.HistoricalKey, start, end time.Time) string {
+	if sink.c.ApiVersion == 2 {
+		return sink.composeFluxRawQuery(metricName, labels, metricKeys, start, end)
+	}
 	seriesName, fieldName := sink.metricToSeriesAndField(metricName)
 
 	queries := make([]string, len(metricKeys))
@@ -210,7 +230,7 @@ func (sink *influxdbSink) composeRawQuery(metricName string, labels map[string]s
 		if !end.IsZero() {
 			pred += fmt.Sprintf(" AND time < '%s'", end.Format(time.RFC3339))
 		}
-		queries[i] = fmt.Sprintf("SELECT time, %q FROM %q WHERE %s", fieldName, seriesName, pred)
+		queries[i] = fmt.Sprintf("SELECT time, %q FROM %s WHERE %s", fieldName, sink.seriesSource(seriesName), pred)
 	}
 
 	return strings.Join(queries, "; ")
@@ -276,7 +296,7 @@ func (sink *influxdbSink) GetMetric(metricName string, metricKeys []core.Histori
 
 	res := make(map[core.HistoricalKey][]core.TimestampedMetricValue, len(metricKeys))
 	for i, key := range metricKeys {
-		if len(resp[i].Series) < 1 {
+		if i >= len(resp) || len(resp[i].Series) < 1 {
 			return nil, fmt.Errorf("No results for metric %q describing %q", metricName, key.String())
 		}
 
@@ -319,7 +339,7 @@ func (sink *influxdbSink) GetLabeledMetric(metricName string, labels map[string]
 
 	res := make(map[core.HistoricalKey][]core.TimestampedMetricValue, len(metricKeys))
 	for i, key := range metricKeys {
-		if len(resp[i].Series) < 1 {
+		if i >= len(resp) || len(resp[i].Series) < 1 {
 			return nil, fmt.Errorf("No results for metric %q describing %q", metricName, key.String())
 		}
 
@@ -335,6 +355,9 @@ func (sink *influxdbSink) GetLabeledMetric(metricName string, labels map[string]
 
 // composeAggregateQuery creates the InfluxQL query to fetch the given aggregation values
 func (sink *influxdbSink) composeAggregateQuery(metricName string, labels map[string]string, aggregations []core.AggregationType, metricKeys []core.HistoricalKey, start, end time.Time, bucketSize time.Duration) string {
+	if sink.c.ApiVersion == 2 {
+		return sink.composeFluxAggregateQuery(metricName, labels, aggregations, metricKeys, start, end, bucketSize)
+	}
 	seriesName, fieldName := sink.metricToSeriesAndField(metricName)
 
 	var bucketSizeNanoSeconds int64 = 0
@@ -360,7 +383,7 @@ func (sink *influxdbSink) composeAggregateQuery(metricName string, labels map[st
 			aggParts[i] = sink.aggregationFunc(agg, fieldName)
 		}
 
-		queries[i] = fmt.Sprintf("SELECT %s FROM %q WHERE %s", strings.Join(aggParts, ", "), seriesName, pred)
+		queries[i] = fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(aggParts, ", "), sink.seriesSource(seriesName), pred)
 
 		if bucketSize != 0 {
 			// group by time requires we have at least one time bound
@@ -454,7 +477,7 @@ func (sink *influxdbSink) GetAggregation(metricName string, aggregations []core.
 	//       instead of returning an error.  We should detect this case and return an error ourselves (or maybe just require a start time at the API level)
 	res := make(map[core.HistoricalKey][]core.TimestampedAggregationValue, len(metricKeys))
 	for i, key := range metricKeys {
-		if len(resp[i].Series) < 1 {
+		if i >= len(resp) || len(resp[i].Series) < 1 {
 			return nil, fmt.Errorf("No results for metric %q describing %q", metricName, key.String())
 		}
 
@@ -505,7 +528,7 @@ func (sink *influxdbSink) GetLabeledAggregation(metricName string, labels map[st
 	//       instead of returning an error.  We should detect this case and return an error ourselves (or maybe just require a start time at the API level)
 	res := make(map[core.HistoricalKey][]core.TimestampedAggregationValue, len(metricKeys))
 	for i, key := range metricKeys {
-		if len(resp[i].Series) < 1 {
+		if i >= len(resp) || len(resp[i].Series) < 1 {
 			return nil, fmt.Errorf("No results for metric %q describing %q", metricName, key.String())
 		}
 
@@ -571,16 +594,25 @@ func (sink *influxdbSink) GetMetricNames(metricKey core.HistoricalKey) ([]string
 	if err := sink.checkSanitizedKey(&metricKey); err != nil {
 		return nil, err
 	}
+	if sink.c.ApiVersion == 2 {
+		return sink.stringListQuery(sink.composeFluxTagValuesQuery("_measurement", sink.keyToFluxPredicate(metricKey), "name"), "Unable to list available metrics")
+	}
 	return sink.stringListQuery(fmt.Sprintf("SHOW MEASUREMENTS WHERE %s", sink.keyToSelector(metricKey)), "Unable to list available metrics")
 }
 
 // GetNodes retrieves the list of nodes in the cluster
 func (sink *influxdbSink) GetNodes() ([]string, error) {
+	if sink.c.ApiVersion == 2 {
+		return sink.stringListQuery(sink.composeFluxTagValuesQuery(core.LabelNodename.Key, "", core.LabelNodename.Key), "Unable to list all nodes")
+	}
 	return sink.stringListQuery(fmt.Sprintf("SHOW TAG VALUES WITH KEY = %s", core.LabelNodename.Key), "Unable to list all nodes")
 }
 
 // GetNamespaces retrieves the list of namespaces in the cluster
 func (sink *influxdbSink) GetNamespaces() ([]string, error) {
+	if sink.c.ApiVersion == 2 {
+		return sink.stringListQuery(sink.composeFluxTagValuesQuery(core.LabelNamespaceName.Key, "", core.LabelNamespaceName.Key), "Unable to list all namespaces")
+	}
 	return sink.stringListQuery(fmt.Sprintf("SHOW TAG VALUES WITH KEY = %s", core.LabelNamespaceName.Key), "Unable to list all namespaces")
 }
 
@@ -593,6 +625,10 @@ func (sink *influxdbSink) GetPodsFromNamespace(namespace string) ([]string, erro
 	// we just get all series for the uptime measurement for pods which match our namespace
 	// (any measurement should work here, though)
 	q := fmt.Sprintf("SHOW SERIES FROM %q WHERE %s = '%s' AND type = '%s'", core.MetricUptime.MetricDescriptor.Name, core.LabelNamespaceName.Key, namespace, core.MetricSetTypePod)
+	if sink.c.ApiVersion == 2 {
+		pred := strings.Join([]string{fluxEquals("_measurement", core.MetricUptime.MetricDescriptor.Name), fluxEquals(core.LabelNamespaceName.Key, namespace), fluxEquals("type", core.MetricSetTypePod)}, " and ")
+		q = sink.composeFluxTagValuesQuery(core.LabelPodName.Key, pred, core.LabelPodName.Key)
+	}
 	return sink.stringListQueryCol(q, core.LabelPodName.Key, fmt.Sprintf("Unable to list pods in namespace %q", namespace))
 }
 
@@ -605,6 +641,10 @@ func (sink *influxdbSink) GetSystemContainersFromNode(node string) ([]string, er
 	// we just get all series for the uptime measurement for system containers on our node
 	// (any measurement should work here, though)
 	q := fmt.Sprintf("SHOW SERIES FROM %q WHERE %s = '%s' AND type = '%s'", core.MetricUptime.MetricDescriptor.Name, core.LabelNodename.Key, node, core.MetricSetTypeSystemContainer)
+	if sink.c.ApiVersion == 2 {
+		pred := strings.Join([]string{fluxEquals("_measurement", core.MetricUptime.MetricDescriptor.Name), fluxEquals(core.LabelNodename.Key, node), fluxEquals("type", core.MetricSetTypeSystemContainer)}, " and ")
+		q = sink.composeFluxTagValuesQuery(core.LabelContainerName.Key, pred, core.LabelContainerName.Key)
+	}
 	return sink.stringListQueryCol(q, core.LabelContainerName.Key, fmt.Sprintf("Unable to list system containers on node %q", node))
 }
 
@@ -688,12 +728,17 @@ func (sink *influxdbSink) runQuery(queryStr string) ([]influxdb.Result, error) {
 		return nil, resp.Error()
 	}
 
-	if len(resp.Results) < 1 {
+	results := resp.Results
+	if sink.c.ApiVersion == 2 {
+		results = fluxResults(results)
+	}
+
+	if len(results) < 1 {
 		glog.Errorf("Unable to perform query %q against database %q: no results returned", q.Command, q.Database)
 		return nil, fmt.Errorf("No results returned")
 	}
 
-	return resp.Results, nil
+	return results, nil
 }
 
 // populateAggregations extracts aggregation values from a given data point
@@ -20,13 +20,16 @@ import (
 	"testing"
 	"time"
 
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 
 	influx_models "github.com/influxdata/influxdb/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	influxdb_common "k8s.io/heapster/common/influxdb"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/batching"
 	util "k8s.io/kubernetes/pkg/util/testing"
 )
 
@@ -37,8 +40,9 @@ type fakeInfluxDBDataSink struct {
 
 func newRawInfluxSink() *influxdbSink {
 	return &influxdbSink{
-		client: influxdb_common.Client,
-		c:      influxdb_common.Config,
+		client:    influxdb_common.Client,
+		c:         influxdb_common.Config,
+		batchSize: batching.Fixed(defaultBatchSize),
 	}
 }
 
@@ -151,6 +155,117 @@ func TestStoreMultipleDataInput(t *testing.T) {
 	assert.Equal(t, 5, len(fakeSink.fakeDbClient.Pnts))
 }
 
+func TestStoreRawSamples(t *testing.T) {
+	config := influxdb_common.Config
+	config.RawSamples = true
+	client := influxdb_common.NewFakeInfluxDBClient()
+	sink := &influxdbSink{
+		client:    client,
+		c:         config,
+		batchSize: batching.Fixed(defaultBatchSize),
+	}
+	assert.True(t, sink.AcceptsRawSamples())
+
+	timestamp := time.Now()
+	metricSet := core.MetricSet{
+		Labels: map[string]string{"namespace_id": "123"},
+		MetricValues: map[string]core.MetricValue{
+			"cpu/usage": {
+				ValueType:  core.ValueInt64,
+				MetricType: core.MetricCumulative,
+				IntValue:   200,
+			},
+			"cpu/usage_rate": {
+				ValueType:  core.ValueInt64,
+				MetricType: core.MetricGauge,
+				IntValue:   10,
+			},
+		},
+		RawSamples: []core.RawSample{
+			{
+				Timestamp: timestamp.Add(-10 * time.Second),
+				MetricValues: map[string]core.MetricValue{
+					"cpu/usage": {ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 100},
+				},
+			},
+			{
+				Timestamp: timestamp,
+				MetricValues: map[string]core.MetricValue{
+					"cpu/usage": {ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 200},
+				},
+			},
+		},
+	}
+	data := core.DataBatch{
+		Timestamp: timestamp,
+		MetricSets: map[string]*core.MetricSet{
+			"pod1": &metricSet,
+		},
+	}
+
+	sink.ExportData(&data)
+	// Two raw samples of cpu/usage plus cpu/usage_rate at the batch timestamp.
+	assert.Equal(t, 3, len(client.Pnts))
+}
+
+func TestStoreMetricFamilies(t *testing.T) {
+	uri, err := url.Parse("influxdb:?familyretention=filesystem:7d&familyretention=cpu:90d&familymeasurement=filesystem:fs")
+	assert.NoError(t, err)
+	config, err := influxdb_common.BuildConfig(uri)
+	assert.NoError(t, err)
+	client := influxdb_common.NewFakeInfluxDBClient()
+	sink := &influxdbSink{
+		client:    client,
+		c:         *config,
+		batchSize: batching.Fixed(defaultBatchSize),
+	}
+
+	data := core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			"node1": {
+				Labels: map[string]string{"nodename": "node1"},
+				MetricValues: map[string]core.MetricValue{
+					"cpu/usage":    {ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 200},
+					"memory/usage": {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 100},
+				},
+				LabeledMetrics: []core.LabeledMetric{{
+					Name:        "filesystem/usage",
+					Labels:      map[string]string{"resource_id": "/dev/sda1"},
+					MetricValue: core.MetricValue{ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 300},
+				}},
+			},
+		},
+	}
+	sink.ExportData(&data)
+
+	retentionPolicies := make(map[string]string)
+	for _, pnt := range client.Pnts {
+		retentionPolicies[pnt.Ponit.Measurement] = pnt.RetentionPolicy
+		if pnt.Ponit.Measurement == "fs" {
+			assert.Equal(t, map[string]interface{}{"usage": int64(300)}, pnt.Ponit.Fields)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"cpu/usage":    "cpu",
+		"memory/usage": "default",
+		"fs":           "filesystem",
+	}, retentionPolicies)
+
+	key := core.HistoricalKey{ObjectType: core.MetricSetTypeNode, NodeName: "node1"}
+	assert.Equal(t, `SELECT time, "usage" FROM "filesystem"."fs" WHERE type = 'node' AND nodename = 'node1'`,
+		sink.composeRawQuery("filesystem/usage", nil, []core.HistoricalKey{key}, time.Time{}, time.Time{}))
+	assert.Equal(t, `SELECT time, "value" FROM "memory/usage" WHERE type = 'node' AND nodename = 'node1'`,
+		sink.composeRawQuery("memory/usage", nil, []core.HistoricalKey{key}, time.Time{}, time.Time{}))
+
+	for _, query := range []string{"familyretention=filesystem", "familymeasurement=:fs", "apiversion=2&org=o&familyretention=cpu:1d"} {
+		uri, err := url.Parse("influxdb:?" + query)
+		assert.NoError(t, err)
+		_, err = influxdb_common.BuildConfig(uri)
+		assert.Error(t, err, query)
+	}
+}
+
 func TestCreateInfluxdbSink(t *testing.T) {
 	handler := util.FakeHandler{
 		StatusCode:   200,
@@ -172,6 +287,50 @@ func TestCreateInfluxdbSink(t *testing.T) {
 	assert.Equal(t, sink.Name(), "InfluxDB Sink")
 }
 
+func TestGzipWrites(t *testing.T) {
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/write":
+			assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+			assert.Equal(t, "k8s", r.URL.Query().Get("db"))
+			user, password, _ := r.BasicAuth()
+			assert.Equal(t, "root:secret", user+":"+password)
+			body, err := readBody(r)
+			require.NoError(t, err)
+			writes = append(writes, string(body))
+			w.WriteHeader(http.StatusNoContent)
+		case "/query":
+			w.Write([]byte(`{"results": [{}]}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	uri, err := url.Parse(server.URL + "?gzip=true&pw=secret")
+	require.NoError(t, err)
+	sink, err := CreateInfluxdbSink(uri)
+	require.NoError(t, err)
+	sink.ExportData(&core.DataBatch{
+		Timestamp: time.Unix(1000, 0),
+		MetricSets: map[string]*core.MetricSet{
+			"pod1": {
+				Labels: map[string]string{"pod_name": "pod1"},
+				MetricValues: map[string]core.MetricValue{
+					"memory/usage": {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1024},
+				},
+			},
+		},
+	})
+	assert.Equal(t, []string{"memory/usage,pod_name=pod1 value=1024i 1000000000000\n"}, writes)
+
+	uri, err = url.Parse(server.URL + "?gzip=maybe")
+	require.NoError(t, err)
+	_, err = CreateInfluxdbSink(uri)
+	assert.Error(t, err)
+}
+
 func makeRow(results [][]string) influx_models.Row {
 	resRow := influx_models.Row{
 		Values: make([][]interface{}, len(results)),
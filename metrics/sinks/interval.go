@@ -0,0 +1,256 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"time"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	DownsampleLast = "last"
+	DownsampleAvg  = "avg"
+	DownsampleMax  = "max"
+)
+
+// Gauge values of the batches received since the last export.
+type gaugeStats struct {
+	sum   float64
+	max   float64
+	count int
+}
+
+// A sink wrapper exporting to the sink at its own interval rather than at every batch. Longer
+// intervals export one batch per interval, with the gauges of the batches received since the
+// previous export averaged or maxed if configured. Shorter intervals export a batch per
+// interval from the raw samples of the batches, if the sources forward them. Exports are
+// aligned on multiples of the interval.
+type intervalSink struct {
+	core.DataSink
+	interval   time.Duration
+	downsample string
+	// Start of the interval of the last export.
+	window time.Time
+	// Gauges since the last export, by metric set key and metric key.
+	gauges map[string]*gaugeStats
+}
+
+// Wraps the sink with the push interval given in the options of its uri, or returns it as is
+// if it has none.
+func newIntervalSink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	if len(opts["pushinterval"]) == 0 {
+		return sink, nil
+	}
+	if _, ok := sink.(core.HttpSink); ok {
+		return nil, fmt.Errorf("push intervals are not supported by sink %s", sink.Name())
+	}
+	interval, err := time.ParseDuration(opts["pushinterval"][0])
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("failed to parse `pushinterval` flag - %v", opts["pushinterval"][0])
+	}
+	this := &intervalSink{
+		DataSink:   sink,
+		interval:   interval,
+		downsample: DownsampleLast,
+		gauges:     make(map[string]*gaugeStats),
+	}
+	if len(opts["downsample"]) >= 1 {
+		switch opts["downsample"][0] {
+		case DownsampleLast, DownsampleAvg, DownsampleMax:
+			this.downsample = opts["downsample"][0]
+		default:
+			return nil, fmt.Errorf("failed to parse `downsample` flag - should be %s, %s or %s, got %q",
+				DownsampleLast, DownsampleAvg, DownsampleMax, opts["downsample"][0])
+		}
+	}
+	return this, nil
+}
+
+func (this *intervalSink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *intervalSink) exportData(data *core.DataBatch) error {
+	// Out of band batches only cover a few nodes, and would break the interval.
+	if data.OutOfBand {
+		return nil
+	}
+	var result error
+	window := data.Timestamp.Truncate(this.interval)
+	for _, batch := range this.rawBatches(data, window) {
+		if err := tryExportData(this.DataSink, batch); err != nil {
+			result = err
+		}
+	}
+
+	this.accumulate(data)
+	if !this.window.IsZero() && !window.After(this.window) {
+		return result
+	}
+	this.window = window
+	batch := this.downsampled(data)
+	this.gauges = make(map[string]*gaugeStats)
+	if err := tryExportData(this.DataSink, batch); err != nil {
+		result = err
+	}
+	return result
+}
+
+// Returns a batch for every interval after the one of the last export and before the one of
+// the batch, with the latest raw sample of each metric set in that interval.
+func (this *intervalSink) rawBatches(data *core.DataBatch, window time.Time) []*core.DataBatch {
+	batches := make(map[time.Time]*core.DataBatch)
+	for key, ms := range data.MetricSets {
+		for _, sample := range ms.RawSamples {
+			sampleWindow := sample.Timestamp.Truncate(this.interval)
+			if !sampleWindow.After(this.window) || !sampleWindow.Before(window) {
+				continue
+			}
+			batch, found := batches[sampleWindow]
+			if !found {
+				batch = &core.DataBatch{
+					Timestamp:    sample.Timestamp,
+					MetricSets:   make(map[string]*core.MetricSet),
+					Completeness: data.Completeness,
+				}
+				batches[sampleWindow] = batch
+			}
+			if sample.Timestamp.After(batch.Timestamp) {
+				batch.Timestamp = sample.Timestamp
+			}
+			if previous, found := batch.MetricSets[key]; found && previous.ScrapeTime.After(sample.Timestamp) {
+				continue
+			}
+			batch.MetricSets[key] = &core.MetricSet{
+				CreateTime:   ms.CreateTime,
+				ScrapeTime:   sample.Timestamp,
+				Labels:       ms.Labels,
+				MetricValues: sample.MetricValues,
+			}
+		}
+	}
+
+	windows := make([]time.Time, 0, len(batches))
+	for sampleWindow := range batches {
+		windows = append(windows, sampleWindow)
+	}
+	sort.Sort(timestamps(windows))
+	result := make([]*core.DataBatch, 0, len(windows))
+	for _, sampleWindow := range windows {
+		result = append(result, batches[sampleWindow])
+		this.window = sampleWindow
+	}
+	return result
+}
+
+type timestamps []time.Time
+
+func (t timestamps) Len() int           { return len(t) }
+func (t timestamps) Less(i, j int) bool { return t[i].Before(t[j]) }
+func (t timestamps) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// Records the gauges of the batch, when they're downsampled.
+func (this *intervalSink) accumulate(data *core.DataBatch) {
+	if this.downsample == DownsampleLast {
+		return
+	}
+	record := func(key string, value core.MetricValue) {
+		current, ok := gaugeValue(value)
+		if !ok {
+			return
+		}
+		stats, found := this.gauges[key]
+		if !found {
+			stats = &gaugeStats{max: current}
+			this.gauges[key] = stats
+		}
+		stats.sum += current
+		stats.count++
+		if current > stats.max {
+			stats.max = current
+		}
+	}
+	for setKey, ms := range data.MetricSets {
+		for name, value := range ms.MetricValues {
+			record(setKey+"|"+name, value)
+		}
+		for i := range ms.LabeledMetrics {
+			record(setKey+"|"+labeledMetricKey(&ms.LabeledMetrics[i]), ms.LabeledMetrics[i].MetricValue)
+		}
+	}
+}
+
+// Returns the batch with the gauges downsampled, and without the raw samples unless the sink
+// accepts them.
+func (this *intervalSink) downsampled(data *core.DataBatch) *core.DataBatch {
+	if !acceptsRawSamples(this.DataSink) {
+		data = withoutRawSamples(data)
+	}
+	if this.downsample == DownsampleLast {
+		return data
+	}
+	result := &core.DataBatch{
+		Timestamp:    data.Timestamp,
+		MetricSets:   make(map[string]*core.MetricSet, len(data.MetricSets)),
+		Completeness: data.Completeness,
+	}
+	for setKey, ms := range data.MetricSets {
+		msCopy := *ms
+		msCopy.MetricValues = make(map[string]core.MetricValue, len(ms.MetricValues))
+		for name, value := range ms.MetricValues {
+			msCopy.MetricValues[name] = this.downsampledValue(setKey+"|"+name, value)
+		}
+		msCopy.LabeledMetrics = make([]core.LabeledMetric, 0, len(ms.LabeledMetrics))
+		for _, metric := range ms.LabeledMetrics {
+			metric.MetricValue = this.downsampledValue(setKey+"|"+labeledMetricKey(&metric), metric.MetricValue)
+			msCopy.LabeledMetrics = append(msCopy.LabeledMetrics, metric)
+		}
+		result.MetricSets[setKey] = &msCopy
+	}
+	return result
+}
+
+func (this *intervalSink) downsampledValue(key string, value core.MetricValue) core.MetricValue {
+	stats, found := this.gauges[key]
+	if !found || stats.count < 2 {
+		return value
+	}
+	downsampled := stats.max
+	if this.downsample == DownsampleAvg {
+		downsampled = stats.sum / float64(stats.count)
+	}
+	switch value.ValueType {
+	case core.ValueInt64:
+		value.IntValue = int64(math.Floor(downsampled + 0.5))
+	case core.ValueFloat:
+		value.FloatValue = float32(downsampled)
+	}
+	return value
+}
+
+// The raw samples of the batches are needed for the intervals shorter than the batches.
+func (this *intervalSink) AcceptsRawSamples() bool {
+	return true
+}
+
+func (this *intervalSink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func newTestIntervalSink(t *testing.T, sink core.DataSink, query string) core.DataSink {
+	uri, err := url.Parse("?" + query)
+	require.NoError(t, err)
+	wrapped, err := newIntervalSink(sink, uri)
+	require.NoError(t, err)
+	return wrapped
+}
+
+func memoryBatch(timestamp time.Time, usage int64) *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: timestamp,
+		MetricSets: map[string]*core.MetricSet{
+			"node:n1": {
+				MetricValues: map[string]core.MetricValue{
+					core.MetricCpuUsage.Name:    {MetricType: core.MetricCumulative, ValueType: core.ValueInt64, IntValue: usage},
+					core.MetricMemoryUsage.Name: {MetricType: core.MetricGauge, ValueType: core.ValueInt64, IntValue: usage},
+				},
+			},
+		},
+	}
+}
+
+func TestIntervalSinkDownsamples(t *testing.T) {
+	base := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		downsample string
+		memory     []int64
+	}{
+		{"", []int64{1, 5, 8}},
+		{"downsample=last", []int64{1, 5, 8}},
+		{"downsample=avg", []int64{1, 3, 7}},
+		{"downsample=max", []int64{1, 5, 8}},
+	} {
+		sink := &recordingSink{}
+		wrapped := newTestIntervalSink(t, sink, "pushinterval=5m&"+tc.downsample)
+		// Batches every minute, from 00:00 to 00:10.
+		for minute, usage := range []int64{1, 2, 3, 4, 0, 5, 6, 7, 8, 7, 8} {
+			wrapped.ExportData(memoryBatch(base.Add(time.Duration(minute)*time.Minute), usage))
+		}
+
+		require.Len(t, sink.batches, 3, tc.downsample)
+		for i, batch := range sink.batches {
+			assert.Equal(t, base.Add(time.Duration(5*i)*time.Minute), batch.Timestamp, tc.downsample)
+			metrics := batch.MetricSets["node:n1"].MetricValues
+			assert.Equal(t, tc.memory[i], metrics[core.MetricMemoryUsage.Name].IntValue, tc.downsample)
+			// Cumulative metrics keep their last value.
+			assert.Equal(t, []int64{1, 5, 8}[i], metrics[core.MetricCpuUsage.Name].IntValue, tc.downsample)
+		}
+	}
+}
+
+func TestIntervalSinkMaxDownsample(t *testing.T) {
+	base := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+	sink := &recordingSink{}
+	wrapped := newTestIntervalSink(t, sink, "pushinterval=5m&downsample=max")
+	for minute, usage := range []int64{1, 2, 9, 4, 3, 5} {
+		wrapped.ExportData(memoryBatch(base.Add(time.Duration(minute)*time.Minute), usage))
+	}
+
+	require.Len(t, sink.batches, 2)
+	metrics := sink.batches[1].MetricSets["node:n1"].MetricValues
+	// Batches from 00:01 to 00:05.
+	assert.Equal(t, int64(9), metrics[core.MetricMemoryUsage.Name].IntValue)
+	assert.Equal(t, int64(5), metrics[core.MetricCpuUsage.Name].IntValue)
+}
+
+func TestIntervalSinkRawSamples(t *testing.T) {
+	base := time.Date(2016, 10, 1, 0, 1, 0, 0, time.UTC)
+	sink := &recordingSink{}
+	wrapped := newTestIntervalSink(t, sink, "pushinterval=10s")
+	assert.True(t, wrapped.(core.RawSampleSink).AcceptsRawSamples())
+
+	batch := func(timestamp time.Time, seconds ...int) *core.DataBatch {
+		data := memoryBatch(timestamp, 0)
+		for _, second := range seconds {
+			data.MetricSets["node:n1"].RawSamples = append(data.MetricSets["node:n1"].RawSamples, core.RawSample{
+				Timestamp: base.Add(time.Duration(second) * time.Second),
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryUsage.Name: {MetricType: core.MetricGauge, ValueType: core.ValueInt64, IntValue: int64(second)},
+				},
+			})
+		}
+		return data
+	}
+	wrapped.ExportData(batch(base))
+	// Samples every 5 seconds over the minute. The first one is in the interval of the last
+	// export, and the last one in the interval of the batch.
+	wrapped.ExportData(batch(base.Add(time.Minute), 5, 10, 15, 20, 25, 30, 35, 40, 45, 50, 55, 60))
+
+	require.Len(t, sink.batches, 7)
+	assert.Equal(t, base, sink.batches[0].Timestamp)
+	for i, batch := range sink.batches[1:6] {
+		second := 10*i + 15
+		assert.Equal(t, base.Add(time.Duration(second)*time.Second), batch.Timestamp)
+		assert.Equal(t, int64(second), batch.MetricSets["node:n1"].MetricValues[core.MetricMemoryUsage.Name].IntValue)
+	}
+	// The sink doesn't accept raw samples.
+	assert.Equal(t, base.Add(time.Minute), sink.batches[6].Timestamp)
+	assert.Empty(t, sink.batches[6].MetricSets["node:n1"].RawSamples)
+}
@@ -15,71 +15,99 @@
 package kafka
 
 import (
+	"fmt"
 	"net/url"
+	"strings"
 	"sync"
-	"time"
 
 	"github.com/golang/glog"
 	kafka_common "k8s.io/heapster/common/kafka"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/encoding"
 )
 
-type KafkaSinkPoint struct {
-	MetricsName      string
-	MetricsValue     interface{}
-	MetricsTimestamp time.Time
-	MetricsTags      map[string]string
-}
+// The message format of the json format.
+type KafkaSinkPoint encoding.JsonPoint
 
 type kafkaSink struct {
 	kafka_common.KafkaClient
 	sync.RWMutex
+	encoder encoding.Encoder
+	// Returns the key of the message of a point, or an empty key to distribute the points
+	// across the partitions.
+	messageKey func(point *encoding.Point) string
+}
+
+// Returns the function building the message keys of the `partitionkey` option: namespace,
+// pod, node or label:<name>.
+func parseMessageKey(opts url.Values) (func(point *encoding.Point) string, error) {
+	if len(opts["partitionkey"]) == 0 {
+		return nil, nil
+	}
+	value := opts["partitionkey"][0]
+	switch {
+	case value == "namespace":
+		return func(point *encoding.Point) string {
+			return point.Labels[core.LabelNamespaceName.Key]
+		}, nil
+	case value == "pod":
+		return func(point *encoding.Point) string {
+			if point.Labels[core.LabelPodName.Key] == "" {
+				return ""
+			}
+			return point.Labels[core.LabelNamespaceName.Key] + "/" + point.Labels[core.LabelPodName.Key]
+		}, nil
+	case value == "node":
+		return func(point *encoding.Point) string {
+			return point.Labels[core.LabelNodename.Key]
+		}, nil
+	case strings.HasPrefix(value, "label:") && len(value) > len("label:"):
+		label := strings.TrimPrefix(value, "label:")
+		return func(point *encoding.Point) string {
+			return point.Labels[label]
+		}, nil
+	}
+	return nil, fmt.Errorf("failed to parse `partitionkey` flag - should be namespace, pod, node or label:<name>, got %q", value)
 }
 
 func (sink *kafkaSink) ExportData(dataBatch *core.DataBatch) {
 	sink.Lock()
 	defer sink.Unlock()
 
-	for _, metricSet := range dataBatch.MetricSets {
-		for metricName, metricValue := range metricSet.MetricValues {
-			point := KafkaSinkPoint{
-				MetricsName: metricName,
-				MetricsTags: metricSet.Labels,
-				MetricsValue: map[string]interface{}{
-					"value": metricValue.GetValue(),
-				},
-				MetricsTimestamp: dataBatch.Timestamp.UTC(),
-			}
-			err := sink.ProduceKafkaMessage(point)
-			if err != nil {
-				glog.Errorf("Failed to produce metric message: %s", err)
-			}
+	for _, point := range encoding.BatchPoints(dataBatch) {
+		msgData, err := sink.encoder.Encode(point)
+		if err != nil {
+			glog.Errorf("Failed to encode metric %s: %v", point.Name, err)
+			continue
 		}
-		for _, metric := range metricSet.LabeledMetrics {
-			labels := make(map[string]string)
-			for k, v := range metricSet.Labels {
-				labels[k] = v
-			}
-			for k, v := range metric.Labels {
-				labels[k] = v
-			}
-			point := KafkaSinkPoint{
-				MetricsName: metric.Name,
-				MetricsTags: labels,
-				MetricsValue: map[string]interface{}{
-					"value": metric.GetValue(),
-				},
-				MetricsTimestamp: dataBatch.Timestamp.UTC(),
-			}
-			err := sink.ProduceKafkaMessage(point)
-			if err != nil {
-				glog.Errorf("Failed to produce metric message: %s", err)
-			}
+		key := ""
+		if sink.messageKey != nil {
+			key = sink.messageKey(point)
+		}
+		if err := sink.ProduceKeyedKafkaMessage(key, msgData); err != nil {
+			glog.Errorf("Failed to produce metric message: %s", err)
 		}
 	}
 }
 
 func NewKafkaSink(uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	// Avro schemas are registered under the subject of the topic by default.
+	if len(opts["avrosubject"]) < 1 {
+		topic, err := kafka_common.GetTopic(opts, kafka_common.TimeSeriesTopic)
+		if err != nil {
+			return nil, err
+		}
+		opts.Set("avrosubject", topic+"-value")
+	}
+	encoder, err := encoding.NewEncoder(opts, encoding.FormatJson)
+	if err != nil {
+		return nil, err
+	}
+	messageKey, err := parseMessageKey(opts)
+	if err != nil {
+		return nil, err
+	}
 	client, err := kafka_common.NewKafkaClient(uri, kafka_common.TimeSeriesTopic)
 	if err != nil {
 		return nil, err
@@ -87,5 +115,7 @@ func NewKafkaSink(uri *url.URL) (core.DataSink, error) {
 
 	return &kafkaSink{
 		KafkaClient: client,
+		encoder:     encoder,
+		messageKey:  messageKey,
 	}, nil
 }
@@ -17,15 +17,20 @@ package kafka
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/encoding"
 )
 
 type fakeKafkaClient struct {
 	points []KafkaSinkPoint
+	keys   []string
 }
 
 type fakeKafkaSink struct {
@@ -34,17 +39,23 @@ type fakeKafkaSink struct {
 }
 
 func NewFakeKafkaClient() *fakeKafkaClient {
-	return &fakeKafkaClient{[]KafkaSinkPoint{}}
+	return &fakeKafkaClient{points: []KafkaSinkPoint{}}
 }
 
 func (client *fakeKafkaClient) ProduceKafkaMessage(msgData interface{}) error {
-	if point, ok := msgData.(KafkaSinkPoint); ok {
-		client.points = append(client.points, point)
+	point := KafkaSinkPoint{}
+	if err := json.Unmarshal(msgData.([]byte), &point); err != nil {
+		return err
 	}
-
+	client.points = append(client.points, point)
 	return nil
 }
 
+func (client *fakeKafkaClient) ProduceKeyedKafkaMessage(key string, msgData interface{}) error {
+	client.keys = append(client.keys, key)
+	return client.ProduceKafkaMessage(msgData)
+}
+
 func (client *fakeKafkaClient) Name() string {
 	return "Apache Kafka Sink"
 }
@@ -56,9 +67,11 @@ func (client *fakeKafkaClient) Stop() {
 // Returns a fake kafka sink.
 func NewFakeSink() fakeKafkaSink {
 	client := NewFakeKafkaClient()
+	encoder, _ := encoding.NewEncoder(url.Values{}, encoding.FormatJson)
 	return fakeKafkaSink{
 		&kafkaSink{
 			KafkaClient: client,
+			encoder:     encoder,
 		},
 		client,
 	}
@@ -191,3 +204,66 @@ func TestStoreMultipleDataInput(t *testing.T) {
 	}
 
 }
+
+func TestPartitionKey(t *testing.T) {
+	labels := map[string]string{
+		core.LabelNamespaceName.Key: "ns1",
+		core.LabelPodName.Key:       "p1",
+		core.LabelNodename.Key:      "n1",
+		"app":                       "web",
+	}
+	for _, tc := range []struct {
+		option string
+		key    string
+	}{
+		{"", ""},
+		{"partitionkey=namespace", "ns1"},
+		{"partitionkey=pod", "ns1/p1"},
+		{"partitionkey=node", "n1"},
+		{"partitionkey=label:app", "web"},
+		{"partitionkey=label:missing", ""},
+	} {
+		opts, err := url.ParseQuery(tc.option)
+		assert.NoError(t, err)
+		messageKey, err := parseMessageKey(opts)
+		assert.NoError(t, err)
+
+		fakeSink := NewFakeSink()
+		fakeSink.DataSink.(*kafkaSink).messageKey = messageKey
+		fakeSink.ExportData(&core.DataBatch{
+			Timestamp: time.Now(),
+			MetricSets: map[string]*core.MetricSet{
+				"namespace:ns1/pod:p1": {
+					Labels: labels,
+					MetricValues: map[string]core.MetricValue{
+						"memory/usage": {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1},
+					},
+				},
+			},
+		})
+		assert.Equal(t, []string{tc.key}, fakeSink.fakeProducer.keys, tc.option)
+	}
+
+	for _, option := range []string{"partitionkey=container", "partitionkey=label:"} {
+		opts, err := url.ParseQuery(option)
+		assert.NoError(t, err)
+		_, err = parseMessageKey(opts)
+		assert.Error(t, err, option)
+	}
+}
+
+func TestAvroSubjectOfTopic(t *testing.T) {
+	var paths []string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"id":42}`))
+	}))
+	defer registry.Close()
+
+	uri, err := url.Parse("?format=avro&timeseriestopic=metrics&schemaregistry=" + url.QueryEscape(registry.URL))
+	assert.NoError(t, err)
+	// Fails without brokers, once the encoder is created.
+	_, err = NewKafkaSink(uri)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"/subjects/metrics-value/versions"}, paths)
+}
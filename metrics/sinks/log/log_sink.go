@@ -36,7 +36,12 @@ func (this *LogSink) Stop() {
 
 func batchToString(batch *core.DataBatch) string {
 	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("DataBatch     Timestamp: %s\n\n", batch.Timestamp))
+	buffer.WriteString(fmt.Sprintf("DataBatch     Timestamp: %s\n", batch.Timestamp))
+	if c := batch.Completeness; c != nil {
+		buffer.WriteString(fmt.Sprintf("Completeness: nodes %d/%d, pods %d/%d, degraded: %t\n",
+			c.NodesScraped, c.NodesExpected, c.PodsCovered, c.PodsRunning, c.Degraded))
+	}
+	buffer.WriteString("\n")
 	for _, key := range sortedMetricSetKeys(batch.MetricSets) {
 		ms := batch.MetricSets[key]
 		buffer.WriteString(fmt.Sprintf("MetricSet: %s\n", key))
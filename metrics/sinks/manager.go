@@ -15,12 +15,14 @@
 package sinks
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util/accounting"
 )
 
 const (
@@ -61,12 +63,52 @@ type sinkHolder struct {
 	sink             core.DataSink
 	dataBatchChannel chan *core.DataBatch
 	stopChannel      chan bool
+	// Closed once the sink is stopped.
+	stopped  chan struct{}
+	stats    *sinkStats
+	priority string
+	// Nil if the circuit breakers are disabled.
+	breaker *circuitBreaker
+}
+
+// Starts the goroutine exporting the data pushed to the sink.
+func newSinkHolder(sink core.DataSink) sinkHolder {
+	priority := sinkPriority(sink)
+	sh := sinkHolder{
+		sink:             sink,
+		dataBatchChannel: make(chan *core.DataBatch),
+		stopChannel:      make(chan bool),
+		stopped:          make(chan struct{}),
+		stats:            newSinkStats(sink.Name(), priority),
+		priority:         priority,
+		breaker:          newCircuitBreaker(sink.Name()),
+	}
+	accounting.DefaultLedger.Go(accounting.SinkOwner(sink.Name()), func() {
+		for {
+			select {
+			case data := <-sh.dataBatchChannel:
+				err := export(sh.sink, sh.stats, data)
+				sh.breaker.record(time.Now(), err)
+			case isStop := <-sh.stopChannel:
+				glog.V(2).Infof("Stop received: %s", sh.sink.Name())
+				if isStop {
+					sh.sink.Stop()
+					close(sh.stopped)
+					return
+				}
+			}
+		}
+	})
+	return sh
 }
 
 // Sink Manager - a special sink that distributes data to other sinks. It pushes data
 // only to these sinks that completed their previous exports. Data that could not be
-// pushed in the defined time is dropped and not retried.
+// pushed in the export timeout, of the sink or else of the manager, is dropped and not retried. The high priority sinks get the
+// data before the others, and the low priority ones only if they are idle. The sinks whose
+// circuit breaker is open are skipped. Sinks can be added and removed while it runs.
 type sinkManager struct {
+	sync.RWMutex
 	sinkHolders       []sinkHolder
 	exportDataTimeout time.Duration
 	stopTimeout       time.Duration
@@ -75,26 +117,7 @@ type sinkManager struct {
 func NewDataSinkManager(sinks []core.DataSink, exportDataTimeout, stopTimeout time.Duration) (core.DataSink, error) {
 	sinkHolders := []sinkHolder{}
 	for _, sink := range sinks {
-		sh := sinkHolder{
-			sink:             sink,
-			dataBatchChannel: make(chan *core.DataBatch),
-			stopChannel:      make(chan bool),
-		}
-		sinkHolders = append(sinkHolders, sh)
-		go func(sh sinkHolder) {
-			for {
-				select {
-				case data := <-sh.dataBatchChannel:
-					export(sh.sink, data)
-				case isStop := <-sh.stopChannel:
-					glog.V(2).Infof("Stop received: %s", sh.sink.Name())
-					if isStop {
-						sh.sink.Stop()
-						return
-					}
-				}
-			}
-		}(sh)
+		sinkHolders = append(sinkHolders, newSinkHolder(sink))
 	}
 	return &sinkManager{
 		sinkHolders:       sinkHolders,
@@ -103,36 +126,169 @@ func NewDataSinkManager(sinks []core.DataSink, exportDataTimeout, stopTimeout ti
 	}, nil
 }
 
-// Guarantees that the export will complete in sinkExportDataTimeout.
+// Starts pushing data to the sink, with the next batch.
+func (this *sinkManager) addSink(sink core.DataSink) {
+	sh := newSinkHolder(sink)
+	this.Lock()
+	defer this.Unlock()
+	// The slice is replaced rather than appended to, as exports may be iterating over it.
+	sinkHolders := make([]sinkHolder, 0, len(this.sinkHolders)+1)
+	sinkHolders = append(sinkHolders, this.sinkHolders...)
+	this.sinkHolders = append(sinkHolders, sh)
+}
+
+// Stops pushing data to the sink and stops it, once its current export completes. Waits for
+// the sink to stop, so that it flushes its data before a replacement starts, at most for
+// the stop timeout.
+func (this *sinkManager) removeSink(sink core.DataSink) {
+	this.Lock()
+	var removed []sinkHolder
+	sinkHolders := make([]sinkHolder, 0, len(this.sinkHolders))
+	for _, sh := range this.sinkHolders {
+		if sh.sink == sink {
+			removed = append(removed, sh)
+		} else {
+			sinkHolders = append(sinkHolders, sh)
+		}
+	}
+	this.sinkHolders = sinkHolders
+	this.Unlock()
+
+	for _, sh := range removed {
+		timeout := time.After(this.stopTimeout)
+		select {
+		case sh.stopChannel <- true:
+		case <-timeout:
+			glog.Warningf("Failed to stop sink: %s", sh.sink.Name())
+			continue
+		}
+		select {
+		case <-sh.stopped:
+			glog.V(2).Infof("Stopped sink: %s", sh.sink.Name())
+		case <-timeout:
+			glog.Warningf("Sink %s didn't stop in %v", sh.sink.Name(), this.stopTimeout)
+		}
+	}
+}
+
+func (this *sinkManager) holders() []sinkHolder {
+	this.RLock()
+	defer this.RUnlock()
+	return this.sinkHolders
+}
+
+// Guarantees that the export will complete in the longest export timeout of the sinks, for each
+// priority class.
 func (this *sinkManager) ExportData(data *core.DataBatch) {
+	rawSamples := hasRawSamples(data)
+	histograms := hasHistograms(data)
+	stripped := make(map[sinkDataKey]*core.DataBatch)
+	sinkData := func(sh sinkHolder) *core.DataBatch {
+		key := sinkDataKey{
+			rawSamples: rawSamples && acceptsRawSamples(sh.sink),
+			histograms: histograms && acceptsHistograms(sh.sink),
+		}
+		if key.rawSamples == rawSamples && key.histograms == histograms {
+			return data
+		}
+		if _, found := stripped[key]; !found {
+			stripped[key] = stripBatch(data, key)
+		}
+		return stripped[key]
+	}
+
+	sinkHolders := this.holders()
 	var wg sync.WaitGroup
-	for _, sh := range this.sinkHolders {
-		wg.Add(1)
-		go func(sh sinkHolder, wg *sync.WaitGroup) {
-			defer wg.Done()
-			glog.V(2).Infof("Pushing data to: %s", sh.sink.Name())
-			select {
-			case sh.dataBatchChannel <- data:
-				glog.V(2).Infof("Data push completed: %s", sh.sink.Name())
-				// everything ok
-			case <-time.After(this.exportDataTimeout):
-				glog.Warningf("Failed to push data to sink: %s", sh.sink.Name())
-			}
-		}(sh, &wg)
+	// The latency critical sinks don't wait for the batches of the others to be prepared and pushed.
+	for _, sh := range sinkHolders {
+		if sh.priority == PriorityHigh {
+			this.push(sh, sinkData(sh), &wg)
+		}
+	}
+	wg.Wait()
+	for _, sh := range sinkHolders {
+		switch sh.priority {
+		case PriorityHigh:
+		case PriorityLow:
+			offer(sh, sinkData(sh))
+		default:
+			this.push(sh, sinkData(sh), &wg)
+		}
 	}
 	// Wait for all pushes to complete or timeout.
 	wg.Wait()
 }
 
+// Pushes the batch to the sink, waiting for it to complete its previous export at most for the
+// export timeout.
+func (this *sinkManager) push(sh sinkHolder, sinkData *core.DataBatch, wg *sync.WaitGroup) {
+	if !allowed(sh, sinkData) {
+		return
+	}
+	timeout := sinkExportTimeout(sh.sink, this.exportDataTimeout)
+	wg.Add(1)
+	accounting.DefaultLedger.Go(accounting.SinkOwner(sh.sink.Name()), func() {
+		defer wg.Done()
+		glog.V(2).Infof("Pushing data to: %s", sh.sink.Name())
+		select {
+		case sh.dataBatchChannel <- sinkData:
+			glog.V(2).Infof("Data push completed: %s", sh.sink.Name())
+			// everything ok
+		case <-time.After(timeout):
+			glog.Warningf("Failed to push data to sink: %s", sh.sink.Name())
+			sh.stats.dropped(batchPoints(sinkData))
+			// A sink still busy with its previous export after the timeout is failing too,
+			// whether it reports its failures or not.
+			sh.breaker.record(time.Now(), fmt.Errorf("sink %s still busy after %v", sh.sink.Name(), timeout))
+		}
+	})
+}
+
+// Pushes the batch to the sink only if it is idle.
+func offer(sh sinkHolder, sinkData *core.DataBatch) {
+	if !allowed(sh, sinkData) {
+		return
+	}
+	select {
+	case sh.dataBatchChannel <- sinkData:
+		glog.V(2).Infof("Data push completed: %s", sh.sink.Name())
+	default:
+		glog.V(2).Infof("Skipping busy low priority sink: %s", sh.sink.Name())
+		sh.stats.dropped(batchPoints(sinkData))
+	}
+}
+
+// Returns whether the circuit breaker of the sink lets the batch through, dropping it otherwise.
+func allowed(sh sinkHolder, sinkData *core.DataBatch) bool {
+	if sh.breaker.allow(time.Now()) {
+		return true
+	}
+	glog.V(2).Infof("Skipping sink with an open circuit breaker: %s", sh.sink.Name())
+	sh.stats.dropped(batchPoints(sinkData))
+	return false
+}
+
+func (this *sinkManager) Stats() []SinkStats {
+	sinkHolders := this.holders()
+	result := make([]SinkStats, 0, len(sinkHolders))
+	for _, sh := range sinkHolders {
+		stats := sh.stats.get()
+		stats.CircuitBreaker = sh.breaker.get()
+		result = append(result, stats)
+	}
+	return result
+}
+
 func (this *sinkManager) Name() string {
 	return "Manager"
 }
 
 func (this *sinkManager) Stop() {
-	for _, sh := range this.sinkHolders {
+	for _, sh := range this.holders() {
 		glog.V(2).Infof("Running stop for: %s", sh.sink.Name())
 
-		go func(sh sinkHolder) {
+		sh := sh
+		accounting.DefaultLedger.Go(accounting.SinkOwner(sh.sink.Name()), func() {
 			select {
 			case sh.stopChannel <- true:
 				// everything ok
@@ -142,11 +298,123 @@ func (this *sinkManager) Stop() {
 				glog.Warningf("Failed to stop sink: %s", sh.sink.Name())
 			}
 			return
-		}(sh)
+		})
+	}
+}
+
+// Describes which optional data is kept in the batch passed to a sink.
+type sinkDataKey struct {
+	rawSamples bool
+	histograms bool
+}
+
+func stripBatch(data *core.DataBatch, keep sinkDataKey) *core.DataBatch {
+	if !keep.rawSamples {
+		data = withoutRawSamples(data)
+	}
+	if !keep.histograms {
+		data = withoutHistograms(data)
+	}
+	return data
+}
+
+func acceptsHistograms(s core.DataSink) bool {
+	histogramSink, ok := s.(core.HistogramSink)
+	return ok && histogramSink.AcceptsHistograms()
+}
+
+func hasHistograms(data *core.DataBatch) bool {
+	for _, ms := range data.MetricSets {
+		if metricSetHasHistograms(ms) {
+			return true
+		}
+	}
+	return false
+}
+
+func metricSetHasHistograms(ms *core.MetricSet) bool {
+	for _, value := range ms.MetricValues {
+		if value.ValueType == core.ValueHistogram {
+			return true
+		}
+	}
+	for _, metric := range ms.LabeledMetrics {
+		if metric.ValueType == core.ValueHistogram {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a shallow copy of the batch without histogram values, for sinks which
+// can't store them.
+func withoutHistograms(data *core.DataBatch) *core.DataBatch {
+	result := &core.DataBatch{
+		Timestamp:    data.Timestamp,
+		MetricSets:   make(map[string]*core.MetricSet, len(data.MetricSets)),
+		Completeness: data.Completeness,
+		OutOfBand:    data.OutOfBand,
+	}
+	for key, ms := range data.MetricSets {
+		if !metricSetHasHistograms(ms) {
+			result.MetricSets[key] = ms
+			continue
+		}
+		msCopy := *ms
+		msCopy.MetricValues = make(map[string]core.MetricValue, len(ms.MetricValues))
+		for name, value := range ms.MetricValues {
+			if value.ValueType != core.ValueHistogram {
+				msCopy.MetricValues[name] = value
+			}
+		}
+		msCopy.LabeledMetrics = make([]core.LabeledMetric, 0, len(ms.LabeledMetrics))
+		for _, metric := range ms.LabeledMetrics {
+			if metric.ValueType != core.ValueHistogram {
+				msCopy.LabeledMetrics = append(msCopy.LabeledMetrics, metric)
+			}
+		}
+		result.MetricSets[key] = &msCopy
+	}
+	return result
+}
+
+func acceptsRawSamples(s core.DataSink) bool {
+	rawSampleSink, ok := s.(core.RawSampleSink)
+	return ok && rawSampleSink.AcceptsRawSamples()
+}
+
+func hasRawSamples(data *core.DataBatch) bool {
+	for _, ms := range data.MetricSets {
+		if len(ms.RawSamples) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a shallow copy of the batch without raw samples, so that sinks which don't use them
+// (in particular the in-memory metric sink) don't keep them alive.
+func withoutRawSamples(data *core.DataBatch) *core.DataBatch {
+	result := &core.DataBatch{
+		Timestamp:    data.Timestamp,
+		MetricSets:   make(map[string]*core.MetricSet, len(data.MetricSets)),
+		Completeness: data.Completeness,
+		OutOfBand:    data.OutOfBand,
+	}
+	for key, ms := range data.MetricSets {
+		if len(ms.RawSamples) == 0 {
+			result.MetricSets[key] = ms
+			continue
+		}
+		msCopy := *ms
+		msCopy.RawSamples = nil
+		result.MetricSets[key] = &msCopy
 	}
+	return result
 }
 
-func export(s core.DataSink, data *core.DataBatch) {
+// Returns the error reported by the sink, if any.
+func export(s core.DataSink, stats *sinkStats, data *core.DataBatch) error {
 	startTime := time.Now()
 	defer lastExportTimestamp.
 		WithLabelValues(s.Name()).
@@ -155,5 +423,8 @@ func export(s core.DataSink, data *core.DataBatch) {
 		WithLabelValues(s.Name()).
 		Observe(float64(time.Since(startTime)) / float64(time.Microsecond))
 
-	s.ExportData(data)
+	// The sinks log the reasons of their failures.
+	err := tryExportData(s, data)
+	stats.exported(batchPoints(data), time.Since(startTime), err)
+	return err
 }
@@ -129,3 +129,63 @@ func TestStop(t *testing.T) {
 	assert.Equal(t, true, sink1.IsStopped())
 	assert.Equal(t, true, sink2.IsStopped())
 }
+
+func TestWithoutRawSamples(t *testing.T) {
+	now := time.Now()
+	batch := core.DataBatch{
+		Timestamp: now,
+		MetricSets: map[string]*core.MetricSet{
+			"m1": {
+				MetricValues: map[string]core.MetricValue{"m": {IntValue: 2}},
+				RawSamples: []core.RawSample{
+					{Timestamp: now.Add(-time.Second), MetricValues: map[string]core.MetricValue{"m": {IntValue: 1}}},
+					{Timestamp: now, MetricValues: map[string]core.MetricValue{"m": {IntValue: 2}}},
+				},
+			},
+			"m2": {
+				MetricValues: map[string]core.MetricValue{"m": {IntValue: 3}},
+			},
+		},
+	}
+	assert.True(t, hasRawSamples(&batch))
+
+	stripped := withoutRawSamples(&batch)
+	assert.False(t, hasRawSamples(stripped))
+	assert.Equal(t, now, stripped.Timestamp)
+	assert.Equal(t, int64(2), stripped.MetricSets["m1"].MetricValues["m"].IntValue)
+	assert.Equal(t, batch.MetricSets["m2"], stripped.MetricSets["m2"])
+	// The original batch is left untouched.
+	assert.Len(t, batch.MetricSets["m1"].RawSamples, 2)
+}
+
+func TestWithoutHistograms(t *testing.T) {
+	histogram := &core.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 2}, Sum: 5, Count: 3}
+	batch := core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			"m1": {
+				MetricValues: map[string]core.MetricValue{
+					"m": {IntValue: 2},
+					"h": {ValueType: core.ValueHistogram, HistogramValue: histogram},
+				},
+				LabeledMetrics: []core.LabeledMetric{
+					{Name: "l", MetricValue: core.MetricValue{IntValue: 1}},
+					{Name: "lh", MetricValue: core.MetricValue{ValueType: core.ValueHistogram, HistogramValue: histogram}},
+				},
+			},
+			"m2": {
+				MetricValues: map[string]core.MetricValue{"m": {IntValue: 3}},
+			},
+		},
+	}
+	assert.True(t, hasHistograms(&batch))
+
+	stripped := withoutHistograms(&batch)
+	assert.False(t, hasHistograms(stripped))
+	assert.Equal(t, map[string]core.MetricValue{"m": {IntValue: 2}}, stripped.MetricSets["m1"].MetricValues)
+	assert.Len(t, stripped.MetricSets["m1"].LabeledMetrics, 1)
+	assert.Equal(t, batch.MetricSets["m2"], stripped.MetricSets["m2"])
+	// The original batch is left untouched.
+	assert.Len(t, batch.MetricSets["m1"].MetricValues, 2)
+	assert.Len(t, batch.MetricSets["m1"].LabeledMetrics, 2)
+}
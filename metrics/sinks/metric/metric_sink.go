@@ -15,59 +15,104 @@
 package metric
 
 import (
+	"hash/fnv"
 	"sync"
 	"time"
 
 	"k8s.io/heapster/metrics/core"
 )
 
+// Number of shards the per-entity storage is split into.
+const metricSinkShards = 32
+
 // A simple in-memory storage for metrics. It divides metrics into 2 categories
 // * metrics that need to be stored for couple minutes.
 // * metrics that need to be stored for longer time (15 min, 1 hour).
 // The user of this struct needs to decide what are the long-stored metrics upfront.
+//
+// Per-entity data is sharded by the MetricSet key. The content of the sink is never modified
+// once published: ExportData builds new versions of the shards the batch touches, or that hold
+// expired data, reuses the others and publishes them all at once in a new state, so readers
+// see either the whole batch or none of it and hold the lock only to pick up the current state.
 type MetricSink struct {
-	// Request can come from other threads.
-	lock sync.Mutex
+	// Serializes writers.
+	exportLock sync.Mutex
 
 	// List of metrics that will be stored for up to X seconds.
 	longStoreMetrics   []string
 	longStoreDuration  time.Duration
 	shortStoreDuration time.Duration
 
+	// Guards state.
+	lock  sync.RWMutex
+	state *metricSinkState
+}
+
+type metricSinkState struct {
 	// Stores full DataBatch with all metrics and labels.
 	shortStore []*core.DataBatch
-	// Memory-efficient long/mid term storage for metrics.
-	longStore []*multimetricStore
+
+	shards [metricSinkShards]*metricSinkShard
 }
 
-// Stores values of a single metrics for different MetricSets.
-// Assumes that the user knows what the metric is.
-type int64Store map[string]int64
+type metricSinkShard struct {
+	// MetricSets from the short store, by key, oldest first.
+	shortStore map[string][]timestampedMetricSet
+	// Memory-efficient long/mid term storage for metrics, by key, oldest first.
+	longStore map[string][]timestampedInt64Values
+	// Timestamps of the oldest entries of the stores, zero if they are empty.
+	oldestShort time.Time
+	oldestLong  time.Time
+}
 
-type multimetricStore struct {
+type timestampedMetricSet struct {
+	// Timestamp of the batch from which the metric set was taken.
+	timestamp time.Time
+	metricSet *core.MetricSet
+}
+
+type timestampedInt64Values struct {
 	// Timestamp of the batch from which the metrics were taken.
 	timestamp time.Time
-	// Metric name to int64store with metric values.
-	store map[string]int64Store
+	// Metric name to value.
+	values map[string]int64
 }
 
-func buildMultimetricStore(metrics []string, batch *core.DataBatch) *multimetricStore {
-	store := multimetricStore{
-		timestamp: batch.Timestamp,
-		store:     make(map[string]int64Store, len(metrics)),
-	}
-	for _, metric := range metrics {
-		store.store[metric] = make(int64Store, len(batch.MetricSets))
-	}
-	for key, ms := range batch.MetricSets {
-		for _, metric := range metrics {
-			if metricValue, found := ms.MetricValues[metric]; found {
-				metricstore := store.store[metric]
-				metricstore[key] = metricValue.IntValue
-			}
+func shardIndex(key string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % metricSinkShards)
+}
+
+func newMetricSinkState() *metricSinkState {
+	state := &metricSinkState{shortStore: make([]*core.DataBatch, 0)}
+	for i := range state.shards {
+		state.shards[i] = &metricSinkShard{
+			shortStore: make(map[string][]timestampedMetricSet),
+			longStore:  make(map[string][]timestampedInt64Values),
 		}
 	}
-	return &store
+	return state
+}
+
+func (this *metricSinkState) shard(key string) *metricSinkShard {
+	return this.shards[shardIndex(key)]
+}
+
+func (this *MetricSink) current() *metricSinkState {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.state
+}
+
+func (this *MetricSink) publish(state *metricSinkState) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.state = state
+}
+
+func (this *MetricSink) shard(key string) *metricSinkShard {
+	return this.current().shard(key)
 }
 
 func (this *MetricSink) Name() string {
@@ -79,41 +124,147 @@ func (this *MetricSink) Stop() {
 }
 
 func (this *MetricSink) ExportData(batch *core.DataBatch) {
-	this.lock.Lock()
-	defer this.lock.Unlock()
+	this.exportLock.Lock()
+	defer this.exportLock.Unlock()
 
 	now := time.Now()
+	shortCutoff := now.Add(-this.shortStoreDuration)
+	longCutoff := now.Add(-this.longStoreDuration)
+
 	// TODO: add sorting
-	this.longStore = append(popOldStore(this.longStore, now.Add(-this.longStoreDuration)),
-		buildMultimetricStore(this.longStoreMetrics, batch))
-	this.shortStore = append(popOld(this.shortStore, now.Add(-this.shortStoreDuration)), batch)
+	state := this.current()
+	newState := &metricSinkState{
+		shortStore: popOld(state.shortStore, shortCutoff),
+		shards:     state.shards,
+	}
+	// Out of band batches only add samples to the metrics of their entities, the latest
+	// batch has to cover the whole cluster.
+	if !batch.OutOfBand {
+		newState.shortStore = append(newState.shortStore, batch)
+	}
+
+	var batchKeys [metricSinkShards][]string
+	for key := range batch.MetricSets {
+		index := shardIndex(key)
+		batchKeys[index] = append(batchKeys[index], key)
+	}
+	for i, shard := range state.shards {
+		shortExpired := expired(shard.oldestShort, shortCutoff)
+		longExpired := expired(shard.oldestLong, longCutoff)
+		if len(batchKeys[i]) == 0 && !shortExpired && !longExpired {
+			continue
+		}
+		newState.shards[i] = shard.update(batch, batchKeys[i], this.longStoreMetrics,
+			shortExpired, shortCutoff, longExpired, longCutoff)
+	}
+	this.publish(newState)
 }
 
-func (this *MetricSink) GetLatestDataBatch() *core.DataBatch {
-	this.lock.Lock()
-	defer this.lock.Unlock()
+// Whether the store whose oldest entry has the given timestamp holds entries to pop.
+func expired(oldest, cutoff time.Time) bool {
+	return !oldest.IsZero() && !oldest.After(cutoff)
+}
+
+// Returns the earlier of the timestamps, ignoring the zero one.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// Builds a new version of the shard with the metric sets of the batch and without the expired
+// entries. The stores that have nothing expired are only copied.
+func (this *metricSinkShard) update(batch *core.DataBatch, keys []string, longStoreMetrics []string,
+	shortExpired bool, shortCutoff time.Time, longExpired bool, longCutoff time.Time) *metricSinkShard {
+	result := &metricSinkShard{
+		shortStore: make(map[string][]timestampedMetricSet, len(this.shortStore)+len(keys)),
+		longStore:  make(map[string][]timestampedInt64Values, len(this.longStore)+len(keys)),
+	}
+	if shortExpired {
+		for key, metricSets := range this.shortStore {
+			if filtered := popOldMetricSets(metricSets, shortCutoff); len(filtered) > 0 {
+				result.shortStore[key] = filtered
+				for _, stored := range filtered {
+					result.oldestShort = earliest(result.oldestShort, stored.timestamp)
+				}
+			}
+		}
+	} else {
+		for key, metricSets := range this.shortStore {
+			result.shortStore[key] = metricSets
+		}
+		result.oldestShort = this.oldestShort
+	}
+	if longExpired {
+		for key, values := range this.longStore {
+			if filtered := popOldValues(values, longCutoff); len(filtered) > 0 {
+				result.longStore[key] = filtered
+				for _, stored := range filtered {
+					result.oldestLong = earliest(result.oldestLong, stored.timestamp)
+				}
+			}
+		}
+	} else {
+		for key, values := range this.longStore {
+			result.longStore[key] = values
+		}
+		result.oldestLong = this.oldestLong
+	}
 
-	if len(this.shortStore) == 0 {
+	for _, key := range keys {
+		ms := batch.MetricSets[key]
+		// The stored slices may be shared with the previous version, append to a copy.
+		metricSets := result.shortStore[key]
+		result.shortStore[key] = append(metricSets[:len(metricSets):len(metricSets)], timestampedMetricSet{
+			timestamp: batch.Timestamp,
+			metricSet: ms,
+		})
+		result.oldestShort = earliest(result.oldestShort, batch.Timestamp)
+		values := make(map[string]int64)
+		for _, metric := range longStoreMetrics {
+			if metricValue, found := ms.MetricValues[metric]; found {
+				values[metric] = metricValue.IntValue
+			}
+		}
+		if len(values) > 0 {
+			stored := result.longStore[key]
+			result.longStore[key] = append(stored[:len(stored):len(stored)], timestampedInt64Values{
+				timestamp: batch.Timestamp,
+				values:    values,
+			})
+			result.oldestLong = earliest(result.oldestLong, batch.Timestamp)
+		}
+	}
+	return result
+}
+
+func (this *metricSinkShard) getShortStore(key string) []timestampedMetricSet {
+	return this.shortStore[key]
+}
+
+func (this *metricSinkShard) getLongStore(key string) []timestampedInt64Values {
+	return this.longStore[key]
+}
+
+func (this *MetricSink) GetLatestDataBatch() *core.DataBatch {
+	shortStore := this.current().shortStore
+	if len(shortStore) == 0 {
 		return nil
 	}
-	return this.shortStore[len(this.shortStore)-1]
+	return shortStore[len(shortStore)-1]
 }
 
 func (this *MetricSink) GetShortStore() []*core.DataBatch {
-	this.lock.Lock()
-	defer this.lock.Unlock()
-
-	result := make([]*core.DataBatch, 0, len(this.shortStore))
-	for _, batch := range this.shortStore {
+	shortStore := this.current().shortStore
+	result := make([]*core.DataBatch, 0, len(shortStore))
+	for _, batch := range shortStore {
 		result = append(result, batch)
 	}
 	return result
 }
 
 func (this *MetricSink) GetMetric(metricName string, keys []string, start, end time.Time) map[string][]core.TimestampedMetricValue {
-	this.lock.Lock()
-	defer this.lock.Unlock()
-
 	useLongStore := false
 	for _, longStoreMetric := range this.longStoreMetrics {
 		if longStoreMetric == metricName {
@@ -121,48 +272,38 @@ func (this *MetricSink) GetMetric(metricName string, keys []string, start, end t
 		}
 	}
 
+	state := this.current()
 	result := make(map[string][]core.TimestampedMetricValue)
-	if useLongStore {
-		for _, store := range this.longStore {
-			// Inclusive start and end.
-			if !store.timestamp.Before(start) && !store.timestamp.After(end) {
-				substore := store.store[metricName]
-				for _, key := range keys {
-					if val, found := substore[key]; found {
-						result[key] = append(result[key], core.TimestampedMetricValue{
-							Timestamp: store.timestamp,
-							MetricValue: core.MetricValue{
-								IntValue:   val,
-								ValueType:  core.ValueInt64,
-								MetricType: core.MetricGauge,
-							},
-						})
-					}
+	for _, key := range keys {
+		shard := state.shard(key)
+		if useLongStore {
+			for _, stored := range shard.getLongStore(key) {
+				// Inclusive start and end.
+				if stored.timestamp.Before(start) || stored.timestamp.After(end) {
+					continue
+				}
+				if val, found := stored.values[metricName]; found {
+					result[key] = append(result[key], core.TimestampedMetricValue{
+						Timestamp: stored.timestamp,
+						MetricValue: core.MetricValue{
+							IntValue:   val,
+							ValueType:  core.ValueInt64,
+							MetricType: core.MetricGauge,
+						},
+					})
 				}
 			}
-		}
-	} else {
-		for _, batch := range this.shortStore {
-			// Inclusive start and end.
-			if !batch.Timestamp.Before(start) && !batch.Timestamp.After(end) {
-				for _, key := range keys {
-					metricSet, found := batch.MetricSets[key]
-					if !found {
-						continue
-					}
-					metricValue, found := metricSet.MetricValues[metricName]
-					if !found {
-						continue
-					}
-					keyResult, found := result[key]
-					if !found {
-						keyResult = make([]core.TimestampedMetricValue, 0)
-					}
-					keyResult = append(keyResult, core.TimestampedMetricValue{
-						Timestamp:   batch.Timestamp,
+		} else {
+			for _, stored := range shard.getShortStore(key) {
+				// Inclusive start and end.
+				if stored.timestamp.Before(start) || stored.timestamp.After(end) {
+					continue
+				}
+				if metricValue, found := stored.metricSet.MetricValues[metricName]; found {
+					result[key] = append(result[key], core.TimestampedMetricValue{
+						Timestamp:   stored.timestamp,
 						MetricValue: metricValue,
 					})
-					result[key] = keyResult
 				}
 			}
 		}
@@ -172,39 +313,37 @@ func (this *MetricSink) GetMetric(metricName string, keys []string, start, end t
 
 func (this *MetricSink) GetLabeledMetric(metricName string, labels map[string]string, keys []string, start, end time.Time) map[string][]core.TimestampedMetricValue {
 	// NB: the long store doesn't store labeled metrics, so it's not relevant here
+	state := this.current()
 	result := make(map[string][]core.TimestampedMetricValue)
-	for _, batch := range this.shortStore {
-		// Inclusive start and end
-		if !batch.Timestamp.Before(start) && !batch.Timestamp.After(end) {
-			for _, key := range keys {
-				metricSet, found := batch.MetricSets[key]
-				if !found {
+	for _, key := range keys {
+		for _, stored := range state.shard(key).getShortStore(key) {
+			// Inclusive start and end
+			if stored.timestamp.Before(start) || stored.timestamp.After(end) {
+				continue
+			}
+
+			for _, labeledMetric := range stored.metricSet.LabeledMetrics {
+				if labeledMetric.Name != metricName {
 					continue
 				}
 
-				for _, labeledMetric := range metricSet.LabeledMetrics {
-					if labeledMetric.Name != metricName {
-						continue
-					}
-
-					if len(labeledMetric.Labels) != len(labels) {
-						continue
-					}
+				if len(labeledMetric.Labels) != len(labels) {
+					continue
+				}
 
-					labelsMatch := true
-					for k, v := range labels {
-						if lblMetricVal, ok := labeledMetric.Labels[k]; !ok || lblMetricVal != v {
-							labelsMatch = false
-							break
-						}
+				labelsMatch := true
+				for k, v := range labels {
+					if lblMetricVal, ok := labeledMetric.Labels[k]; !ok || lblMetricVal != v {
+						labelsMatch = false
+						break
 					}
+				}
 
-					if labelsMatch {
-						result[key] = append(result[key], core.TimestampedMetricValue{
-							Timestamp:   batch.Timestamp,
-							MetricValue: labeledMetric.MetricValue,
-						})
-					}
+				if labelsMatch {
+					result[key] = append(result[key], core.TimestampedMetricValue{
+						Timestamp:   stored.timestamp,
+						MetricValue: labeledMetric.MetricValue,
+					})
 				}
 			}
 		}
@@ -214,15 +353,10 @@ func (this *MetricSink) GetLabeledMetric(metricName string, labels map[string]st
 }
 
 func (this *MetricSink) GetMetricNames(key string) []string {
-	this.lock.Lock()
-	defer this.lock.Unlock()
-
 	metricNames := make(map[string]bool)
-	for _, batch := range this.shortStore {
-		if set, found := batch.MetricSets[key]; found {
-			for key := range set.MetricValues {
-				metricNames[key] = true
-			}
+	for _, stored := range this.shard(key).getShortStore(key) {
+		for key := range stored.metricSet.MetricValues {
+			metricNames[key] = true
 		}
 	}
 	result := make([]string, 0, len(metricNames))
@@ -234,15 +368,13 @@ func (this *MetricSink) GetMetricNames(key string) []string {
 
 func (this *MetricSink) getAllNames(predicate func(ms *core.MetricSet) bool,
 	name func(key string, ms *core.MetricSet) string) []string {
-	this.lock.Lock()
-	defer this.lock.Unlock()
-
-	if len(this.shortStore) == 0 {
+	latest := this.GetLatestDataBatch()
+	if latest == nil {
 		return []string{}
 	}
 
 	result := make([]string, 0, 0)
-	for key, value := range this.shortStore[len(this.shortStore)-1].MetricSets {
+	for key, value := range latest.MetricSets {
 		if predicate(value) {
 			result = append(result, name(key, value))
 		}
@@ -259,9 +391,19 @@ func (this *MetricSink) GetMetricSetKeys() []string {
 		func(key string, ms *core.MetricSet) string { return key })
 }
 
-func (this *MetricSink) GetNodes() []string {
+// Tells whether the metric set belongs to the federated cluster, the primary one if empty.
+func inCluster(ms *core.MetricSet, cluster string) bool {
+	if core.IsPrimaryCluster(cluster) {
+		return core.IsPrimaryCluster(ms.Labels[core.LabelClusterName.Key])
+	}
+	return ms.Labels[core.LabelClusterName.Key] == cluster
+}
+
+func (this *MetricSink) GetNodes(cluster string) []string {
 	return this.getAllNames(
-		func(ms *core.MetricSet) bool { return ms.Labels[core.LabelMetricSetType.Key] == core.MetricSetTypeNode },
+		func(ms *core.MetricSet) bool {
+			return ms.Labels[core.LabelMetricSetType.Key] == core.MetricSetTypeNode && inCluster(ms, cluster)
+		},
 		func(key string, ms *core.MetricSet) string { return ms.Labels[core.LabelHostname.Key] })
 }
 
@@ -273,42 +415,42 @@ func (this *MetricSink) GetPods() []string {
 		})
 }
 
-func (this *MetricSink) GetNamespaces() []string {
+func (this *MetricSink) GetNamespaces(cluster string) []string {
 	return this.getAllNames(
 		func(ms *core.MetricSet) bool {
-			return ms.Labels[core.LabelMetricSetType.Key] == core.MetricSetTypeNamespace
+			return ms.Labels[core.LabelMetricSetType.Key] == core.MetricSetTypeNamespace && inCluster(ms, cluster)
 		},
 		func(key string, ms *core.MetricSet) string { return ms.Labels[core.LabelNamespaceName.Key] })
 }
 
-func (this *MetricSink) GetPodsFromNamespace(namespace string) []string {
+func (this *MetricSink) GetPodsFromNamespace(cluster, namespace string) []string {
 	return this.getAllNames(
 		func(ms *core.MetricSet) bool {
 			return ms.Labels[core.LabelMetricSetType.Key] == core.MetricSetTypePod &&
-				ms.Labels[core.LabelNamespaceName.Key] == namespace
+				ms.Labels[core.LabelNamespaceName.Key] == namespace && inCluster(ms, cluster)
 		},
 		func(key string, ms *core.MetricSet) string {
 			return ms.Labels[core.LabelPodName.Key]
 		})
 }
 
-func (this *MetricSink) GetContainersForPodFromNamespace(namespace, pod string) []string {
+func (this *MetricSink) GetContainersForPodFromNamespace(cluster, namespace, pod string) []string {
 	return this.getAllNames(
 		func(ms *core.MetricSet) bool {
 			return ms.Labels[core.LabelMetricSetType.Key] == core.MetricSetTypePodContainer &&
 				ms.Labels[core.LabelNamespaceName.Key] == namespace &&
-				ms.Labels[core.LabelPodName.Key] == pod
+				ms.Labels[core.LabelPodName.Key] == pod && inCluster(ms, cluster)
 		},
 		func(key string, ms *core.MetricSet) string {
 			return ms.Labels[core.LabelContainerName.Key]
 		})
 }
 
-func (this *MetricSink) GetSystemContainersFromNode(node string) []string {
+func (this *MetricSink) GetSystemContainersFromNode(cluster, node string) []string {
 	return this.getAllNames(
 		func(ms *core.MetricSet) bool {
 			return ms.Labels[core.LabelMetricSetType.Key] == core.MetricSetTypeSystemContainer &&
-				ms.Labels[core.LabelHostname.Key] == node
+				ms.Labels[core.LabelHostname.Key] == node && inCluster(ms, cluster)
 		},
 		func(key string, ms *core.MetricSet) string {
 			return ms.Labels[core.LabelContainerName.Key]
@@ -325,11 +467,21 @@ func popOld(storage []*core.DataBatch, cutoffTime time.Time) []*core.DataBatch {
 	return result
 }
 
-func popOldStore(storages []*multimetricStore, cutoffTime time.Time) []*multimetricStore {
-	result := make([]*multimetricStore, 0, len(storages))
-	for _, store := range storages {
-		if store.timestamp.After(cutoffTime) {
-			result = append(result, store)
+func popOldMetricSets(storage []timestampedMetricSet, cutoffTime time.Time) []timestampedMetricSet {
+	result := make([]timestampedMetricSet, 0, len(storage)+1)
+	for _, stored := range storage {
+		if stored.timestamp.After(cutoffTime) {
+			result = append(result, stored)
+		}
+	}
+	return result
+}
+
+func popOldValues(storage []timestampedInt64Values, cutoffTime time.Time) []timestampedInt64Values {
+	result := make([]timestampedInt64Values, 0, len(storage)+1)
+	for _, stored := range storage {
+		if stored.timestamp.After(cutoffTime) {
+			result = append(result, stored)
 		}
 	}
 	return result
@@ -340,7 +492,6 @@ func NewMetricSink(shortStoreDuration, longStoreDuration time.Duration, longStor
 		longStoreMetrics:   longStoreMetrics,
 		longStoreDuration:  longStoreDuration,
 		shortStoreDuration: shortStoreDuration,
-		longStore:          make([]*multimetricStore, 0),
-		shortStore:         make([]*core.DataBatch, 0),
+		state:              newMetricSinkState(),
 	}
 }
@@ -15,6 +15,8 @@
 package metric
 
 import (
+	"bytes"
+	"sort"
 	"testing"
 	"time"
 
@@ -186,6 +188,86 @@ func TestGetMetrics(t *testing.T) {
 	assert.Contains(t, metricNames, "m2")
 }
 
+func TestOutOfBandBatch(t *testing.T) {
+	now := time.Now()
+	key := core.PodKey("ns1", "pod1")
+	otherKey := core.PodKey("ns1", "other")
+
+	_, _, batch3 := makeBatches(now, key, otherKey)
+	outOfBand := core.DataBatch{
+		Timestamp: now.Add(-10 * time.Second),
+		MetricSets: map[string]*core.MetricSet{
+			key: {
+				MetricValues: map[string]core.MetricValue{
+					"m1": {
+						ValueType:  core.ValueInt64,
+						MetricType: core.MetricGauge,
+						IntValue:   50,
+					},
+				},
+			},
+		},
+		OutOfBand: true,
+	}
+
+	metrics := NewMetricSink(45*time.Second, 120*time.Second, []string{"m1"})
+	metrics.ExportData(&batch3)
+	metrics.ExportData(&outOfBand)
+
+	// The samples are kept, but the latest batch stays the last regular one.
+	result := metrics.GetMetric("m1", []string{key}, now.Add(-120*time.Second), now)
+	assert.Equal(t, 2, len(result[key]))
+	assert.Equal(t, int64(50), result[key][1].MetricValue.IntValue)
+	assert.Equal(t, batch3.Timestamp, metrics.GetLatestDataBatch().Timestamp)
+	assert.Equal(t, 1, len(metrics.GetShortStore()))
+}
+
+func TestExportDataUpdatesTouchedShards(t *testing.T) {
+	now := time.Now()
+	key := core.PodKey("ns1", "pod1")
+	otherKey := core.PodKey("ns1", "other")
+	newBatch := func(timestamp time.Time, outOfBand bool, keys ...string) *core.DataBatch {
+		batch := &core.DataBatch{
+			Timestamp:  timestamp,
+			MetricSets: map[string]*core.MetricSet{},
+			OutOfBand:  outOfBand,
+		}
+		for _, key := range keys {
+			batch.MetricSets[key] = &core.MetricSet{
+				MetricValues: map[string]core.MetricValue{
+					"m1": {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1},
+				},
+			}
+		}
+		return batch
+	}
+
+	metrics := NewMetricSink(45*time.Second, 120*time.Second, []string{"m1"})
+	metrics.ExportData(newBatch(now.Add(-20*time.Second), false, key, otherKey))
+	before := metrics.current()
+	metrics.ExportData(newBatch(now.Add(-10*time.Second), true, key))
+	after := metrics.current()
+
+	for i := range after.shards {
+		if i == shardIndex(key) {
+			assert.True(t, before.shards[i] != after.shards[i])
+		} else {
+			assert.True(t, before.shards[i] == after.shards[i], "shard %d was rebuilt", i)
+		}
+	}
+	// The published state is left alone.
+	assert.Equal(t, 1, len(before.shard(key).getShortStore(key)))
+	assert.Equal(t, 2, len(after.shard(key).getShortStore(key)))
+
+	// Shards holding expired data are rebuilt without it even if the batch doesn't touch them.
+	metrics = NewMetricSink(45*time.Second, 120*time.Second, []string{"m1"})
+	metrics.ExportData(newBatch(now.Add(-150*time.Second), false, otherKey))
+	metrics.ExportData(newBatch(now.Add(-10*time.Second), true, key))
+	assert.Equal(t, 0, len(metrics.shard(otherKey).getShortStore(otherKey)))
+	assert.Equal(t, 0, len(metrics.shard(otherKey).getLongStore(otherKey)))
+	assert.Equal(t, 1, len(metrics.shard(key).getLongStore(key)))
+}
+
 func TestGetLabeledMetrics(t *testing.T) {
 	now := time.Now().UTC()
 	key := core.PodKey("ns1", "pod1")
@@ -263,8 +345,125 @@ func TestGetNames(t *testing.T) {
 
 	assert.Contains(t, metrics.GetPods(), "ns1/pod1")
 	assert.Contains(t, metrics.GetPods(), "ns2/pod2")
-	assert.Contains(t, metrics.GetPodsFromNamespace("ns1"), "pod1")
-	assert.NotContains(t, metrics.GetPodsFromNamespace("ns1"), "pod2")
+	assert.Contains(t, metrics.GetPodsFromNamespace("", "ns1"), "pod1")
+	assert.NotContains(t, metrics.GetPodsFromNamespace("", "ns1"), "pod2")
 	assert.Contains(t, metrics.GetMetricSetKeys(), key)
 	assert.Contains(t, metrics.GetMetricSetKeys(), otherKey)
 }
+
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	now := time.Now()
+	key := core.PodKey("ns1", "pod1")
+	otherKey := core.PodKey("ns1", "other")
+	batch1, batch2, batch3 := makeBatches(now, key, otherKey)
+
+	metrics := NewMetricSink(45*time.Second, 120*time.Second, []string{"m1"})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			metrics.ExportData(&batch1)
+			metrics.ExportData(&batch2)
+			metrics.ExportData(&batch3)
+		}
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		metrics.GetMetric("m1", []string{key, otherKey}, now.Add(-120*time.Second), now)
+		metrics.GetMetric("m2", []string{key}, now.Add(-120*time.Second), now)
+		metrics.GetLabeledMetric("somelblmetric", map[string]string{"lbl1": "val1.1", "lbl2": "val2.1"}, []string{key}, now.Add(-120*time.Second), now)
+		metrics.GetMetricNames(key)
+		metrics.GetPods()
+	}
+
+	assert.Equal(t, int64(20), metrics.GetLatestDataBatch().MetricSets[key].MetricValues["m1"].IntValue)
+	// Only batch3 is within the short store window.
+	for _, value := range metrics.GetMetric("m2", []string{key}, now.Add(-120*time.Second), now)[key] {
+		assert.Equal(t, int64(222), value.IntValue)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	now := time.Now()
+	key := core.PodKey("ns1", "pod1")
+	otherKey := core.PodKey("ns1", "other")
+
+	batch1, batch2, batch3 := makeBatches(now, key, otherKey)
+
+	metrics := NewMetricSink(45*time.Second, 120*time.Second, []string{"m1"})
+	metrics.ExportData(&batch1)
+	metrics.ExportData(&batch2)
+	metrics.ExportData(&batch3)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, metrics.WriteSnapshot(buf))
+
+	// A sink with a shorter long store drops the older values of the snapshot.
+	restored := NewMetricSink(45*time.Second, 30*time.Second, []string{"m1"})
+	timestamp, err := restored.RestoreSnapshot(buf)
+	assert.NoError(t, err)
+	assert.False(t, timestamp.Before(now))
+
+	assert.Equal(t, len(metrics.GetShortStore()), len(restored.GetShortStore()))
+	assert.Equal(t, batch3.Timestamp.Unix(), restored.GetLatestDataBatch().Timestamp.Unix())
+	keys, restoredKeys := metrics.GetMetricSetKeys(), restored.GetMetricSetKeys()
+	sort.Strings(keys)
+	sort.Strings(restoredKeys)
+	assert.Equal(t, keys, restoredKeys)
+	result := restored.GetMetric("m1", []string{key}, now.Add(-120*time.Second), now)
+	assert.Equal(t, 1, len(result[key]))
+	assert.Equal(t, int64(20), result[key][0].MetricValue.IntValue)
+	assert.Equal(t, int64(222), restored.GetMetric("m2", []string{key}, now.Add(-120*time.Second), now)[key][0].MetricValue.IntValue)
+	assert.Equal(t, 2, len(restored.GetLabeledMetric("somelblmetric", map[string]string{"lbl1": "val1.2", "lbl2": "val2.1"}, []string{key}, now.Add(-120*time.Second), now)[key])+
+		len(restored.GetLabeledMetric("somelblmetric", map[string]string{"lbl1": "val1.1", "lbl2": "val2.1"}, []string{key}, now.Add(-120*time.Second), now)[key]))
+
+	// Exports continue on top of the restored model.
+	batch4 := batch3
+	batch4.Timestamp = now.Add(-10 * time.Second)
+	restored.ExportData(&batch4)
+	assert.Equal(t, 2, len(restored.GetMetric("m1", []string{key}, now.Add(-120*time.Second), now)[key]))
+
+	_, err = restored.RestoreSnapshot(bytes.NewReader([]byte("not a snapshot")))
+	assert.Error(t, err)
+}
+
+func TestRelabelHistory(t *testing.T) {
+	now := time.Now()
+	key := core.PodKey("ns1", "pod1")
+	otherKey := core.PodKey("ns1", "other")
+
+	batch1, batch2, batch3 := makeBatches(now, key, otherKey)
+	batch1.MetricSets[key].Labels = map[string]string{"team": "platfrom"}
+	batch2.MetricSets[key].Labels = map[string]string{"team": "platfrom"}
+
+	metrics := NewMetricSink(time.Hour, time.Hour, []string{"m1"})
+	metrics.ExportData(&batch1)
+	metrics.ExportData(&batch2)
+	metrics.ExportData(&batch3)
+	before := metrics.GetShortStore()
+
+	count := metrics.RelabelHistory(func(ms *core.MetricSet) *core.MetricSet {
+		if ms.Labels["team"] != "platfrom" {
+			return nil
+		}
+		result := *ms
+		result.Labels = map[string]string{"team": "platform"}
+		return &result
+	})
+	assert.Equal(t, 2, count)
+
+	// The metric sets already handed out are left alone.
+	assert.Equal(t, "platfrom", before[0].MetricSets[key].Labels["team"])
+
+	after := metrics.GetShortStore()
+	assert.Equal(t, "platform", after[0].MetricSets[key].Labels["team"])
+	assert.Equal(t, "platform", after[1].MetricSets[key].Labels["team"])
+	assert.Equal(t, before[2], after[2])
+	for _, ms := range metrics.shard(key).getShortStore(key)[:2] {
+		assert.Equal(t, "platform", ms.metricSet.Labels["team"])
+	}
+}
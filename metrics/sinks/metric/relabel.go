@@ -0,0 +1,97 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"k8s.io/heapster/metrics/core"
+)
+
+// RelabelHistory replaces the stored metric sets for which relabel returns a corrected copy.
+// Metric sets are replaced rather than modified, as readers use them without holding a lock.
+// Returns the number of metric sets corrected.
+func (this *MetricSink) RelabelHistory(relabel func(*core.MetricSet) *core.MetricSet) int {
+	this.exportLock.Lock()
+	defer this.exportLock.Unlock()
+
+	corrected := make(map[*core.MetricSet]*core.MetricSet)
+	correct := func(metricSet *core.MetricSet) *core.MetricSet {
+		if result, found := corrected[metricSet]; found {
+			return result
+		}
+		result := relabel(metricSet)
+		if result == nil {
+			result = metricSet
+		}
+		corrected[metricSet] = result
+		return result
+	}
+
+	state := this.current()
+	newState := &metricSinkState{shortStore: make([]*core.DataBatch, 0, len(state.shortStore))}
+	for _, batch := range state.shortStore {
+		var copied *core.DataBatch
+		for key, metricSet := range batch.MetricSets {
+			result := correct(metricSet)
+			if result == metricSet {
+				continue
+			}
+			if copied == nil {
+				copied = &core.DataBatch{
+					Timestamp:    batch.Timestamp,
+					MetricSets:   make(map[string]*core.MetricSet, len(batch.MetricSets)),
+					Completeness: batch.Completeness,
+					OutOfBand:    batch.OutOfBand,
+				}
+				for k, v := range batch.MetricSets {
+					copied.MetricSets[k] = v
+				}
+			}
+			copied.MetricSets[key] = result
+		}
+		if copied == nil {
+			copied = batch
+		}
+		newState.shortStore = append(newState.shortStore, copied)
+	}
+
+	for i, shard := range state.shards {
+		newShard := &metricSinkShard{
+			shortStore:  make(map[string][]timestampedMetricSet, len(shard.shortStore)),
+			longStore:   shard.longStore,
+			oldestShort: shard.oldestShort,
+			oldestLong:  shard.oldestLong,
+		}
+		for key, metricSets := range shard.shortStore {
+			relabeled := make([]timestampedMetricSet, 0, len(metricSets))
+			for _, metricSet := range metricSets {
+				relabeled = append(relabeled, timestampedMetricSet{
+					timestamp: metricSet.timestamp,
+					metricSet: correct(metricSet.metricSet),
+				})
+			}
+			newShard.shortStore[key] = relabeled
+		}
+		newState.shards[i] = newShard
+	}
+	this.publish(newState)
+
+	count := 0
+	for metricSet, result := range corrected {
+		if metricSet != result {
+			count++
+		}
+	}
+	return count
+}
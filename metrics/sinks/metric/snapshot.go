@@ -0,0 +1,108 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+	"time"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// Snapshot is the content of the metric sink, saved to restore the model of a new heapster.
+type Snapshot struct {
+	Timestamp  time.Time
+	ShortStore []*core.DataBatch
+	LongStore  map[string][]SnapshotValues
+}
+
+type SnapshotValues struct {
+	Timestamp time.Time
+	Values    map[string]int64
+}
+
+// WriteSnapshot writes the content of the sink gzip compressed.
+func (this *MetricSink) WriteSnapshot(w io.Writer) error {
+	state := this.current()
+	snapshot := &Snapshot{
+		Timestamp:  time.Now(),
+		ShortStore: state.shortStore,
+		LongStore:  make(map[string][]SnapshotValues),
+	}
+	for _, shard := range state.shards {
+		for key, stored := range shard.longStore {
+			values := make([]SnapshotValues, 0, len(stored))
+			for _, value := range stored {
+				values = append(values, SnapshotValues{Timestamp: value.timestamp, Values: value.values})
+			}
+			snapshot.LongStore[key] = values
+		}
+	}
+
+	compressed := gzip.NewWriter(w)
+	if err := gob.NewEncoder(compressed).Encode(snapshot); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// RestoreSnapshot replaces the content of the sink by a snapshot written by WriteSnapshot,
+// without the data that is too old to be stored anymore. Returns the time of the snapshot.
+func (this *MetricSink) RestoreSnapshot(r io.Reader) (time.Time, error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return time.Time{}, err
+	}
+	snapshot := &Snapshot{}
+	if err := gob.NewDecoder(compressed).Decode(snapshot); err != nil {
+		return time.Time{}, err
+	}
+
+	this.exportLock.Lock()
+	defer this.exportLock.Unlock()
+
+	now := time.Now()
+	shortStore := popOld(snapshot.ShortStore, now.Add(-this.shortStoreDuration))
+	longCutoff := now.Add(-this.longStoreDuration)
+
+	state := newMetricSinkState()
+	state.shortStore = shortStore
+	for _, batch := range shortStore {
+		for key, metricSet := range batch.MetricSets {
+			shard := state.shard(key)
+			shard.shortStore[key] = append(shard.shortStore[key], timestampedMetricSet{
+				timestamp: batch.Timestamp,
+				metricSet: metricSet,
+			})
+			shard.oldestShort = earliest(shard.oldestShort, batch.Timestamp)
+		}
+	}
+	for key, values := range snapshot.LongStore {
+		shard := state.shard(key)
+		for _, value := range values {
+			if value.Timestamp.After(longCutoff) {
+				shard.longStore[key] = append(shard.longStore[key], timestampedInt64Values{
+					timestamp: value.Timestamp,
+					values:    value.Values,
+				})
+				shard.oldestLong = earliest(shard.oldestLong, value.Timestamp)
+			}
+		}
+	}
+	this.publish(state)
+	return snapshot.Timestamp, nil
+}
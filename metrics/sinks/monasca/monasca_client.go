@@ -24,6 +24,8 @@ import (
 	"net/url"
 
 	"github.com/golang/glog"
+
+	"k8s.io/heapster/common/transport"
 )
 
 // Client specifies the methods of any client ot the Monasca API
@@ -80,7 +82,7 @@ func (monClient *ClientImpl) prepareRequest(method string, path string, request
 }
 
 func (monClient *ClientImpl) receiveResponse(req *http.Request) (int, string, error) {
-	resp, err := (&http.Client{}).Do(req)
+	resp, err := transport.NewClient(0).Do(req)
 	if err != nil {
 		return 0, "", err
 	}
@@ -0,0 +1,166 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentsdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	opentsdbclient "github.com/bluebreezecf/opentsdb-goclient/client"
+)
+
+const (
+	protocolHttp   = "http"
+	protocolTelnet = "telnet"
+	dialTimeout    = 5 * time.Second
+	requestTimeout = 30 * time.Second
+)
+
+// httpClient writes the data points in a single request to the `/api/put` endpoint of the
+// HTTP API, authenticating with basic auth or a bearer token if configured.
+type httpClient struct {
+	client   *http.Client
+	endpoint string
+	username string
+	password string
+	token    string
+	gzip     bool
+}
+
+func (this *httpClient) do(method, path string, body io.Reader, gzipped bool) (*http.Response, error) {
+	req, err := http.NewRequest(method, this.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if this.username != "" {
+		req.SetBasicAuth(this.username, this.password)
+	} else if this.token != "" {
+		req.Header.Set("Authorization", "Bearer "+this.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return this.client.Do(req)
+}
+
+func (this *httpClient) Ping() error {
+	resp, err := this.do("GET", "/api/version", nil, false)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status of %s/api/version: %s", this.endpoint, resp.Status)
+	}
+	return nil
+}
+
+func (this *httpClient) Put(datapoints []opentsdbclient.DataPoint, queryParam string) (*opentsdbclient.PutResponse, error) {
+	var body bytes.Buffer
+	if this.gzip {
+		writer := gzip.NewWriter(&body)
+		if err := json.NewEncoder(writer).Encode(datapoints); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	} else if err := json.NewEncoder(&body).Encode(datapoints); err != nil {
+		return nil, err
+	}
+
+	path := "/api/put"
+	if queryParam != "" {
+		path += "?" + queryParam
+	}
+	resp, err := this.do("POST", path, &body, this.gzip)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	putResp := &opentsdbclient.PutResponse{StatusCode: resp.StatusCode}
+	if len(content) > 0 {
+		// Failed puts are described in the body, whose format is only known with a summary.
+		if err := json.Unmarshal(content, putResp); err != nil && resp.StatusCode/100 == 2 {
+			return nil, fmt.Errorf("failed to parse the response of %s/api/put: %v", this.endpoint, err)
+		}
+	}
+	if resp.StatusCode/100 != 2 {
+		return putResp, fmt.Errorf("failed to put %d data points (%d failed): %s", len(datapoints), putResp.Failed, resp.Status)
+	}
+	return putResp, nil
+}
+
+// telnetClient writes the data points as `put` lines on a connection to the telnet API.
+type telnetClient struct {
+	address string
+}
+
+func (this *telnetClient) Ping() error {
+	conn, err := net.DialTimeout("tcp", this.address, dialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Formats a data point in the telnet style, e.g. `put sys.cpu.user 1356998400 42.5 host=webserver01`.
+func telnetLine(datapoint *opentsdbclient.DataPoint) string {
+	keys := make([]string, 0, len(datapoint.Tags))
+	for key := range datapoint.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make([]string, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, key+"="+datapoint.Tags[key])
+	}
+	return fmt.Sprintf("put %s %d %v %s\n", datapoint.Metric, datapoint.Timestamp, datapoint.Value, strings.Join(tags, " "))
+}
+
+// The telnet API doesn't acknowledge the data points, so the response only counts the
+// ones written to the connection.
+func (this *telnetClient) Put(datapoints []opentsdbclient.DataPoint, queryParam string) (*opentsdbclient.PutResponse, error) {
+	conn, err := net.DialTimeout("tcp", this.address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var lines bytes.Buffer
+	for i := range datapoints {
+		lines.WriteString(telnetLine(&datapoints[i]))
+	}
+	conn.SetWriteDeadline(time.Now().Add(requestTimeout))
+	if _, err := conn.Write(lines.Bytes()); err != nil {
+		return nil, err
+	}
+	return &opentsdbclient.PutResponse{StatusCode: http.StatusOK, Success: int64(len(datapoints))}, nil
+}
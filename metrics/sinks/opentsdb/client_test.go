@@ -0,0 +1,176 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentsdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	opentsdb "github.com/bluebreezecf/opentsdb-goclient/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// An OpenTSDB HTTP API recording the put data points and the authorization of the requests.
+type fakeHttpApi struct {
+	puts           [][]opentsdb.DataPoint
+	authorizations []string
+	gzipped        bool
+}
+
+func (this *fakeHttpApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.authorizations = append(this.authorizations, r.Header.Get("Authorization"))
+	switch r.URL.Path {
+	case "/api/version":
+		w.Write([]byte(`{"version":"2.3.0"}`))
+	case "/api/put":
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			this.gzipped = true
+			reader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = reader
+		}
+		datapoints := []opentsdb.DataPoint{}
+		if err := json.NewDecoder(body).Decode(&datapoints); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		this.puts = append(this.puts, datapoints)
+		json.NewEncoder(w).Encode(&opentsdb.PutResponse{Success: int64(len(datapoints))})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newHttpSink(t *testing.T, server *httptest.Server, options string) *openTSDBSink {
+	uri, err := url.Parse(server.URL + "?" + options)
+	require.NoError(t, err)
+	sink, err := CreateOpenTSDBSink(uri)
+	require.NoError(t, err)
+	return sink.(*openTSDBSink)
+}
+
+func TestHttpClient(t *testing.T) {
+	api := &fakeHttpApi{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	sink := newHttpSink(t, server, "username=heapster&password=secret&chunksize=3&gzip=true")
+	batch := generateFakeBatch()
+	sink.ExportData(batch)
+
+	// The 8 data points are written in chunks of 3.
+	require.Len(t, api.puts, 3)
+	assert.Len(t, api.puts[0], 3)
+	assert.Len(t, api.puts[1], 3)
+	assert.Len(t, api.puts[2], 2)
+	assert.True(t, api.gzipped)
+	for _, authorization := range api.authorizations {
+		assert.Equal(t, "Basic aGVhcHN0ZXI6c2VjcmV0", authorization)
+	}
+	assert.Contains(t, sink.getState(), "Number of write failures: 0")
+
+	api = &fakeHttpApi{}
+	server.Config.Handler = api
+	sink = newHttpSink(t, server, "token=abc")
+	sink.ExportData(batch)
+	require.Len(t, api.puts, 1)
+	assert.Len(t, api.puts[0], len(batch.MetricSets))
+	assert.False(t, api.gzipped)
+	assert.Equal(t, "Bearer abc", api.authorizations[0])
+}
+
+func TestHttpClientFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/put" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"failed":8,"success":0,"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	sink := newHttpSink(t, server, "")
+	resp, err := sink.client.Put([]opentsdb.DataPoint{{Metric: "m", Timestamp: 1, Value: 1, Tags: map[string]string{"a": "b"}}}, "")
+	assert.Error(t, err)
+	assert.Equal(t, int64(8), resp.Failed)
+
+	sink.ExportData(generateFakeBatch())
+	assert.Contains(t, sink.getState(), "Number of write failures: 1")
+}
+
+func TestTelnetClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	lines := make(chan []string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		received := []string{}
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			received = append(received, scanner.Text())
+		}
+		lines <- received
+	}()
+
+	uri, err := url.Parse("//" + listener.Addr().String() + "?protocol=telnet")
+	require.NoError(t, err)
+	sink, err := CreateOpenTSDBSink(uri)
+	require.NoError(t, err)
+	_, err = sink.(*openTSDBSink).client.Put([]opentsdb.DataPoint{
+		{Metric: "cpu_usage_cumulative", Timestamp: 1475280000, Value: int64(42), Tags: map[string]string{"pod_name": "redis", "container_name": "redis"}},
+		{Metric: "cpu_usage_rate_gauge", Timestamp: 1475280000, Value: float32(0.5), Tags: map[string]string{"pod_name": "redis"}},
+	}, opentsdb.PutRespWithSummary)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"put cpu_usage_cumulative 1475280000 42 container_name=redis pod_name=redis",
+		"put cpu_usage_rate_gauge 1475280000 0.5 pod_name=redis",
+	}, <-lines)
+}
+
+func TestCreateOpenTSDBSinkWithOptions(t *testing.T) {
+	for _, options := range []string{"protocol=udp", "chunksize=0", "gzip=maybe", "username=a&token=b"} {
+		_, err := CreateOpenTSDBSink(&url.URL{Host: "localhost:4242", RawQuery: options})
+		assert.Error(t, err, options)
+	}
+
+	sink, err := CreateOpenTSDBSink(&url.URL{Scheme: "https", Host: "opentsdb.example.com", RawQuery: "chunksize=50"})
+	require.NoError(t, err)
+	tsdbSink := sink.(*openTSDBSink)
+	assert.Equal(t, 50, tsdbSink.chunkSize)
+	assert.Equal(t, "https://opentsdb.example.com", tsdbSink.client.(*httpClient).endpoint)
+}
+
+func TestToValidOpenTsdbName(t *testing.T) {
+	assert.Equal(t, "app_web_version_1.0", toValidOpenTsdbName("app:web,version=1.0"))
+	assert.Equal(t, "kube-system/dns", toValidOpenTsdbName("kube-system/dns"))
+	assert.Equal(t, "équipe_données", toValidOpenTsdbName("équipe données"))
+	assert.Equal(t, "a_b", toValidOpenTsdbName("a\"b"))
+}
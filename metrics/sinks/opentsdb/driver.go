@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +27,7 @@ import (
 	opentsdbclient "github.com/bluebreezecf/opentsdb-goclient/client"
 	opentsdbcfg "github.com/bluebreezecf/opentsdb-goclient/config"
 	"github.com/golang/glog"
+	"k8s.io/heapster/common/transport"
 	"k8s.io/heapster/metrics/core"
 )
 
@@ -37,12 +39,12 @@ const (
 	opentsdbSinkName    = "OpenTSDB Sink"
 	sinkRegisterName    = "opentsdb"
 	defaultOpentsdbHost = "127.0.0.1:4242"
-	batchSize           = 1000
+	defaultChunkSize    = 1000
 )
 
 var (
 	// Matches any disallowed character in OpenTSDB names.
-	disallowedCharsRegexp = regexp.MustCompile("[^[:alnum:]\\-_\\./]")
+	disallowedCharsRegexp = regexp.MustCompile("[^\\p{L}\\p{N}\\-_\\./]")
 )
 
 // openTSDBClient defines the minimal methods which will be used to
@@ -57,6 +59,21 @@ type openTSDBSink struct {
 	sync.RWMutex
 	writeFailures int
 	config        opentsdbcfg.OpenTSDBConfig
+	// Maximum number of data points written at once, the default one if not positive.
+	chunkSize int
+}
+
+func (tsdbSink *openTSDBSink) put(dataPoints []opentsdbclient.DataPoint) bool {
+	resp, err := tsdbSink.client.Put(dataPoints, opentsdbclient.PutRespWithSummary)
+	if err != nil {
+		glog.Errorf("failed to write metrics to opentsdb - %v", err)
+		tsdbSink.recordWriteFailure()
+		return false
+	}
+	if resp.Failed > 0 {
+		glog.Warningf("opentsdb rejected %d of %d data points", resp.Failed, len(dataPoints))
+	}
+	return true
 }
 
 func (tsdbSink *openTSDBSink) ExportData(data *core.DataBatch) {
@@ -64,28 +81,24 @@ func (tsdbSink *openTSDBSink) ExportData(data *core.DataBatch) {
 		glog.Warningf("Failed to ping opentsdb: %v", err)
 		return
 	}
-	dataPoints := make([]opentsdbclient.DataPoint, 0, batchSize)
+	chunkSize := tsdbSink.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	dataPoints := make([]opentsdbclient.DataPoint, 0, chunkSize)
 	for _, metricSet := range data.MetricSets {
 		for metricName, metricValue := range metricSet.MetricValues {
 			dataPoints = append(dataPoints, tsdbSink.metricToPoint(metricName, metricValue, data.Timestamp, metricSet.Labels))
-			if len(dataPoints) >= batchSize {
-				_, err := tsdbSink.client.Put(dataPoints, opentsdbclient.PutRespWithSummary)
-				if err != nil {
-					glog.Errorf("failed to write metrics to opentsdb - %v", err)
-					tsdbSink.recordWriteFailure()
+			if len(dataPoints) >= chunkSize {
+				if !tsdbSink.put(dataPoints) {
 					return
 				}
-				dataPoints = make([]opentsdbclient.DataPoint, 0, batchSize)
+				dataPoints = make([]opentsdbclient.DataPoint, 0, chunkSize)
 			}
 		}
 	}
-	if len(dataPoints) >= 0 {
-		_, err := tsdbSink.client.Put(dataPoints, opentsdbclient.PutRespWithSummary)
-		if err != nil {
-			glog.Errorf("failed to write metrics to opentsdb - %v", err)
-			tsdbSink.recordWriteFailure()
-			return
-		}
+	if len(dataPoints) > 0 {
+		tsdbSink.put(dataPoints)
 	}
 }
 
@@ -110,6 +123,7 @@ func (tsdbSink *openTSDBSink) Stop() {
 // accepted by OpenTSDB. As the OpenTSDB documentation states:
 // 'Metric names, tag names and tag values have to be made of alpha numeric
 // characters, dash "-", underscore "_", period ".", and forward slash "/".'
+// Unicode letters and digits are accepted as well.
 func toValidOpenTsdbName(name string) (validName string) {
 	// This takes care of some cases where dash "-" characters were
 	// encoded as '\\x2d' in received Timeseries Points
@@ -156,8 +170,6 @@ func (tsdbSink *openTSDBSink) metricToPoint(name string, value core.MetricValue,
 // current datapoint. Otherwise, the opentsdb will return error and the operation of putting
 // datapoint will be failed.
 func (tsdbSink *openTSDBSink) secureTags(datapoint *opentsdbclient.DataPoint) {
-
-	glog.Warningf("%#v", datapoint)
 	if len(datapoint.Tags) == 0 {
 		datapoint.Tags[defaultTagName] = defaultTagValue
 	}
@@ -183,16 +195,58 @@ func (tsdbSink *openTSDBSink) setupClient() error {
 	return nil
 }
 
-func new(opentsdbHost string) (*openTSDBSink, error) {
-	cfg := opentsdbcfg.OpenTSDBConfig{OpentsdbHost: opentsdbHost}
-	opentsdbClient, err := opentsdbclient.NewClient(cfg)
-	if err != nil {
-		return nil, err
+func new(opentsdbHost string, scheme string, opts url.Values) (*openTSDBSink, error) {
+	tsdbSink := &openTSDBSink{
+		config:    opentsdbcfg.OpenTSDBConfig{OpentsdbHost: opentsdbHost},
+		chunkSize: defaultChunkSize,
+	}
+	if len(opts["chunksize"]) >= 1 {
+		chunkSize, err := strconv.Atoi(opts["chunksize"][0])
+		if err != nil || chunkSize <= 0 {
+			return nil, fmt.Errorf("failed to parse `chunksize` flag - should be a positive integer, got %q", opts["chunksize"][0])
+		}
+		tsdbSink.chunkSize = chunkSize
 	}
-	return &openTSDBSink{
-		client: opentsdbClient,
-		config: cfg,
-	}, nil
+
+	protocol := protocolHttp
+	if len(opts["protocol"]) >= 1 {
+		protocol = opts["protocol"][0]
+	}
+	switch protocol {
+	case protocolHttp:
+		if scheme != "https" {
+			scheme = "http"
+		}
+		client := &httpClient{
+			client:   transport.NewClient(requestTimeout),
+			endpoint: scheme + "://" + opentsdbHost,
+		}
+		if len(opts["username"]) >= 1 {
+			client.username = opts["username"][0]
+			if len(opts["password"]) >= 1 {
+				client.password = opts["password"][0]
+			}
+		}
+		if len(opts["token"]) >= 1 {
+			if client.username != "" {
+				return nil, fmt.Errorf("only one of the `username` and `token` flags can be set")
+			}
+			client.token = opts["token"][0]
+		}
+		if len(opts["gzip"]) >= 1 {
+			gzip, err := strconv.ParseBool(opts["gzip"][0])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse `gzip` flag - %v", err)
+			}
+			client.gzip = gzip
+		}
+		tsdbSink.client = client
+	case protocolTelnet:
+		tsdbSink.client = &telnetClient{address: opentsdbHost}
+	default:
+		return nil, fmt.Errorf("failed to parse `protocol` flag - unknown protocol %q, should be %s or %s", protocol, protocolHttp, protocolTelnet)
+	}
+	return tsdbSink, nil
 }
 
 func CreateOpenTSDBSink(uri *url.URL) (core.DataSink, error) {
@@ -200,7 +254,7 @@ func CreateOpenTSDBSink(uri *url.URL) (core.DataSink, error) {
 	if len(uri.Host) > 0 {
 		host = uri.Host
 	}
-	tsdbSink, err := new(host)
+	tsdbSink, err := new(host, uri.Scheme, uri.Query())
 	if err != nil {
 		return nil, err
 	}
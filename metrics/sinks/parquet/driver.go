@@ -0,0 +1,291 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parquet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/encoding"
+	"k8s.io/heapster/metrics/snapshot"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Minute
+	defaultMaxRows       = 1000000
+	defaultCluster       = "default"
+	// Number of rows of the row groups of the files.
+	rowGroupSize = 100000
+
+	partitionLayout = "2006-01-02"
+	// Layout of the time in the name of the files, sorting like the times.
+	fileTimeLayout = "20060102T150405.000000000"
+)
+
+// Labels stored in their own column, the others are only in the labels column.
+var labelColumns = []string{
+	core.LabelMetricSetType.Key,
+	core.LabelNodename.Key,
+	core.LabelNamespaceName.Key,
+	core.LabelPodName.Key,
+	core.LabelContainerName.Key,
+	core.LabelResourceID.Key,
+}
+
+var fileSchema = buildSchema()
+
+func buildSchema() []columnSchema {
+	schema := []columnSchema{
+		{name: "timestamp", typ: typeInt64, converted: convertedTimestampMillis},
+		{name: "cluster", typ: typeByteArray, converted: convertedUTF8},
+		{name: "name", typ: typeByteArray, converted: convertedUTF8},
+		{name: "value", typ: typeDouble, converted: convertedNone},
+	}
+	for _, label := range labelColumns {
+		schema = append(schema, columnSchema{name: label, typ: typeByteArray, converted: convertedUTF8})
+	}
+	// All the labels as a JSON object.
+	return append(schema, columnSchema{name: "labels", typ: typeByteArray, converted: convertedUTF8})
+}
+
+type row struct {
+	timestamp   int64
+	name        string
+	value       float64
+	labelValues []string
+	labels      string
+}
+
+// Buffers the points of the batches and periodically writes them as Parquet files to an
+// object storage, partitioned by date and cluster like dt=<date>/cluster=<cluster>/, so they
+// can be queried in place by engines like Athena or BigQuery.
+type parquetSink struct {
+	sync.Mutex
+
+	location      *url.URL
+	prefix        string
+	cluster       string
+	codec         int32
+	flushInterval time.Duration
+	maxRows       int
+
+	// Buffered rows by partition date.
+	rows  map[string][]row
+	count int
+
+	newStore    func(object string) (snapshot.ObjectStore, error)
+	now         func() time.Time
+	stopChannel chan struct{}
+}
+
+func (this *parquetSink) Name() string {
+	return "Parquet Sink"
+}
+
+func (this *parquetSink) ExportData(batch *core.DataBatch) {
+	this.Lock()
+	for _, point := range encoding.BatchPoints(batch) {
+		if r, ok := newRow(point); ok {
+			date := point.Timestamp.UTC().Format(partitionLayout)
+			this.rows[date] = append(this.rows[date], r)
+			this.count++
+		}
+	}
+	full := this.count >= this.maxRows
+	this.Unlock()
+
+	if full {
+		this.flush()
+	}
+}
+
+func newRow(point *encoding.Point) (row, bool) {
+	r := row{
+		timestamp:   point.Timestamp.UnixNano() / int64(time.Millisecond),
+		name:        point.Name,
+		labelValues: make([]string, len(labelColumns)),
+	}
+	switch point.Value.ValueType {
+	case core.ValueInt64:
+		r.value = float64(point.Value.IntValue)
+	case core.ValueFloat:
+		r.value = float64(point.Value.FloatValue)
+	default:
+		return r, false
+	}
+	for i, label := range labelColumns {
+		r.labelValues[i] = point.Labels[label]
+	}
+	labels, err := json.Marshal(point.Labels)
+	if err != nil {
+		glog.Errorf("Failed to encode the labels of %s: %v", point.Name, err)
+		return r, false
+	}
+	r.labels = string(labels)
+	return r, true
+}
+
+// Writes a file per partition of the buffered rows. The rows of a failed upload are kept for
+// the next flush, as long as the buffer isn't full.
+func (this *parquetSink) flush() {
+	this.Lock()
+	partitions := this.rows
+	this.rows = make(map[string][]row)
+	this.count = 0
+	this.Unlock()
+
+	for date, rows := range partitions {
+		object, err := this.upload(date, rows)
+		if err == nil {
+			glog.V(2).Infof("Wrote %d rows to %s", len(rows), object)
+			continue
+		}
+		this.Lock()
+		if this.count+len(rows) > this.maxRows {
+			glog.Errorf("Failed to write %s, dropping %d rows: %v", object, len(rows), err)
+		} else {
+			glog.Errorf("Failed to write %s, retrying with the next flush: %v", object, err)
+			this.rows[date] = append(rows, this.rows[date]...)
+			this.count += len(rows)
+		}
+		this.Unlock()
+	}
+}
+
+func (this *parquetSink) upload(date string, rows []row) (string, error) {
+	object := fmt.Sprintf("%sdt=%s/cluster=%s/part-%s.parquet", this.prefix, date, this.cluster, this.now().UTC().Format(fileTimeLayout))
+	data, err := this.encode(rows)
+	if err != nil {
+		return object, err
+	}
+	store, err := this.newStore(object)
+	if err != nil {
+		return object, err
+	}
+	return object, store.Put(data)
+}
+
+func (this *parquetSink) encode(rows []row) ([]byte, error) {
+	writer := newParquetWriter(fileSchema, this.codec)
+	for start := 0; start < len(rows); start += rowGroupSize {
+		end := start + rowGroupSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		columns := make([]*columnData, len(fileSchema))
+		for i := range columns {
+			columns[i] = &columnData{}
+		}
+		for _, r := range rows[start:end] {
+			columns[0].appendInt64(r.timestamp)
+			columns[1].appendString(this.cluster)
+			columns[2].appendString(r.name)
+			columns[3].appendDouble(r.value)
+			for i, value := range r.labelValues {
+				columns[4+i].appendString(value)
+			}
+			columns[len(columns)-1].appendString(r.labels)
+		}
+		if err := writer.writeRowGroup(end-start, columns); err != nil {
+			return nil, err
+		}
+	}
+	return writer.close(), nil
+}
+
+func (this *parquetSink) run() {
+	ticker := time.NewTicker(this.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			this.flush()
+		case <-this.stopChannel:
+			return
+		}
+	}
+}
+
+func (this *parquetSink) Stop() {
+	close(this.stopChannel)
+	this.flush()
+}
+
+func NewParquetSink(uri *url.URL) (core.DataSink, error) {
+	if uri.Scheme != "gs" && uri.Scheme != "s3" {
+		return nil, fmt.Errorf("the location of the parquet sink should start with gs:// or s3://, e.g. parquet:s3://<bucket>/<prefix>?region=<region>")
+	}
+	sink := &parquetSink{
+		location:      uri,
+		prefix:        strings.TrimPrefix(uri.Path, "/"),
+		cluster:       defaultCluster,
+		codec:         codecGzip,
+		flushInterval: defaultFlushInterval,
+		maxRows:       defaultMaxRows,
+		rows:          make(map[string][]row),
+		now:           time.Now,
+		stopChannel:   make(chan struct{}),
+	}
+	if sink.prefix != "" && !strings.HasSuffix(sink.prefix, "/") {
+		sink.prefix += "/"
+	}
+	sink.newStore = func(object string) (snapshot.ObjectStore, error) {
+		return snapshot.NewObjectStoreAt(sink.location, object)
+	}
+	opts := uri.Query()
+
+	if len(opts["cluster"]) >= 1 {
+		sink.cluster = opts["cluster"][0]
+	}
+	if len(opts["compression"]) >= 1 {
+		switch opts["compression"][0] {
+		case "gzip":
+			sink.codec = codecGzip
+		case "none":
+			sink.codec = codecUncompressed
+		default:
+			return nil, fmt.Errorf("failed to parse `compression` flag - should be gzip or none")
+		}
+	}
+	if len(opts["flushinterval"]) >= 1 {
+		flushInterval, err := time.ParseDuration(opts["flushinterval"][0])
+		if err != nil || flushInterval <= 0 {
+			return nil, fmt.Errorf("failed to parse `flushinterval` flag - should be a positive duration")
+		}
+		sink.flushInterval = flushInterval
+	}
+	if len(opts["maxrows"]) >= 1 {
+		maxRows, err := strconv.Atoi(opts["maxrows"][0])
+		if err != nil || maxRows <= 0 {
+			return nil, fmt.Errorf("failed to parse `maxrows` flag - should be a positive number")
+		}
+		sink.maxRows = maxRows
+	}
+	// Checks the location, e.g. that S3 has a region.
+	if _, err := sink.newStore(sink.prefix); err != nil {
+		return nil, err
+	}
+
+	go sink.run()
+	glog.Infof("Writing Parquet files of cluster %s to %s://%s/%s", sink.cluster, uri.Scheme, uri.Host, sink.prefix)
+	return sink, nil
+}
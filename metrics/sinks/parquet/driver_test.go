@@ -0,0 +1,174 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parquet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/snapshot"
+)
+
+type fakeStores struct {
+	sync.Mutex
+	objects map[string][]byte
+	fail    bool
+}
+
+type fakeStore struct {
+	stores *fakeStores
+	object string
+}
+
+func (this *fakeStore) Put(data []byte) error {
+	this.stores.Lock()
+	defer this.stores.Unlock()
+	if this.stores.fail {
+		return fmt.Errorf("unavailable")
+	}
+	this.stores.objects[this.object] = data
+	return nil
+}
+
+func (this *fakeStore) Get() ([]byte, error) {
+	return nil, nil
+}
+
+func (this *fakeStore) String() string {
+	return this.object
+}
+
+func newTestSink(t *testing.T, location string) (*parquetSink, *fakeStores) {
+	uri, err := url.Parse(location)
+	require.NoError(t, err)
+	sink, err := NewParquetSink(uri)
+	require.NoError(t, err)
+	stores := &fakeStores{objects: make(map[string][]byte)}
+	parquetSink := sink.(*parquetSink)
+	parquetSink.newStore = func(object string) (snapshot.ObjectStore, error) {
+		return &fakeStore{stores: stores, object: object}, nil
+	}
+	parquetSink.now = func() time.Time {
+		return time.Date(2016, 10, 2, 0, 5, 0, 0, time.UTC)
+	}
+	return parquetSink, stores
+}
+
+func testBatch(timestamp time.Time) *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: timestamp,
+		MetricSets: map[string]*core.MetricSet{
+			core.PodKey("ns1", "pod1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePod,
+					core.LabelNamespaceName.Key: "ns1",
+					core.LabelPodName.Key:       "pod1",
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryUsage.Name: {
+						ValueType:  core.ValueInt64,
+						MetricType: core.MetricGauge,
+						IntValue:   1024,
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestParquetSinkPartitions(t *testing.T) {
+	sink, stores := newTestSink(t, "gs://bucket/metrics?cluster=prod&flushinterval=1h&endpoint=http://localhost")
+	defer close(sink.stopChannel)
+
+	sink.ExportData(testBatch(time.Date(2016, 10, 1, 23, 59, 0, 0, time.UTC)))
+	// Partitioned by the UTC date whatever the zone of the timestamp.
+	sink.ExportData(testBatch(time.Date(2016, 10, 1, 17, 0, 0, 0, time.FixedZone("PDT", -7*3600))))
+	sink.ExportData(testBatch(time.Date(2016, 10, 2, 0, 1, 0, 0, time.UTC)))
+	assert.Empty(t, stores.objects)
+
+	sink.flush()
+	require.Len(t, stores.objects, 2)
+	file, found := stores.objects["metrics/dt=2016-10-02/cluster=prod/part-20161002T000500.000000000.parquet"]
+	require.True(t, found)
+	_, found = stores.objects["metrics/dt=2016-10-01/cluster=prod/part-20161002T000500.000000000.parquet"]
+	require.True(t, found)
+
+	footer := readFooter(t, file)
+	assert.Equal(t, int64(2), footer[3])
+	elements := footer[2].([]interface{})
+	require.Len(t, elements, len(fileSchema)+1)
+	chunks := footer[4].([]interface{})[0].(thriftStruct)[1].([]interface{})
+	column := func(name string) []byte {
+		for i, schema := range fileSchema {
+			if schema.name == name {
+				return readColumnChunk(t, file, chunks[i].(thriftStruct))
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return nil
+	}
+	assert.Equal(t, []int64{1475366400000, 1475366460000}, decodeInt64s(column("timestamp")))
+	assert.Equal(t, []string{"prod", "prod"}, decodeStrings(column("cluster")))
+	assert.Equal(t, []string{"memory/usage", "memory/usage"}, decodeStrings(column("name")))
+	assert.Equal(t, []string{"pod1", "pod1"}, decodeStrings(column(core.LabelPodName.Key)))
+	assert.Equal(t, []string{"", ""}, decodeStrings(column(core.LabelContainerName.Key)))
+	labels := map[string]string{}
+	require.NoError(t, json.Unmarshal([]byte(decodeStrings(column("labels"))[0]), &labels))
+	assert.Equal(t, "ns1", labels[core.LabelNamespaceName.Key])
+
+	sink.flush()
+	assert.Len(t, stores.objects, 2)
+}
+
+func TestParquetSinkRetriesFailedUploads(t *testing.T) {
+	sink, stores := newTestSink(t, "gs://bucket/?maxrows=3&compression=none&endpoint=http://localhost")
+	defer close(sink.stopChannel)
+
+	stores.fail = true
+	sink.ExportData(testBatch(time.Date(2016, 10, 2, 0, 0, 0, 0, time.UTC)))
+	sink.flush()
+	assert.Equal(t, 1, sink.count)
+
+	stores.fail = false
+	sink.ExportData(testBatch(time.Date(2016, 10, 2, 0, 1, 0, 0, time.UTC)))
+	sink.ExportData(testBatch(time.Date(2016, 10, 2, 0, 2, 0, 0, time.UTC)))
+	// Flushed when full.
+	assert.Equal(t, 0, sink.count)
+	file, found := stores.objects["dt=2016-10-02/cluster=default/part-20161002T000500.000000000.parquet"]
+	require.True(t, found)
+	assert.Equal(t, int64(3), readFooter(t, file)[3])
+}
+
+func TestParquetSinkOptions(t *testing.T) {
+	for _, location := range []string{
+		"file:///tmp/metrics",
+		"s3://bucket/metrics",
+		"gs://bucket/metrics?compression=snappy",
+		"gs://bucket/metrics?flushinterval=0s",
+		"gs://bucket/metrics?maxrows=-1",
+	} {
+		uri, err := url.Parse(location)
+		require.NoError(t, err)
+		_, err = NewParquetSink(uri)
+		assert.Error(t, err, location)
+	}
+}
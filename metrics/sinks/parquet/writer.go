@@ -0,0 +1,324 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"k8s.io/heapster/version"
+)
+
+// A minimal Parquet writer: flat schemas of required columns, plain encoding, one data page
+// per column chunk, uncompressed or gzip. See https://github.com/apache/parquet-format.
+
+const parquetMagic = "PAR1"
+
+// Physical types.
+const (
+	typeInt64     int32 = 2
+	typeDouble    int32 = 5
+	typeByteArray int32 = 6
+)
+
+// Converted (logical) types.
+const (
+	convertedNone            int32 = -1
+	convertedUTF8            int32 = 0
+	convertedTimestampMillis int32 = 9
+)
+
+// Compression codecs.
+const (
+	codecUncompressed int32 = 0
+	codecGzip         int32 = 2
+)
+
+const (
+	repetitionRequired int32 = 0
+	pageTypeData       int32 = 0
+	encodingPlain      int32 = 0
+	encodingRLE        int32 = 3
+)
+
+type columnSchema struct {
+	name      string
+	typ       int32
+	converted int32
+}
+
+// Values of a column in a row group, plain encoded.
+type columnData struct {
+	values bytes.Buffer
+}
+
+func (this *columnData) appendInt64(v int64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	this.values.Write(b[:])
+}
+
+func (this *columnData) appendDouble(v float64) {
+	this.appendInt64(int64(math.Float64bits(v)))
+}
+
+func (this *columnData) appendString(v string) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(v)))
+	this.values.Write(b[:])
+	this.values.WriteString(v)
+}
+
+type columnChunkMeta struct {
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroupMeta struct {
+	rows    int64
+	columns []columnChunkMeta
+}
+
+// parquetWriter writes row groups to an in-memory file.
+type parquetWriter struct {
+	schema    []columnSchema
+	codec     int32
+	out       bytes.Buffer
+	rowGroups []rowGroupMeta
+}
+
+func newParquetWriter(schema []columnSchema, codec int32) *parquetWriter {
+	writer := &parquetWriter{schema: schema, codec: codec}
+	writer.out.WriteString(parquetMagic)
+	return writer
+}
+
+// Writes a row group holding the given number of rows of every column.
+func (this *parquetWriter) writeRowGroup(rows int, columns []*columnData) error {
+	if len(columns) != len(this.schema) {
+		return fmt.Errorf("got %d columns, expected %d", len(columns), len(this.schema))
+	}
+	group := rowGroupMeta{rows: int64(rows)}
+	for _, column := range columns {
+		raw := column.values.Bytes()
+		page := raw
+		if this.codec == codecGzip {
+			var compressed bytes.Buffer
+			writer := gzip.NewWriter(&compressed)
+			if _, err := writer.Write(raw); err != nil {
+				return err
+			}
+			if err := writer.Close(); err != nil {
+				return err
+			}
+			page = compressed.Bytes()
+		}
+
+		header := newCompactWriter()
+		header.structBegin()
+		header.i32(1, pageTypeData)
+		header.i32(2, int32(len(raw)))
+		header.i32(3, int32(len(page)))
+		header.structField(5)
+		header.i32(1, int32(rows))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.structEnd()
+		header.structEnd()
+
+		offset := int64(this.out.Len())
+		this.out.Write(header.bytes())
+		this.out.Write(page)
+		group.columns = append(group.columns, columnChunkMeta{
+			offset:           offset,
+			uncompressedSize: int64(header.len() + len(raw)),
+			compressedSize:   int64(header.len() + len(page)),
+		})
+	}
+	this.rowGroups = append(this.rowGroups, group)
+	return nil
+}
+
+// Writes the footer and returns the content of the file.
+func (this *parquetWriter) close() []byte {
+	var numRows int64
+	for _, group := range this.rowGroups {
+		numRows += group.rows
+	}
+
+	footer := newCompactWriter()
+	footer.structBegin()
+	footer.i32(1, 1)
+	footer.listBegin(2, compactStruct, len(this.schema)+1)
+	footer.structBegin()
+	footer.binary(4, "schema")
+	footer.i32(5, int32(len(this.schema)))
+	footer.structEnd()
+	for _, column := range this.schema {
+		footer.structBegin()
+		footer.i32(1, column.typ)
+		footer.i32(3, repetitionRequired)
+		footer.binary(4, column.name)
+		if column.converted != convertedNone {
+			footer.i32(6, column.converted)
+		}
+		footer.structEnd()
+	}
+	footer.i64(3, numRows)
+	footer.listBegin(4, compactStruct, len(this.rowGroups))
+	for _, group := range this.rowGroups {
+		var totalSize int64
+		footer.structBegin()
+		footer.listBegin(1, compactStruct, len(group.columns))
+		for i, chunk := range group.columns {
+			totalSize += chunk.uncompressedSize
+			footer.structBegin()
+			footer.i64(2, chunk.offset)
+			footer.structField(3)
+			footer.i32(1, this.schema[i].typ)
+			footer.listBegin(2, compactI32, 2)
+			footer.listI32(encodingPlain)
+			footer.listI32(encodingRLE)
+			footer.listBegin(3, compactBinary, 1)
+			footer.listBinary(this.schema[i].name)
+			footer.i32(4, this.codec)
+			footer.i64(5, group.rows)
+			footer.i64(6, chunk.uncompressedSize)
+			footer.i64(7, chunk.compressedSize)
+			footer.i64(9, chunk.offset)
+			footer.structEnd()
+			footer.structEnd()
+		}
+		footer.i64(2, totalSize)
+		footer.i64(3, group.rows)
+		footer.structEnd()
+	}
+	footer.binary(6, fmt.Sprintf("heapster version %s", version.HeapsterVersion))
+	footer.structEnd()
+
+	this.out.Write(footer.bytes())
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(footer.len()))
+	this.out.Write(length[:])
+	this.out.WriteString(parquetMagic)
+	return this.out.Bytes()
+}
+
+// Types of the Thrift compact protocol.
+const (
+	compactStop   byte = 0
+	compactI32    byte = 5
+	compactI64    byte = 6
+	compactBinary byte = 8
+	compactList   byte = 9
+	compactStruct byte = 12
+)
+
+// compactWriter serializes Thrift structures with the compact protocol, used by the
+// Parquet metadata.
+type compactWriter struct {
+	buf bytes.Buffer
+	// Id of the last field written in each of the enclosing structures.
+	lastField []int16
+}
+
+func newCompactWriter() *compactWriter {
+	return &compactWriter{}
+}
+
+func (this *compactWriter) bytes() []byte {
+	return this.buf.Bytes()
+}
+
+func (this *compactWriter) len() int {
+	return this.buf.Len()
+}
+
+func (this *compactWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	this.buf.Write(b[:n])
+}
+
+func (this *compactWriter) zigzag(v int64) {
+	this.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (this *compactWriter) fieldHeader(id int16, typ byte) {
+	last := &this.lastField[len(this.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		this.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		this.buf.WriteByte(typ)
+		this.zigzag(int64(id))
+	}
+	*last = id
+}
+
+// Starts a structure at the top level or in a list.
+func (this *compactWriter) structBegin() {
+	this.lastField = append(this.lastField, 0)
+}
+
+// Starts a structure in a field of the current structure.
+func (this *compactWriter) structField(id int16) {
+	this.fieldHeader(id, compactStruct)
+	this.structBegin()
+}
+
+func (this *compactWriter) structEnd() {
+	this.buf.WriteByte(compactStop)
+	this.lastField = this.lastField[:len(this.lastField)-1]
+}
+
+func (this *compactWriter) i32(id int16, v int32) {
+	this.fieldHeader(id, compactI32)
+	this.zigzag(int64(v))
+}
+
+func (this *compactWriter) i64(id int16, v int64) {
+	this.fieldHeader(id, compactI64)
+	this.zigzag(v)
+}
+
+func (this *compactWriter) binary(id int16, v string) {
+	this.fieldHeader(id, compactBinary)
+	this.listBinary(v)
+}
+
+// Starts a list field, followed by its elements.
+func (this *compactWriter) listBegin(id int16, elementType byte, size int) {
+	this.fieldHeader(id, compactList)
+	if size < 15 {
+		this.buf.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		this.buf.WriteByte(0xf0 | elementType)
+		this.varint(uint64(size))
+	}
+}
+
+func (this *compactWriter) listI32(v int32) {
+	this.zigzag(int64(v))
+}
+
+func (this *compactWriter) listBinary(v string) {
+	this.varint(uint64(len(v)))
+	this.buf.WriteString(v)
+}
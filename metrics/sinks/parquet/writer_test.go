@@ -0,0 +1,194 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A Thrift structure read with the compact protocol, by field id.
+type thriftStruct map[int16]interface{}
+
+type compactReader struct {
+	data []byte
+	pos  int
+}
+
+func (this *compactReader) byte() byte {
+	b := this.data[this.pos]
+	this.pos++
+	return b
+}
+
+func (this *compactReader) varint() uint64 {
+	v, n := binary.Uvarint(this.data[this.pos:])
+	this.pos += n
+	return v
+}
+
+func (this *compactReader) zigzag() int64 {
+	v := this.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (this *compactReader) value(typ byte) interface{} {
+	switch typ {
+	case compactI32, compactI64:
+		return this.zigzag()
+	case compactBinary:
+		n := int(this.varint())
+		s := string(this.data[this.pos : this.pos+n])
+		this.pos += n
+		return s
+	case compactList:
+		header := this.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(this.varint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = this.value(header & 0xf)
+		}
+		return list
+	case compactStruct:
+		return this.readStruct()
+	default:
+		panic("unsupported type")
+	}
+}
+
+func (this *compactReader) readStruct() thriftStruct {
+	result := thriftStruct{}
+	var last int16
+	for {
+		header := this.byte()
+		if header == compactStop {
+			return result
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(this.zigzag())
+		}
+		last = id
+		result[id] = this.value(header & 0xf)
+	}
+}
+
+// Reads the footer of a Parquet file.
+func readFooter(t *testing.T, file []byte) thriftStruct {
+	require.True(t, len(file) > 12)
+	require.Equal(t, parquetMagic, string(file[:4]))
+	require.Equal(t, parquetMagic, string(file[len(file)-4:]))
+	length := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	reader := &compactReader{data: file[len(file)-8-length : len(file)-8]}
+	footer := reader.readStruct()
+	assert.Equal(t, length, reader.pos)
+	return footer
+}
+
+// Reads the plain encoded values of a column chunk.
+func readColumnChunk(t *testing.T, file []byte, chunk thriftStruct) []byte {
+	meta := chunk[3].(thriftStruct)
+	reader := &compactReader{data: file, pos: int(meta[9].(int64))}
+	header := reader.readStruct()
+	assert.Equal(t, int64(pageTypeData), header[1])
+	page := file[reader.pos : reader.pos+int(header[3].(int64))]
+	if meta[4].(int64) == int64(codecGzip) {
+		compressed, err := gzip.NewReader(bytes.NewReader(page))
+		require.NoError(t, err)
+		page, err = ioutil.ReadAll(compressed)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int(header[2].(int64)), len(page))
+	assert.Equal(t, meta[5], header[5].(thriftStruct)[1])
+	return page
+}
+
+func decodeStrings(values []byte) []string {
+	result := []string{}
+	for len(values) > 0 {
+		n := int(binary.LittleEndian.Uint32(values))
+		result = append(result, string(values[4:4+n]))
+		values = values[4+n:]
+	}
+	return result
+}
+
+func decodeInt64s(values []byte) []int64 {
+	result := []int64{}
+	for ; len(values) > 0; values = values[8:] {
+		result = append(result, int64(binary.LittleEndian.Uint64(values)))
+	}
+	return result
+}
+
+func TestParquetWriter(t *testing.T) {
+	schema := []columnSchema{
+		{name: "timestamp", typ: typeInt64, converted: convertedTimestampMillis},
+		{name: "name", typ: typeByteArray, converted: convertedUTF8},
+		{name: "value", typ: typeDouble, converted: convertedNone},
+	}
+	for _, codec := range []int32{codecUncompressed, codecGzip} {
+		writer := newParquetWriter(schema, codec)
+		for group := 0; group < 2; group++ {
+			columns := []*columnData{{}, {}, {}}
+			for i := 0; i < 20; i++ {
+				columns[0].appendInt64(int64(group*100 + i))
+				columns[1].appendString("cpu/usage")
+				columns[2].appendDouble(float64(i) / 2)
+			}
+			require.NoError(t, writer.writeRowGroup(20, columns))
+		}
+		file := writer.close()
+
+		footer := readFooter(t, file)
+		assert.Equal(t, int64(40), footer[3])
+		elements := footer[2].([]interface{})
+		require.Len(t, elements, 4)
+		assert.Equal(t, int64(3), elements[0].(thriftStruct)[5])
+		assert.Equal(t, "timestamp", elements[1].(thriftStruct)[4])
+		assert.Equal(t, int64(convertedTimestampMillis), elements[1].(thriftStruct)[6])
+		assert.Equal(t, "value", elements[3].(thriftStruct)[4])
+		_, found := elements[3].(thriftStruct)[6]
+		assert.False(t, found)
+
+		groups := footer[4].([]interface{})
+		require.Len(t, groups, 2)
+		for i, group := range groups {
+			assert.Equal(t, int64(20), group.(thriftStruct)[3])
+			chunks := group.(thriftStruct)[1].([]interface{})
+			require.Len(t, chunks, 3)
+
+			timestamps := decodeInt64s(readColumnChunk(t, file, chunks[0].(thriftStruct)))
+			require.Len(t, timestamps, 20)
+			assert.Equal(t, int64(i*100+19), timestamps[19])
+			names := decodeStrings(readColumnChunk(t, file, chunks[1].(thriftStruct)))
+			require.Len(t, names, 20)
+			assert.Equal(t, "cpu/usage", names[0])
+			values := decodeInt64s(readColumnChunk(t, file, chunks[2].(thriftStruct)))
+			assert.Equal(t, 9.5, math.Float64frombits(uint64(values[19])))
+			assert.Equal(t, []interface{}{"value"}, chunks[2].(thriftStruct)[3].(thriftStruct)[3])
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"k8s.io/heapster/common/transport"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/batching"
+)
+
+const (
+	defaultTimeout   = 10 * time.Second
+	defaultBatchSize = 1000
+	metricNameLabel  = "__name__"
+)
+
+type remoteWriteSink struct {
+	sync.RWMutex
+	*nameTranslator
+	endpoint    string
+	client      *http.Client
+	user        string
+	password    string
+	batchSize   *batching.BatchSize
+	concurrency batching.Concurrency
+	// Number of failed write requests.
+	writeFailures int
+}
+
+func (sink *remoteWriteSink) Name() string {
+	return "Prometheus Remote Write Sink"
+}
+
+func (sink *remoteWriteSink) ExportData(dataBatch *core.DataBatch) {
+	sink.TryExportData(dataBatch)
+}
+
+// Samples written again have the same timestamps, which the receivers deduplicate.
+func (sink *remoteWriteSink) TryExportData(dataBatch *core.DataBatch) error {
+	requests := sink.concurrency.Start()
+	timestamp := dataBatch.Timestamp.UnixNano() / int64(time.Millisecond)
+	batchSize := sink.batchSize.Size()
+	series := make([]*TimeSeries, 0, batchSize)
+	flush := func() {
+		if len(series) == 0 {
+			return
+		}
+		request := &WriteRequest{Timeseries: series}
+		requests.Go(func() error {
+			start := time.Now()
+			err := sink.write(request)
+			sink.batchSize.Record(len(request.Timeseries), time.Since(start), err)
+			if err != nil {
+				glog.Errorf("Failed to write %d series to %s: %v", len(request.Timeseries), sink.endpoint, err)
+				sink.recordWriteFailure()
+			} else {
+				glog.V(4).Infof("Wrote %d series to %s", len(request.Timeseries), sink.endpoint)
+			}
+			return err
+		})
+		batchSize = sink.batchSize.Size()
+		series = make([]*TimeSeries, 0, batchSize)
+	}
+
+	for _, metricSet := range dataBatch.MetricSets {
+		for metricName, metricValue := range metricSet.MetricValues {
+			if ts := sink.timeSeries(metricName, metricSet.Labels, nil, metricValue, timestamp); ts != nil {
+				series = append(series, ts)
+			}
+			if len(series) >= batchSize {
+				flush()
+			}
+		}
+		for _, metric := range metricSet.LabeledMetrics {
+			if ts := sink.timeSeries(metric.Name, metricSet.Labels, metric.Labels, metric.MetricValue, timestamp); ts != nil {
+				series = append(series, ts)
+			}
+			if len(series) >= batchSize {
+				flush()
+			}
+		}
+	}
+	flush()
+	return requests.Wait()
+}
+
+// Builds the time series of a single metric value, or nil if the value can't be represented.
+func (sink *remoteWriteSink) timeSeries(metricName string, setLabels, metricLabels map[string]string, value core.MetricValue, timestamp int64) *TimeSeries {
+	var sample float64
+	switch value.ValueType {
+	case core.ValueInt64:
+		sample = float64(value.IntValue)
+	case core.ValueFloat:
+		sample = float64(value.FloatValue)
+	default:
+		return nil
+	}
+
+	labels := sink.labels(setLabels, metricLabels)
+	labels[metricNameLabel] = sink.metricName(metricName)
+
+	// Prometheus requires the labels of a series to be sorted by name.
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ts := &TimeSeries{
+		Labels:  make([]*Label, 0, len(names)),
+		Samples: []*Sample{{Value: sample, Timestamp: timestamp}},
+	}
+	for _, name := range names {
+		ts.Labels = append(ts.Labels, &Label{Name: name, Value: labels[name]})
+	}
+	return ts
+}
+
+func (sink *remoteWriteSink) write(request *WriteRequest) error {
+	data, err := proto.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", sink.endpoint, bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if sink.user != "" {
+		req.SetBasicAuth(sink.user, sink.password)
+	}
+	resp, err := sink.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func (sink *remoteWriteSink) recordWriteFailure() {
+	sink.Lock()
+	defer sink.Unlock()
+	sink.writeFailures++
+}
+
+func (sink *remoteWriteSink) DebugInfo() string {
+	sink.RLock()
+	defer sink.RUnlock()
+	return fmt.Sprintf("Sink Type: Prometheus Remote Write\n\tendpoint: %s\n\tNumber of write failures: %d\n", sink.endpoint, sink.writeFailures)
+}
+
+func (sink *remoteWriteSink) Stop() {
+	// nothing needs to be done.
+}
+
+func CreateRemoteWriteSink(uri *url.URL) (core.DataSink, error) {
+	if uri.Host == "" {
+		return nil, fmt.Errorf("remote write endpoint is required, e.g. prometheus:http://localhost:9009/api/prom/push")
+	}
+	opts := uri.Query()
+
+	translator, err := newNameTranslator(opts)
+	if err != nil {
+		return nil, err
+	}
+	sink := &remoteWriteSink{
+		nameTranslator: translator,
+		endpoint:       (&url.URL{Scheme: uri.Scheme, Host: uri.Host, Path: uri.Path}).String(),
+	}
+	if len(opts["user"]) >= 1 {
+		sink.user = opts["user"][0]
+	}
+	if len(opts["pw"]) >= 1 {
+		sink.password = opts["pw"][0]
+	}
+	if sink.batchSize, err = batching.NewBatchSize(sink.Name(), opts, defaultBatchSize); err != nil {
+		return nil, err
+	}
+	if sink.concurrency, err = batching.NewConcurrency(opts); err != nil {
+		return nil, err
+	}
+	timeout := defaultTimeout
+	if len(opts["timeout"]) >= 1 {
+		timeout, err = time.ParseDuration(opts["timeout"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `timeout` flag - %v", err)
+		}
+	}
+	sink.client = transport.NewClient(timeout)
+
+	glog.Infof("Created Prometheus remote write sink with endpoint %s", sink.endpoint)
+	return sink, nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+)
+
+type fakeRemoteWriteServer struct {
+	sync.Mutex
+	*httptest.Server
+	requests []*WriteRequest
+}
+
+func newFakeRemoteWriteServer(t *testing.T) *fakeRemoteWriteServer {
+	server := &fakeRemoteWriteServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		compressed, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		data, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+		request := &WriteRequest{}
+		require.NoError(t, proto.Unmarshal(data, request))
+		server.Lock()
+		server.requests = append(server.requests, request)
+		server.Unlock()
+	}))
+	return server
+}
+
+func createSink(t *testing.T, server *fakeRemoteWriteServer, query string) *remoteWriteSink {
+	uri, err := url.Parse(server.URL + "/api/prom/push?" + query)
+	require.NoError(t, err)
+	sink, err := CreateRemoteWriteSink(uri)
+	require.NoError(t, err)
+	return sink.(*remoteWriteSink)
+}
+
+func labelsOf(ts *TimeSeries) map[string]string {
+	result := map[string]string{}
+	for _, label := range ts.Labels {
+		result[label.Name] = label.Value
+	}
+	return result
+}
+
+func TestExportData(t *testing.T) {
+	server := newFakeRemoteWriteServer(t)
+	defer server.Close()
+	sink := createSink(t, server, "metric=memory/usage:container_memory_usage_bytes&label=pod_name:pod&label=labels:")
+
+	timestamp := time.Unix(1000, 0)
+	sink.ExportData(&core.DataBatch{
+		Timestamp: timestamp,
+		MetricSets: map[string]*core.MetricSet{
+			"namespace:ns1/pod:pod1": {
+				Labels: map[string]string{
+					core.LabelPodName.Key:       "pod1",
+					core.LabelNamespaceName.Key: "ns1",
+					core.LabelLabels.Key:        "app:web",
+					core.LabelHostname.Key:      "",
+				},
+				MetricValues: map[string]core.MetricValue{
+					"memory/usage":   {ValueType: core.ValueInt64, IntValue: 1024},
+					"cpu/usage_rate": {ValueType: core.ValueFloat, FloatValue: 0.5},
+				},
+				LabeledMetrics: []core.LabeledMetric{{
+					Name:        "filesystem/usage",
+					Labels:      map[string]string{core.LabelResourceID.Key: "/"},
+					MetricValue: core.MetricValue{ValueType: core.ValueInt64, IntValue: 300},
+				}},
+			},
+		},
+	})
+
+	require.Len(t, server.requests, 1)
+	series := map[string]*TimeSeries{}
+	for _, ts := range server.requests[0].Timeseries {
+		series[labelsOf(ts)[metricNameLabel]] = ts
+	}
+	require.Len(t, series, 3)
+
+	memory := series["container_memory_usage_bytes"]
+	require.NotNil(t, memory)
+	assert.Equal(t, []*Sample{{Value: 1024, Timestamp: 1000000}}, memory.Samples)
+	assert.Equal(t, map[string]string{
+		metricNameLabel:  "container_memory_usage_bytes",
+		"pod":            "pod1",
+		"namespace_name": "ns1",
+	}, labelsOf(memory))
+	for i := 1; i < len(memory.Labels); i++ {
+		assert.True(t, memory.Labels[i-1].Name < memory.Labels[i].Name)
+	}
+
+	cpu := series["heapster_cpu_usage_rate"]
+	require.NotNil(t, cpu)
+	assert.Equal(t, 0.5, cpu.Samples[0].Value)
+
+	fs := series["heapster_filesystem_usage"]
+	require.NotNil(t, fs)
+	assert.Equal(t, "/", labelsOf(fs)["resource_id"])
+	assert.Equal(t, "pod1", labelsOf(fs)["pod"])
+}
+
+func TestExportDataBatches(t *testing.T) {
+	server := newFakeRemoteWriteServer(t)
+	defer server.Close()
+	sink := createSink(t, server, "batchsize=2&prefix=")
+
+	metricSet := &core.MetricSet{
+		Labels:       map[string]string{},
+		MetricValues: map[string]core.MetricValue{},
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		metricSet.MetricValues[name] = core.MetricValue{ValueType: core.ValueInt64, IntValue: 1}
+	}
+	sink.ExportData(&core.DataBatch{
+		Timestamp:  time.Now(),
+		MetricSets: map[string]*core.MetricSet{"node:n1": metricSet},
+	})
+
+	require.Len(t, server.requests, 3)
+	names := map[string]bool{}
+	for _, request := range server.requests {
+		assert.True(t, len(request.Timeseries) <= 2)
+		for _, ts := range request.Timeseries {
+			names[labelsOf(ts)[metricNameLabel]] = true
+		}
+	}
+	assert.Len(t, names, 5)
+	assert.True(t, names["a"])
+}
+
+func TestExportDataAdaptiveBatches(t *testing.T) {
+	server := newFakeRemoteWriteServer(t)
+	defer server.Close()
+	sink := createSink(t, server, "batchsize=2&adaptivebatch=true&minbatchsize=1&prefix=")
+
+	metricSet := &core.MetricSet{
+		Labels:       map[string]string{},
+		MetricValues: map[string]core.MetricValue{},
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		metricSet.MetricValues[name] = core.MetricValue{ValueType: core.ValueInt64, IntValue: 1}
+	}
+	sink.ExportData(&core.DataBatch{
+		Timestamp:  time.Now(),
+		MetricSets: map[string]*core.MetricSet{"node:n1": metricSet},
+	})
+
+	// The batches grow by one after every full batch.
+	require.Len(t, server.requests, 3)
+	assert.Len(t, server.requests[0].Timeseries, 2)
+	assert.Len(t, server.requests[1].Timeseries, 3)
+	assert.Len(t, server.requests[2].Timeseries, 1)
+	assert.Equal(t, 4, sink.batchSize.Size())
+}
+
+func TestExportDataFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	uri, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	sink, err := CreateRemoteWriteSink(uri)
+	require.NoError(t, err)
+
+	err = sink.(core.RetryableSink).TryExportData(&core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{"node:n1": {
+			MetricValues: map[string]core.MetricValue{"uptime": {ValueType: core.ValueInt64, IntValue: 1}},
+		}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, sink.(*remoteWriteSink).writeFailures)
+}
+
+func TestCreateRemoteWriteSinkErrors(t *testing.T) {
+	for _, raw := range []string{
+		"/api/prom/push",
+		"http://localhost:9009/push?batchsize=0",
+		"http://localhost:9009/push?timeout=x",
+		"http://localhost:9009/push?label=pod_name",
+	} {
+		uri, err := url.Parse(raw)
+		require.NoError(t, err)
+		_, err = CreateRemoteWriteSink(uri)
+		assert.Error(t, err, raw)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	ExpositionPath = "/cluster-metrics"
+)
+
+// A sink which serves the metrics of the latest data batch in the Prometheus text format,
+// so that Prometheus can scrape them from Heapster.
+type expositionSink struct {
+	sync.RWMutex
+	*nameTranslator
+	latest *core.DataBatch
+	// Descriptions of the known metrics, used as help texts.
+	descriptions map[string]string
+}
+
+func (sink *expositionSink) Name() string {
+	return "Prometheus Exposition Sink"
+}
+
+func (sink *expositionSink) ExportData(dataBatch *core.DataBatch) {
+	// Out of band batches would hide the metrics of the other nodes until the next scrape.
+	if dataBatch.OutOfBand {
+		return
+	}
+	sink.Lock()
+	defer sink.Unlock()
+	sink.latest = dataBatch
+}
+
+func (sink *expositionSink) Stop() {
+	// nothing needs to be done.
+}
+
+func (sink *expositionSink) HttpPath() string {
+	return ExpositionPath
+}
+
+func (sink *expositionSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sink.RLock()
+	latest := sink.latest
+	sink.RUnlock()
+
+	buf := &bytes.Buffer{}
+	if latest != nil {
+		for _, family := range sink.metricFamilies(latest) {
+			if _, err := expfmt.MetricFamilyToText(buf, family); err != nil {
+				glog.Errorf("Failed to write metric family %s: %v", family.GetName(), err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	w.Write(buf.Bytes())
+}
+
+// Converts the batch to metric families sorted by name, with the metrics of every family
+// sorted by their labels.
+func (sink *expositionSink) metricFamilies(dataBatch *core.DataBatch) []*dto.MetricFamily {
+	timestamp := dataBatch.Timestamp.UnixNano() / int64(time.Millisecond)
+	families := make(map[string]*dto.MetricFamily)
+	add := func(metricName string, setLabels, metricLabels map[string]string, value core.MetricValue) {
+		var sample float64
+		switch value.ValueType {
+		case core.ValueInt64:
+			sample = float64(value.IntValue)
+		case core.ValueFloat:
+			sample = float64(value.FloatValue)
+		default:
+			return
+		}
+		name := sink.metricName(metricName)
+		family, found := families[name]
+		if !found {
+			family = &dto.MetricFamily{
+				Name: proto.String(name),
+				Help: proto.String(sink.help(metricName)),
+				Type: dto.MetricType_GAUGE.Enum(),
+			}
+			if value.MetricType == core.MetricCumulative {
+				family.Type = dto.MetricType_COUNTER.Enum()
+			}
+			families[name] = family
+		}
+
+		metric := &dto.Metric{TimestampMs: proto.Int64(timestamp)}
+		labels := sink.labels(setLabels, metricLabels)
+		for labelName, labelValue := range labels {
+			metric.Label = append(metric.Label, &dto.LabelPair{
+				Name:  proto.String(labelName),
+				Value: proto.String(labelValue),
+			})
+		}
+		sort.Sort(byLabelName(metric.Label))
+		if family.GetType() == dto.MetricType_COUNTER {
+			metric.Counter = &dto.Counter{Value: proto.Float64(sample)}
+		} else {
+			metric.Gauge = &dto.Gauge{Value: proto.Float64(sample)}
+		}
+		family.Metric = append(family.Metric, metric)
+	}
+
+	for _, metricSet := range dataBatch.MetricSets {
+		for metricName, metricValue := range metricSet.MetricValues {
+			add(metricName, metricSet.Labels, nil, metricValue)
+		}
+		for _, metric := range metricSet.LabeledMetrics {
+			add(metric.Name, metricSet.Labels, metric.Labels, metric.MetricValue)
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		family := families[name]
+		sort.Sort(byLabels(family.Metric))
+		result = append(result, family)
+	}
+	return result
+}
+
+func (sink *expositionSink) help(metricName string) string {
+	if description, found := sink.descriptions[metricName]; found {
+		return description
+	}
+	return "Heapster metric " + metricName
+}
+
+type byLabelName []*dto.LabelPair
+
+func (a byLabelName) Len() int           { return len(a) }
+func (a byLabelName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byLabelName) Less(i, j int) bool { return a[i].GetName() < a[j].GetName() }
+
+// Orders metrics with sorted labels.
+type byLabels []*dto.Metric
+
+func (a byLabels) Len() int      { return len(a) }
+func (a byLabels) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byLabels) Less(i, j int) bool {
+	left, right := a[i].Label, a[j].Label
+	for k := 0; k < len(left) && k < len(right); k++ {
+		if left[k].GetName() != right[k].GetName() {
+			return left[k].GetName() < right[k].GetName()
+		}
+		if left[k].GetValue() != right[k].GetValue() {
+			return left[k].GetValue() < right[k].GetValue()
+		}
+	}
+	return len(left) < len(right)
+}
+
+func newExpositionSink(uri *url.URL) (*expositionSink, error) {
+	translator, err := newNameTranslator(uri.Query())
+	if err != nil {
+		return nil, err
+	}
+	descriptions := make(map[string]string)
+	for _, metric := range core.AllMetrics {
+		descriptions[metric.Name] = metric.Description
+	}
+	return &expositionSink{
+		nameTranslator: translator,
+		descriptions:   descriptions,
+	}, nil
+}
+
+func CreateExpositionSink(uri *url.URL) (core.DataSink, error) {
+	sink, err := newExpositionSink(uri)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("Created Prometheus exposition sink serving on %s", ExpositionPath)
+	return sink, nil
+}
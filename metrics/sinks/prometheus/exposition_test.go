@@ -0,0 +1,108 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestExpositionSink(t *testing.T) {
+	uri, err := url.Parse("?label=pod_name:pod&label=labels:")
+	require.NoError(t, err)
+	sink, err := CreateExpositionSink(uri)
+	require.NoError(t, err)
+	httpSink, ok := sink.(core.HttpSink)
+	require.True(t, ok)
+	assert.Equal(t, "/cluster-metrics", httpSink.HttpPath())
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		httpSink.ServeHTTP(recorder, &http.Request{})
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+		return recorder.Body.String()
+	}
+	assert.Equal(t, "", scrape())
+
+	sink.ExportData(&core.DataBatch{
+		Timestamp: time.Unix(1000, 0),
+		MetricSets: map[string]*core.MetricSet{
+			core.PodKey("ns1", "pod1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePod,
+					core.LabelPodName.Key:       "pod1",
+					core.LabelNamespaceName.Key: "ns1",
+					core.LabelNodename.Key:      "node1",
+					core.LabelLabels.Key:        "app:web",
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryUsage.Name:      {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1024},
+					core.MetricCpuUsage.Name:         {ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 77},
+					core.MetricCpuUsageRate.Name:     {ValueType: core.ValueFloat, MetricType: core.MetricGauge, FloatValue: 0.5},
+					core.MetricNetworkRx.Name:        {ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 5},
+					core.MetricMemoryWorkingSet.Name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 512},
+				},
+			},
+			core.NodeKey("node1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypeNode,
+					core.LabelNodename.Key:      "node1",
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryUsage.Name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 4096},
+				},
+				LabeledMetrics: []core.LabeledMetric{{
+					Name:        core.MetricFilesystemUsage.Name,
+					Labels:      map[string]string{core.LabelResourceID.Key: "/dev/sda1"},
+					MetricValue: core.MetricValue{ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 300},
+				}},
+			},
+		},
+	})
+
+	lines := strings.Split(scrape(), "\n")
+	assert.Contains(t, lines, "# TYPE heapster_memory_usage gauge")
+	assert.Contains(t, lines, "# HELP heapster_memory_usage "+core.MetricMemoryUsage.Description)
+	assert.Contains(t, lines, `heapster_memory_usage{namespace_name="ns1",nodename="node1",pod="pod1",type="pod"} 1024 1000000`)
+	assert.Contains(t, lines, `heapster_memory_usage{nodename="node1",type="node"} 4096 1000000`)
+	assert.Contains(t, lines, "# TYPE heapster_cpu_usage counter")
+	assert.Contains(t, lines, `heapster_cpu_usage_rate{namespace_name="ns1",nodename="node1",pod="pod1",type="pod"} 0.5 1000000`)
+	assert.Contains(t, lines, `heapster_filesystem_usage{nodename="node1",resource_id="/dev/sda1",type="node"} 300 1000000`)
+
+	// Families are sorted by name.
+	var families []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "# TYPE ") {
+			families = append(families, strings.Fields(line)[2])
+		}
+	}
+	assert.Equal(t, []string{
+		"heapster_cpu_usage",
+		"heapster_cpu_usage_rate",
+		"heapster_filesystem_usage",
+		"heapster_memory_usage",
+		"heapster_memory_working_set",
+		"heapster_network_rx",
+	}, families)
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultPrefix = "heapster_"
+)
+
+var (
+	// Matches any character not allowed in Prometheus metric and label names.
+	invalidNameCharRegexp = regexp.MustCompile("[^a-zA-Z0-9_]")
+)
+
+// Translates heapster metric and label names to Prometheus ones. Configured with the
+// `prefix`, `metric` and `label` options shared by the Prometheus sinks.
+type nameTranslator struct {
+	prefix string
+	// Explicit translations of heapster metric and label names.
+	metricNames map[string]string
+	labelNames  map[string]string
+}
+
+func newNameTranslator(opts url.Values) (*nameTranslator, error) {
+	translator := &nameTranslator{prefix: defaultPrefix}
+	if len(opts["prefix"]) >= 1 {
+		translator.prefix = opts["prefix"][0]
+	}
+	var err error
+	if translator.metricNames, err = parseNameMapping("metric", opts["metric"]); err != nil {
+		return nil, err
+	}
+	if translator.labelNames, err = parseNameMapping("label", opts["label"]); err != nil {
+		return nil, err
+	}
+	return translator, nil
+}
+
+// Translates a heapster metric name, e.g. cpu/usage_rate, to a Prometheus one, e.g. heapster_cpu_usage_rate.
+func (this *nameTranslator) metricName(name string) string {
+	if translated, found := this.metricNames[name]; found {
+		return translated
+	}
+	return this.prefix + toValidPrometheusName(name)
+}
+
+// Translates a heapster label name to a Prometheus one. Returns an empty string for dropped labels.
+func (this *nameTranslator) labelName(name string) string {
+	if translated, found := this.labelNames[name]; found {
+		return translated
+	}
+	return toValidPrometheusName(name)
+}
+
+// Translates the labels of a metric, skipping dropped labels and empty values.
+func (this *nameTranslator) labels(sources ...map[string]string) map[string]string {
+	result := make(map[string]string)
+	for _, source := range sources {
+		for name, value := range source {
+			if name = this.labelName(name); name != "" && value != "" {
+				result[name] = value
+			}
+		}
+	}
+	return result
+}
+
+func toValidPrometheusName(name string) string {
+	return invalidNameCharRegexp.ReplaceAllLiteralString(name, "_")
+}
+
+// Parses repeated <from>:<to> options into a map.
+func parseNameMapping(name string, values []string) (map[string]string, error) {
+	result := make(map[string]string, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid `%s` flag %q, should be <heapster name>:<prometheus name>", name, value)
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/heapster/metrics/core"
+)
+
+// Escapes the label values and help texts of the OpenMetrics text format.
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// A sink which writes the metrics of the latest data batch to a file in the OpenMetrics text
+// format, replacing the previous snapshot atomically, for the tools reading OpenMetrics files.
+type openMetricsSink struct {
+	sync.Mutex
+	// Converts the batches to metric families like the Prometheus exposition sink.
+	exposition *expositionSink
+	path       string
+	// Minimum time between the snapshots, every batch is written if 0.
+	interval time.Duration
+	// Timestamp of the batch of the latest snapshot.
+	written time.Time
+}
+
+func (this *openMetricsSink) Name() string {
+	return "OpenMetrics File Sink"
+}
+
+func (this *openMetricsSink) ExportData(dataBatch *core.DataBatch) {
+	// Out of band batches only cover a few nodes, the snapshot is the complete batch.
+	if dataBatch.OutOfBand {
+		return
+	}
+	this.Lock()
+	defer this.Unlock()
+	if this.interval > 0 && dataBatch.Timestamp.Sub(this.written) < this.interval {
+		return
+	}
+	if err := this.write(dataBatch); err != nil {
+		glog.Errorf("Failed to write OpenMetrics snapshot %s: %v", this.path, err)
+		return
+	}
+	this.written = dataBatch.Timestamp
+}
+
+// Writes the batch to a temporary file renamed to the path of the snapshot, so that readers
+// never see a partial snapshot.
+func (this *openMetricsSink) write(dataBatch *core.DataBatch) error {
+	file, err := ioutil.TempFile(filepath.Dir(this.path), "."+filepath.Base(this.path)+"-")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	err = writeOpenMetrics(writer, this.exposition.metricFamilies(dataBatch))
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), this.path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (this *openMetricsSink) Stop() {
+	// nothing needs to be done.
+}
+
+// Writes the metric families in the OpenMetrics text format. The samples of the counters get
+// the mandatory `_total` suffix, the timestamps are in seconds.
+func writeOpenMetrics(w io.Writer, families []*dto.MetricFamily) error {
+	for _, family := range families {
+		name := family.GetName()
+		metricType := "gauge"
+		sampleName := name
+		if family.GetType() == dto.MetricType_COUNTER {
+			metricType = "counter"
+			name = strings.TrimSuffix(name, "_total")
+			sampleName = name + "_total"
+		}
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n# HELP %s %s\n", name, metricType, name, openMetricsEscaper.Replace(family.GetHelp())); err != nil {
+			return err
+		}
+		for _, metric := range family.Metric {
+			value := metric.GetGauge().GetValue()
+			if metric.Counter != nil {
+				value = metric.GetCounter().GetValue()
+			}
+			labels := make([]string, 0, len(metric.Label))
+			for _, label := range metric.Label {
+				labels = append(labels, fmt.Sprintf(`%s="%s"`, label.GetName(), openMetricsEscaper.Replace(label.GetValue())))
+			}
+			line := sampleName
+			if len(labels) > 0 {
+				line += "{" + strings.Join(labels, ",") + "}"
+			}
+			line += " " + formatOpenMetricsValue(value)
+			if metric.TimestampMs != nil {
+				line += " " + strconv.FormatFloat(float64(metric.GetTimestampMs())/1000, 'f', -1, 64)
+			}
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+func formatOpenMetricsValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func CreateOpenMetricsSink(uri *url.URL) (core.DataSink, error) {
+	if uri.Path == "" {
+		return nil, fmt.Errorf("the path of the OpenMetrics snapshot is required, e.g. openmetrics:/var/lib/heapster/metrics.om")
+	}
+	exposition, err := newExpositionSink(uri)
+	if err != nil {
+		return nil, err
+	}
+	sink := &openMetricsSink{
+		exposition: exposition,
+		path:       uri.Path,
+	}
+	opts := uri.Query()
+	if len(opts["interval"]) >= 1 {
+		if sink.interval, err = time.ParseDuration(opts["interval"][0]); err != nil || sink.interval < 0 {
+			return nil, fmt.Errorf("failed to parse `interval` flag - %v", opts["interval"][0])
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(sink.path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the directory of the OpenMetrics snapshot: %v", err)
+	}
+	glog.Infof("Writing OpenMetrics snapshots to %s", sink.path)
+	return sink, nil
+}
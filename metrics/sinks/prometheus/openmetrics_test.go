@@ -0,0 +1,100 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+)
+
+func openMetricsBatch(timestamp time.Time, memory int64) *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: timestamp,
+		MetricSets: map[string]*core.MetricSet{
+			core.PodKey("ns1", "pod1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypePod,
+					core.LabelPodName.Key:       "pod1",
+					core.LabelLabels.Key:        `app:"web"`,
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryUsage.Name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: memory},
+					core.MetricCpuUsage.Name:    {ValueType: core.ValueInt64, MetricType: core.MetricCumulative, IntValue: 77},
+				},
+			},
+		},
+	}
+}
+
+func TestOpenMetricsSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openmetrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshots", "metrics.om")
+
+	uri, err := url.Parse("openmetrics:" + path + "?interval=1m&label=pod_name:pod")
+	require.NoError(t, err)
+	sink, err := CreateOpenMetricsSink(uri)
+	require.NoError(t, err)
+
+	now := time.Unix(1000, 500*int64(time.Millisecond))
+	sink.ExportData(openMetricsBatch(now, 1024))
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `# TYPE heapster_cpu_usage counter
+# HELP heapster_cpu_usage `+core.MetricCpuUsage.Description+`
+heapster_cpu_usage_total{labels="app:\"web\"",pod="pod1",type="pod"} 77 1000.5
+# TYPE heapster_memory_usage gauge
+# HELP heapster_memory_usage `+core.MetricMemoryUsage.Description+`
+heapster_memory_usage{labels="app:\"web\"",pod="pod1",type="pod"} 1024 1000.5
+# EOF
+`, string(content))
+
+	// The snapshot is written at most once per interval, and not for out of band batches.
+	sink.ExportData(openMetricsBatch(now.Add(30*time.Second), 2048))
+	outOfBand := openMetricsBatch(now.Add(time.Minute), 3072)
+	outOfBand.OutOfBand = true
+	sink.ExportData(outOfBand)
+	content, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), " 1024 ")
+
+	sink.ExportData(openMetricsBatch(now.Add(time.Minute), 4096))
+	content, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), " 4096 ")
+
+	// No temporary file is left over.
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestCreateOpenMetricsSinkErrors(t *testing.T) {
+	for _, rawUri := range []string{"openmetrics:", "openmetrics:/tmp/metrics.om?interval=soon", "openmetrics:/tmp/metrics.om?metric=:x"} {
+		uri, err := url.Parse(rawUri)
+		require.NoError(t, err)
+		_, err = CreateOpenMetricsSink(uri)
+		assert.Error(t, err, rawUri)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/heapster/metrics/core"
+	metricsink "k8s.io/heapster/metrics/sinks/metric"
+)
+
+// Priority classes of the sinks. The sink manager pushes every batch to the high priority sinks
+// first, then to the normal priority ones, and waits for both. It doesn't wait for the low
+// priority sinks: a batch is dropped right away if such a sink is still busy with the previous one.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+var (
+	// Time spent waiting for the rate limit of the sink in microseconds.
+	exporterThrottleDuration = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "heapster",
+			Subsystem: "exporter",
+			Name:      "throttled_microseconds_total",
+			Help:      "Time spent waiting for the rate limit of the exporter in microseconds.",
+		},
+		[]string{"exporter"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(exporterThrottleDuration)
+}
+
+// A sink wrapper setting the priority class and the export timeout of the sink in the sink manager.
+type prioritySink struct {
+	core.DataSink
+	priority string
+	// How long the sink manager waits for the sink to take a batch, 0 for the default.
+	exportTimeout time.Duration
+}
+
+// Wraps the sink with the priority and the export timeout given in the options of its uri, or
+// returns it as is if it has the normal priority and the default timeout.
+func newPrioritySink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	this := &prioritySink{DataSink: sink, priority: PriorityNormal}
+	if len(opts["priority"]) >= 1 {
+		this.priority = opts["priority"][0]
+		switch this.priority {
+		case PriorityHigh, PriorityNormal, PriorityLow:
+		default:
+			return nil, fmt.Errorf("failed to parse `priority` flag - %v", this.priority)
+		}
+	}
+	if len(opts["exporttimeout"]) >= 1 {
+		timeout, err := time.ParseDuration(opts["exporttimeout"][0])
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("failed to parse `exporttimeout` flag - %v", opts["exporttimeout"][0])
+		}
+		this.exportTimeout = timeout
+	}
+	if this.priority == PriorityNormal && this.exportTimeout == 0 {
+		return sink, nil
+	}
+	if _, ok := sink.(core.HttpSink); ok {
+		return nil, fmt.Errorf("priorities and export timeouts are not supported by sink %s", sink.Name())
+	}
+	return this, nil
+}
+
+func (this *prioritySink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *prioritySink) exportData(data *core.DataBatch) error {
+	return tryExportData(this.DataSink, data)
+}
+
+func (this *prioritySink) AcceptsRawSamples() bool {
+	return acceptsRawSamples(this.DataSink)
+}
+
+func (this *prioritySink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
+
+// Returns the priority class of the sink. The in-memory metric sink, which serves the model and
+// the metrics API used by the autoscalers, has the high priority unless configured otherwise.
+func sinkPriority(sink core.DataSink) string {
+	switch s := sink.(type) {
+	case *prioritySink:
+		return s.priority
+	case *metricsink.MetricSink:
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// Returns how long the sink manager waits for the sink to take a batch, or the default timeout
+// if the sink has none.
+func sinkExportTimeout(sink core.DataSink, defaultTimeout time.Duration) time.Duration {
+	if s, ok := sink.(*prioritySink); ok && s.exportTimeout > 0 {
+		return s.exportTimeout
+	}
+	return defaultTimeout
+}
+
+// A sink wrapper limiting the number of points per second exported to the sink with a token
+// bucket. A batch with more points than available waits until the bucket refilled, which delays
+// the next batches of the sink but not the other sinks.
+type rateLimitSink struct {
+	core.DataSink
+	// Points per second refilling the bucket, and the most it holds.
+	rate  float64
+	burst float64
+	// Points in the bucket at the last export, negative if it waited for them.
+	tokens     float64
+	lastExport time.Time
+
+	nowFunc   func() time.Time
+	afterFunc func(time.Duration) <-chan time.Time
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// Wraps the sink with the rate limit given in the options of its uri, or returns it as is if it
+// has none.
+func newRateLimitSink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	if len(opts["rateLimit"]) == 0 {
+		return sink, nil
+	}
+	rate, err := strconv.ParseFloat(opts["rateLimit"][0], 64)
+	if err != nil || rate <= 0 {
+		return nil, fmt.Errorf("failed to parse `rateLimit` flag - %v", opts["rateLimit"][0])
+	}
+	// One second worth of points by default.
+	burst := int64(rate)
+	if len(opts["rateBurst"]) >= 1 {
+		if burst, err = strconv.ParseInt(opts["rateBurst"][0], 10, 64); err != nil || burst <= 0 {
+			return nil, fmt.Errorf("failed to parse `rateBurst` flag - %v", opts["rateBurst"][0])
+		}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if _, ok := sink.(core.HttpSink); ok {
+		return nil, fmt.Errorf("rate limits are not supported by sink %s", sink.Name())
+	}
+	this := &rateLimitSink{
+		DataSink:  sink,
+		rate:      rate,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+		nowFunc:   time.Now,
+		afterFunc: time.After,
+		stop:      make(chan struct{}),
+	}
+	this.lastExport = this.nowFunc()
+	return this, nil
+}
+
+func (this *rateLimitSink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *rateLimitSink) exportData(data *core.DataBatch) error {
+	// Batches larger than the burst are let through once the bucket refilled the missing points.
+	if wait := this.take(batchPoints(data)); wait > 0 {
+		glog.V(2).Infof("Waiting %v for the rate limit of sink %s", wait, this.Name())
+		exporterThrottleDuration.WithLabelValues(this.Name()).Add(float64(wait) / float64(time.Microsecond))
+		select {
+		case <-this.afterFunc(wait):
+		case <-this.stop:
+			return fmt.Errorf("sink %s stopped while waiting for its rate limit", this.Name())
+		}
+	}
+	return tryExportData(this.DataSink, data)
+}
+
+// Takes the points from the bucket, and returns how long to wait until it refilled the missing ones.
+func (this *rateLimitSink) take(points int) time.Duration {
+	now := this.nowFunc()
+	this.tokens = math.Min(this.burst, this.tokens+now.Sub(this.lastExport).Seconds()*this.rate)
+	this.lastExport = now
+	if this.tokens -= float64(points); this.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-this.tokens / this.rate * float64(time.Second))
+}
+
+func (this *rateLimitSink) Stop() {
+	this.stopOnce.Do(func() { close(this.stop) })
+	this.DataSink.Stop()
+}
+
+func (this *rateLimitSink) AcceptsRawSamples() bool {
+	return acceptsRawSamples(this.DataSink)
+}
+
+func (this *rateLimitSink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
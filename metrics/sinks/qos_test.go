@@ -0,0 +1,162 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	metricsink "k8s.io/heapster/metrics/sinks/metric"
+	"k8s.io/heapster/metrics/util"
+)
+
+func newTestQoSSink(t *testing.T, sink core.DataSink, query string) core.DataSink {
+	uri, err := url.Parse("?" + query)
+	require.NoError(t, err)
+	wrapped, err := newRateLimitSink(sink, uri)
+	require.NoError(t, err)
+	wrapped, err = newPrioritySink(wrapped, uri)
+	require.NoError(t, err)
+	return wrapped
+}
+
+func TestNewQoSSink(t *testing.T) {
+	sink := &recordingSink{}
+	assert.True(t, newTestQoSSink(t, sink, "batchsize=10") == core.DataSink(sink))
+	assert.True(t, newTestQoSSink(t, sink, "priority=normal") == core.DataSink(sink))
+	assert.Equal(t, PriorityNormal, sinkPriority(sink))
+	assert.Equal(t, PriorityLow, sinkPriority(newTestQoSSink(t, sink, "priority=low")))
+	assert.Equal(t, PriorityHigh, sinkPriority(newTestQoSSink(t, sink, "priority=high&rateLimit=100")))
+	assert.Equal(t, PriorityHigh, sinkPriority(metricsink.NewMetricSink(time.Minute, time.Minute, nil)))
+
+	wrapped := newTestQoSSink(t, sink, "exporttimeout=1m")
+	assert.Equal(t, PriorityNormal, sinkPriority(wrapped))
+	assert.Equal(t, time.Minute, sinkExportTimeout(wrapped, time.Second))
+	assert.Equal(t, time.Second, sinkExportTimeout(sink, time.Second))
+
+	for _, query := range []string{"priority=urgent", "exporttimeout=0s", "rateLimit=0", "rateLimit=fast", "rateLimit=10&rateBurst=-1"} {
+		uri, err := url.Parse("?" + query)
+		require.NoError(t, err)
+		_, err = newRateLimitSink(sink, uri)
+		if err == nil {
+			_, err = newPrioritySink(sink, uri)
+		}
+		assert.Error(t, err, query)
+	}
+}
+
+// A clock whose timers fire right away, unless it's blocked, moving it forward.
+type fakeClock struct {
+	now     time.Time
+	waits   []time.Duration
+	blocked bool
+}
+
+func (this *fakeClock) Now() time.Time {
+	return this.now
+}
+
+func (this *fakeClock) After(d time.Duration) <-chan time.Time {
+	this.waits = append(this.waits, d)
+	if this.blocked {
+		return nil
+	}
+	this.now = this.now.Add(d)
+	fired := make(chan time.Time, 1)
+	fired <- this.now
+	return fired
+}
+
+func TestRateLimitSink(t *testing.T) {
+	sink := &recordingSink{}
+	// Two points per batch, two batches per second.
+	wrapped := newTestQoSSink(t, sink, "rateLimit=4&rateBurst=2")
+	limited := wrapped.(*rateLimitSink)
+	clock := &fakeClock{now: time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)}
+	limited.nowFunc, limited.afterFunc, limited.lastExport = clock.Now, clock.After, clock.now
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, tryExportData(wrapped, batchWithPoints()))
+	}
+	assert.Len(t, sink.batches, 3)
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond}, clock.waits)
+
+	// The bucket refills up to the burst.
+	clock.now = clock.now.Add(time.Hour)
+	clock.waits = nil
+	assert.NoError(t, tryExportData(wrapped, batchWithPoints()))
+	assert.Empty(t, clock.waits)
+
+	// A stopped sink doesn't wait for its rate limit anymore.
+	clock.blocked = true
+	wrapped.Stop()
+	assert.Error(t, tryExportData(wrapped, batchWithPoints()))
+	assert.Len(t, sink.batches, 4)
+}
+
+func TestSinkExportTimeout(t *testing.T) {
+	timeout := 3 * time.Second
+
+	fast := util.NewDummySink("fast", 0)
+	slow := newTestQoSSink(t, util.NewDummySink("slow", 2*time.Second), "exporttimeout=100ms")
+	manager, _ := NewDataSinkManager([]core.DataSink{fast, slow}, timeout, timeout)
+	// Let the sinks start waiting for batches.
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	manager.ExportData(batchWithPoints())
+	manager.ExportData(batchWithPoints())
+	elapsed := time.Since(start)
+	if elapsed > time.Second {
+		t.Fatalf("2xExportData took too long: %s", elapsed)
+	}
+	stats := manager.(StatsProvider).Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, int64(1), stats[1].DroppedBatches)
+}
+
+func TestLowPrioritySinkDoesntDelayExports(t *testing.T) {
+	timeout := 3 * time.Second
+
+	fast := util.NewDummySink("fast", 0)
+	slow := util.NewDummySink("slow", 2*time.Second)
+	lowPriority := newTestQoSSink(t, slow, "priority=low")
+	manager, _ := NewDataSinkManager([]core.DataSink{fast, lowPriority}, timeout, timeout)
+	// Let the sinks start waiting for batches.
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	manager.ExportData(batchWithPoints())
+	manager.ExportData(batchWithPoints())
+	manager.ExportData(batchWithPoints())
+	elapsed := time.Since(start)
+	if elapsed > time.Second {
+		t.Fatalf("3xExportData took too long: %s", elapsed)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 3, fast.GetExportCount())
+	// The low priority sink was busy with the first batch.
+	assert.Equal(t, 1, slow.GetExportCount())
+	stats := manager.(StatsProvider).Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, PriorityLow, stats[1].Priority)
+	assert.Equal(t, int64(2), stats[1].DroppedBatches)
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// A sink wrapper renaming, dropping and adding labels before the data is exported to the sink, to
+// follow the naming conventions and cardinality limits of its backend. The labeled metrics of a metric
+// set which only differed by dropped labels are merged, summing their values.
+type relabelSink struct {
+	core.DataSink
+	// New names of the labels, by old name.
+	renames map[string]string
+	drops   namePatterns
+	// Labels added to all the metric sets.
+	additions map[string]string
+}
+
+// Parses the `<key>:<value>` pairs of an option.
+func parseLabelPairs(option string, values []string) (map[string]string, error) {
+	result := make(map[string]string, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("failed to parse `%s` flag - %q should be <key>:<value>", option, value)
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
+
+// Wraps the sink with the relabeling given in the options of its uri, or returns it as is if it has none.
+func newRelabelSink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	this := &relabelSink{DataSink: sink}
+	var err error
+	if this.renames, err = parseLabelPairs("renameLabel", opts["renameLabel"]); err != nil {
+		return nil, err
+	}
+	for from, to := range this.renames {
+		if to == "" {
+			return nil, fmt.Errorf("failed to parse `renameLabel` flag - empty new name of label %q", from)
+		}
+	}
+	if this.additions, err = parseLabelPairs("addLabel", opts["addLabel"]); err != nil {
+		return nil, err
+	}
+	if this.drops, err = parseNamePatterns(opts["dropLabels"]); err != nil {
+		return nil, fmt.Errorf("failed to parse `dropLabels` flag - %v", err)
+	}
+	if len(this.renames) == 0 && len(this.drops) == 0 && len(this.additions) == 0 {
+		return sink, nil
+	}
+	if _, ok := sink.(core.HttpSink); ok {
+		return nil, fmt.Errorf("relabeling is not supported by sink %s", sink.Name())
+	}
+	return this, nil
+}
+
+// Returns a copy of the labels, renamed and without the dropped ones.
+func (this *relabelSink) relabel(labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels))
+	for key, value := range labels {
+		if this.drops.matches(key) {
+			continue
+		}
+		if to, found := this.renames[key]; found {
+			key = to
+		}
+		result[key] = value
+	}
+	return result
+}
+
+func (this *relabelSink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *relabelSink) exportData(data *core.DataBatch) error {
+	result := &core.DataBatch{
+		Timestamp:    data.Timestamp,
+		MetricSets:   make(map[string]*core.MetricSet, len(data.MetricSets)),
+		Completeness: data.Completeness,
+		OutOfBand:    data.OutOfBand,
+	}
+	for key, ms := range data.MetricSets {
+		msCopy := *ms
+		msCopy.Labels = this.relabel(ms.Labels)
+		for name, value := range this.additions {
+			msCopy.Labels[name] = value
+		}
+		msCopy.LabeledMetrics = make([]core.LabeledMetric, 0, len(ms.LabeledMetrics))
+		// Index of the labeled metrics in the copy, by name and labels.
+		index := make(map[string]int, len(ms.LabeledMetrics))
+		for _, metric := range ms.LabeledMetrics {
+			metric.Labels = this.relabel(metric.Labels)
+			metricKey := labeledMetricKey(&metric)
+			if i, found := index[metricKey]; found {
+				mergeMetricValue(&msCopy.LabeledMetrics[i].MetricValue, metric.MetricValue)
+				continue
+			}
+			index[metricKey] = len(msCopy.LabeledMetrics)
+			msCopy.LabeledMetrics = append(msCopy.LabeledMetrics, metric)
+		}
+		result.MetricSets[key] = &msCopy
+	}
+	return tryExportData(this.DataSink, result)
+}
+
+// Adds the value to the one of a labeled metric which became identical once relabeled. Histograms
+// are not merged, the first one is kept.
+func mergeMetricValue(value *core.MetricValue, other core.MetricValue) {
+	switch value.ValueType {
+	case core.ValueInt64:
+		value.IntValue += other.IntValue
+	case core.ValueFloat:
+		value.FloatValue += other.FloatValue
+	}
+}
+
+func (this *relabelSink) AcceptsRawSamples() bool {
+	return acceptsRawSamples(this.DataSink)
+}
+
+func (this *relabelSink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
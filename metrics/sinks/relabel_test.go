@@ -0,0 +1,110 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestRelabelSink(t *testing.T) {
+	sink := &recordingSink{}
+	uri, err := url.Parse("?renameLabel=namespace_name:namespace&renameLabel=resource_id:device" +
+		"&dropLabels=pod_id,label*&addLabel=cluster:prod&addLabel=region:eu-west")
+	require.NoError(t, err)
+	wrapped, err := newRelabelSink(sink, uri)
+	require.NoError(t, err)
+
+	data := &core.DataBatch{
+		Timestamp: time.Unix(1475323200, 0),
+		MetricSets: map[string]*core.MetricSet{
+			core.PodKey("prod", "p1"): {
+				Labels: map[string]string{
+					core.LabelNamespaceName.Key: "prod",
+					core.LabelPodName.Key:       "p1",
+					core.LabelPodId.Key:         "0a1b",
+					core.LabelLabels.Key:        "app:web",
+				},
+				MetricValues: map[string]core.MetricValue{
+					"cpu/usage": {ValueType: core.ValueInt64, IntValue: 1},
+				},
+				LabeledMetrics: []core.LabeledMetric{{
+					Name:        "filesystem/usage",
+					Labels:      map[string]string{core.LabelResourceID.Key: "/dev/sda1"},
+					MetricValue: core.MetricValue{ValueType: core.ValueInt64, IntValue: 10},
+				}},
+			},
+		},
+	}
+	wrapped.ExportData(data)
+
+	require.Len(t, sink.batches, 1)
+	ms := sink.batches[0].MetricSets[core.PodKey("prod", "p1")]
+	assert.Equal(t, map[string]string{
+		"namespace":           "prod",
+		core.LabelPodName.Key: "p1",
+		"cluster":             "prod",
+		"region":              "eu-west",
+	}, ms.Labels)
+	require.Len(t, ms.LabeledMetrics, 1)
+	assert.Equal(t, map[string]string{"device": "/dev/sda1"}, ms.LabeledMetrics[0].Labels)
+	assert.Equal(t, int64(1), ms.MetricValues["cpu/usage"].IntValue)
+	// The batch of the other sinks is left untouched.
+	assert.Equal(t, "prod", data.MetricSets[core.PodKey("prod", "p1")].Labels[core.LabelNamespaceName.Key])
+	assert.Equal(t, "/dev/sda1", data.MetricSets[core.PodKey("prod", "p1")].LabeledMetrics[0].Labels[core.LabelResourceID.Key])
+}
+
+func TestRelabelSinkMergesDroppedLabels(t *testing.T) {
+	sink := &recordingSink{}
+	uri, err := url.Parse("?dropLabels=resource_id")
+	require.NoError(t, err)
+	wrapped, err := newRelabelSink(sink, uri)
+	require.NoError(t, err)
+
+	device := func(name, device string, value int64) core.LabeledMetric {
+		return core.LabeledMetric{
+			Name:        name,
+			Labels:      map[string]string{core.LabelResourceID.Key: device},
+			MetricValue: core.MetricValue{ValueType: core.ValueInt64, IntValue: value},
+		}
+	}
+	wrapped.ExportData(&core.DataBatch{
+		MetricSets: map[string]*core.MetricSet{
+			core.NodeKey("n1"): {
+				Labels: map[string]string{},
+				LabeledMetrics: []core.LabeledMetric{
+					device("filesystem/usage", "/dev/sda1", 10),
+					device("filesystem/limit", "/dev/sda1", 100),
+					device("filesystem/usage", "/dev/sda2", 20),
+					device("filesystem/limit", "/dev/sda2", 200),
+				},
+			},
+		},
+	})
+
+	metrics := sink.batches[0].MetricSets[core.NodeKey("n1")].LabeledMetrics
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "filesystem/usage", metrics[0].Name)
+	assert.Equal(t, int64(30), metrics[0].IntValue)
+	assert.Empty(t, metrics[0].Labels)
+	assert.Equal(t, "filesystem/limit", metrics[1].Name)
+	assert.Equal(t, int64(300), metrics[1].IntValue)
+}
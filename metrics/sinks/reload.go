@@ -0,0 +1,198 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	// How often the sink configuration file is checked for changes.
+	sinkConfigReloadInterval = 30 * time.Second
+)
+
+// SinkConfigWatcher adds, removes and reconfigures sinks of the sink manager at runtime, as
+// listed in a file, e.g. a mounted ConfigMap. The file has a sink per line, in the format of the
+// --sink flag. Empty lines and lines starting with # are ignored. A sink whose line changed is
+// stopped, which flushes its data, and created again with the new options.
+type SinkConfigWatcher struct {
+	path    string
+	factory *SinkFactory
+	manager *sinkManager
+	modTime time.Time
+	// Sinks created from the file and their uris, by uri.
+	lock  sync.Mutex
+	sinks map[string]core.DataSink
+	uris  map[string]flags.Uri
+	stop  chan struct{}
+}
+
+// NewSinkConfigWatcher creates the sinks listed in the file and adds them to the manager,
+// failing if the file can't be read.
+func NewSinkConfigWatcher(manager core.DataSink, factory *SinkFactory, path string) (*SinkConfigWatcher, error) {
+	sm, ok := manager.(*sinkManager)
+	if !ok {
+		return nil, fmt.Errorf("sinks can't be added to %s", manager.Name())
+	}
+	this := &SinkConfigWatcher{
+		path:    path,
+		factory: factory,
+		manager: sm,
+		sinks:   make(map[string]core.DataSink),
+		uris:    make(map[string]flags.Uri),
+		stop:    make(chan struct{}),
+	}
+	if err := this.reload(); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+// Starts checking the file for changes.
+func (this *SinkConfigWatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(sinkConfigReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := this.reload(); err != nil {
+					glog.Warningf("Failed to reload sink configuration %s, keeping the previous sinks: %v", this.path, err)
+				}
+			case <-this.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (this *SinkConfigWatcher) Stop() {
+	close(this.stop)
+}
+
+// Reconfigures the sinks if the file was modified since it was last read. Sinks which fail to be
+// created are logged and left out, the other changes are still applied.
+func (this *SinkConfigWatcher) reload() error {
+	info, err := os.Stat(this.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(this.modTime) {
+		return nil
+	}
+	uris, err := readSinkConfig(this.path)
+	if err != nil {
+		return err
+	}
+	this.modTime = info.ModTime()
+
+	wanted := make(map[string]flags.Uri, len(uris))
+	for _, uri := range uris {
+		wanted[uri.String()] = uri
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for key, sink := range this.sinks {
+		if _, found := wanted[key]; !found {
+			glog.Infof("Removing sink %s", sink.Name())
+			this.manager.removeSink(sink)
+			delete(this.sinks, key)
+			delete(this.uris, key)
+		}
+	}
+	for key, uri := range wanted {
+		if _, found := this.sinks[key]; found {
+			continue
+		}
+		sink, err := this.build(uri)
+		if err != nil {
+			glog.Errorf("Failed to create sink %s: %v", uri.Key, err)
+			continue
+		}
+		glog.Infof("Adding sink %s", sink.Name())
+		this.manager.addSink(sink)
+		this.sinks[key] = sink
+		this.uris[key] = uri
+	}
+	return nil
+}
+
+// Uris returns the uris of the sinks created from the file, with their secrets redacted.
+func (this *SinkConfigWatcher) Uris() []string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	result := make([]string, 0, len(this.uris))
+	for _, uri := range this.uris {
+		result = append(result, uri.Redacted())
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (this *SinkConfigWatcher) build(uri flags.Uri) (core.DataSink, error) {
+	sink, err := this.factory.Build(uri)
+	if err != nil {
+		return nil, err
+	}
+	// Sinks serving http need to be registered when heapster starts.
+	if _, ok := sink.(core.HttpSink); ok {
+		sink.Stop()
+		return nil, fmt.Errorf("sink %s can only be configured with --sink", sink.Name())
+	}
+	wrapped, err := wrap(sink, uri)
+	if err != nil {
+		sink.Stop()
+		return nil, err
+	}
+	return wrapped, nil
+}
+
+// Reads the sink uris of the file, failing on the first invalid one.
+func readSinkConfig(path string) ([]flags.Uri, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	uris := []flags.Uri{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		uri := flags.Uri{}
+		if err := uri.Set(text); err != nil {
+			return nil, fmt.Errorf("invalid sink on line %d - %v", line, err)
+		}
+		// The in-memory sink backing the model is always there.
+		if uri.Key == "metric" {
+			return nil, fmt.Errorf("invalid sink on line %d - the metric sink can only be configured with --sink", line)
+		}
+		uris = append(uris, uri)
+	}
+	return uris, scanner.Err()
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+)
+
+func TestAddRemoveSink(t *testing.T) {
+	sink1 := util.NewDummySink("s1", 0)
+	sink2 := util.NewDummySink("s2", 0)
+	manager, _ := NewDataSinkManager([]core.DataSink{sink1}, time.Second, time.Second)
+	sm := manager.(*sinkManager)
+
+	sm.addSink(sink2)
+	manager.ExportData(batchWithPoints())
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, sink1.GetExportCount())
+	assert.Equal(t, 1, sink2.GetExportCount())
+
+	// The removed sink is stopped by the time removeSink returns.
+	sm.removeSink(sink1)
+	assert.True(t, sink1.IsStopped())
+	manager.ExportData(batchWithPoints())
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, sink1.GetExportCount())
+	assert.Equal(t, 2, sink2.GetExportCount())
+	assert.Len(t, sm.Stats(), 1)
+}
+
+func TestSinkConfigWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink_config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sinks")
+	modTime := time.Now()
+	write := func(content string) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		// Every write is seen as a modification, even within the file system time resolution.
+		modTime = modTime.Add(time.Second)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	manager, _ := NewDataSinkManager([]core.DataSink{}, time.Second, time.Second)
+	sm := manager.(*sinkManager)
+
+	_, err = NewSinkConfigWatcher(manager, NewSinkFactory(), path)
+	assert.Error(t, err, "missing file")
+
+	write("# sinks added at runtime\nlog\n\n")
+	watcher, err := NewSinkConfigWatcher(manager, NewSinkFactory(), path)
+	require.NoError(t, err)
+	require.Len(t, sm.holders(), 1)
+	logSink := sm.holders()[0].sink
+	assert.Equal(t, "Log Sink", logSink.Name())
+
+	// Unchanged sinks are kept, the reconfigured ones are created again.
+	write("log\nlog:?namespaces=kube-system\n")
+	require.NoError(t, watcher.reload())
+	require.Len(t, sm.holders(), 2)
+	assert.Equal(t, logSink, sm.holders()[0].sink)
+	assert.IsType(t, &filterSink{}, sm.holders()[1].sink)
+
+	write("log:?namespaces=default\n")
+	require.NoError(t, watcher.reload())
+	require.Len(t, sm.holders(), 1)
+	assert.IsType(t, &filterSink{}, sm.holders()[0].sink)
+	assert.Equal(t, []string{"log:?namespaces=default"}, configuredSinks(watcher))
+
+	write("log:?namespaces=default\nlog:?namespaces=default&token=abc\n")
+	require.NoError(t, watcher.reload())
+	assert.Equal(t, []string{"log:?namespaces=default", "log:?namespaces=default&token=REDACTED"}, watcher.Uris())
+
+	// Sinks failing to be created are left out.
+	write("log:?namespaces=default\nnosuchsink\nlog:?namespaces=default&retries=1\n")
+	require.NoError(t, watcher.reload())
+	assert.Len(t, sm.holders(), 1)
+
+	// An invalid file keeps the previous sinks.
+	for _, content := range []string{":nokey\n", "log\nmetric\n"} {
+		write(content)
+		assert.Error(t, watcher.reload(), content)
+		assert.Len(t, sm.holders(), 1)
+	}
+
+	write("")
+	require.NoError(t, watcher.reload())
+	assert.Empty(t, sm.holders())
+}
+
+func configuredSinks(watcher *SinkConfigWatcher) []string {
+	result := []string{}
+	for key := range watcher.sinks {
+		result = append(result, key)
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// A sink wrapper exporting metrics under other names, to keep the dashboards and queries of a
+// backend working while migrating to other naming conventions. The aliased metrics are exported
+// under both their name and their aliases.
+type renameSink struct {
+	core.DataSink
+	// New name of the metrics, by old name.
+	renames map[string]string
+	// Other names under which the metrics are also exported, by name.
+	aliases map[string][]string
+}
+
+// Parses the `<old>:<new>` metric names of an option.
+func parseMetricNames(option string, values []string) (map[string][]string, error) {
+	result := make(map[string][]string, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("failed to parse `%s` flag - %q should be <old>:<new>", option, value)
+		}
+		result[parts[0]] = append(result[parts[0]], parts[1])
+	}
+	return result, nil
+}
+
+// Wraps the sink with the renaming given in the options of its uri, or returns it as is if it has none.
+func newRenameSink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	renames, err := parseMetricNames("renameMetric", opts["renameMetric"])
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := parseMetricNames("aliasMetric", opts["aliasMetric"])
+	if err != nil {
+		return nil, err
+	}
+	if len(renames) == 0 && len(aliases) == 0 {
+		return sink, nil
+	}
+	if _, ok := sink.(core.HttpSink); ok {
+		return nil, fmt.Errorf("metric renaming is not supported by sink %s", sink.Name())
+	}
+	this := &renameSink{
+		DataSink: sink,
+		renames:  make(map[string]string, len(renames)),
+		aliases:  aliases,
+	}
+	for from, to := range renames {
+		if len(to) > 1 {
+			return nil, fmt.Errorf("failed to parse `renameMetric` flag - metric %q is renamed several times", from)
+		}
+		this.renames[from] = to[0]
+	}
+	return this, nil
+}
+
+// Returns the names under which the metric is exported.
+func (this *renameSink) names(name string) []string {
+	result := []string{name}
+	if to, found := this.renames[name]; found {
+		result[0] = to
+	}
+	return append(result, this.aliases[name]...)
+}
+
+// Returns a copy of the metric values, under their new names.
+func (this *renameSink) renameValues(values map[string]core.MetricValue) map[string]core.MetricValue {
+	result := make(map[string]core.MetricValue, len(values))
+	for name, value := range values {
+		for _, to := range this.names(name) {
+			result[to] = value
+		}
+	}
+	return result
+}
+
+func (this *renameSink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *renameSink) exportData(data *core.DataBatch) error {
+	result := &core.DataBatch{
+		Timestamp:    data.Timestamp,
+		MetricSets:   make(map[string]*core.MetricSet, len(data.MetricSets)),
+		Completeness: data.Completeness,
+		OutOfBand:    data.OutOfBand,
+	}
+	for key, ms := range data.MetricSets {
+		msCopy := *ms
+		msCopy.MetricValues = this.renameValues(ms.MetricValues)
+		msCopy.LabeledMetrics = make([]core.LabeledMetric, 0, len(ms.LabeledMetrics))
+		for _, metric := range ms.LabeledMetrics {
+			for _, to := range this.names(metric.Name) {
+				metric.Name = to
+				msCopy.LabeledMetrics = append(msCopy.LabeledMetrics, metric)
+			}
+		}
+		if len(ms.RawSamples) > 0 {
+			msCopy.RawSamples = make([]core.RawSample, 0, len(ms.RawSamples))
+			for _, sample := range ms.RawSamples {
+				sample.MetricValues = this.renameValues(sample.MetricValues)
+				msCopy.RawSamples = append(msCopy.RawSamples, sample)
+			}
+		}
+		result.MetricSets[key] = &msCopy
+	}
+	return tryExportData(this.DataSink, result)
+}
+
+func (this *renameSink) AcceptsRawSamples() bool {
+	return acceptsRawSamples(this.DataSink)
+}
+
+func (this *renameSink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestRenameSink(t *testing.T) {
+	sink := &recordingSink{}
+	uri, err := url.Parse("?renameMetric=memory/usage:memory_bytes&renameMetric=filesystem/usage:fs_bytes" +
+		"&aliasMetric=cpu/usage_rate:cpu_usage_millicores&aliasMetric=cpu/usage_rate:cpu_millicores")
+	require.NoError(t, err)
+	wrapped, err := newRenameSink(sink, uri)
+	require.NoError(t, err)
+
+	value := func(v int64) core.MetricValue {
+		return core.MetricValue{ValueType: core.ValueInt64, IntValue: v}
+	}
+	data := &core.DataBatch{
+		Timestamp: time.Unix(1475323200, 0),
+		MetricSets: map[string]*core.MetricSet{
+			core.NodeKey("n1"): {
+				Labels: map[string]string{core.LabelNodename.Key: "n1"},
+				MetricValues: map[string]core.MetricValue{
+					"cpu/usage_rate": value(250),
+					"memory/usage":   value(1024),
+					"uptime":         value(10),
+				},
+				LabeledMetrics: []core.LabeledMetric{{
+					Name:        "filesystem/usage",
+					Labels:      map[string]string{core.LabelResourceID.Key: "/dev/sda1"},
+					MetricValue: value(10),
+				}},
+				RawSamples: []core.RawSample{{
+					MetricValues: map[string]core.MetricValue{"memory/usage": value(512)},
+				}},
+			},
+		},
+	}
+	wrapped.ExportData(data)
+
+	require.Len(t, sink.batches, 1)
+	ms := sink.batches[0].MetricSets[core.NodeKey("n1")]
+	assert.Equal(t, map[string]core.MetricValue{
+		"cpu/usage_rate":       value(250),
+		"cpu_usage_millicores": value(250),
+		"cpu_millicores":       value(250),
+		"memory_bytes":         value(1024),
+		"uptime":               value(10),
+	}, ms.MetricValues)
+	require.Len(t, ms.LabeledMetrics, 1)
+	assert.Equal(t, "fs_bytes", ms.LabeledMetrics[0].Name)
+	assert.Equal(t, "/dev/sda1", ms.LabeledMetrics[0].Labels[core.LabelResourceID.Key])
+	require.Len(t, ms.RawSamples, 1)
+	assert.Equal(t, map[string]core.MetricValue{"memory_bytes": value(512)}, ms.RawSamples[0].MetricValues)
+	// The batch of the other sinks is left untouched.
+	original := data.MetricSets[core.NodeKey("n1")]
+	assert.Len(t, original.MetricValues, 3)
+	assert.Contains(t, original.MetricValues, "memory/usage")
+	assert.Equal(t, "filesystem/usage", original.LabeledMetrics[0].Name)
+	assert.Contains(t, original.RawSamples[0].MetricValues, "memory/usage")
+}
@@ -0,0 +1,316 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxBackoff = 30 * time.Second
+	defaultDeadLetterSize  = 1000
+)
+
+var (
+	exporterRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "heapster",
+			Subsystem: "exporter",
+			Name:      "retries_total",
+			Help:      "Number of exports of a batch retried after a failure, for each exporter.",
+		},
+		[]string{"exporter"},
+	)
+	exporterDeadLetterBatches = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "exporter",
+			Name:      "dead_letter_batches",
+			Help:      "Number of batches spilled to the dead letter directory of the exporter, waiting to be exported again.",
+		},
+		[]string{"exporter"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(exporterRetries)
+	prometheus.MustRegister(exporterDeadLetterBatches)
+}
+
+// A sink wrapper retrying the failed exports with an exponential backoff. The batches which still
+// fail are dropped or, if a dead letter directory is configured, spilled there and exported again,
+// oldest first, along with the next batches.
+type retrySink struct {
+	core.DataSink
+	sink       core.RetryableSink
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	// Directory holding one file per spilled batch, empty if failed batches are dropped.
+	deadLetterDir  string
+	deadLetterSize int
+	// Age of the oldest batch kept in the directory relative to the latest batch, 0 if unbounded.
+	deadLetterAge time.Duration
+	// Files of the spilled batches, oldest first.
+	spilled []string
+	// Number of failed exports of the spilled batches, by file.
+	replayFailures map[string]int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Wraps the sink with the retries given in the options of its uri, or returns it as is if it has none.
+func newRetrySink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	if len(opts["retries"]) == 0 && len(opts["deadletter"]) == 0 {
+		return sink, nil
+	}
+	retryable, ok := sink.(core.RetryableSink)
+	if !ok {
+		return nil, fmt.Errorf("retries are not supported by sink %s", sink.Name())
+	}
+	this := &retrySink{
+		DataSink:       sink,
+		sink:           retryable,
+		backoff:        defaultRetryBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+		deadLetterSize: defaultDeadLetterSize,
+		replayFailures: make(map[string]int),
+		stop:           make(chan struct{}),
+	}
+	if len(opts["retries"]) >= 1 {
+		retries, err := strconv.Atoi(opts["retries"][0])
+		if err != nil || retries < 0 {
+			return nil, fmt.Errorf("failed to parse `retries` flag - %v", opts["retries"][0])
+		}
+		this.retries = retries
+	}
+	for _, option := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"retrybackoff", &this.backoff},
+		{"retrymaxbackoff", &this.maxBackoff},
+	} {
+		if len(opts[option.name]) >= 1 {
+			duration, err := time.ParseDuration(opts[option.name][0])
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("failed to parse `%s` flag - %v", option.name, opts[option.name][0])
+			}
+			*option.value = duration
+		}
+	}
+	if len(opts["deadlettersize"]) >= 1 {
+		size, err := strconv.Atoi(opts["deadlettersize"][0])
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("failed to parse `deadlettersize` flag - %v", opts["deadlettersize"][0])
+		}
+		this.deadLetterSize = size
+	}
+	if len(opts["deadletterage"]) >= 1 {
+		age, err := time.ParseDuration(opts["deadletterage"][0])
+		if err != nil || age <= 0 {
+			return nil, fmt.Errorf("failed to parse `deadletterage` flag - %v", opts["deadletterage"][0])
+		}
+		this.deadLetterAge = age
+	}
+	if len(opts["deadletter"]) >= 1 {
+		this.deadLetterDir = opts["deadletter"][0]
+		if err := os.MkdirAll(this.deadLetterDir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create dead letter directory: %v", err)
+		}
+		// Batches spilled before a restart are exported again with the next batches.
+		files, err := filepath.Glob(filepath.Join(this.deadLetterDir, "*"+blackoutBufferSuffix))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		this.spilled = files
+		exporterDeadLetterBatches.WithLabelValues(sink.Name()).Set(float64(len(files)))
+	}
+	return this, nil
+}
+
+func (this *retrySink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+// Returns the error of the last failed export of the batch, even if it was spilled.
+func (this *retrySink) exportData(data *core.DataBatch) error {
+	// The spilled batches go first, so that the backends get the points in order while they're up.
+	this.expire(data.Timestamp)
+	rejected := this.replay()
+	err := this.export(data)
+	if err == nil && rejected != "" {
+		this.reject(rejected)
+	}
+	if err != nil {
+		if this.deadLetterDir == "" {
+			glog.Errorf("Dropping batch of %v after %d failed exports to sink %s: %v", data.Timestamp, this.retries+1, this.Name(), err)
+			return err
+		}
+		if err := this.spill(data); err != nil {
+			glog.Errorf("Failed to spill batch of %v of sink %s: %v", data.Timestamp, this.Name(), err)
+			return err
+		}
+		return spilledError{err}
+	}
+	return nil
+}
+
+// The error of a failed export of a batch spilled to the dead letter directory, which isn't
+// dropped since it's exported again later.
+type spilledError struct {
+	error
+}
+
+// Exports the batch, retrying with an exponential backoff until it's exported, the retries are
+// exhausted or the sink is stopped.
+func (this *retrySink) export(data *core.DataBatch) error {
+	backoff := this.backoff
+	err := this.sink.TryExportData(data)
+	for attempt := 0; err != nil && attempt < this.retries; attempt++ {
+		glog.Warningf("Failed to export batch of %v to sink %s, retrying in %v: %v", data.Timestamp, this.Name(), backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-this.stop:
+			return err
+		}
+		exporterRetries.WithLabelValues(this.Name()).Inc()
+		err = this.sink.TryExportData(data)
+		if backoff *= 2; backoff > this.maxBackoff {
+			backoff = this.maxBackoff
+		}
+	}
+	return err
+}
+
+func (this *retrySink) spill(data *core.DataBatch) error {
+	if len(this.spilled) >= this.deadLetterSize {
+		glog.Warningf("Dead letter directory of sink %s is full, dropping the oldest batch", this.Name())
+		this.forget(this.spilled[0])
+		this.spilled = this.spilled[1:]
+	}
+	name, err := writeBufferedBatch(this.deadLetterDir, data)
+	if err != nil {
+		return err
+	}
+	this.spilled = append(this.spilled, name)
+	exporterDeadLetterBatches.WithLabelValues(this.Name()).Set(float64(len(this.spilled)))
+	return nil
+}
+
+// Exports the spilled batches once each, oldest first, until one fails, and returns the file of
+// the batch which failed, if any.
+func (this *retrySink) replay() string {
+	for len(this.spilled) > 0 {
+		name := this.spilled[0]
+		data, err := readBufferedBatch(name)
+		if err != nil {
+			glog.Errorf("Failed to read spilled batch %s: %v", name, err)
+		} else if err := this.sink.TryExportData(data); err != nil {
+			glog.V(2).Infof("Failed to export spilled batch of %v to sink %s: %v", data.Timestamp, this.Name(), err)
+			return name
+		}
+		this.forget(name)
+		this.spilled = this.spilled[1:]
+		exporterDeadLetterBatches.WithLabelValues(this.Name()).Set(float64(len(this.spilled)))
+	}
+	return ""
+}
+
+// Counts a failed export of the oldest spilled batch while the backend accepted the next batch. A
+// spilled batch failing once more than a batch is retried is dropped, so that a batch the backend
+// rejects doesn't hold back the others, unless the directory has an age, which bounds the outages
+// instead. The failures during outages aren't counted, so that they don't drop the batches the
+// directory is there to keep.
+func (this *retrySink) reject(name string) {
+	this.replayFailures[name]++
+	if this.deadLetterAge > 0 || this.replayFailures[name] <= this.retries {
+		return
+	}
+	glog.Errorf("Dropping spilled batch %s after %d failed exports to sink %s while the next batches were exported", name, this.replayFailures[name], this.Name())
+	this.forget(name)
+	this.spilled = this.spilled[1:]
+	exporterDeadLetterBatches.WithLabelValues(this.Name()).Set(float64(len(this.spilled)))
+}
+
+// Drops the spilled batches older than the age of the dead letter directory, so that an outage
+// longer than it doesn't flood the backend with stale points once it recovers.
+func (this *retrySink) expire(now time.Time) {
+	if this.deadLetterAge == 0 {
+		return
+	}
+	expired := 0
+	for _, name := range this.spilled {
+		timestamp, err := bufferedBatchTime(name)
+		if err == nil && now.Sub(timestamp) <= this.deadLetterAge {
+			break
+		}
+		this.forget(name)
+		expired++
+	}
+	if expired == 0 {
+		return
+	}
+	glog.Warningf("Dropping %d spilled batches of sink %s older than %v", expired, this.Name(), this.deadLetterAge)
+	this.spilled = this.spilled[expired:]
+	exporterDeadLetterBatches.WithLabelValues(this.Name()).Set(float64(len(this.spilled)))
+}
+
+// Returns the timestamp of the batch written in the file by writeBufferedBatch.
+func bufferedBatchTime(name string) (time.Time, error) {
+	base := strings.TrimSuffix(filepath.Base(name), blackoutBufferSuffix)
+	if i := strings.IndexByte(base, '_'); i >= 0 {
+		base = base[:i]
+	}
+	nanos, err := strconv.ParseInt(base, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid name of buffered batch %s", name)
+	}
+	return time.Unix(0, nanos), nil
+}
+
+func (this *retrySink) forget(name string) {
+	os.Remove(name)
+	delete(this.replayFailures, name)
+}
+
+func (this *retrySink) Stop() {
+	this.stopOnce.Do(func() { close(this.stop) })
+	this.DataSink.Stop()
+}
+
+func (this *retrySink) AcceptsRawSamples() bool {
+	return acceptsRawSamples(this.DataSink)
+}
+
+func (this *retrySink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
@@ -0,0 +1,228 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// A retryable sink failing while it's down.
+type flakySink struct {
+	recordingSink
+	down     bool
+	attempts int
+}
+
+func (this *flakySink) TryExportData(data *core.DataBatch) error {
+	this.attempts++
+	if this.down {
+		return errors.New("backend down")
+	}
+	this.recordingSink.ExportData(data)
+	return nil
+}
+
+func (this *flakySink) ExportData(data *core.DataBatch) {
+	this.TryExportData(data)
+}
+
+// Goes up again after the given number of failed attempts.
+type recoveringSink struct {
+	flakySink
+	failures int
+}
+
+func (this *recoveringSink) TryExportData(data *core.DataBatch) error {
+	this.down = this.attempts < this.failures
+	return this.flakySink.TryExportData(data)
+}
+
+// A retryable sink rejecting the batch of the given time.
+type rejectingSink struct {
+	flakySink
+	rejected time.Time
+}
+
+func (this *rejectingSink) TryExportData(data *core.DataBatch) error {
+	if data.Timestamp.Equal(this.rejected) {
+		this.attempts++
+		return errors.New("rejected")
+	}
+	return this.flakySink.TryExportData(data)
+}
+
+func newTestRetrySink(t *testing.T, sink core.DataSink, query string) *retrySink {
+	uri, err := url.Parse("?" + query)
+	require.NoError(t, err)
+	wrapped, err := newRetrySink(sink, uri)
+	require.NoError(t, err)
+	return wrapped.(*retrySink)
+}
+
+func batchAt(minute int) *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp:  time.Date(2016, 10, 1, 0, minute, 0, 0, time.UTC),
+		MetricSets: map[string]*core.MetricSet{},
+	}
+}
+
+func TestRetrySink(t *testing.T) {
+	sink := &recoveringSink{failures: 2}
+	wrapped := newTestRetrySink(t, sink, "retries=3&retrybackoff=1ms")
+
+	wrapped.ExportData(batchAt(0))
+	assert.Equal(t, 3, sink.attempts)
+	assert.Equal(t, []time.Time{batchAt(0).Timestamp}, sink.timestamps)
+
+	// Without a dead letter directory the batch is dropped after the retries.
+	sink.failures = 100
+	wrapped.ExportData(batchAt(1))
+	assert.Equal(t, 7, sink.attempts)
+	assert.Len(t, sink.timestamps, 1)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	sink := &flakySink{down: true}
+	wrapped := newTestRetrySink(t, sink, "retries=4&retrybackoff=10ms&retrymaxbackoff=20ms")
+
+	start := time.Now()
+	wrapped.ExportData(batchAt(0))
+	// 10ms, 20ms, 20ms and 20ms.
+	assert.True(t, time.Since(start) >= 70*time.Millisecond)
+	assert.Equal(t, 5, sink.attempts)
+
+	// Stopping the sink interrupts the retries.
+	wrapped = newTestRetrySink(t, sink, "retries=4&retrybackoff=1h")
+	wrapped.Stop()
+	wrapped.Stop()
+	wrapped.ExportData(batchAt(0))
+	assert.Equal(t, 6, sink.attempts)
+}
+
+func TestDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &flakySink{down: true}
+	wrapped := newTestRetrySink(t, sink, "retries=1&retrybackoff=1ms&deadlettersize=2&deadletter="+dir)
+	for minute := 0; minute < 3; minute++ {
+		wrapped.ExportData(batchAt(minute))
+	}
+	// The oldest batch was dropped once the directory was full.
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Empty(t, sink.timestamps)
+
+	// The spilled batches are exported after a restart, before the new batch.
+	wrapped = newTestRetrySink(t, sink, "retries=1&retrybackoff=1ms&deadletter="+dir)
+	require.Len(t, wrapped.spilled, 2)
+	sink.down = false
+	wrapped.ExportData(batchAt(3))
+	assert.Equal(t, []time.Time{batchAt(1).Timestamp, batchAt(2).Timestamp, batchAt(3).Timestamp}, sink.timestamps)
+	files, err = filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestDeadLetterReplayFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &rejectingSink{flakySink: flakySink{down: true}, rejected: batchAt(0).Timestamp}
+	wrapped := newTestRetrySink(t, sink, "retrybackoff=1ms&deadletter="+dir)
+	// Even without retries, the spilled batches are kept for as long as the backend is down.
+	for minute := 0; minute < 3; minute++ {
+		wrapped.ExportData(batchAt(minute))
+	}
+	require.Len(t, wrapped.spilled, 3)
+
+	// A spilled batch the backend rejects while it accepts the next batch is dropped.
+	sink.down = false
+	wrapped.ExportData(batchAt(3))
+	assert.Equal(t, []time.Time{batchAt(3).Timestamp}, sink.timestamps)
+	require.Len(t, wrapped.spilled, 2)
+	assert.Equal(t, wrapped.spilled[0], filepath.Join(dir, fmt.Sprintf("%020d.batch", batchAt(1).Timestamp.UnixNano())))
+
+	wrapped.ExportData(batchAt(4))
+	assert.Equal(t, []time.Time{batchAt(3).Timestamp, batchAt(1).Timestamp, batchAt(2).Timestamp, batchAt(4).Timestamp}, sink.timestamps)
+	assert.Empty(t, wrapped.spilled)
+}
+
+func TestDeadLetterSameTimestamp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &flakySink{down: true}
+	wrapped := newTestRetrySink(t, sink, "deadletter="+dir)
+	wrapped.ExportData(batchAt(0))
+	wrapped.ExportData(batchAt(0))
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// Both are exported after a restart.
+	wrapped = newTestRetrySink(t, sink, "deadletter="+dir)
+	require.Len(t, wrapped.spilled, 2)
+	sink.down = false
+	wrapped.ExportData(batchAt(1))
+	assert.Equal(t, []time.Time{batchAt(0).Timestamp, batchAt(0).Timestamp, batchAt(1).Timestamp}, sink.timestamps)
+}
+
+func TestDeadLetterAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &flakySink{down: true}
+	wrapped := newTestRetrySink(t, sink, "retrybackoff=1ms&deadletterage=5m&deadletter="+dir)
+	for minute := 0; minute < 10; minute++ {
+		wrapped.ExportData(batchAt(minute))
+	}
+	// The batches of the 5 minutes before the latest one are kept.
+	require.Len(t, wrapped.spilled, 6)
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Len(t, files, 6)
+
+	// They are replayed once the backend recovers.
+	sink.down = false
+	wrapped.ExportData(batchAt(10))
+	require.Len(t, sink.timestamps, 6)
+	assert.Equal(t, batchAt(5).Timestamp, sink.timestamps[0])
+	assert.Empty(t, wrapped.spilled)
+}
+
+func TestRetriesNeedRetryableSink(t *testing.T) {
+	uri, err := url.Parse("?retries=3")
+	require.NoError(t, err)
+	_, err = newRetrySink(&recordingSink{}, uri)
+	assert.Error(t, err)
+}
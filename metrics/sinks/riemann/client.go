@@ -0,0 +1,121 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riemann
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	pb "github.com/golang/protobuf/proto"
+	riemann_api "github.com/rikatz/goryman"
+	"github.com/rikatz/goryman/proto"
+)
+
+const (
+	dialTimeout = 5 * time.Second
+	// Deadline of sending a message and reading its acknowledgement.
+	sendTimeout = 30 * time.Second
+)
+
+// Sends the events one by one with the goryman client, over UDP when they fit in a datagram
+// and over TCP otherwise.
+type gorymanClient struct {
+	*riemann_api.GorymanClient
+}
+
+func (this gorymanClient) SendEvents(events []*riemann_api.Event) error {
+	for _, event := range events {
+		if err := this.SendEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sends batches of events in a single protobuf message over TCP, or TLS if configured, and
+// waits for Riemann to acknowledge each of them.
+type batchClient struct {
+	addr      string
+	tlsConfig *tls.Config
+	conn      net.Conn
+}
+
+func (this *batchClient) Connect() error {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var err error
+	if this.tlsConfig != nil {
+		this.conn, err = tls.DialWithDialer(dialer, "tcp", this.addr, this.tlsConfig)
+	} else {
+		this.conn, err = dialer.Dial("tcp", this.addr)
+	}
+	return err
+}
+
+func (this *batchClient) Close() error {
+	if this.conn == nil {
+		return nil
+	}
+	err := this.conn.Close()
+	this.conn = nil
+	return err
+}
+
+func (this *batchClient) SendEvents(events []*riemann_api.Event) error {
+	if this.conn == nil {
+		return errors.New("not connected to Riemann")
+	}
+	message := &proto.Msg{Events: make([]*proto.Event, 0, len(events))}
+	for _, event := range events {
+		converted, err := riemann_api.EventToProtocolBuffer(event)
+		if err != nil {
+			return err
+		}
+		message.Events = append(message.Events, converted)
+	}
+	data, err := pb.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	// Messages are prefixed with their length, in both directions.
+	this.conn.SetDeadline(time.Now().Add(sendTimeout))
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	if _, err := this.conn.Write(frame); err != nil {
+		return err
+	}
+	var length uint32
+	if err := binary.Read(this.conn, binary.BigEndian, &length); err != nil {
+		return err
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(this.conn, response); err != nil {
+		return err
+	}
+	ack := &proto.Msg{}
+	if err := pb.Unmarshal(response, ack); err != nil {
+		return err
+	}
+	if !ack.GetOk() {
+		return fmt.Errorf("riemann refused %d events: %s", len(events), ack.GetError())
+	}
+	return nil
+}
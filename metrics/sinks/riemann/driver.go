@@ -15,10 +15,16 @@
 package riemann
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/url"
 	"reflect"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 
 	"time"
@@ -26,6 +32,7 @@ import (
 	"github.com/golang/glog"
 	riemann_api "github.com/rikatz/goryman"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/batching"
 )
 
 // Abstracted for testing: this package works against any client that obeys the
@@ -34,12 +41,13 @@ import (
 type riemannClient interface {
 	Connect() error
 	Close() error
-	SendEvent(e *riemann_api.Event) error
+	SendEvents(events []*riemann_api.Event) error
 }
 
 type riemannSink struct {
-	client riemannClient
-	config riemannConfig
+	client    riemannClient
+	config    riemannConfig
+	batchSize *batching.BatchSize
 	sync.RWMutex
 }
 
@@ -48,11 +56,41 @@ type riemannConfig struct {
 	ttl   float32
 	state string
 	tags  []string
+	// TTLs and state thresholds of specific metrics.
+	metricTtls   map[string]float32
+	metricStates map[string]stateThresholds
+	// Whether the events are sent in batches over TCP rather than one by one with the goryman
+	// client, and the TLS configuration of the connection if any.
+	batched   bool
+	tlsConfig *tls.Config
+}
+
+// Values of a metric from which its events are in the warning and critical states, ok below.
+// Lower values are worse if critical is below warning, e.g. for available bytes.
+type stateThresholds struct {
+	warning  float64
+	critical float64
+}
+
+func (this stateThresholds) state(value float64) string {
+	worse := func(value, threshold float64) bool {
+		if this.critical < this.warning {
+			return value <= threshold
+		}
+		return value >= threshold
+	}
+	switch {
+	case worse(value, this.critical):
+		return "critical"
+	case worse(value, this.warning):
+		return "warning"
+	}
+	return "ok"
 }
 
 const (
-	// Maximum number of riemann Events to be sent in one batch.
-	maxSendBatchSize = 10000
+	// Events sent in one message by default, one by one.
+	defaultBatchSize = 1
 	max_retries      = 2
 )
 
@@ -80,14 +118,28 @@ func CreateRiemannSink(uri *url.URL) (core.DataSink, error) {
 	if len(options["tags"]) > 0 {
 		c.tags = options["tags"]
 	}
+	var err error
+	if c.metricTtls, err = parseMetricTtls(options["metricttl"]); err != nil {
+		return nil, err
+	}
+	if c.metricStates, err = parseMetricStates(options["metricstate"]); err != nil {
+		return nil, err
+	}
+	if c.tlsConfig, err = parseTLSConfig(options, c.host); err != nil {
+		return nil, err
+	}
+	c.batched = c.tlsConfig != nil || len(options["batchsize"]) > 0 || len(options["adaptivebatch"]) > 0
 
 	glog.Infof("Riemann sink URI: '%+v', host: '%+v', options: '%+v', ", uri, c.host, options)
 	rs := &riemannSink{
 		client: nil,
 		config: c,
 	}
+	if rs.batchSize, err = batching.NewBatchSize(rs.Name(), options, defaultBatchSize); err != nil {
+		return nil, err
+	}
 
-	err := rs.setupRiemannClient()
+	err = rs.setupRiemannClient()
 	if err != nil {
 		glog.Warningf("Riemann sink not connected: %v", err)
 		// Warn but return the sink.
@@ -95,14 +147,109 @@ func CreateRiemannSink(uri *url.URL) (core.DataSink, error) {
 	return rs, nil
 }
 
+// Parses repeated <metric>:<seconds> options.
+func parseMetricTtls(values []string) (map[string]float32, error) {
+	result := make(map[string]float32, len(values))
+	for _, value := range values {
+		sep := strings.LastIndex(value, ":")
+		if sep <= 0 {
+			return nil, fmt.Errorf("failed to parse `metricttl` flag - %q should be <metric>:<seconds>", value)
+		}
+		ttl, err := strconv.ParseFloat(value[sep+1:], 32)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("failed to parse `metricttl` flag - %q should be <metric>:<seconds>", value)
+		}
+		result[value[:sep]] = float32(ttl)
+	}
+	return result, nil
+}
+
+// Parses repeated <metric>:<warning>:<critical> options.
+func parseMetricStates(values []string) (map[string]stateThresholds, error) {
+	result := make(map[string]stateThresholds, len(values))
+	for _, value := range values {
+		parts := strings.Split(value, ":")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("failed to parse `metricstate` flag - %q should be <metric>:<warning>:<critical>", value)
+		}
+		n := len(parts)
+		warning, err := strconv.ParseFloat(parts[n-2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `metricstate` flag - %q should be <metric>:<warning>:<critical>", value)
+		}
+		critical, err := strconv.ParseFloat(parts[n-1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `metricstate` flag - %q should be <metric>:<warning>:<critical>", value)
+		}
+		result[strings.Join(parts[:n-2], ":")] = stateThresholds{warning: warning, critical: critical}
+	}
+	return result, nil
+}
+
+// Returns the TLS configuration of the `tls`, `cacert`, `cert`, `key`, `servername` and
+// `insecure` options, nil if TLS isn't enabled.
+func parseTLSConfig(options url.Values, host string) (*tls.Config, error) {
+	if len(options["tls"]) == 0 {
+		return nil, nil
+	}
+	useTLS, err := strconv.ParseBool(options["tls"][0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse `tls` flag - %v", err)
+	}
+	if !useTLS {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if serverName, _, err := net.SplitHostPort(host); err == nil {
+		config.ServerName = serverName
+	}
+	if len(options["servername"]) >= 1 {
+		config.ServerName = options["servername"][0]
+	}
+	if len(options["cacert"]) >= 1 {
+		pem, err := ioutil.ReadFile(options["cacert"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read `cacert` file - %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to parse `cacert` file - no certificate found")
+		}
+	}
+	if len(options["cert"]) >= 1 || len(options["key"]) >= 1 {
+		if len(options["cert"]) == 0 || len(options["key"]) == 0 {
+			return nil, fmt.Errorf("both `cert` and `key` flags are required for client authentication")
+		}
+		certificate, err := tls.LoadX509KeyPair(options["cert"][0], options["key"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate - %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	if len(options["insecure"]) >= 1 {
+		if config.InsecureSkipVerify, err = strconv.ParseBool(options["insecure"][0]); err != nil {
+			return nil, fmt.Errorf("failed to parse `insecure` flag - %v", err)
+		}
+	}
+	return config, nil
+}
+
 func (rs *riemannSink) setupRiemannClient() error {
+	if rs.config.batched {
+		client := &batchClient{addr: rs.config.host, tlsConfig: rs.config.tlsConfig}
+		if err := client.Connect(); err != nil {
+			return err
+		}
+		rs.client = client
+		return nil
+	}
 	client := riemann_api.NewGorymanClient(rs.config.host)
-	runtime.SetFinalizer(client, func(c riemannClient) { c.Close() })
+	runtime.SetFinalizer(client, func(c *riemann_api.GorymanClient) { c.Close() })
 	err := client.Connect()
 	if err != nil {
 		return err
 	}
-	rs.client = client
+	rs.client = gorymanClient{client}
 	return nil
 }
 
@@ -127,9 +274,9 @@ func (sink *riemannSink) ExportData(dataBatch *core.DataBatch) {
 		}
 	}
 
-	var dataEvents []riemann_api.Event
+	var dataEvents []*riemann_api.Event
 	appendMetric := func(host, name string, value interface{}, labels map[string]string) {
-		event := riemann_api.Event{
+		event := &riemann_api.Event{
 			Time:        dataBatch.Timestamp.Unix(),
 			Service:     name,
 			Host:        host,
@@ -140,12 +287,13 @@ func (sink *riemannSink) ExportData(dataBatch *core.DataBatch) {
 			State:       sink.config.state,
 			Tags:        sink.config.tags,
 		}
-
-		dataEvents = append(dataEvents, event)
-		if len(dataEvents) >= maxSendBatchSize {
-			sink.sendData(dataEvents)
-			dataEvents = nil
+		if ttl, found := sink.config.metricTtls[name]; found {
+			event.Ttl = ttl
+		}
+		if thresholds, found := sink.config.metricStates[name]; found {
+			event.State = thresholds.state(floatValue(value))
 		}
+		dataEvents = append(dataEvents, event)
 	}
 
 	riemannValue := func(value interface{}) interface{} {
@@ -182,25 +330,64 @@ func (sink *riemannSink) ExportData(dataBatch *core.DataBatch) {
 	}
 }
 
-func (sink *riemannSink) sendData(dataEvents []riemann_api.Event) {
+func floatValue(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// Sends the events in messages of the batch size of the sink.
+func (sink *riemannSink) sendData(dataEvents []*riemann_api.Event) {
 	if sink.client == nil {
 		return
 	}
 
 	start := time.Now()
+	total := len(dataEvents)
 	errors := 0
-	for _, event := range dataEvents {
-		glog.V(8).Infof("Sending event to Riemann:  %+v", event)
+	for len(dataEvents) > 0 {
+		size := sink.batchSize.Size()
+		if size > len(dataEvents) {
+			size = len(dataEvents)
+		}
+		batch := dataEvents[:size]
+		dataEvents = dataEvents[size:]
+
+		glog.V(8).Infof("Sending %d events to Riemann, the first one: %+v", len(batch), batch[0])
 		var err error
 		for try := 0; try < max_retries; try++ {
-			err = sink.client.SendEvent(&event)
+			if try > 0 {
+				// A failed message may still be acknowledged later on the same connection, which
+				// would then acknowledge the retry in its place.
+				sink.client.Close()
+				if err = sink.client.Connect(); err != nil {
+					break
+				}
+			}
+			sendStart := time.Now()
+			err = sink.client.SendEvents(batch)
+			sink.batchSize.Record(len(batch), time.Since(sendStart), err)
 			if err == nil {
 				break
 			}
 		}
 		if err != nil {
-			errors++
-			glog.V(4).Infof("Failed to send event to Riemann: %+v: %+v", event, err)
+			errors += len(batch)
+			glog.V(4).Infof("Failed to send %d events to Riemann: %+v", len(batch), err)
+			if sink.config.batched {
+				// The stream may be out of sync, it is reopened on the next export and the
+				// remaining events are dropped.
+				errors += len(dataEvents)
+				break
+			}
 		}
 	}
 	end := time.Now()
@@ -209,5 +396,5 @@ func (sink *riemannSink) sendData(dataEvents []riemann_api.Event) {
 		sink.client.Close()
 		sink.client = nil
 	}
-	glog.V(4).Infof("Exported %d events to riemann in %s", len(dataEvents)-errors, end.Sub(start))
+	glog.V(4).Infof("Exported %d events to riemann in %s", total-errors, end.Sub(start))
 }
@@ -15,14 +15,21 @@
 package riemann
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"testing"
 	"time"
 
+	pb "github.com/golang/protobuf/proto"
 	riemann_api "github.com/rikatz/goryman"
+	"github.com/rikatz/goryman/proto"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/batching"
 )
 
 type eventSendToRiemann struct {
@@ -50,9 +57,11 @@ func (client *fakeRiemannClient) Close() error {
 	return nil
 }
 
-func (client *fakeRiemannClient) SendEvent(e *riemann_api.Event) error {
-	eventsJson, _ := json.Marshal(e)
-	client.events = append(client.events, eventSendToRiemann{event: string(eventsJson)})
+func (client *fakeRiemannClient) SendEvents(events []*riemann_api.Event) error {
+	for _, e := range events {
+		eventsJson, _ := json.Marshal(e)
+		client.events = append(client.events, eventSendToRiemann{event: string(eventsJson)})
+	}
 	return nil
 }
 
@@ -68,8 +77,9 @@ func NewFakeSink() fakeRiemannSink {
 
 	return fakeRiemannSink{
 		&riemannSink{
-			client: riemannClient,
-			config: c,
+			client:    riemannClient,
+			config:    c,
+			batchSize: batching.Fixed(1),
 		},
 		riemannClient,
 	}
@@ -195,3 +205,164 @@ func TestStoreMultipleDataInput(t *testing.T) {
 		assert.Contains(t, eventsString, expectEvt)
 	}
 }
+
+func TestMetricTtlsAndStates(t *testing.T) {
+	fakeSink := NewFakeSink()
+	sink := fakeSink.DataSink.(*riemannSink)
+	var err error
+	sink.config.metricTtls, err = parseMetricTtls([]string{"memory/usage:300"})
+	assert.NoError(t, err)
+	sink.config.metricStates, err = parseMetricStates([]string{"cpu/usage_rate:800:950", "filesystem/available:2000:1000"})
+	assert.NoError(t, err)
+
+	metricSet := func(name string, value int64) *core.MetricSet {
+		return &core.MetricSet{
+			Labels: map[string]string{},
+			MetricValues: map[string]core.MetricValue{
+				name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: value},
+			},
+		}
+	}
+	fakeSink.ExportData(&core.DataBatch{
+		Timestamp: time.Unix(1000, 0),
+		MetricSets: map[string]*core.MetricSet{
+			"1": metricSet("memory/usage", 10),
+			"2": metricSet("cpu/usage_rate", 500),
+			"3": metricSet("cpu/usage_rate", 900),
+			"4": metricSet("cpu/usage_rate", 960),
+			"5": metricSet("filesystem/available", 1500),
+		},
+	})
+
+	eventsString := fmt.Sprintf("%s", fakeSink.fakeRiemannClient.events)
+	assert.Contains(t, eventsString, `{"Ttl":300,"Time":1000,"Tags":[],"Host":"","State":"","Service":"memory/usage","Metric":10,`)
+	assert.Contains(t, eventsString, `"State":"ok","Service":"cpu/usage_rate","Metric":500,`)
+	assert.Contains(t, eventsString, `"State":"warning","Service":"cpu/usage_rate","Metric":900,`)
+	assert.Contains(t, eventsString, `"State":"critical","Service":"cpu/usage_rate","Metric":960,`)
+	// Lower values are worse when the critical threshold is below the warning one.
+	assert.Contains(t, eventsString, `"State":"warning","Service":"filesystem/available","Metric":1500,`)
+}
+
+func TestCreateRiemannSinkErrors(t *testing.T) {
+	for _, query := range []string{
+		"metricttl=memory/usage",
+		"metricttl=memory/usage:soon",
+		"metricstate=cpu/usage_rate:800",
+		"metricstate=cpu/usage_rate:high:950",
+		"tls=maybe",
+		"tls=true&cacert=/nonexistent",
+		"tls=true&cert=/tmp/cert.pem",
+		"batchsize=0",
+	} {
+		uri, err := url.Parse("riemann://127.0.0.1:1/?" + query)
+		assert.NoError(t, err)
+		_, err = CreateRiemannSink(uri)
+		assert.Error(t, err, query)
+	}
+}
+
+// A Riemann server acknowledging the messages it receives over TCP, except the first unacked ones,
+// after which it closes the connection.
+func fakeRiemannServer(t *testing.T, unacked int) (net.Listener, chan int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	received := make(chan int, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			for {
+				var length uint32
+				if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+					break
+				}
+				data := make([]byte, length)
+				if _, err := io.ReadFull(conn, data); err != nil {
+					break
+				}
+				message := &proto.Msg{}
+				if err := pb.Unmarshal(data, message); err != nil {
+					break
+				}
+				received <- len(message.Events)
+				if unacked > 0 {
+					unacked--
+					break
+				}
+				ack, _ := pb.Marshal(&proto.Msg{Ok: pb.Bool(true)})
+				binary.Write(conn, binary.BigEndian, uint32(len(ack)))
+				conn.Write(ack)
+			}
+			conn.Close()
+		}
+	}()
+	return listener, received
+}
+
+func TestBatchedRiemannSink(t *testing.T) {
+	listener, received := fakeRiemannServer(t, 0)
+	defer listener.Close()
+
+	uri, err := url.Parse("riemann://" + listener.Addr().String() + "/?batchsize=2")
+	assert.NoError(t, err)
+	sink, err := CreateRiemannSink(uri)
+	assert.NoError(t, err)
+	defer sink.Stop()
+
+	metricSets := make(map[string]*core.MetricSet)
+	for i := 0; i < 5; i++ {
+		metricSets[fmt.Sprintf("pod%d", i)] = &core.MetricSet{
+			Labels: map[string]string{core.LabelHostname.Key: "node1"},
+			MetricValues: map[string]core.MetricValue{
+				"memory/usage": {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: int64(i)},
+			},
+		}
+	}
+	sink.ExportData(&core.DataBatch{Timestamp: time.Now(), MetricSets: metricSets})
+
+	var batches []int
+	for i := 0; i < 3; i++ {
+		select {
+		case events := <-received:
+			batches = append(batches, events)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Riemann didn't receive all the batches: %v", batches)
+		}
+	}
+	assert.Equal(t, []int{2, 2, 1}, batches)
+}
+
+func TestBatchedRiemannSinkReconnectsToRetry(t *testing.T) {
+	listener, received := fakeRiemannServer(t, 1)
+	defer listener.Close()
+
+	uri, err := url.Parse("riemann://" + listener.Addr().String() + "/?batchsize=10")
+	assert.NoError(t, err)
+	sink, err := CreateRiemannSink(uri)
+	assert.NoError(t, err)
+	defer sink.Stop()
+
+	sink.ExportData(&core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			"pod1": {
+				Labels: map[string]string{core.LabelHostname.Key: "node1"},
+				MetricValues: map[string]core.MetricValue{
+					"memory/usage": {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 1},
+				},
+			},
+		},
+	})
+	// The unacknowledged message was sent again over a new connection.
+	for i := 0; i < 2; i++ {
+		select {
+		case events := <-received:
+			assert.Equal(t, 1, events)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Riemann didn't receive the message %d times", i+1)
+		}
+	}
+	assert.NotNil(t, sink.(*riemannSink).client)
+}
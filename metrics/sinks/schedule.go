@@ -0,0 +1,327 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	defaultBlackoutBufferSize = 1000
+	blackoutBufferSuffix      = ".batch"
+)
+
+// A cron-like schedule with minute, hour, day of month, month and day of week fields,
+// evaluated in UTC. Each field holds the set of accepted values as a bit mask.
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// Whether the day fields were restricted, in which case a day matches if either does.
+	dayOfMonthAny, dayOfWeekAny bool
+}
+
+var cronFieldRanges = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// Parses a schedule of five space separated fields. Every field is `*` or a comma separated
+// list of values or ranges `a-b`, optionally followed by a step `/n`.
+func parseCronSchedule(text string) (*cronSchedule, error) {
+	fields := strings.Fields(text)
+	if len(fields) != len(cronFieldRanges) {
+		return nil, fmt.Errorf("invalid schedule %q: expected %d fields, got %d", text, len(cronFieldRanges), len(fields))
+	}
+	masks := make([]uint64, len(fields))
+	for i, field := range fields {
+		mask, err := parseCronField(field, cronFieldRanges[i].min, cronFieldRanges[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in schedule %q: %v", cronFieldRanges[i].name, text, err)
+		}
+		masks[i] = mask
+	}
+	return &cronSchedule{
+		minute:        masks[0],
+		hour:          masks[1],
+		dayOfMonth:    masks[2],
+		month:         masks[3],
+		dayOfWeek:     masks[4],
+		dayOfMonthAny: fields[2] == "*",
+		dayOfWeekAny:  fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		first, last := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if first, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			last = first
+			if len(bounds) > 1 {
+				if last, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			}
+		}
+		if first < min || last > max || first > last {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := first; v <= last; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+func (this *cronSchedule) matches(t time.Time) bool {
+	t = t.UTC()
+	if this.minute&(1<<uint(t.Minute())) == 0 || this.hour&(1<<uint(t.Hour())) == 0 || this.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dayOfMonth := this.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := this.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if this.dayOfMonthAny || this.dayOfWeekAny {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// A recurring period starting at the times of the schedule and lasting the given duration.
+type blackoutWindow struct {
+	schedule *cronSchedule
+	duration time.Duration
+}
+
+// Tells whether the window is open at the given time, i.e. whether the schedule matched
+// a minute in the last duration.
+func (this *blackoutWindow) contains(t time.Time) bool {
+	earliest := t.Add(-this.duration)
+	for start := t.Truncate(time.Minute); start.After(earliest); start = start.Add(-time.Minute) {
+		if this.schedule.matches(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses a window given as `<schedule>,<duration>`, e.g. `0 2 * * 0,2h`.
+func parseBlackoutWindow(text string) (blackoutWindow, error) {
+	i := strings.LastIndex(text, ",")
+	if i < 0 {
+		return blackoutWindow{}, fmt.Errorf("invalid blackout %q: expected <schedule>,<duration>", text)
+	}
+	schedule, err := parseCronSchedule(text[:i])
+	if err != nil {
+		return blackoutWindow{}, err
+	}
+	duration, err := time.ParseDuration(text[i+1:])
+	if err != nil || duration <= 0 {
+		return blackoutWindow{}, fmt.Errorf("invalid blackout duration %q", text[i+1:])
+	}
+	return blackoutWindow{schedule: schedule, duration: duration}, nil
+}
+
+// A sink wrapper pausing the exports during blackout windows. Batches exported during a
+// window are dropped or, if a buffer directory is configured, stored there and exported
+// in order once the window is over.
+type scheduledSink struct {
+	core.DataSink
+	windows []blackoutWindow
+	// Directory holding one file per buffered batch, empty if batches are dropped.
+	bufferDir  string
+	bufferSize int
+	// Files of the buffered batches, oldest first.
+	buffered []string
+	nowFunc  func() time.Time
+}
+
+// Wraps the sink with the blackout windows given in the options of its uri, or returns it
+// as is if it has none.
+func newScheduledSink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	if len(opts["blackout"]) == 0 {
+		return sink, nil
+	}
+	if _, ok := sink.(core.HttpSink); ok {
+		return nil, fmt.Errorf("blackout windows are not supported by sink %s", sink.Name())
+	}
+	this := &scheduledSink{
+		DataSink:   sink,
+		bufferSize: defaultBlackoutBufferSize,
+		nowFunc:    time.Now,
+	}
+	for _, text := range opts["blackout"] {
+		window, err := parseBlackoutWindow(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `blackout` flag - %v", err)
+		}
+		this.windows = append(this.windows, window)
+	}
+	if len(opts["blackoutbuffersize"]) >= 1 {
+		size, err := strconv.Atoi(opts["blackoutbuffersize"][0])
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("failed to parse `blackoutbuffersize` flag - %v", opts["blackoutbuffersize"][0])
+		}
+		this.bufferSize = size
+	}
+	if len(opts["blackoutbuffer"]) >= 1 {
+		this.bufferDir = opts["blackoutbuffer"][0]
+		if err := os.MkdirAll(this.bufferDir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create blackout buffer directory: %v", err)
+		}
+		// Batches buffered before a restart are exported after the next window.
+		files, err := filepath.Glob(filepath.Join(this.bufferDir, "*"+blackoutBufferSuffix))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		this.buffered = files
+	}
+	return this, nil
+}
+
+func (this *scheduledSink) inBlackout(t time.Time) bool {
+	for i := range this.windows {
+		if this.windows[i].contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *scheduledSink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *scheduledSink) exportData(data *core.DataBatch) error {
+	if this.inBlackout(this.nowFunc()) {
+		if this.bufferDir == "" {
+			glog.V(2).Infof("Dropping data during blackout of sink %s", this.DataSink.Name())
+			return nil
+		}
+		if err := this.buffer(data); err != nil {
+			glog.Errorf("Failed to buffer data for sink %s: %v", this.DataSink.Name(), err)
+		}
+		return nil
+	}
+	this.catchUp()
+	return tryExportData(this.DataSink, data)
+}
+
+func (this *scheduledSink) buffer(data *core.DataBatch) error {
+	if len(this.buffered) >= this.bufferSize {
+		glog.Warningf("Blackout buffer of sink %s is full, dropping the oldest batch", this.DataSink.Name())
+		os.Remove(this.buffered[0])
+		this.buffered = this.buffered[1:]
+	}
+	name, err := writeBufferedBatch(this.bufferDir, data)
+	if err != nil {
+		return err
+	}
+	this.buffered = append(this.buffered, name)
+	return nil
+}
+
+// Writes the batch to a new file of the directory named after its timestamp, and a sequence
+// number for the batches with the same timestamp, so that the files sort oldest first.
+func writeBufferedBatch(dir string, data *core.DataBatch) (string, error) {
+	for seq := 0; ; seq++ {
+		name := filepath.Join(dir, fmt.Sprintf("%020d%s", data.Timestamp.UnixNano(), blackoutBufferSuffix))
+		if seq > 0 {
+			name = filepath.Join(dir, fmt.Sprintf("%020d_%06d%s", data.Timestamp.UnixNano(), seq, blackoutBufferSuffix))
+		}
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		if err := gob.NewEncoder(file).Encode(data); err != nil {
+			os.Remove(name)
+			return "", err
+		}
+		return name, nil
+	}
+}
+
+// Exports the buffered batches, oldest first.
+func (this *scheduledSink) catchUp() {
+	if len(this.buffered) == 0 {
+		return
+	}
+	glog.Infof("Exporting %d batches buffered during blackout to sink %s", len(this.buffered), this.DataSink.Name())
+	for _, name := range this.buffered {
+		data, err := readBufferedBatch(name)
+		if err != nil {
+			glog.Errorf("Failed to read buffered batch %s: %v", name, err)
+		} else {
+			this.DataSink.ExportData(data)
+		}
+		os.Remove(name)
+	}
+	this.buffered = nil
+}
+
+func readBufferedBatch(name string) (*core.DataBatch, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data := &core.DataBatch{}
+	if err := gob.NewDecoder(file).Decode(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (this *scheduledSink) AcceptsRawSamples() bool {
+	return acceptsRawSamples(this.DataSink)
+}
+
+func (this *scheduledSink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
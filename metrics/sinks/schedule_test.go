@@ -0,0 +1,130 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+type recordingSink struct {
+	timestamps []time.Time
+	batches    []*core.DataBatch
+}
+
+func (this *recordingSink) Name() string { return "recording" }
+func (this *recordingSink) Stop()        {}
+func (this *recordingSink) ExportData(data *core.DataBatch) {
+	this.timestamps = append(this.timestamps, data.Timestamp)
+	this.batches = append(this.batches, data)
+}
+
+func TestBlackoutWindow(t *testing.T) {
+	// Sundays from 02:00 to 04:00, and the first day of the month at 00:30 for 15 minutes.
+	window, err := parseBlackoutWindow("0 2 * * 0,2h")
+	require.NoError(t, err)
+	monthly, err := parseBlackoutWindow("30 0 1 * *,15m")
+	require.NoError(t, err)
+
+	// 2016-10-02 is a Sunday.
+	for _, tc := range []struct {
+		window   blackoutWindow
+		time     time.Time
+		expected bool
+	}{
+		{window, time.Date(2016, 10, 2, 1, 59, 0, 0, time.UTC), false},
+		{window, time.Date(2016, 10, 2, 2, 0, 0, 0, time.UTC), true},
+		{window, time.Date(2016, 10, 2, 3, 59, 59, 0, time.UTC), true},
+		{window, time.Date(2016, 10, 2, 4, 0, 0, 0, time.UTC), false},
+		{window, time.Date(2016, 10, 3, 2, 30, 0, 0, time.UTC), false},
+		{monthly, time.Date(2016, 10, 1, 0, 40, 0, 0, time.UTC), true},
+		{monthly, time.Date(2016, 10, 2, 0, 40, 0, 0, time.UTC), false},
+	} {
+		assert.Equal(t, tc.expected, tc.window.contains(tc.time), "%v", tc.time)
+	}
+
+	schedule, err := parseCronSchedule("*/15 9-17 * 1,6 1-5")
+	require.NoError(t, err)
+	assert.True(t, schedule.matches(time.Date(2016, 6, 1, 9, 45, 0, 0, time.UTC)))
+	assert.False(t, schedule.matches(time.Date(2016, 6, 1, 9, 50, 0, 0, time.UTC)))
+	assert.False(t, schedule.matches(time.Date(2016, 7, 1, 9, 45, 0, 0, time.UTC)))
+	assert.False(t, schedule.matches(time.Date(2016, 6, 4, 9, 45, 0, 0, time.UTC)))
+
+	for _, text := range []string{"0 2 * * 0", "0 2 * *,1h", "60 2 * * *,1h", "0 2 * * 7,1h", "0 2 * * 0,-1h", "*/0 * * * *,1h"} {
+		_, err := parseBlackoutWindow(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestScheduledSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blackout")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &recordingSink{}
+	uri, err := url.Parse("?blackout=0+2+*+*+*,1h&blackoutbuffer=" + dir + "&blackoutbuffersize=2")
+	require.NoError(t, err)
+	wrapped, err := newScheduledSink(sink, uri)
+	require.NoError(t, err)
+	scheduled := wrapped.(*scheduledSink)
+
+	export := func(now time.Time) {
+		scheduled.nowFunc = func() time.Time { return now }
+		scheduled.ExportData(&core.DataBatch{Timestamp: now, MetricSets: map[string]*core.MetricSet{}})
+	}
+	base := time.Date(2016, 10, 1, 1, 59, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		export(base.Add(time.Duration(i) * time.Minute))
+	}
+	// The batch before the window is exported, the oldest batch of the window is dropped.
+	assert.Equal(t, []time.Time{base}, sink.timestamps)
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// Buffered batches survive a restart and are exported before the next batch.
+	wrapped, err = newScheduledSink(sink, uri)
+	require.NoError(t, err)
+	scheduled = wrapped.(*scheduledSink)
+	export(base.Add(61 * time.Minute))
+	assert.Equal(t, []time.Time{base, base.Add(3 * time.Minute), base.Add(4 * time.Minute), base.Add(61 * time.Minute)}, sink.timestamps)
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	// Without a buffer the batches of the window are dropped.
+	sink = &recordingSink{}
+	uri, err = url.Parse("?blackout=0+2+*+*+*,1h")
+	require.NoError(t, err)
+	wrapped, err = newScheduledSink(sink, uri)
+	require.NoError(t, err)
+	scheduled = wrapped.(*scheduledSink)
+	export(base.Add(30 * time.Minute))
+	export(base.Add(90 * time.Minute))
+	assert.Equal(t, []time.Time{base.Add(90 * time.Minute)}, sink.timestamps)
+
+	// Sinks without windows are not wrapped.
+	wrapped, err = newScheduledSink(sink, &url.URL{})
+	require.NoError(t, err)
+	assert.Equal(t, sink, wrapped)
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/heapster/metrics/core"
+)
+
+var (
+	// Number of points in the batches exported to sink.
+	exporterBatchPoints = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace: "heapster",
+			Subsystem: "exporter",
+			Name:      "batch_points",
+			Help:      "Number of points in the batches exported to sink.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Number of failed exports to sink.
+	exporterFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "heapster",
+			Subsystem: "exporter",
+			Name:      "failures_total",
+			Help:      "Number of failed exports to sink.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Number of exports to sink which failed in a row.
+	exporterConsecutiveFailures = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "exporter",
+			Name:      "consecutive_failures",
+			Help:      "Number of exports to sink which failed in a row.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Number of points which weren't exported to sink.
+	exporterDroppedPoints = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "heapster",
+			Subsystem: "exporter",
+			Name:      "dropped_points_total",
+			Help:      "Number of points which weren't exported to sink, because it was still busy with the previous batch or the export failed and the batch wasn't spilled to a dead letter directory.",
+		},
+		[]string{"exporter"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(exporterBatchPoints)
+	prometheus.MustRegister(exporterFailures)
+	prometheus.MustRegister(exporterConsecutiveFailures)
+	prometheus.MustRegister(exporterDroppedPoints)
+}
+
+// SinkStats are the statistics of the exports to a sink, served on /api/v1/sinks.
+// Failures are only known for the sinks which report them, e.g. those supporting retries.
+type SinkStats struct {
+	Name     string `json:"name"`
+	Priority string `json:"priority"`
+	// Time the last export completed, and the last successful one.
+	LastExport  time.Time `json:"lastExport"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	// Duration of the last export, and the average over all of them.
+	LastLatencySeconds    float64 `json:"lastLatencySeconds"`
+	AverageLatencySeconds float64 `json:"averageLatencySeconds"`
+	// Number of points in the last exported batch, and the average over all of them.
+	LastBatchPoints    int     `json:"lastBatchPoints"`
+	AverageBatchPoints float64 `json:"averageBatchPoints"`
+	Exports            int64   `json:"exports"`
+	Failures           int64   `json:"failures"`
+	// Number of exports which failed since the last successful one.
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	LastError           string `json:"lastError,omitempty"`
+	// Batches and points which were skipped because the sink was still busy with the previous
+	// batch, or which failed to export and weren't spilled to a dead letter directory.
+	DroppedBatches int64 `json:"droppedBatches"`
+	DroppedPoints  int64 `json:"droppedPoints"`
+	// State of the circuit breaker of the sink, empty if the circuit breakers are disabled.
+	CircuitBreaker string `json:"circuitBreaker,omitempty"`
+}
+
+// StatsProvider is implemented by the sink manager, which reports the statistics of its sinks.
+type StatsProvider interface {
+	Stats() []SinkStats
+}
+
+// A sink wrapper reporting whether the export to the sink it wraps failed.
+type reportingSink interface {
+	core.DataSink
+	exportData(*core.DataBatch) error
+}
+
+// Exports the batch, returning an error if the sink, or the one it wraps, reports a failure.
+func tryExportData(sink core.DataSink, data *core.DataBatch) error {
+	switch s := sink.(type) {
+	case reportingSink:
+		return s.exportData(data)
+	case core.RetryableSink:
+		return s.TryExportData(data)
+	}
+	sink.ExportData(data)
+	return nil
+}
+
+// Statistics of a sink, updated by the sink manager.
+type sinkStats struct {
+	sync.Mutex
+	stats        SinkStats
+	totalLatency time.Duration
+	totalPoints  int64
+}
+
+func newSinkStats(name, priority string) *sinkStats {
+	return &sinkStats{stats: SinkStats{Name: name, Priority: priority}}
+}
+
+func (this *sinkStats) exported(points int, latency time.Duration, err error) {
+	this.Lock()
+	defer this.Unlock()
+
+	now := time.Now()
+	this.stats.Exports++
+	this.stats.LastExport = now
+	this.stats.LastLatencySeconds = latency.Seconds()
+	this.totalLatency += latency
+	this.stats.AverageLatencySeconds = this.totalLatency.Seconds() / float64(this.stats.Exports)
+	this.stats.LastBatchPoints = points
+	this.totalPoints += int64(points)
+	this.stats.AverageBatchPoints = float64(this.totalPoints) / float64(this.stats.Exports)
+	exporterBatchPoints.WithLabelValues(this.stats.Name).Observe(float64(points))
+	if err != nil {
+		this.stats.Failures++
+		this.stats.ConsecutiveFailures++
+		this.stats.LastError = err.Error()
+		exporterFailures.WithLabelValues(this.stats.Name).Inc()
+		if _, spilled := err.(spilledError); !spilled {
+			this.droppedLocked(points)
+		}
+	} else {
+		this.stats.LastSuccess = now
+		this.stats.ConsecutiveFailures = 0
+		this.stats.LastError = ""
+	}
+	exporterConsecutiveFailures.WithLabelValues(this.stats.Name).Set(float64(this.stats.ConsecutiveFailures))
+}
+
+func (this *sinkStats) dropped(points int) {
+	this.Lock()
+	defer this.Unlock()
+	this.droppedLocked(points)
+}
+
+// Must be called with the lock held.
+func (this *sinkStats) droppedLocked(points int) {
+	this.stats.DroppedBatches++
+	this.stats.DroppedPoints += int64(points)
+	exporterDroppedPoints.WithLabelValues(this.stats.Name).Add(float64(points))
+}
+
+func (this *sinkStats) get() SinkStats {
+	this.Lock()
+	defer this.Unlock()
+	return this.stats
+}
+
+// Returns the number of points of the batch: its metric values and labeled metrics.
+func batchPoints(data *core.DataBatch) int {
+	points := 0
+	for _, ms := range data.MetricSets {
+		points += len(ms.MetricValues) + len(ms.LabeledMetrics)
+	}
+	return points
+}
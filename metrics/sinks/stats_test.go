@@ -0,0 +1,133 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+)
+
+func batchWithPoints() *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			core.PodKey("ns1", "pod1"): {
+				Labels:       map[string]string{core.LabelNamespaceName.Key: "ns1"},
+				MetricValues: map[string]core.MetricValue{"m1": {IntValue: 1}},
+				LabeledMetrics: []core.LabeledMetric{
+					{Name: "m2", MetricValue: core.MetricValue{IntValue: 2}},
+				},
+			},
+		},
+	}
+}
+
+func TestTryExportData(t *testing.T) {
+	// Sinks which don't report failures always succeed.
+	assert.NoError(t, tryExportData(&recordingSink{}, batchWithPoints()))
+
+	// The failures are reported through the wrappers.
+	sink := &flakySink{down: true}
+	uri, err := url.Parse("?namespaces=ns1")
+	require.NoError(t, err)
+	wrapped, err := newFilterSink(sink, uri)
+	require.NoError(t, err)
+	require.IsType(t, &filterSink{}, wrapped)
+	assert.Error(t, tryExportData(wrapped, batchWithPoints()))
+	sink.down = false
+	assert.NoError(t, tryExportData(wrapped, batchWithPoints()))
+	assert.Len(t, sink.batches, 1)
+}
+
+func TestSinkStats(t *testing.T) {
+	sink := &flakySink{}
+	stats := newSinkStats(sink.Name(), PriorityNormal)
+
+	export(sink, stats, batchWithPoints())
+	s := stats.get()
+	assert.Equal(t, "recording", s.Name)
+	assert.Equal(t, int64(1), s.Exports)
+	assert.Equal(t, 2, s.LastBatchPoints)
+	assert.False(t, s.LastSuccess.IsZero())
+	assert.Equal(t, 0, s.ConsecutiveFailures)
+
+	sink.down = true
+	export(sink, stats, batchWithPoints())
+	export(sink, stats, &core.DataBatch{Timestamp: time.Now(), MetricSets: map[string]*core.MetricSet{}})
+	s = stats.get()
+	assert.Equal(t, int64(3), s.Exports)
+	assert.Equal(t, int64(2), s.Failures)
+	assert.Equal(t, 2, s.ConsecutiveFailures)
+	assert.Equal(t, "backend down", s.LastError)
+	assert.Equal(t, int64(2), s.DroppedBatches)
+	assert.Equal(t, int64(2), s.DroppedPoints)
+	assert.Equal(t, 0, s.LastBatchPoints)
+	assert.InDelta(t, 4.0/3, s.AverageBatchPoints, 0.001)
+	assert.True(t, s.LastSuccess.Before(s.LastExport))
+
+	sink.down = false
+	export(sink, stats, batchWithPoints())
+	s = stats.get()
+	assert.Equal(t, 0, s.ConsecutiveFailures)
+	assert.Empty(t, s.LastError)
+	assert.Equal(t, int64(2), s.Failures)
+	assert.Equal(t, s.LastExport, s.LastSuccess)
+}
+
+func TestSpilledBatchesArentDropped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &flakySink{down: true}
+	wrapped := newTestRetrySink(t, sink, "deadletter="+dir)
+	stats := newSinkStats(sink.Name(), PriorityNormal)
+	export(wrapped, stats, batchWithPoints())
+	s := stats.get()
+	assert.Equal(t, int64(1), s.Failures)
+	assert.Equal(t, "backend down", s.LastError)
+	assert.Equal(t, int64(0), s.DroppedBatches)
+	assert.Equal(t, int64(0), s.DroppedPoints)
+}
+
+func TestManagerStats(t *testing.T) {
+	sink1 := util.NewDummySink("s1", 0)
+	sink2 := util.NewDummySink("s2", 2*time.Second)
+	manager, _ := NewDataSinkManager([]core.DataSink{sink1, sink2}, 100*time.Millisecond, time.Second)
+
+	// s2 is still busy with the first batch when the second one is pushed.
+	manager.ExportData(batchWithPoints())
+	manager.ExportData(batchWithPoints())
+	time.Sleep(100 * time.Millisecond)
+
+	stats := manager.(StatsProvider).Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "s1", stats[0].Name)
+	assert.Equal(t, int64(2), stats[0].Exports)
+	assert.Equal(t, int64(0), stats[0].DroppedBatches)
+	assert.Equal(t, "s2", stats[1].Name)
+	assert.Equal(t, int64(0), stats[1].Exports)
+	assert.Equal(t, int64(1), stats[1].DroppedBatches)
+	assert.Equal(t, int64(2), stats[1].DroppedPoints)
+}
@@ -0,0 +1,228 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+const defaultChangeHeartbeat = 10 * time.Minute
+
+// Minimum change of the gauges of a metric family for them to be exported again.
+type changeThreshold struct {
+	// Metric name, or prefix of the metric names if it ends with `/`.
+	family string
+	value  float64
+	// Whether the value is a fraction of the last exported value rather than an absolute one.
+	relative bool
+}
+
+func (this *changeThreshold) matches(metricName string) bool {
+	if strings.HasSuffix(this.family, "/") {
+		return strings.HasPrefix(metricName, this.family)
+	}
+	return metricName == this.family
+}
+
+// Tells whether the value didn't change since the last one, i.e. is equal to it or differs
+// by less than the threshold.
+func (this *changeThreshold) unchanged(last, value float64) bool {
+	delta := math.Abs(value - last)
+	if this.relative {
+		return delta == 0 || delta < this.value*math.Abs(last)
+	}
+	return delta == 0 || delta < this.value
+}
+
+// Parses a threshold given as `<family>:<value>`, the value being absolute or a percentage,
+// e.g. `filesystem/:1%` or `memory/usage:1048576`.
+func parseChangeThreshold(text string) (changeThreshold, error) {
+	i := strings.LastIndex(text, ":")
+	if i <= 0 {
+		return changeThreshold{}, fmt.Errorf("invalid change threshold %q: expected <family>:<value>", text)
+	}
+	threshold := changeThreshold{family: text[:i]}
+	value := text[i+1:]
+	if strings.HasSuffix(value, "%") {
+		threshold.relative = true
+		value = strings.TrimSuffix(value, "%")
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 {
+		return changeThreshold{}, fmt.Errorf("invalid change threshold value %q", text[i+1:])
+	}
+	threshold.value = parsed
+	if threshold.relative {
+		threshold.value /= 100
+	}
+	return threshold, nil
+}
+
+// Last exported value of a gauge.
+type exportedValue struct {
+	value     float64
+	timestamp time.Time
+}
+
+// A sink wrapper dropping the gauges of the configured families whose change since they
+// were last exported is below the threshold of their family, to reduce the writes of slow
+// moving metrics. A gauge is exported at least every heartbeat even if it didn't change.
+type thresholdSink struct {
+	core.DataSink
+	thresholds []changeThreshold
+	heartbeat  time.Duration
+	// Last exported values, by metric set key, metric name and labels.
+	exported map[string]exportedValue
+}
+
+// Wraps the sink with the change thresholds given in the options of its uri, or returns it
+// as is if it has none.
+func newThresholdSink(sink core.DataSink, uri *url.URL) (core.DataSink, error) {
+	opts := uri.Query()
+	if len(opts["changethreshold"]) == 0 {
+		return sink, nil
+	}
+	if _, ok := sink.(core.HttpSink); ok {
+		return nil, fmt.Errorf("change thresholds are not supported by sink %s", sink.Name())
+	}
+	this := &thresholdSink{
+		DataSink:  sink,
+		heartbeat: defaultChangeHeartbeat,
+		exported:  make(map[string]exportedValue),
+	}
+	for _, text := range opts["changethreshold"] {
+		threshold, err := parseChangeThreshold(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `changethreshold` flag - %v", err)
+		}
+		this.thresholds = append(this.thresholds, threshold)
+	}
+	if len(opts["changeheartbeat"]) >= 1 {
+		heartbeat, err := time.ParseDuration(opts["changeheartbeat"][0])
+		if err != nil || heartbeat <= 0 {
+			return nil, fmt.Errorf("failed to parse `changeheartbeat` flag - %v", opts["changeheartbeat"][0])
+		}
+		this.heartbeat = heartbeat
+	}
+	return this, nil
+}
+
+// Returns the threshold of the metric, the one with the longest family if several match.
+func (this *thresholdSink) threshold(metricName string) *changeThreshold {
+	var result *changeThreshold
+	for i := range this.thresholds {
+		threshold := &this.thresholds[i]
+		if threshold.matches(metricName) && (result == nil || len(threshold.family) > len(result.family)) {
+			result = threshold
+		}
+	}
+	return result
+}
+
+func gaugeValue(value core.MetricValue) (float64, bool) {
+	if value.MetricType != core.MetricGauge {
+		return 0, false
+	}
+	switch value.ValueType {
+	case core.ValueInt64:
+		return float64(value.IntValue), true
+	case core.ValueFloat:
+		return float64(value.FloatValue), true
+	}
+	return 0, false
+}
+
+func labeledMetricKey(metric *core.LabeledMetric) string {
+	names := make([]string, 0, len(metric.Labels))
+	for name := range metric.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	key := metric.Name
+	for _, name := range names {
+		key += "," + name + "=" + metric.Labels[name]
+	}
+	return key
+}
+
+// Tells whether the value should be exported, recording it in exported if so, or keeping
+// its last exported value otherwise.
+func (this *thresholdSink) keep(key, metricName string, value core.MetricValue, timestamp time.Time, exported map[string]exportedValue) bool {
+	threshold := this.threshold(metricName)
+	if threshold == nil {
+		return true
+	}
+	current, ok := gaugeValue(value)
+	if !ok {
+		return true
+	}
+	last, found := this.exported[key]
+	if found && timestamp.Sub(last.timestamp) < this.heartbeat && threshold.unchanged(last.value, current) {
+		exported[key] = last
+		return false
+	}
+	exported[key] = exportedValue{value: current, timestamp: timestamp}
+	return true
+}
+
+func (this *thresholdSink) ExportData(data *core.DataBatch) {
+	this.exportData(data)
+}
+
+func (this *thresholdSink) exportData(data *core.DataBatch) error {
+	// The values which aren't in the batch anymore are forgotten.
+	exported := make(map[string]exportedValue, len(this.exported))
+	result := &core.DataBatch{
+		Timestamp:    data.Timestamp,
+		MetricSets:   make(map[string]*core.MetricSet, len(data.MetricSets)),
+		Completeness: data.Completeness,
+		OutOfBand:    data.OutOfBand,
+	}
+	for setKey, ms := range data.MetricSets {
+		msCopy := *ms
+		msCopy.MetricValues = make(map[string]core.MetricValue, len(ms.MetricValues))
+		for name, value := range ms.MetricValues {
+			if this.keep(setKey+"|"+name, name, value, data.Timestamp, exported) {
+				msCopy.MetricValues[name] = value
+			}
+		}
+		msCopy.LabeledMetrics = make([]core.LabeledMetric, 0, len(ms.LabeledMetrics))
+		for i := range ms.LabeledMetrics {
+			metric := &ms.LabeledMetrics[i]
+			if this.keep(setKey+"|"+labeledMetricKey(metric), metric.Name, metric.MetricValue, data.Timestamp, exported) {
+				msCopy.LabeledMetrics = append(msCopy.LabeledMetrics, *metric)
+			}
+		}
+		result.MetricSets[setKey] = &msCopy
+	}
+	this.exported = exported
+	return tryExportData(this.DataSink, result)
+}
+
+func (this *thresholdSink) AcceptsRawSamples() bool {
+	return acceptsRawSamples(this.DataSink)
+}
+
+func (this *thresholdSink) AcceptsHistograms() bool {
+	return acceptsHistograms(this.DataSink)
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func TestParseChangeThreshold(t *testing.T) {
+	threshold, err := parseChangeThreshold("filesystem/:1%")
+	require.NoError(t, err)
+	assert.Equal(t, changeThreshold{family: "filesystem/", value: 0.01, relative: true}, threshold)
+	assert.True(t, threshold.matches("filesystem/usage"))
+	assert.False(t, threshold.matches("memory/usage"))
+
+	threshold, err = parseChangeThreshold("memory/usage:1048576")
+	require.NoError(t, err)
+	assert.Equal(t, changeThreshold{family: "memory/usage", value: 1048576}, threshold)
+	assert.True(t, threshold.matches("memory/usage"))
+	assert.False(t, threshold.matches("memory/usage_rate"))
+
+	for _, text := range []string{"filesystem/", ":1%", "filesystem/:x", "filesystem/:-1"} {
+		_, err := parseChangeThreshold(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestThresholdSink(t *testing.T) {
+	sink := &recordingSink{}
+	uri, err := url.Parse("?changethreshold=filesystem/:1%25&changethreshold=filesystem/inode_utilization:0&changeheartbeat=5m")
+	require.NoError(t, err)
+	wrapped, err := newThresholdSink(sink, uri)
+	require.NoError(t, err)
+
+	base := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+	export := func(minute int, usage int64, inodes int64) {
+		wrapped.ExportData(&core.DataBatch{
+			Timestamp: base.Add(time.Duration(minute) * time.Minute),
+			MetricSets: map[string]*core.MetricSet{
+				"node:n1": {
+					MetricValues: map[string]core.MetricValue{
+						core.MetricCpuUsage.Name:    {MetricType: core.MetricCumulative, ValueType: core.ValueInt64, IntValue: int64(minute)},
+						core.MetricMemoryUsage.Name: {MetricType: core.MetricGauge, ValueType: core.ValueInt64, IntValue: 7},
+					},
+					LabeledMetrics: []core.LabeledMetric{
+						{
+							Name:        core.MetricFilesystemUsage.Name,
+							Labels:      map[string]string{core.LabelResourceID.Key: "/"},
+							MetricValue: core.MetricValue{MetricType: core.MetricGauge, ValueType: core.ValueInt64, IntValue: usage},
+						},
+						{
+							Name:        core.MetricFilesystemInodeUtilization.Name,
+							Labels:      map[string]string{core.LabelResourceID.Key: "/"},
+							MetricValue: core.MetricValue{MetricType: core.MetricGauge, ValueType: core.ValueInt64, IntValue: inodes},
+						},
+					},
+				},
+			},
+		})
+	}
+	exported := func(i int) []string {
+		names := []string{}
+		for _, metric := range sink.batches[i].MetricSets["node:n1"].LabeledMetrics {
+			names = append(names, metric.Name)
+		}
+		return names
+	}
+
+	export(0, 1000, 50)
+	// Changes below 1% of the last exported value are dropped, and add up until they reach it.
+	export(1, 1005, 50)
+	export(2, 1009, 49)
+	export(3, 1010, 49)
+	// Unchanged values are exported again after the heartbeat.
+	export(8, 1010, 49)
+
+	require.Len(t, sink.batches, 5)
+	assert.Equal(t, []string{core.MetricFilesystemUsage.Name, core.MetricFilesystemInodeUtilization.Name}, exported(0))
+	assert.Equal(t, []string{}, exported(1))
+	assert.Equal(t, []string{core.MetricFilesystemInodeUtilization.Name}, exported(2))
+	assert.Equal(t, []string{core.MetricFilesystemUsage.Name}, exported(3))
+	assert.Equal(t, []string{core.MetricFilesystemUsage.Name, core.MetricFilesystemInodeUtilization.Name}, exported(4))
+	// Metrics without a threshold are always exported.
+	for _, batch := range sink.batches {
+		assert.Len(t, batch.MetricSets["node:n1"].MetricValues, 2)
+	}
+
+	// Sinks without thresholds are not wrapped.
+	wrapped, err = newThresholdSink(sink, &url.URL{})
+	require.NoError(t, err)
+	assert.Equal(t, sink, wrapped)
+}
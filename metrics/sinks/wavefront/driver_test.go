@@ -15,8 +15,13 @@
 package wavefront
 
 import (
+	"compress/gzip"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
 	"k8s.io/heapster/metrics/core"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
 	"strings"
@@ -114,6 +119,71 @@ func TestCreateWavefrontSinkWithNoEmptyInputs(t *testing.T) {
 	assert.Equal(t, true, wfSink.IncludeContainers)
 }
 
+func TestCreateWavefrontSinkDirectIngestion(t *testing.T) {
+	uri, _ := url.Parse("https://example.wavefront.com/?token=secret&batchSize=100")
+	sink, err := NewWavefrontSink(uri)
+	assert.NoError(t, err)
+	wfSink := sink.(*wavefrontSink)
+	assert.Equal(t, "https://example.wavefront.com", wfSink.Server)
+	assert.Equal(t, "secret", wfSink.Token)
+	assert.Equal(t, 100, wfSink.BatchSize)
+	assert.Equal(t, "", wfSink.ProxyAddress)
+
+	for _, fakeUrl := range []string{
+		"https://example.wavefront.com",
+		"https://example.wavefront.com?token=secret&batchSize=0",
+		"wavefront-proxy:2878?batchSize=many",
+	} {
+		uri, _ := url.Parse(fakeUrl)
+		_, err := NewWavefrontSink(uri)
+		assert.Error(t, err, fakeUrl)
+	}
+}
+
+func TestDirectIngestion(t *testing.T) {
+	var requests [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/report", r.URL.Path)
+		assert.Equal(t, "wavefront", r.URL.Query().Get("f"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		reader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		requests = append(requests, strings.Split(strings.TrimSpace(string(body)), "\n"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse(server.URL + "?token=secret&batchSize=3")
+	sink, err := NewWavefrontSink(uri)
+	require.NoError(t, err)
+	batch := generateFakeBatch()
+	sink.ExportData(batch)
+	sink.Stop()
+
+	// The 8 points are sent in batches of 3.
+	require.Equal(t, 3, len(requests))
+	assert.Equal(t, 3, len(requests[0]))
+	assert.Equal(t, 3, len(requests[1]))
+	assert.Equal(t, 2, len(requests[2]))
+	assert.Contains(t, requests[0][0], "cpu.limit 1000 ")
+}
+
+func TestTagTruncation(t *testing.T) {
+	assert.Equal(t, "key=\"value\" ", tagToString("key", "value"))
+
+	long := tagToString("key", strings.Repeat("v", 300))
+	assert.Equal(t, "key=\""+strings.Repeat("v", maxTagLength-3)+"\" ", long)
+
+	// Multi-byte characters aren't cut.
+	truncated := tagToString("key", strings.Repeat("v", maxTagLength-4)+"éé")
+	assert.Equal(t, "key=\""+strings.Repeat("v", maxTagLength-4)+"\" ", truncated)
+
+	assert.Equal(t, "", tagToString(strings.Repeat("k", maxTagLength), "value"))
+}
+
 func generateFakeBatch() *core.DataBatch {
 	batch := core.DataBatch{
 		Timestamp:  time.Now(),
@@ -15,27 +15,44 @@
 package wavefront
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/golang/glog"
+	"k8s.io/heapster/common/transport"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util/accounting"
 )
 
 const (
 	sysSubContainerName = "system.slice/"
+	// Wavefront rejects points whose tag key and value are longer than this combined.
+	maxTagLength = 254
+	// Number of points sent per request in direct ingestion mode.
+	defaultBatchSize = 10000
+	reportPath       = "/report?f=wavefront"
 )
 
 var excludeTagList = [...]string{"namespace_id", "host_id", "pod_id", "hostname"}
 
 type wavefrontSink struct {
-	Conn              net.Conn
-	ProxyAddress      string
+	Conn         net.Conn
+	ProxyAddress string
+	// Wavefront API server and token of the direct ingestion, used instead of a proxy.
+	Server            string
+	Token             string
+	BatchSize         int
+	client            *http.Client
+	pendingLines      []string
 	ClusterName       string
 	Prefix            string
 	IncludeLabels     bool
@@ -49,8 +66,13 @@ func (wfSink *wavefrontSink) Name() string {
 }
 
 func (wfSink *wavefrontSink) Stop() {
-	// Do nothing.
-	wfSink.Conn.Close()
+	if wfSink.Conn != nil {
+		wfSink.Conn.Close()
+	}
+}
+
+func (wfSink *wavefrontSink) direct() bool {
+	return wfSink.Server != ""
 }
 
 func (wfSink *wavefrontSink) sendLine(line string) {
@@ -60,6 +82,14 @@ func (wfSink *wavefrontSink) sendLine(line string) {
 		glog.Infoln(line)
 		return
 	}
+	if wfSink.direct() {
+		wfSink.pendingLines = append(wfSink.pendingLines, line)
+		accounting.DefaultLedger.AddBufferBytes(accounting.SinkOwner(wfSink.Name()), int64(len(line)))
+		if len(wfSink.pendingLines) >= wfSink.BatchSize {
+			wfSink.flush()
+		}
+		return
+	}
 	//if the connection was closed or interrupted - don't cause a panic (we'll retry at next interval)
 	defer func() {
 		if r := recover(); r != nil {
@@ -77,12 +107,69 @@ func (wfSink *wavefrontSink) sendPoint(metricName string, metricValStr string, t
 	wfSink.sendLine(metricLine)
 }
 
+// Sends the pending lines to the Wavefront API in a single request. Lines which can't be
+// sent are dropped, the next batch being sent at the next interval.
+func (wfSink *wavefrontSink) flush() {
+	if len(wfSink.pendingLines) == 0 {
+		return
+	}
+	lines := wfSink.pendingLines
+	wfSink.pendingLines = nil
+	size := 0
+	for _, line := range lines {
+		size += len(line)
+	}
+	defer accounting.DefaultLedger.AddBufferBytes(accounting.SinkOwner(wfSink.Name()), -int64(size))
+
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	for _, line := range lines {
+		writer.Write([]byte(line))
+	}
+	writer.Close()
+
+	req, err := http.NewRequest("POST", wfSink.Server+reportPath, &body)
+	if err != nil {
+		glog.Warningf("Unable to create the request to Wavefront at %s: %v", wfSink.Server, err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+wfSink.Token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := wfSink.client.Do(req)
+	if err != nil {
+		glog.Warningf("Unable to send %d points to Wavefront at %s: %v", len(lines), wfSink.Server, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		glog.Warningf("Unable to send %d points to Wavefront at %s: %s", len(lines), wfSink.Server, resp.Status)
+	}
+}
+
+// Formats a point tag, truncating its value to the Wavefront limits.
+func tagToString(key string, value string) string {
+	if len(key)+len(value) > maxTagLength {
+		if len(key) >= maxTagLength {
+			glog.V(4).Infof("Dropping Wavefront point tag %q which is longer than %d characters", key, maxTagLength)
+			return ""
+		}
+		end := maxTagLength - len(key)
+		// Don't cut a multi-byte character.
+		for end > 0 && !utf8.RuneStart(value[end]) {
+			end--
+		}
+		value = value[:end]
+	}
+	return key + "=\"" + value + "\" "
+}
+
 func tagsToString(tags map[string]string) string {
 	tagStr := ""
 	for k, v := range tags {
 		//if k != "hostname" {
 		if excludeTag(k) == false {
-			tagStr += k + "=\"" + v + "\" "
+			tagStr += tagToString(k, v)
 		}
 	}
 	return tagStr
@@ -181,7 +268,7 @@ func (wfSink *wavefrontSink) send(batch *core.DataBatch) {
 				source := tags["hostname"]
 				tagStr := tagsToString(tags)
 				for labelName, labelValue := range metric.Labels {
-					tagStr += labelName + "=\"" + labelValue + "\" "
+					tagStr += tagToString(labelName, labelValue)
 				}
 				metricCounter = metricCounter + 1
 				wfSink.sendPoint(metricName, metricValStr, ts, source, tagStr)
@@ -200,6 +287,12 @@ func (wfSink *wavefrontSink) ExportData(batch *core.DataBatch) {
 		return
 	}
 
+	if wfSink.direct() {
+		wfSink.send(batch)
+		wfSink.flush()
+		return
+	}
+
 	//make sure we're Connected before sending a real batch
 	err := wfSink.connect()
 	if err != nil {
@@ -213,7 +306,7 @@ func (wfSink *wavefrontSink) ExportData(batch *core.DataBatch) {
 
 func (wfSink *wavefrontSink) connect() error {
 	var err error
-	wfSink.Conn, err = net.DialTimeout("tcp", wfSink.ProxyAddress, time.Second*10)
+	wfSink.Conn, err = accounting.DefaultLedger.DialTimeout(accounting.SinkOwner(wfSink.Name()), "tcp", wfSink.ProxyAddress, time.Second*10)
 	if err != nil {
 		glog.Warningf("Unable to connect to Wavefront proxy at address: %s", wfSink.ProxyAddress)
 		return err
@@ -227,6 +320,7 @@ func NewWavefrontSink(uri *url.URL) (core.DataSink, error) {
 
 	storage := &wavefrontSink{
 		ProxyAddress:      uri.Scheme + ":" + uri.Opaque,
+		BatchSize:         defaultBatchSize,
 		ClusterName:       "k8s-cluster",
 		Prefix:            "heapster.",
 		IncludeLabels:     false,
@@ -259,6 +353,24 @@ func NewWavefrontSink(uri *url.URL) (core.DataSink, error) {
 		}
 		storage.IncludeContainers = incContainers
 	}
+	// An URL of the Wavefront API server, e.g. https://<instance>.wavefront.com, selects the
+	// direct ingestion instead of the proxy.
+	if uri.Host != "" {
+		if len(vals["token"]) < 1 || vals["token"][0] == "" {
+			return nil, fmt.Errorf("the `token` option is required to send metrics directly to Wavefront at %s", uri.Host)
+		}
+		storage.ProxyAddress = ""
+		storage.Server = uri.Scheme + "://" + uri.Host + strings.TrimSuffix(uri.Path, "/")
+		storage.Token = vals["token"][0]
+		storage.client = transport.NewClient(30 * time.Second)
+	}
+	if len(vals["batchSize"]) > 0 {
+		batchSize, err := strconv.Atoi(vals["batchSize"][0])
+		if err != nil || batchSize <= 0 {
+			return nil, fmt.Errorf("failed to parse `batchSize` flag - should be a positive integer, got %q", vals["batchSize"][0])
+		}
+		storage.BatchSize = batchSize
+	}
 	if len(vals["testMode"]) > 0 {
 		testMode := false
 		testMode, err := strconv.ParseBool(vals["testMode"][0])
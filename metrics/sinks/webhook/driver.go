@@ -0,0 +1,257 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/common/transport"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sinks/batching"
+	"k8s.io/heapster/metrics/sinks/encoding"
+)
+
+const (
+	defaultBatchSize   = 1000
+	defaultTimeout     = 10 * time.Second
+	defaultContentType = "application/json"
+
+	// A JSON object with the time of the batch and its points.
+	defaultTemplate = `{"timestamp": {{millis .Timestamp}}, "points": [` +
+		`{{range $i, $point := .Points}}{{if $i}}, {{end}}` +
+		`{"name": {{json $point.Name}}, "value": {{value $point.Value}}, "labels": {{json $point.Labels}}}` +
+		`{{end}}]}`
+)
+
+// Request is the data the templates of the body and the headers are executed against.
+type Request struct {
+	// Time of the batch.
+	Timestamp time.Time
+	// Points of the request, at most the batch size.
+	Points []*encoding.Point
+}
+
+var templateFuncs = template.FuncMap{
+	// Encodes a value in JSON.
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// Formats the value of a metric as a number.
+	"value": func(v core.MetricValue) string {
+		if v.ValueType == core.ValueFloat {
+			return strconv.FormatFloat(float64(v.FloatValue), 'g', -1, 32)
+		}
+		return strconv.FormatInt(v.IntValue, 10)
+	},
+	// Milliseconds since the epoch.
+	"millis": func(t time.Time) int64 {
+		return t.UnixNano() / int64(time.Millisecond)
+	},
+}
+
+func newTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+type header struct {
+	name  string
+	value *template.Template
+}
+
+// POSTs the points of the batches to an HTTP endpoint, in bodies and headers rendered by Go
+// templates, so that any system taking metrics over HTTP can be fed without a sink of its own.
+type webhookSink struct {
+	sync.RWMutex
+
+	endpoint    string
+	client      *http.Client
+	body        *template.Template
+	headers     []header
+	contentType string
+	user        string
+	password    string
+	token       string
+	batchSize   *batching.BatchSize
+	concurrency batching.Concurrency
+	// Number of failed requests.
+	failures int
+}
+
+func (this *webhookSink) Name() string {
+	return "Webhook Sink"
+}
+
+func (this *webhookSink) ExportData(batch *core.DataBatch) {
+	this.TryExportData(batch)
+}
+
+// A batch exported again is posted again in full, the endpoint has to deduplicate the points
+// by timestamp if it needs to.
+func (this *webhookSink) TryExportData(batch *core.DataBatch) error {
+	requests := this.concurrency.Start()
+	points := encoding.BatchPoints(batch)
+	for len(points) > 0 {
+		size := this.batchSize.Size()
+		if size > len(points) {
+			size = len(points)
+		}
+		request := &Request{Timestamp: batch.Timestamp, Points: points[:size]}
+		points = points[size:]
+
+		requests.Go(func() error {
+			start := time.Now()
+			err := this.post(request)
+			this.batchSize.Record(size, time.Since(start), err)
+			if err != nil {
+				glog.Errorf("Failed to post %d points to %s: %v", size, this.endpoint, err)
+				this.Lock()
+				this.failures++
+				this.Unlock()
+			}
+			return err
+		})
+	}
+	return requests.Wait()
+}
+
+func (this *webhookSink) post(request *Request) error {
+	var body bytes.Buffer
+	if err := this.body.Execute(&body, request); err != nil {
+		return fmt.Errorf("failed to render the body: %v", err)
+	}
+	req, err := http.NewRequest("POST", this.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", this.contentType)
+	for _, header := range this.headers {
+		var value bytes.Buffer
+		if err := header.value.Execute(&value, request); err != nil {
+			return fmt.Errorf("failed to render the %s header: %v", header.name, err)
+		}
+		req.Header.Set(header.name, value.String())
+	}
+	if this.user != "" {
+		req.SetBasicAuth(this.user, this.password)
+	}
+	if this.token != "" {
+		req.Header.Set("Authorization", "Bearer "+this.token)
+	}
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func (this *webhookSink) DebugInfo() string {
+	this.RLock()
+	defer this.RUnlock()
+	return fmt.Sprintf("Sink Type: Webhook\n\tendpoint: %s\n\tNumber of failed requests: %d\n", this.endpoint, this.failures)
+}
+
+func (this *webhookSink) Stop() {
+	// nothing needs to be done.
+}
+
+func NewWebhookSink(uri *url.URL) (core.DataSink, error) {
+	if uri.Host == "" {
+		return nil, fmt.Errorf("the endpoint of the webhook is required, e.g. webhook:https://example.com/metrics")
+	}
+	opts := uri.Query()
+	sink := &webhookSink{
+		endpoint:    (&url.URL{Scheme: uri.Scheme, Host: uri.Host, Path: uri.Path}).String(),
+		contentType: defaultContentType,
+	}
+
+	text := defaultTemplate
+	if len(opts["template"]) >= 1 {
+		content, err := ioutil.ReadFile(opts["template"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read `template` file - %v", err)
+		}
+		text = string(content)
+	}
+	var err error
+	if sink.body, err = newTemplate("body", text); err != nil {
+		return nil, err
+	}
+	for _, value := range opts["header"] {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("failed to parse `header` flag - %q should be <name>:<template>", value)
+		}
+		name := strings.TrimSpace(parts[0])
+		tmpl, err := newTemplate(name, strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		sink.headers = append(sink.headers, header{name: name, value: tmpl})
+	}
+	if len(opts["contenttype"]) >= 1 {
+		sink.contentType = opts["contenttype"][0]
+	}
+	if len(opts["user"]) >= 1 {
+		sink.user = opts["user"][0]
+	}
+	if len(opts["pw"]) >= 1 {
+		sink.password = opts["pw"][0]
+	}
+	if len(opts["tokenfile"]) >= 1 {
+		token, err := ioutil.ReadFile(opts["tokenfile"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read `tokenfile` file - %v", err)
+		}
+		sink.token = strings.TrimSpace(string(token))
+	}
+	timeout := defaultTimeout
+	if len(opts["timeout"]) >= 1 {
+		if timeout, err = time.ParseDuration(opts["timeout"][0]); err != nil {
+			return nil, fmt.Errorf("failed to parse `timeout` flag - %v", err)
+		}
+	}
+	sink.client = transport.NewClient(timeout)
+	if sink.batchSize, err = batching.NewBatchSize(sink.Name(), opts, defaultBatchSize); err != nil {
+		return nil, err
+	}
+	if sink.concurrency, err = batching.NewConcurrency(opts); err != nil {
+		return nil, err
+	}
+
+	glog.Infof("Created webhook sink posting to %s", sink.endpoint)
+	return sink, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+)
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+type fakeEndpoint struct {
+	sync.Mutex
+	server   *httptest.Server
+	requests []request
+	status   int
+}
+
+func newFakeEndpoint() *fakeEndpoint {
+	endpoint := &fakeEndpoint{status: http.StatusOK}
+	endpoint.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		endpoint.Lock()
+		defer endpoint.Unlock()
+		endpoint.requests = append(endpoint.requests, request{header: r.Header, body: string(body)})
+		w.WriteHeader(endpoint.status)
+	}))
+	return endpoint
+}
+
+func newSink(t *testing.T, endpoint *fakeEndpoint, query string) *webhookSink {
+	uri, err := url.Parse(endpoint.server.URL + "/metrics?" + query)
+	require.NoError(t, err)
+	sink, err := NewWebhookSink(uri)
+	require.NoError(t, err)
+	return sink.(*webhookSink)
+}
+
+func testBatch() *core.DataBatch {
+	return &core.DataBatch{
+		Timestamp: time.Unix(1475323200, 0),
+		MetricSets: map[string]*core.MetricSet{
+			"node:node-1": {
+				Labels: map[string]string{core.LabelNodename.Key: "node-1"},
+				MetricValues: map[string]core.MetricValue{
+					"cpu/usage":    {ValueType: core.ValueInt64, IntValue: 1000},
+					"memory/usage": {ValueType: core.ValueInt64, IntValue: 2000},
+					"cpu/load":     {ValueType: core.ValueFloat, FloatValue: 0.5},
+				},
+			},
+		},
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	endpoint := newFakeEndpoint()
+	defer endpoint.server.Close()
+	sink := newSink(t, endpoint, "")
+
+	assert.NoError(t, sink.TryExportData(testBatch()))
+
+	require.Len(t, endpoint.requests, 1)
+	assert.Equal(t, "application/json", endpoint.requests[0].header.Get("Content-Type"))
+	var body struct {
+		Timestamp int64
+		Points    []struct {
+			Name   string
+			Value  float64
+			Labels map[string]string
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(endpoint.requests[0].body), &body))
+	assert.Equal(t, int64(1475323200000), body.Timestamp)
+	values := map[string]float64{}
+	for _, point := range body.Points {
+		values[point.Name] = point.Value
+		assert.Equal(t, "node-1", point.Labels[core.LabelNodename.Key])
+	}
+	assert.Equal(t, map[string]float64{"cpu/usage": 1000, "memory/usage": 2000, "cpu/load": 0.5}, values)
+}
+
+func TestTemplatesAndAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	templateFile := filepath.Join(dir, "body.tmpl")
+	require.NoError(t, ioutil.WriteFile(templateFile,
+		[]byte(`{{range .Points}}{{.Name}} {{value .Value}} {{index .Labels "nodename"}}{{"\n"}}{{end}}`), 0644))
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600))
+
+	endpoint := newFakeEndpoint()
+	defer endpoint.server.Close()
+	sink := newSink(t, endpoint, url.Values{
+		"template":    {templateFile},
+		"tokenfile":   {tokenFile},
+		"contenttype": {"text/plain"},
+		"header":      {"X-Points:{{len .Points}}", "X-Time: {{millis .Timestamp}}"},
+		"batchsize":   {"2"},
+	}.Encode())
+
+	sink.ExportData(testBatch())
+
+	require.Len(t, endpoint.requests, 2)
+	lines := ""
+	for i, points := range []string{"2", "1"} {
+		header := endpoint.requests[i].header
+		assert.Equal(t, points, header.Get("X-Points"))
+		assert.Equal(t, "1475323200000", header.Get("X-Time"))
+		assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+		assert.Equal(t, "text/plain", header.Get("Content-Type"))
+		lines += endpoint.requests[i].body
+	}
+	assert.Contains(t, lines, "cpu/usage 1000 node-1\n")
+	assert.Contains(t, lines, "memory/usage 2000 node-1\n")
+	assert.Contains(t, lines, "cpu/load 0.5 node-1\n")
+}
+
+func TestBasicAuth(t *testing.T) {
+	endpoint := newFakeEndpoint()
+	defer endpoint.server.Close()
+	sink := newSink(t, endpoint, "user=heapster&pw=secret")
+
+	sink.ExportData(testBatch())
+
+	require.Len(t, endpoint.requests, 1)
+	req := &http.Request{Header: endpoint.requests[0].header}
+	user, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "heapster", user)
+	assert.Equal(t, "secret", password)
+}
+
+func TestFailedRequests(t *testing.T) {
+	endpoint := newFakeEndpoint()
+	defer endpoint.server.Close()
+	endpoint.status = http.StatusInternalServerError
+	sink := newSink(t, endpoint, "batchsize=2")
+
+	assert.Error(t, sink.TryExportData(testBatch()))
+
+	assert.Len(t, endpoint.requests, 2)
+	assert.Equal(t, 2, sink.failures)
+	assert.Contains(t, sink.DebugInfo(), "Number of failed requests: 2")
+}
+
+func TestInvalidOptions(t *testing.T) {
+	for _, query := range []string{
+		"header=X-Points",
+		"header=:value",
+		"header=X-Points:{{len .Points",
+		"template=/nonexistent",
+		"tokenfile=/nonexistent",
+		"timeout=soon",
+		"batchsize=none",
+	} {
+		uri, err := url.Parse("https://example.com/metrics?" + query)
+		require.NoError(t, err)
+		_, err = NewWebhookSink(uri)
+		assert.Error(t, err, query)
+	}
+
+	uri, err := url.Parse("/metrics")
+	require.NoError(t, err)
+	_, err = NewWebhookSink(uri)
+	assert.Error(t, err)
+}
@@ -0,0 +1,304 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sizing recommends the resources of the heapster pod from its measured usage,
+// so that it can be sized without the addon resizer.
+package sizing
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+const (
+	// How often the usage is measured.
+	sampleInterval = time.Minute
+	// Period over which the peak memory and the average CPU usage are computed.
+	usageWindow = time.Hour
+	// Headroom added to the measured usage, the memory peaks being sharper than the CPU ones.
+	memoryHeadroom = 1.3
+	cpuHeadroom    = 1.5
+	// Minimum recommendation, for clusters too small for the measured costs to be meaningful.
+	minMemoryBytes    = 64 * 1024 * 1024
+	minCpuMillicores  = 20
+	defaultCgroupRoot = "/sys/fs/cgroup"
+)
+
+var (
+	recommendedResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "sizing",
+			Name:      "recommended_requests",
+			Help:      "Resource requests recommended for heapster, in bytes for memory and millicores for cpu.",
+		},
+		[]string{"resource"},
+	)
+
+	insufficientResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "sizing",
+			Name:      "insufficient_limit",
+			Help:      "1 if the limit of heapster is below the recommendation, 0 otherwise.",
+		},
+		[]string{"resource"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(recommendedResources)
+	prometheus.MustRegister(insufficientResources)
+}
+
+// Resources of the heapster pod. Zero values are unknown or unlimited.
+type Resources struct {
+	MemoryBytes   int64 `json:"memoryBytes"`
+	CpuMillicores int64 `json:"cpuMillicores"`
+}
+
+// Recommendation is the sizing of heapster recommended for the running pods of the cluster.
+type Recommendation struct {
+	Timestamp   time.Time `json:"timestamp"`
+	RunningPods int       `json:"runningPods"`
+	// Peak memory usage and average CPU usage over the last hour.
+	Usage Resources `json:"usage"`
+	// Usage extrapolated to 1000 running pods.
+	UsagePer1000Pods Resources `json:"usagePer1000Pods"`
+	Requests         Resources `json:"requests"`
+	// Limits of the heapster container, read from its cgroup.
+	Limits Resources `json:"limits"`
+	// Resources whose limit is below the recommended requests.
+	Insufficient []string `json:"insufficient,omitempty"`
+}
+
+type usageSample struct {
+	timestamp   time.Time
+	memoryBytes int64
+	// Cumulative CPU time used by the process.
+	cpuSeconds float64
+}
+
+// Recommender measures the usage of heapster and recommends its resource requests.
+type Recommender struct {
+	sync.RWMutex
+	podLister *cache.StoreToPodLister
+	// Whether insufficient limits are logged as warnings.
+	warn       bool
+	cgroupRoot string
+	usageFunc  func() (int64, float64)
+	samples    []usageSample
+}
+
+// Measures the memory used by the process and its cumulative CPU time.
+func processUsage() (int64, float64) {
+	stats := &runtime.MemStats{}
+	runtime.ReadMemStats(stats)
+	memory := int64(stats.Sys - stats.HeapReleased)
+
+	usage := &syscall.Rusage{}
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, usage); err != nil {
+		glog.Warningf("Failed to get the CPU usage of heapster: %v", err)
+		return memory, 0
+	}
+	cpu := time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	return memory, cpu.Seconds()
+}
+
+// Adds a usage sample, dropping the ones older than the window.
+func (this *Recommender) sample(now time.Time) {
+	memory, cpu := this.usageFunc()
+	this.Lock()
+	defer this.Unlock()
+	this.samples = append(this.samples, usageSample{timestamp: now, memoryBytes: memory, cpuSeconds: cpu})
+	cutoff := now.Add(-usageWindow)
+	for len(this.samples) > 0 && this.samples[0].timestamp.Before(cutoff) {
+		this.samples = this.samples[1:]
+	}
+}
+
+// Returns the peak memory usage and the average CPU usage of the samples.
+func (this *Recommender) usage() Resources {
+	this.RLock()
+	defer this.RUnlock()
+	usage := Resources{}
+	for _, sample := range this.samples {
+		if sample.memoryBytes > usage.MemoryBytes {
+			usage.MemoryBytes = sample.memoryBytes
+		}
+	}
+	if n := len(this.samples); n >= 2 {
+		first, last := this.samples[0], this.samples[n-1]
+		if elapsed := last.timestamp.Sub(first.timestamp).Seconds(); elapsed > 0 {
+			usage.CpuMillicores = int64(math.Ceil((last.cpuSeconds - first.cpuSeconds) / elapsed * 1000))
+		}
+	}
+	return usage
+}
+
+// Recommend returns the sizing of heapster for the given number of running pods, or for the
+// current ones if it isn't positive.
+func (this *Recommender) Recommend(now time.Time, targetPods int) (*Recommendation, error) {
+	pods, err := this.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	running := 0
+	for _, pod := range pods {
+		if pod.Status.Phase == kube_api.PodRunning {
+			running++
+		}
+	}
+
+	recommendation := &Recommendation{
+		Timestamp:   now,
+		RunningPods: running,
+		Usage:       this.usage(),
+		Limits:      readCgroupLimits(this.cgroupRoot),
+	}
+	if running > 0 {
+		recommendation.UsagePer1000Pods = Resources{
+			MemoryBytes:   recommendation.Usage.MemoryBytes * 1000 / int64(running),
+			CpuMillicores: recommendation.Usage.CpuMillicores * 1000 / int64(running),
+		}
+	}
+	if targetPods <= 0 {
+		targetPods = running
+	}
+	recommendation.Requests = Resources{
+		MemoryBytes:   maxInt64(minMemoryBytes, int64(float64(recommendation.UsagePer1000Pods.MemoryBytes)*float64(targetPods)/1000*memoryHeadroom)),
+		CpuMillicores: maxInt64(minCpuMillicores, int64(float64(recommendation.UsagePer1000Pods.CpuMillicores)*float64(targetPods)/1000*cpuHeadroom)),
+	}
+
+	limits := recommendation.Limits
+	if limits.MemoryBytes > 0 && limits.MemoryBytes < recommendation.Requests.MemoryBytes {
+		recommendation.Insufficient = append(recommendation.Insufficient, "memory")
+	}
+	if limits.CpuMillicores > 0 && limits.CpuMillicores < recommendation.Requests.CpuMillicores {
+		recommendation.Insufficient = append(recommendation.Insufficient, "cpu")
+	}
+	return recommendation, nil
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Logs the recommendation for the current pods, warning about insufficient limits if enabled.
+func (this *Recommender) report(now time.Time) {
+	recommendation, err := this.Recommend(now, 0)
+	if err != nil {
+		glog.Warningf("Failed to recommend heapster resources: %v", err)
+		return
+	}
+	recommendedResources.WithLabelValues("memory").Set(float64(recommendation.Requests.MemoryBytes))
+	recommendedResources.WithLabelValues("cpu").Set(float64(recommendation.Requests.CpuMillicores))
+	insufficientResources.WithLabelValues("memory").Set(0)
+	insufficientResources.WithLabelValues("cpu").Set(0)
+	for _, resource := range recommendation.Insufficient {
+		insufficientResources.WithLabelValues(resource).Set(1)
+	}
+
+	glog.Infof("Recommended heapster requests for %d running pods: memory=%dMi cpu=%dm (measured per 1000 pods: memory=%dMi cpu=%dm)",
+		recommendation.RunningPods, recommendation.Requests.MemoryBytes>>20, recommendation.Requests.CpuMillicores,
+		recommendation.UsagePer1000Pods.MemoryBytes>>20, recommendation.UsagePer1000Pods.CpuMillicores)
+	if this.warn && len(recommendation.Insufficient) > 0 {
+		glog.Warningf("Heapster limits are insufficient for %d running pods: limits memory=%dMi cpu=%dm, recommended memory=%dMi cpu=%dm",
+			recommendation.RunningPods, recommendation.Limits.MemoryBytes>>20, recommendation.Limits.CpuMillicores,
+			recommendation.Requests.MemoryBytes>>20, recommendation.Requests.CpuMillicores)
+	}
+}
+
+// Start measures the usage periodically, and logs the recommendation at the given interval
+// if it's positive.
+func (this *Recommender) Start(reportInterval time.Duration) {
+	go func() {
+		lastReport := time.Now()
+		for now := range time.Tick(sampleInterval) {
+			this.sample(now)
+			if reportInterval > 0 && now.Sub(lastReport) >= reportInterval {
+				this.report(now)
+				lastReport = now
+			}
+		}
+	}()
+}
+
+// Reads the memory and CPU limits of the container from cgroup v1 or v2.
+func readCgroupLimits(root string) Resources {
+	limits := Resources{}
+	if content, err := ioutil.ReadFile(filepath.Join(root, "memory.max")); err == nil {
+		limits.MemoryBytes = parseCgroupValue(string(content))
+	} else if content, err := ioutil.ReadFile(filepath.Join(root, "memory", "memory.limit_in_bytes")); err == nil {
+		limits.MemoryBytes = parseCgroupValue(string(content))
+		// Unlimited memory is reported as a huge number.
+		if limits.MemoryBytes >= math.MaxInt64/2 {
+			limits.MemoryBytes = 0
+		}
+	}
+
+	var quota, period int64
+	if content, err := ioutil.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		if fields := strings.Fields(string(content)); len(fields) == 2 {
+			quota, period = parseCgroupValue(fields[0]), parseCgroupValue(fields[1])
+		}
+	} else {
+		quotaContent, quotaErr := ioutil.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+		periodContent, periodErr := ioutil.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+		if quotaErr == nil && periodErr == nil {
+			quota, period = parseCgroupValue(string(quotaContent)), parseCgroupValue(string(periodContent))
+		}
+	}
+	if quota > 0 && period > 0 {
+		limits.CpuMillicores = quota * 1000 / period
+	}
+	return limits
+}
+
+// Parses a cgroup value, 0 for unlimited ("max" or -1) and invalid values.
+func parseCgroupValue(content string) int64 {
+	value, err := strconv.ParseInt(strings.TrimSpace(content), 10, 64)
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
+// NewRecommender creates a recommender for the running pods of the lister, warning about
+// insufficient limits if warn is set.
+func NewRecommender(podLister *cache.StoreToPodLister, warn bool) *Recommender {
+	return &Recommender{
+		podLister:  podLister,
+		warn:       warn,
+		cgroupRoot: defaultCgroupRoot,
+		usageFunc:  processUsage,
+	}
+}
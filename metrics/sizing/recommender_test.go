@@ -0,0 +1,109 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sizing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+func writeCgroupFile(t *testing.T, root, name, content string) {
+	path := filepath.Join(root, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content+"\n"), 0644))
+}
+
+func TestRecommender(t *testing.T) {
+	podLister := &cache.StoreToPodLister{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})}
+	for i := 0; i < 500; i++ {
+		phase := kube_api.PodRunning
+		if i%5 == 0 {
+			phase = kube_api.PodPending
+		}
+		podLister.Indexer.Add(&kube_api.Pod{
+			ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: fmt.Sprintf("pod%d", i)},
+			Status:     kube_api.PodStatus{Phase: phase},
+		})
+	}
+
+	root, err := ioutil.TempDir("", "cgroup")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	writeCgroupFile(t, root, "memory.max", fmt.Sprint(200<<20))
+	writeCgroupFile(t, root, "cpu.max", "max 100000")
+
+	recommender := NewRecommender(podLister, true)
+	recommender.cgroupRoot = root
+	start := time.Now()
+	// 100Mi peak and 40 millicores over 10 minutes.
+	for i, memory := range []int64{80 << 20, 100 << 20, 90 << 20} {
+		recommender.usageFunc = func() (int64, float64) { return memory, float64(i) * 12 }
+		recommender.sample(start.Add(time.Duration(i) * 5 * time.Minute))
+	}
+
+	recommendation, err := recommender.Recommend(start, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 400, recommendation.RunningPods)
+	assert.Equal(t, Resources{MemoryBytes: 100 << 20, CpuMillicores: 40}, recommendation.Usage)
+	assert.Equal(t, Resources{MemoryBytes: 250 << 20, CpuMillicores: 100}, recommendation.UsagePer1000Pods)
+	assert.Equal(t, Resources{MemoryBytes: 130 << 20, CpuMillicores: 60}, recommendation.Requests)
+	assert.Equal(t, Resources{MemoryBytes: 200 << 20}, recommendation.Limits)
+	assert.Empty(t, recommendation.Insufficient)
+
+	// Twice as many pods don't fit in the memory limit.
+	recommendation, err = recommender.Recommend(start, 800)
+	require.NoError(t, err)
+	assert.Equal(t, Resources{MemoryBytes: 260 << 20, CpuMillicores: 120}, recommendation.Requests)
+	assert.Equal(t, []string{"memory"}, recommendation.Insufficient)
+
+	// Small clusters get the minimum.
+	recommendation, err = recommender.Recommend(start, 1)
+	require.NoError(t, err)
+	assert.Equal(t, Resources{MemoryBytes: minMemoryBytes, CpuMillicores: minCpuMillicores}, recommendation.Requests)
+
+	// Samples older than the window are dropped.
+	recommender.sample(start.Add(2 * time.Hour))
+	assert.Len(t, recommender.samples, 1)
+}
+
+func TestReadCgroupLimits(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	assert.Equal(t, Resources{}, readCgroupLimits(root))
+
+	writeCgroupFile(t, root, "memory/memory.limit_in_bytes", "9223372036854771712")
+	writeCgroupFile(t, root, "cpu/cpu.cfs_quota_us", "50000")
+	writeCgroupFile(t, root, "cpu/cpu.cfs_period_us", "100000")
+	assert.Equal(t, Resources{CpuMillicores: 500}, readCgroupLimits(root))
+
+	writeCgroupFile(t, root, "memory/memory.limit_in_bytes", "536870912")
+	writeCgroupFile(t, root, "cpu/cpu.cfs_quota_us", "-1")
+	assert.Equal(t, Resources{MemoryBytes: 512 << 20}, readCgroupLimits(root))
+
+	writeCgroupFile(t, root, "memory.max", "max")
+	writeCgroupFile(t, root, "cpu.max", "250000 100000")
+	assert.Equal(t, Resources{CpuMillicores: 2500}, readCgroupLimits(root))
+}
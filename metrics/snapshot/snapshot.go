@@ -0,0 +1,120 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package snapshot saves the in-memory model to a remote object storage, and restores it in a
+// new heapster so that the model survives the loss of the node running heapster.
+package snapshot
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	metricsink "k8s.io/heapster/metrics/sinks/metric"
+)
+
+var (
+	lastUploadTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "snapshot",
+			Name:      "last_upload_timestamp_seconds",
+			Help:      "Time of the latest successful upload of the model snapshot.",
+		},
+	)
+
+	uploadSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "snapshot",
+			Name:      "size_bytes",
+			Help:      "Compressed size of the latest model snapshot.",
+		},
+	)
+
+	uploadFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "heapster",
+			Subsystem: "snapshot",
+			Name:      "upload_failures_total",
+			Help:      "Number of failed uploads of the model snapshot.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(lastUploadTimestamp)
+	prometheus.MustRegister(uploadSize)
+	prometheus.MustRegister(uploadFailures)
+}
+
+// Uploader saves the model of the metric sink to the object store.
+type Uploader struct {
+	store      ObjectStore
+	metricSink *metricsink.MetricSink
+}
+
+// Upload writes a snapshot of the model.
+func (this *Uploader) Upload() error {
+	buf := &bytes.Buffer{}
+	if err := this.metricSink.WriteSnapshot(buf); err != nil {
+		return err
+	}
+	if err := this.store.Put(buf.Bytes()); err != nil {
+		return err
+	}
+	lastUploadTimestamp.Set(float64(time.Now().Unix()))
+	uploadSize.Set(float64(buf.Len()))
+	glog.V(2).Infof("Uploaded a model snapshot of %d bytes to %s", buf.Len(), this.store)
+	return nil
+}
+
+// Restore replaces the model by the latest snapshot, if there is one.
+func (this *Uploader) Restore() error {
+	data, err := this.store.Get()
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		glog.Infof("No model snapshot in %s, starting with an empty model", this.store)
+		return nil
+	}
+	timestamp, err := this.metricSink.RestoreSnapshot(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	glog.Infof("Restored the model from the snapshot of %v in %s", timestamp, this.store)
+	return nil
+}
+
+// Start uploads a snapshot at every interval.
+func (this *Uploader) Start(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := this.Upload(); err != nil {
+				uploadFailures.Inc()
+				glog.Errorf("Failed to upload the model snapshot to %s: %v", this.store, err)
+			}
+		}
+	}()
+}
+
+func NewUploader(store ObjectStore, metricSink *metricsink.MetricSink) *Uploader {
+	return &Uploader{
+		store:      store,
+		metricSink: metricSink,
+	}
+}
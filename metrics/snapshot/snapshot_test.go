@@ -0,0 +1,136 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	metricsink "k8s.io/heapster/metrics/sinks/metric"
+)
+
+// An object storage keeping the objects in memory.
+type fakeStorage struct {
+	objects  map[string][]byte
+	requests []*http.Request
+}
+
+func newFakeStorage(t *testing.T) (*fakeStorage, *httptest.Server) {
+	storage := &fakeStorage{objects: make(map[string][]byte)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storage.requests = append(storage.requests, r)
+		switch r.Method {
+		case "PUT":
+			data, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			storage.objects[r.URL.Path] = data
+		case "GET":
+			data, found := storage.objects[r.URL.Path]
+			if !found {
+				http.Error(w, "no such object", http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+	return storage, server
+}
+
+func TestS3Store(t *testing.T) {
+	storage, server := newFakeStorage(t)
+	defer server.Close()
+	os.Setenv("AWS_ACCESS_KEY_ID", "id")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	store, err := NewObjectStore("s3://bucket/heapster/?region=eu-west-1&endpoint=" + server.URL)
+	require.NoError(t, err)
+	data, err := store.Get()
+	require.NoError(t, err)
+	assert.Nil(t, data)
+
+	require.NoError(t, store.Put([]byte("model")))
+	data, err = store.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "model", string(data))
+
+	assert.Contains(t, storage.objects, "/bucket/heapster/"+defaultObjectName)
+	for _, req := range storage.requests {
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/"), req.Header.Get("Authorization"))
+		assert.Contains(t, req.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request")
+		assert.NotEmpty(t, req.Header.Get("X-Amz-Content-Sha256"))
+	}
+
+	_, err = NewObjectStore("s3://bucket/model")
+	assert.Error(t, err)
+}
+
+func TestNewObjectStore(t *testing.T) {
+	store, err := NewObjectStore("gs://bucket/dir/model%20v1.gob.gz?endpoint=http://localhost:4443")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:4443/bucket/dir/model%20v1.gob.gz", store.String())
+
+	store, err = NewObjectStore("s3://bucket?region=us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://bucket.s3.us-east-1.amazonaws.com/"+defaultObjectName, store.String())
+
+	for _, location := range []string{"gs:///model", "file:///tmp/model", "bucket/model"} {
+		_, err := NewObjectStore(location)
+		assert.Error(t, err, location)
+	}
+}
+
+func TestUploader(t *testing.T) {
+	_, server := newFakeStorage(t)
+	defer server.Close()
+	store, err := NewObjectStore("gs://bucket/model?endpoint=" + server.URL)
+	require.NoError(t, err)
+
+	// Nothing to restore yet.
+	restored := metricsink.NewMetricSink(time.Minute, time.Hour, []string{})
+	require.NoError(t, NewUploader(store, restored).Restore())
+	assert.Nil(t, restored.GetLatestDataBatch())
+
+	metricSink := metricsink.NewMetricSink(time.Minute, time.Hour, []string{})
+	metricSink.ExportData(&core.DataBatch{
+		Timestamp: time.Now(),
+		MetricSets: map[string]*core.MetricSet{
+			core.NodeKey("node1"): {
+				Labels: map[string]string{
+					core.LabelMetricSetType.Key: core.MetricSetTypeNode,
+					core.LabelHostname.Key:      "node1",
+				},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricMemoryUsage.Name: {ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 42},
+				},
+			},
+		},
+	})
+	require.NoError(t, NewUploader(store, metricSink).Upload())
+
+	require.NoError(t, NewUploader(store, restored).Restore())
+	assert.Equal(t, []string{"node1"}, restored.GetNodes(""))
+	assert.Equal(t, int64(42), restored.GetLatestDataBatch().MetricSets[core.NodeKey("node1")].MetricValues[core.MetricMemoryUsage.Name].IntValue)
+}
@@ -0,0 +1,206 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// Name of the snapshot object when the location is a bucket or a directory.
+	defaultObjectName = "heapster-model.gob.gz"
+	gcsEndpoint       = "https://storage.googleapis.com"
+	gcsScope          = "https://www.googleapis.com/auth/devstorage.read_write"
+	storeTimeout      = time.Minute
+)
+
+// ObjectStore reads and writes the snapshot object in a remote object storage.
+type ObjectStore interface {
+	// Writes the object, replacing the previous one.
+	Put(data []byte) error
+	// Reads the object, nil if there is none.
+	Get() ([]byte, error)
+	// Location of the object, for logging.
+	String() string
+}
+
+// A store using plain HTTP requests, authenticated by the sign function.
+type httpStore struct {
+	client    *http.Client
+	objectUrl string
+	sign      func(req *http.Request, body []byte) error
+}
+
+func (this *httpStore) String() string {
+	return this.objectUrl
+}
+
+func (this *httpStore) do(method string, body []byte) ([]byte, int, error) {
+	req, err := http.NewRequest(method, this.objectUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if err := this.sign(req, body); err != nil {
+		return nil, 0, err
+	}
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return content, resp.StatusCode, nil
+}
+
+func (this *httpStore) Put(data []byte) error {
+	content, status, err := this.do("PUT", data)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to write %s: status %d: %s", this.objectUrl, status, string(content))
+	}
+	return nil
+}
+
+func (this *httpStore) Get() ([]byte, error) {
+	content, status, err := this.do("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case http.StatusOK:
+		return content, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to read %s: status %d: %s", this.objectUrl, status, string(content))
+	}
+}
+
+// Escapes the object name, keeping its slashes.
+func escapeObjectName(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = url.QueryEscape(part)
+		parts[i] = strings.Replace(parts[i], "+", "%20", -1)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Google Cloud Storage, through its XML API with the default Google credentials.
+func newGCSStore(bucket, object string, opts url.Values) (ObjectStore, error) {
+	endpoint := gcsEndpoint
+	if len(opts["endpoint"]) >= 1 {
+		endpoint = strings.TrimSuffix(opts["endpoint"][0], "/")
+	}
+	client := &http.Client{Timeout: storeTimeout}
+	if endpoint == gcsEndpoint {
+		var err error
+		if client, err = google.DefaultClient(oauth2.NoContext, gcsScope); err != nil {
+			return nil, fmt.Errorf("failed to get Google credentials: %v", err)
+		}
+		client.Timeout = storeTimeout
+	}
+	return &httpStore{
+		client:    client,
+		objectUrl: fmt.Sprintf("%s/%s/%s", endpoint, bucket, escapeObjectName(object)),
+		sign:      func(*http.Request, []byte) error { return nil },
+	}, nil
+}
+
+// Amazon S3 or a compatible storage, with requests signed with the default AWS credentials.
+func newS3Store(bucket, object string, opts url.Values) (ObjectStore, error) {
+	if len(opts["region"]) < 1 {
+		return nil, fmt.Errorf("the `region` option is required for S3 locations")
+	}
+	region := opts["region"][0]
+	// Virtual-hosted style for AWS, path style for custom endpoints.
+	objectUrl := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, escapeObjectName(object))
+	if len(opts["endpoint"]) >= 1 {
+		objectUrl = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(opts["endpoint"][0], "/"), bucket, escapeObjectName(object))
+	}
+	creds := defaults.CredChain(defaults.Config(), defaults.Handlers())
+	return &httpStore{
+		client:    &http.Client{Timeout: storeTimeout},
+		objectUrl: objectUrl,
+		sign: func(req *http.Request, body []byte) error {
+			return signS3Request(req, body, region, creds)
+		},
+	}, nil
+}
+
+// Signs the request with the AWS signature version 4.
+func signS3Request(req *http.Request, body []byte, region string, creds *credentials.Credentials) error {
+	awsReq := request.New(aws.Config{Credentials: creds, Region: aws.String(region)},
+		metadata.ClientInfo{ServiceName: "s3", SigningRegion: region}, request.Handlers{}, nil,
+		&request.Operation{HTTPMethod: req.Method}, nil, nil)
+	awsReq.HTTPRequest = req
+	// Only used to compute the digest of the payload.
+	awsReq.Body = bytes.NewReader(body)
+	v4.Sign(awsReq)
+	return awsReq.Error
+}
+
+// NewObjectStore creates the store of a location like gs://<bucket>/<object> or
+// s3://<bucket>/<object>?region=<region>. Locations ending with a slash get a default object name.
+func NewObjectStore(location string) (ObjectStore, error) {
+	uri, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	object := strings.TrimPrefix(uri.Path, "/")
+	if object == "" || strings.HasSuffix(object, "/") {
+		object += defaultObjectName
+	}
+	return NewObjectStoreAt(uri, object)
+}
+
+// NewObjectStoreAt creates the store of the given object in the bucket of a location like
+// gs://<bucket>/... or s3://<bucket>/...?region=<region>. The path of the location is ignored.
+func NewObjectStoreAt(location *url.URL, object string) (ObjectStore, error) {
+	if location.Host == "" {
+		return nil, fmt.Errorf("no bucket in location %q", location)
+	}
+	switch location.Scheme {
+	case "gs":
+		return newGCSStore(location.Host, object, location.Query())
+	case "s3":
+		return newS3Store(location.Host, object, location.Query())
+	default:
+		return nil, fmt.Errorf("unsupported location %q, should start with gs:// or s3://", location)
+	}
+}
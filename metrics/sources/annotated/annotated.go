@@ -0,0 +1,183 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package annotated adds to the sources of a provider the ones scraping the metrics endpoints
+// which the running pods declare in their annotations, like the prometheus and appmetrics ones.
+package annotated
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	. "k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// Annotations of the pods declaring their metrics endpoint.
+type Endpoint struct {
+	// Annotation enabling the endpoint when true. Without it, the path annotation does.
+	Enable string
+	// Annotation of the path of the endpoint, DefaultPath if missing.
+	Path        string
+	DefaultPath string
+	// Annotation of the port of the endpoint, the first declared port of the pod if missing.
+	Port string
+	// Annotation of the scheme of the endpoint, http if missing, or empty if it's always http.
+	Scheme string
+}
+
+// URL returns the url of the endpoint of the pod, or false if the pod isn't running or doesn't
+// declare it.
+func (this *Endpoint) URL(pod *kube_api.Pod) (string, bool) {
+	path := pod.Annotations[this.Path]
+	if this.Enable != "" {
+		if enabled, _ := strconv.ParseBool(pod.Annotations[this.Enable]); !enabled {
+			return "", false
+		}
+		if path == "" {
+			path = this.DefaultPath
+		}
+	}
+	if path == "" {
+		return "", false
+	}
+	if pod.Status.Phase != kube_api.PodRunning || pod.Status.PodIP == "" {
+		return "", false
+	}
+	port := pod.Annotations[this.Port]
+	if port == "" {
+		// Like Prometheus, the first declared port by default.
+		for _, container := range pod.Spec.Containers {
+			if len(container.Ports) > 0 {
+				port = strconv.Itoa(int(container.Ports[0].ContainerPort))
+				break
+			}
+		}
+	}
+	if port == "" {
+		glog.V(2).Infof("Not scraping pod %s/%s: no port to scrape", pod.Namespace, pod.Name)
+		return "", false
+	}
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(pod.Status.PodIP, port),
+		Path:   path,
+	}
+	if scheme := pod.Annotations[this.Scheme]; this.Scheme != "" && scheme != "" {
+		u.Scheme = scheme
+	}
+	return u.String(), true
+}
+
+// The endpoint of a pod, which the sources of the pods embed.
+type Pod struct {
+	Namespace string
+	PodName   string
+	URL       string
+	// Labels of the metric set of the pod.
+	Labels map[string]string
+}
+
+func (this *Pod) NodeName() string {
+	return this.Labels[LabelNodename.Key]
+}
+
+// Key returns the key of the metric set of the pod.
+func (this *Pod) Key() string {
+	return PodKey(this.Namespace, this.PodName)
+}
+
+// NewMetricSet returns an empty metric set of the pod, scraped now.
+func (this *Pod) NewMetricSet() *MetricSet {
+	ms := &MetricSet{
+		ScrapeTime:     time.Now(),
+		Labels:         make(map[string]string, len(this.Labels)),
+		MetricValues:   map[string]MetricValue{},
+		LabeledMetrics: []LabeledMetric{},
+	}
+	for k, v := range this.Labels {
+		ms.Labels[k] = v
+	}
+	return ms
+}
+
+// Get requests the endpoint, accepting the given content type, and returns the response if it
+// succeeded. The caller closes its body.
+func (this *Pod) Get(client *http.Client, accept string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", this.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("request failed - %q", resp.Status)
+	}
+	return resp, nil
+}
+
+// Adds a source for every pod declaring the endpoint to the sources of the provider.
+type provider struct {
+	provider  MetricsSourceProvider
+	podLister *cache.StoreToPodLister
+	endpoint  Endpoint
+	newSource func(pod Pod) MetricsSource
+}
+
+func (this *provider) GetMetricsSources() []MetricsSource {
+	sources := this.provider.GetMetricsSources()
+	pods, err := this.podLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("error while listing pods: %v", err)
+		return sources
+	}
+	for _, pod := range pods {
+		u, found := this.endpoint.URL(pod)
+		if !found {
+			continue
+		}
+		sources = append(sources, this.newSource(Pod{
+			Namespace: pod.Namespace,
+			PodName:   pod.Name,
+			URL:       u,
+			Labels:    util.PodLabels(pod),
+		}))
+	}
+	return sources
+}
+
+// NewProvider returns a provider adding the source returned by newSource for every pod of the
+// lister declaring the endpoint to the sources of the provider.
+func NewProvider(inner MetricsSourceProvider, podLister *cache.StoreToPodLister, endpoint Endpoint,
+	newSource func(pod Pod) MetricsSource) MetricsSourceProvider {
+	return &provider{
+		provider:  inner,
+		podLister: podLister,
+		endpoint:  endpoint,
+		newSource: newSource,
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package appmetrics fetches the application metrics of the pods annotated with the path of
+// their metrics endpoint, in the JSON format defined here, and attaches them to the metric sets
+// of the pods as custom metrics.
+package appmetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	. "k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/annotated"
+	"k8s.io/heapster/metrics/sources/kubelet"
+	"k8s.io/heapster/metrics/util"
+	"k8s.io/heapster/metrics/util/accounting"
+	"k8s.io/kubernetes/pkg/client/cache"
+	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+const (
+	// Annotations of the pods serving their metrics.
+	PathAnnotation = "heapster.io/metrics-path"
+	PortAnnotation = "heapster.io/metrics-port"
+
+	TypeGauge      = "gauge"
+	TypeCumulative = "cumulative"
+
+	// Time allowed to a pod to return its metrics.
+	fetchTimeout = 10 * time.Second
+	// Largest response read from a pod.
+	maxResponseSize = 1 << 20
+)
+
+// Response is returned by the metrics endpoints of the pods, e.g.
+// {"metrics": [{"name": "queue_length", "value": 12}]}.
+type Response struct {
+	Metrics []AppMetric `json:"metrics"`
+}
+
+type AppMetric struct {
+	// Name of the metric, exported as custom/<name>.
+	Name string `json:"name"`
+	// gauge, the default, or cumulative.
+	Type  string  `json:"type,omitempty"`
+	Value float64 `json:"value"`
+	// Labels of the metric, which make it a labeled metric.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// A source fetching the metrics endpoint of a pod.
+type podSource struct {
+	annotated.Pod
+	client *http.Client
+}
+
+func (this *podSource) Name() string {
+	return this.String()
+}
+
+func (this *podSource) String() string {
+	return fmt.Sprintf("appmetrics:%s/%s", this.Namespace, this.PodName)
+}
+
+func (this *podSource) ScrapeMetrics(start, end time.Time) *DataBatch {
+	result := &DataBatch{
+		Timestamp:  end,
+		MetricSets: map[string]*MetricSet{},
+	}
+	response, err := this.fetch()
+	if err != nil {
+		glog.Errorf("Failed to fetch the metrics of pod %s/%s from %s: %v", this.Namespace, this.PodName, this.URL, err)
+		return result
+	}
+	ms := this.NewMetricSet()
+	for _, metric := range response.Metrics {
+		if err := addMetric(ms, &metric); err != nil {
+			glog.V(4).Infof("Skipping metric %q of pod %s/%s: %v", metric.Name, this.Namespace, this.PodName, err)
+		}
+	}
+	result.MetricSets[this.Key()] = ms
+	return result
+}
+
+func (this *podSource) fetch() (*Response, error) {
+	resp, err := this.Get(this.client, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	response := &Response{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Adds the metric to the metric set as a custom metric, labeled if it has labels.
+func addMetric(ms *MetricSet, metric *AppMetric) error {
+	if metric.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	value := MetricValue{
+		ValueType:  ValueFloat,
+		FloatValue: float32(metric.Value),
+	}
+	switch metric.Type {
+	case "", TypeGauge:
+		value.MetricType = MetricGauge
+	case TypeCumulative:
+		value.MetricType = MetricCumulative
+	default:
+		return fmt.Errorf("unknown type %q", metric.Type)
+	}
+	name := CustomMetricPrefix + metric.Name
+	if len(metric.Labels) == 0 {
+		ms.MetricValues[name] = value
+		return nil
+	}
+	ms.LabeledMetrics = append(ms.LabeledMetrics, LabeledMetric{
+		Name:        name,
+		Labels:      metric.Labels,
+		MetricValue: value,
+	})
+	return nil
+}
+
+// The endpoint of the pods annotated with heapster.io/metrics-path.
+var endpoint = annotated.Endpoint{
+	Path: PathAnnotation,
+	Port: PortAnnotation,
+}
+
+// Adds a source for every running pod annotated with heapster.io/metrics-path to the sources of
+// the provider.
+func newAppMetricsProvider(provider MetricsSourceProvider, podLister *cache.StoreToPodLister, client *http.Client) MetricsSourceProvider {
+	return annotated.NewProvider(provider, podLister, endpoint, func(pod annotated.Pod) MetricsSource {
+		return &podSource{Pod: pod, client: client}
+	})
+}
+
+// NewAppMetricsProvider adds the sources fetching the metrics of the annotated pods to the
+// sources of the provider, if the appMetrics option of the kubernetes source uri is set.
+// Otherwise it returns the provider as is.
+func NewAppMetricsProvider(provider MetricsSourceProvider, uri *url.URL) (MetricsSourceProvider, error) {
+	opts := uri.Query()
+	if len(opts["appMetrics"]) == 0 {
+		return provider, nil
+	}
+	enabled, err := strconv.ParseBool(opts["appMetrics"][0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse `appMetrics` flag - %v", err)
+	}
+	if !enabled {
+		return provider, nil
+	}
+
+	kubeConfig, _, err := kubelet.GetKubeConfigs(uri)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient := kube_client.NewOrDie(kubeConfig)
+	podLister, _, _ := util.GetPodLister(kubeClient)
+	client := &http.Client{
+		Transport: &http.Transport{Dial: accounting.DefaultLedger.Dial(accounting.SourceOwner("appmetrics"), nil)},
+		Timeout:   fetchTimeout,
+	}
+	return newAppMetricsProvider(provider, podLister, client), nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/annotated"
+	"k8s.io/heapster/metrics/util"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+const response = `{"metrics": [
+	{"name": "queue_length", "value": 12},
+	{"name": "http_requests_total", "type": "cumulative", "value": 1027, "labels": {"code": "200"}},
+	{"name": "http_requests_total", "type": "cumulative", "value": 3, "labels": {"code": "500"}},
+	{"name": "latency", "type": "histogram", "value": 0.2},
+	{"value": 1}
+]}`
+
+func annotatedPod(name string, annotations map[string]string) *kube_api.Pod {
+	return &kube_api.Pod{
+		ObjectMeta: kube_api.ObjectMeta{
+			Name:        name,
+			Namespace:   "ns1",
+			UID:         types.UID("uid-" + name),
+			Annotations: annotations,
+		},
+		Spec: kube_api.PodSpec{
+			NodeName: "node1",
+			Containers: []kube_api.Container{{
+				Ports: []kube_api.ContainerPort{{ContainerPort: 8080}},
+			}},
+		},
+		Status: kube_api.PodStatus{
+			Phase: kube_api.PodRunning,
+			PodIP: "10.0.0.1",
+		},
+	}
+}
+
+func TestMetricsUrl(t *testing.T) {
+	for _, test := range []struct {
+		annotations map[string]string
+		url         string
+	}{
+		{nil, ""},
+		{map[string]string{PortAnnotation: "9102"}, ""},
+		{map[string]string{PathAnnotation: "/stats"}, "http://10.0.0.1:8080/stats"},
+		{map[string]string{PathAnnotation: "/stats", PortAnnotation: "9102"}, "http://10.0.0.1:9102/stats"},
+	} {
+		u, found := endpoint.URL(annotatedPod("pod1", test.annotations))
+		assert.Equal(t, test.url != "", found, "%v", test.annotations)
+		assert.Equal(t, test.url, u, "%v", test.annotations)
+	}
+
+	pending := annotatedPod("pod1", map[string]string{PathAnnotation: "/stats"})
+	pending.Status.Phase = kube_api.PodPending
+	_, found := endpoint.URL(pending)
+	assert.False(t, found)
+
+	noPort := annotatedPod("pod1", map[string]string{PathAnnotation: "/stats"})
+	noPort.Spec.Containers = nil
+	_, found = endpoint.URL(noPort)
+	assert.False(t, found)
+}
+
+func TestFetchPod(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	source := &podSource{
+		Pod: annotated.Pod{
+			Namespace: "ns1",
+			PodName:   "pod1",
+			URL:       server.URL,
+			Labels: map[string]string{
+				core.LabelMetricSetType.Key: core.MetricSetTypePod,
+				core.LabelNodename.Key:      "node1",
+			},
+		},
+		client: http.DefaultClient,
+	}
+	assert.Equal(t, "node1", source.NodeName())
+	batch := source.ScrapeMetrics(time.Now(), time.Now())
+	ms := batch.MetricSets[core.PodKey("ns1", "pod1")]
+	require.NotNil(t, ms)
+	assert.Equal(t, core.MetricSetTypePod, ms.Labels[core.LabelMetricSetType.Key])
+
+	// Without the metrics of unknown type or without name.
+	require.Len(t, ms.MetricValues, 1)
+	assert.Equal(t, core.MetricValue{ValueType: core.ValueFloat, MetricType: core.MetricGauge, FloatValue: 12},
+		ms.MetricValues["custom/queue_length"])
+	require.Len(t, ms.LabeledMetrics, 2)
+	for _, metric := range ms.LabeledMetrics {
+		assert.Equal(t, "custom/http_requests_total", metric.Name)
+		assert.Equal(t, core.MetricCumulative, metric.MetricType)
+		if metric.Labels["code"] == "500" {
+			assert.Equal(t, float32(3), metric.FloatValue)
+		} else {
+			assert.Equal(t, float32(1027), metric.FloatValue)
+		}
+	}
+
+	// A failed fetch returns no metric set.
+	server.Close()
+	batch = source.ScrapeMetrics(time.Now(), time.Now())
+	assert.Empty(t, batch.MetricSets)
+}
+
+func TestAppMetricsProvider(t *testing.T) {
+	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, store.Add(annotatedPod("pod1", map[string]string{PathAnnotation: "/stats"})))
+	require.NoError(t, store.Add(annotatedPod("pod2", nil)))
+	provider := newAppMetricsProvider(util.NewDummyMetricsSourceProvider(util.NewDummyMetricsSource("node1", 0)),
+		&cache.StoreToPodLister{Indexer: store}, http.DefaultClient)
+	sources := provider.GetMetricsSources()
+	require.Len(t, sources, 2)
+	pod := sources[1].(*podSource)
+	assert.Equal(t, "appmetrics:ns1/pod1", pod.Name())
+	assert.Equal(t, "http://10.0.0.1:8080/stats", pod.URL)
+	assert.Equal(t, "uid-pod1", pod.Labels[core.LabelPodId.Key])
+}
+
+func TestNewAppMetricsProvider(t *testing.T) {
+	inner := util.NewDummyMetricsSourceProvider()
+	for _, query := range []string{"", "appMetrics=false"} {
+		provider, err := NewAppMetricsProvider(inner, &url.URL{RawQuery: query})
+		require.NoError(t, err)
+		assert.Equal(t, inner, provider)
+	}
+	_, err := NewAppMetricsProvider(inner, &url.URL{RawQuery: "appMetrics=maybe"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	. "k8s.io/heapster/metrics/core"
+)
+
+const (
+	// The canary value is always 1.
+	CanaryConstant = "constant"
+	// The canary value goes up by one every scrape and wraps around to 0 after the period.
+	CanarySawtooth = "sawtooth"
+)
+
+// canarySource generates a known synthetic series that goes through the processors and
+// reaches every sink like the scraped metrics, so that the end-to-end delivery and the
+// latency of each sink can be checked by looking for the canary downstream.
+type canarySource struct {
+	sync.Mutex
+	pattern string
+	period  int64
+	step    int64
+	now     func() time.Time
+}
+
+func (this *canarySource) Name() string {
+	return "canary"
+}
+
+func (this *canarySource) String() string {
+	return fmt.Sprintf("canary source (%s)", this.pattern)
+}
+
+func (this *canarySource) ScrapeMetrics(start, end time.Time) *DataBatch {
+	this.Lock()
+	value := int64(1)
+	if this.pattern == CanarySawtooth {
+		value = this.step % this.period
+	}
+	this.step++
+	this.Unlock()
+
+	now := this.now()
+	return &DataBatch{
+		Timestamp: end,
+		MetricSets: map[string]*MetricSet{
+			CanaryKey(): {
+				CreateTime: now,
+				ScrapeTime: now,
+				Labels: map[string]string{
+					LabelMetricSetType.Key: MetricSetTypeCanary,
+				},
+				MetricValues: map[string]MetricValue{
+					MetricCanaryValue.Name: {
+						ValueType:  ValueInt64,
+						MetricType: MetricGauge,
+						IntValue:   value,
+					},
+					MetricCanaryTimestamp.Name: {
+						ValueType:  ValueInt64,
+						MetricType: MetricGauge,
+						IntValue:   now.UnixNano() / int64(time.Millisecond),
+					},
+				},
+			},
+		},
+	}
+}
+
+type canaryProvider struct {
+	provider MetricsSourceProvider
+	canary   *canarySource
+}
+
+func (this *canaryProvider) GetMetricsSources() []MetricsSource {
+	return append(this.provider.GetMetricsSources(), this.canary)
+}
+
+// NewCanaryProvider adds a source generating the canary series with the given pattern
+// to the sources of the provider. The period is the number of scrapes of a sawtooth.
+func NewCanaryProvider(provider MetricsSourceProvider, pattern string, period int) (MetricsSourceProvider, error) {
+	switch pattern {
+	case CanaryConstant, CanarySawtooth:
+	default:
+		return nil, fmt.Errorf("canary pattern not recognized: %s", pattern)
+	}
+	if period < 1 {
+		return nil, fmt.Errorf("canary period needs to be positive - %d", period)
+	}
+	return &canaryProvider{
+		provider: provider,
+		canary: &canarySource{
+			pattern: pattern,
+			period:  int64(period),
+			now:     time.Now,
+		},
+	}, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+)
+
+func TestCanarySawtooth(t *testing.T) {
+	provider, err := NewCanaryProvider(util.NewDummyMetricsSourceProvider(
+		util.NewDummyMetricsSource("s1", 0)), CanarySawtooth, 3)
+	require.NoError(t, err)
+
+	manager, _ := NewSourceManager(provider, time.Second*3)
+	end := time.Now().Truncate(10 * time.Second)
+	values := []int64{}
+	for i := 0; i < 5; i++ {
+		before := time.Now()
+		batch := manager.ScrapeMetrics(end.Add(-10*time.Second), end)
+		assert.Contains(t, batch.MetricSets, "s1")
+		canary, found := batch.MetricSets[core.CanaryKey()]
+		require.True(t, found)
+		assert.Equal(t, core.MetricSetTypeCanary, canary.Labels[core.LabelMetricSetType.Key])
+		assert.True(t, canary.MetricValues[core.MetricCanaryTimestamp.Name].IntValue >= before.UnixNano()/int64(time.Millisecond))
+		values = append(values, canary.MetricValues[core.MetricCanaryValue.Name].IntValue)
+	}
+	assert.Equal(t, []int64{0, 1, 2, 0, 1}, values)
+}
+
+func TestCanaryConstant(t *testing.T) {
+	provider, err := NewCanaryProvider(util.NewDummyMetricsSourceProvider(), CanaryConstant, 10)
+	require.NoError(t, err)
+	sources := provider.GetMetricsSources()
+	require.Len(t, sources, 1)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		batch := sources[0].ScrapeMetrics(now.Add(-time.Minute), now)
+		assert.Equal(t, int64(1), batch.MetricSets[core.CanaryKey()].MetricValues[core.MetricCanaryValue.Name].IntValue)
+	}
+}
+
+func TestCanaryInvalidConfig(t *testing.T) {
+	_, err := NewCanaryProvider(util.NewDummyMetricsSourceProvider(), "square", 10)
+	assert.Error(t, err)
+	_, err = NewCanaryProvider(util.NewDummyMetricsSourceProvider(), CanarySawtooth, 0)
+	assert.Error(t, err)
+}
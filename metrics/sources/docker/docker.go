@@ -0,0 +1,298 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package docker reads the stats of the containers from the Docker Engine API, for heapster
+// running as a host agent outside of Kubernetes.
+package docker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	dockertypes "github.com/docker/engine-api/types"
+	"github.com/golang/glog"
+
+	. "k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+	"k8s.io/heapster/metrics/util/accounting"
+)
+
+const (
+	DefaultSocket = "/var/run/docker.sock"
+
+	// Labels set by the Kubelet on the containers of the pods.
+	podNameLabel       = "io.kubernetes.pod.name"
+	podNamespaceLabel  = "io.kubernetes.pod.namespace"
+	podUIDLabel        = "io.kubernetes.pod.uid"
+	containerNameLabel = "io.kubernetes.container.name"
+	// Name of the infrastructure containers of the pods, which aren't exported.
+	infraContainerName = "POD"
+
+	// Stats requests running at once. Each takes about a second, as the engine samples the CPU.
+	maxParallelStats = 10
+	requestTimeout   = 30 * time.Second
+)
+
+// A source reading the stats of the running containers of a Docker Engine.
+type dockerMetricsSource struct {
+	client *http.Client
+	// Url of the engine, without its path.
+	url      string
+	hostname string
+}
+
+func (this *dockerMetricsSource) Name() string {
+	return this.String()
+}
+
+func (this *dockerMetricsSource) String() string {
+	return fmt.Sprintf("docker:%s", this.hostname)
+}
+
+func (this *dockerMetricsSource) NodeName() string {
+	return this.hostname
+}
+
+func (this *dockerMetricsSource) ScrapeMetrics(start, end time.Time) *DataBatch {
+	result := &DataBatch{
+		Timestamp:  end,
+		MetricSets: map[string]*MetricSet{},
+	}
+	containers := []dockertypes.Container{}
+	if err := this.get("/containers/json", &containers); err != nil {
+		glog.Errorf("Failed to list the containers of Docker Engine %s: %v", this.url, err)
+		return result
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxParallelStats)
+	for _, container := range containers {
+		if container.Labels[containerNameLabel] == infraContainerName {
+			continue
+		}
+		container := container
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			stats := &dockertypes.StatsJSON{}
+			if err := this.get("/containers/"+container.ID+"/stats?stream=false", stats); err != nil {
+				glog.Errorf("Failed to get the stats of container %s: %v", container.ID, err)
+				return
+			}
+			key, ms := this.decodeContainer(&container, stats)
+			lock.Lock()
+			result.MetricSets[key] = ms
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	return result
+}
+
+func (this *dockerMetricsSource) get(path string, value interface{}) error {
+	resp, err := this.client.Get(this.url + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body - %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed - %q, response: %q", resp.Status, string(body))
+	}
+	return json.Unmarshal(body, value)
+}
+
+// Returns the key and the metric set of the container. The containers of the pods started by
+// a Kubelet are exported as pod containers, with the pod labels of the Kubelet, and the other
+// ones as system containers of the host. The other labels of the containers go to the labels
+// label.
+func (this *dockerMetricsSource) decodeContainer(container *dockertypes.Container, stats *dockertypes.StatsJSON) (string, *MetricSet) {
+	ms := &MetricSet{
+		CreateTime:     time.Unix(container.Created, 0),
+		ScrapeTime:     stats.Read,
+		MetricValues:   map[string]MetricValue{},
+		LabeledMetrics: []LabeledMetric{},
+		Labels: map[string]string{
+			LabelHostname.Key:           this.hostname,
+			LabelNodename.Key:           this.hostname,
+			LabelContainerBaseImage.Key: container.Image,
+		},
+	}
+
+	userLabels := make(map[string]string)
+	for k, v := range container.Labels {
+		if !strings.HasPrefix(k, "io.kubernetes.") {
+			userLabels[k] = v
+		}
+	}
+	if len(userLabels) > 0 {
+		ms.Labels[LabelLabels.Key] = util.LabelsToString(userLabels)
+	}
+
+	var key string
+	pod, namespace := container.Labels[podNameLabel], container.Labels[podNamespaceLabel]
+	if pod != "" && namespace != "" && container.Labels[containerNameLabel] != "" {
+		name := container.Labels[containerNameLabel]
+		key = PodContainerKey(namespace, pod, name)
+		ms.Labels[LabelMetricSetType.Key] = MetricSetTypePodContainer
+		ms.Labels[LabelContainerName.Key] = name
+		ms.Labels[LabelPodName.Key] = pod
+		ms.Labels[LabelNamespaceName.Key] = namespace
+		ms.Labels[LabelPodNamespace.Key] = namespace
+		ms.Labels[LabelPodId.Key] = container.Labels[podUIDLabel]
+	} else {
+		name := container.ID
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		key = NodeContainerKey(this.hostname, name)
+		ms.Labels[LabelMetricSetType.Key] = MetricSetTypeSystemContainer
+		ms.Labels[LabelContainerName.Key] = name
+	}
+
+	addInt := func(metric *Metric, value uint64) {
+		ms.MetricValues[metric.Name] = MetricValue{
+			ValueType:  ValueInt64,
+			MetricType: metric.Type,
+			IntValue:   int64(value),
+		}
+	}
+	if !ms.CreateTime.IsZero() {
+		addInt(&MetricUptime, uint64(time.Since(ms.CreateTime).Nanoseconds()/time.Millisecond.Nanoseconds()))
+	}
+	addInt(&MetricCpuUsage, stats.CPUStats.CPUUsage.TotalUsage)
+	addInt(&MetricMemoryUsage, stats.MemoryStats.Usage)
+	// Like cAdvisor, the working set leaves out the inactive page cache.
+	workingSet := stats.MemoryStats.Usage
+	if inactive := stats.MemoryStats.Stats["total_inactive_file"]; inactive < workingSet {
+		workingSet -= inactive
+	}
+	addInt(&MetricMemoryWorkingSet, workingSet)
+	if value, found := stats.MemoryStats.Stats["pgfault"]; found {
+		addInt(&MetricMemoryPageFaults, value)
+	}
+	if value, found := stats.MemoryStats.Stats["pgmajfault"]; found {
+		addInt(&MetricMemoryMajorPageFaults, value)
+	}
+	if len(stats.Networks) > 0 {
+		network := dockertypes.NetworkStats{}
+		for _, iface := range stats.Networks {
+			network.RxBytes += iface.RxBytes
+			network.RxErrors += iface.RxErrors
+			network.TxBytes += iface.TxBytes
+			network.TxErrors += iface.TxErrors
+		}
+		addInt(&MetricNetworkRx, network.RxBytes)
+		addInt(&MetricNetworkRxErrors, network.RxErrors)
+		addInt(&MetricNetworkTx, network.TxBytes)
+		addInt(&MetricNetworkTxErrors, network.TxErrors)
+	}
+	return key, ms
+}
+
+type dockerProvider struct {
+	source *dockerMetricsSource
+}
+
+func (this *dockerProvider) GetMetricsSources() []MetricsSource {
+	return []MetricsSource{this.source}
+}
+
+// NewDockerProvider returns a provider of the source reading the Docker Engine at the uri:
+// unix:///path/to/socket, the default socket if empty, or tcp://host:port, with TLS if its
+// tlsCert and tlsKey options are set.
+func NewDockerProvider(uri *url.URL) (MetricsSourceProvider, error) {
+	opts := uri.Query()
+	hostname := ""
+	if len(opts["hostname"]) >= 1 {
+		hostname = opts["hostname"][0]
+	} else {
+		var err error
+		if hostname, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get the hostname - %v", err)
+		}
+	}
+
+	dial := accounting.DefaultLedger.Dial(accounting.SourceOwner("docker"), nil)
+	transport := &http.Transport{}
+	source := &dockerMetricsSource{hostname: hostname}
+	switch uri.Scheme {
+	case "", "unix":
+		socket := uri.Path
+		if socket == "" {
+			socket = DefaultSocket
+		}
+		transport.Dial = func(_, _ string) (net.Conn, error) {
+			return dial("unix", socket)
+		}
+		source.url = "http://docker"
+	case "tcp":
+		transport.Dial = dial
+		source.url = "http://" + uri.Host
+		if len(opts["tlsCert"]) >= 1 || len(opts["tlsKey"]) >= 1 {
+			tlsConfig, err := clientTLSConfig(opts)
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsConfig
+			source.url = "https://" + uri.Host
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Docker Engine address %q, should be unix:// or tcp://", uri.String())
+	}
+	source.client = &http.Client{Transport: transport, Timeout: requestTimeout}
+	return &dockerProvider{source: source}, nil
+}
+
+// Returns the TLS configuration of the tlsCert, tlsKey and tlsCA options, like the --tlscert,
+// --tlskey and --tlscacert options of the docker CLI.
+func clientTLSConfig(opts url.Values) (*tls.Config, error) {
+	if len(opts["tlsCert"]) == 0 || len(opts["tlsKey"]) == 0 {
+		return nil, fmt.Errorf("both `tlsCert` and `tlsKey` flags are required for TLS")
+	}
+	cert, err := tls.LoadX509KeyPair(opts["tlsCert"][0], opts["tlsKey"][0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the TLS client certificate - %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if len(opts["tlsCA"]) >= 1 {
+		ca, err := ioutil.ReadFile(opts["tlsCA"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read `tlsCA` - %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to parse `tlsCA` - no certificate found")
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dockertypes "github.com/docker/engine-api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// Serves the containers and their stats like the Docker Engine API.
+func fakeEngine(t *testing.T) http.Handler {
+	containers := []dockertypes.Container{{
+		ID:      "c1",
+		Names:   []string{"/web"},
+		Image:   "nginx:1.11",
+		Created: time.Now().Add(-time.Hour).Unix(),
+		Labels:  map[string]string{"com.example.team": "frontend"},
+	}, {
+		ID:    "c2",
+		Names: []string{"/k8s_app_pod1"},
+		Image: "app:1",
+		Labels: map[string]string{
+			podNameLabel:       "pod1",
+			podNamespaceLabel:  "ns1",
+			podUIDLabel:        "uid1",
+			containerNameLabel: "app",
+		},
+	}, {
+		ID:     "c3",
+		Names:  []string{"/k8s_POD_pod1"},
+		Labels: map[string]string{podNameLabel: "pod1", podNamespaceLabel: "ns1", containerNameLabel: infraContainerName},
+	}}
+	stats := &dockertypes.StatsJSON{
+		Stats: dockertypes.Stats{
+			Read:     time.Now(),
+			CPUStats: dockertypes.CPUStats{CPUUsage: dockertypes.CPUUsage{TotalUsage: 5000}},
+			MemoryStats: dockertypes.MemoryStats{
+				Usage: 1000,
+				Stats: map[string]uint64{"total_inactive_file": 300, "pgfault": 7, "pgmajfault": 1},
+			},
+		},
+		Networks: map[string]dockertypes.NetworkStats{
+			"eth0": {RxBytes: 10, TxBytes: 20},
+			"eth1": {RxBytes: 1, TxBytes: 2, RxErrors: 3},
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var value interface{}
+		switch r.URL.Path {
+		case "/containers/json":
+			value = containers
+		case "/containers/c1/stats", "/containers/c2/stats":
+			assert.Equal(t, "false", r.URL.Query().Get("stream"))
+			value = stats
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(value))
+	})
+}
+
+func TestScrapeMetrics(t *testing.T) {
+	server := httptest.NewServer(fakeEngine(t))
+	defer server.Close()
+	serverUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	provider, err := NewDockerProvider(&url.URL{Scheme: "tcp", Host: serverUrl.Host, RawQuery: "hostname=host1"})
+	require.NoError(t, err)
+	sources := provider.GetMetricsSources()
+	require.Len(t, sources, 1)
+	assert.Equal(t, "docker:host1", sources[0].Name())
+	batch := sources[0].ScrapeMetrics(time.Now(), time.Now())
+	require.Len(t, batch.MetricSets, 2)
+
+	web := batch.MetricSets[core.NodeContainerKey("host1", "web")]
+	require.NotNil(t, web)
+	assert.Equal(t, core.MetricSetTypeSystemContainer, web.Labels[core.LabelMetricSetType.Key])
+	assert.Equal(t, "com.example.team:frontend", web.Labels[core.LabelLabels.Key])
+	assert.Equal(t, "nginx:1.11", web.Labels[core.LabelContainerBaseImage.Key])
+	assert.Equal(t, "host1", web.Labels[core.LabelNodename.Key])
+	for metric, value := range map[string]int64{
+		core.MetricCpuUsage.Name:              5000,
+		core.MetricMemoryUsage.Name:           1000,
+		core.MetricMemoryWorkingSet.Name:      700,
+		core.MetricMemoryPageFaults.Name:      7,
+		core.MetricMemoryMajorPageFaults.Name: 1,
+		core.MetricNetworkRx.Name:             11,
+		core.MetricNetworkTx.Name:             22,
+		core.MetricNetworkRxErrors.Name:       3,
+	} {
+		assert.Equal(t, value, web.MetricValues[metric].IntValue, metric)
+	}
+	assert.True(t, web.MetricValues[core.MetricUptime.Name].IntValue >= int64(time.Hour/time.Millisecond))
+
+	app := batch.MetricSets[core.PodContainerKey("ns1", "pod1", "app")]
+	require.NotNil(t, app)
+	assert.Equal(t, core.MetricSetTypePodContainer, app.Labels[core.LabelMetricSetType.Key])
+	assert.Equal(t, "uid1", app.Labels[core.LabelPodId.Key])
+	assert.Equal(t, "app", app.Labels[core.LabelContainerName.Key])
+	_, found := app.Labels[core.LabelLabels.Key]
+	assert.False(t, found)
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := &httptest.Server{Listener: listener, Config: &http.Server{Handler: fakeEngine(t)}}
+	server.Start()
+	defer server.Close()
+
+	provider, err := NewDockerProvider(&url.URL{Scheme: "unix", Path: socket, RawQuery: "hostname=host1"})
+	require.NoError(t, err)
+	batch := provider.GetMetricsSources()[0].ScrapeMetrics(time.Now(), time.Now())
+	assert.Len(t, batch.MetricSets, 2)
+}
+
+func TestNewDockerProvider(t *testing.T) {
+	provider, err := NewDockerProvider(&url.URL{})
+	require.NoError(t, err)
+	source := provider.GetMetricsSources()[0].(*dockerMetricsSource)
+	hostname, _ := os.Hostname()
+	assert.Equal(t, hostname, source.NodeName())
+
+	for _, uri := range []string{
+		"http://localhost:2375",
+		"tcp://localhost:2376?tlsCert=cert.pem",
+		"tcp://localhost:2376?tlsCert=missing.pem&tlsKey=missing.pem",
+	} {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		_, err = NewDockerProvider(u)
+		assert.Error(t, err, uri)
+	}
+}
@@ -16,10 +16,15 @@ package sources
 
 import (
 	"fmt"
+	"net/url"
+	"strconv"
 
 	"k8s.io/heapster/common/flags"
 	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/appmetrics"
+	"k8s.io/heapster/metrics/sources/docker"
 	"k8s.io/heapster/metrics/sources/kubelet"
+	"k8s.io/heapster/metrics/sources/prometheus"
 	"k8s.io/heapster/metrics/sources/summary"
 )
 
@@ -27,23 +32,112 @@ type SourceFactory struct {
 }
 
 func (this *SourceFactory) Build(uri flags.Uri) (core.MetricsSourceProvider, error) {
+	provider, err := this.build(uri)
+	if err != nil {
+		return nil, err
+	}
+	provider, err = prometheus.NewPrometheusProvider(provider, &uri.Val)
+	if err != nil {
+		return nil, err
+	}
+	return appmetrics.NewAppMetricsProvider(provider, &uri.Val)
+}
+
+func (this *SourceFactory) build(uri flags.Uri) (core.MetricsSourceProvider, error) {
 	switch uri.Key {
 	case "kubernetes":
+		summaryApi, err := useSummaryApi(&uri.Val)
+		if err != nil {
+			return nil, err
+		}
+		if summaryApi {
+			provider, err := summary.NewSummaryProvider(&uri.Val)
+			return provider, err
+		}
 		provider, err := kubelet.NewKubeletProvider(&uri.Val)
 		return provider, err
 	case "kubernetes.summary_api":
 		provider, err := summary.NewSummaryProvider(&uri.Val)
 		return provider, err
+	case "docker":
+		provider, err := docker.NewDockerProvider(&uri.Val)
+		return provider, err
 	default:
 		return nil, fmt.Errorf("Source not recognized: %s", uri.Key)
 	}
 }
 
+// Options of the kubernetes source which only the cAdvisor API of the kubelets supports.
+var cadvisorOptions = []string{"rawSamples", "numa", "incremental"}
+
+// Returns whether the kubernetes source reads the summary API of the kubelets, which it does
+// unless summaryApi=false or an option needing the cAdvisor API is enabled.
+func useSummaryApi(uri *url.URL) (bool, error) {
+	opts := uri.Query()
+	cadvisorOption := ""
+	for _, option := range cadvisorOptions {
+		if len(opts[option]) >= 1 {
+			enabled, err := strconv.ParseBool(opts[option][0])
+			if err != nil {
+				return false, fmt.Errorf("failed to parse `%s` flag - %v", option, err)
+			}
+			if enabled {
+				cadvisorOption = option
+			}
+		}
+	}
+	if len(opts["summaryApi"]) == 0 {
+		return cadvisorOption == "", nil
+	}
+	summaryApi, err := strconv.ParseBool(opts["summaryApi"][0])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse `summaryApi` flag - %v", err)
+	}
+	if summaryApi && cadvisorOption != "" {
+		return false, fmt.Errorf("`%s` is not supported with `summaryApi`", cadvisorOption)
+	}
+	return summaryApi, nil
+}
+
+// BuildAll builds the provider of the sources. Several sources are only supported for
+// federating Kubernetes clusters, each named by the cluster option of its uri.
 func (this *SourceFactory) BuildAll(uris flags.Uris) (core.MetricsSourceProvider, error) {
-	if len(uris) != 1 {
-		return nil, fmt.Errorf("Only one source is supported")
+	if len(uris) == 0 {
+		return nil, fmt.Errorf("No source is given")
+	}
+	if len(uris) == 1 && ClusterName(uris[0]) == "" {
+		return this.Build(uris[0])
 	}
-	return this.Build(uris[0])
+	clusters := make(map[string]bool, len(uris))
+	for _, uri := range uris {
+		if uri.Key != "kubernetes" && uri.Key != "kubernetes.summary_api" {
+			return nil, fmt.Errorf("Only kubernetes sources can be federated, got %s", uri.Key)
+		}
+		cluster := ClusterName(uri)
+		if cluster == "" {
+			return nil, fmt.Errorf("`cluster` flag is required on every federated source")
+		}
+		if clusters[cluster] {
+			return nil, fmt.Errorf("cluster %q is given by several sources", cluster)
+		}
+		clusters[cluster] = true
+	}
+	federated := &federatedProvider{}
+	for _, uri := range uris {
+		provider, err := this.Build(uri)
+		if err != nil {
+			return nil, err
+		}
+		federated.clusters = append(federated.clusters, ClusterName(uri))
+		federated.providers = append(federated.providers, provider)
+	}
+	return federated, nil
+}
+
+// ClusterName returns the name of the federated cluster given by the cluster option of the uri,
+// or an empty string.
+func ClusterName(uri flags.Uri) string {
+	return uri.Val.Query().Get("cluster")
 }
 
 func NewSourceFactory() *SourceFactory {
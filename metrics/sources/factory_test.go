@@ -0,0 +1,95 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/metrics/util"
+)
+
+func TestUseSummaryApi(t *testing.T) {
+	for query, expected := range map[string]bool{
+		"":                              true,
+		"summaryApi=true":               true,
+		"summaryApi=false":              false,
+		"rawSamples=false":              true,
+		"rawSamples=true":               false,
+		"numa=true":                     false,
+		"numa=true&summaryApi=false":    false,
+		"rawSamples=false&numa=false":   true,
+		"rawSamples=false&summaryApi=1": true,
+	} {
+		summaryApi, err := useSummaryApi(&url.URL{RawQuery: query})
+		require.NoError(t, err, query)
+		assert.Equal(t, expected, summaryApi, query)
+	}
+
+	for _, query := range []string{"summaryApi=maybe", "numa=maybe", "rawSamples=true&summaryApi=true"} {
+		_, err := useSummaryApi(&url.URL{RawQuery: query})
+		assert.Error(t, err, query)
+	}
+}
+
+func TestBuildAllFederation(t *testing.T) {
+	factory := NewSourceFactory()
+	for _, sources := range [][]string{
+		{},
+		{"kubernetes:http://a?cluster=c1", "kubernetes:http://b"},
+		{"kubernetes:http://a?cluster=c1", "kubernetes:http://b?cluster=c1"},
+		{"kubernetes:http://a?cluster=c1", "docker:?cluster=c2"},
+	} {
+		uris := flags.Uris{}
+		for _, source := range sources {
+			require.NoError(t, uris.Set(source))
+		}
+		_, err := factory.BuildAll(uris)
+		assert.Error(t, err, "%v", sources)
+	}
+}
+
+func TestBuildPlugins(t *testing.T) {
+	factory := NewSourceFactory()
+	provider := util.NewDummyMetricsSourceProvider(util.NewDummyMetricsSource("p1", 0))
+
+	built, err := factory.BuildPlugins(provider, flags.Uris{})
+	require.NoError(t, err)
+	assert.Equal(t, provider, built)
+
+	plugins := flags.Uris{}
+	require.NoError(t, plugins.Set("exec:/usr/local/bin/plugin?arg=-v"))
+	built, err = factory.BuildPlugins(provider, plugins)
+	require.NoError(t, err)
+	sources := built.GetMetricsSources()
+	require.Len(t, sources, 2)
+	assert.Equal(t, "exec:/usr/local/bin/plugin", sources[1].Name())
+	assert.Empty(t, HttpSources(built))
+
+	require.NoError(t, plugins.Set("push:?token=secret"))
+	built, err = factory.BuildPlugins(provider, plugins)
+	require.NoError(t, err)
+	httpSources := HttpSources(built)
+	require.Len(t, httpSources, 1)
+	assert.Equal(t, "/api/v1/push", httpSources[0].HttpPath())
+
+	require.NoError(t, plugins.Set("grpc:localhost:9000"))
+	_, err = factory.BuildPlugins(provider, plugins)
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"time"
+
+	. "k8s.io/heapster/metrics/core"
+)
+
+// A source of a federated cluster. It sets the cluster label on the metric sets of the source,
+// and scopes their keys unless the cluster is the primary one.
+type clusterSource struct {
+	MetricsSource
+	cluster string
+}
+
+func (this *clusterSource) Name() string {
+	return this.cluster + "/" + this.MetricsSource.Name()
+}
+
+func (this *clusterSource) String() string {
+	return this.Name()
+}
+
+func (this *clusterSource) ScrapeMetrics(start, end time.Time) *DataBatch {
+	batch := this.MetricsSource.ScrapeMetrics(start, end)
+	if batch == nil {
+		return nil
+	}
+	metricSets := make(map[string]*MetricSet, len(batch.MetricSets))
+	for key, ms := range batch.MetricSets {
+		if ms.Labels == nil {
+			ms.Labels = make(map[string]string)
+		}
+		ms.Labels[LabelClusterName.Key] = this.cluster
+		metricSets[ClusterScopedKey(this.cluster, key)] = ms
+	}
+	batch.MetricSets = metricSets
+	return batch
+}
+
+// The source of a node of a federated cluster. The nodes of the clusters other than the primary
+// one are named like their keys, so that the nodes of the primary cluster scraped out of band
+// don't match them.
+type clusterNodeSource struct {
+	clusterSource
+	node NodeMetricsSource
+}
+
+func (this *clusterNodeSource) NodeName() string {
+	return ClusterScopedKey(this.cluster, this.node.NodeName())
+}
+
+// Returns the source wrapped for the cluster.
+func newClusterSource(source MetricsSource, cluster string) MetricsSource {
+	if node, ok := source.(NodeMetricsSource); ok {
+		return &clusterNodeSource{
+			clusterSource: clusterSource{MetricsSource: source, cluster: cluster},
+			node:          node,
+		}
+	}
+	return &clusterSource{MetricsSource: source, cluster: cluster}
+}
+
+// A provider of the sources of several clusters, by cluster name.
+type federatedProvider struct {
+	clusters  []string
+	providers []MetricsSourceProvider
+}
+
+func (this *federatedProvider) GetMetricsSources() []MetricsSource {
+	sources := []MetricsSource{}
+	for i, provider := range this.providers {
+		for _, source := range provider.GetMetricsSources() {
+			sources = append(sources, newClusterSource(source, this.clusters[i]))
+		}
+	}
+	return sources
+}
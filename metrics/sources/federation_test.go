@@ -0,0 +1,51 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util"
+)
+
+func TestFederatedProvider(t *testing.T) {
+	core.SetPrimaryCluster("c1")
+	defer core.SetPrimaryCluster("")
+
+	provider := &federatedProvider{
+		clusters: []string{"c1", "c2"},
+		providers: []core.MetricsSourceProvider{
+			util.NewDummyMetricsSourceProvider(util.NewDummyMetricsSource("p1", 0)),
+			util.NewDummyMetricsSourceProvider(util.NewDummyMetricsSource("p2", 0)),
+		},
+	}
+	sources := provider.GetMetricsSources()
+	require.Len(t, sources, 2)
+	assert.Equal(t, "c1/dummy", sources[0].Name())
+
+	now := time.Now()
+	primary := sources[0].ScrapeMetrics(now, now)
+	require.Contains(t, primary.MetricSets, "p1")
+	assert.Equal(t, "c1", primary.MetricSets["p1"].Labels[core.LabelClusterName.Key])
+
+	other := sources[1].ScrapeMetrics(now, now)
+	require.Contains(t, other.MetricSets, "cluster:c2/p2")
+	assert.Equal(t, "c2", other.MetricSets["cluster:c2/p2"].Labels[core.LabelClusterName.Key])
+}
@@ -15,13 +15,16 @@
 package kubelet
 
 import (
+	"fmt"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/golang/glog"
 	kube_config "k8s.io/heapster/common/kubernetes"
 	kube_client "k8s.io/kubernetes/pkg/client/restclient"
 	kubelet_client "k8s.io/kubernetes/pkg/kubelet/client"
+	"k8s.io/kubernetes/pkg/labels"
 )
 
 const (
@@ -70,3 +73,52 @@ func GetKubeConfigs(uri *url.URL) (*kube_client.Config, *kubelet_client.KubeletC
 
 	return kubeConfig, kubeletConfig, nil
 }
+
+// GetNodeLabelSelector returns the selector of the nodes to scrape, given by the nodeLabelSelector
+// option of the uri, e.g. `kubernetes.io/os!=windows`. All nodes are selected without it.
+func GetNodeLabelSelector(uri *url.URL) (labels.Selector, error) {
+	opts := uri.Query()
+	if len(opts["nodeLabelSelector"]) == 0 || opts["nodeLabelSelector"][0] == "" {
+		return labels.Everything(), nil
+	}
+	selector, err := labels.Parse(opts["nodeLabelSelector"][0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse `nodeLabelSelector` flag - %v", err)
+	}
+	return selector, nil
+}
+
+// ScrapeOptions bound the requests to the Kubelets, so that a few slow Kubelets don't hold the
+// scrape of a large cluster past its deadline.
+type ScrapeOptions struct {
+	// Requests running at once, unbounded if 0.
+	Concurrency int
+	// Timeout of each request, none if 0.
+	Timeout time.Duration
+	// Times a request failing with a connection, timeout or server error is retried.
+	Retries int
+}
+
+// GetScrapeOptions returns the options given by the scrapeConcurrency, scrapeTimeout and
+// scrapeRetries options of the uri.
+func GetScrapeOptions(uri *url.URL) (ScrapeOptions, error) {
+	opts := uri.Query()
+	result := ScrapeOptions{}
+	var err error
+	if len(opts["scrapeConcurrency"]) >= 1 {
+		if result.Concurrency, err = strconv.Atoi(opts["scrapeConcurrency"][0]); err != nil || result.Concurrency < 0 {
+			return result, fmt.Errorf("failed to parse `scrapeConcurrency` flag - %q should be a non-negative integer", opts["scrapeConcurrency"][0])
+		}
+	}
+	if len(opts["scrapeTimeout"]) >= 1 {
+		if result.Timeout, err = time.ParseDuration(opts["scrapeTimeout"][0]); err != nil || result.Timeout < 0 {
+			return result, fmt.Errorf("failed to parse `scrapeTimeout` flag - %q should be a non-negative duration", opts["scrapeTimeout"][0])
+		}
+	}
+	if len(opts["scrapeRetries"]) >= 1 {
+		if result.Retries, err = strconv.Atoi(opts["scrapeRetries"][0]); err != nil || result.Retries < 0 {
+			return result, fmt.Errorf("failed to parse `scrapeRetries` flag - %q should be a non-negative integer", opts["scrapeRetries"][0])
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"bytes"
+	"encoding/json"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+)
+
+// A container of the cAdvisor API of the Kubelets, with its spec left encoded and the stats
+// telling whether they hold pressure stall information.
+type rawContainerInfo struct {
+	cadvisor.ContainerReference
+	Subcontainers []cadvisor.ContainerReference `json:"subcontainers,omitempty"`
+	Spec          rawSpec                       `json:"spec,omitempty"`
+	Stats         []*rawContainerStats          `json:"stats,omitempty"`
+}
+
+func (this *rawContainerInfo) containerInfo(spec cadvisor.ContainerSpec) cadvisor.ContainerInfo {
+	info := cadvisor.ContainerInfo{
+		ContainerReference: this.ContainerReference,
+		Subcontainers:      this.Subcontainers,
+		Spec:               spec,
+		Stats:              make([]*cadvisor.ContainerStats, 0, len(this.Stats)),
+	}
+	for _, stat := range this.Stats {
+		info.Stats = append(info.Stats, &stat.ContainerStats)
+	}
+	return info
+}
+
+// The encoded spec of a container. json.Unmarshal passes a slice of the response body to
+// UnmarshalJSON, which is kept rather than copied, as the body outlives the decoding of the specs.
+type rawSpec []byte
+
+func (this *rawSpec) UnmarshalJSON(data []byte) error {
+	*this = data
+	return nil
+}
+
+// Stats of a container of the cAdvisor API, noting whether they hold pressure stall information,
+// which the cAdvisor types don't.
+type rawContainerStats struct {
+	cadvisor.ContainerStats
+	pressure bool
+}
+
+// The pressure stall information of a resource, in the cAdvisor API of cgroup v2 nodes.
+type pressureStats struct {
+	PSI json.RawMessage `json:"psi"`
+}
+
+func (this pressureStats) reported() bool {
+	return len(this.PSI) > 0 && string(this.PSI) != "null"
+}
+
+var psiKey = []byte(`"psi"`)
+
+func (this *rawContainerStats) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &this.ContainerStats); err != nil {
+		return err
+	}
+	if !bytes.Contains(data, psiKey) {
+		return nil
+	}
+	pressure := struct {
+		Cpu    pressureStats `json:"cpu"`
+		Memory pressureStats `json:"memory"`
+		DiskIo pressureStats `json:"diskio"`
+	}{}
+	if err := json.Unmarshal(data, &pressure); err != nil {
+		return err
+	}
+	this.pressure = pressure.Cpu.reported() || pressure.Memory.reported() || pressure.DiskIo.reported()
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"sync"
+	"time"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+)
+
+// Age above which the stats of a container aren't exported anymore when the Kubelet has no newer
+// ones, and which bounds the stats requested after a node couldn't be scraped for a while.
+const incrementalMaxAge = 2 * time.Minute
+
+// Keeps the newest stats of the containers of the nodes, so that only the stats newer than the
+// last scrape are requested from the Kubelets. The containers without newer stats keep their
+// last ones, which lets the metric resolution be shorter than the housekeeping interval of
+// cAdvisor.
+type incrementalCache struct {
+	lock  sync.Mutex
+	nodes map[string]*nodeStats
+}
+
+type nodeStats struct {
+	// Newest stats by container name.
+	containers map[string]*cadvisor.ContainerStats
+	// Timestamp of the newest stats of the node.
+	newest time.Time
+}
+
+func newIncrementalCache() *incrementalCache {
+	return &incrementalCache{nodes: make(map[string]*nodeStats)}
+}
+
+// Returns the start of the stats to request from the Kubelet of the node, just after its newest
+// known stats, or the start of the scrape window if there are none.
+func (this *incrementalCache) since(node string, start, end time.Time) time.Time {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	stats, found := this.nodes[node]
+	if !found || stats.newest.IsZero() {
+		return start
+	}
+	since := stats.newest.Add(time.Nanosecond)
+	if oldest := end.Add(-incrementalMaxAge); since.Before(oldest) {
+		return oldest
+	}
+	return since
+}
+
+// Gives the containers of the node without new stats their last ones, if they aren't too old,
+// and remembers the newest stats of the others. The containers gone from the Kubelet are
+// forgotten.
+func (this *incrementalCache) merge(node string, containers []cadvisor.ContainerInfo, now time.Time) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	previous := this.nodes[node]
+	current := &nodeStats{containers: make(map[string]*cadvisor.ContainerStats, len(containers))}
+	if previous != nil {
+		current.newest = previous.newest
+	}
+	for i := range containers {
+		c := &containers[i]
+		if len(c.Stats) > 0 {
+			latest := c.Stats[len(c.Stats)-1]
+			current.containers[c.Name] = latest
+			if latest.Timestamp.After(current.newest) {
+				current.newest = latest.Timestamp
+			}
+			continue
+		}
+		if previous == nil {
+			continue
+		}
+		if last, found := previous.containers[c.Name]; found && now.Sub(last.Timestamp) <= incrementalMaxAge {
+			c.Stats = []*cadvisor.ContainerStats{last}
+			current.containers[c.Name] = last
+		}
+	}
+	this.nodes[node] = current
+}
+
+// Forgets the stats of the nodes not in the cluster anymore.
+func (this *incrementalCache) retain(nodes map[string]bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for node := range this.nodes {
+		if !nodes[node] {
+			delete(this.nodes, node)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	cadvisor_api "github.com/google/cadvisor/info/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/processors"
+)
+
+func TestIncrementalScrapes(t *testing.T) {
+	kubelet := newFakeKubelet(t)
+	defer kubelet.server.Close()
+	sampled := time.Now().Add(-10 * time.Second).Truncate(time.Second)
+	container := func(name string, stats ...*cadvisor_api.ContainerStats) cadvisor_api.ContainerInfo {
+		return cadvisor_api.ContainerInfo{
+			ContainerReference: cadvisor_api.ContainerReference{Name: name},
+			Spec:               cadvisor_api.ContainerSpec{HasCpu: true},
+			Stats:              stats,
+		}
+	}
+	cpu := func(timestamp time.Time, total uint64) *cadvisor_api.ContainerStats {
+		return &cadvisor_api.ContainerStats{Timestamp: timestamp, Cpu: cadvisor_api.CpuStats{Usage: cadvisor_api.CpuUsage{Total: total}}}
+	}
+	kubelet.containers = map[string]cadvisor_api.ContainerInfo{
+		"/":           container("/", cpu(sampled, 100)),
+		"/system/foo": container("/system/foo", cpu(sampled, 10)),
+	}
+
+	source := newKubeletMetricsSource(kubelet.host(t), &KubeletClient{}, "node1", "node1", "", false)
+	source.incremental = newIncrementalCache()
+	end := time.Now()
+	batch := source.ScrapeMetrics(end.Add(-time.Minute), end)
+	assert.Equal(t, end.Add(-time.Minute).Unix(), kubelet.statsStart.Unix())
+	require.Len(t, batch.MetricSets, 2)
+
+	// Only the stats newer than the last ones are requested, and the containers without newer
+	// ones keep their last stats.
+	kubelet.containers = map[string]cadvisor_api.ContainerInfo{
+		"/":           container("/", cpu(sampled.Add(5*time.Second), 200)),
+		"/system/foo": container("/system/foo"),
+	}
+	batch = source.ScrapeMetrics(end, end.Add(5*time.Second))
+	assert.True(t, sampled.Add(time.Nanosecond).Equal(kubelet.statsStart))
+	require.Len(t, batch.MetricSets, 2)
+	assert.Equal(t, int64(200), batch.MetricSets[core.NodeKey("node1")].MetricValues[core.MetricCpuUsage.Name].IntValue)
+	foo := batch.MetricSets[core.NodeContainerKey("node1", "system/foo")]
+	require.NotNil(t, foo)
+	assert.Equal(t, int64(10), foo.MetricValues[core.MetricCpuUsage.Name].IntValue)
+	assert.True(t, sampled.Equal(foo.ScrapeTime))
+
+	// The containers gone from the Kubelet are forgotten, and the stats are requested from the
+	// oldest ones exported after a long gap.
+	kubelet.containers = map[string]cadvisor_api.ContainerInfo{"/": container("/")}
+	later := end.Add(time.Hour)
+	batch = source.ScrapeMetrics(later.Add(-time.Minute), later)
+	assert.Equal(t, later.Add(-incrementalMaxAge).UnixNano(), kubelet.statsStart.UnixNano())
+	assert.Empty(t, batch.MetricSets)
+	assert.Len(t, source.incremental.nodes["node1"].containers, 0)
+
+	source.incremental.retain(map[string]bool{})
+	assert.Empty(t, source.incremental.nodes)
+}
+
+func TestIncrementalWithRawSamples(t *testing.T) {
+	_, err := NewKubeletProvider(&url.URL{Scheme: "http", Host: "localhost:8080", RawQuery: "inClusterConfig=false&incremental=true&rawSamples=true"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "incremental")
+}
+
+func TestIncrementalScrapesKeepRates(t *testing.T) {
+	kubelet := newFakeKubelet(t)
+	defer kubelet.server.Close()
+	sampled := time.Now().Add(-10 * time.Second).Truncate(time.Second)
+	cpu := func(timestamp time.Time, total uint64) cadvisor_api.ContainerInfo {
+		return cadvisor_api.ContainerInfo{
+			ContainerReference: cadvisor_api.ContainerReference{Name: "/system/foo"},
+			Spec:               cadvisor_api.ContainerSpec{HasCpu: true},
+			Stats: []*cadvisor_api.ContainerStats{{
+				Timestamp: timestamp,
+				Cpu:       cadvisor_api.CpuStats{Usage: cadvisor_api.CpuUsage{Total: total}},
+			}},
+		}
+	}
+	source := newKubeletMetricsSource(kubelet.host(t), &KubeletClient{}, "node1", "node1", "", false)
+	source.incremental = newIncrementalCache()
+	rates := processors.NewRateCalculator(core.RateMetricsMapping)
+	key := core.NodeContainerKey("node1", "system/foo")
+	end := time.Now()
+	scrape := func(containers ...cadvisor_api.ContainerInfo) *core.MetricSet {
+		kubelet.containers = map[string]cadvisor_api.ContainerInfo{}
+		for _, container := range containers {
+			kubelet.containers[container.Name] = container
+		}
+		end = end.Add(5 * time.Second)
+		batch, err := rates.Process(source.ScrapeMetrics(end.Add(-5*time.Second), end))
+		require.NoError(t, err)
+		return batch.MetricSets[key]
+	}
+
+	scrape(cpu(sampled, 1e9))
+	foo := scrape(cpu(sampled.Add(5*time.Second), 2e9))
+	require.NotNil(t, foo)
+	assert.Equal(t, int64(200), foo.MetricValues[core.MetricCpuUsageRate.Name].IntValue)
+
+	// The container without newer stats keeps its last rate.
+	idle := cpu(sampled, 0)
+	idle.Stats = nil
+	foo = scrape(idle)
+	require.NotNil(t, foo)
+	assert.Equal(t, int64(200), foo.MetricValues[core.MetricCpuUsageRate.Name].IntValue)
+
+	// The next rate covers the time since the stats of the last rate.
+	foo = scrape(cpu(sampled.Add(15*time.Second), 6e9))
+	require.NotNil(t, foo)
+	assert.Equal(t, int64(400), foo.MetricValues[core.MetricCpuUsageRate.Name].IntValue)
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,11 +28,11 @@ import (
 	cadvisor "github.com/google/cadvisor/info/v1"
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/heapster/metrics/util"
+	"k8s.io/heapster/metrics/util/accounting"
 	kube_api "k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/client/cache"
 	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
 	"k8s.io/kubernetes/pkg/fields"
-	"k8s.io/kubernetes/pkg/labels"
 )
 
 const (
@@ -67,15 +68,26 @@ type kubeletMetricsSource struct {
 	nodename      string
 	hostname      string
 	hostId        string
+	// Whether all samples from the scrape window should be attached to the MetricSets.
+	rawSamples bool
+	// NUMA topologies of the nodes, nil unless the usage of the NUMA nodes is scraped.
+	topologies *topologyCache
+	// Newest stats of the containers of the nodes, nil unless the scrapes are incremental.
+	incremental *incrementalCache
 }
 
 func NewKubeletMetricsSource(host Host, client *KubeletClient, nodeName string, hostName string, hostId string) MetricsSource {
+	return newKubeletMetricsSource(host, client, nodeName, hostName, hostId, false)
+}
+
+func newKubeletMetricsSource(host Host, client *KubeletClient, nodeName string, hostName string, hostId string, rawSamples bool) *kubeletMetricsSource {
 	return &kubeletMetricsSource{
 		host:          host,
 		kubeletClient: client,
 		nodename:      nodeName,
 		hostname:      hostName,
 		hostId:        hostId,
+		rawSamples:    rawSamples,
 	}
 }
 
@@ -83,6 +95,10 @@ func (this *kubeletMetricsSource) Name() string {
 	return this.String()
 }
 
+func (this *kubeletMetricsSource) NodeName() string {
+	return this.nodename
+}
+
 func (this *kubeletMetricsSource) String() string {
 	return fmt.Sprintf("kubelet:%s:%d", this.host.IP, this.host.Port)
 }
@@ -121,11 +137,13 @@ func (this *kubeletMetricsSource) decodeMetrics(c *cadvisor.ContainerInfo) (stri
 	if len(c.Stats) == 0 {
 		return "", nil
 	}
+	// Stats are ordered from the oldest to the newest.
+	latest := c.Stats[len(c.Stats)-1]
 
 	var metricSetKey string
 	cMetrics := &MetricSet{
 		CreateTime:   c.Spec.CreationTime,
-		ScrapeTime:   c.Stats[0].Timestamp,
+		ScrapeTime:   latest.Timestamp,
 		MetricValues: map[string]MetricValue{},
 		Labels: map[string]string{
 			LabelNodename.Key: this.nodename,
@@ -174,13 +192,17 @@ func (this *kubeletMetricsSource) decodeMetrics(c *cadvisor.ContainerInfo) (stri
 
 	for _, metric := range StandardMetrics {
 		if metric.HasValue != nil && metric.HasValue(&c.Spec) {
-			cMetrics.MetricValues[metric.Name] = metric.GetValue(&c.Spec, c.Stats[0])
+			cMetrics.MetricValues[metric.Name] = metric.GetValue(&c.Spec, latest)
 		}
 	}
 
+	if this.rawSamples {
+		cMetrics.RawSamples = decodeRawSamples(c)
+	}
+
 	for _, metric := range LabeledMetrics {
 		if metric.HasLabeledMetric != nil && metric.HasLabeledMetric(&c.Spec) {
-			labeledMetrics := metric.GetLabeledMetric(&c.Spec, c.Stats[0])
+			labeledMetrics := metric.GetLabeledMetric(&c.Spec, latest)
 			cMetrics.LabeledMetrics = append(cMetrics.LabeledMetrics, labeledMetrics...)
 		}
 	}
@@ -188,7 +210,11 @@ func (this *kubeletMetricsSource) decodeMetrics(c *cadvisor.ContainerInfo) (stri
 	if c.Spec.HasCustomMetrics {
 	metricloop:
 		for _, spec := range c.Spec.CustomMetrics {
-			if cmValue, ok := c.Stats[0].CustomMetrics[spec.Name]; ok && cmValue != nil && len(cmValue) >= 1 {
+			if diskMetric, found := DiskCustomMetrics[spec.Name]; found {
+				cMetrics.LabeledMetrics = append(cMetrics.LabeledMetrics, decodeDiskMetrics(&diskMetric, spec, latest.CustomMetrics[spec.Name])...)
+				continue
+			}
+			if cmValue, ok := latest.CustomMetrics[spec.Name]; ok && cmValue != nil && len(cmValue) >= 1 {
 				newest := cmValue[0]
 				for _, metricVal := range cmValue {
 					if newest.Timestamp.Before(metricVal.Timestamp) {
@@ -226,10 +252,112 @@ func (this *kubeletMetricsSource) decodeMetrics(c *cadvisor.ContainerInfo) (stri
 	return metricSetKey, cMetrics
 }
 
+// Decodes a disk custom metric, holding the newest value of every device in its label.
+func decodeDiskMetrics(metric *Metric, spec cadvisor.MetricSpec, values []cadvisor.MetricVal) []LabeledMetric {
+	newest := make(map[string]cadvisor.MetricVal)
+	devices := []string{}
+	for _, value := range values {
+		if value.Label == "" {
+			continue
+		}
+		last, found := newest[value.Label]
+		if !found {
+			devices = append(devices, value.Label)
+		}
+		if !found || last.Timestamp.Before(value.Timestamp) {
+			newest[value.Label] = value
+		}
+	}
+	result := make([]LabeledMetric, 0, len(devices))
+	for _, device := range devices {
+		value := newest[device]
+		number := float64(value.IntValue)
+		if spec.Format == cadvisor.FloatType {
+			number = value.FloatValue
+		}
+		result = append(result, NewDiskMetric(metric, device, number))
+	}
+	return result
+}
+
+// NewDiskMetric returns the value of a disk metric for a device of the node.
+func NewDiskMetric(metric *Metric, device string, value float64) LabeledMetric {
+	result := LabeledMetric{
+		Name:   metric.Name,
+		Labels: map[string]string{LabelResourceID.Key: device},
+		MetricValue: MetricValue{
+			MetricType: metric.Type,
+			ValueType:  metric.ValueType,
+		},
+	}
+	if metric.ValueType == ValueInt64 {
+		result.IntValue = int64(value)
+	} else {
+		result.FloatValue = float32(value)
+	}
+	return result
+}
+
+// MoveDiskMetricsToNode moves the disk metrics reported by the containers of the node, e.g.
+// the one of a node plugin, to the metric set of the node.
+func MoveDiskMetricsToNode(metricSets map[string]*MetricSet, nodeKey string) {
+	node, found := metricSets[nodeKey]
+	if !found {
+		return
+	}
+	for key, metricSet := range metricSets {
+		if key == nodeKey {
+			continue
+		}
+		kept := metricSet.LabeledMetrics[:0]
+		for _, metric := range metricSet.LabeledMetrics {
+			if isDiskMetric(metric.Name) {
+				node.LabeledMetrics = append(node.LabeledMetrics, metric)
+			} else {
+				kept = append(kept, metric)
+			}
+		}
+		metricSet.LabeledMetrics = kept
+	}
+}
+
+func isDiskMetric(name string) bool {
+	for _, metric := range DiskMetrics {
+		if metric.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Decodes the standard metrics of every sample of the container.
+func decodeRawSamples(c *cadvisor.ContainerInfo) []RawSample {
+	samples := make([]RawSample, 0, len(c.Stats))
+	for _, stat := range c.Stats {
+		sample := RawSample{
+			Timestamp:    stat.Timestamp,
+			MetricValues: map[string]MetricValue{},
+		}
+		for _, metric := range StandardMetrics {
+			if metric.HasValue != nil && metric.HasValue(&c.Spec) {
+				sample.MetricValues[metric.Name] = metric.GetValue(&c.Spec, stat)
+			}
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
 func (this *kubeletMetricsSource) ScrapeMetrics(start, end time.Time) *DataBatch {
-	containers, err := this.scrapeKubelet(this.kubeletClient, this.host, start, end)
+	since := start
+	if this.incremental != nil {
+		since = this.incremental.since(this.nodename, start, end)
+	}
+	containers, cgroupVersion, err := this.scrapeKubelet(this.kubeletClient, this.host, since, end)
 	if err != nil {
 		glog.Errorf("error while getting containers from Kubelet: %v", err)
+	} else if this.incremental != nil {
+		this.incremental.merge(this.nodename, containers, end)
 	}
 	glog.V(2).Infof("successfully obtained stats for %v containers", len(containers))
 
@@ -237,8 +365,12 @@ func (this *kubeletMetricsSource) ScrapeMetrics(start, end time.Time) *DataBatch
 		Timestamp:  end,
 		MetricSets: map[string]*MetricSet{},
 	}
+	root := rootStats(containers)
 	keys := make(map[string]bool)
 	for _, c := range containers {
+		for _, stat := range c.Stats {
+			NormalizeCgroupStats(cgroupVersion, stat)
+		}
 		name, metrics := this.decodeMetrics(&c)
 		if name == "" || metrics == nil {
 			continue
@@ -246,19 +378,46 @@ func (this *kubeletMetricsSource) ScrapeMetrics(start, end time.Time) *DataBatch
 		result.MetricSets[name] = metrics
 		keys[name] = true
 	}
+	if node, found := result.MetricSets[NodeKey(this.nodename)]; found {
+		if cgroupVersion != "" {
+			node.Labels[LabelCgroupVersion.Key] = cgroupVersion
+		}
+		if this.topologies != nil {
+			this.addNumaMetrics(node, root)
+		}
+	}
+	MoveDiskMetricsToNode(result.MetricSets, NodeKey(this.nodename))
 	return result
 }
 
-func (this *kubeletMetricsSource) scrapeKubelet(client *KubeletClient, host Host, start, end time.Time) ([]cadvisor.ContainerInfo, error) {
+// Returns the newest stats of the root container of the node, nil if there are none.
+func rootStats(containers []cadvisor.ContainerInfo) *cadvisor.ContainerStats {
+	for i := range containers {
+		if isNode(&containers[i]) && len(containers[i].Stats) > 0 {
+			return containers[i].Stats[len(containers[i].Stats)-1]
+		}
+	}
+	return nil
+}
+
+// Returns the containers of the Kubelet and the cgroup version of the node, if known.
+func (this *kubeletMetricsSource) scrapeKubelet(client *KubeletClient, host Host, start, end time.Time) ([]cadvisor.ContainerInfo, string, error) {
 	startTime := time.Now()
 	defer kubeletRequestLatency.WithLabelValues(this.hostname).Observe(float64(time.Since(startTime)))
-	return client.GetAllRawContainers(host, start, end)
+	containers, payload, err := client.GetAllRawContainersPayload(host, start, end)
+	if err == nil {
+		DefaultPayloadTracker.Record(this.hostname, payload)
+	}
+	return containers, payload.CgroupVersion, err
 }
 
 type kubeletProvider struct {
 	nodeLister    *cache.StoreToNodeLister
 	reflector     *cache.Reflector
 	kubeletClient *KubeletClient
+	rawSamples    bool
+	topologies    *topologyCache
+	incremental   *incrementalCache
 }
 
 func (this *kubeletProvider) GetMetricsSources() []MetricsSource {
@@ -274,21 +433,39 @@ func (this *kubeletProvider) GetMetricsSources() []MetricsSource {
 	}
 
 	nodeNames := make(map[string]bool)
+	hostnames := make(map[string]bool)
 	for _, node := range nodes.Items {
+		// Virtual kubelets have no cAdvisor API, the summary API reads the stats of some.
+		if provider := GetVirtualProvider(&node); provider != "" {
+			glog.V(4).Infof("Skipping node %s: virtual kubelet node of provider %s", node.Name, provider)
+			continue
+		}
 		nodeNames[node.Name] = true
 		hostname, ip, err := getNodeHostnameAndIP(&node)
 		if err != nil {
 			glog.Errorf("%v", err)
 			continue
 		}
-		sources = append(sources, NewKubeletMetricsSource(
+		hostnames[hostname] = true
+		source := newKubeletMetricsSource(
 			Host{IP: ip, Port: this.kubeletClient.GetPort()},
 			this.kubeletClient,
 			node.Name,
 			hostname,
 			node.Spec.ExternalID,
-		))
+			this.rawSamples,
+		)
+		source.topologies = this.topologies
+		source.incremental = this.incremental
+		sources = append(sources, source)
 	}
+	if this.topologies != nil {
+		this.topologies.retain(nodeNames)
+	}
+	if this.incremental != nil {
+		this.incremental.retain(nodeNames)
+	}
+	DefaultPayloadTracker.Retain(hostnames)
 	return sources
 }
 
@@ -325,24 +502,72 @@ func NewKubeletProvider(uri *url.URL) (MetricsSourceProvider, error) {
 		return nil, err
 	}
 	kubeClient := kube_client.NewOrDie(kubeConfig)
+	kubeletConfig.Dial = accounting.DefaultLedger.Dial(accounting.SourceOwner("kubelet"), kubeletConfig.Dial)
 	kubeletClient, err := NewKubeletClient(kubeletConfig)
 	if err != nil {
 		return nil, err
 	}
+	scrapeOptions, err := GetScrapeOptions(uri)
+	if err != nil {
+		return nil, err
+	}
+	kubeletClient.SetScrapeOptions(scrapeOptions)
+
+	rawSamples := false
+	if opts := uri.Query(); len(opts["rawSamples"]) >= 1 {
+		rawSamples, err = strconv.ParseBool(opts["rawSamples"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `rawSamples` flag - %v", err)
+		}
+	}
+
+	var topologies *topologyCache
+	if opts := uri.Query(); len(opts["numa"]) >= 1 {
+		numa, err := strconv.ParseBool(opts["numa"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `numa` flag - %v", err)
+		}
+		if numa {
+			topologies = newTopologyCache()
+		}
+	}
+
+	var incremental *incrementalCache
+	if opts := uri.Query(); len(opts["incremental"]) >= 1 {
+		enabled, err := strconv.ParseBool(opts["incremental"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `incremental` flag - %v", err)
+		}
+		// The reused stats would be attached again as raw samples.
+		if enabled && rawSamples {
+			return nil, fmt.Errorf("failed to parse `incremental` flag - incremental scrapes don't keep raw samples")
+		}
+		if enabled {
+			incremental = newIncrementalCache()
+		}
+	}
+
+	nodeSelector, err := GetNodeLabelSelector(uri)
+	if err != nil {
+		return nil, err
+	}
 
 	// Get nodes to test if the client is configured well. Watch gives less error information.
 	if _, err := kubeClient.Nodes().List(kube_api.ListOptions{
-		LabelSelector: labels.Everything(),
+		LabelSelector: nodeSelector,
 		FieldSelector: fields.Everything()}); err != nil {
 		glog.Errorf("Failed to load nodes: %v", err)
 	}
 
 	// watch nodes
-	nodeLister, reflector, _ := util.GetNodeLister(kubeClient)
+	nodeLister, reflector, _ := util.GetSelectedNodeLister(kubeClient, nodeSelector)
 
 	return &kubeletProvider{
 		nodeLister:    nodeLister,
 		reflector:     reflector,
 		kubeletClient: kubeletClient,
+		rawSamples:    rawSamples,
+		topologies:    topologies,
+		incremental:   incremental,
 	}, nil
 }
@@ -24,9 +24,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/golang/glog"
 	cadvisor "github.com/google/cadvisor/info/v1"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/kubernetes/pkg/api/unversioned"
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/stats"
 	kube_client "k8s.io/kubernetes/pkg/kubelet/client"
 )
@@ -40,6 +44,27 @@ type Host struct {
 type KubeletClient struct {
 	config *kube_client.KubeletClientConfig
 	client *http.Client
+	// Bounds the requests running at once, unbounded if nil.
+	slots chan struct{}
+	// Times a failed request is retried.
+	retries int
+	// Decoded container specs of the Kubelets, decoded every scrape if nil.
+	specs *specCache
+}
+
+// Pause before retrying a failed request.
+const retryBackoff = 500 * time.Millisecond
+
+// SetScrapeOptions sets the limits of the requests of the client to the Kubelets.
+func (self *KubeletClient) SetScrapeOptions(opts ScrapeOptions) {
+	self.slots = nil
+	if opts.Concurrency > 0 {
+		self.slots = make(chan struct{}, opts.Concurrency)
+	}
+	self.retries = opts.Retries
+	if opts.Timeout > 0 && self.client != nil {
+		self.client.Timeout = opts.Timeout
+	}
 }
 
 type ErrNotFound struct {
@@ -55,37 +80,71 @@ func IsNotFoundError(err error) bool {
 	return isNotFound
 }
 
-func sampleContainerStats(stats []*cadvisor.ContainerStats) []*cadvisor.ContainerStats {
-	if len(stats) == 0 {
-		return []*cadvisor.ContainerStats{}
+func (self *KubeletClient) postRequestAndGetValue(client *http.Client, req *http.Request, value interface{}) (Payload, error) {
+	payload := Payload{}
+	body, err := self.doWithRetries(client, req)
+	if err != nil {
+		return payload, err
+	}
+	payload.Bytes = len(body)
+	startTime := time.Now()
+	err = json.Unmarshal(body, value)
+	payload.ParseTime = time.Since(startTime)
+	if err != nil {
+		return payload, fmt.Errorf("failed to parse output. Response: %q. Error: %v", string(body), err)
+	}
+	return payload, nil
+}
+
+// Returns the body of the response to the request, retrying it on the errors which may be
+// transient: failed connections, timeouts and server errors.
+func (self *KubeletClient) doWithRetries(client *http.Client, req *http.Request) ([]byte, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	for attempt := 0; ; attempt++ {
+		if reqBody != nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+		}
+		body, retry, err := self.do(client, req)
+		if err == nil || !retry || attempt >= self.retries {
+			return body, err
+		}
+		glog.V(2).Infof("Retrying request to %q after error: %v", req.URL.String(), err)
+		time.Sleep(retryBackoff)
 	}
-	return []*cadvisor.ContainerStats{stats[len(stats)-1]}
 }
 
-func (self *KubeletClient) postRequestAndGetValue(client *http.Client, req *http.Request, value interface{}) error {
+// Returns the body of the response to the request, and whether its error is worth a retry.
+func (self *KubeletClient) do(client *http.Client, req *http.Request) ([]byte, bool, error) {
+	if self.slots != nil {
+		self.slots <- struct{}{}
+		defer func() { <-self.slots }()
+	}
 	response, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, true, err
 	}
 	defer response.Body.Close()
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response body - %v", err)
+		return nil, true, fmt.Errorf("failed to read response body - %v", err)
 	}
 	if response.StatusCode == http.StatusNotFound {
-		return &ErrNotFound{req.URL.String()}
+		return nil, false, &ErrNotFound{req.URL.String()}
 	} else if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("request failed - %q, response: %q", response.Status, string(body))
-	}
-	err = json.Unmarshal(body, value)
-	if err != nil {
-		return fmt.Errorf("failed to parse output. Response: %q. Error: %v", string(body), err)
+		return nil, response.StatusCode >= http.StatusInternalServerError,
+			fmt.Errorf("request failed - %q, response: %q", response.Status, string(body))
 	}
-	return nil
+	return body, false, nil
 }
 
 func (self *KubeletClient) parseStat(containerInfo *cadvisor.ContainerInfo) *cadvisor.ContainerInfo {
-	containerInfo.Stats = sampleContainerStats(containerInfo.Stats)
 	if len(containerInfo.Aliases) > 0 {
 		containerInfo.Name = containerInfo.Aliases[0]
 	}
@@ -116,8 +175,15 @@ type statsRequest struct {
 	Subcontainers bool `json:"subcontainers,omitempty"`
 }
 
-// Get stats for all non-Kubernetes containers.
+// Get stats for all non-Kubernetes containers. All the samples collected in the given time window
+// are returned, oldest first.
 func (self *KubeletClient) GetAllRawContainers(host Host, start, end time.Time) ([]cadvisor.ContainerInfo, error) {
+	containers, _, err := self.GetAllRawContainersPayload(host, start, end)
+	return containers, err
+}
+
+// GetAllRawContainersPayload is GetAllRawContainers also describing the response of the kubelet.
+func (self *KubeletClient) GetAllRawContainersPayload(host Host, start, end time.Time) ([]cadvisor.ContainerInfo, Payload, error) {
 	scheme := "http"
 	if self.config != nil && self.config.EnableHttps {
 		scheme = "https"
@@ -129,6 +195,45 @@ func (self *KubeletClient) GetAllRawContainers(host Host, start, end time.Time)
 }
 
 func (self *KubeletClient) GetSummary(host Host) (*stats.Summary, error) {
+	summary, _, err := self.GetSummaryPayload(host, false)
+	return summary, err
+}
+
+// RlimitStats are the process limits of a node, which only the recent kubelets report.
+type RlimitStats struct {
+	Time unversioned.Time `json:"time"`
+	// Maximum number of processes of the node.
+	MaxPID *int64 `json:"maxpid,omitempty"`
+	// Number of processes running on the node.
+	NumOfRunningProcesses *int64 `json:"curproc,omitempty"`
+}
+
+// Summary is a summary of the stats of a node, with the stats which the summary API version
+// vendored here doesn't have yet.
+type Summary struct {
+	stats.Summary
+	// Process limits of the node, nil if the kubelet doesn't report them.
+	Rlimit *RlimitStats
+}
+
+// The JSON of a summary, whose node may have process limits.
+type summaryResponse struct {
+	Node struct {
+		stats.NodeStats
+		Rlimit *RlimitStats `json:"rlimit,omitempty"`
+	} `json:"node"`
+	Pods []stats.PodStats `json:"pods"`
+}
+
+// GetSummaryPayload is GetSummary also describing the response of the kubelet. With onlyCpuAndMemory,
+// kubelets supporting it leave out the network, filesystem and user defined metrics.
+func (self *KubeletClient) GetSummaryPayload(host Host, onlyCpuAndMemory bool) (*stats.Summary, Payload, error) {
+	summary, payload, err := self.GetFullSummaryPayload(host, onlyCpuAndMemory)
+	return &summary.Summary, payload, err
+}
+
+// GetFullSummaryPayload is GetSummaryPayload also returning the process limits of the node.
+func (self *KubeletClient) GetFullSummaryPayload(host Host, onlyCpuAndMemory bool) (*Summary, Payload, error) {
 	url := url.URL{
 		Scheme: "http",
 		Host:   fmt.Sprintf("%s:%d", host.IP, host.Port),
@@ -137,25 +242,127 @@ func (self *KubeletClient) GetSummary(host Host) (*stats.Summary, error) {
 	if self.config != nil && self.config.EnableHttps {
 		url.Scheme = "https"
 	}
+	if onlyCpuAndMemory {
+		url.RawQuery = "only_cpu_and_memory=true"
+	}
 
 	req, err := http.NewRequest("GET", url.String(), nil)
 	if err != nil {
-		return nil, err
+		return nil, Payload{}, err
 	}
-	summary := &stats.Summary{}
+	response := &summaryResponse{}
 	client := self.client
 	if client == nil {
 		client = http.DefaultClient
 	}
-	err = self.postRequestAndGetValue(client, req, summary)
-	return summary, err
+	payload, err := self.postRequestAndGetValue(client, req, response)
+	summary := &Summary{
+		Summary: stats.Summary{Node: response.Node.NodeStats, Pods: response.Pods},
+		Rlimit:  response.Node.Rlimit,
+	}
+	if err == nil {
+		payload.Containers = len(summary.Node.SystemContainers)
+		for _, pod := range summary.Pods {
+			payload.Containers += len(pod.Containers)
+		}
+	}
+	return summary, payload, err
+}
+
+// GetMachineInfo returns the machine info of the node, with the topology of its NUMA nodes.
+func (self *KubeletClient) GetMachineInfo(host Host) (*cadvisor.MachineInfo, error) {
+	url := fmt.Sprintf("%s://%s:%d/spec/", self.scheme(), host.IP, host.Port)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	info := &cadvisor.MachineInfo{}
+	if _, err := self.postRequestAndGetValue(self.httpClient(), req, info); err != nil {
+		return nil, fmt.Errorf("failed to get the machine info from Kubelet URL %q: %v", url, err)
+	}
+	return info, nil
+}
+
+// The per-NUMA node memory stats of newer cadvisor versions, in bytes of every kind by NUMA node.
+type numaStats struct {
+	File        map[string]uint64 `json:"file"`
+	Anon        map[string]uint64 `json:"anon"`
+	Unevictable map[string]uint64 `json:"unevictable"`
+}
+
+// The part of the stats of a container holding the per-NUMA node memory stats.
+type numaContainerInfo struct {
+	Stats []struct {
+		Memory struct {
+			ContainerData struct {
+				NumaStats numaStats `json:"numa_stats"`
+			} `json:"container_data"`
+			HierarchicalData struct {
+				NumaStats numaStats `json:"numa_stats"`
+			} `json:"hierarchical_data"`
+		} `json:"memory"`
+	} `json:"stats"`
+}
+
+// GetNumaMemoryUsage returns the memory in use on every NUMA node of the node, in bytes, from the
+// stats of its root container. Returns an empty map if the cadvisor of the Kubelet doesn't report it.
+func (self *KubeletClient) GetNumaMemoryUsage(host Host) (map[int]uint64, error) {
+	url := fmt.Sprintf("%s://%s:%d/stats/container/", self.scheme(), host.IP, host.Port)
+	body, err := json.Marshal(statsRequest{ContainerName: "/", NumStats: 1})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var containers map[string]numaContainerInfo
+	if _, err := self.postRequestAndGetValue(self.httpClient(), req, &containers); err != nil {
+		return nil, fmt.Errorf("failed to get the root container stats from Kubelet URL %q: %v", url, err)
+	}
+	result := map[int]uint64{}
+	root, found := containers["/"]
+	if !found || len(root.Stats) == 0 {
+		return result, nil
+	}
+	memory := root.Stats[len(root.Stats)-1].Memory
+	stats := memory.HierarchicalData.NumaStats
+	if len(stats.File)+len(stats.Anon)+len(stats.Unevictable) == 0 {
+		stats = memory.ContainerData.NumaStats
+	}
+	for _, usage := range []map[string]uint64{stats.File, stats.Anon, stats.Unevictable} {
+		for node, value := range usage {
+			id, err := strconv.Atoi(node)
+			if err != nil {
+				return nil, fmt.Errorf("invalid NUMA node %q in the stats of Kubelet URL %q", node, url)
+			}
+			result[id] += value
+		}
+	}
+	return result, nil
+}
+
+func (self *KubeletClient) scheme() string {
+	if self.config != nil && self.config.EnableHttps {
+		return "https"
+	}
+	return "http"
+}
+
+func (self *KubeletClient) httpClient() *http.Client {
+	if self.client == nil {
+		return http.DefaultClient
+	}
+	return self.client
 }
 
 func (self *KubeletClient) GetPort() int {
 	return int(self.config.Port)
 }
 
-func (self *KubeletClient) getAllContainers(url string, start, end time.Time) ([]cadvisor.ContainerInfo, error) {
+func (self *KubeletClient) getAllContainers(url string, start, end time.Time) ([]cadvisor.ContainerInfo, Payload, error) {
 	// Request data from all subcontainers.
 	request := statsRequest{
 		ContainerName: "/",
@@ -166,32 +373,47 @@ func (self *KubeletClient) getAllContainers(url string, start, end time.Time) ([
 	}
 	body, err := json.Marshal(request)
 	if err != nil {
-		return nil, err
+		return nil, Payload{}, err
 	}
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		return nil, err
+		return nil, Payload{}, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	var containers map[string]cadvisor.ContainerInfo
+	var containers map[string]rawContainerInfo
 	client := self.client
 	if client == nil {
 		client = http.DefaultClient
 	}
-	err = self.postRequestAndGetValue(client, req, &containers)
+	payload, err := self.postRequestAndGetValue(client, req, &containers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all container stats from Kubelet URL %q: %v", url, err)
+		return nil, payload, fmt.Errorf("failed to get all container stats from Kubelet URL %q: %v", url, err)
+	}
+	payload.Containers = len(containers)
+	if root, found := containers["/"]; found && len(root.Stats) > 0 {
+		stat := root.Stats[len(root.Stats)-1]
+		payload.CgroupVersion = core.DetectCgroupVersion(&stat.ContainerStats, stat.pressure)
 	}
 
-	result := make([]cadvisor.ContainerInfo, 0, len(containers))
-	for _, containerInfo := range containers {
+	startTime := time.Now()
+	specs := self.specs
+	if specs == nil {
+		specs = newSpecCache()
+	}
+	decoded, err := specs.decode(url, containers, startTime)
+	payload.ParseTime += time.Since(startTime)
+	if err != nil {
+		return nil, payload, fmt.Errorf("failed to parse container specs from Kubelet URL %q: %v", url, err)
+	}
+	result := make([]cadvisor.ContainerInfo, 0, len(decoded))
+	for _, containerInfo := range decoded {
 		cont := self.parseStat(&containerInfo)
 		if cont != nil {
 			result = append(result, *cont)
 		}
 	}
-	return result, nil
+	return result, payload, nil
 }
 
 func NewKubeletClient(kubeletConfig *kube_client.KubeletClientConfig) (*KubeletClient, error) {
@@ -206,5 +428,6 @@ func NewKubeletClient(kubeletConfig *kube_client.KubeletClientConfig) (*KubeletC
 	return &KubeletClient{
 		config: kubeletConfig,
 		client: c,
+		specs:  newSpecCache(),
 	}, nil
 }
@@ -16,7 +16,10 @@ package kubelet
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
@@ -96,9 +99,59 @@ func TestAllContainers(t *testing.T) {
 	server := httptest.NewServer(&handler)
 	defer server.Close()
 	kubeletClient := KubeletClient{}
-	containers, err := kubeletClient.getAllContainers(server.URL, time.Now(), time.Now().Add(time.Minute))
+	containers, payload, err := kubeletClient.getAllContainers(server.URL, time.Now(), time.Now().Add(time.Minute))
 	require.NoError(t, err)
 	require.Len(t, containers, 2)
+	assert.Equal(t, len(data), payload.Bytes)
+	assert.Equal(t, 2, payload.Containers)
 	checkContainer(t, rootContainer, containers[0])
 	checkContainer(t, subcontainer, containers[1])
 }
+
+func TestRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		// The request body is sent again on every attempt.
+		assert.NotEmpty(t, body)
+		switch r.URL.Path {
+		case "/flaky":
+			if attempts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("{}"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	kubeletClient := KubeletClient{client: &http.Client{}}
+	kubeletClient.SetScrapeOptions(ScrapeOptions{Concurrency: 1, Retries: 2})
+	_, _, err := kubeletClient.getAllContainers(server.URL+"/flaky", time.Now(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	// Missing endpoints aren't retried, the summary API falls back to the cAdvisor API on them.
+	attempts = 0
+	_, _, err = kubeletClient.getAllContainers(server.URL+"/missing", time.Now(), time.Now())
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestGetScrapeOptions(t *testing.T) {
+	opts, err := GetScrapeOptions(&url.URL{})
+	require.NoError(t, err)
+	assert.Equal(t, ScrapeOptions{}, opts)
+
+	opts, err = GetScrapeOptions(&url.URL{RawQuery: "scrapeConcurrency=50&scrapeTimeout=5s&scrapeRetries=1"})
+	require.NoError(t, err)
+	assert.Equal(t, ScrapeOptions{Concurrency: 50, Timeout: 5 * time.Second, Retries: 1}, opts)
+
+	for _, query := range []string{"scrapeConcurrency=-1", "scrapeTimeout=5", "scrapeRetries=x"} {
+		_, err := GetScrapeOptions(&url.URL{RawQuery: query})
+		assert.Error(t, err, query)
+	}
+}
@@ -16,6 +16,7 @@ package kubelet
 import (
 	"encoding/json"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
 	"testing"
@@ -26,6 +27,9 @@ import (
 	"github.com/stretchr/testify/require"
 	"k8s.io/heapster/metrics/core"
 	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	kubelet_client "k8s.io/kubernetes/pkg/kubelet/client"
+	"k8s.io/kubernetes/pkg/labels"
 	util "k8s.io/kubernetes/pkg/util/testing"
 )
 
@@ -296,6 +300,87 @@ func TestDecodeMetrics6(t *testing.T) {
 	assert.Equal(t, metricSet.Labels[core.LabelMetricSetType.Key], core.MetricSetTypeNode)
 }
 
+func TestDecodeCpuSpecMetrics(t *testing.T) {
+	kMS := kubeletMetricsSource{
+		nodename: "test",
+		hostname: "test-hostname",
+	}
+	c1 := cadvisor_api.ContainerInfo{
+		ContainerReference: cadvisor_api.ContainerReference{
+			Name: "/docker-daemon",
+		},
+		Spec: cadvisor_api.ContainerSpec{
+			CreationTime: time.Now(),
+			HasCpu:       true,
+			Cpu: cadvisor_api.CpuSpec{
+				Limit:  512,
+				Quota:  50000,
+				Period: 100000,
+			},
+		},
+		Stats: []*cadvisor_api.ContainerStats{
+			{
+				Timestamp: time.Now(),
+			},
+		},
+	}
+	_, metricSet := kMS.decodeMetrics(&c1)
+	assert.Equal(t, int64(512), metricSet.MetricValues[core.MetricCpuShares.Name].IntValue)
+	assert.Equal(t, int64(50000), metricSet.MetricValues[core.MetricCpuQuota.Name].IntValue)
+	assert.Equal(t, int64(100000), metricSet.MetricValues[core.MetricCpuPeriod.Name].IntValue)
+
+	// No CFS quota set.
+	c1.Spec.Cpu.Quota = 0
+	_, metricSet = kMS.decodeMetrics(&c1)
+	_, found := metricSet.MetricValues[core.MetricCpuQuota.Name]
+	assert.False(t, found)
+}
+
+func TestDecodeRawSamples(t *testing.T) {
+	kMS := kubeletMetricsSource{
+		nodename:   "test",
+		hostname:   "test-hostname",
+		rawSamples: true,
+	}
+	now := time.Now()
+	c1 := cadvisor_api.ContainerInfo{
+		ContainerReference: cadvisor_api.ContainerReference{
+			Name: "/",
+		},
+		Spec: cadvisor_api.ContainerSpec{
+			CreationTime: now.Add(-time.Hour),
+			HasCpu:       true,
+		},
+		Stats: []*cadvisor_api.ContainerStats{
+			{
+				Timestamp: now.Add(-20 * time.Second),
+				Cpu:       cadvisor_api.CpuStats{Usage: cadvisor_api.CpuUsage{Total: 100}},
+			},
+			{
+				Timestamp: now.Add(-10 * time.Second),
+				Cpu:       cadvisor_api.CpuStats{Usage: cadvisor_api.CpuUsage{Total: 200}},
+			},
+			{
+				Timestamp: now,
+				Cpu:       cadvisor_api.CpuStats{Usage: cadvisor_api.CpuUsage{Total: 300}},
+			},
+		},
+	}
+	_, metricSet := kMS.decodeMetrics(&c1)
+	assert.Equal(t, now, metricSet.ScrapeTime)
+	assert.Equal(t, int64(300), metricSet.MetricValues[core.MetricCpuUsage.Name].IntValue)
+	require.Len(t, metricSet.RawSamples, 3)
+	for i, sample := range metricSet.RawSamples {
+		assert.Equal(t, c1.Stats[i].Timestamp, sample.Timestamp)
+		assert.Equal(t, int64(100*(i+1)), sample.MetricValues[core.MetricCpuUsage.Name].IntValue)
+	}
+
+	kMS.rawSamples = false
+	_, metricSet = kMS.decodeMetrics(&c1)
+	assert.Equal(t, int64(300), metricSet.MetricValues[core.MetricCpuUsage.Name].IntValue)
+	assert.Empty(t, metricSet.RawSamples)
+}
+
 var nodes = []kube_api.Node{
 	{
 		ObjectMeta: kube_api.ObjectMeta{
@@ -385,6 +470,41 @@ func TestGetNodeHostnameAndIP(t *testing.T) {
 	}
 }
 
+// Scrapes a fake Kubelet serving the response, after passing it to edit, if set.
+func scrapeFakeKubelet(t *testing.T, response map[string]cadvisor_api.ContainerInfo, edit func(map[string]interface{})) *core.DataBatch {
+	data, err := json.Marshal(&response)
+	require.NoError(t, err)
+	if edit != nil {
+		decoded := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		edit(decoded)
+		data, err = json.Marshal(decoded)
+		require.NoError(t, err)
+	}
+	handler := util.FakeHandler{
+		StatusCode:   200,
+		RequestBody:  "",
+		ResponseBody: string(data),
+		T:            t,
+	}
+	server := httptest.NewServer(&handler)
+	defer server.Close()
+
+	var client KubeletClient
+
+	mtrcSrc := kubeletMetricsSource{
+		kubeletClient: &client,
+	}
+
+	split := strings.SplitN(strings.Replace(server.URL, "http://", "", 1), ":", 2)
+	mtrcSrc.host.IP = split[0]
+	mtrcSrc.host.Port, err = strconv.Atoi(split[1])
+
+	start := time.Now()
+	end := start.Add(5 * time.Second)
+	return mtrcSrc.ScrapeMetrics(start, end)
+}
+
 func TestScrapeMetrics(t *testing.T) {
 	rootContainer := cadvisor_api.ContainerInfo{
 		ContainerReference: cadvisor_api.ContainerReference{
@@ -437,31 +557,210 @@ func TestScrapeMetrics(t *testing.T) {
 			},
 		},
 	}
-	data, err := json.Marshal(&response)
-	require.NoError(t, err)
-	handler := util.FakeHandler{
-		StatusCode:   200,
-		RequestBody:  "",
-		ResponseBody: string(data),
-		T:            t,
+	res := scrapeFakeKubelet(t, response, nil)
+	assert.Equal(t, res.MetricSets["node:/container:docker-daemon"].Labels["type"], "sys_container")
+	assert.Equal(t, res.MetricSets["node:/container:docker-daemon"].Labels["container_name"], "docker-daemon")
+
+}
+
+func TestScrapeMetricsCgroupVersion(t *testing.T) {
+	spec := cadvisor_api.ContainerSpec{
+		CreationTime: time.Now(),
+		HasCpu:       true,
+		HasMemory:    true,
+	}
+	response := func(stats *cadvisor_api.ContainerStats) map[string]cadvisor_api.ContainerInfo {
+		return map[string]cadvisor_api.ContainerInfo{
+			"/": {
+				ContainerReference: cadvisor_api.ContainerReference{Name: "/"},
+				Spec:               spec,
+				Stats:              []*cadvisor_api.ContainerStats{stats},
+			},
+			"/docker-daemon": {
+				ContainerReference: cadvisor_api.ContainerReference{Name: "/docker-daemon"},
+				Spec:               spec,
+				Stats:              []*cadvisor_api.ContainerStats{{Timestamp: time.Now()}},
+			},
+		}
 	}
-	server := httptest.NewServer(&handler)
-	defer server.Close()
 
-	var client KubeletClient
+	// cgroup v1 reports per-cpu usage and total_inactive_file.
+	res := scrapeFakeKubelet(t, response(&cadvisor_api.ContainerStats{
+		Timestamp: time.Now(),
+		Cpu: cadvisor_api.CpuStats{
+			Usage: cadvisor_api.CpuUsage{Total: 100, PerCpu: []uint64{40, 60}},
+		},
+		Memory: cadvisor_api.MemoryStats{
+			Usage:            200,
+			WorkingSet:       150,
+			HierarchicalData: cadvisor_api.MemoryStatsMemoryData{Pgfault: 10, Pgmajfault: 1},
+		},
+	}), nil)
+	node := res.MetricSets["node:"]
+	require.NotNil(t, node)
+	assert.Equal(t, core.CgroupV1, node.Labels[core.LabelCgroupVersion.Key])
+	assert.Equal(t, int64(150), node.MetricValues[core.MetricMemoryWorkingSet.Name].IntValue)
 
-	mtrcSrc := kubeletMetricsSource{
-		kubeletClient: &client,
+	// cgroup v2 reports pressure stall information, but neither per-cpu usage nor
+	// total_inactive_file.
+	v2 := &cadvisor_api.ContainerStats{
+		Timestamp: time.Now(),
+		Cpu: cadvisor_api.CpuStats{
+			Usage: cadvisor_api.CpuUsage{Total: 100},
+		},
+		Memory: cadvisor_api.MemoryStats{
+			Usage: 200,
+			ContainerData: cadvisor_api.MemoryStatsMemoryData{
+				Pgfault:    10,
+				Pgmajfault: 1,
+			},
+		},
 	}
+	res = scrapeFakeKubelet(t, response(v2), func(response map[string]interface{}) {
+		stats := response["/"].(map[string]interface{})["stats"].([]interface{})[0].(map[string]interface{})
+		stats["cpu"].(map[string]interface{})["psi"] = map[string]interface{}{
+			"some": map[string]interface{}{"total": 1000, "avg10": 0.5},
+		}
+	})
+	node = res.MetricSets["node:"]
+	require.NotNil(t, node)
+	assert.Equal(t, core.CgroupV2, node.Labels[core.LabelCgroupVersion.Key])
+	assert.Equal(t, int64(200), node.MetricValues[core.MetricMemoryWorkingSet.Name].IntValue)
+	assert.Equal(t, int64(10), node.MetricValues[core.MetricMemoryPageFaults.Name].IntValue)
+	_, found := res.MetricSets["node:/container:docker-daemon"].Labels[core.LabelCgroupVersion.Key]
+	assert.False(t, found)
 
-	split := strings.SplitN(strings.Replace(server.URL, "http://", "", 1), ":", 2)
-	mtrcSrc.host.IP = split[0]
-	mtrcSrc.host.Port, err = strconv.Atoi(split[1])
+	// Without pressure stall information the stats are left alone.
+	res = scrapeFakeKubelet(t, response(v2), nil)
+	node = res.MetricSets["node:"]
+	require.NotNil(t, node)
+	_, found = node.Labels[core.LabelCgroupVersion.Key]
+	assert.False(t, found)
+}
 
-	start := time.Now()
-	end := start.Add(5 * time.Second)
-	res := mtrcSrc.ScrapeMetrics(start, end)
-	assert.Equal(t, res.MetricSets["node:/container:docker-daemon"].Labels["type"], "sys_container")
-	assert.Equal(t, res.MetricSets["node:/container:docker-daemon"].Labels["container_name"], "docker-daemon")
+func TestDecodeDiskMetrics(t *testing.T) {
+	kMS := kubeletMetricsSource{
+		nodename: "test",
+		hostname: "test-hostname",
+	}
+	now := time.Now()
+	c1 := cadvisor_api.ContainerInfo{
+		ContainerReference: cadvisor_api.ContainerReference{
+			Name: "/docker/smart-exporter",
+		},
+		Spec: cadvisor_api.ContainerSpec{
+			CreationTime:     now,
+			HasCustomMetrics: true,
+			CustomMetrics: []cadvisor_api.MetricSpec{
+				{
+					Name:   "disk_health_status",
+					Type:   cadvisor_api.MetricGauge,
+					Format: cadvisor_api.IntType,
+				},
+				{
+					Name:   "disk_temperature",
+					Type:   cadvisor_api.MetricGauge,
+					Format: cadvisor_api.FloatType,
+				},
+			},
+		},
+		Stats: []*cadvisor_api.ContainerStats{
+			{
+				Timestamp: now,
+				CustomMetrics: map[string][]cadvisor_api.MetricVal{
+					"disk_health_status": {
+						{Label: "sda", Timestamp: now.Add(-time.Minute), IntValue: 1},
+						{Label: "sda", Timestamp: now, IntValue: 0},
+						{Label: "sdb", Timestamp: now, IntValue: 1},
+					},
+					"disk_temperature": {
+						{Label: "sda", Timestamp: now, FloatValue: 41.5},
+						{Timestamp: now, FloatValue: 99},
+					},
+				},
+			},
+		},
+	}
+	_, metricSet := kMS.decodeMetrics(&c1)
+	require.NotNil(t, metricSet)
+	_, found := metricSet.MetricValues[core.CustomMetricPrefix+"disk_health_status"]
+	assert.False(t, found)
+
+	values := map[string]core.MetricValue{}
+	for _, metric := range metricSet.LabeledMetrics {
+		values[metric.Name+"|"+metric.Labels[core.LabelResourceID.Key]] = metric.MetricValue
+	}
+	require.Len(t, values, 3)
+	assert.Equal(t, int64(0), values["disk/health_status|sda"].IntValue)
+	assert.Equal(t, int64(1), values["disk/health_status|sdb"].IntValue)
+	assert.Equal(t, core.ValueFloat, values["disk/temperature|sda"].ValueType)
+	assert.Equal(t, float32(41.5), values["disk/temperature|sda"].FloatValue)
+}
+
+func TestMoveDiskMetricsToNode(t *testing.T) {
+	node := &core.MetricSet{LabeledMetrics: []core.LabeledMetric{}}
+	container := &core.MetricSet{
+		LabeledMetrics: []core.LabeledMetric{
+			NewDiskMetric(&core.MetricDiskHealthStatus, "sda", 1),
+			{Name: "filesystem/usage", Labels: map[string]string{core.LabelResourceID.Key: "/"}},
+		},
+	}
+	metricSets := map[string]*core.MetricSet{
+		core.NodeKey("test"):                            node,
+		core.NodeContainerKey("test", "smart-exporter"): container,
+	}
+	MoveDiskMetricsToNode(metricSets, core.NodeKey("test"))
+	require.Len(t, node.LabeledMetrics, 1)
+	assert.Equal(t, "disk/health_status", node.LabeledMetrics[0].Name)
+	require.Len(t, container.LabeledMetrics, 1)
+	assert.Equal(t, "filesystem/usage", container.LabeledMetrics[0].Name)
+}
+
+func TestGetNodeLabelSelector(t *testing.T) {
+	selector, err := GetNodeLabelSelector(&url.URL{})
+	require.NoError(t, err)
+	assert.True(t, selector.Empty())
+
+	selector, err = GetNodeLabelSelector(&url.URL{RawQuery: url.Values{"nodeLabelSelector": {"kubernetes.io/os!=windows,pool in (a,b)"}}.Encode()})
+	require.NoError(t, err)
+	assert.True(t, selector.Matches(labels.Set{"kubernetes.io/os": "linux", "pool": "a"}))
+	assert.False(t, selector.Matches(labels.Set{"kubernetes.io/os": "windows", "pool": "a"}))
+	assert.False(t, selector.Matches(labels.Set{"kubernetes.io/os": "linux"}))
+
+	_, err = GetNodeLabelSelector(&url.URL{RawQuery: "nodeLabelSelector=a%3D%3Db%3Dc"})
+	assert.Error(t, err)
+}
+
+func TestGetVirtualProvider(t *testing.T) {
+	node := &kube_api.Node{ObjectMeta: kube_api.ObjectMeta{Name: "regular"}}
+	assert.Equal(t, "", GetVirtualProvider(node))
+
+	node.Labels = map[string]string{"type": "virtual-kubelet"}
+	assert.Equal(t, UnknownVirtualProvider, GetVirtualProvider(node))
+
+	node.Annotations = map[string]string{
+		kube_api.TaintsAnnotationKey: `[{"key":"virtual-kubelet.io/provider","value":"azure","effect":"NoSchedule"}]`,
+	}
+	assert.Equal(t, "azure", GetVirtualProvider(node))
+
+	node.Labels = map[string]string{VirtualKubeletProviderKey: "aws"}
+	assert.Equal(t, "aws", GetVirtualProvider(node))
+}
+
+func TestProviderSkipsVirtualNodes(t *testing.T) {
+	nodeLister := &cache.StoreToNodeLister{Store: cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	for _, node := range []*kube_api.Node{
+		{ObjectMeta: kube_api.ObjectMeta{Name: "regular"}},
+		{ObjectMeta: kube_api.ObjectMeta{Name: "aci", Labels: map[string]string{"type": "virtual-kubelet"}}},
+	} {
+		node.Status.Addresses = []kube_api.NodeAddress{{Type: kube_api.NodeInternalIP, Address: "127.0.0.1"}}
+		require.NoError(t, nodeLister.Add(node))
+	}
+	kubeletClient, err := NewKubeletClient(&kubelet_client.KubeletClientConfig{Port: 10255})
+	require.NoError(t, err)
+	provider := &kubeletProvider{nodeLister: nodeLister, kubeletClient: kubeletClient}
 
+	sources := provider.GetMetricsSources()
+	require.Len(t, sources, 1)
+	assert.Equal(t, "regular", sources[0].(*kubeletMetricsSource).nodename)
 }
@@ -0,0 +1,94 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	cadvisor "github.com/google/cadvisor/info/v1"
+	. "k8s.io/heapster/metrics/core"
+)
+
+// How long the NUMA topology of a node is cached before being requested again.
+const topologyRefreshInterval = time.Hour
+
+// Caches the NUMA topology of the nodes, which only changes when they reboot, so that it is requested
+// from the Kubelets once an hour rather than every scrape.
+type topologyCache struct {
+	lock       sync.Mutex
+	topologies map[string]cachedTopology
+}
+
+type cachedTopology struct {
+	nodes   []cadvisor.Node
+	fetched time.Time
+}
+
+func newTopologyCache() *topologyCache {
+	return &topologyCache{topologies: make(map[string]cachedTopology)}
+}
+
+// Returns the NUMA topology of the node, requesting it from its Kubelet if it isn't cached or is too old.
+func (this *topologyCache) get(client *KubeletClient, host Host, node string, now time.Time) ([]cadvisor.Node, error) {
+	this.lock.Lock()
+	cached, found := this.topologies[node]
+	this.lock.Unlock()
+	if found && now.Sub(cached.fetched) < topologyRefreshInterval {
+		return cached.nodes, nil
+	}
+
+	info, err := client.GetMachineInfo(host)
+	if err != nil {
+		if found {
+			glog.Warningf("Using the cached NUMA topology of node %s: %v", node, err)
+			return cached.nodes, nil
+		}
+		return nil, err
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.topologies[node] = cachedTopology{nodes: info.Topology, fetched: now}
+	return info.Topology, nil
+}
+
+// Forgets the topologies of the nodes not in the cluster anymore.
+func (this *topologyCache) retain(nodes map[string]bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for node := range this.topologies {
+		if !nodes[node] {
+			delete(this.topologies, node)
+		}
+	}
+}
+
+// Adds the usage of the NUMA nodes of the node to its metric set, if the Kubelet reports its topology.
+func (this *kubeletMetricsSource) addNumaMetrics(node *MetricSet, root *cadvisor.ContainerStats) {
+	topology, err := this.topologies.get(this.kubeletClient, this.host, this.nodename, time.Now())
+	if err != nil {
+		glog.Errorf("error while getting the NUMA topology of node %s: %v", this.nodename, err)
+		return
+	}
+	if len(topology) == 0 {
+		return
+	}
+	memoryUsage, err := this.kubeletClient.GetNumaMemoryUsage(this.host)
+	if err != nil {
+		glog.Errorf("error while getting the NUMA memory usage of node %s: %v", this.nodename, err)
+	}
+	node.LabeledMetrics = append(node.LabeledMetrics, NumaMetricValues(topology, root, memoryUsage)...)
+}
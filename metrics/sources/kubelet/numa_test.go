@@ -0,0 +1,180 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cadvisor_api "github.com/google/cadvisor/info/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+)
+
+// Root container stats with per-NUMA node memory stats, in pages, as reported by newer cadvisors.
+const numaRootStats = `{"/": {"name": "/", "stats": [{"memory": {
+	"container_data": {"numa_stats": {"file": {"0": 4096}}},
+	"hierarchical_data": {"numa_stats": {"file": {"0": 4096, "1": 8192}, "anon": {"0": 40960, "1": 81920}, "unevictable": {"1": 12288}}}
+}}]}}`
+
+type fakeKubelet struct {
+	sync.Mutex
+	server       *httptest.Server
+	topology     []cadvisor_api.Node
+	specRequests int
+	containers   map[string]cadvisor_api.ContainerInfo
+	// Start of the last request of the stats of the containers.
+	statsStart time.Time
+}
+
+func newFakeKubelet(t *testing.T) *fakeKubelet {
+	kubelet := &fakeKubelet{}
+	kubelet.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kubelet.Lock()
+		defer kubelet.Unlock()
+		switch r.URL.Path {
+		case "/spec/":
+			kubelet.specRequests++
+			require.NoError(t, json.NewEncoder(w).Encode(&cadvisor_api.MachineInfo{Topology: kubelet.topology}))
+		case "/stats/container/":
+			var request statsRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			if request.Subcontainers {
+				kubelet.statsStart = request.Start
+				require.NoError(t, json.NewEncoder(w).Encode(kubelet.containers))
+			} else {
+				w.Write([]byte(numaRootStats))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return kubelet
+}
+
+func (this *fakeKubelet) host(t *testing.T) Host {
+	split := strings.SplitN(strings.TrimPrefix(this.server.URL, "http://"), ":", 2)
+	port, err := strconv.Atoi(split[1])
+	require.NoError(t, err)
+	return Host{IP: split[0], Port: port}
+}
+
+func TestScrapeNumaMetrics(t *testing.T) {
+	kubelet := newFakeKubelet(t)
+	defer kubelet.server.Close()
+	kubelet.topology = []cadvisor_api.Node{
+		{Id: 0, Memory: 1 << 30, Cores: []cadvisor_api.Core{{Threads: []int{0, 1}}}},
+		{Id: 1, Memory: 1 << 31, Cores: []cadvisor_api.Core{{Threads: []int{2, 3}}}},
+	}
+	kubelet.containers = map[string]cadvisor_api.ContainerInfo{
+		"/": {
+			ContainerReference: cadvisor_api.ContainerReference{Name: "/"},
+			Spec:               cadvisor_api.ContainerSpec{HasCpu: true, HasMemory: true},
+			Stats: []*cadvisor_api.ContainerStats{{
+				Timestamp: time.Now(),
+				Cpu: cadvisor_api.CpuStats{
+					Usage: cadvisor_api.CpuUsage{Total: 1000, PerCpu: []uint64{100, 200, 300, 400}},
+				},
+			}},
+		},
+	}
+
+	source := newKubeletMetricsSource(kubelet.host(t), &KubeletClient{}, "node1", "node1", "", false)
+	source.topologies = newTopologyCache()
+	for i := 0; i < 2; i++ {
+		batch := source.ScrapeMetrics(time.Now(), time.Now())
+		node := batch.MetricSets[core.NodeKey("node1")]
+		require.NotNil(t, node)
+
+		values := map[string]int64{}
+		for _, metric := range node.LabeledMetrics {
+			values[metric.Name+":"+metric.Labels[core.LabelResourceID.Key]] = metric.IntValue
+		}
+		assert.Equal(t, map[string]int64{
+			"memory/numa_capacity:node0": 1 << 30,
+			"memory/numa_capacity:node1": 1 << 31,
+			"memory/numa_usage:node0":    45056,
+			"memory/numa_usage:node1":    102400,
+			"cpu/numa_usage:node0":       300,
+			"cpu/numa_usage:node1":       700,
+		}, values)
+	}
+	// The topology is cached.
+	assert.Equal(t, 1, kubelet.specRequests)
+}
+
+func TestScrapeWithoutNuma(t *testing.T) {
+	kubelet := newFakeKubelet(t)
+	defer kubelet.server.Close()
+	kubelet.containers = map[string]cadvisor_api.ContainerInfo{
+		"/": {
+			ContainerReference: cadvisor_api.ContainerReference{Name: "/"},
+			Spec:               cadvisor_api.ContainerSpec{HasCpu: true},
+			Stats:              []*cadvisor_api.ContainerStats{{Timestamp: time.Now()}},
+		},
+	}
+
+	source := newKubeletMetricsSource(kubelet.host(t), &KubeletClient{}, "node1", "node1", "", false)
+	node := source.ScrapeMetrics(time.Now(), time.Now()).MetricSets[core.NodeKey("node1")]
+	require.NotNil(t, node)
+	assert.Empty(t, node.LabeledMetrics)
+	assert.Equal(t, 0, kubelet.specRequests)
+
+	// Nodes without topology don't get NUMA metrics either.
+	source.topologies = newTopologyCache()
+	node = source.ScrapeMetrics(time.Now(), time.Now()).MetricSets[core.NodeKey("node1")]
+	require.NotNil(t, node)
+	assert.Empty(t, node.LabeledMetrics)
+	assert.Equal(t, 1, kubelet.specRequests)
+}
+
+func TestTopologyCache(t *testing.T) {
+	kubelet := newFakeKubelet(t)
+	kubelet.topology = []cadvisor_api.Node{{Id: 0}}
+	host := kubelet.host(t)
+	client := &KubeletClient{}
+	cache := newTopologyCache()
+	now := time.Now()
+
+	topology, err := cache.get(client, host, "node1", now)
+	require.NoError(t, err)
+	assert.Len(t, topology, 1)
+
+	kubelet.topology = []cadvisor_api.Node{{Id: 0}, {Id: 1}}
+	topology, err = cache.get(client, host, "node1", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, topology, 1)
+	topology, err = cache.get(client, host, "node1", now.Add(topologyRefreshInterval))
+	require.NoError(t, err)
+	assert.Len(t, topology, 2)
+
+	// The cached topology is kept while the Kubelet can't be reached.
+	kubelet.server.Close()
+	topology, err = cache.get(client, host, "node1", now.Add(3*topologyRefreshInterval))
+	assert.NoError(t, err)
+	assert.Len(t, topology, 2)
+	_, err = cache.get(client, host, "node2", now)
+	assert.Error(t, err)
+
+	cache.retain(map[string]bool{"node2": true})
+	assert.Empty(t, cache.topologies)
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// A node is an outlier when its payload or parse time is this many times the median of the nodes.
+	payloadOutlierFactor = 5
+	// Payloads and parse times below these are never outliers, however small the median.
+	minOutlierBytes     = 1024 * 1024
+	minOutlierParseTime = 100 * time.Millisecond
+)
+
+var (
+	payloadBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "kubelet",
+			Name:      "payload_bytes",
+			Help:      "Size in bytes of the latest response of the Kubelet.",
+		},
+		[]string{"node"},
+	)
+	payloadContainers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "kubelet",
+			Name:      "payload_containers",
+			Help:      "Number of containers in the latest response of the Kubelet.",
+		},
+		[]string{"node"},
+	)
+	payloadParseDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "kubelet",
+			Name:      "parse_duration_microseconds",
+			Help:      "Time spent parsing the latest response of the Kubelet in microseconds.",
+		},
+		[]string{"node"},
+	)
+	payloadOutlier = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "kubelet",
+			Name:      "payload_outlier",
+			Help:      "1 if the latest response of the Kubelet is much larger or slower to parse than the ones of the other nodes, 0 otherwise.",
+		},
+		[]string{"node"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(payloadBytes)
+	prometheus.MustRegister(payloadContainers)
+	prometheus.MustRegister(payloadParseDuration)
+	prometheus.MustRegister(payloadOutlier)
+}
+
+// Payload describes a response of the Kubelet.
+type Payload struct {
+	Bytes      int
+	Containers int
+	ParseTime  time.Duration
+	// Cgroup version of the node, from the stats of its root container, empty if unknown.
+	CgroupVersion string
+	// Whether the payload dominates the scrape of the nodes, set by the tracker.
+	Outlier bool
+}
+
+// PayloadTracker keeps the latest payload of each node, to flag the nodes whose payloads
+// are much larger or slower to parse than the others, e.g. because of thousands of dead containers.
+type PayloadTracker struct {
+	lock     sync.Mutex
+	payloads map[string]Payload
+}
+
+// DefaultPayloadTracker tracks the payloads of the kubelet sources and exports them.
+var DefaultPayloadTracker = NewPayloadTracker()
+
+func NewPayloadTracker() *PayloadTracker {
+	return &PayloadTracker{payloads: make(map[string]Payload)}
+}
+
+// Retain forgets the payloads of the nodes other than the given ones, e.g. of the deleted nodes.
+func (this *PayloadTracker) Retain(nodes map[string]bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for node := range this.payloads {
+		if !nodes[node] {
+			delete(this.payloads, node)
+			payloadBytes.DeleteLabelValues(node)
+			payloadContainers.DeleteLabelValues(node)
+			payloadParseDuration.DeleteLabelValues(node)
+			payloadOutlier.DeleteLabelValues(node)
+		}
+	}
+}
+
+// Record stores the latest payload of the node and returns whether it is an outlier.
+func (this *PayloadTracker) Record(node string, payload Payload) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	bytes := []int{}
+	parseTimes := []time.Duration{}
+	for other, otherPayload := range this.payloads {
+		if other != node {
+			bytes = append(bytes, otherPayload.Bytes)
+			parseTimes = append(parseTimes, otherPayload.ParseTime)
+		}
+	}
+	payload.Outlier = false
+	if len(bytes) > 0 {
+		sort.Ints(bytes)
+		sort.Sort(durations(parseTimes))
+		medianBytes, medianParseTime := bytes[len(bytes)/2], parseTimes[len(parseTimes)/2]
+		payload.Outlier = (payload.Bytes >= minOutlierBytes && payload.Bytes > payloadOutlierFactor*medianBytes) ||
+			(payload.ParseTime >= minOutlierParseTime && payload.ParseTime > payloadOutlierFactor*medianParseTime)
+		if payload.Outlier && !this.payloads[node].Outlier {
+			glog.Warningf("Kubelet of node %s returned %d bytes for %d containers, parsed in %v, against a median of %d bytes parsed in %v",
+				node, payload.Bytes, payload.Containers, payload.ParseTime, medianBytes, medianParseTime)
+		}
+	}
+	this.payloads[node] = payload
+
+	payloadBytes.WithLabelValues(node).Set(float64(payload.Bytes))
+	payloadContainers.WithLabelValues(node).Set(float64(payload.Containers))
+	payloadParseDuration.WithLabelValues(node).Set(float64(payload.ParseTime / time.Microsecond))
+	if payload.Outlier {
+		payloadOutlier.WithLabelValues(node).Set(1)
+	} else {
+		payloadOutlier.WithLabelValues(node).Set(0)
+	}
+	return payload.Outlier
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
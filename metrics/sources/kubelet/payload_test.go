@@ -0,0 +1,49 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadTracker(t *testing.T) {
+	tracker := NewPayloadTracker()
+	small := Payload{Bytes: 500 * 1024, Containers: 30, ParseTime: 10 * time.Millisecond}
+
+	// A single node has nothing to be compared with.
+	assert.False(t, tracker.Record("node1", Payload{Bytes: 50 * 1024 * 1024}))
+
+	assert.False(t, tracker.Record("node1", small))
+	assert.False(t, tracker.Record("node2", small))
+	assert.False(t, tracker.Record("node3", small))
+
+	// Thousands of dead containers.
+	assert.True(t, tracker.Record("node4", Payload{Bytes: 40 * 1024 * 1024, Containers: 5000, ParseTime: 400 * time.Millisecond}))
+	assert.True(t, tracker.Record("node4", Payload{Bytes: 1024 * 1024, Containers: 100, ParseTime: 2 * time.Second}))
+	assert.False(t, tracker.Record("node4", small))
+
+	// Small payloads aren't outliers, however smaller the other ones are.
+	assert.False(t, tracker.Record("node5", Payload{Bytes: 900 * 1024, ParseTime: 90 * time.Millisecond}))
+
+	// The payloads of the nodes that left the cluster are forgotten.
+	tracker.Retain(map[string]bool{"node4": true, "node6": true})
+	assert.Len(t, tracker.payloads, 1)
+	assert.True(t, tracker.Record("node6", Payload{Bytes: 40 * 1024 * 1024, ParseTime: 400 * time.Millisecond}))
+	tracker.Retain(map[string]bool{"node6": true})
+	assert.False(t, tracker.Record("node6", Payload{Bytes: 40 * 1024 * 1024, ParseTime: 400 * time.Millisecond}))
+}
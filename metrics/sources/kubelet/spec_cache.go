@@ -0,0 +1,94 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+)
+
+// How long the specs of a Kubelet which isn't scraped anymore are kept.
+const specCacheExpiry = 10 * time.Minute
+
+// Caches the decoded specs of the containers of the Kubelets, with their labels, which only
+// change when the containers are replaced, so that they are decoded once per container rather
+// than every scrape. Only a fingerprint of the encoded specs is kept to notice the changes. The
+// Kubelets still send the specs every scrape.
+type specCache struct {
+	lock sync.Mutex
+	// Specs by container name, by Kubelet url.
+	kubelets map[string]*kubeletSpecs
+}
+
+type kubeletSpecs struct {
+	specs   map[string]*cachedSpec
+	scraped time.Time
+}
+
+type cachedSpec struct {
+	fingerprint uint64
+	spec        cadvisor.ContainerSpec
+}
+
+func newSpecCache() *specCache {
+	return &specCache{kubelets: make(map[string]*kubeletSpecs)}
+}
+
+func fingerprint(raw rawSpec) uint64 {
+	hash := fnv.New64a()
+	hash.Write(raw)
+	return hash.Sum64()
+}
+
+// Returns the containers of the response of the Kubelet at the url, with the specs which didn't
+// change since the last scrape taken from the cache. The specs of the containers gone from the
+// response are forgotten.
+func (this *specCache) decode(url string, containers map[string]rawContainerInfo, now time.Time) ([]cadvisor.ContainerInfo, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for kubelet, cached := range this.kubelets {
+		if now.Sub(cached.scraped) > specCacheExpiry {
+			delete(this.kubelets, kubelet)
+		}
+	}
+	previous := this.kubelets[url]
+	current := &kubeletSpecs{
+		specs:   make(map[string]*cachedSpec, len(containers)),
+		scraped: now,
+	}
+	result := make([]cadvisor.ContainerInfo, 0, len(containers))
+	for name, raw := range containers {
+		var cached *cachedSpec
+		if previous != nil {
+			cached = previous.specs[name]
+		}
+		if hash := fingerprint(raw.Spec); cached == nil || cached.fingerprint != hash {
+			cached = &cachedSpec{fingerprint: hash}
+			if len(raw.Spec) > 0 {
+				if err := json.Unmarshal(raw.Spec, &cached.spec); err != nil {
+					return nil, err
+				}
+			}
+		}
+		current.specs[name] = cached
+		result = append(result, raw.containerInfo(cached.spec))
+	}
+	this.kubelets[url] = current
+	return result, nil
+}
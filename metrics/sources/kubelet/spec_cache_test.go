@@ -0,0 +1,75 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	cadvisor "github.com/google/cadvisor/info/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeContainers(t *testing.T, specs *specCache, url string, body string, now time.Time) map[string]cadvisor.ContainerInfo {
+	var containers map[string]rawContainerInfo
+	require.NoError(t, json.Unmarshal([]byte(body), &containers))
+	decoded, err := specs.decode(url, containers, now)
+	require.NoError(t, err)
+	result := make(map[string]cadvisor.ContainerInfo)
+	for _, container := range decoded {
+		result[container.Name] = container
+	}
+	return result
+}
+
+func TestSpecCache(t *testing.T) {
+	specs := newSpecCache()
+	now := time.Now()
+	first := decodeContainers(t, specs, "kubelet1", `{
+  "/a": {"name": "/a", "spec": {"labels": {"app": "a"}, "image": "a:1"}, "stats": [{"cpu": {"usage": {"total": 1}}}]},
+  "/b": {"name": "/b", "spec": {"labels": {"app": "b"}}},
+  "/c": {"name": "/c"}
+}`, now)
+	require.Len(t, first, 3)
+	assert.Equal(t, "a:1", first["/a"].Spec.Image)
+	assert.Equal(t, uint64(1), first["/a"].Stats[0].Cpu.Usage.Total)
+	assert.Empty(t, first["/c"].Spec.Labels)
+
+	// The unchanged spec isn't decoded again, the replaced container gets its new spec.
+	second := decodeContainers(t, specs, "kubelet1", `{
+  "/a": {"name": "/a", "spec": {"labels": {"app": "a"}, "image": "a:1"}, "stats": [{"cpu": {"usage": {"total": 2}}}]},
+  "/b": {"name": "/b", "spec": {"labels": {"app": "b2"}}},
+  "/c": {"name": "/c"}
+}`, now.Add(time.Minute))
+	assert.Equal(t, reflect.ValueOf(first["/a"].Spec.Labels).Pointer(), reflect.ValueOf(second["/a"].Spec.Labels).Pointer())
+	assert.Equal(t, uint64(2), second["/a"].Stats[0].Cpu.Usage.Total)
+	assert.Equal(t, "b2", second["/b"].Spec.Labels["app"])
+
+	// The specs of the containers gone are forgotten.
+	decodeContainers(t, specs, "kubelet1", `{"/a": {"name": "/a", "spec": {"image": "a:1"}}}`, now.Add(2*time.Minute))
+	assert.Len(t, specs.kubelets["kubelet1"].specs, 1)
+
+	// And those of the Kubelets not scraped anymore.
+	decodeContainers(t, specs, "kubelet2", `{}`, now.Add(specCacheExpiry+3*time.Minute))
+	assert.NotContains(t, specs.kubelets, "kubelet1")
+
+	var containers map[string]rawContainerInfo
+	require.NoError(t, json.Unmarshal([]byte(`{"/a": {"name": "/a", "spec": {"image": 1}}}`), &containers))
+	_, err := specs.decode("kubelet2", containers, now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/golang/glog"
+	kube_api "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// Value of the `type` label of the nodes registered by a virtual kubelet.
+	virtualKubeletNodeType = "virtual-kubelet"
+	// Key of the label or taint holding the provider of a virtual kubelet node.
+	VirtualKubeletProviderKey = "virtual-kubelet.io/provider"
+	// Provider of virtual kubelet nodes not naming one.
+	UnknownVirtualProvider = "unknown"
+)
+
+// GetVirtualProvider returns the provider of a virtual kubelet node, e.g. Azure Container
+// Instances or AWS Fargate, or "" if the node runs a real kubelet.
+func GetVirtualProvider(node *kube_api.Node) string {
+	provider, found := node.Labels[VirtualKubeletProviderKey]
+	if !found && node.Labels["type"] != virtualKubeletNodeType {
+		return ""
+	}
+	if provider != "" {
+		return provider
+	}
+	taints, err := kube_api.GetTaintsFromNodeAnnotations(node.Annotations)
+	if err != nil {
+		glog.Warningf("Failed to read the taints of node %v: %v", node.Name, err)
+	}
+	for _, taint := range taints {
+		if taint.Key == VirtualKubeletProviderKey && taint.Value != "" {
+			return taint.Value
+		}
+	}
+	return UnknownVirtualProvider
+}
+
+// GetSkipVirtualNodes returns whether the virtual kubelet nodes aren't scraped, given by the
+// skipVirtualNodes option of the uri.
+func GetSkipVirtualNodes(uri *url.URL) (bool, error) {
+	opts := uri.Query()
+	if len(opts["skipVirtualNodes"]) == 0 {
+		return false, nil
+	}
+	skip, err := strconv.ParseBool(opts["skipVirtualNodes"][0])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse `skipVirtualNodes` flag - %v", err)
+	}
+	return skip, nil
+}
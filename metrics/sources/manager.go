@@ -16,9 +16,12 @@ package sources
 
 import (
 	"math/rand"
+	"sort"
+	"strings"
 	"time"
 
 	. "k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/util/accounting"
 
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus"
@@ -77,9 +80,29 @@ func (this *sourceManager) Name() string {
 
 func (this *sourceManager) ScrapeMetrics(start, end time.Time) *DataBatch {
 	glog.V(1).Infof("Scraping metrics start: %s, end: %s", start, end)
-	sources := this.metricsSourceProvider.GetMetricsSources()
+	return this.scrapeSources(this.metricsSourceProvider.GetMetricsSources(), start, end)
+}
 
-	responseChannel := make(chan *DataBatch)
+// Scrapes only the sources of the given nodes. The batch is marked out of band.
+func (this *sourceManager) ScrapeNodeMetrics(nodes []string, start, end time.Time) *DataBatch {
+	glog.V(1).Infof("Scraping metrics of nodes %v start: %s, end: %s", nodes, start, end)
+	wanted := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		wanted[node] = true
+	}
+	sources := []MetricsSource{}
+	for _, source := range this.metricsSourceProvider.GetMetricsSources() {
+		if nodeSource, ok := source.(NodeMetricsSource); ok && wanted[nodeSource.NodeName()] {
+			sources = append(sources, source)
+		}
+	}
+	response := this.scrapeSources(sources, start, end)
+	response.OutOfBand = true
+	return response
+}
+
+func (this *sourceManager) scrapeSources(sources []MetricsSource, start, end time.Time) *DataBatch {
+	responseChannel := make(chan *scrapeResult)
 	startTime := time.Now()
 	timeoutTime := startTime.Add(this.metricsScrapeTimeout)
 
@@ -89,8 +112,8 @@ func (this *sourceManager) ScrapeMetrics(start, end time.Time) *DataBatch {
 	}
 
 	for _, source := range sources {
-
-		go func(source MetricsSource, channel chan *DataBatch, start, end, timeoutTime time.Time, delayInMs int) {
+		source := source
+		accounting.DefaultLedger.Go(accounting.SourceOwner(source.Name()), func() {
 
 			// Prevents network congestion.
 			time.Sleep(time.Duration(rand.Intn(delayMs)) * time.Millisecond)
@@ -105,14 +128,14 @@ func (this *sourceManager) ScrapeMetrics(start, end time.Time) *DataBatch {
 			timeForResponse := timeoutTime.Sub(now)
 
 			select {
-			case channel <- metrics:
+			case responseChannel <- &scrapeResult{source: source.Name(), batch: metrics}:
 				// passed the response correctly.
 				return
 			case <-time.After(timeForResponse):
 				glog.Warningf("Failed to send the response back %s", source)
 				return
 			}
-		}(source, responseChannel, start, end, timeoutTime, delayMs)
+		})
 	}
 	response := DataBatch{
 		Timestamp:  end,
@@ -120,6 +143,7 @@ func (this *sourceManager) ScrapeMetrics(start, end time.Time) *DataBatch {
 	}
 
 	latencies := make([]int, 11)
+	results := []*scrapeResult{}
 
 responseloop:
 	for i := range sources {
@@ -130,11 +154,9 @@ responseloop:
 		}
 
 		select {
-		case dataBatch := <-responseChannel:
-			if dataBatch != nil {
-				for key, value := range dataBatch.MetricSets {
-					response.MetricSets[key] = value
-				}
+		case result := <-responseChannel:
+			if result.batch != nil {
+				results = append(results, result)
 			}
 			latency := now.Sub(startTime)
 			bucket := int(latency.Seconds())
@@ -149,6 +171,8 @@ responseloop:
 		}
 	}
 
+	response.MetricSets = mergeResults(results)
+
 	glog.V(1).Infof("ScrapeMetrics: time: %s size: %d", time.Since(startTime), len(response.MetricSets))
 	for i, value := range latencies {
 		glog.V(1).Infof("   scrape  bucket %d: %d", i, value)
@@ -156,6 +180,84 @@ responseloop:
 	return &response
 }
 
+// The batch scraped by a source.
+type scrapeResult struct {
+	source string
+	batch  *DataBatch
+}
+
+// A metric set scraped by a source.
+type sourceMetricSet struct {
+	source string
+	ms     *MetricSet
+}
+
+// Sorts the metric sets with resource metrics first, and then by name of source.
+type byMergeOrder []sourceMetricSet
+
+func (s byMergeOrder) Len() int      { return len(s) }
+func (s byMergeOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byMergeOrder) Less(i, j int) bool {
+	if resource := hasResourceMetrics(s[i].ms); resource != hasResourceMetrics(s[j].ms) {
+		return resource
+	}
+	return s[i].source < s[j].source
+}
+
+// Tells whether the metric set holds metrics other than custom ones, i.e. was scraped by a
+// resource source such as the kubelets rather than from the endpoints of the pods.
+func hasResourceMetrics(ms *MetricSet) bool {
+	for name := range ms.MetricValues {
+		if !strings.HasPrefix(name, CustomMetricPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the metric sets of the batches scraped by the sources. The metric sets scraped by
+// several sources are merged in the same order whichever source answered first, so that the
+// labels, values and times of the resource sources win.
+func mergeResults(results []*scrapeResult) map[string]*MetricSet {
+	sets := map[string][]sourceMetricSet{}
+	for _, result := range results {
+		for key, ms := range result.batch.MetricSets {
+			sets[key] = append(sets[key], sourceMetricSet{source: result.source, ms: ms})
+		}
+	}
+	merged := make(map[string]*MetricSet, len(sets))
+	for key, scraped := range sets {
+		sort.Sort(byMergeOrder(scraped))
+		for _, other := range scraped[1:] {
+			mergeMetricSets(scraped[0].ms, other.ms)
+		}
+		merged[key] = scraped[0].ms
+	}
+	return merged
+}
+
+// Adds the labels and metrics of a metric set scraped by another source, e.g. the custom metrics
+// of a pod scraped from its own endpoint, to the metric set. The values of the metric set win.
+func mergeMetricSets(ms, other *MetricSet) {
+	for key, value := range other.Labels {
+		if _, found := ms.Labels[key]; !found {
+			ms.Labels[key] = value
+		}
+	}
+	for name, value := range other.MetricValues {
+		if _, found := ms.MetricValues[name]; !found {
+			ms.MetricValues[name] = value
+		}
+	}
+	ms.LabeledMetrics = append(ms.LabeledMetrics, other.LabeledMetrics...)
+	if ms.CreateTime.IsZero() {
+		ms.CreateTime = other.CreateTime
+	}
+	if ms.ScrapeTime.IsZero() {
+		ms.ScrapeTime = other.ScrapeTime
+	}
+}
+
 func scrape(s MetricsSource, start, end time.Time) *DataBatch {
 	sourceName := s.Name()
 	startTime := time.Now()
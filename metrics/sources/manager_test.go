@@ -18,6 +18,7 @@ import (
 	"testing"
 	"time"
 
+	"k8s.io/heapster/metrics/core"
 	"k8s.io/heapster/metrics/util"
 )
 
@@ -115,3 +116,127 @@ func TestNoSourcesReplyInTime(t *testing.T) {
 		t.Fatal("s2 found")
 	}
 }
+
+type dummyNodeSource struct {
+	*util.DummyMetricsSource
+	nodeName string
+}
+
+func (this *dummyNodeSource) NodeName() string {
+	return this.nodeName
+}
+
+func TestScrapeNodeMetrics(t *testing.T) {
+	metricsSourceProvider := util.NewDummyMetricsSourceProvider(
+		&dummyNodeSource{util.NewDummyMetricsSource("s1", time.Millisecond), "node1"},
+		&dummyNodeSource{util.NewDummyMetricsSource("s2", time.Millisecond), "node2"},
+		util.NewDummyMetricsSource("s3", time.Millisecond))
+
+	manager, _ := NewSourceManager(metricsSourceProvider, time.Second*3)
+	end := time.Now()
+	dataBatch := manager.(core.NodeScrapingSource).ScrapeNodeMetrics([]string{"node2"}, end.Add(-10*time.Second), end)
+
+	if !dataBatch.OutOfBand {
+		t.Fatal("batch not marked out of band")
+	}
+	if len(dataBatch.MetricSets) != 1 || dataBatch.MetricSets["s2"] == nil {
+		t.Fatalf("expected only s2, got %v", dataBatch.MetricSets)
+	}
+}
+
+func TestMergeMetricSets(t *testing.T) {
+	scrapeTime := time.Now()
+	ms := &core.MetricSet{
+		ScrapeTime: scrapeTime,
+		Labels:     map[string]string{core.LabelPodName.Key: "pod1", core.LabelNodename.Key: "node1"},
+		MetricValues: map[string]core.MetricValue{
+			core.MetricCpuUsage.Name: {ValueType: core.ValueInt64, IntValue: 10},
+		},
+	}
+	other := &core.MetricSet{
+		ScrapeTime: scrapeTime.Add(time.Second),
+		Labels:     map[string]string{core.LabelPodName.Key: "pod1", core.LabelPodId.Key: "uid1"},
+		MetricValues: map[string]core.MetricValue{
+			core.MetricCpuUsage.Name: {ValueType: core.ValueInt64, IntValue: 20},
+			"custom/requests":        {ValueType: core.ValueFloat, FloatValue: 3},
+		},
+		LabeledMetrics: []core.LabeledMetric{{Name: "custom/errors", Labels: map[string]string{"code": "500"}}},
+	}
+	mergeMetricSets(ms, other)
+
+	if ms.Labels[core.LabelNodename.Key] != "node1" || ms.Labels[core.LabelPodId.Key] != "uid1" {
+		t.Fatalf("labels not merged: %v", ms.Labels)
+	}
+	if ms.MetricValues[core.MetricCpuUsage.Name].IntValue != 10 {
+		t.Fatalf("existing value replaced: %v", ms.MetricValues[core.MetricCpuUsage.Name])
+	}
+	if _, found := ms.MetricValues["custom/requests"]; !found {
+		t.Fatal("custom/requests not merged")
+	}
+	if len(ms.LabeledMetrics) != 1 {
+		t.Fatalf("labeled metrics not merged: %v", ms.LabeledMetrics)
+	}
+	if !ms.ScrapeTime.Equal(scrapeTime) {
+		t.Fatalf("scrape time replaced: %v", ms.ScrapeTime)
+	}
+}
+
+func TestMergeResultsOrder(t *testing.T) {
+	createTime := time.Now().Add(-time.Hour)
+	scrapeTime := time.Now()
+	results := func() []*scrapeResult {
+		kubelet := &scrapeResult{source: "kubelet:node1:10255", batch: &core.DataBatch{
+			MetricSets: map[string]*core.MetricSet{"pod1": {
+				CreateTime: createTime,
+				ScrapeTime: scrapeTime,
+				Labels:     map[string]string{core.LabelPodName.Key: "pod1", core.LabelNodename.Key: "node1"},
+				MetricValues: map[string]core.MetricValue{
+					core.MetricCpuUsage.Name: {ValueType: core.ValueInt64, IntValue: 10},
+				},
+			}},
+		}}
+		prometheus := &scrapeResult{source: "prometheus:ns1/pod1", batch: &core.DataBatch{
+			MetricSets: map[string]*core.MetricSet{"pod1": {
+				ScrapeTime: scrapeTime.Add(time.Second),
+				Labels:     map[string]string{core.LabelPodName.Key: "pod1", core.LabelNodename.Key: "other"},
+				MetricValues: map[string]core.MetricValue{
+					"custom/requests": {ValueType: core.ValueFloat, FloatValue: 3},
+				},
+			}},
+		}}
+		appmetrics := &scrapeResult{source: "appmetrics:ns1/pod1", batch: &core.DataBatch{
+			MetricSets: map[string]*core.MetricSet{"pod1": {
+				ScrapeTime: scrapeTime.Add(2 * time.Second),
+				Labels:     map[string]string{core.LabelPodName.Key: "pod1"},
+				MetricValues: map[string]core.MetricValue{
+					"custom/requests": {ValueType: core.ValueFloat, FloatValue: 5},
+				},
+			}},
+		}}
+		return []*scrapeResult{prometheus, kubelet, appmetrics}
+	}
+
+	// The same set is merged whichever source answered first.
+	forward := mergeResults(results())
+	reversed := results()
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	backward := mergeResults(reversed)
+	for _, merged := range []map[string]*core.MetricSet{forward, backward} {
+		ms := merged["pod1"]
+		if !ms.CreateTime.Equal(createTime) || !ms.ScrapeTime.Equal(scrapeTime) {
+			t.Fatalf("times of the resource source replaced: %v %v", ms.CreateTime, ms.ScrapeTime)
+		}
+		if ms.Labels[core.LabelNodename.Key] != "node1" {
+			t.Fatalf("labels of the resource source replaced: %v", ms.Labels)
+		}
+		if ms.MetricValues[core.MetricCpuUsage.Name].IntValue != 10 {
+			t.Fatalf("cpu usage not merged: %v", ms.MetricValues)
+		}
+		// The custom sources are merged by name.
+		if ms.MetricValues["custom/requests"].FloatValue != 5 {
+			t.Fatalf("custom/requests not taken from appmetrics: %v", ms.MetricValues["custom/requests"])
+		}
+	}
+}
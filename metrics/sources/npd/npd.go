@@ -0,0 +1,244 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package npd reads the problems of the nodes reported by the node problem detector, the
+// conditions it sets on the nodes and the events it records, and exports them as node metrics.
+package npd
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	. "k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/kubelet"
+	"k8s.io/heapster/metrics/util"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+// Components of the node problem detector recording the events of the temporary problems.
+var defaultEventSources = []string{"kernel-monitor", "docker-monitor", "systemd-monitor", "abrt-adaptor"}
+
+// Conditions of the nodes set by the Kubelet rather than by the node problem detector.
+var kubeletConditions = map[kube_api.NodeConditionType]bool{
+	kube_api.NodeReady:              true,
+	kube_api.NodeOutOfDisk:          true,
+	kube_api.NodeMemoryPressure:     true,
+	kube_api.NodeDiskPressure:       true,
+	kube_api.NodeNetworkUnavailable: true,
+	"PIDPressure":                   true,
+}
+
+// A source exporting the conditions of the nodes as node/problem, and counting the warning
+// events of the node problem detector as node/problem_events, with the condition type or the
+// event reason as resource id, e.g. KernelDeadlock or KernelOops.
+type problemSource struct {
+	nodeLister *cache.StoreToNodeLister
+	// Events involving the nodes.
+	events cache.Store
+	// Condition types to export, all but the ones of the Kubelet if empty.
+	conditions   map[string]bool
+	eventSources map[string]bool
+
+	lock sync.Mutex
+	// Events counted, by reason, by node.
+	totals map[string]map[string]int64
+	// Count of the events already counted, by uid.
+	counted map[types.UID]int32
+}
+
+func (this *problemSource) Name() string {
+	return this.String()
+}
+
+func (this *problemSource) String() string {
+	return "npd"
+}
+
+func (this *problemSource) ScrapeMetrics(start, end time.Time) *DataBatch {
+	result := &DataBatch{
+		Timestamp:  end,
+		MetricSets: map[string]*MetricSet{},
+	}
+	nodes, err := this.nodeLister.List()
+	if err != nil {
+		glog.Errorf("error while listing nodes: %v", err)
+		return result
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.countEvents()
+	nodeNames := make(map[string]bool, len(nodes.Items))
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		nodeNames[node.Name] = true
+		ms := &MetricSet{
+			CreateTime:     node.CreationTimestamp.Time,
+			ScrapeTime:     end,
+			MetricValues:   map[string]MetricValue{},
+			LabeledMetrics: []LabeledMetric{},
+			Labels: map[string]string{
+				LabelMetricSetType.Key: MetricSetTypeNode,
+				LabelNodename.Key:      node.Name,
+			},
+		}
+		for _, condition := range node.Status.Conditions {
+			if !this.exported(condition.Type) {
+				continue
+			}
+			value := int64(0)
+			if condition.Status == kube_api.ConditionTrue {
+				value = 1
+			}
+			ms.LabeledMetrics = append(ms.LabeledMetrics, problemMetric(&MetricNodeProblem, string(condition.Type), value))
+		}
+		for reason, total := range this.totals[node.Name] {
+			ms.LabeledMetrics = append(ms.LabeledMetrics, problemMetric(&MetricNodeProblemEvents, reason, total))
+		}
+		if len(ms.LabeledMetrics) > 0 {
+			result.MetricSets[NodeKey(node.Name)] = ms
+		}
+	}
+	for node := range this.totals {
+		if !nodeNames[node] {
+			delete(this.totals, node)
+		}
+	}
+	return result
+}
+
+// Returns whether the condition is exported.
+func (this *problemSource) exported(condition kube_api.NodeConditionType) bool {
+	if len(this.conditions) > 0 {
+		return this.conditions[string(condition)]
+	}
+	return !kubeletConditions[condition]
+}
+
+func problemMetric(metric *Metric, problem string, value int64) LabeledMetric {
+	return LabeledMetric{
+		Name:   metric.Name,
+		Labels: map[string]string{LabelResourceID.Key: problem},
+		MetricValue: MetricValue{
+			ValueType:  ValueInt64,
+			MetricType: metric.Type,
+			IntValue:   value,
+		},
+	}
+}
+
+// Adds the occurrences of the warning events of the node problem detector since the last
+// scrape to the totals. The events repeated by the node problem detector have their count
+// increased rather than being recorded again.
+func (this *problemSource) countEvents() {
+	seen := make(map[types.UID]bool)
+	for _, obj := range this.events.List() {
+		event, ok := obj.(*kube_api.Event)
+		if !ok || event.Type != kube_api.EventTypeWarning || event.InvolvedObject.Kind != "Node" ||
+			!this.eventSources[event.Source.Component] {
+			continue
+		}
+		seen[event.UID] = true
+		count := event.Count
+		if count < 1 {
+			count = 1
+		}
+		added := count - this.counted[event.UID]
+		if added <= 0 {
+			continue
+		}
+		this.counted[event.UID] = count
+		node := event.InvolvedObject.Name
+		if this.totals[node] == nil {
+			this.totals[node] = make(map[string]int64)
+		}
+		this.totals[node][event.Reason] += int64(added)
+	}
+	// The events expire after a while.
+	for uid := range this.counted {
+		if !seen[uid] {
+			delete(this.counted, uid)
+		}
+	}
+}
+
+func newProblemSource(nodeLister *cache.StoreToNodeLister, events cache.Store, conditions, eventSources []string) *problemSource {
+	source := &problemSource{
+		nodeLister:   nodeLister,
+		events:       events,
+		conditions:   make(map[string]bool),
+		eventSources: make(map[string]bool),
+		totals:       make(map[string]map[string]int64),
+		counted:      make(map[types.UID]int32),
+	}
+	for _, condition := range conditions {
+		source.conditions[condition] = true
+	}
+	for _, component := range eventSources {
+		source.eventSources[component] = true
+	}
+	return source
+}
+
+// Returns the comma-separated values of the option, or the default ones if it isn't set.
+func listOption(opts url.Values, name string, defaults []string) []string {
+	if len(opts[name]) == 0 {
+		return defaults
+	}
+	result := []string{}
+	for _, value := range strings.Split(opts[name][0], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// NewProblemSource returns the source of the problems of the nodes of the Kubernetes API of the
+// uri, given like the one of the kubernetes source, e.g.
+// npd:https://kubernetes.default?inClusterConfig=true&conditions=KernelDeadlock,ReadonlyFilesystem.
+// The conditions option selects the exported conditions, all but the ones of the Kubelet by
+// default, and the eventSources option the components of the node problem detector whose events
+// are counted.
+func NewProblemSource(uri *url.URL) (MetricsSource, error) {
+	opts := uri.Query()
+	conditions := listOption(opts, "conditions", nil)
+	eventSources := listOption(opts, "eventSources", defaultEventSources)
+
+	kubeConfig, _, err := kubelet.GetKubeConfigs(uri)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient := kube_client.NewOrDie(kubeConfig)
+	nodeSelector, err := kubelet.GetNodeLabelSelector(uri)
+	if err != nil {
+		return nil, err
+	}
+	nodeLister, _, _ := util.GetSelectedNodeLister(kubeClient, nodeSelector)
+	events := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	if len(eventSources) > 0 {
+		lw := cache.NewListWatchFromClient(kubeClient, "events", kube_api.NamespaceAll,
+			fields.OneTermEqualSelector("involvedObject.kind", "Node"))
+		cache.NewReflector(lw, &kube_api.Event{}, events, time.Hour).Run()
+	}
+	return newProblemSource(nodeLister, events, conditions, eventSources), nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package npd
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+func node(name string, conditions ...kube_api.NodeCondition) *kube_api.Node {
+	return &kube_api.Node{
+		ObjectMeta: kube_api.ObjectMeta{Name: name},
+		Status:     kube_api.NodeStatus{Conditions: conditions},
+	}
+}
+
+func event(uid, node, component, reason string, count int32) *kube_api.Event {
+	return &kube_api.Event{
+		ObjectMeta:     kube_api.ObjectMeta{Namespace: "default", Name: uid, UID: types.UID(uid)},
+		InvolvedObject: kube_api.ObjectReference{Kind: "Node", Name: node},
+		Source:         kube_api.EventSource{Component: component},
+		Type:           kube_api.EventTypeWarning,
+		Reason:         reason,
+		Count:          count,
+	}
+}
+
+// Returns the values of the labeled metrics of the metric set, by metric name and resource id.
+func problems(ms *core.MetricSet) map[string]int64 {
+	result := make(map[string]int64)
+	for _, metric := range ms.LabeledMetrics {
+		result[metric.Name+":"+metric.Labels[core.LabelResourceID.Key]] = metric.IntValue
+	}
+	return result
+}
+
+func TestProblemSource(t *testing.T) {
+	nodeLister := &cache.StoreToNodeLister{Store: cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	require.NoError(t, nodeLister.Store.Add(node("node1",
+		kube_api.NodeCondition{Type: kube_api.NodeReady, Status: kube_api.ConditionTrue},
+		kube_api.NodeCondition{Type: "KernelDeadlock", Status: kube_api.ConditionTrue},
+		kube_api.NodeCondition{Type: "ReadonlyFilesystem", Status: kube_api.ConditionFalse},
+	)))
+	require.NoError(t, nodeLister.Store.Add(node("node2",
+		kube_api.NodeCondition{Type: kube_api.NodeReady, Status: kube_api.ConditionTrue},
+	)))
+	events := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, events.Add(event("e1", "node1", "kernel-monitor", "KernelOops", 2)))
+	require.NoError(t, events.Add(event("e2", "node1", "kernel-monitor", "TaskHung", 0)))
+	require.NoError(t, events.Add(event("e3", "node1", "kubelet", "Rebooted", 1)))
+	gone := event("e4", "node3", "kernel-monitor", "KernelOops", 1)
+	require.NoError(t, events.Add(gone))
+
+	source := newProblemSource(nodeLister, events, nil, defaultEventSources)
+	end := time.Now()
+	batch := source.ScrapeMetrics(end.Add(-time.Minute), end)
+	require.Len(t, batch.MetricSets, 1)
+	ms := batch.MetricSets[core.NodeKey("node1")]
+	require.NotNil(t, ms)
+	assert.Equal(t, core.MetricSetTypeNode, ms.Labels[core.LabelMetricSetType.Key])
+	assert.Equal(t, map[string]int64{
+		"node/problem:KernelDeadlock":     1,
+		"node/problem:ReadonlyFilesystem": 0,
+		"node/problem_events:KernelOops":  2,
+		"node/problem_events:TaskHung":    1,
+	}, problems(ms))
+	assert.NotContains(t, source.totals, "node3")
+
+	// The repeated events are counted once more, the expired ones are forgotten.
+	require.NoError(t, events.Update(event("e1", "node1", "kernel-monitor", "KernelOops", 5)))
+	require.NoError(t, events.Delete(event("e2", "node1", "kernel-monitor", "TaskHung", 0)))
+	require.NoError(t, events.Add(event("e5", "node1", "kernel-monitor", "KernelOops", 1)))
+	batch = source.ScrapeMetrics(end, end.Add(time.Minute))
+	values := problems(batch.MetricSets[core.NodeKey("node1")])
+	assert.Equal(t, int64(6), values["node/problem_events:KernelOops"])
+	assert.Equal(t, int64(1), values["node/problem_events:TaskHung"])
+	assert.NotContains(t, source.counted, types.UID("e2"))
+
+	// Only the selected conditions are exported.
+	source = newProblemSource(nodeLister, events, []string{"ReadonlyFilesystem"}, nil)
+	batch = source.ScrapeMetrics(end, end.Add(time.Minute))
+	assert.Equal(t, map[string]int64{"node/problem:ReadonlyFilesystem": 0}, problems(batch.MetricSets[core.NodeKey("node1")]))
+}
+
+func TestListOption(t *testing.T) {
+	opts := url.Values{"conditions": []string{"KernelDeadlock, NTPProblem,"}, "eventSources": []string{""}}
+	assert.Equal(t, []string{"KernelDeadlock", "NTPProblem"}, listOption(opts, "conditions", nil))
+	assert.Empty(t, listOption(opts, "eventSources", defaultEventSources))
+	assert.Equal(t, defaultEventSources, listOption(opts, "other", defaultEventSources))
+}
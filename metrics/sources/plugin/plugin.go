@@ -0,0 +1,226 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin runs external source plugins, which provide metric sets without being built
+// into heapster. A plugin is either an executable run every scrape, which reads a Request as JSON
+// on its standard input and writes a Response as JSON on its standard output, or an http endpoint
+// where agents push their metric sets.
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// Metric types of the plugin metric values.
+	TypeGauge      = "gauge"
+	TypeCumulative = "cumulative"
+)
+
+// Request is written to the standard input of the plugin.
+type Request struct {
+	// Window of the scrape.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Response is read from the standard output of the plugin.
+type Response struct {
+	// Metric sets by key, e.g. `namespace:ns1/pod:pod1` to add metrics to a pod. The metric sets
+	// sharing a key with the ones of the other sources are merged into them.
+	MetricSets map[string]MetricSet `json:"metricSets"`
+}
+
+type MetricSet struct {
+	Labels         map[string]string      `json:"labels,omitempty"`
+	CreateTime     time.Time              `json:"createTime,omitempty"`
+	ScrapeTime     time.Time              `json:"scrapeTime,omitempty"`
+	MetricValues   map[string]MetricValue `json:"metricValues,omitempty"`
+	LabeledMetrics []LabeledMetric        `json:"labeledMetrics,omitempty"`
+}
+
+// MetricValue holds either an integer or a float value.
+type MetricValue struct {
+	// gauge, the default, or cumulative.
+	Type       string   `json:"type,omitempty"`
+	IntValue   *int64   `json:"intValue,omitempty"`
+	FloatValue *float64 `json:"floatValue,omitempty"`
+}
+
+type LabeledMetric struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	MetricValue
+}
+
+// A source running a plugin executable every scrape.
+type execSource struct {
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+func (this *execSource) Name() string {
+	return this.String()
+}
+
+func (this *execSource) String() string {
+	return fmt.Sprintf("exec:%s", this.command)
+}
+
+func (this *execSource) ScrapeMetrics(start, end time.Time) *core.DataBatch {
+	result := &core.DataBatch{
+		Timestamp:  end,
+		MetricSets: map[string]*core.MetricSet{},
+	}
+	response, err := this.run(&Request{Start: start, End: end})
+	if err != nil {
+		glog.Errorf("Failed to run source plugin %s: %v", this.command, err)
+		return result
+	}
+	for key, ms := range response.MetricSets {
+		metricSet, err := convertMetricSet(&ms)
+		if err != nil {
+			glog.Errorf("Skipping metric set %s of source plugin %s: %v", key, this.command, err)
+			continue
+		}
+		result.MetricSets[key] = metricSet
+	}
+	return result
+}
+
+// Runs the plugin, killing it after the timeout.
+func (this *execSource) run(request *Request) (*Response, error) {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(this.command, this.args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	// The children of the plugin may keep its output open after it's killed, so the scrape
+	// doesn't wait for them.
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(this.timeout):
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("timed out after %v", this.timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v, stderr: %q", err, stderr.String())
+	}
+	response := &Response{}
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return nil, fmt.Errorf("failed to parse output - %v", err)
+	}
+	return response, nil
+}
+
+// Returns the metric set of the response as a heapster metric set.
+func convertMetricSet(ms *MetricSet) (*core.MetricSet, error) {
+	result := &core.MetricSet{
+		Labels:         ms.Labels,
+		CreateTime:     ms.CreateTime,
+		ScrapeTime:     ms.ScrapeTime,
+		MetricValues:   make(map[string]core.MetricValue, len(ms.MetricValues)),
+		LabeledMetrics: make([]core.LabeledMetric, 0, len(ms.LabeledMetrics)),
+	}
+	if result.Labels == nil {
+		result.Labels = make(map[string]string)
+	}
+	for name, value := range ms.MetricValues {
+		metricValue, err := convertMetricValue(&value)
+		if err != nil {
+			return nil, fmt.Errorf("metric %s: %v", name, err)
+		}
+		result.MetricValues[name] = metricValue
+	}
+	for _, metric := range ms.LabeledMetrics {
+		metricValue, err := convertMetricValue(&metric.MetricValue)
+		if err != nil {
+			return nil, fmt.Errorf("labeled metric %s: %v", metric.Name, err)
+		}
+		result.LabeledMetrics = append(result.LabeledMetrics, core.LabeledMetric{
+			Name:        metric.Name,
+			Labels:      metric.Labels,
+			MetricValue: metricValue,
+		})
+	}
+	return result, nil
+}
+
+func convertMetricValue(value *MetricValue) (core.MetricValue, error) {
+	result := core.MetricValue{}
+	switch value.Type {
+	case "", TypeGauge:
+		result.MetricType = core.MetricGauge
+	case TypeCumulative:
+		result.MetricType = core.MetricCumulative
+	default:
+		return result, fmt.Errorf("unknown type %q", value.Type)
+	}
+	switch {
+	case value.IntValue != nil && value.FloatValue == nil:
+		result.ValueType = core.ValueInt64
+		result.IntValue = *value.IntValue
+	case value.FloatValue != nil && value.IntValue == nil:
+		result.ValueType = core.ValueFloat
+		result.FloatValue = float32(*value.FloatValue)
+	default:
+		return result, fmt.Errorf("exactly one of intValue and floatValue must be set")
+	}
+	return result, nil
+}
+
+// NewExecSource returns the source running the plugin executable at the path of the uri, like
+// exec:/usr/local/bin/plugin?arg=--verbose&timeout=5s, with the arguments given by its arg
+// options.
+func NewExecSource(uri *url.URL) (core.MetricsSource, error) {
+	if uri.Path == "" {
+		return nil, fmt.Errorf("the path of the source plugin executable is required")
+	}
+	opts := uri.Query()
+	source := &execSource{
+		command: uri.Path,
+		args:    opts["arg"],
+		timeout: defaultTimeout,
+	}
+	if len(opts["timeout"]) >= 1 {
+		timeout, err := time.ParseDuration(opts["timeout"][0])
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("failed to parse `timeout` flag - %q should be a positive duration", opts["timeout"][0])
+		}
+		source.timeout = timeout
+	}
+	return source, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+// Writes a plugin executable running the shell script, and returns its path.
+func writePlugin(t *testing.T, dir, script string) string {
+	path := filepath.Join(dir, "plugin")
+	require.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755))
+	return path
+}
+
+func TestExecSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The plugin echoes the end of the window from its request as a label.
+	path := writePlugin(t, dir, `
+end=$(sed 's/.*"end":"\([^"]*\)".*/\1/')
+cat <<JSON
+{"metricSets": {
+  "namespace:ns1/pod:pod1": {
+    "labels": {"end": "$end", "flag": "$1"},
+    "metricValues": {
+      "custom/queue_length": {"intValue": 12},
+      "custom/requests": {"type": "cumulative", "floatValue": 1.5}
+    },
+    "labeledMetrics": [{"name": "custom/errors", "labels": {"code": "500"}, "intValue": 3}]
+  },
+  "namespace:ns1/pod:bad": {
+    "metricValues": {"custom/both": {"intValue": 1, "floatValue": 1}}
+  }
+}}
+JSON
+`)
+	source, err := NewExecSource(&url.URL{Path: path, RawQuery: "arg=--verbose"})
+	require.NoError(t, err)
+	assert.Equal(t, "exec:"+path, source.Name())
+
+	end := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	batch := source.ScrapeMetrics(end.Add(-time.Minute), end)
+	assert.Equal(t, end, batch.Timestamp)
+	require.Len(t, batch.MetricSets, 1)
+	ms := batch.MetricSets[core.PodKey("ns1", "pod1")]
+	require.NotNil(t, ms)
+	assert.Equal(t, "2016-10-01T12:00:00Z", ms.Labels["end"])
+	assert.Equal(t, "--verbose", ms.Labels["flag"])
+	assert.Equal(t, core.MetricValue{ValueType: core.ValueInt64, MetricType: core.MetricGauge, IntValue: 12},
+		ms.MetricValues["custom/queue_length"])
+	assert.Equal(t, core.MetricValue{ValueType: core.ValueFloat, MetricType: core.MetricCumulative, FloatValue: 1.5},
+		ms.MetricValues["custom/requests"])
+	require.Len(t, ms.LabeledMetrics, 1)
+	assert.Equal(t, "500", ms.LabeledMetrics[0].Labels["code"])
+	assert.Equal(t, int64(3), ms.LabeledMetrics[0].IntValue)
+}
+
+func TestExecSourceFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, script := range []string{"exit 1", "echo not json", "sleep 5"} {
+		path := writePlugin(t, dir, script)
+		source, err := NewExecSource(&url.URL{Path: path, RawQuery: "timeout=100ms"})
+		require.NoError(t, err)
+		startTime := time.Now()
+		batch := source.ScrapeMetrics(time.Now(), time.Now())
+		assert.Empty(t, batch.MetricSets, script)
+		assert.True(t, time.Since(startTime) < 5*time.Second, script)
+	}
+
+	for _, query := range []string{"timeout=0s", "timeout=soon"} {
+		_, err := NewExecSource(&url.URL{Path: "/bin/true", RawQuery: query})
+		assert.Error(t, err, query)
+	}
+	_, err = NewExecSource(&url.URL{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,381 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+const (
+	DefaultPushPath = "/api/v1/push"
+	// Largest request body accepted.
+	maxPushBytes = 10 << 20
+	// Metric sets kept between two scrapes, above which the pushes are rejected.
+	maxPushedMetricSets = 10000
+)
+
+// PushSource receives the metric sets posted by agents and jobs on its http endpoint, and
+// returns them on the next scrape. The requests are either a Response as JSON, or points in
+// the InfluxDB line protocol.
+type PushSource struct {
+	path  string
+	token string
+
+	lock       sync.Mutex
+	metricSets map[string]*core.MetricSet
+}
+
+func (this *PushSource) Name() string {
+	return this.String()
+}
+
+func (this *PushSource) String() string {
+	return fmt.Sprintf("push:%s", this.path)
+}
+
+func (this *PushSource) HttpPath() string {
+	return this.path
+}
+
+// ScrapeMetrics returns the metric sets pushed since the last scrape.
+func (this *PushSource) ScrapeMetrics(start, end time.Time) *core.DataBatch {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	result := &core.DataBatch{
+		Timestamp:  end,
+		MetricSets: this.metricSets,
+	}
+	this.metricSets = make(map[string]*core.MetricSet)
+	return result
+}
+
+func (this *PushSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+this.token)) != 1 {
+		http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPushBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body - %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var metricSets map[string]*core.MetricSet
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		metricSets, err = decodeJSON(body)
+	} else {
+		metricSets, err = decodeLines(string(body), time.Now())
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := this.add(metricSets); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Merges the metric sets into the ones pushed since the last scrape. The later values of a
+// metric replace the earlier ones.
+func (this *PushSource) add(metricSets map[string]*core.MetricSet) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	added := 0
+	for key := range metricSets {
+		if _, found := this.metricSets[key]; !found {
+			added++
+		}
+	}
+	if len(this.metricSets)+added > maxPushedMetricSets {
+		return fmt.Errorf("too many metric sets pushed since the last scrape, at most %d", maxPushedMetricSets)
+	}
+	for key, ms := range metricSets {
+		current, found := this.metricSets[key]
+		if !found {
+			this.metricSets[key] = ms
+			continue
+		}
+		for k, v := range ms.Labels {
+			current.Labels[k] = v
+		}
+		for name, value := range ms.MetricValues {
+			current.MetricValues[name] = value
+		}
+		current.LabeledMetrics = mergeLabeledMetrics(current.LabeledMetrics, ms.LabeledMetrics)
+		if ms.ScrapeTime.After(current.ScrapeTime) {
+			current.ScrapeTime = ms.ScrapeTime
+		}
+	}
+	glog.V(4).Infof("Received %d metric sets on %s", len(metricSets), this.path)
+	return nil
+}
+
+// Returns the labeled metrics with the added ones, replacing those with the same name and
+// labels.
+func mergeLabeledMetrics(metrics, added []core.LabeledMetric) []core.LabeledMetric {
+	for _, metric := range added {
+		replaced := false
+		for i := range metrics {
+			if metrics[i].Name == metric.Name && sameLabels(metrics[i].Labels, metric.Labels) {
+				metrics[i] = metric
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
+
+func sameLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if value, found := b[k]; !found || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Decodes a Response, keyed like the responses of the exec plugins.
+func decodeJSON(body []byte) (map[string]*core.MetricSet, error) {
+	response := &Response{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, fmt.Errorf("failed to parse request body - %v", err)
+	}
+	result := make(map[string]*core.MetricSet, len(response.MetricSets))
+	for key, ms := range response.MetricSets {
+		metricSet, err := convertMetricSet(&ms)
+		if err != nil {
+			return nil, fmt.Errorf("metric set %s: %v", key, err)
+		}
+		if metricSet.ScrapeTime.IsZero() {
+			metricSet.ScrapeTime = time.Now()
+		}
+		result[key] = metricSet
+	}
+	return result, nil
+}
+
+// Decodes lines of the InfluxDB line protocol: `measurement,tag=value field=value timestamp`,
+// without escaped spaces or commas. The entity tags select the metric set of the points, and
+// their other tags become the labels of labeled metrics. The field named value is the metric
+// of the measurement, the other fields are metrics named measurement/field. All the metrics are
+// custom gauges, integers if their value ends with i. The timestamps are in nanoseconds, and
+// default to now.
+func decodeLines(body string, now time.Time) (map[string]*core.MetricSet, error) {
+	result := make(map[string]*core.MetricSet)
+	for i, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := decodeLine(result, line, now); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return result, nil
+}
+
+func decodeLine(metricSets map[string]*core.MetricSet, line string, now time.Time) error {
+	parts := strings.Fields(line)
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("expected a measurement, fields and an optional timestamp")
+	}
+	scrapeTime := now
+	if len(parts) == 3 {
+		nanos, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", parts[2])
+		}
+		scrapeTime = time.Unix(0, nanos)
+	}
+
+	tags := strings.Split(parts[0], ",")
+	measurement := tags[0]
+	if measurement == "" {
+		return fmt.Errorf("missing measurement")
+	}
+	if !strings.HasPrefix(measurement, core.CustomMetricPrefix) {
+		measurement = core.CustomMetricPrefix + measurement
+	}
+	entityLabels := make(map[string]string)
+	metricLabels := make(map[string]string)
+	for _, tag := range tags[1:] {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+		if entityTags[kv[0]] {
+			entityLabels[kv[0]] = kv[1]
+		} else {
+			metricLabels[kv[0]] = kv[1]
+		}
+	}
+	key, err := entityKey(entityLabels)
+	if err != nil {
+		return err
+	}
+
+	ms, found := metricSets[key]
+	if !found {
+		ms = &core.MetricSet{
+			Labels:         entityLabels,
+			MetricValues:   map[string]core.MetricValue{},
+			LabeledMetrics: []core.LabeledMetric{},
+		}
+		metricSets[key] = ms
+	}
+	if scrapeTime.After(ms.ScrapeTime) {
+		ms.ScrapeTime = scrapeTime
+	}
+	for _, field := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid field %q", field)
+		}
+		name := measurement
+		if kv[0] != "value" {
+			name = measurement + "/" + kv[0]
+		}
+		value, err := parseFieldValue(kv[1])
+		if err != nil {
+			return fmt.Errorf("field %s: %v", kv[0], err)
+		}
+		if len(metricLabels) == 0 {
+			ms.MetricValues[name] = value
+			continue
+		}
+		ms.LabeledMetrics = mergeLabeledMetrics(ms.LabeledMetrics, []core.LabeledMetric{{
+			Name:        name,
+			Labels:      metricLabels,
+			MetricValue: value,
+		}})
+	}
+	return nil
+}
+
+func parseFieldValue(value string) (core.MetricValue, error) {
+	result := core.MetricValue{MetricType: core.MetricGauge}
+	if strings.HasSuffix(value, "i") {
+		intValue, err := strconv.ParseInt(strings.TrimSuffix(value, "i"), 10, 64)
+		if err != nil {
+			return result, fmt.Errorf("invalid integer %q", value)
+		}
+		result.ValueType = core.ValueInt64
+		result.IntValue = intValue
+		return result, nil
+	}
+	floatValue, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return result, fmt.Errorf("invalid float %q", value)
+	}
+	result.ValueType = core.ValueFloat
+	result.FloatValue = float32(floatValue)
+	return result, nil
+}
+
+// Tags of the points identifying the entity of their metric set.
+var entityTags = map[string]bool{
+	core.LabelNamespaceName.Key: true,
+	core.LabelPodName.Key:       true,
+	core.LabelContainerName.Key: true,
+	core.LabelNodename.Key:      true,
+	core.LabelCronJobName.Key:   true,
+}
+
+// Returns the key of the metric set of the entity tags, and sets its type and the labels
+// expected of that type. The points without entity tags go to the cluster.
+func entityKey(labels map[string]string) (string, error) {
+	namespace := labels[core.LabelNamespaceName.Key]
+	pod := labels[core.LabelPodName.Key]
+	container := labels[core.LabelContainerName.Key]
+	node := labels[core.LabelNodename.Key]
+	cronJob := labels[core.LabelCronJobName.Key]
+	switch {
+	case pod != "" && namespace == "", cronJob != "" && namespace == "":
+		return "", fmt.Errorf("%s is required with %s and %s", core.LabelNamespaceName.Key, core.LabelPodName.Key, core.LabelCronJobName.Key)
+	case pod != "" && container != "":
+		labels[core.LabelMetricSetType.Key] = core.MetricSetTypePodContainer
+		labels[core.LabelPodNamespace.Key] = namespace
+		return core.PodContainerKey(namespace, pod, container), nil
+	case pod != "":
+		labels[core.LabelMetricSetType.Key] = core.MetricSetTypePod
+		labels[core.LabelPodNamespace.Key] = namespace
+		return core.PodKey(namespace, pod), nil
+	case cronJob != "":
+		labels[core.LabelMetricSetType.Key] = core.MetricSetTypeCronJob
+		return core.CronJobKey(namespace, cronJob), nil
+	case node != "" && container != "":
+		labels[core.LabelMetricSetType.Key] = core.MetricSetTypeSystemContainer
+		return core.NodeContainerKey(node, container), nil
+	case node != "":
+		labels[core.LabelMetricSetType.Key] = core.MetricSetTypeNode
+		return core.NodeKey(node), nil
+	case container != "":
+		return "", fmt.Errorf("%s requires %s or %s", core.LabelContainerName.Key, core.LabelPodName.Key, core.LabelNodename.Key)
+	case namespace != "":
+		labels[core.LabelMetricSetType.Key] = core.MetricSetTypeNamespace
+		return core.NamespaceKey(namespace), nil
+	default:
+		labels[core.LabelMetricSetType.Key] = core.MetricSetTypeCluster
+		return core.ClusterKey(), nil
+	}
+}
+
+// NewPushSource returns the source receiving the pushed metric sets on the path of the uri,
+// /api/v1/push if empty, like push:/api/v1/push?token=secret. The pushes must send the token
+// as a bearer token.
+func NewPushSource(uri *url.URL) (*PushSource, error) {
+	opts := uri.Query()
+	if len(opts["token"]) == 0 || opts["token"][0] == "" {
+		return nil, fmt.Errorf("the `token` flag of the push source is required")
+	}
+	path := uri.Path
+	if path == "" {
+		path = DefaultPushPath
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("the path of the push source should be absolute, got %q", path)
+	}
+	return &PushSource{
+		path:       path,
+		token:      opts["token"][0],
+		metricSets: make(map[string]*core.MetricSet),
+	}, nil
+}
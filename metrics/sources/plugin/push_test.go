@@ -0,0 +1,126 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+)
+
+func push(source *PushSource, token, contentType, body string) int {
+	req, _ := http.NewRequest("POST", source.HttpPath(), strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	source.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestPushSource(t *testing.T) {
+	source, err := NewPushSource(&url.URL{RawQuery: "token=secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "push:/api/v1/push", source.Name())
+
+	assert.Equal(t, http.StatusUnauthorized, push(source, "", "text/plain", "jobs value=1i"))
+	assert.Equal(t, http.StatusUnauthorized, push(source, "wrong", "text/plain", "jobs value=1i"))
+	assert.Equal(t, http.StatusBadRequest, push(source, "secret", "text/plain", "jobs value=x"))
+
+	assert.Equal(t, http.StatusNoContent, push(source, "secret", "text/plain", `
+# Batch job progress.
+batch_records,namespace_name=ns1,pod_name=job-0 value=100i,failed=2i 1475323200000000000
+batch_duration,namespace_name=ns1,pod_name=job-0,stage=load value=1.5
+queue_length value=7i
+`))
+	assert.Equal(t, http.StatusNoContent, push(source, "secret", "application/json", `{"metricSets": {
+  "namespace:ns1/pod:job-0": {"metricValues": {"custom/batch_records": {"intValue": 120}}}
+}}`))
+
+	end := time.Date(2016, 10, 1, 12, 1, 0, 0, time.UTC)
+	batch := source.ScrapeMetrics(end.Add(-time.Minute), end)
+	assert.Equal(t, end, batch.Timestamp)
+	require.Len(t, batch.MetricSets, 2)
+
+	pod := batch.MetricSets[core.PodKey("ns1", "job-0")]
+	require.NotNil(t, pod)
+	assert.Equal(t, core.MetricSetTypePod, pod.Labels[core.LabelMetricSetType.Key])
+	assert.Equal(t, "ns1", pod.Labels[core.LabelPodNamespace.Key])
+	assert.Equal(t, int64(120), pod.MetricValues["custom/batch_records"].IntValue)
+	assert.Equal(t, int64(2), pod.MetricValues["custom/batch_records/failed"].IntValue)
+	require.Len(t, pod.LabeledMetrics, 1)
+	assert.Equal(t, "custom/batch_duration", pod.LabeledMetrics[0].Name)
+	assert.Equal(t, map[string]string{"stage": "load"}, pod.LabeledMetrics[0].Labels)
+	assert.Equal(t, core.MetricValue{ValueType: core.ValueFloat, MetricType: core.MetricGauge, FloatValue: 1.5},
+		pod.LabeledMetrics[0].MetricValue)
+
+	cluster := batch.MetricSets[core.ClusterKey()]
+	require.NotNil(t, cluster)
+	assert.Equal(t, int64(7), cluster.MetricValues["custom/queue_length"].IntValue)
+
+	// The pushed metric sets are returned once.
+	assert.Empty(t, source.ScrapeMetrics(end, end.Add(time.Minute)).MetricSets)
+}
+
+func TestDecodeLinesEntities(t *testing.T) {
+	now := time.Now()
+	metricSets, err := decodeLines(`
+a,namespace_name=ns1,pod_name=p1,container_name=c1 value=1
+b,nodename=n1,container_name=kubelet value=1
+c,nodename=n1 value=1
+d,namespace_name=ns1,cronjob_name=nightly value=1
+e,namespace_name=ns1 value=1
+`, now)
+	require.NoError(t, err)
+	for key, typ := range map[string]string{
+		core.PodContainerKey("ns1", "p1", "c1"): core.MetricSetTypePodContainer,
+		core.NodeContainerKey("n1", "kubelet"):  core.MetricSetTypeSystemContainer,
+		core.NodeKey("n1"):                      core.MetricSetTypeNode,
+		core.CronJobKey("ns1", "nightly"):       core.MetricSetTypeCronJob,
+		core.NamespaceKey("ns1"):                core.MetricSetTypeNamespace,
+	} {
+		require.NotNil(t, metricSets[key], key)
+		assert.Equal(t, typ, metricSets[key].Labels[core.LabelMetricSetType.Key], key)
+		assert.Equal(t, now, metricSets[key].ScrapeTime, key)
+	}
+
+	for _, line := range []string{
+		"a,pod_name=p1 value=1",
+		"a,container_name=c1 value=1",
+		"a value=1 yesterday",
+		"a,namespace_name value=1",
+		"a",
+	} {
+		_, err := decodeLines(line, now)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestNewPushSource(t *testing.T) {
+	_, err := NewPushSource(&url.URL{})
+	assert.Error(t, err)
+	source, err := NewPushSource(&url.URL{Path: "/push/jobs", RawQuery: "token=secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "/push/jobs", source.HttpPath())
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"fmt"
+
+	"k8s.io/heapster/common/flags"
+	. "k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/npd"
+	"k8s.io/heapster/metrics/sources/plugin"
+	"k8s.io/heapster/metrics/sources/statsd"
+	"k8s.io/heapster/metrics/sources/workload"
+)
+
+// Adds the sources of the external plugins to the sources of the provider.
+type pluginProvider struct {
+	provider MetricsSourceProvider
+	plugins  []MetricsSource
+}
+
+func (this *pluginProvider) GetMetricsSources() []MetricsSource {
+	return append(this.provider.GetMetricsSources(), this.plugins...)
+}
+
+func (this *SourceFactory) buildPlugin(uri flags.Uri) (MetricsSource, error) {
+	switch uri.Key {
+	case "exec":
+		return plugin.NewExecSource(&uri.Val)
+	case "push":
+		return plugin.NewPushSource(&uri.Val)
+	case "statsd":
+		return statsd.NewStatsdSource(&uri.Val)
+	case "npd":
+		return npd.NewProblemSource(&uri.Val)
+	case "workloads":
+		return workload.NewWorkloadSource(&uri.Val)
+	default:
+		return nil, fmt.Errorf("Source plugin not recognized: %s", uri.Key)
+	}
+}
+
+// BuildPlugins adds the sources of the external plugins given by the uris to the sources of
+// the provider, or returns it as is if there are none.
+func (this *SourceFactory) BuildPlugins(provider MetricsSourceProvider, uris flags.Uris) (MetricsSourceProvider, error) {
+	if len(uris) == 0 {
+		return provider, nil
+	}
+	result := &pluginProvider{provider: provider}
+	for _, uri := range uris {
+		source, err := this.buildPlugin(uri)
+		if err != nil {
+			return nil, err
+		}
+		result.plugins = append(result.plugins, source)
+	}
+	return result, nil
+}
+
+// HttpSources returns the source plugins of the provider receiving their metrics on an http
+// endpoint, which need to be served.
+func HttpSources(provider MetricsSourceProvider) []HttpSource {
+	result := []HttpSource{}
+	plugins, ok := provider.(*pluginProvider)
+	if !ok {
+		return result
+	}
+	for _, source := range plugins.plugins {
+		if httpSource, ok := source.(HttpSource); ok {
+			result = append(result, httpSource)
+		}
+	}
+	return result
+}
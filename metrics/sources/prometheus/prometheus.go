@@ -0,0 +1,187 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prometheus scrapes the Prometheus endpoints of the annotated pods, and attaches the
+// selected series to the metric sets of the pods as custom metrics.
+package prometheus
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	. "k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/annotated"
+	"k8s.io/heapster/metrics/sources/kubelet"
+	"k8s.io/heapster/metrics/util"
+	"k8s.io/heapster/metrics/util/accounting"
+	"k8s.io/kubernetes/pkg/client/cache"
+	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+const (
+	// Annotations of the pods to scrape, as understood by the Prometheus Kubernetes configurations.
+	ScrapeAnnotation = "prometheus.io/scrape"
+	PortAnnotation   = "prometheus.io/port"
+	PathAnnotation   = "prometheus.io/path"
+	SchemeAnnotation = "prometheus.io/scheme"
+
+	defaultPath = "/metrics"
+	// Time allowed to a pod to return its metrics.
+	scrapeTimeout = 10 * time.Second
+)
+
+// A source scraping the Prometheus endpoint of a pod.
+type podSource struct {
+	annotated.Pod
+	client *http.Client
+	// Series to keep.
+	series *regexp.Regexp
+}
+
+func (this *podSource) Name() string {
+	return this.String()
+}
+
+func (this *podSource) String() string {
+	return fmt.Sprintf("prometheus:%s/%s", this.Namespace, this.PodName)
+}
+
+func (this *podSource) ScrapeMetrics(start, end time.Time) *DataBatch {
+	result := &DataBatch{
+		Timestamp:  end,
+		MetricSets: map[string]*MetricSet{},
+	}
+	families, err := this.scrape()
+	if err != nil {
+		glog.Errorf("Failed to scrape the Prometheus metrics of pod %s/%s from %s: %v", this.Namespace, this.PodName, this.URL, err)
+		return result
+	}
+	ms := this.NewMetricSet()
+	for name, family := range families {
+		if !this.series.MatchString(name) {
+			continue
+		}
+		decodeFamily(ms, family)
+	}
+	result.MetricSets[this.Key()] = ms
+	return result
+}
+
+func (this *podSource) scrape() (map[string]*dto.MetricFamily, error) {
+	resp, err := this.Get(this.client, string(expfmt.FmtText))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	parser := expfmt.TextParser{}
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// Adds the counters, gauges and untyped series of the family to the metric set, as custom
+// metrics. The series with labels are added as labeled metrics. Summaries and histograms are
+// left out, as their quantiles and buckets don't map to single values.
+func decodeFamily(ms *MetricSet, family *dto.MetricFamily) {
+	name := CustomMetricPrefix + family.GetName()
+	for _, metric := range family.Metric {
+		value := MetricValue{ValueType: ValueFloat}
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			value.MetricType = MetricCumulative
+			value.FloatValue = float32(metric.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			value.MetricType = MetricGauge
+			value.FloatValue = float32(metric.GetGauge().GetValue())
+		case dto.MetricType_UNTYPED:
+			value.MetricType = MetricGauge
+			value.FloatValue = float32(metric.GetUntyped().GetValue())
+		default:
+			glog.V(4).Infof("Skipping %s: unsupported Prometheus metric type %v", family.GetName(), family.GetType())
+			return
+		}
+		if len(metric.Label) == 0 {
+			ms.MetricValues[name] = value
+			continue
+		}
+		labels := make(map[string]string, len(metric.Label))
+		for _, label := range metric.Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		ms.LabeledMetrics = append(ms.LabeledMetrics, LabeledMetric{
+			Name:        name,
+			Labels:      labels,
+			MetricValue: value,
+		})
+	}
+}
+
+// The endpoint of the pods annotated with prometheus.io/scrape=true.
+var endpoint = annotated.Endpoint{
+	Enable:      ScrapeAnnotation,
+	Path:        PathAnnotation,
+	DefaultPath: defaultPath,
+	Port:        PortAnnotation,
+	Scheme:      SchemeAnnotation,
+}
+
+// Adds a source for every running pod annotated with prometheus.io/scrape=true to the sources
+// of the provider.
+func newPrometheusProvider(provider MetricsSourceProvider, podLister *cache.StoreToPodLister, client *http.Client, series *regexp.Regexp) MetricsSourceProvider {
+	return annotated.NewProvider(provider, podLister, endpoint, func(pod annotated.Pod) MetricsSource {
+		return &podSource{Pod: pod, client: client, series: series}
+	})
+}
+
+// NewPrometheusProvider adds the sources scraping the annotated pods to the sources of the
+// provider, if the prometheusScrape option of the kubernetes source uri is set. Otherwise it
+// returns the provider as is.
+func NewPrometheusProvider(provider MetricsSourceProvider, uri *url.URL) (MetricsSourceProvider, error) {
+	opts := uri.Query()
+	if len(opts["prometheusScrape"]) == 0 {
+		return provider, nil
+	}
+	scrape, err := strconv.ParseBool(opts["prometheusScrape"][0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse `prometheusScrape` flag - %v", err)
+	}
+	if !scrape {
+		return provider, nil
+	}
+	series := regexp.MustCompile("")
+	if len(opts["prometheusSeries"]) >= 1 {
+		series, err = regexp.Compile("^(?:" + opts["prometheusSeries"][0] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `prometheusSeries` flag - %v", err)
+		}
+	}
+
+	kubeConfig, _, err := kubelet.GetKubeConfigs(uri)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient := kube_client.NewOrDie(kubeConfig)
+	podLister, _, _ := util.GetPodLister(kubeClient)
+	client := &http.Client{
+		Transport: &http.Transport{Dial: accounting.DefaultLedger.Dial(accounting.SourceOwner("prometheus"), nil)},
+		Timeout:   scrapeTimeout,
+	}
+	return newPrometheusProvider(provider, podLister, client, series), nil
+}
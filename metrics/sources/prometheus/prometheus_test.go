@@ -0,0 +1,168 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/annotated"
+	"k8s.io/heapster/metrics/util"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+const exposition = `# TYPE http_requests_total counter
+http_requests_total{code="200"} 1027
+http_requests_total{code="500"} 3
+# TYPE queue_length gauge
+queue_length 12
+# TYPE go_goroutines gauge
+go_goroutines 40
+# TYPE request_duration_seconds summary
+request_duration_seconds{quantile="0.5"} 0.2
+request_duration_seconds_sum 10
+request_duration_seconds_count 50
+`
+
+func annotatedPod(name string, annotations map[string]string) *kube_api.Pod {
+	return &kube_api.Pod{
+		ObjectMeta: kube_api.ObjectMeta{
+			Name:        name,
+			Namespace:   "ns1",
+			UID:         types.UID("uid-" + name),
+			Annotations: annotations,
+		},
+		Spec: kube_api.PodSpec{
+			NodeName: "node1",
+			Containers: []kube_api.Container{{
+				Ports: []kube_api.ContainerPort{{ContainerPort: 8080}},
+			}},
+		},
+		Status: kube_api.PodStatus{
+			Phase: kube_api.PodRunning,
+			PodIP: "10.0.0.1",
+		},
+	}
+}
+
+func TestScrapeUrl(t *testing.T) {
+	for _, test := range []struct {
+		annotations map[string]string
+		url         string
+	}{
+		{nil, ""},
+		{map[string]string{ScrapeAnnotation: "false"}, ""},
+		{map[string]string{ScrapeAnnotation: "true"}, "http://10.0.0.1:8080/metrics"},
+		{map[string]string{ScrapeAnnotation: "true", PortAnnotation: "9102", PathAnnotation: "/stats",
+			SchemeAnnotation: "https"}, "https://10.0.0.1:9102/stats"},
+	} {
+		u, found := endpoint.URL(annotatedPod("pod1", test.annotations))
+		assert.Equal(t, test.url != "", found, "%v", test.annotations)
+		assert.Equal(t, test.url, u, "%v", test.annotations)
+	}
+
+	pending := annotatedPod("pod1", map[string]string{ScrapeAnnotation: "true"})
+	pending.Status.Phase = kube_api.PodPending
+	_, found := endpoint.URL(pending)
+	assert.False(t, found)
+
+	noPort := annotatedPod("pod1", map[string]string{ScrapeAnnotation: "true"})
+	noPort.Spec.Containers = nil
+	_, found = endpoint.URL(noPort)
+	assert.False(t, found)
+}
+
+func TestScrapePod(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(exposition))
+	}))
+	defer server.Close()
+
+	source := &podSource{
+		Pod: annotated.Pod{
+			Namespace: "ns1",
+			PodName:   "pod1",
+			URL:       server.URL,
+			Labels: map[string]string{
+				core.LabelMetricSetType.Key: core.MetricSetTypePod,
+				core.LabelNodename.Key:      "node1",
+			},
+		},
+		client: http.DefaultClient,
+		series: regexp.MustCompile("^(?:http_.*|queue_length|request_duration_seconds)$"),
+	}
+	assert.Equal(t, "node1", source.NodeName())
+	batch := source.ScrapeMetrics(time.Now(), time.Now())
+	ms := batch.MetricSets[core.PodKey("ns1", "pod1")]
+	require.NotNil(t, ms)
+	assert.Equal(t, core.MetricSetTypePod, ms.Labels[core.LabelMetricSetType.Key])
+
+	// Only the selected series, without the summaries.
+	require.Len(t, ms.MetricValues, 1)
+	assert.Equal(t, core.MetricValue{ValueType: core.ValueFloat, MetricType: core.MetricGauge, FloatValue: 12},
+		ms.MetricValues["custom/queue_length"])
+	require.Len(t, ms.LabeledMetrics, 2)
+	for _, metric := range ms.LabeledMetrics {
+		assert.Equal(t, "custom/http_requests_total", metric.Name)
+		assert.Equal(t, core.MetricCumulative, metric.MetricType)
+		if metric.Labels["code"] == "500" {
+			assert.Equal(t, float32(3), metric.FloatValue)
+		} else {
+			assert.Equal(t, float32(1027), metric.FloatValue)
+		}
+	}
+
+	// A failed scrape returns no metric set.
+	server.Close()
+	batch = source.ScrapeMetrics(time.Now(), time.Now())
+	assert.Empty(t, batch.MetricSets)
+}
+
+func TestPrometheusProvider(t *testing.T) {
+	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, store.Add(annotatedPod("pod1", map[string]string{ScrapeAnnotation: "true"})))
+	require.NoError(t, store.Add(annotatedPod("pod2", nil)))
+	provider := newPrometheusProvider(util.NewDummyMetricsSourceProvider(util.NewDummyMetricsSource("node1", 0)),
+		&cache.StoreToPodLister{Indexer: store}, http.DefaultClient, regexp.MustCompile(""))
+	sources := provider.GetMetricsSources()
+	require.Len(t, sources, 2)
+	pod := sources[1].(*podSource)
+	assert.Equal(t, "prometheus:ns1/pod1", pod.Name())
+	assert.Equal(t, "http://10.0.0.1:8080/metrics", pod.URL)
+	assert.Equal(t, "uid-pod1", pod.Labels[core.LabelPodId.Key])
+}
+
+func TestNewPrometheusProvider(t *testing.T) {
+	inner := util.NewDummyMetricsSourceProvider()
+	for _, query := range []string{"", "prometheusScrape=false"} {
+		provider, err := NewPrometheusProvider(inner, &url.URL{RawQuery: query})
+		require.NoError(t, err)
+		assert.Equal(t, inner, provider)
+	}
+	for _, query := range []string{"prometheusScrape=maybe", "prometheusScrape=true&prometheusSeries=("} {
+		_, err := NewPrometheusProvider(inner, &url.URL{RawQuery: query})
+		assert.Error(t, err, query)
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statsd listens for StatsD metrics, aggregates them between two scrapes and attaches
+// them to the metric sets of the pods sending them, found by their IP, as custom metrics.
+package statsd
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	. "k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/kubelet"
+	"k8s.io/heapster/metrics/util"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+const (
+	DefaultAddress = ":8125"
+	// Largest UDP packet read.
+	maxPacketSize = 65535
+)
+
+// Metrics of a StatsD name sent by a pod. Counters and gauges keep their value across scrapes,
+// like in StatsD, timers are reset every scrape.
+type aggregate struct {
+	// c, g or ms.
+	metricType string
+	// Total of a counter or value of a gauge.
+	value float64
+	// Timings of the current scrape, in milliseconds.
+	count         int64
+	sum, min, max float64
+}
+
+// A source aggregating the StatsD metrics received on UDP and TCP by the IP of their sender.
+type statsdSource struct {
+	address   string
+	podLister *cache.StoreToPodLister
+
+	lock sync.Mutex
+	// Aggregates by name, by sender IP.
+	aggregates map[string]map[string]*aggregate
+}
+
+func (this *statsdSource) Name() string {
+	return this.String()
+}
+
+func (this *statsdSource) String() string {
+	return fmt.Sprintf("statsd:%s", this.address)
+}
+
+func (this *statsdSource) ScrapeMetrics(start, end time.Time) *DataBatch {
+	result := &DataBatch{
+		Timestamp:  end,
+		MetricSets: map[string]*MetricSet{},
+	}
+	pods, err := this.podLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("error while listing pods: %v", err)
+		return result
+	}
+	podsByIP := make(map[string]*kube_api.Pod, len(pods))
+	for _, pod := range pods {
+		// The pods using the network of their node can't be told apart by their IP.
+		hostNetwork := pod.Spec.SecurityContext != nil && pod.Spec.SecurityContext.HostNetwork
+		if pod.Status.Phase == kube_api.PodRunning && pod.Status.PodIP != "" && !hostNetwork {
+			podsByIP[pod.Status.PodIP] = pod
+		}
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for ip, aggregates := range this.aggregates {
+		pod, found := podsByIP[ip]
+		if !found {
+			glog.V(2).Infof("Dropping the StatsD metrics of %s: no running pod has its IP", ip)
+			delete(this.aggregates, ip)
+			continue
+		}
+		ms := &MetricSet{
+			CreateTime:     pod.CreationTimestamp.Time,
+			ScrapeTime:     end,
+			MetricValues:   map[string]MetricValue{},
+			LabeledMetrics: []LabeledMetric{},
+			Labels:         util.PodLabels(pod),
+		}
+		for name, aggregate := range aggregates {
+			aggregate.export(ms, CustomMetricPrefix+name)
+		}
+		result.MetricSets[PodKey(pod.Namespace, pod.Name)] = ms
+	}
+	return result
+}
+
+// Adds the metrics of the aggregate to the metric set, and resets its timings.
+func (this *aggregate) export(ms *MetricSet, name string) {
+	floatValue := func(metricType MetricType, value float64) MetricValue {
+		return MetricValue{ValueType: ValueFloat, MetricType: metricType, FloatValue: float32(value)}
+	}
+	switch this.metricType {
+	case "c":
+		ms.MetricValues[name] = floatValue(MetricCumulative, this.value)
+	case "g":
+		ms.MetricValues[name] = floatValue(MetricGauge, this.value)
+	case "ms":
+		if this.count == 0 {
+			return
+		}
+		ms.MetricValues[name+"/count"] = MetricValue{ValueType: ValueInt64, MetricType: MetricGauge, IntValue: this.count}
+		ms.MetricValues[name+"/mean"] = floatValue(MetricGauge, this.sum/float64(this.count))
+		ms.MetricValues[name+"/min"] = floatValue(MetricGauge, this.min)
+		ms.MetricValues[name+"/max"] = floatValue(MetricGauge, this.max)
+		this.count, this.sum = 0, 0
+	}
+}
+
+// Adds the lines of a packet or connection from the IP to the aggregates. The invalid lines are
+// skipped.
+func (this *statsdSource) receive(ip string, lines []string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := this.add(ip, line); err != nil {
+			glog.V(4).Infof("Skipping StatsD line %q from %s: %v", line, ip, err)
+		}
+	}
+}
+
+// Adds a line, name:value|type[|@rate][|#tags], to the aggregates of the IP. Timers and
+// histograms are both aggregated as timers. Sets and tags aren't supported.
+func (this *statsdSource) add(ip, line string) error {
+	fields := strings.Split(line, "|")
+	if len(fields) < 2 {
+		return fmt.Errorf("missing type")
+	}
+	// The tags may have colons too.
+	colon := strings.LastIndex(fields[0], ":")
+	if colon <= 0 {
+		return fmt.Errorf("missing name")
+	}
+	name := fields[0][:colon]
+	fields[0] = fields[0][colon+1:]
+	metricType := fields[1]
+	if metricType == "h" {
+		metricType = "ms"
+	}
+	if metricType != "c" && metricType != "g" && metricType != "ms" {
+		return fmt.Errorf("unsupported type %q", fields[1])
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("invalid value %q", fields[0])
+	}
+	rate := 1.0
+	for _, field := range fields[2:] {
+		if strings.HasPrefix(field, "@") {
+			rate, err = strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return fmt.Errorf("invalid sample rate %q", field)
+			}
+		}
+	}
+
+	aggregates, found := this.aggregates[ip]
+	if !found {
+		aggregates = make(map[string]*aggregate)
+		this.aggregates[ip] = aggregates
+	}
+	current, found := aggregates[name]
+	if !found || current.metricType != metricType {
+		current = &aggregate{metricType: metricType}
+		aggregates[name] = current
+	}
+	switch metricType {
+	case "c":
+		current.value += value / rate
+	case "g":
+		// Signed gauges change the current value.
+		if strings.HasPrefix(fields[0], "+") || strings.HasPrefix(fields[0], "-") {
+			current.value += value
+		} else {
+			current.value = value
+		}
+	case "ms":
+		if current.count == 0 || value < current.min {
+			current.min = value
+		}
+		if current.count == 0 || value > current.max {
+			current.max = value
+		}
+		current.count++
+		current.sum += value
+	}
+	return nil
+}
+
+// Reads the packets sent to the UDP connection until it's closed.
+func (this *statsdSource) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			glog.Errorf("Stopped listening for StatsD metrics on udp %s: %v", conn.LocalAddr(), err)
+			return
+		}
+		host, _, _ := net.SplitHostPort(addr.String())
+		this.receive(host, strings.Split(string(buf[:n]), "\n"))
+	}
+}
+
+// Accepts the TCP connections until the listener is closed, and reads their lines.
+func (this *statsdSource) serveTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			glog.Errorf("Stopped listening for StatsD metrics on tcp %s: %v", listener.Addr(), err)
+			return
+		}
+		go func() {
+			defer conn.Close()
+			host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				this.receive(host, []string{scanner.Text()})
+			}
+		}()
+	}
+}
+
+// Listens on the UDP and TCP ports of the address.
+func (this *statsdSource) listen() error {
+	conn, err := net.ListenPacket("udp", this.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for StatsD metrics on udp %s - %v", this.address, err)
+	}
+	listener, err := net.Listen("tcp", this.address)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to listen for StatsD metrics on tcp %s - %v", this.address, err)
+	}
+	go this.serveUDP(conn)
+	go this.serveTCP(listener)
+	return nil
+}
+
+func newStatsdSource(address string, podLister *cache.StoreToPodLister) *statsdSource {
+	return &statsdSource{
+		address:    address,
+		podLister:  podLister,
+		aggregates: make(map[string]map[string]*aggregate),
+	}
+}
+
+// NewStatsdSource returns the source listening for StatsD metrics on the UDP and TCP ports of
+// its address option, :8125 by default. The pods are listed from the Kubernetes API of the
+// uri, given like the one of the kubernetes source, e.g.
+// statsd:https://kubernetes.default?inClusterConfig=true&address=:9125.
+func NewStatsdSource(uri *url.URL) (MetricsSource, error) {
+	opts := uri.Query()
+	address := DefaultAddress
+	if len(opts["address"]) >= 1 {
+		address = opts["address"][0]
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, fmt.Errorf("failed to parse `address` flag - %v", err)
+		}
+	}
+	kubeConfig, _, err := kubelet.GetKubeConfigs(uri)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient := kube_client.NewOrDie(kubeConfig)
+	podLister, _, _ := util.GetPodLister(kubeClient)
+	source := newStatsdSource(address, podLister)
+	if err := source.listen(); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+func newPodLister(t *testing.T, pods ...*kube_api.Pod) *cache.StoreToPodLister {
+	podLister := &cache.StoreToPodLister{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})}
+	for _, pod := range pods {
+		require.NoError(t, podLister.Indexer.Add(pod))
+	}
+	return podLister
+}
+
+func runningPod(name, ip string) *kube_api.Pod {
+	return &kube_api.Pod{
+		ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: name, UID: types.UID(name + "-uid")},
+		Spec:       kube_api.PodSpec{NodeName: "node1"},
+		Status:     kube_api.PodStatus{Phase: kube_api.PodRunning, PodIP: ip},
+	}
+}
+
+func TestAggregation(t *testing.T) {
+	hostPod := runningPod("host", "10.0.0.1")
+	hostPod.Spec.SecurityContext = &kube_api.PodSecurityContext{HostNetwork: true}
+	source := newStatsdSource(DefaultAddress, newPodLister(t, runningPod("app", "10.1.0.5"), hostPod))
+
+	source.receive("10.1.0.5", []string{
+		"requests:1|c",
+		"requests:2|c|@0.5",
+		"queue:10|g",
+		"queue:-3|g",
+		"latency:10|ms",
+		"latency:30|ms|#env:prod",
+		"size:4|h",
+		"users:bob|s",
+		"bad:x|c",
+	})
+	source.receive("10.0.0.1", []string{"requests:1|c"})
+	source.receive("10.9.9.9", []string{"requests:1|c"})
+
+	end := time.Now()
+	batch := source.ScrapeMetrics(end.Add(-time.Minute), end)
+	require.Len(t, batch.MetricSets, 1)
+	ms := batch.MetricSets[core.PodKey("ns1", "app")]
+	require.NotNil(t, ms)
+	assert.Equal(t, "app-uid", ms.Labels[core.LabelPodId.Key])
+	assert.Equal(t, "node1", ms.Labels[core.LabelNodename.Key])
+	assert.Equal(t, core.MetricValue{ValueType: core.ValueFloat, MetricType: core.MetricCumulative, FloatValue: 5},
+		ms.MetricValues["custom/requests"])
+	assert.Equal(t, core.MetricValue{ValueType: core.ValueFloat, MetricType: core.MetricGauge, FloatValue: 7},
+		ms.MetricValues["custom/queue"])
+	assert.Equal(t, int64(2), ms.MetricValues["custom/latency/count"].IntValue)
+	assert.Equal(t, float32(20), ms.MetricValues["custom/latency/mean"].FloatValue)
+	assert.Equal(t, float32(10), ms.MetricValues["custom/latency/min"].FloatValue)
+	assert.Equal(t, float32(30), ms.MetricValues["custom/latency/max"].FloatValue)
+	assert.Equal(t, int64(1), ms.MetricValues["custom/size/count"].IntValue)
+	assert.NotContains(t, ms.MetricValues, "custom/users")
+	assert.NotContains(t, ms.MetricValues, "custom/bad")
+
+	// Counters and gauges keep their value, the timers are reset.
+	source.receive("10.1.0.5", []string{"requests:1|c"})
+	batch = source.ScrapeMetrics(end, end.Add(time.Minute))
+	ms = batch.MetricSets[core.PodKey("ns1", "app")]
+	require.NotNil(t, ms)
+	assert.Equal(t, float32(6), ms.MetricValues["custom/requests"].FloatValue)
+	assert.Equal(t, float32(7), ms.MetricValues["custom/queue"].FloatValue)
+	assert.NotContains(t, ms.MetricValues, "custom/latency/count")
+}
+
+func TestListen(t *testing.T) {
+	source := newStatsdSource("127.0.0.1:0", newPodLister(t, runningPod("app", "127.0.0.1")))
+	udp, err := net.ListenPacket("udp", source.address)
+	require.NoError(t, err)
+	defer udp.Close()
+	tcp, err := net.Listen("tcp", source.address)
+	require.NoError(t, err)
+	defer tcp.Close()
+	go source.serveUDP(udp)
+	go source.serveTCP(tcp)
+
+	conn, err := net.Dial("udp", udp.LocalAddr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("udp_requests:1|c\nudp_queue:3|g"))
+	require.NoError(t, err)
+	conn.Close()
+	conn, err = net.Dial("tcp", tcp.Addr().String())
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(conn, "tcp_requests:2|c\n")
+	require.NoError(t, err)
+	conn.Close()
+
+	var ms *core.MetricSet
+	for i := 0; i < 100; i++ {
+		batch := source.ScrapeMetrics(time.Time{}, time.Now())
+		if ms = batch.MetricSets[core.PodKey("ns1", "app")]; ms != nil && len(ms.MetricValues) == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NotNil(t, ms)
+	assert.Equal(t, float32(1), ms.MetricValues["custom/udp_requests"].FloatValue)
+	assert.Equal(t, float32(3), ms.MetricValues["custom/udp_queue"].FloatValue)
+	assert.Equal(t, float32(2), ms.MetricValues["custom/tcp_requests"].FloatValue)
+}
+
+func TestNewStatsdSourceAddress(t *testing.T) {
+	_, err := NewStatsdSource(&url.URL{Scheme: "https", Host: "kubernetes.default", RawQuery: "address=8125"})
+	assert.Error(t, err)
+}
@@ -17,6 +17,9 @@ package summary
 import (
 	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	. "k8s.io/heapster/metrics/core"
@@ -25,7 +28,9 @@ import (
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/heapster/metrics/util"
+	"k8s.io/heapster/metrics/util/accounting"
 	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
 	"k8s.io/kubernetes/pkg/client/cache"
 	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/stats"
@@ -60,8 +65,15 @@ type NodeInfo struct {
 	HostName       string
 	HostID         string
 	KubeletVersion string
+	// Provider of the virtual kubelet running the node, empty for regular nodes.
+	VirtualProvider string
+	// Operating system of the node, e.g. linux or windows.
+	OperatingSystem string
 }
 
+// Operating system of the Windows nodes.
+const windowsOS = "windows"
+
 // Kubelet-provided metrics for pod and system container.
 type summaryMetricsSource struct {
 	node          NodeInfo
@@ -70,21 +82,58 @@ type summaryMetricsSource struct {
 	// Whether this node requires the fall-back source.
 	useFallback bool
 	fallback    MetricsSource
+
+	// Adapter of the virtual kubelet provider, nil for regular nodes.
+	virtualAdapter VirtualNodeAdapter
+
+	// Whether to request summaries without the network, filesystem and user defined metrics.
+	onlyCpuAndMemory bool
+
+	// Whether the node runs Windows, whose Kubelet has no cgroups nor cAdvisor API, and leaves
+	// the stats it doesn't measure at zero.
+	windows bool
+
+	// Scrapes failed in a row. After maxScrapeFailures, a virtual kubelet, which may serve no
+	// stats at all, is only probed every failedNodeProbeInterval until it serves stats again.
+	// The regular nodes are scraped every time, their failures being usually transient.
+	failures  int
+	skipUntil time.Time
 }
 
+const (
+	maxScrapeFailures       = 3
+	failedNodeProbeInterval = 10 * time.Minute
+)
+
 func NewSummaryMetricsSource(node NodeInfo, client *kubelet.KubeletClient, fallback MetricsSource) MetricsSource {
-	return &summaryMetricsSource{
-		node:          node,
-		kubeletClient: client,
-		useFallback:   !summarySupported(node.KubeletVersion),
-		fallback:      fallback,
-	}
+	return newSummaryMetricsSource(node, client, fallback, false)
+}
+
+func newSummaryMetricsSource(node NodeInfo, client *kubelet.KubeletClient, fallback MetricsSource, onlyCpuAndMemory bool) *summaryMetricsSource {
+	source := &summaryMetricsSource{
+		node:             node,
+		kubeletClient:    client,
+		fallback:         fallback,
+		onlyCpuAndMemory: onlyCpuAndMemory,
+		windows:          node.OperatingSystem == windowsOS,
+	}
+	if node.VirtualProvider != "" {
+		// Virtual kubelets have no cAdvisor to fall back to, whatever version they claim.
+		source.virtualAdapter = getVirtualNodeAdapter(node.VirtualProvider)
+	} else if !source.windows {
+		source.useFallback = !summarySupported(node.KubeletVersion)
+	}
+	return source
 }
 
 func (this *summaryMetricsSource) Name() string {
 	return this.String()
 }
 
+func (this *summaryMetricsSource) NodeName() string {
+	return this.node.NodeName
+}
+
 func (this *summaryMetricsSource) String() string {
 	return fmt.Sprintf("kubelet_summary:%s:%d", this.node.IP, this.node.Port)
 }
@@ -98,33 +147,67 @@ func (this *summaryMetricsSource) ScrapeMetrics(start, end time.Time) *DataBatch
 		Timestamp:  time.Now(),
 		MetricSets: map[string]*MetricSet{},
 	}
+	if result.Timestamp.Before(this.skipUntil) {
+		return result
+	}
 
-	summary, err := func() (*stats.Summary, error) {
+	summary, err := func() (*kubelet.Summary, error) {
 		startTime := time.Now()
 		defer summaryRequestLatency.WithLabelValues(this.node.HostName).Observe(float64(time.Since(startTime)))
-		return this.kubeletClient.GetSummary(this.node.Host)
+		if this.virtualAdapter != nil {
+			summary, err := this.virtualAdapter.GetSummary(this.kubeletClient, this.node)
+			if err != nil {
+				return nil, err
+			}
+			return &kubelet.Summary{Summary: *summary}, nil
+		}
+		summary, payload, err := this.kubeletClient.GetFullSummaryPayload(this.node.Host, this.onlyCpuAndMemory)
+		if err == nil {
+			kubelet.DefaultPayloadTracker.Record(this.node.HostName, payload)
+		}
+		return summary, err
 	}()
 
 	if err != nil {
-		if kubelet.IsNotFoundError(err) {
-			glog.Warningf("Summary not found, using fallback: %v", err)
+		if kubelet.IsNotFoundError(err) && this.virtualAdapter == nil && !this.windows {
+			glog.Warningf("Summary of node %s not found, using the cAdvisor API until its kubelet is upgraded: %v", this.node.NodeName, err)
 			this.useFallback = true
 			return this.fallback.ScrapeMetrics(start, end)
 		}
+		this.failures++
+		if this.virtualAdapter != nil && this.failures >= maxScrapeFailures {
+			this.skipUntil = result.Timestamp.Add(failedNodeProbeInterval)
+			glog.Warningf("Kubelet %s(%s:%d) failed %d scrapes in a row, probing it again in %v: %v",
+				this.node.NodeName, this.node.IP, this.node.Port, this.failures, failedNodeProbeInterval, err)
+			return result
+		}
 		glog.Errorf("error while getting metrics summary from Kubelet %s(%s:%d): %v", this.node.NodeName, this.node.IP, this.node.Port, err)
 		return result
 	}
+	if this.virtualAdapter != nil && this.failures >= maxScrapeFailures {
+		glog.Infof("Kubelet %s(%s:%d) serves stats again", this.node.NodeName, this.node.IP, this.node.Port)
+	}
+	this.failures = 0
 
-	result.MetricSets = this.decodeSummary(summary)
+	if this.virtualAdapter != nil {
+		filterVirtualSummary(&summary.Summary, this.virtualAdapter.Capabilities())
+	}
+	result.MetricSets = this.decodeSummary(&summary.Summary)
+	if nodeMetrics, found := result.MetricSets[NodeKey(summary.Node.NodeName)]; found {
+		this.decodeRlimitStats(nodeMetrics, summary.Rlimit)
+	}
+	kubelet.MoveDiskMetricsToNode(result.MetricSets, NodeKey(summary.Node.NodeName))
 
 	return result
 }
 
+// Returns whether the kubelet of the given version serves the summary API. The kubelets whose
+// version can't be parsed, e.g. custom builds, are assumed to serve it until they return a 404.
 func summarySupported(kubeletVersion string) bool {
 	semver, err := version.Parse(kubeletVersion)
 	if err != nil {
-		glog.Errorf("Unable to parse kubelet version: %q", kubeletVersion)
-		return false
+		glog.Warningf("Unable to parse kubelet version %q, detecting whether it serves the summary API", kubeletVersion)
+		return true
 	}
 	return semver.GE(minSummaryKubeletVersion)
 }
@@ -132,6 +215,10 @@ func summarySupported(kubeletVersion string) bool {
 const (
 	RootFsKey = "/"
 	LogsKey   = "logs"
+	// Key of the filesystem of the images of the container runtime, on the node.
+	ImageFsKey = "imagefs"
+	// Label of the user defined disk metrics holding the device.
+	DiskDeviceLabel = "device"
 )
 
 // For backwards compatibility, map summary system names into original names.
@@ -183,6 +270,9 @@ func (this *summaryMetricsSource) decodeNodeStats(metrics map[string]*MetricSet,
 	this.decodeMemoryStats(nodeMetrics, node.Memory)
 	this.decodeNetworkStats(nodeMetrics, node.Network)
 	this.decodeFsStats(nodeMetrics, RootFsKey, node.Fs)
+	if node.Runtime != nil {
+		this.decodeFsStats(nodeMetrics, ImageFsKey, node.Runtime.ImageFs)
+	}
 	metrics[NodeKey(node.NodeName)] = nodeMetrics
 
 	for _, container := range node.SystemContainers {
@@ -265,12 +355,27 @@ func (this *summaryMetricsSource) decodeMemoryStats(metrics *MetricSet, memory *
 		return
 	}
 
+	if this.windows {
+		// Windows measures the working set, and the commit charge as the usage on recent
+		// Kubelets only. There are no page faults.
+		this.addIntMetric(metrics, &MetricMemoryUsage, nonZero(memory.UsageBytes))
+		this.addIntMetric(metrics, &MetricMemoryWorkingSet, memory.WorkingSetBytes)
+		return
+	}
 	this.addIntMetric(metrics, &MetricMemoryUsage, memory.UsageBytes)
 	this.addIntMetric(metrics, &MetricMemoryWorkingSet, memory.WorkingSetBytes)
 	this.addIntMetric(metrics, &MetricMemoryPageFaults, memory.PageFaults)
 	this.addIntMetric(metrics, &MetricMemoryMajorPageFaults, memory.MajorPageFaults)
 }
 
+// Returns the value, or nil if it's zero.
+func nonZero(value *uint64) *uint64 {
+	if value == nil || *value == 0 {
+		return nil
+	}
+	return value
+}
+
 func (this *summaryMetricsSource) decodeNetworkStats(metrics *MetricSet, network *stats.NetworkStats) {
 	if network == nil {
 		return
@@ -282,19 +387,65 @@ func (this *summaryMetricsSource) decodeNetworkStats(metrics *MetricSet, network
 	this.addIntMetric(metrics, &MetricNetworkTxErrors, network.TxErrors)
 }
 
+func (this *summaryMetricsSource) decodeRlimitStats(metrics *MetricSet, rlimit *kubelet.RlimitStats) {
+	if rlimit == nil {
+		return
+	}
+
+	for metric, value := range map[*Metric]*int64{
+		&MetricProcessMax:   rlimit.MaxPID,
+		&MetricProcessCount: rlimit.NumOfRunningProcesses,
+	} {
+		if value != nil {
+			metrics.MetricValues[metric.Name] = MetricValue{
+				ValueType:  ValueInt64,
+				MetricType: metric.Type,
+				IntValue:   *value,
+			}
+		}
+	}
+}
+
 func (this *summaryMetricsSource) decodeFsStats(metrics *MetricSet, fsKey string, fs *stats.FsStats) {
 	if fs == nil {
 		return
 	}
+	// The Windows Kubelets report the filesystems they don't measure, e.g. the logs of the
+	// containers, with a zero capacity.
+	if this.windows && nonZero(fs.CapacityBytes) == nil {
+		return
+	}
 
 	fsLabels := map[string]string{LabelResourceID.Key: fsKey}
 	this.addLabeledIntMetric(metrics, &MetricFilesystemUsage, fsLabels, fs.UsedBytes)
 	this.addLabeledIntMetric(metrics, &MetricFilesystemLimit, fsLabels, fs.CapacityBytes)
 	this.addLabeledIntMetric(metrics, &MetricFilesystemAvailable, fsLabels, fs.AvailableBytes)
+	if fs.Inodes != nil && fs.InodesFree != nil && *fs.Inodes > 0 {
+		metrics.LabeledMetrics = append(metrics.LabeledMetrics, LabeledMetric{
+			Name:   MetricFilesystemInodeUtilization.Name,
+			Labels: fsLabels,
+			MetricValue: MetricValue{
+				ValueType:  ValueFloat,
+				MetricType: MetricFilesystemInodeUtilization.Type,
+				FloatValue: InodeUtilization(*fs.Inodes, *fs.InodesFree),
+			},
+		})
+	}
 }
 
 func (this *summaryMetricsSource) decodeUserDefinedMetrics(metrics *MetricSet, udm []stats.UserDefinedMetric) {
 	for _, metric := range udm {
+		if diskMetric, found := DiskCustomMetrics[metric.Name]; found {
+			device := metric.Labels[DiskDeviceLabel]
+			if this.windows {
+				// Volumes like `C:\`, whose backslash the sinks would have to escape.
+				device = strings.TrimRight(device, `\`)
+			}
+			if device != "" {
+				metrics.LabeledMetrics = append(metrics.LabeledMetrics, kubelet.NewDiskMetric(&diskMetric, device, metric.Value))
+			}
+			continue
+		}
 		mv := MetricValue{}
 		switch metric.Type {
 		case stats.MetricGauge:
@@ -374,6 +525,15 @@ type summaryProvider struct {
 	nodeLister    *cache.StoreToNodeLister
 	reflector     *cache.Reflector
 	kubeletClient *kubelet.KubeletClient
+
+	onlyCpuAndMemory bool
+	// Whether the virtual kubelet nodes are left out.
+	skipVirtualNodes bool
+
+	// Sources of the nodes by name, kept while their node info doesn't change so that the nodes
+	// found to not serve the summary API keep using the fallback.
+	lock    sync.Mutex
+	sources map[string]*summaryMetricsSource
 }
 
 func (this *summaryProvider) GetMetricsSources() []MetricsSource {
@@ -384,21 +544,37 @@ func (this *summaryProvider) GetMetricsSources() []MetricsSource {
 		return sources
 	}
 
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	previous := this.sources
+	this.sources = make(map[string]*summaryMetricsSource, len(nodes.Items))
+	hostnames := make(map[string]bool, len(nodes.Items))
 	for _, node := range nodes.Items {
+		if this.skipVirtualNodes && kubelet.GetVirtualProvider(&node) != "" {
+			continue
+		}
 		info, err := this.getNodeInfo(&node)
 		if err != nil {
 			glog.Errorf("%v", err)
 			continue
 		}
-		fallback := kubelet.NewKubeletMetricsSource(
-			info.Host,
-			this.kubeletClient,
-			info.NodeName,
-			info.HostName,
-			info.HostID,
-		)
-		sources = append(sources, NewSummaryMetricsSource(info, this.kubeletClient, fallback))
+		// A new version of the kubelet may serve the summary API.
+		source, found := previous[info.NodeName]
+		if !found || source.node != info {
+			fallback := kubelet.NewKubeletMetricsSource(
+				info.Host,
+				this.kubeletClient,
+				info.NodeName,
+				info.HostName,
+				info.HostID,
+			)
+			source = newSummaryMetricsSource(info, this.kubeletClient, fallback, this.onlyCpuAndMemory)
+		}
+		this.sources[info.NodeName] = source
+		hostnames[info.HostName] = true
+		sources = append(sources, source)
 	}
+	kubelet.DefaultPayloadTracker.Retain(hostnames)
 	return sources
 }
 
@@ -415,7 +591,12 @@ func (this *summaryProvider) getNodeInfo(node *kube_api.Node) (NodeInfo, error)
 		Host: kubelet.Host{
 			Port: this.kubeletClient.GetPort(),
 		},
-		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+		KubeletVersion:  node.Status.NodeInfo.KubeletVersion,
+		VirtualProvider: kubelet.GetVirtualProvider(node),
+		OperatingSystem: node.Status.NodeInfo.OperatingSystem,
+	}
+	if info.OperatingSystem == "" {
+		info.OperatingSystem = node.Labels[unversioned.LabelOS]
 	}
 
 	for _, addr := range node.Status.Addresses {
@@ -444,16 +625,43 @@ func NewSummaryProvider(uri *url.URL) (MetricsSourceProvider, error) {
 		return nil, err
 	}
 	kubeClient := kube_client.NewOrDie(kubeConfig)
+	kubeletConfig.Dial = accounting.DefaultLedger.Dial(accounting.SourceOwner("kubelet_summary"), kubeletConfig.Dial)
 	kubeletClient, err := kubelet.NewKubeletClient(kubeletConfig)
 	if err != nil {
 		return nil, err
 	}
+	scrapeOptions, err := kubelet.GetScrapeOptions(uri)
+	if err != nil {
+		return nil, err
+	}
+	kubeletClient.SetScrapeOptions(scrapeOptions)
+	onlyCpuAndMemory := false
+	if opts := uri.Query(); len(opts["onlyCpuAndMemory"]) >= 1 {
+		onlyCpuAndMemory, err = strconv.ParseBool(opts["onlyCpuAndMemory"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse `onlyCpuAndMemory` flag - %v", err)
+		}
+	}
+
+	nodeSelector, err := kubelet.GetNodeLabelSelector(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	skipVirtualNodes, err := kubelet.GetSkipVirtualNodes(uri)
+	if err != nil {
+		return nil, err
+	}
+
 	// watch nodes
-	nodeLister, reflector, _ := util.GetNodeLister(kubeClient)
+	nodeLister, reflector, _ := util.GetSelectedNodeLister(kubeClient, nodeSelector)
 
 	return &summaryProvider{
-		nodeLister:    nodeLister,
-		reflector:     reflector,
-		kubeletClient: kubeletClient,
+		nodeLister:       nodeLister,
+		reflector:        reflector,
+		kubeletClient:    kubeletClient,
+		onlyCpuAndMemory: onlyCpuAndMemory,
+		skipVirtualNodes: skipVirtualNodes,
+		sources:          make(map[string]*summaryMetricsSource),
 	}, nil
 }
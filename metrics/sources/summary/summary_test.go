@@ -26,8 +26,11 @@ import (
 	"github.com/stretchr/testify/require"
 	"k8s.io/heapster/metrics/core"
 	"k8s.io/heapster/metrics/sources/kubelet"
+	kube_api "k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/cache"
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/stats"
+	kube_client "k8s.io/kubernetes/pkg/kubelet/client"
 	util "k8s.io/kubernetes/pkg/util/testing"
 )
 
@@ -46,6 +49,8 @@ const (
 	offsetFsUsed
 	offsetFsCapacity
 	offsetFsAvailable
+	offsetFsInodesFree
+	offsetFsInodes
 )
 
 const (
@@ -273,6 +278,8 @@ func TestDecodeSummaryMetrics(t *testing.T) {
 			checkFsMetric(t, m, e.key, label, core.MetricFilesystemAvailable, e.seed+offsetFsAvailable)
 			checkFsMetric(t, m, e.key, label, core.MetricFilesystemLimit, e.seed+offsetFsCapacity)
 			checkFsMetric(t, m, e.key, label, core.MetricFilesystemUsage, e.seed+offsetFsUsed)
+			checkFsFloatMetric(t, m, e.key, label, core.MetricFilesystemInodeUtilization,
+				1/float32(e.seed+offsetFsInodes))
 		}
 		delete(metrics, e.key)
 	}
@@ -328,6 +335,8 @@ func genTestSummaryFsStats(seed int) *stats.FsStats {
 		AvailableBytes: uint64Val(seed, offsetFsAvailable),
 		CapacityBytes:  uint64Val(seed, offsetFsCapacity),
 		UsedBytes:      uint64Val(seed, offsetFsUsed),
+		Inodes:         uint64Val(seed, offsetFsInodes),
+		InodesFree:     uint64Val(seed, offsetFsInodesFree),
 	}
 }
 
@@ -355,6 +364,137 @@ func checkFsMetric(t *testing.T, metrics *core.MetricSet, key, label string, met
 	assert.Fail(t, "missing filesystem metric", "%q:[%q]:%q", key, metric.Name, label)
 }
 
+func checkFsFloatMetric(t *testing.T, metrics *core.MetricSet, key, label string, metric core.Metric, value float32) {
+	for _, m := range metrics.LabeledMetrics {
+		if m.Name == metric.Name && m.Labels[core.LabelResourceID.Key] == label {
+			assert.InEpsilon(t, value, m.FloatValue, 0.0001, "%q:%q[%s]", key, metric.Name, label)
+			return
+		}
+	}
+	assert.Fail(t, "missing filesystem metric", "%q:[%q]:%q", key, metric.Name, label)
+}
+
+func TestDecodeDiskMetrics(t *testing.T) {
+	diskMetric := func(name, device string, value float64) stats.UserDefinedMetric {
+		return stats.UserDefinedMetric{
+			UserDefinedMetricDescriptor: stats.UserDefinedMetricDescriptor{
+				Name:   name,
+				Type:   stats.MetricGauge,
+				Labels: map[string]string{"device": device},
+			},
+			Value: value,
+		}
+	}
+	summary := stats.Summary{
+		Node: stats.NodeStats{
+			NodeName:  nodeInfo.NodeName,
+			StartTime: unversioned.NewTime(startTime),
+		},
+		Pods: []stats.PodStats{{
+			PodRef:    stats.PodReference{Name: "smart-exporter", Namespace: "kube-system"},
+			StartTime: unversioned.NewTime(startTime),
+			Containers: []stats.ContainerStats{{
+				Name:      "exporter",
+				StartTime: unversioned.NewTime(startTime),
+				UserDefinedMetrics: []stats.UserDefinedMetric{
+					diskMetric("disk_health_status", "sda", 1),
+					diskMetric("disk_temperature", "sda", 38),
+					diskMetric("disk_temperature", "", 99),
+				},
+			}},
+		}},
+	}
+	ms := testingSummaryMetricsSource()
+	metrics := ms.decodeSummary(&summary)
+	kubelet.MoveDiskMetricsToNode(metrics, core.NodeKey(nodeInfo.NodeName))
+
+	container := metrics[core.PodContainerKey("kube-system", "smart-exporter", "exporter")]
+	require.NotNil(t, container)
+	assert.Empty(t, container.LabeledMetrics)
+	_, found := container.MetricValues[core.CustomMetricPrefix+"disk_temperature"]
+	assert.False(t, found)
+
+	node := metrics[core.NodeKey(nodeInfo.NodeName)]
+	require.NotNil(t, node)
+	values := map[string]core.MetricValue{}
+	for _, metric := range node.LabeledMetrics {
+		if metric.Labels[core.LabelResourceID.Key] == "sda" {
+			values[metric.Name] = metric.MetricValue
+		}
+	}
+	require.Len(t, values, 2)
+	assert.Equal(t, int64(1), values["disk/health_status"].IntValue)
+	assert.Equal(t, float32(38), values["disk/temperature"].FloatValue)
+}
+
+func TestDecodeWindowsSummary(t *testing.T) {
+	zero := uint64(0)
+	summary := stats.Summary{
+		Node: stats.NodeStats{
+			NodeName:  nodeInfo.NodeName,
+			StartTime: unversioned.NewTime(startTime),
+			CPU:       genTestSummaryCPU(1),
+			Memory: &stats.MemoryStats{
+				Time:            unversioned.NewTime(scrapeTime),
+				UsageBytes:      &zero,
+				WorkingSetBytes: uint64Val(2, 0),
+				PageFaults:      &zero,
+				MajorPageFaults: &zero,
+			},
+			Fs: genTestSummaryFsStats(3),
+		},
+		Pods: []stats.PodStats{{
+			PodRef:    stats.PodReference{Name: "iis", Namespace: "web"},
+			StartTime: unversioned.NewTime(startTime),
+			Containers: []stats.ContainerStats{{
+				Name:      "iis",
+				StartTime: unversioned.NewTime(startTime),
+				Logs:      &stats.FsStats{CapacityBytes: &zero, UsedBytes: &zero},
+			}},
+		}},
+	}
+	ms := testingSummaryMetricsSource()
+	ms.windows = true
+	metrics := ms.decodeSummary(&summary)
+
+	node := metrics[core.NodeKey(nodeInfo.NodeName)]
+	require.NotNil(t, node)
+	checkIntMetric(t, node, "node", core.MetricCpuUsage, int64(*genTestSummaryCPU(1).UsageCoreNanoSeconds))
+	checkIntMetric(t, node, "node", core.MetricMemoryWorkingSet, int64(*uint64Val(2, 0)))
+	for _, metric := range []core.Metric{core.MetricMemoryUsage, core.MetricMemoryPageFaults, core.MetricMemoryMajorPageFaults} {
+		_, found := node.MetricValues[metric.Name]
+		assert.False(t, found, metric.Name)
+	}
+	checkFsMetric(t, node, "node", RootFsKey, core.MetricFilesystemLimit, int64(*genTestSummaryFsStats(3).CapacityBytes))
+
+	container := metrics[core.PodContainerKey("web", "iis", "iis")]
+	require.NotNil(t, container)
+	assert.Empty(t, container.LabeledMetrics)
+}
+
+func TestWindowsNodeWithoutFallback(t *testing.T) {
+	server := httptest.NewServer(&util.FakeHandler{
+		StatusCode: 404,
+		T:          t,
+	})
+	defer server.Close()
+
+	info := nodeInfo
+	info.OperatingSystem = "windows"
+	split := strings.SplitN(strings.Replace(server.URL, "http://", "", 1), ":", 2)
+	info.IP = split[0]
+	var err error
+	info.Port, err = strconv.Atoi(split[1])
+	require.NoError(t, err)
+	fallback := &fakeSource{}
+	ms := newSummaryMetricsSource(info, &kubelet.KubeletClient{}, fallback, false)
+
+	// Windows has no cAdvisor API to fall back to.
+	ms.ScrapeMetrics(time.Now(), time.Now())
+	assert.False(t, fallback.scraped)
+	assert.False(t, ms.useFallback)
+}
+
 func TestScrapeSummaryMetrics(t *testing.T) {
 	summary := stats.Summary{
 		Node: stats.NodeStats{
@@ -380,6 +520,40 @@ func TestScrapeSummaryMetrics(t *testing.T) {
 
 	res := ms.ScrapeMetrics(time.Now(), time.Now())
 	assert.Equal(t, res.MetricSets["node:test"].Labels[core.LabelMetricSetType.Key], core.MetricSetTypeNode)
+	assert.Equal(t, "", server.Config.Handler.(*util.FakeHandler).RequestReceived.URL.RawQuery)
+
+	ms.onlyCpuAndMemory = true
+	ms.ScrapeMetrics(time.Now(), time.Now())
+	assert.Equal(t, "only_cpu_and_memory=true", server.Config.Handler.(*util.FakeHandler).RequestReceived.URL.RawQuery)
+}
+
+func TestScrapeRlimitAndImageFs(t *testing.T) {
+	// The summaries of the recent kubelets have the process limits of the node.
+	body := `{"node": {"nodeName": "test", "startTime": "2016-10-01T12:00:00Z",
+		"runtime": {"imageFs": {"usedBytes": 100, "capacityBytes": 1000, "availableBytes": 900}},
+		"rlimit": {"time": "2016-10-01T12:00:00Z", "maxpid": 32768, "curproc": 300}}}`
+	server := httptest.NewServer(&util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: body,
+		T:            t,
+	})
+	defer server.Close()
+
+	ms := testingSummaryMetricsSource()
+	split := strings.SplitN(strings.Replace(server.URL, "http://", "", 1), ":", 2)
+	ms.node.IP = split[0]
+	var err error
+	ms.node.Port, err = strconv.Atoi(split[1])
+	require.NoError(t, err)
+
+	res := ms.ScrapeMetrics(time.Now(), time.Now())
+	node := res.MetricSets[core.NodeKey(nodeInfo.NodeName)]
+	require.NotNil(t, node)
+	checkIntMetric(t, node, "node", core.MetricProcessMax, 32768)
+	checkIntMetric(t, node, "node", core.MetricProcessCount, 300)
+	checkFsMetric(t, node, "node", ImageFsKey, core.MetricFilesystemUsage, 100)
+	checkFsMetric(t, node, "node", ImageFsKey, core.MetricFilesystemLimit, 1000)
+	checkFsMetric(t, node, "node", ImageFsKey, core.MetricFilesystemAvailable, 900)
 }
 
 func TestFallback(t *testing.T) {
@@ -407,6 +581,48 @@ func TestFallback(t *testing.T) {
 	assert.True(t, fallback.scraped)
 }
 
+func TestProviderKeepsFallback(t *testing.T) {
+	nodeLister := &cache.StoreToNodeLister{Store: cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	node := &kube_api.Node{
+		ObjectMeta: kube_api.ObjectMeta{Name: "test"},
+		Status: kube_api.NodeStatus{
+			Addresses: []kube_api.NodeAddress{{Type: kube_api.NodeInternalIP, Address: "127.0.0.1"}},
+			NodeInfo:  kube_api.NodeSystemInfo{KubeletVersion: "v1.3.0"},
+		},
+	}
+	require.NoError(t, nodeLister.Add(node))
+	kubeletClient, err := kubelet.NewKubeletClient(&kube_client.KubeletClientConfig{Port: 10255})
+	require.NoError(t, err)
+	provider := &summaryProvider{
+		nodeLister:    nodeLister,
+		kubeletClient: kubeletClient,
+		sources:       make(map[string]*summaryMetricsSource),
+	}
+
+	sources := provider.GetMetricsSources()
+	require.Len(t, sources, 1)
+	source := sources[0].(*summaryMetricsSource)
+	assert.False(t, source.useFallback)
+	source.useFallback = true
+
+	// The node found to not serve the summary API keeps using the fallback.
+	sources = provider.GetMetricsSources()
+	require.Len(t, sources, 1)
+	assert.True(t, sources[0].(*summaryMetricsSource).useFallback)
+
+	// Until its kubelet is upgraded.
+	upgraded := *node
+	upgraded.Status.NodeInfo.KubeletVersion = "v1.4.0"
+	require.NoError(t, nodeLister.Update(&upgraded))
+	sources = provider.GetMetricsSources()
+	require.Len(t, sources, 1)
+	assert.False(t, sources[0].(*summaryMetricsSource).useFallback)
+
+	require.NoError(t, nodeLister.Delete(&upgraded))
+	assert.Empty(t, provider.GetMetricsSources())
+	assert.Empty(t, provider.sources)
+}
+
 func TestSummarySupported(t *testing.T) {
 	tests := []struct {
 		version        string
@@ -418,7 +634,7 @@ func TestSummarySupported(t *testing.T) {
 		{"v1.3.0-alpha.1", false},
 		{"v1.1.8", true},
 		{"v1.0.6", true},
-		{"v-invalid", true},
+		{"v-invalid", false},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,124 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package summary
+
+import (
+	"k8s.io/heapster/metrics/sources/kubelet"
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/stats"
+)
+
+const (
+	// Key of the label or taint holding the provider of a virtual kubelet node.
+	VirtualKubeletProviderKey = kubelet.VirtualKubeletProviderKey
+	// Provider of virtual kubelet nodes not naming one.
+	UnknownVirtualProvider = kubelet.UnknownVirtualProvider
+)
+
+// Stats served by the virtual kubelet nodes of a provider. Virtual kubelets have no cAdvisor, so
+// the stats a provider does not measure are left out rather than exported as zeros.
+type VirtualNodeCapabilities struct {
+	// Whether the node stats describe the capacity used on the node, rather than being empty.
+	NodeStats bool
+	// Whether the containers report their CPU usage.
+	CPU bool
+	// Whether the containers report their memory usage.
+	Memory bool
+	// Whether the pods report their network traffic.
+	Network bool
+	// Whether the containers and pods report their filesystem and volume usage.
+	Filesystem bool
+}
+
+// VirtualNodeAdapter reads the stats of the virtual kubelet nodes of a provider.
+type VirtualNodeAdapter interface {
+	Capabilities() VirtualNodeCapabilities
+	// GetSummary returns the stats of the node in the format of the summary API.
+	GetSummary(client *kubelet.KubeletClient, node NodeInfo) (*stats.Summary, error)
+}
+
+// Adapter reading the summary API served by the virtual kubelet.
+type summaryAdapter struct {
+	capabilities VirtualNodeCapabilities
+}
+
+func (this *summaryAdapter) Capabilities() VirtualNodeCapabilities {
+	return this.capabilities
+}
+
+func (this *summaryAdapter) GetSummary(client *kubelet.KubeletClient, node NodeInfo) (*stats.Summary, error) {
+	return client.GetSummary(node.Host)
+}
+
+// NewSummaryAdapter returns an adapter for providers serving the summary API with the given capabilities.
+func NewSummaryAdapter(capabilities VirtualNodeCapabilities) VirtualNodeAdapter {
+	return &summaryAdapter{capabilities: capabilities}
+}
+
+var virtualNodeAdapters = map[string]VirtualNodeAdapter{
+	// Azure Container Instances.
+	"azure": NewSummaryAdapter(VirtualNodeCapabilities{CPU: true, Memory: true, Network: true}),
+	// AWS Fargate.
+	"aws": NewSummaryAdapter(VirtualNodeCapabilities{CPU: true, Memory: true}),
+
+	// Other providers are expected to report at least the usage of the containers.
+	UnknownVirtualProvider: NewSummaryAdapter(VirtualNodeCapabilities{CPU: true, Memory: true}),
+}
+
+// RegisterVirtualNodeAdapter sets the adapter used for the virtual kubelet nodes of a provider.
+func RegisterVirtualNodeAdapter(provider string, adapter VirtualNodeAdapter) {
+	virtualNodeAdapters[provider] = adapter
+}
+
+// Returns the adapter of a virtual kubelet provider, or the one of unknown providers.
+func getVirtualNodeAdapter(provider string) VirtualNodeAdapter {
+	if adapter, found := virtualNodeAdapters[provider]; found {
+		return adapter
+	}
+	return virtualNodeAdapters[UnknownVirtualProvider]
+}
+
+// Drops the stats a virtual kubelet provider does not measure from its summary.
+func filterVirtualSummary(summary *stats.Summary, capabilities VirtualNodeCapabilities) {
+	if !capabilities.NodeStats {
+		summary.Node.SystemContainers = nil
+		summary.Node.CPU = nil
+		summary.Node.Memory = nil
+		summary.Node.Network = nil
+		summary.Node.Fs = nil
+		summary.Node.Runtime = nil
+	}
+	for i := range summary.Pods {
+		pod := &summary.Pods[i]
+		if !capabilities.Network {
+			pod.Network = nil
+		}
+		if !capabilities.Filesystem {
+			pod.VolumeStats = nil
+		}
+		for j := range pod.Containers {
+			container := &pod.Containers[j]
+			if !capabilities.CPU {
+				container.CPU = nil
+			}
+			if !capabilities.Memory {
+				container.Memory = nil
+			}
+			if !capabilities.Filesystem {
+				container.Rootfs = nil
+				container.Logs = nil
+			}
+		}
+	}
+}
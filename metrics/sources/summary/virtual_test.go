@@ -0,0 +1,148 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package summary
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/kubelet"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/stats"
+	util "k8s.io/kubernetes/pkg/util/testing"
+)
+
+func testingVirtualSource(t *testing.T, server *httptest.Server, provider string) *summaryMetricsSource {
+	info := nodeInfo
+	info.VirtualProvider = provider
+	split := strings.SplitN(strings.Replace(server.URL, "http://", "", 1), ":", 2)
+	info.IP = split[0]
+	var err error
+	info.Port, err = strconv.Atoi(split[1])
+	require.NoError(t, err)
+	return NewSummaryMetricsSource(info, &kubelet.KubeletClient{}, &fakeSource{}).(*summaryMetricsSource)
+}
+
+func TestScrapeVirtualNode(t *testing.T) {
+	value := uint64(100)
+	summary := stats.Summary{
+		Node: stats.NodeStats{
+			NodeName:  nodeInfo.NodeName,
+			StartTime: unversioned.NewTime(startTime),
+			CPU:       &stats.CPUStats{Time: unversioned.NewTime(startTime), UsageCoreNanoSeconds: &value},
+		},
+		Pods: []stats.PodStats{{
+			PodRef:    stats.PodReference{Name: "pod", Namespace: "ns"},
+			StartTime: unversioned.NewTime(startTime),
+			Network:   &stats.NetworkStats{Time: unversioned.NewTime(startTime), RxBytes: &value},
+			Containers: []stats.ContainerStats{{
+				Name:      "container",
+				StartTime: unversioned.NewTime(startTime),
+				CPU:       &stats.CPUStats{Time: unversioned.NewTime(startTime), UsageCoreNanoSeconds: &value},
+				Memory:    &stats.MemoryStats{Time: unversioned.NewTime(startTime), UsageBytes: &value},
+				Rootfs:    &stats.FsStats{UsedBytes: &value},
+			}},
+		}},
+	}
+	data, err := json.Marshal(&summary)
+	require.NoError(t, err)
+	server := httptest.NewServer(&util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: string(data),
+		T:            t,
+	})
+	defer server.Close()
+
+	// Too old a version for the summary API does not matter to virtual kubelets.
+	ms := testingVirtualSource(t, server, "aws")
+	res := ms.ScrapeMetrics(time.Now(), time.Now())
+	assert.False(t, ms.fallback.(*fakeSource).scraped)
+
+	node := res.MetricSets[core.NodeKey(nodeInfo.NodeName)]
+	require.NotNil(t, node)
+	_, found := node.MetricValues[core.MetricCpuUsage.Name]
+	assert.False(t, found)
+
+	pod := res.MetricSets[core.PodKey("ns", "pod")]
+	require.NotNil(t, pod)
+	_, found = pod.MetricValues[core.MetricNetworkRx.Name]
+	assert.False(t, found)
+
+	container := res.MetricSets[core.PodContainerKey("ns", "pod", "container")]
+	require.NotNil(t, container)
+	assert.Equal(t, int64(100), container.MetricValues[core.MetricMemoryUsage.Name].IntValue)
+	_, found = container.MetricValues[core.MetricCpuUsage.Name]
+	assert.True(t, found)
+	assert.Empty(t, container.LabeledMetrics)
+}
+
+func TestVirtualNodeWithoutFallback(t *testing.T) {
+	server := httptest.NewServer(&util.FakeHandler{
+		StatusCode: 404,
+		T:          t,
+	})
+	defer server.Close()
+
+	ms := testingVirtualSource(t, server, "azure")
+	ms.ScrapeMetrics(time.Now(), time.Now())
+	assert.False(t, ms.fallback.(*fakeSource).scraped)
+	assert.False(t, ms.useFallback)
+}
+
+func TestFailingNodeIsProbed(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	// A virtual kubelet without a stats endpoint.
+	ms := testingVirtualSource(t, server, "unknown")
+	for i := 0; i < maxScrapeFailures+2; i++ {
+		ms.ScrapeMetrics(time.Now(), time.Now())
+	}
+	assert.Equal(t, maxScrapeFailures, requests)
+	assert.True(t, ms.skipUntil.After(time.Now()))
+
+	// Probed again after the interval.
+	ms.skipUntil = time.Now()
+	ms.ScrapeMetrics(time.Now(), time.Now())
+	assert.True(t, ms.skipUntil.After(time.Now()))
+}
+
+func TestFailingRegularNodeIsScraped(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ms := testingVirtualSource(t, server, "")
+	for i := 0; i < maxScrapeFailures+2; i++ {
+		ms.ScrapeMetrics(time.Now(), time.Now())
+	}
+	assert.Equal(t, maxScrapeFailures+2, requests)
+	assert.True(t, ms.skipUntil.IsZero())
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package workload exports the state of the deployments, daemon sets and jobs read from the
+// Kubernetes API, in metric sets of their own.
+package workload
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/golang/glog"
+
+	. "k8s.io/heapster/metrics/core"
+	"k8s.io/heapster/metrics/sources/kubelet"
+	"k8s.io/heapster/metrics/util"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	"k8s.io/kubernetes/pkg/client/cache"
+	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+)
+
+// A source exporting the replicas of the deployments, the scheduled pods of the daemon sets
+// and the completions of the jobs.
+type workloadSource struct {
+	deployments cache.Store
+	daemonSets  cache.Store
+	jobs        cache.Store
+	// Pods, to count the ready pods of the daemon sets.
+	podLister *cache.StoreToPodLister
+}
+
+func (this *workloadSource) Name() string {
+	return this.String()
+}
+
+func (this *workloadSource) String() string {
+	return "workloads"
+}
+
+func (this *workloadSource) ScrapeMetrics(start, end time.Time) *DataBatch {
+	result := &DataBatch{
+		Timestamp:  end,
+		MetricSets: map[string]*MetricSet{},
+	}
+	for _, obj := range this.deployments.List() {
+		deployment, ok := obj.(*extensions.Deployment)
+		if !ok {
+			continue
+		}
+		ms := newMetricSet(&deployment.ObjectMeta, MetricSetTypeDeployment, end)
+		ms.Labels[LabelDeploymentName.Key] = deployment.Name
+		setInt(ms, &MetricDeploymentReplicasDesired, deployment.Spec.Replicas)
+		setInt(ms, &MetricDeploymentReplicasAvailable, deployment.Status.AvailableReplicas)
+		setInt(ms, &MetricDeploymentReplicasUpdated, deployment.Status.UpdatedReplicas)
+		setInt(ms, &MetricDeploymentReplicasUnavailable, deployment.Status.UnavailableReplicas)
+		result.MetricSets[DeploymentKey(deployment.Namespace, deployment.Name)] = ms
+	}
+	for _, obj := range this.daemonSets.List() {
+		daemonSet, ok := obj.(*extensions.DaemonSet)
+		if !ok {
+			continue
+		}
+		ms := newMetricSet(&daemonSet.ObjectMeta, MetricSetTypeDaemonSet, end)
+		ms.Labels[LabelDaemonSetName.Key] = daemonSet.Name
+		setInt(ms, &MetricDaemonSetScheduledDesired, daemonSet.Status.DesiredNumberScheduled)
+		setInt(ms, &MetricDaemonSetScheduledCurrent, daemonSet.Status.CurrentNumberScheduled)
+		setInt(ms, &MetricDaemonSetMisscheduled, daemonSet.Status.NumberMisscheduled)
+		if ready, err := this.readyPods(daemonSet.Namespace, daemonSet.Spec.Selector); err != nil {
+			glog.Errorf("Failed to count the ready pods of daemon set %s/%s: %v", daemonSet.Namespace, daemonSet.Name, err)
+		} else {
+			setInt(ms, &MetricDaemonSetReady, ready)
+		}
+		result.MetricSets[DaemonSetKey(daemonSet.Namespace, daemonSet.Name)] = ms
+	}
+	for _, obj := range this.jobs.List() {
+		job, ok := obj.(*batch.Job)
+		if !ok {
+			continue
+		}
+		ms := newMetricSet(&job.ObjectMeta, MetricSetTypeJob, end)
+		ms.Labels[LabelJobName.Key] = job.Name
+		// The jobs without completions are done when any of their pods succeeds.
+		if job.Spec.Completions != nil {
+			setInt(ms, &MetricJobCompletionsDesired, *job.Spec.Completions)
+		}
+		setInt(ms, &MetricJobActive, job.Status.Active)
+		setInt(ms, &MetricJobSucceeded, job.Status.Succeeded)
+		setInt(ms, &MetricJobFailed, job.Status.Failed)
+		result.MetricSets[JobKey(job.Namespace, job.Name)] = ms
+	}
+	return result
+}
+
+// Returns the number of running and ready pods of the namespace matching the selector.
+func (this *workloadSource) readyPods(namespace string, labelSelector *unversioned.LabelSelector) (int32, error) {
+	selector, err := unversioned.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return 0, err
+	}
+	pods, err := this.podLister.Pods(namespace).List(selector)
+	if err != nil {
+		return 0, err
+	}
+	ready := int32(0)
+	for _, pod := range pods {
+		if pod.Status.Phase != kube_api.PodRunning {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == kube_api.PodReady && condition.Status == kube_api.ConditionTrue {
+				ready++
+			}
+		}
+	}
+	return ready, nil
+}
+
+func newMetricSet(meta *kube_api.ObjectMeta, metricSetType string, now time.Time) *MetricSet {
+	ms := &MetricSet{
+		CreateTime:     meta.CreationTimestamp.Time,
+		ScrapeTime:     now,
+		MetricValues:   map[string]MetricValue{},
+		LabeledMetrics: []LabeledMetric{},
+		Labels: map[string]string{
+			LabelMetricSetType.Key: metricSetType,
+			LabelNamespaceName.Key: meta.Namespace,
+		},
+	}
+	if len(meta.Labels) > 0 {
+		ms.Labels[LabelLabels.Key] = util.LabelsToString(meta.Labels)
+	}
+	return ms
+}
+
+func setInt(ms *MetricSet, metric *Metric, value int32) {
+	ms.MetricValues[metric.Name] = MetricValue{
+		ValueType:  ValueInt64,
+		MetricType: metric.Type,
+		IntValue:   int64(value),
+	}
+}
+
+// Returns a store of the objects of the resource, kept up to date by a reflector.
+func watch(client cache.Getter, resource string, obj interface{}) cache.Store {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	lw := cache.NewListWatchFromClient(client, resource, kube_api.NamespaceAll, fields.Everything())
+	cache.NewReflector(lw, obj, store, time.Hour).Run()
+	return store
+}
+
+// NewWorkloadSource returns the source of the state of the workloads of the Kubernetes API of
+// the uri, given like the one of the kubernetes source, e.g.
+// workloads:https://kubernetes.default?inClusterConfig=true.
+func NewWorkloadSource(uri *url.URL) (MetricsSource, error) {
+	kubeConfig, _, err := kubelet.GetKubeConfigs(uri)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient := kube_client.NewOrDie(kubeConfig)
+	podLister, _, _ := util.GetPodLister(kubeClient)
+	return &workloadSource{
+		deployments: watch(kubeClient.ExtensionsClient, "deployments", &extensions.Deployment{}),
+		daemonSets:  watch(kubeClient.ExtensionsClient, "daemonsets", &extensions.DaemonSet{}),
+		jobs:        watch(kubeClient.BatchClient, "jobs", &batch.Job{}),
+		podLister:   podLister,
+	}, nil
+}
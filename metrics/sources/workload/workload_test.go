@@ -0,0 +1,123 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/heapster/metrics/core"
+	kube_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+func pod(name string, phase kube_api.PodPhase, ready kube_api.ConditionStatus) *kube_api.Pod {
+	return &kube_api.Pod{
+		ObjectMeta: kube_api.ObjectMeta{Namespace: "kube-system", Name: name, Labels: map[string]string{"app": "agent"}},
+		Status: kube_api.PodStatus{
+			Phase:      phase,
+			Conditions: []kube_api.PodCondition{{Type: kube_api.PodReady, Status: ready}},
+		},
+	}
+}
+
+func store(t *testing.T, objs ...interface{}) cache.Store {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, obj := range objs {
+		require.NoError(t, store.Add(obj))
+	}
+	return store
+}
+
+func TestWorkloadSource(t *testing.T) {
+	completions := int32(5)
+	source := &workloadSource{
+		deployments: store(t, &extensions.Deployment{
+			ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: "web", Labels: map[string]string{"tier": "front"}},
+			Spec:       extensions.DeploymentSpec{Replicas: 3},
+			Status:     extensions.DeploymentStatus{AvailableReplicas: 2, UpdatedReplicas: 3, UnavailableReplicas: 1},
+		}),
+		daemonSets: store(t, &extensions.DaemonSet{
+			ObjectMeta: kube_api.ObjectMeta{Namespace: "kube-system", Name: "agent"},
+			Spec:       extensions.DaemonSetSpec{Selector: &unversioned.LabelSelector{MatchLabels: map[string]string{"app": "agent"}}},
+			Status:     extensions.DaemonSetStatus{DesiredNumberScheduled: 4, CurrentNumberScheduled: 3, NumberMisscheduled: 1},
+		}),
+		jobs: store(t,
+			&batch.Job{
+				ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: "batch"},
+				Spec:       batch.JobSpec{Completions: &completions},
+				Status:     batch.JobStatus{Active: 2, Succeeded: 1, Failed: 1},
+			},
+			&batch.Job{ObjectMeta: kube_api.ObjectMeta{Namespace: "ns1", Name: "queue"}},
+		),
+		podLister: &cache.StoreToPodLister{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})},
+	}
+	for _, p := range []*kube_api.Pod{
+		pod("agent-1", kube_api.PodRunning, kube_api.ConditionTrue),
+		pod("agent-2", kube_api.PodRunning, kube_api.ConditionFalse),
+		pod("agent-3", kube_api.PodSucceeded, kube_api.ConditionTrue),
+	} {
+		require.NoError(t, source.podLister.Indexer.Add(p))
+	}
+
+	end := time.Now()
+	batch := source.ScrapeMetrics(end.Add(-time.Minute), end)
+	require.Len(t, batch.MetricSets, 4)
+	values := func(key string) map[string]int64 {
+		ms := batch.MetricSets[key]
+		require.NotNil(t, ms, key)
+		result := make(map[string]int64)
+		for name, value := range ms.MetricValues {
+			result[name] = value.IntValue
+		}
+		return result
+	}
+
+	deployment := batch.MetricSets[core.DeploymentKey("ns1", "web")]
+	require.NotNil(t, deployment)
+	assert.Equal(t, core.MetricSetTypeDeployment, deployment.Labels[core.LabelMetricSetType.Key])
+	assert.Equal(t, "web", deployment.Labels[core.LabelDeploymentName.Key])
+	assert.Equal(t, "tier:front", deployment.Labels[core.LabelLabels.Key])
+	assert.Equal(t, map[string]int64{
+		"deployment/replicas_desired":     3,
+		"deployment/replicas_available":   2,
+		"deployment/replicas_updated":     3,
+		"deployment/replicas_unavailable": 1,
+	}, values(core.DeploymentKey("ns1", "web")))
+
+	assert.Equal(t, "agent", batch.MetricSets[core.DaemonSetKey("kube-system", "agent")].Labels[core.LabelDaemonSetName.Key])
+	assert.Equal(t, map[string]int64{
+		"daemonset/scheduled_desired": 4,
+		"daemonset/scheduled_current": 3,
+		"daemonset/misscheduled":      1,
+		"daemonset/ready":             1,
+	}, values(core.DaemonSetKey("kube-system", "agent")))
+
+	assert.Equal(t, core.MetricSetTypeJob, batch.MetricSets[core.JobKey("ns1", "batch")].Labels[core.LabelMetricSetType.Key])
+	assert.Equal(t, map[string]int64{
+		"job/completions_desired": 5,
+		"job/active":              2,
+		"job/succeeded":           1,
+		"job/failed":              1,
+	}, values(core.JobKey("ns1", "batch")))
+	assert.NotContains(t, values(core.JobKey("ns1", "queue")), "job/completions_desired")
+}
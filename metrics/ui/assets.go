@@ -0,0 +1,321 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+// The UI only uses the model API, with paths relative to BasePath so that it also works
+// behind the apiserver proxy.
+
+const indexHtml = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Heapster</title>
+<link rel="stylesheet" href="ui.css">
+</head>
+<body>
+<header>
+  <h1>Heapster</h1>
+  <span id="updated"></span>
+  <span id="error"></span>
+</header>
+<section>
+  <h2>Cluster</h2>
+  <table id="cluster"></table>
+</section>
+<section>
+  <h2>Nodes</h2>
+  <table id="nodes"></table>
+</section>
+<section>
+  <h2>Namespaces</h2>
+  <table id="namespaces"></table>
+</section>
+<section>
+  <h2>Pods <span id="namespace"></span></h2>
+  <p id="pods-hint">Select a namespace to list its pods.</p>
+  <table id="pods"></table>
+</section>
+<section>
+  <h2>Events of the last hour</h2>
+  <table id="events"></table>
+</section>
+<script src="ui.js"></script>
+</body>
+</html>
+`
+
+const uiCss = `body {
+  font-family: sans-serif;
+  font-size: 14px;
+  margin: 0 2em 2em 2em;
+  color: #222;
+}
+header {
+  display: flex;
+  align-items: baseline;
+  border-bottom: 1px solid #ccc;
+}
+header h1 {
+  margin-right: 1em;
+}
+#updated {
+  color: #666;
+}
+#error {
+  color: #c00;
+  margin-left: 1em;
+}
+table {
+  border-collapse: collapse;
+  min-width: 40em;
+}
+th, td {
+  text-align: left;
+  padding: 0.3em 1em 0.3em 0;
+  border-bottom: 1px solid #eee;
+}
+td.number {
+  text-align: right;
+}
+tr.selectable {
+  cursor: pointer;
+}
+tr.selectable:hover, tr.selected {
+  background: #eef;
+}
+tr.Warning td {
+  color: #c60;
+}
+.bar {
+  display: inline-block;
+  width: 6em;
+  height: 0.8em;
+  background: #eee;
+  margin-left: 0.5em;
+}
+.bar span {
+  display: block;
+  height: 100%;
+  background: #48c;
+}
+`
+
+const uiJs = `(function() {
+  'use strict';
+
+  var model = '../api/v1/model';
+  var refreshInterval = 60 * 1000;
+  var selectedNamespace = null;
+
+  function get(path) {
+    return fetch(model + path, {credentials: 'same-origin'}).then(function(response) {
+      if (!response.ok) {
+        var err = new Error(response.status + ' ' + path);
+        err.status = response.status;
+        throw err;
+      }
+      return response.json();
+    });
+  }
+
+  // Returns the latest value of a metric result, or null if it has no points.
+  function latest(result) {
+    var value = null, timestamp = null;
+    (result.metrics || []).forEach(function(point) {
+      if (timestamp === null || point.timestamp > timestamp) {
+        timestamp = point.timestamp;
+        value = point.value;
+      }
+    });
+    return value;
+  }
+
+  function metric(path, name) {
+    return get(path + '/metrics/' + name).then(latest, function() { return null; });
+  }
+
+  function metrics(path, names) {
+    return Promise.all(names.map(function(name) { return metric(path, name); }));
+  }
+
+  function cpu(millicores) {
+    if (millicores === null) {
+      return '-';
+    }
+    return millicores < 1000 ? millicores + 'm' : (millicores / 1000).toFixed(2);
+  }
+
+  function memory(bytes) {
+    if (bytes === null) {
+      return '-';
+    }
+    var units = ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+    var i = 0;
+    while (bytes >= 1024 && i < units.length - 1) {
+      bytes /= 1024;
+      i++;
+    }
+    return bytes.toFixed(i === 0 ? 0 : 1) + ' ' + units[i];
+  }
+
+  function utilization(usage, capacity) {
+    var cell = document.createElement('td');
+    if (usage === null || !capacity) {
+      cell.textContent = '-';
+      return cell;
+    }
+    var share = Math.min(usage / capacity, 1);
+    cell.textContent = Math.round(100 * usage / capacity) + '%';
+    var bar = document.createElement('span');
+    bar.className = 'bar';
+    var fill = document.createElement('span');
+    fill.style.width = (100 * share) + '%';
+    bar.appendChild(fill);
+    cell.appendChild(bar);
+    return cell;
+  }
+
+  function cell(text, className) {
+    var td = document.createElement('td');
+    td.textContent = text;
+    if (className) {
+      td.className = className;
+    }
+    return td;
+  }
+
+  function fill(id, headers, rows) {
+    var table = document.getElementById(id);
+    table.innerHTML = '';
+    var head = document.createElement('tr');
+    headers.forEach(function(header) {
+      var th = document.createElement('th');
+      th.textContent = header;
+      head.appendChild(th);
+    });
+    table.appendChild(head);
+    rows.forEach(function(row) { table.appendChild(row); });
+  }
+
+  function row(cells) {
+    var tr = document.createElement('tr');
+    cells.forEach(function(td) { tr.appendChild(td); });
+    return tr;
+  }
+
+  function refreshNodes() {
+    return get('/nodes/').then(function(nodes) {
+      nodes.sort();
+      return Promise.all(nodes.map(function(node) {
+        return metrics('/nodes/' + encodeURIComponent(node),
+          ['cpu/usage_rate', 'cpu/node_capacity', 'memory/usage', 'memory/node_capacity']);
+      })).then(function(values) {
+        var total = [0, 0, 0, 0];
+        fill('nodes', ['Node', 'CPU', 'CPU capacity', 'CPU utilization', 'Memory', 'Memory capacity', 'Memory utilization'],
+          nodes.map(function(node, i) {
+            var v = values[i];
+            v.forEach(function(value, j) { total[j] += value || 0; });
+            return row([cell(node), cell(cpu(v[0]), 'number'), cell(cpu(v[1]), 'number'), utilization(v[0], v[1]),
+              cell(memory(v[2]), 'number'), cell(memory(v[3]), 'number'), utilization(v[2], v[3])]);
+          }));
+        fill('cluster', ['Nodes', 'CPU', 'CPU capacity', 'CPU utilization', 'Memory', 'Memory capacity', 'Memory utilization'],
+          [row([cell(String(nodes.length)), cell(cpu(total[0]), 'number'), cell(cpu(total[1]), 'number'), utilization(total[0], total[1]),
+            cell(memory(total[2]), 'number'), cell(memory(total[3]), 'number'), utilization(total[2], total[3])])]);
+      });
+    });
+  }
+
+  function refreshNamespaces() {
+    return get('/namespaces/').then(function(namespaces) {
+      namespaces.sort();
+      return Promise.all(namespaces.map(function(namespace) {
+        return metrics('/namespaces/' + encodeURIComponent(namespace),
+          ['cpu/usage_rate', 'cpu/request', 'memory/usage', 'memory/request']);
+      })).then(function(values) {
+        fill('namespaces', ['Namespace', 'CPU', 'CPU requests', 'Memory', 'Memory requests'],
+          namespaces.map(function(namespace, i) {
+            var v = values[i];
+            var tr = row([cell(namespace), cell(cpu(v[0]), 'number'), cell(cpu(v[1]), 'number'),
+              cell(memory(v[2]), 'number'), cell(memory(v[3]), 'number')]);
+            tr.className = 'selectable' + (namespace === selectedNamespace ? ' selected' : '');
+            tr.onclick = function() {
+              selectedNamespace = namespace;
+              refresh();
+            };
+            return tr;
+          }));
+      });
+    }, function(err) {
+      // The namespaces are only available when running in Kubernetes.
+      if (err.status !== 404) {
+        throw err;
+      }
+    });
+  }
+
+  function refreshPods() {
+    if (selectedNamespace === null) {
+      return Promise.resolve();
+    }
+    document.getElementById('namespace').textContent = 'in ' + selectedNamespace;
+    document.getElementById('pods-hint').style.display = 'none';
+    var namespacePath = '/namespaces/' + encodeURIComponent(selectedNamespace);
+    return get(namespacePath + '/pods/').then(function(pods) {
+      pods.sort();
+      if (pods.length === 0) {
+        fill('pods', ['Pod', 'CPU', 'Memory'], []);
+        return;
+      }
+      var list = namespacePath + '/pod-list/' + pods.map(encodeURIComponent).join(',');
+      return Promise.all([get(list + '/metrics/cpu/usage_rate'), get(list + '/metrics/memory/usage')]).then(function(values) {
+        fill('pods', ['Pod', 'CPU', 'Memory'], pods.map(function(pod, i) {
+          return row([cell(pod), cell(cpu(latest(values[0].items[i])), 'number'), cell(memory(latest(values[1].items[i])), 'number')]);
+        }));
+      });
+    });
+  }
+
+  function refreshEvents() {
+    var start = new Date(Date.now() - 60 * 60 * 1000).toISOString().replace(/\.\d+Z$/, 'Z');
+    return get('/events?start=' + start).then(function(events) {
+      events.reverse();
+      fill('events', ['Last seen', 'Namespace', 'Name', 'Type', 'Reason', 'Count', 'Message'], events.map(function(event) {
+        var tr = row([cell(new Date(event.lastTimestamp).toLocaleTimeString()), cell(event.namespace), cell(event.name),
+          cell(event.type), cell(event.reason), cell(String(event.count), 'number'), cell(event.message)]);
+        tr.className = event.type;
+        return tr;
+      }));
+    }, function(err) {
+      // The events are only available when heapster is started with --event_source.
+      if (err.status !== 404) {
+        throw err;
+      }
+      fill('events', ['Events are not available, heapster needs to be started with --event_source'], []);
+    });
+  }
+
+  function refresh() {
+    Promise.all([refreshNodes(), refreshNamespaces(), refreshPods(), refreshEvents()]).then(function() {
+      document.getElementById('error').textContent = '';
+      document.getElementById('updated').textContent = 'Updated ' + new Date().toLocaleTimeString();
+    }, function(err) {
+      document.getElementById('error').textContent = 'Failed to refresh: ' + err.message;
+    });
+  }
+
+  refresh();
+  setInterval(refresh, refreshInterval);
+})();
+`
@@ -0,0 +1,55 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ui serves a minimal web UI showing the utilization of the cluster, its nodes, namespaces
+// and pods from the model API, and the recent events. The assets are compiled into the binary.
+package ui
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Path under which the UI is served.
+const BasePath = "/ui/"
+
+type asset struct {
+	contentType string
+	content     string
+}
+
+var assets = map[string]asset{
+	"":           {contentType: "text/html; charset=utf-8", content: indexHtml},
+	"index.html": {contentType: "text/html; charset=utf-8", content: indexHtml},
+	"ui.css":     {contentType: "text/css; charset=utf-8", content: uiCss},
+	"ui.js":      {contentType: "application/javascript; charset=utf-8", content: uiJs},
+}
+
+// NewHandler returns the handler serving the UI assets under BasePath.
+func NewHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "HEAD" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		asset, found := assets[strings.TrimPrefix(req.URL.Path, BasePath)]
+		if !found {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", asset.contentType)
+		io.WriteString(w, asset.content)
+	})
+}
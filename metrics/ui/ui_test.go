@@ -0,0 +1,62 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle(BasePath, NewHandler())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string, expectedStatus int) (string, string) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, expectedStatus, resp.StatusCode, path)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.Header.Get("Content-Type"), string(body)
+	}
+
+	// The UI is served from its base path, with or without trailing slash.
+	for _, path := range []string{"/ui", "/ui/", "/ui/index.html"} {
+		contentType, body := get(path, http.StatusOK)
+		assert.True(t, strings.HasPrefix(contentType, "text/html"), path)
+		assert.Contains(t, body, `<script src="ui.js">`, path)
+	}
+	contentType, body := get("/ui/ui.js", http.StatusOK)
+	assert.True(t, strings.HasPrefix(contentType, "application/javascript"))
+	assert.Contains(t, body, "../api/v1/model")
+	contentType, _ = get("/ui/ui.css", http.StatusOK)
+	assert.True(t, strings.HasPrefix(contentType, "text/css"))
+
+	get("/ui/missing.js", http.StatusNotFound)
+
+	resp, err := http.Post(server.URL+"/ui/", "text/plain", strings.NewReader(""))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
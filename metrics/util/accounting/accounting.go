@@ -0,0 +1,175 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accounting attributes the goroutines, open connections and buffered bytes of
+// heapster to the sources and sinks owning them, so that a leaking integration can be
+// found from the /debug/resources endpoint or the heapster_accounting_* metrics.
+package accounting
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	goroutines = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "accounting",
+			Name:      "goroutines",
+			Help:      "Number of goroutines run by a source or sink.",
+		},
+		[]string{"owner"},
+	)
+
+	connections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "accounting",
+			Name:      "connections",
+			Help:      "Number of connections opened by a source or sink.",
+		},
+		[]string{"owner"},
+	)
+
+	bufferBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "accounting",
+			Name:      "buffer_bytes",
+			Help:      "Size of the data buffered by a source or sink in bytes.",
+		},
+		[]string{"owner"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(goroutines)
+	prometheus.MustRegister(connections)
+	prometheus.MustRegister(bufferBytes)
+}
+
+// Resources used by a source or sink.
+type Usage struct {
+	Goroutines  int64 `json:"goroutines"`
+	Connections int64 `json:"connections"`
+	BufferBytes int64 `json:"bufferBytes"`
+}
+
+// Ledger keeps the resources used by each owner.
+type Ledger struct {
+	sync.Mutex
+	usage map[string]*Usage
+	// Whether the usage is exported as Prometheus metrics.
+	export bool
+}
+
+// The ledger of the process.
+var DefaultLedger = &Ledger{usage: make(map[string]*Usage), export: true}
+
+// NewLedger creates a ledger whose usage isn't exported, e.g. for tests.
+func NewLedger() *Ledger {
+	return &Ledger{usage: make(map[string]*Usage)}
+}
+
+// SourceOwner returns the owner of the resources of a source, all the sources of a kind
+// (e.g. the kubelets of all the nodes) sharing the same owner.
+func SourceOwner(sourceName string) string {
+	return "source:" + strings.SplitN(sourceName, ":", 2)[0]
+}
+
+// SinkOwner returns the owner of the resources of a sink.
+func SinkOwner(sinkName string) string {
+	return "sink:" + sinkName
+}
+
+func (this *Ledger) add(owner string, goroutineDelta, connectionDelta, bufferDelta int64) {
+	this.Lock()
+	defer this.Unlock()
+	usage, found := this.usage[owner]
+	if !found {
+		usage = &Usage{}
+		this.usage[owner] = usage
+	}
+	usage.Goroutines += goroutineDelta
+	usage.Connections += connectionDelta
+	usage.BufferBytes += bufferDelta
+	if this.export {
+		goroutines.WithLabelValues(owner).Set(float64(usage.Goroutines))
+		connections.WithLabelValues(owner).Set(float64(usage.Connections))
+		bufferBytes.WithLabelValues(owner).Set(float64(usage.BufferBytes))
+	}
+}
+
+// Go runs the function in a goroutine accounted to the owner.
+func (this *Ledger) Go(owner string, f func()) {
+	this.add(owner, 1, 0, 0)
+	go func() {
+		defer this.add(owner, -1, 0, 0)
+		f()
+	}()
+}
+
+// AddBufferBytes accounts buffered data to the owner, or releases it if the size is negative.
+func (this *Ledger) AddBufferBytes(owner string, size int64) {
+	this.add(owner, 0, 0, size)
+}
+
+// Usage returns the resources currently used by each owner.
+func (this *Ledger) Usage() map[string]Usage {
+	this.Lock()
+	defer this.Unlock()
+	result := make(map[string]Usage, len(this.usage))
+	for owner, usage := range this.usage {
+		result[owner] = *usage
+	}
+	return result
+}
+
+// A connection released from the ledger when closed.
+type accountedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (this *accountedConn) Close() error {
+	this.once.Do(this.release)
+	return this.Conn.Close()
+}
+
+// Dial returns a dial function opening connections accounted to the owner with the given
+// one, or with a default dialer if it's nil.
+func (this *Ledger) Dial(owner string, dial func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).Dial
+	}
+	return func(network, address string) (net.Conn, error) {
+		conn, err := dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		this.add(owner, 0, 1, 0)
+		return &accountedConn{Conn: conn, release: func() { this.add(owner, 0, -1, 0) }}, nil
+	}
+}
+
+// DialTimeout opens a connection accounted to the owner, see net.DialTimeout.
+func (this *Ledger) DialTimeout(owner string, network, address string, timeout time.Duration) (net.Conn, error) {
+	return this.Dial(owner, (&net.Dialer{Timeout: timeout}).Dial)(network, address)
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounting
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwners(t *testing.T) {
+	assert.Equal(t, "source:kubelet_summary", SourceOwner("kubelet_summary:10.0.0.1:10255"))
+	assert.Equal(t, "source:kubelet", SourceOwner("kubelet"))
+	assert.Equal(t, "sink:Metric Sink", SinkOwner("Metric Sink"))
+}
+
+func TestGoroutines(t *testing.T) {
+	ledger := NewLedger()
+	release := make(chan bool)
+	done := make(chan bool)
+	for i := 0; i < 3; i++ {
+		ledger.Go("sink:a", func() {
+			<-release
+			done <- true
+		})
+	}
+	assert.Equal(t, Usage{Goroutines: 3}, ledger.Usage()["sink:a"])
+
+	for i := 0; i < 3; i++ {
+		release <- true
+		<-done
+	}
+	// The goroutines are released after the function returns.
+	for i := 0; i < 100 && ledger.Usage()["sink:a"].Goroutines > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, Usage{}, ledger.Usage()["sink:a"])
+}
+
+func TestConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	ledger := NewLedger()
+	first, err := ledger.DialTimeout("source:kubelet", "tcp", listener.Addr().String(), time.Second)
+	require.NoError(t, err)
+	second, err := ledger.Dial("source:kubelet", nil)("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), ledger.Usage()["source:kubelet"].Connections)
+
+	// Closing twice releases the connection once.
+	first.Close()
+	first.Close()
+	assert.Equal(t, int64(1), ledger.Usage()["source:kubelet"].Connections)
+	second.Close()
+	assert.Equal(t, int64(0), ledger.Usage()["source:kubelet"].Connections)
+
+	_, err = ledger.DialTimeout("source:kubelet", "tcp", "127.0.0.1:0", time.Second)
+	assert.Error(t, err)
+	assert.Equal(t, int64(0), ledger.Usage()["source:kubelet"].Connections)
+}
+
+func TestBufferBytes(t *testing.T) {
+	ledger := NewLedger()
+	ledger.AddBufferBytes("sink:a", 100)
+	ledger.AddBufferBytes("sink:b", 10)
+	ledger.AddBufferBytes("sink:a", -40)
+	assert.Equal(t, map[string]Usage{
+		"sink:a": {BufferBytes: 60},
+		"sink:b": {BufferBytes: 10},
+	}, ledger.Usage())
+}
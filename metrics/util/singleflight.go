@@ -0,0 +1,66 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"sync"
+)
+
+// The error returned to the callers waiting for a call whose function panicked.
+var errSingleFlightPanic = errors.New("the coalesced call panicked")
+
+type singleFlightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// SingleFlightGroup coalesces concurrent calls with the same key into a single execution,
+// whose result is shared by all the callers. The zero value is ready to use.
+type SingleFlightGroup struct {
+	lock  sync.Mutex
+	calls map[string]*singleFlightCall
+}
+
+// Do executes fn unless a call with the same key is already in flight, in which case it waits
+// for that call and returns its result. The returned bool is true if the result was shared.
+func (this *SingleFlightGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	this.lock.Lock()
+	if this.calls == nil {
+		this.calls = make(map[string]*singleFlightCall)
+	}
+	if call, found := this.calls[key]; found {
+		this.lock.Unlock()
+		call.wg.Wait()
+		return call.val, call.err, true
+	}
+	call := &singleFlightCall{}
+	call.wg.Add(1)
+	this.calls[key] = call
+	this.lock.Unlock()
+
+	// Deferred, so that the callers waiting for the call aren't blocked forever if fn panics.
+	defer func() {
+		this.lock.Lock()
+		delete(this.calls, key)
+		this.lock.Unlock()
+	}()
+	defer call.wg.Done()
+
+	call.err = errSingleFlightPanic
+	call.val, call.err = fn()
+	return call.val, call.err, false
+}
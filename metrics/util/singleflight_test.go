@@ -0,0 +1,119 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSingleFlightCoalescesCalls(t *testing.T) {
+	group := SingleFlightGroup{}
+	var executions int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&executions, 1)
+		<-release
+		return "result", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			val, err, _ := group.Do("key", fn)
+			assert.NoError(t, err)
+			results[i] = val
+		}(i)
+	}
+	// Give all the goroutines time to join the in-flight call.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&executions))
+	for _, val := range results {
+		assert.Equal(t, "result", val)
+	}
+}
+
+func TestSingleFlightSequentialCalls(t *testing.T) {
+	group := SingleFlightGroup{}
+	executions := 0
+	fn := func() (interface{}, error) {
+		executions++
+		return nil, errors.New("failed")
+	}
+
+	_, err, shared := group.Do("key", fn)
+	assert.Error(t, err)
+	assert.False(t, shared)
+	_, err, shared = group.Do("key", fn)
+	assert.Error(t, err)
+	assert.False(t, shared)
+	assert.Equal(t, 2, executions)
+}
+
+func TestSingleFlightPanic(t *testing.T) {
+	group := SingleFlightGroup{}
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			assert.NotNil(t, recover())
+		}()
+		group.Do("key", func() (interface{}, error) {
+			<-release
+			panic("failed")
+		})
+	}()
+	// Give the call time to start.
+	time.Sleep(100 * time.Millisecond)
+
+	waiter := make(chan error)
+	go func() {
+		_, err, shared := group.Do("key", func() (interface{}, error) {
+			return nil, nil
+		})
+		assert.True(t, shared)
+		waiter <- err
+	}()
+	// Give the waiter time to join the in-flight call.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	<-done
+
+	select {
+	case err := <-waiter:
+		assert.Equal(t, errSingleFlightPanic, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiter of the panicked call is blocked")
+	}
+
+	// The key isn't in flight anymore.
+	_, err, shared := group.Do("key", func() (interface{}, error) {
+		return "result", nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, shared)
+}
@@ -16,12 +16,17 @@ package util
 
 import (
 	"fmt"
+	"k8s.io/heapster/metrics/core"
 	kube_api "k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/client/cache"
 	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
 	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -39,6 +44,20 @@ func LabelsToString(labels map[string]string) string {
 	return strings.Join(output, labelSeperator)
 }
 
+// Splits labels concatenated by LabelsToString back into a map.
+func StringToLabels(labels string) map[string]string {
+	output := make(map[string]string)
+	if labels == "" {
+		return output
+	}
+	for _, pair := range strings.Split(labels, labelSeperator) {
+		if kv := strings.SplitN(pair, ":", 2); len(kv) == 2 {
+			output[kv[0]] = kv[1]
+		}
+	}
+	return output
+}
+
 func CopyLabels(labels map[string]string) map[string]string {
 	c := make(map[string]string, len(labels))
 	for key, val := range labels {
@@ -58,10 +77,71 @@ func SetLabelSeperator(seperator string) {
 	labelSeperator = seperator
 }
 
+func LabelSeperator() string {
+	return labelSeperator
+}
+
 func GetNodeLister(kubeClient *kube_client.Client) (*cache.StoreToNodeLister, *cache.Reflector, error) {
-	lw := cache.NewListWatchFromClient(kubeClient, "nodes", kube_api.NamespaceAll, fields.Everything())
+	return GetSelectedNodeLister(kubeClient, labels.Everything())
+}
+
+// GetSelectedNodeLister returns a lister of the nodes matching the label selector, which the
+// apiserver filters.
+func GetSelectedNodeLister(kubeClient *kube_client.Client, selector labels.Selector) (*cache.StoreToNodeLister, *cache.Reflector, error) {
+	lw := &cache.ListWatch{
+		ListFunc: func(options kube_api.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return kubeClient.Nodes().List(options)
+		},
+		WatchFunc: func(options kube_api.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return kubeClient.Nodes().Watch(options)
+		},
+	}
 	nodeLister := &cache.StoreToNodeLister{Store: cache.NewStore(cache.MetaNamespaceKeyFunc)}
 	reflector := cache.NewReflector(lw, &kube_api.Node{}, nodeLister.Store, time.Hour)
 	reflector.Run()
 	return nodeLister, reflector, nil
 }
+
+// Pod listers by API server, which are watched once for all the sources and processors.
+var podListers = struct {
+	sync.Mutex
+	listers map[string]*sharedPodLister
+}{listers: make(map[string]*sharedPodLister)}
+
+type sharedPodLister struct {
+	podLister *cache.StoreToPodLister
+	reflector *cache.Reflector
+}
+
+// GetPodLister returns a lister of the pods of the API server of the client. The listers of the
+// same API server share the same watch.
+func GetPodLister(kubeClient *kube_client.Client) (*cache.StoreToPodLister, *cache.Reflector, error) {
+	server := kubeClient.Get().URL().String()
+	podListers.Lock()
+	defer podListers.Unlock()
+	if shared, found := podListers.listers[server]; found {
+		return shared.podLister, shared.reflector, nil
+	}
+	lw := cache.NewListWatchFromClient(kubeClient, "pods", kube_api.NamespaceAll, fields.Everything())
+	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	podLister := &cache.StoreToPodLister{Indexer: store}
+	reflector := cache.NewReflector(lw, &kube_api.Pod{}, store, time.Hour)
+	reflector.Run()
+	podListers.listers[server] = &sharedPodLister{podLister: podLister, reflector: reflector}
+	return podLister, reflector, nil
+}
+
+// PodLabels returns the labels of the metric set of the pod, for the sources attaching metrics
+// to the pods.
+func PodLabels(pod *kube_api.Pod) map[string]string {
+	return map[string]string{
+		core.LabelMetricSetType.Key: core.MetricSetTypePod,
+		core.LabelPodId.Key:         string(pod.UID),
+		core.LabelPodName.Key:       pod.Name,
+		core.LabelNamespaceName.Key: pod.Namespace,
+		core.LabelPodNamespace.Key:  pod.Namespace,
+		core.LabelNodename.Key:      pod.Spec.NodeName,
+	}
+}